@@ -6,8 +6,9 @@ import (
 	"log"
 )
 
-// embed all static files
+// embed all static files, including the .br and .gz variants written by go generate
 //
+//go:generate go run ../cmd/compress-assets static
 //go:embed all:static
 var staticFS embed.FS
 
@@ -0,0 +1,4 @@
+-- title and description are extracted from the content when a post is saved
+-- NULL means not extracted yet; existing posts are backfilled by a background task
+ALTER TABLE posts ADD COLUMN title TEXT;
+ALTER TABLE posts ADD COLUMN description TEXT;
@@ -0,0 +1,13 @@
+-- single-row table holding the TOTP secret, encrypted with AUTH_TOTP_KEY
+CREATE TABLE IF NOT EXISTS two_factor
+(
+  id             INTEGER PRIMARY KEY CHECK (id = 1),
+  secret         TEXT    NOT NULL,
+  enabled        BOOLEAN NOT NULL DEFAULT FALSE,
+  -- JSON array of SHA-256 hashes of unused recovery codes
+  recovery_codes TEXT    NOT NULL DEFAULT '[]',
+  -- time step of the last accepted code, to reject replays
+  last_step      BIGINT  NOT NULL DEFAULT 0,
+  created_at     BIGINT  NOT NULL,
+  updated_at     BIGINT  NOT NULL
+);
@@ -0,0 +1,15 @@
+-- latest check of each external link found in posts
+CREATE TABLE IF NOT EXISTS link_checks
+(
+  url           TEXT PRIMARY KEY NOT NULL,
+  -- HTTP status of the last check, 0 if the request failed
+  status        INTEGER NOT NULL,
+  error         TEXT,
+  -- number of consecutive failed checks
+  failures      INTEGER NOT NULL DEFAULT 0,
+  checked_at    BIGINT  NOT NULL,
+  -- time of the first failure of the current run of failures
+  failing_since BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_checks_checked_at ON link_checks (checked_at);
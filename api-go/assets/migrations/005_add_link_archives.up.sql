@@ -0,0 +1,11 @@
+-- snapshots of the pages linked from posts, stored by the hash of their content
+CREATE TABLE IF NOT EXISTS link_archives
+(
+  url         TEXT PRIMARY KEY NOT NULL,
+  -- SHA-256 of the snapshot, also its file name in the upload storage
+  hash        TEXT    NOT NULL,
+  size        INTEGER NOT NULL,
+  archived_at BIGINT  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_archives_hash ON link_archives (hash);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS tag_merged_posts;
+DELETE FROM tags WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_tags_deleted_at;
+ALTER TABLE tags DROP COLUMN merged_into;
+ALTER TABLE tags DROP COLUMN deleted_at;
@@ -0,0 +1,21 @@
+-- deleted and merged tags stay in the trash until purged, so that they can be restored
+-- a tag in the trash keeps its name, using the name again takes the tag out of the trash
+ALTER TABLE tags ADD COLUMN deleted_at BIGINT;
+-- the tag this tag was merged into, NULL if it was deleted
+ALTER TABLE tags ADD COLUMN merged_into INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_tags_deleted_at ON tags (deleted_at);
+
+-- posts moved to another tag by a merge, to undo the merge on restore
+CREATE TABLE IF NOT EXISTS tag_merged_posts
+(
+  tag_id     INTEGER NOT NULL,
+  post_id    INTEGER NOT NULL,
+  -- content of the post before the merge
+  content    TEXT    NOT NULL,
+  -- whether the post was already tagged with the target tag
+  had_target BOOLEAN NOT NULL,
+  FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE,
+  FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+  CONSTRAINT uq_tag_merged_posts UNIQUE (tag_id, post_id)
+);
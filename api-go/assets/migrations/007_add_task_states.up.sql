@@ -0,0 +1,13 @@
+-- state of the background tasks kept across restarts
+CREATE TABLE IF NOT EXISTS task_states
+(
+  name        TEXT PRIMARY KEY NOT NULL,
+  enabled     BOOLEAN NOT NULL DEFAULT TRUE,
+  run_count   INTEGER NOT NULL DEFAULT 0,
+  error_count INTEGER NOT NULL DEFAULT 0,
+  retries     INTEGER NOT NULL DEFAULT 0,
+  -- in milliseconds, NULL if the task never ran
+  last_run    BIGINT,
+  last_error  TEXT    NOT NULL DEFAULT '',
+  updated_at  BIGINT  NOT NULL
+);
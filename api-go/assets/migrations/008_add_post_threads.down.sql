@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_root_id;
+ALTER TABLE posts DROP COLUMN depth;
+ALTER TABLE posts DROP COLUMN root_id;
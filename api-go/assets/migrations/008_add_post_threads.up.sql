@@ -0,0 +1,13 @@
+-- the post at the top of the thread of a post, itself for a post without parent
+ALTER TABLE posts ADD COLUMN root_id INTEGER;
+-- the number of parents above a post, 0 for a post without parent
+ALTER TABLE posts ADD COLUMN depth INTEGER NOT NULL DEFAULT 0;
+
+WITH RECURSIVE thread(id, root_id, depth) AS (
+  SELECT id, id, 0 FROM posts WHERE parent_id IS NULL
+  UNION ALL
+  SELECT p.id, t.root_id, t.depth + 1 FROM posts p JOIN thread t ON p.parent_id = t.id
+)
+UPDATE posts SET root_id = thread.root_id, depth = thread.depth FROM thread WHERE posts.id = thread.id;
+
+CREATE INDEX IF NOT EXISTS idx_posts_root_id ON posts (root_id);
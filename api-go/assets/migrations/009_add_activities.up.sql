@@ -0,0 +1,13 @@
+-- what happened in the vault, e.g. a post created or a tag renamed, newest last
+CREATE TABLE IF NOT EXISTS activities
+(
+  id         INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+  type       TEXT    NOT NULL,
+  -- the post or tag the activity is about, NULL for an import or a backup
+  subject_id INTEGER,
+  summary    TEXT    NOT NULL DEFAULT '',
+  created_at BIGINT  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_activities_type ON activities (type, id);
+CREATE INDEX IF NOT EXISTS idx_activities_created_at ON activities (created_at);
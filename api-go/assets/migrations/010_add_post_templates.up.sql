@@ -0,0 +1,13 @@
+-- reusable skeletons of posts, e.g. a daily note or meeting notes
+CREATE TABLE IF NOT EXISTS post_templates
+(
+  id         INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+  name       TEXT    NOT NULL UNIQUE,
+  -- HTML content with placeholders like {{date}}, expanded when a post is created from it
+  content    TEXT    NOT NULL,
+  -- JSON array of the names of the tags added to the posts created from it
+  tags       TEXT    NOT NULL DEFAULT '[]',
+  color      TEXT,
+  created_at BIGINT  NOT NULL,
+  updated_at BIGINT  NOT NULL
+);
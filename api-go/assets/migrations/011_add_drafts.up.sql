@@ -0,0 +1,13 @@
+-- drafts autosaved by the editor, kept until saved as a post, deleted or expired
+CREATE TABLE IF NOT EXISTS drafts
+(
+  -- chosen by the editor, e.g. new for a new post or post-42 for an edit of post 42
+  key        TEXT PRIMARY KEY NOT NULL,
+  content    TEXT    NOT NULL,
+  -- the post the draft edits, NULL for a new post
+  post_id    INTEGER,
+  updated_at BIGINT  NOT NULL,
+  expires_at BIGINT  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_drafts_expires_at ON drafts (expires_at);
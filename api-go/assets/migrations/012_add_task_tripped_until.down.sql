@@ -0,0 +1 @@
+ALTER TABLE task_states DROP COLUMN tripped_until;
@@ -0,0 +1,3 @@
+-- end of the cooldown of a task disabled by its circuit breaker, in milliseconds, NULL if it didn't trip
+-- a task restored before then is enabled again at the end of its cooldown
+ALTER TABLE task_states ADD COLUMN tripped_until BIGINT;
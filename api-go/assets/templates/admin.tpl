@@ -0,0 +1,263 @@
+{{define "admin"}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8">
+  <meta content="width=device-width, initial-scale=1" name="viewport">
+  <meta content="noindex" name="robots">
+  <title>{{.app_name}} admin</title>
+  <style>
+    :root {
+      --background: 220 23% 95%;
+      --foreground: 234 16% 35%;
+      --muted: 220 12% 50%;
+      --border: 220 16% 84%;
+      --primary: 266 85% 58%;
+      --success: 109 58% 40%;
+      --error: 347 87% 44%;
+    }
+
+    @media (prefers-color-scheme: dark) {
+      :root {
+        --background: 229 20% 20%;
+        --foreground: 232 28% 79%;
+        --muted: 229 12% 64%;
+        --border: 229 13% 32%;
+        --primary: 174 42% 65%;
+        --success: 115 54% 76%;
+        --error: 343 81% 75%;
+      }
+    }
+
+    body {
+      margin: 0;
+      padding: 1.5rem;
+      font-family: system-ui, sans-serif;
+      font-size: 0.9rem;
+      color: hsl(var(--foreground));
+      background-color: hsl(var(--background));
+    }
+
+    h1 {
+      font-size: 1.5rem;
+      margin: 0 0 1rem;
+    }
+
+    h2 {
+      font-size: 1.1rem;
+      margin: 2rem 0 0.75rem;
+    }
+
+    table {
+      width: 100%;
+      border-collapse: collapse;
+    }
+
+    th, td {
+      padding: 0.4rem 0.6rem;
+      text-align: left;
+      vertical-align: top;
+      border-bottom: 1px solid hsl(var(--border));
+    }
+
+    th {
+      color: hsl(var(--muted));
+      font-weight: 500;
+    }
+
+    a {
+      color: hsl(var(--primary));
+    }
+
+    code {
+      font-size: 0.8rem;
+      word-break: break-all;
+    }
+
+    .ok {
+      color: hsl(var(--success));
+    }
+
+    .error {
+      color: hsl(var(--error));
+    }
+
+    .muted {
+      color: hsl(var(--muted));
+    }
+
+    .message {
+      padding: 0.6rem 0.8rem;
+      margin-bottom: 1rem;
+      border: 1px solid currentColor;
+      border-radius: 0.25rem;
+    }
+
+    .actions {
+      display: flex;
+      flex-wrap: wrap;
+      gap: 0.5rem;
+    }
+
+    button {
+      padding: 0.4rem 0.8rem;
+      font: inherit;
+      color: hsl(var(--background));
+      background-color: hsl(var(--primary));
+      border: none;
+      border-radius: 0.25rem;
+      cursor: pointer;
+    }
+  </style>
+</head>
+<body>
+<h1>{{.app_name}} admin</h1>
+<p class="muted">Rendered at {{time .now}} &middot; <a href="/tasks/">task manager</a></p>
+
+{{if .message}}
+<div class="message {{if eq .status "error"}}error{{else}}ok{{end}}">{{.message}}</div>
+{{end}}
+
+<h2>Quick actions</h2>
+<div class="actions">
+  <form action="/admin/action" method="post">
+    <input name="action" type="hidden" value="reindex">
+    <button type="submit">Rebuild full-text index</button>
+  </form>
+  <form action="/admin/action" method="post" onsubmit="return confirm('Permanently delete all posts in the trash?')">
+    <input name="action" type="hidden" value="purge-trash">
+    <button type="submit">Purge trash</button>
+  </form>
+  <form action="/admin/action" method="post">
+    <input name="action" type="hidden" value="backup">
+    <button type="submit">Back up now</button>
+  </form>
+</div>
+
+<h2>Encrypted export</h2>
+<p class="muted">
+  Download the database, the uploaded files and the search index as a single file encrypted with a passphrase,
+  to keep a copy off-site. It can't be restored without the passphrase, keep it somewhere safe.
+</p>
+<form class="actions" action="/admin/export" method="post">
+  <input name="passphrase" type="password" placeholder="Passphrase" minlength="8" autocomplete="new-password" required>
+  <input name="confirm" type="password" placeholder="Confirm passphrase" minlength="8" autocomplete="new-password" required>
+  <button type="submit">Download export</button>
+</form>
+
+<h2>Health</h2>
+<table>
+  {{range .health}}
+  <tr>
+    <td>{{.Name}}</td>
+    <td class="{{if .OK}}ok{{else}}error{{end}}">{{if .OK}}healthy{{else}}unhealthy{{end}}</td>
+    <td>{{.Detail}}</td>
+  </tr>
+  {{end}}
+</table>
+
+<h2>Tasks{{with .label}} labelled {{.}} <a class="muted" href="?">(all)</a>{{end}}</h2>
+<table>
+  <tr>
+    <th>Name</th>
+    <th>Schedule</th>
+    <th>State</th>
+    <th>Last run</th>
+    <th>Next run</th>
+    <th>Runs</th>
+    <th>Errors</th>
+    <th>Last result</th>
+  </tr>
+  {{range .tasks}}
+  <tr>
+    <td><a href="?task={{.Name}}#history">{{.Name}}</a>{{range .Labels}} <a class="muted" href="?label={{.}}">#{{.}}</a>{{end}}</td>
+    <td><code title="{{schedule .Schedule}}">{{.Schedule}}</code></td>
+    <td>{{if .Running}}running{{else if .Enabled}}enabled{{else}}<span class="muted">disabled</span>{{end}}</td>
+    <td>{{time .LastRun}}</td>
+    <td>{{time .NextRun}}</td>
+    <td>{{.RunCount}}{{if .Retries}} <span class="muted" title="{{.LastAttempts}} of {{.MaxAttempts}} attempts on the last run">({{.Retries}} retries)</span>{{end}}</td>
+    <td {{if .LastError}}class="error" title="{{.LastError}}"{{end}}>{{.ErrorCount}}</td>
+    <td>{{with (index $.results .Name).Value}}<code>{{printf "%+v" .}}</code>{{else}}<span class="muted">-</span>{{end}}</td>
+  </tr>
+  {{end}}
+</table>
+
+{{with .history}}
+<h2 id="history">History of {{.Name}}</h2>
+{{if .Runs}}
+<table>
+  <tr>
+    <th>Started</th>
+    <th>Trigger</th>
+    <th>Duration</th>
+    <th>Attempts</th>
+    <th>Outcome</th>
+  </tr>
+  {{range .Runs}}
+  <tr>
+    <td>{{time .Start}}</td>
+    <td>{{.Trigger}}</td>
+    <td>{{.Duration}} ms</td>
+    <td>{{.Attempts}}</td>
+    <td>{{if .Error}}<span class="error">{{.Error}}</span>{{else}}<span class="ok">ok</span>{{end}}</td>
+  </tr>
+  {{end}}
+</table>
+{{else}}
+<p class="muted">No runs yet.</p>
+{{end}}
+{{if .NextRuns}}
+<p>Next runs: {{range $i, $run := .NextRuns}}{{if $i}} &middot; {{end}}{{time $run}}{{end}}</p>
+{{else}}
+<p class="muted">No run scheduled.</p>
+{{end}}
+{{end}}
+
+<h2>Database</h2>
+<table>
+  <tr><td>Connections</td><td>{{.db_stats.OpenConnections}} open, {{.db_stats.InUse}} in use, {{.db_stats.Idle}} idle, max {{.db_stats.MaxOpenConnections}}</td></tr>
+  <tr><td>Pool waits</td><td>{{.db_stats.WaitCount}} waits, {{.db_stats.WaitDuration}} ms</td></tr>
+  <tr><td>Write queue</td><td>{{.db_stats.WriteQueue.Depth}} queued, {{.db_stats.WriteQueue.Completed}} completed, {{.db_stats.WriteQueue.WaitAvg}} ms average wait, {{.db_stats.WriteQueue.WaitMax}} ms max wait</td></tr>
+  <tr><td>Journal mode</td><td>{{.db_stats.Pragmas.JournalMode}}</td></tr>
+</table>
+
+<h2>Storage</h2>
+<table>
+  <tr>
+    <th>Name</th>
+    <th>Path</th>
+    <th>Files</th>
+    <th>Size</th>
+  </tr>
+  {{range .storage}}
+  <tr>
+    <td>{{.Name}}</td>
+    <td><code>{{.Path}}</code></td>
+    <td>{{.Files}}</td>
+    <td>{{bytes .Bytes}}</td>
+  </tr>
+  {{end}}
+</table>
+
+<h2>Recent errors</h2>
+{{if .errors}}
+<table>
+  <tr>
+    <th>Time</th>
+    <th>Source</th>
+    <th>Error</th>
+  </tr>
+  {{range .errors}}
+  <tr>
+    <td>{{time .Time}}</td>
+    <td>{{.Source}}</td>
+    <td class="error">{{.Message}}</td>
+  </tr>
+  {{end}}
+</table>
+{{else}}
+<p class="muted">No recent errors.</p>
+{{end}}
+</body>
+</html>
+{{end}}
@@ -31,15 +31,49 @@
     margin-top: 0.5rem;
     color: hsl(var(--foreground) / 0.85);
   }
+
+  nav {
+    display: flex;
+    justify-content: space-between;
+    margin-top: 1rem;
+  }
+
+  .search {
+    display: flex;
+    gap: 0.5rem;
+    align-items: center;
+  }
+
+  .search input {
+    flex: 1;
+    padding: 0.3rem 0.5rem;
+    font: inherit;
+  }
 </style>
-<title>mote</title>
+{{if .feed_url}}
+<link href="{{.feed_url}}" rel="alternate" title="{{if .tag}}#{{.tag}}{{else}}mote{{end}}" type="application/atom+xml">
+{{end}}
+<title>{{if .tag}}#{{.tag}} - {{else if .query}}{{.query}} - {{end}}mote</title>
 {{end}}
 
 {{define "content"}}
+{{if .search_url}}
+<form action="{{.search_url}}" class="search" method="get" role="search">
+  <input aria-label="Search" name="q" placeholder="Search" type="search" value="{{.query}}">
+  <a href="{{.base_path}}/tags">Tags</a>
+  <a href="{{.base_path}}/feed.atom">Feed</a>
+</form>
+{{end}}
+{{if .tag}}
+<h1>#{{.tag}} <a href="{{.feed_url}}" style="font-size: 0.9rem">feed</a></h1>
+{{end}}
+{{if and .query (not .posts)}}
+<p>No posts found.</p>
+{{end}}
 <div class="articles">
   {{range .posts}}
   <article>
-    <a href="/shared/{{.ID}}" rel="prefetch">
+    <a href="{{$.base_path}}/{{.ID}}" rel="prefetch">
       <h2>{{if .Title}}{{.Title}}{{else}}Untitled{{end}}</h2>
       <time>{{.CreatedAt}}</time>
       {{if .Description}}
@@ -49,6 +83,12 @@
   </article>
   {{end}}
 </div>
+{{if or .prev_url .next_url}}
+<nav>
+  {{if .prev_url}}<a href="{{.prev_url}}" rel="prev">Newer</a>{{else}}<span></span>{{end}}
+  {{if .next_url}}<a href="{{.next_url}}" rel="next">Older</a>{{end}}
+</nav>
+{{end}}
 {{end}}
 
 {{define "scripts"}}{{end}}
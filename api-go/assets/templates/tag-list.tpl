@@ -0,0 +1,32 @@
+{{define "head"}}
+<style>
+  ul {
+    padding-left: 0;
+    list-style: none;
+  }
+
+  li {
+    padding: 0.3rem 0;
+  }
+
+  .count {
+    margin-left: 0.5rem;
+    color: hsl(var(--foreground) / 0.70);
+    font-size: 0.8rem;
+  }
+</style>
+<title>Tags - mote</title>
+{{end}}
+
+{{define "content"}}
+<h1>Tags</h1>
+<ul>
+  {{range .tags}}
+  <li>
+    <a href="{{$.base_path}}/tags/{{tagPath .Name}}">#{{.Name}}</a><span class="count">{{.Posts}}</span>
+  </li>
+  {{end}}
+</ul>
+{{end}}
+
+{{define "scripts"}}{{end}}
@@ -0,0 +1,107 @@
+// Command compress-assets writes gzip and brotli variants next to the files of a directory,
+// so they can be embedded and served pre-encoded
+//
+// Usage: go run ./cmd/compress-assets [dir]
+//
+// Brotli variants are written with the brotli command if it is installed
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// minSize is the size below which compression isn't worth a separate file
+const minSize = 1024
+
+// skipExts are formats that are already compressed
+var skipExts = map[string]bool{
+	".gz": true, ".br": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true,
+	".woff": true, ".woff2": true, ".zip": true,
+}
+
+func main() {
+	dir := "assets/static"
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+
+	brotli, err := exec.LookPath("brotli")
+	if err != nil {
+		log.Printf("brotli command not found, only gzip variants are written")
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || skipExts[strings.ToLower(filepath.Ext(path))] {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if len(data) < minSize {
+			return nil
+		}
+
+		if err := writeGzip(path, data); err != nil {
+			return fmt.Errorf("failed to gzip %s: %w", path, err)
+		}
+		if brotli != "" {
+			if err := writeBrotli(brotli, path, len(data)); err != nil {
+				return fmt.Errorf("failed to brotli %s: %w", path, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeGzip writes path.gz if it is smaller than the original
+func writeGzip(path string, data []byte) error {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if buf.Len() >= len(data) {
+		return os.Remove(path + ".gz")
+	}
+	log.Printf("%s: %d -> %d bytes (gzip)", path, len(data), buf.Len())
+	return os.WriteFile(path+".gz", buf.Bytes(), 0644)
+}
+
+// writeBrotli writes path.br with the brotli command, and removes it if it isn't smaller than the original
+func writeBrotli(brotli, path string, size int) error {
+	out := path + ".br"
+	if err := exec.Command(brotli, "--best", "--force", "--output="+out, path).Run(); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(out)
+	if err != nil {
+		return err
+	}
+	if info.Size() >= int64(size) {
+		return os.Remove(out)
+	}
+	log.Printf("%s: %d -> %d bytes (brotli)", path, size, info.Size())
+	return nil
+}
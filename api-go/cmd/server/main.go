@@ -1,17 +1,241 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // the timezones of daily counts, on hosts without a timezone database
 
 	"github.com/cymoo/mote/internal/app"
 	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/importer"
+	"github.com/cymoo/mote/internal/services"
 )
 
 func main() {
 	cfg := config.Load()
+
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(cfg, os.Args[2:]); err != nil {
+			log.Fatalf("import error: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		if !runDoctor(cfg, os.Args[2:]) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "reencode-index" {
+		if err := runReencodeIndex(cfg); err != nil {
+			log.Fatalf("reencode error: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExport(cfg, os.Args[2:]); err != nil {
+			log.Fatalf("export error: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := runRestore(cfg, os.Args[2:]); err != nil {
+			log.Fatalf("restore error: %v", err)
+		}
+		return
+	}
+
 	application := app.New(cfg)
 
 	if err := application.Run(); err != nil {
 		log.Fatalf("application error: %v", err)
 	}
 }
+
+// runImport imports the notes of an export directory or zip archive
+//
+// Usage: mote import -format memos|dayone|markdown [-dry-run] <path>
+func runImport(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "format of the export: "+strings.Join(importer.Formats(), ", "))
+	dryRun := flags.Bool("dry-run", false, "check the export without importing anything")
+	flags.Parse(args)
+
+	if *format == "" || flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	fsys, closeSource, err := importer.OpenSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+
+	application := app.New(cfg)
+	defer application.Close()
+
+	im := importer.New(application.GetDB(), services.NewUploadService(&cfg.Upload, application.GetImagePool()), application.GetFTS(), &cfg.Post)
+	progress, err := im.Run(context.Background(), *format, fsys, importer.Options{
+		DryRun: *dryRun,
+		OnProgress: func(p importer.Progress) {
+			fmt.Printf("\r%d/%d notes", p.Done, p.Total)
+		},
+	})
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+
+	for _, message := range progress.Errors {
+		fmt.Println("skipped", message)
+	}
+	verb := "imported"
+	if progress.DryRun {
+		verb = "would import"
+	}
+	fmt.Printf("%s %d notes with %d files, skipped %d\n", verb, progress.Imported, progress.Files, progress.Skipped)
+	return nil
+}
+
+// runDoctor checks the dependencies of the app and prints a report, it returns whether all checks passed
+//
+// Usage: mote doctor [-json]
+func runDoctor(cfg *config.Config, args []string) bool {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	flags.Parse(args)
+
+	report := app.Doctor(cfg)
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+		return report.OK
+	}
+
+	for _, check := range report.Checks {
+		status := "ok"
+		if !check.OK {
+			status = "FAIL"
+		}
+		fmt.Printf("%-4s  %-16s  %s (%dms)\n", status, check.Name, check.Detail, check.Duration)
+	}
+	return report.OK
+}
+
+// runReencodeIndex stores the indexed documents with the configured SEARCH_DOC_ENCODING
+//
+// Usage: mote reencode-index
+func runReencodeIndex(cfg *config.Config) error {
+	application := app.New(cfg)
+	defer application.Close()
+
+	report, err := application.GetFTS().MigrateEncoding(context.Background(), func(done, total int) {
+		fmt.Printf("\r%d/%d documents", done, total)
+	})
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("stored %d documents as %s: %d bytes before, %d bytes after\n",
+		report.Documents, report.Encoding, report.BytesBefore, report.BytesAfter)
+	return nil
+}
+
+// runExport writes an encrypted archive of the database, the uploads and the full-text index
+// The passphrase is read from EXPORT_PASSPHRASE, or from the standard input.
+//
+// Usage: mote export [-o archive]
+func runExport(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "mote-export-"+time.Now().Format("20060102-150405")+".mote", "path of the archive")
+	flags.Parse(args)
+
+	passphrase, err := readPassphrase()
+	if err != nil {
+		return err
+	}
+	if err := services.CheckPassphrase(passphrase); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	application := app.New(cfg)
+	defer application.Close()
+
+	report, err := services.Export(context.Background(), application.GetDB(), cfg.Upload.BasePath, application.GetFTS(),
+		file, passphrase)
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+	fmt.Printf("exported %d files (%d bytes) and %d index keys to %s\n",
+		report.Files, report.Bytes, report.IndexKeys, *output)
+	return nil
+}
+
+// runRestore replaces the data of the app with an encrypted archive written by export, the app must be stopped
+// The passphrase is read from EXPORT_PASSPHRASE, or from the standard input.
+//
+// Usage: mote restore <archive>
+func runRestore(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	passphrase, err := readPassphrase()
+	if err != nil {
+		return err
+	}
+	report, err := app.Restore(cfg, file, passphrase)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %d files (%d bytes) and %d index keys\n", report.Files, report.Bytes, report.IndexKeys)
+	return nil
+}
+
+// readPassphrase returns EXPORT_PASSPHRASE if set, or reads a line from the standard input
+func readPassphrase() (string, error) {
+	if passphrase := os.Getenv("EXPORT_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	fmt.Fprint(os.Stderr, "passphrase: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read the passphrase: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,8 +19,13 @@ import (
 
 	"github.com/cymoo/mote/assets"
 	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/notify"
+	"github.com/cymoo/mote/internal/services"
 	"github.com/cymoo/mote/internal/tasks"
 	"github.com/cymoo/mote/pkg/fulltext"
+	"github.com/cymoo/mote/pkg/util/precompressed"
+	"github.com/cymoo/mote/pkg/util/ring"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -28,16 +37,30 @@ import (
 	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite"
 
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 type App struct {
 	config *config.Config
-	db     *sqlx.DB
+	// db is shared by the services, so that they share its write queue and read replica, see services.DB
+	db     *services.DB
 	redis  *redis.Client
 	fts    *fulltext.FullTextSearch
-	tm     *mita.TaskManager
+	tm     *tasks.Manager
 	server *http.Server
+	// notifier delivers the notifications to the configured channels, nothing if there are none
+	notifier notify.Notifier
+	// images bounds the images processed at once, it is shared by all the services storing uploads
+	images *services.ImagePool
+
+	// taskResults keeps the latest result reported by each background task
+	taskResults *tasks.ResultStore
+	// requestLog keeps the most recent requests recorded by the debug log middleware
+	requestLog *ring.Buffer[models.RequestLogEntry]
+	// tracerProvider exports the spans of the app, nil unless tracing is enabled
+	tracerProvider *sdktrace.TracerProvider
 }
 
 // New creates a new App instance with the given configuration
@@ -58,6 +81,12 @@ func (app *App) initialize() error {
 	log.Printf("app config:\n%s", configJSON)
 	log.Println("=================================")
 
+	if app.config.Tracing.Enabled {
+		if err := app.initTracing(); err != nil {
+			return fmt.Errorf("failed to initialize tracing: %w", err)
+		}
+	}
+
 	if err := app.initDatabase(); err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
@@ -70,6 +99,14 @@ func (app *App) initialize() error {
 		return fmt.Errorf("failed to initialize full-text search: %w", err)
 	}
 
+	app.images = services.NewImagePool(&app.config.Upload)
+
+	notifier, enabled := notify.New(&app.config.Notify)
+	app.notifier = notifier
+	if enabled {
+		log.Println("notifications enabled")
+	}
+
 	if err := app.setupTasks(); err != nil {
 		return fmt.Errorf("failed to add tasks: %w", err)
 	}
@@ -81,24 +118,15 @@ func (app *App) initialize() error {
 
 // initDatabase initializes the database connection and runs migrations if enabled
 func (app *App) initDatabase() error {
-	if app.config.DB.AutoMigrate {
-		log.Println("running database migrations...")
-		if err := runMigrations(app.config.DB.URL); err != nil {
-			return fmt.Errorf("failed to run migrations: %w", err)
-		}
-	}
+	services.OnCheckpoint(app.onCheckpoint)
 
-	db, err := sqlx.Connect("sqlite", app.config.DB.URL)
+	// Per-connection pragmas are passed in the DSN, so that every pooled connection gets them
+	db, err := sqlx.Connect("sqlite", sqliteDSN(app.config.DB.URL, app.config.DB, false))
 	if err != nil {
 		log.Printf("database connection error: %v", app.config.DB.URL)
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	_, err = db.Exec("PRAGMA foreign_keys = ON")
-	if err != nil {
-		return fmt.Errorf("failed to enable foreign keys: %w", err)
-	}
-
 	_, err = db.Exec("PRAGMA journal_mode = WAL")
 	if err != nil {
 		return fmt.Errorf("failed to enable WAL mode: %w", err)
@@ -122,11 +150,82 @@ func (app *App) initDatabase() error {
 		return fmt.Errorf("database ping failed: %w", err)
 	}
 
-	app.db = db
+	app.db = services.NewDB(db)
+
+	// Migrations run between checkpoints, so that backups can snapshot the schema before and after
+	if app.config.DB.AutoMigrate {
+		log.Println("running database migrations...")
+		err := services.WithCheckpoints(context.Background(), app.db, "migrate", func() error {
+			return runMigrations(app.config.DB.URL)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+
 	log.Println("database connection established successfully")
+
+	if app.config.DB.ReadURL != "" {
+		if err := app.initReadReplica(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initReadReplica opens the read-only database serving read queries
+func (app *App) initReadReplica() error {
+	readDB, err := sqlx.Connect("sqlite", sqliteDSN(app.config.DB.ReadURL, app.config.DB, true))
+	if err != nil {
+		log.Printf("read database connection error: %v", app.config.DB.ReadURL)
+		return fmt.Errorf("failed to connect to read database: %w", err)
+	}
+
+	poolSize := app.config.DB.ReadPoolSize
+	readDB.SetMaxOpenConns(poolSize)
+	readDB.SetMaxIdleConns(poolSize)
+	readDB.SetConnMaxIdleTime(0)
+	readDB.SetConnMaxLifetime(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := readDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("read database ping failed: %w", err)
+	}
+
+	app.db.UseReadReplica(readDB)
+	log.Println("read database connection established successfully")
 	return nil
 }
 
+// onCheckpoint logs a checkpoint event and runs the configured checkpoint command
+func (app *App) onCheckpoint(ctx context.Context, event services.CheckpointEvent) {
+	if event.Error != "" {
+		log.Printf("checkpoint %s %s: %s", event.Phase, event.Operation, event.Error)
+	} else if event.Checkpoint != nil {
+		log.Printf("checkpoint %s %s: %d of %d frames checkpointed",
+			event.Phase, event.Operation, event.Checkpoint.Checkpointed, event.Checkpoint.Log)
+	}
+
+	command := app.config.DB.CheckpointCommand
+	if command == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"CHECKPOINT_OPERATION="+event.Operation,
+		"CHECKPOINT_PHASE="+event.Phase,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("checkpoint command failed: %v: %s", err, output)
+	}
+}
+
 // initRedis initializes the Redis client and tests the connection
 func (app *App) initRedis() error {
 	app.redis = redis.NewClient(&redis.Options{
@@ -134,6 +233,11 @@ func (app *App) initRedis() error {
 		Password: app.config.Redis.Password,
 		DB:       app.config.Redis.DB,
 	})
+	if app.tracerProvider != nil {
+		if err := redisotel.InstrumentTracing(app.redis, redisotel.WithTracerProvider(app.tracerProvider)); err != nil {
+			return fmt.Errorf("failed to trace redis: %w", err)
+		}
+	}
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -149,78 +253,235 @@ func (app *App) initRedis() error {
 
 // initFullTextSearch initializes the full-text search engine
 func (app *App) initFullTextSearch() error {
+	tokenizer, err := fulltext.NewTokenizer(app.config.Search.Tokenizer, app.config.Search.DictPaths...)
+	if err != nil {
+		return err
+	}
 	app.fts = fulltext.NewFullTextSearch(
 		app.redis,
-		fulltext.NewGseTokenizer(),
+		tokenizer,
 		"fts:",
-	)
+	).WithEncoding(fulltext.Encoding(app.config.Search.DocEncoding)).
+		WithPostingLimit(app.config.Search.PostingLimit)
 	log.Println("full-text search initialized successfully")
 	return nil
 }
 
 // setupTasks sets up the background tasks using mita
 func (app *App) setupTasks() error {
-	tm := mita.New()
+	app.taskResults = tasks.NewResultStore()
+	tm := tasks.NewManager(
+		tasks.WithTypedValue(tasks.ConfigKey, app.config),
+		tasks.WithTypedValue(tasks.DBKey, app.db),
+		tasks.WithTypedValue(tasks.FTSKey, app.fts),
+		tasks.WithTypedValue(tasks.UploadKey, services.NewUploadService(&app.config.Upload, app.images)),
+		tasks.WithTypedValue(tasks.ResultsKey, app.taskResults),
+	).WithShutdownTimeout(app.config.Task.ShutdownTimeout)
+	policy, err := tasks.ParseQueuePolicy(app.config.Task.QueuePolicy)
+	if err != nil {
+		return err
+	}
+	tm.WithQueue(app.config.Task.QueueSize, policy, app.config.Task.QueueTimeout).WithWorkers(app.config.Task.Workers)
+
+	var defaults []tasks.TaskOption
+	// run each task on one replica only
+	if app.config.Task.DistributedLock {
+		defaults = append(defaults, tasks.WithDistributedLock(app.redis))
+	}
+	// spread the scheduled runs of the replicas
+	if app.config.Task.Jitter > 0 {
+		defaults = append(defaults, tasks.WithJitter(app.config.Task.Jitter))
+	}
+	tm.SetDefaultOptions(defaults...)
 
-	tm.SetContextValue("db", app.db)
-	tm.SetContextValue("fts", app.fts)
+	// the tasks scanning or rewriting all posts run one at a time
+	dbHeavy := tasks.WithGroup("db-heavy", 1)
 
 	// delete old posts daily at 2:00 AM
-	if err := tm.AddTask("delete-old-posts", mita.Every().Day().At(2, 0), tasks.DeleteOldPosts); err != nil {
+	if err := tm.AddTask("delete-old-posts", mita.Every().Day().At(2, 0), tasks.DeleteOldPosts, tasks.WithRetry(3, time.Minute), dbHeavy, tasks.WithLabels("maintenance", "posts")); err != nil {
+		return err
+	}
+
+	// purge tags deleted longer than the retention period daily at 2:30 AM
+	if err := tm.AddTask("purge-deleted-tags", mita.Every().Day().At(2, 30), tasks.PurgeDeletedTags, dbHeavy, tasks.WithLabels("maintenance", "tags")); err != nil {
+		return err
+	}
+
+	// prune activities older than the retention period daily at 2:45 AM
+	if err := tm.AddTask("prune-activities", mita.Every().Day().At(2, 45), tasks.PruneActivities, tasks.WithLabels("maintenance")); err != nil {
+		return err
+	}
+
+	// purge the expired drafts of the editor daily at 2:50 AM
+	if err := tm.AddTask("purge-expired-drafts", mita.Every().Day().At(2, 50), tasks.PurgeExpiredDrafts, tasks.WithLabels("maintenance")); err != nil {
 		return err
 	}
 
 	// rebuild full-text index on the first day of each month at 2:00 AM
-	if err := tm.AddTask("rebuild-fulltext-index", mita.Every().Day().At(2, 0).OnDay(1), tasks.RebuildFullTextIndex); err != nil {
+	if err := tm.AddTask("rebuild-fulltext-index", mita.Every().Day().At(2, 0).OnDay(1), tasks.RebuildFullTextIndex, tasks.WithRetry(3, time.Minute), dbHeavy, tasks.WithLabels("search")); err != nil {
+		return err
+	}
+
+	// verify the full-text index against the database every 6 hours
+	if err := tm.AddTask("check-index-consistency", mita.Every().Hours(6), tasks.CheckIndexConsistency, tasks.WithRetry(3, time.Minute), dbHeavy, tasks.WithLabels("search")); err != nil {
+		return err
+	}
+
+	// fix children counts that drifted from the live children of posts daily at 3:15 AM
+	if err := tm.AddTask("recompute-children-counts", mita.Every().Day().At(3, 15), tasks.RecomputeChildrenCounts, dbHeavy, tasks.WithLabels("posts")); err != nil {
+		return err
+	}
+
+	// look for tokens in too many documents daily at 3:30 AM
+	if err := tm.AddTask("manage-stop-tokens", mita.Every().Day().At(3, 30), tasks.ManageStopTokens, tasks.WithLabels("search")); err != nil {
+		return err
+	}
+
+	// backfill titles of posts created before the title column existed
+	if err := tm.AddTask("backfill-post-titles", mita.Every().Day().At(3, 0), tasks.BackfillPostTitles, dbHeavy, tasks.WithLabels("posts")); err != nil {
+		return err
+	}
+
+	// check the external links of posts daily at 4:00 AM
+	if err := tm.AddTask("check-links", mita.Every().Day().At(4, 0), tasks.CheckLinks, tasks.WithLabels("posts")); err != nil {
 		return err
 	}
 
+	// bring the thumbnails up to date with the upload settings weekly on Sunday at 4:30 AM, or when run from the task API
+	if err := tm.AddTask("regenerate-thumbnails", mita.Every().Day().At(4, 30).OnWeekday(time.Sunday), tasks.RegenerateThumbnails, tasks.WithLabels("uploads")); err != nil {
+		return err
+	}
+
+	// keep the run counts and the enabled state of tasks across restarts
+	if store := app.taskStateStore(); store != nil {
+		// A missing table, e.g. with migrations pending, shouldn't keep the app from starting
+		if err := tm.Persist(context.Background(), store, app.config.Task.StateSaveInterval); err != nil {
+			log.Printf("error restoring the state of tasks, it won't be kept: %v", err)
+		}
+	}
+
+	// tell the owner about the failed runs
+	if app.config.Notify.TaskFailures {
+		tm.AddHooks(app.taskFailureHooks())
+	}
+
 	app.tm = tm
 
 	return nil
 }
 
+// taskFailureHooks notifies the failed runs of tasks, and the tasks disabled by their circuit breaker
+// The notifications are delivered in the background, so that a slow channel doesn't delay the runs.
+func (app *App) taskFailureHooks() tasks.Hooks {
+	notifyTask := func(title string) tasks.Hook {
+		return func(name, runID string, err error) {
+			msg := notify.Message{
+				Title:    fmt.Sprintf("[%s] %s: %s", app.config.AppName, title, name),
+				Body:     fmt.Sprintf("Task: %s\nRun: %s\nError: %v", name, runID, err),
+				Priority: notify.PriorityHigh,
+			}
+			notify.Go(app.notifier, msg, app.config.Notify.Timeout, func(err error) {
+				log.Printf("error notifying the failure of task %s: %v", name, err)
+			})
+		}
+	}
+	return tasks.Hooks{
+		OnFailure: notifyTask("task failed"),
+		OnTripped: notifyTask("task disabled after failing"),
+	}
+}
+
+// taskStateStore returns the configured store of the state of tasks, nil if it is not kept
+func (app *App) taskStateStore() tasks.StateStore {
+	switch app.config.Task.StateStore {
+	case "sqlite":
+		return services.NewTaskStateService(app.db)
+	case "redis":
+		return tasks.NewRedisStateStore(app.redis, "tasks:state")
+	}
+	return nil
+}
+
 // setupRoutes configures the HTTP routes and middleware
 func (app *App) setupRoutes() {
 	r := chi.NewRouter()
 
 	// Setup middleware
+	r.Use(middleware.RequestID)
+	if app.config.HTTP.TrustProxy {
+		r.Use(middleware.RealIP)
+	}
 	if app.config.Log.LogRequests {
 		r.Use(middleware.Logger)
 	}
+	if app.config.Log.Debug.Enabled {
+		app.requestLog = ring.New[models.RequestLogEntry](app.config.Log.Debug.BufferSize)
+		r.Use(DebugLog(app.config.Log.Debug, app.requestLog))
+	}
 
 	appEnv := app.config.AppEnv
 	r.Use(PanicRecovery(appEnv == "development" || appEnv == "dev"))
-	r.Use(CORS(app.config.HTTP.CORS))
+
+	// CORS is configured per mount, the API and uploads are meant for other origins, shared pages are not
+	apiCORS := CORS(app.config.HTTP.CORS)
+
+	// The URLs of the uploads are signed in the responses if a signing key is set, and only served with a signature
+	var signer *services.URLSigner
+	if key, _ := app.config.Upload.DecodeSigningKey(); key != nil {
+		signer = services.NewURLSigner(key, app.config.Upload.SignedURLTTL, app.config.Upload.BaseURL)
+	}
+	signURLs := SignUploadURLs(signer)
 
 	// Serve uploaded files
 	uploadUrl := app.config.Upload.BaseURL
 	uploadPath := app.config.Upload.BasePath
-	r.Handle(uploadUrl+"/*", http.StripPrefix(uploadUrl, http.FileServer(http.Dir(uploadPath))))
+	r.With(apiCORS, RequireSignedUploads(signer), SandboxArchives(uploadUrl+"/"+services.ArchiveDir+"/")).Handle(uploadUrl+"/*", http.StripPrefix(uploadUrl, http.FileServer(http.Dir(uploadPath))))
 
 	// Serve static files
 	staticUrl := app.config.StaticURL
 	staticPath := app.config.StaticPath
 
 	// Serve from embedded FS if no static path is set
-	var staticFs http.FileSystem
+	var staticFs fs.FS
 	if staticPath == "" {
-		staticFs = http.FS(assets.StaticFS())
+		staticFs = assets.StaticFS()
 	} else {
-		staticFs = http.Dir(staticPath)
+		staticFs = os.DirFS(staticPath)
 	}
 
-	r.Handle(staticUrl+"/*", http.StripPrefix(staticUrl, http.FileServer(staticFs)))
+	// Pre-compressed .br and .gz variants are served to clients accepting them, see cmd/compress-assets
+	r.Handle(staticUrl+"/*", http.StripPrefix(staticUrl, precompressed.FileServer(staticFs)))
 
 	// Health check endpoint
 	r.Get("/health", app.checkHealth)
 
-	// Mount task web ui
-	r.Mount("/", app.tm.WebHandler("/tasks"))
+	// Mount task web ui, reloaded by the event stream of the task API
+	r.Mount("/", app.tm.LiveWebHandler("/tasks", "/api/tasks/events"))
 
 	// Mount API and page routers
-	r.Mount("/api", NewApiRouter(app))
-	r.Mount("/shared", NewPageRouter(app))
+	r.With(apiCORS, signURLs).Mount("/api", NewApiRouter(app))
+	r.Mount("/admin", NewAdminRouter(app))
+	if len(app.config.HTTP.SharedCORS.AllowedOrigins) > 0 {
+		r.With(CORS(app.config.HTTP.SharedCORS), signURLs).Mount("/shared", NewPageRouter(app))
+	} else {
+		r.With(signURLs).Mount("/shared", NewPageRouter(app))
+	}
+
+	// The public API is meant for other origins like the shared pages, and is only served if keys are set
+	// The explore mode serves the whole vault there instead, the configuration allows only one of them
+	var publicRouter *chi.Mux
+	if app.config.PublicExplore {
+		publicRouter = NewExploreRouter(app)
+	} else if len(app.config.PublicAPI.Keys) > 0 {
+		publicRouter = NewPublicRouter(app)
+	}
+	if publicRouter != nil {
+		if len(app.config.HTTP.SharedCORS.AllowedOrigins) > 0 {
+			r.With(CORS(app.config.HTTP.SharedCORS), signURLs).Mount("/public", publicRouter)
+		} else {
+			r.With(signURLs).Mount("/public", publicRouter)
+		}
+	}
 
 	// Create HTTP server
 	app.server = &http.Server{
@@ -257,6 +518,9 @@ func (app *App) checkHealth(w http.ResponseWriter, r *http.Request) {
 func (app *App) Run() error {
 	// Start background tasks
 	app.tm.Start()
+	if err := app.tm.RunTaskNow("backfill-post-titles"); err != nil {
+		log.Printf("failed to backfill post titles: %v", err)
+	}
 
 	go func() {
 		log.Printf("server starting on %s", app.server.Addr)
@@ -288,7 +552,29 @@ func (app *App) Shutdown() error {
 		return fmt.Errorf("server shutdown failed: %w", err)
 	}
 
-	// Close database connection
+	if err := app.Close(); err != nil {
+		return err
+	}
+
+	// Export the spans still buffered
+	if app.tracerProvider != nil {
+		if err := app.tracerProvider.Shutdown(ctx); err != nil {
+			log.Printf("tracer provider shutdown failed: %v", err)
+		}
+	}
+
+	log.Println("server shutdown completed")
+	return nil
+}
+
+// Close closes the database and redis connections
+func (app *App) Close() error {
+	// Close database connections
+	if app.db != nil && app.db.Reader() != app.db.DB {
+		if err := app.db.Reader().Close(); err != nil {
+			return fmt.Errorf("read database connection close failed: %w", err)
+		}
+	}
 	if app.db != nil {
 		if err := app.db.Close(); err != nil {
 			return fmt.Errorf("database connection close failed: %w", err)
@@ -301,12 +587,10 @@ func (app *App) Shutdown() error {
 			return fmt.Errorf("redis connection close failed: %w", err)
 		}
 	}
-
-	log.Println("server shutdown completed")
 	return nil
 }
 
-func (app *App) GetDB() *sqlx.DB {
+func (app *App) GetDB() *services.DB {
 	return app.db
 }
 
@@ -318,6 +602,30 @@ func (app *App) GetFTS() *fulltext.FullTextSearch {
 	return app.fts
 }
 
+func (app *App) GetImagePool() *services.ImagePool {
+	return app.images
+}
+
+// sqliteDSN appends the per-connection pragmas of the config to the database URL
+// Read-only connections also refuse writes with query_only
+func sqliteDSN(dbURL string, config config.DBConfig, readOnly bool) string {
+	pragmas := url.Values{}
+	pragmas.Add("_pragma", "foreign_keys(1)")
+	if readOnly {
+		pragmas.Add("_pragma", "query_only(1)")
+	}
+	pragmas.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", config.BusyTimeout.Milliseconds()))
+	// A negative cache size is in KiB rather than pages
+	pragmas.Add("_pragma", fmt.Sprintf("cache_size(%d)", -config.CacheSize))
+	pragmas.Add("_pragma", fmt.Sprintf("mmap_size(%d)", config.MmapSize))
+
+	separator := "?"
+	if strings.Contains(dbURL, "?") {
+		separator = "&"
+	}
+	return dbURL + separator + pragmas.Encode()
+}
+
 // verifyForeignKeysConstraints checks if foreign key constraints are enabled
 func verifyForeignKeysConstraints(db *sqlx.DB) {
 	var rv int
@@ -0,0 +1,344 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mote/assets"
+	"github.com/cymoo/mote/internal/handlers"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+	"github.com/cymoo/mote/internal/tasks"
+	"github.com/cymoo/mote/pkg/util/safego"
+)
+
+// dashboardErrorCount is the number of recent errors shown on the dashboard
+const dashboardErrorCount = 10
+
+// healthCheck is the state of a dependency shown on the dashboard
+type healthCheck struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// storageUsage is the disk usage of a directory or file
+type storageUsage struct {
+	Name  string
+	Path  string
+	Files int
+	Bytes int64
+}
+
+// recentError is a failed task run or a failed request
+type recentError struct {
+	Source  string
+	Time    time.Time
+	Message string
+}
+
+// taskHistory is the last runs of a task, and the next ones
+type taskHistory struct {
+	Name     string
+	Runs     []tasks.TaskRun
+	NextRuns []time.Time
+}
+
+// nextRunsShown is the number of next runs shown with the history of a task
+const nextRunsShown = 5
+
+// Dashboard renders the admin dashboard, combining the state of tasks, dependencies and storage
+type Dashboard struct {
+	app         *App
+	template    *template.Template
+	postHandler *handlers.PostHandler
+}
+
+func NewDashboard(app *App) *Dashboard {
+	uploadService := services.NewUploadService(&app.config.Upload, app.images)
+	postHandler := handlers.NewPostHandler(
+		services.NewPostService(app.db),
+		services.NewTagService(app.db),
+		uploadService,
+		app.fts,
+		&app.config.Post,
+		services.NewTagAliasScanner(app.config.Post.TagAliases),
+		services.NewArchiveService(app.db, uploadService, &app.config.Archive),
+		services.NewStatsCache(app.db, app.config.Post.StatsCacheTTL),
+		services.NewViewService(app.redis),
+	)
+
+	return &Dashboard{app: app, template: parseDashboardTemplate(), postHandler: postHandler}
+}
+
+func parseDashboardTemplate() *template.Template {
+	return template.Must(template.New("").Funcs(template.FuncMap{
+		"bytes":    formatBytes,
+		"schedule": tasks.Describe,
+		"time": func(t time.Time) string {
+			if t.IsZero() {
+				return "-"
+			}
+			return t.Format("2006-01-02 15:04:05")
+		},
+	}).ParseFS(assets.TemplateFS(), "templates/admin.tpl"))
+}
+
+// Index renders the dashboard, with the message of the last action if any
+func (d *Dashboard) Index(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	app := d.app
+
+	taskList := app.tm.ListTasks()
+	sort.Slice(taskList, func(i, j int) bool { return taskList[i].Name < taskList[j].Name })
+	// The tasks with a label are listed when it is clicked, the errors are the ones of all tasks
+	label := r.URL.Query().Get("label")
+	shown := taskList
+	if label != "" {
+		shown = slices.DeleteFunc(slices.Clone(taskList), func(task *tasks.TaskInfo) bool {
+			return !slices.Contains(task.Labels, label)
+		})
+	}
+
+	dbStats, err := handlers.NewAdminHandler(app.db).GetDBStats(r)
+	if err != nil {
+		log.Printf("error reading db stats: %v", err)
+	}
+
+	// The history of a task is shown when its name is clicked
+	var history *taskHistory
+	if name := r.URL.Query().Get("task"); name != "" {
+		if runs, err := app.tm.GetTaskHistory(name); err == nil {
+			next, _ := app.tm.GetNextRuns(name, nextRunsShown)
+			history = &taskHistory{Name: name, Runs: runs, NextRuns: next}
+		}
+	}
+
+	data := map[string]any{
+		"app_name": app.config.AppName,
+		"message":  r.URL.Query().Get("msg"),
+		"status":   r.URL.Query().Get("status"),
+		"tasks":    shown,
+		"label":    label,
+		"results":  app.taskResults.All(),
+		"health":   d.health(ctx),
+		"db_stats": dbStats,
+		"storage":  d.storage(ctx),
+		"errors":   d.recentErrors(taskList),
+		"history":  history,
+		"now":      time.Now(),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := d.template.ExecuteTemplate(w, "admin", data); err != nil {
+		log.Printf("error rendering dashboard: %v", err)
+	}
+}
+
+// Action runs a quick action and redirects back to the dashboard with its outcome
+func (d *Dashboard) Action(w http.ResponseWriter, r *http.Request) {
+	var message string
+	var err error
+
+	switch action := r.FormValue("action"); action {
+	case "reindex":
+		err = d.app.tm.RunTaskNow("rebuild-fulltext-index")
+		message = "Rebuilding the full-text index"
+	case "purge-trash":
+		_, err = d.postHandler.ClearPosts(r)
+		message = "Purged the trash"
+	case "backup":
+		var path string
+		path, err = services.Backup(r.Context(), d.app.db, d.app.config.DB.BackupPath)
+		message = "Backed up the database to " + path
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	status := "success"
+	if err != nil {
+		log.Printf("error running dashboard action %s: %v", r.FormValue("action"), err)
+		status, message = "error", err.Error()
+	}
+
+	query := url.Values{"status": {status}, "msg": {message}}
+	http.Redirect(w, r, "/admin/?"+query.Encode(), http.StatusSeeOther)
+}
+
+// Export downloads an encrypted archive of the data of the app, protected by the passphrase of the form
+// See services.Export, it is restored with "mote restore".
+func (d *Dashboard) Export(w http.ResponseWriter, r *http.Request) {
+	passphrase := r.FormValue("passphrase")
+	err := services.CheckPassphrase(passphrase)
+	if err == nil && passphrase != r.FormValue("confirm") {
+		err = errors.New("the passphrases don't match")
+	}
+	if err != nil {
+		query := url.Values{"status": {"error"}, "msg": {err.Error()}}
+		http.Redirect(w, r, "/admin/?"+query.Encode(), http.StatusSeeOther)
+		return
+	}
+
+	name := "mote-export-" + time.Now().Format("20060102-150405") + ".mote"
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	// The download is cut short on an error, which restoring the archive detects as its last chunk is missing
+	report, err := services.Export(r.Context(), d.app.db, d.app.config.Upload.BasePath, d.app.fts, w, passphrase)
+	if err != nil {
+		log.Printf("error exporting: %v", err)
+		return
+	}
+	log.Printf("exported %d files (%s)", report.Files, formatBytes(report.Bytes))
+}
+
+// health checks the database, Redis, the full-text index and the goroutines run in the background
+func (d *Dashboard) health(ctx context.Context) []healthCheck {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	app := d.app
+	checks := []healthCheck{{Name: "Database", OK: true, Detail: "ok"}}
+	if err := app.db.PingContext(ctx); err != nil {
+		checks[0] = healthCheck{Name: "Database", Detail: err.Error()}
+	}
+
+	redisCheck := healthCheck{Name: "Redis", OK: true, Detail: "ok"}
+	if err := app.redis.Ping(ctx).Err(); err != nil {
+		redisCheck = healthCheck{Name: "Redis", Detail: err.Error()}
+	}
+	checks = append(checks, redisCheck)
+
+	ftsCheck := healthCheck{Name: "Full-text index"}
+	docs, err := app.fts.GetDocCount(ctx)
+	posts, postsErr := services.NewPostService(app.db).GetCount(ctx)
+	switch {
+	case err != nil:
+		ftsCheck.Detail = err.Error()
+	case postsErr != nil:
+		ftsCheck.Detail = postsErr.Error()
+	default:
+		ftsCheck.OK = docs == posts
+		ftsCheck.Detail = fmt.Sprintf("%d documents for %d posts", docs, posts)
+	}
+	if result, ok := app.taskResults.Get("check-index-consistency"); ok {
+		if check, ok := result.Value.(tasks.IndexCheckResult); ok {
+			ftsCheck.Detail += fmt.Sprintf(", last drift %.2f%%", check.Drift*100)
+		}
+	}
+	checks = append(checks, ftsCheck)
+
+	backgroundCheck := healthCheck{Name: "Background goroutines", OK: true, Detail: "no panics"}
+	if panics := safego.Stats(); len(panics) > 0 {
+		latest := slices.MaxFunc(panics, func(a, b safego.Stat) int { return a.LastAt.Compare(b.LastAt) })
+		backgroundCheck = healthCheck{
+			Name:   "Background goroutines",
+			Detail: fmt.Sprintf("%d panics recovered, last in %s: %s", safego.Total(), latest.Name, latest.Last),
+		}
+	}
+	checks = append(checks, backgroundCheck)
+
+	return checks
+}
+
+// storage reports the disk usage of the database, uploads and backups
+func (d *Dashboard) storage(ctx context.Context) []storageUsage {
+	var usage []storageUsage
+
+	var dbFile string
+	if err := d.app.db.GetContext(ctx, &dbFile, "SELECT file FROM pragma_database_list WHERE name = 'main'"); err == nil && dbFile != "" {
+		db := storageUsage{Name: "Database", Path: dbFile}
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if info, err := os.Stat(dbFile + suffix); err == nil {
+				db.Files++
+				db.Bytes += info.Size()
+			}
+		}
+		usage = append(usage, db)
+	}
+
+	uploads := d.app.config.Upload.BasePath
+	usage = append(usage,
+		dirUsage("Uploads", uploads),
+		dirUsage("Link archives", filepath.Join(uploads, services.ArchiveDir)),
+		dirUsage("Backups", d.app.config.DB.BackupPath),
+	)
+	return usage
+}
+
+// recentErrors collects the last errors of tasks and, with the debug log, of requests
+func (d *Dashboard) recentErrors(taskList []*tasks.TaskInfo) []recentError {
+	var errs []recentError
+	for _, task := range taskList {
+		if task.LastError != "" {
+			errs = append(errs, recentError{Source: "task " + task.Name, Time: task.LastRun, Message: task.LastError})
+		}
+	}
+
+	if d.app.requestLog != nil {
+		for _, entry := range d.app.requestLog.Items() {
+			if entry.Status >= 500 {
+				errs = append(errs, recentError{
+					Source:  entry.Method + " " + entry.URL,
+					Time:    time.UnixMilli(entry.Time),
+					Message: requestError(entry),
+				})
+			}
+		}
+	}
+
+	slices.SortFunc(errs, func(a, b recentError) int { return b.Time.Compare(a.Time) })
+	return errs[:min(len(errs), dashboardErrorCount)]
+}
+
+func requestError(entry models.RequestLogEntry) string {
+	message := http.StatusText(entry.Status)
+	if body := strings.TrimSpace(entry.ResponseBody); body != "" {
+		message += ": " + body
+	}
+	return message
+}
+
+// dirUsage sums the size of the files under a directory, a missing directory is empty
+func dirUsage(name, dir string) storageUsage {
+	usage := storageUsage{Name: name, Path: dir}
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			usage.Files++
+			usage.Bytes += info.Size()
+		}
+		return nil
+	})
+	return usage
+}
+
+// formatBytes formats a size with a binary unit, e.g. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/tasks"
+)
+
+func TestDashboardTemplate(t *testing.T) {
+	data := map[string]any{
+		"app_name": "mote",
+		"message":  "Backed up",
+		"status":   "success",
+		"tasks": []*tasks.TaskInfo{
+			{TaskInfo: &mita.TaskInfo{Name: "check-links", Schedule: "0 4 * * *", Enabled: true, LastRun: time.Now()}, Labels: []string{"posts"}},
+			{TaskInfo: &mita.TaskInfo{Name: "delete-old-posts", Schedule: "0 2 * * *", LastError: "failed"}, MaxAttempts: 3, Retries: 2},
+		},
+		"results": map[string]tasks.Result{
+			"check-links": {Value: tasks.LinkCheckResult{Checked: 3}, RecordedAt: time.Now()},
+		},
+		"health":   []healthCheck{{Name: "Redis", Detail: "connection refused"}},
+		"db_stats": models.DBStats{},
+		"storage":  []storageUsage{{Name: "Uploads", Path: "./uploads", Files: 2, Bytes: 1536}},
+		"errors":   []recentError{{Source: "task delete-old-posts", Message: "failed"}},
+		"history": &taskHistory{Name: "delete-old-posts", Runs: []tasks.TaskRun{
+			{Start: time.Now(), Trigger: tasks.TriggerManual, Duration: 42, Attempts: 3, Error: "database is locked"},
+		}, NextRuns: []time.Time{time.Date(2024, 6, 16, 2, 0, 0, 0, time.Local)}},
+		"now": time.Now(),
+	}
+
+	var b strings.Builder
+	if err := parseDashboardTemplate().ExecuteTemplate(&b, "admin", data); err != nil {
+		t.Fatalf("failed to render the dashboard: %v", err)
+	}
+
+	for _, expected := range []string{"Backed up", "check-links", "Checked:3", "connection refused", "1.5 KiB", "2 retries", "History of delete-old-posts", "database is locked", "Next runs: 2024-06-16 02:00:00", "every day at 04:00", `href="?label=posts"`} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("expected the dashboard to contain %q", expected)
+		}
+	}
+}
+
+func TestDirUsage(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a"), make([]byte, 10), 0644)
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "sub", "b"), make([]byte, 5), 0644)
+
+	usage := dirUsage("test", dir)
+	if usage.Files != 2 || usage.Bytes != 15 {
+		t.Errorf("expected 2 files and 15 bytes, got %+v", usage)
+	}
+
+	if missing := dirUsage("missing", filepath.Join(dir, "missing")); missing.Files != 0 {
+		t.Errorf("expected a missing directory to be empty, got %+v", missing)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 * 1024 * 1024: "5.0 MiB"}
+	for n, expected := range tests {
+		if got := formatBytes(n); got != expected {
+			t.Errorf("formatBytes(%d) = %q, expected %q", n, got, expected)
+		}
+	}
+}
@@ -1,18 +1,27 @@
 package app
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"math/rand/v2"
 	"net/http"
+	"regexp"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cymoo/mote/internal/config"
 	e "github.com/cymoo/mote/internal/errors"
+	"github.com/cymoo/mote/internal/handlers"
+	"github.com/cymoo/mote/internal/models"
 	"github.com/cymoo/mote/internal/services"
+	"github.com/cymoo/mote/pkg/util/ring"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -37,50 +46,64 @@ func PanicRecovery(logTrace bool) func(http.Handler) http.Handler {
 }
 
 // CORS returns a net/http middleware that handles CORS requests
+// Origins are matched exactly, by a wildcard subdomain such as https://*.example.com, or by "*"
+// If no origins are configured, all origins are allowed
 // config: CORS configuration
 func CORS(config config.CORSConfig) func(http.Handler) http.Handler {
+	allowOrigin := originMatcher(config.AllowedOrigins)
+
+	// Set allowed methods
+	methods := "GET, POST, PUT, DELETE, OPTIONS"
+	if len(config.AllowedMethods) > 0 {
+		methods = strings.Join(config.AllowedMethods, ", ")
+	}
+
+	// Set default headers if none specified
+	headers := "Content-Type, Authorization"
+	if len(config.AllowedHeaders) > 0 {
+		headers = strings.Join(config.AllowedHeaders, ", ")
+	}
+
+	// A wildcard response is the same for every origin, otherwise caches must key on the origin
+	allowAll := len(config.AllowedOrigins) == 0 && !config.AllowCredentials
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			origin := r.Header.Get("Origin")
 
-			// If no origins are specified, allow all origins
-			if len(config.AllowedOrigins) == 0 {
-				w.Header().Set("Access-Control-Allow-Origin", "*")
-			} else {
-				// Check if the request origin is in the allowed list
-				for _, allowedOrigin := range config.AllowedOrigins {
-					if allowedOrigin == "*" || allowedOrigin == origin {
-						w.Header().Set("Access-Control-Allow-Origin", origin)
-						break
-					}
-				}
+			if !allowAll {
+				w.Header().Add("Vary", "Origin")
 			}
-			// Set allowed methods
-			methods := "GET, POST, PUT, DELETE, OPTIONS"
-			if len(config.AllowedMethods) > 0 {
-				methods = strings.Join(config.AllowedMethods, ", ")
+
+			// Not a CORS request, or from an origin that is not allowed
+			if origin == "" || !allowOrigin(origin) {
+				next.ServeHTTP(w, r)
+				return
 			}
-			w.Header().Set("Access-Control-Allow-Methods", methods)
 
-			// Set default headers if none specified
-			headers := "Content-Type, Authorization"
-			if len(config.AllowedHeaders) > 0 {
-				headers = strings.Join(config.AllowedHeaders, ", ")
+			if allowAll {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
 			}
-			w.Header().Set("Access-Control-Allow-Headers", headers)
 
 			// Set Allow-Credentials header
 			if config.AllowCredentials {
 				w.Header().Set("Access-Control-Allow-Credentials", "true")
 			}
 
-			// Set Access-Control-Max-Age header
-			if config.MaxAge > 0 {
-				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
-			}
+			// Handle preflight requests, other OPTIONS requests are passed to the router
+			if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+
+				// Set Access-Control-Max-Age header
+				if config.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
+				}
 
-			// Handle preflight requests
-			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusNoContent)
 				return
 			}
@@ -90,6 +113,41 @@ func CORS(config config.CORSConfig) func(http.Handler) http.Handler {
 	}
 }
 
+// originMatcher returns a function reporting whether an origin is allowed
+func originMatcher(allowedOrigins []string) func(string) bool {
+	if len(allowedOrigins) == 0 || slices.Contains(allowedOrigins, "*") {
+		return func(string) bool { return true }
+	}
+
+	exact := make(map[string]bool)
+	// wildcard subdomains are stored as scheme and domain suffix, e.g. "https://" and ".example.com"
+	type wildcard struct{ scheme, suffix string }
+	var wildcards []wildcard
+
+	for _, origin := range allowedOrigins {
+		if scheme, domain, ok := strings.Cut(origin, "://*."); ok {
+			wildcards = append(wildcards, wildcard{scheme + "://", "." + domain})
+		} else {
+			exact[origin] = true
+		}
+	}
+
+	return func(origin string) bool {
+		if exact[origin] {
+			return true
+		}
+		for _, w := range wildcards {
+			host, ok := strings.CutPrefix(origin, w.scheme)
+			// the subdomain must be non-empty and must not smuggle in another host
+			if ok && strings.HasSuffix(host, w.suffix) && len(host) > len(w.suffix) &&
+				!strings.ContainsAny(host, "/@?#") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // RateLimit returns a net/http middleware that enforces rate limiting, using Redis as the backend
 // client: Redis client
 // expires: duration for rate limit window
@@ -141,10 +199,19 @@ func checkRateLimit(ctx context.Context, client *redis.Client, key string, expir
 	return count <= maxCount, nil
 }
 
-// SimpleAuthCheck returns a net/http middleware that checks for a valid token
+// SimpleAuthCheck returns a net/http middleware that checks for a valid session or token
+// Browsers authenticate with the session cookie or the token cookie, API clients with a bearer token
+// IPs with too many failed attempts are locked out, see AuthService.RecordFailure
 // authService: service to validate tokens
+// sessionService: service to look up and rotate sessions
+// secureCookie: whether a rotated session cookie is HTTPS only
 // excludedPaths: paths to exclude from authentication
-func SimpleAuthCheck(authService *services.AuthService, excludedPaths ...string) func(http.Handler) http.Handler {
+func SimpleAuthCheck(
+	authService *services.AuthService,
+	sessionService *services.SessionService,
+	secureCookie bool,
+	excludedPaths ...string,
+) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			path := r.URL.Path
@@ -155,7 +222,45 @@ func SimpleAuthCheck(authService *services.AuthService, excludedPaths ...string)
 				return
 			}
 
-			// try to get token from cookie or Authorization header
+			// reject locked out IPs before looking at the credentials
+			remaining, err := authService.LockoutRemaining(r.Context(), services.ClientIP(r))
+			if err != nil {
+				log.Printf("error checking auth lockout: %v", err)
+				e.SendJSONError(w, 500, "internal_error")
+				return
+			}
+			if remaining > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+				e.SendJSONError(w, http.StatusTooManyRequests, "too_many_attempts")
+				return
+			}
+
+			// a valid session cookie authenticates the request, rotating its ID when due
+			if sessionID := getTokenFromCookie(r, handlers.SessionCookieName); sessionID != "" {
+				session, err := sessionService.Get(r.Context(), sessionID)
+				if err != nil {
+					log.Printf("error getting session: %v", err)
+					e.SendJSONError(w, 500, "internal_error")
+					return
+				}
+
+				if session != nil {
+					if sessionService.NeedsRotation(session) {
+						if rotated, err := sessionService.Rotate(r.Context(), session); err != nil {
+							log.Printf("error rotating session: %v", err)
+						} else if rotated.ID != session.ID {
+							session = rotated
+							handlers.SetSessionCookie(w, session, secureCookie)
+						}
+					}
+
+					next.ServeHTTP(w, r.WithContext(services.WithSession(r.Context(), session)))
+					return
+				}
+			}
+
+			// otherwise, try to get token from cookie or Authorization header
+			// The token cookie is kept for the clients not on sessions yet, e.g. the auth_request of nginx for /uploads
 			token := getTokenFromCookie(r, "token")
 			if token == "" {
 				token = extractBearerToken(r)
@@ -163,12 +268,13 @@ func SimpleAuthCheck(authService *services.AuthService, excludedPaths ...string)
 
 			// if no token provided, return 400
 			if token == "" {
-				e.SendJSONError(w, 400, "bad_request", "no token provided")
+				e.SendJSONError(w, 400, "bad_request", "no session or token provided")
 				return
 			}
 
 			// validate the token, return 401 if invalid
 			if !authService.IsValidToken(token) {
+				authService.RecordRequestFailure(r)
 				e.SendJSONError(w, 401, "unauthorized", "invalid token")
 				return
 			}
@@ -179,6 +285,256 @@ func SimpleAuthCheck(authService *services.AuthService, excludedPaths ...string)
 	}
 }
 
+// RequireTwoFactor returns a net/http middleware guarding admin operations when two-factor auth is enabled
+// The request must come from a session verified with a second factor, or carry a valid code in X-TOTP-Code
+// twoFactorService: service to check whether two-factor auth is enabled and verify codes
+func RequireTwoFactor(twoFactorService *services.TwoFactorService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			enabled, err := twoFactorService.IsEnabled(r.Context())
+			if err != nil {
+				log.Printf("error checking two-factor auth: %v", err)
+				e.SendJSONError(w, 500, "internal_error")
+				return
+			}
+
+			if !enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if session := services.SessionFromContext(r.Context()); session != nil && session.TwoFactor {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if code := r.Header.Get("X-TOTP-Code"); code != "" {
+				ok, err := twoFactorService.Verify(r.Context(), code)
+				if err != nil {
+					log.Printf("error verifying two-factor code: %v", err)
+					e.SendJSONError(w, 500, "internal_error")
+					return
+				}
+				if ok {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			e.SendJSONError(w, http.StatusForbidden, "two_factor_required", "this operation requires two-factor authentication")
+		})
+	}
+}
+
+// RequireAPIKey returns a net/http middleware checking the key of the public API in X-API-Key
+// Each request counts against the daily quota of the tier of the key, reset at midnight UTC.
+// The quota, remaining requests and reset time are sent in the X-RateLimit-* headers.
+// publicAPIService: service to look up keys and count their requests
+func RequireAPIKey(publicAPIService *services.PublicAPIService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := publicAPIService.LookupKey(r.Header.Get("X-API-Key"))
+			if key == nil {
+				e.SendJSONError(w, http.StatusUnauthorized, "invalid_api_key", "a valid key is required in X-API-Key")
+				return
+			}
+
+			now := time.Now()
+			count, err := publicAPIService.CountRequest(r.Context(), key, now)
+			if err != nil {
+				log.Printf("error counting request of API key %q: %v", key.Name, err)
+				e.SendJSONError(w, 500, "internal_error")
+				return
+			}
+
+			quota := publicAPIService.Quota(key)
+			reset := services.QuotaReset(now)
+			w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(quota, 10))
+			w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(max(quota-count, 0), 10))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+			if count > quota {
+				w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+				e.SendJSONError(w, http.StatusTooManyRequests, "quota_exceeded", "the daily quota of this key is exhausted")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SandboxArchives returns a net/http middleware serving the page snapshots under prefix in a sandbox
+// Snapshots are third-party HTML, the sandbox keeps their scripts from running with the origin of the app
+func SandboxArchives(prefix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				w.Header().Set("Content-Security-Policy", "sandbox")
+				w.Header().Set("X-Content-Type-Options", "nosniff")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSignedUploads returns a net/http middleware refusing the requests for the uploads without a valid signature
+// Every request goes through if signer is nil, see services.URLSigner
+func RequireSignedUploads(signer *services.URLSigner) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if signer == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := signer.Verify(r.URL.Path, r.URL.Query()); err != nil {
+				e.SendJSONError(w, http.StatusForbidden, "forbidden", err.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SignUploadURLs returns a net/http middleware signing the URLs of the uploads in the JSON and HTML responses,
+// and removing their signatures from the JSON requests, so that the URLs are stored unsigned
+// Other responses, e.g. exports and event streams, are sent as they are. It does nothing if signer is nil.
+func SignUploadURLs(signer *services.URLSigner) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if signer == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+				body, err := io.ReadAll(r.Body)
+				r.Body.Close()
+				if err != nil {
+					e.SendJSONError(w, http.StatusBadRequest, "bad_request")
+					return
+				}
+				body = signer.StripText(body)
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				r.ContentLength = int64(len(body))
+			}
+
+			sw := &signingWriter{ResponseWriter: w, signer: signer}
+			next.ServeHTTP(sw, r)
+			sw.finish()
+		})
+	}
+}
+
+// signingWriter keeps a JSON or HTML response in memory, to sign the URLs of the uploads in it before it's sent
+type signingWriter struct {
+	http.ResponseWriter
+	signer *services.URLSigner
+
+	code      int
+	body      bytes.Buffer
+	decided   bool
+	buffering bool
+}
+
+func (w *signingWriter) WriteHeader(code int) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	contentType := w.Header().Get("Content-Type")
+	w.buffering = strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/html")
+	if w.buffering {
+		w.code = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *signingWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.buffering {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController flush the responses sent as they are, e.g. event streams
+func (w *signingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *signingWriter) finish() {
+	if !w.buffering {
+		return
+	}
+	body := w.signer.SignText(w.body.Bytes())
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.code)
+	w.ResponseWriter.Write(body)
+}
+
+// RequestTx returns a net/http middleware running a request in a transaction of the database, which the writes of
+// the services join, so that e.g. a post is created with its tags and activity or not at all, see
+// services.BeginRequestTx. The transaction commits if the handler responds with a status below 400, and rolls back
+// otherwise or if it panics. The response is kept in memory until then, so that a failed commit is answered with an
+// error rather than a success. The request holds the write queue all along: it suits the short writes, not the
+// uploads, imports or requests fetching a remote page.
+func RequestTx(db *services.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, end, err := services.BeginRequestTx(r.Context(), db)
+			if err != nil {
+				log.Printf("error beginning the transaction of %s: %v", r.URL.Path, err)
+				e.SendJSONError(w, 500, "internal_error")
+				return
+			}
+			defer func() {
+				if err := recover(); err != nil {
+					end(false)
+					panic(err)
+				}
+			}()
+
+			tw := &txWriter{header: make(http.Header), code: http.StatusOK}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+
+			if err := end(tw.code < 400); err != nil && tw.code < 400 {
+				log.Printf("error committing the transaction of %s: %v", r.URL.Path, err)
+				e.SendJSONError(w, 500, "internal_error")
+				return
+			}
+			for key, values := range tw.header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(tw.code)
+			w.Write(tw.body.Bytes())
+		})
+	}
+}
+
+// txWriter keeps a response in memory until the transaction of its request ends, see RequestTx
+type txWriter struct {
+	header  http.Header
+	code    int
+	body    bytes.Buffer
+	decided bool
+}
+
+func (w *txWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *txWriter) WriteHeader(code int) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.code = code
+}
+
+func (w *txWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
 // shouldExclude checks if the given path matches any of the skip paths
 func shouldExclude(path string, skipPaths []string) bool {
 	for _, skipPath := range skipPaths {
@@ -213,3 +569,107 @@ func getTokenFromCookie(r *http.Request, name string) string {
 	}
 	return cookie.Value
 }
+
+// DebugLog returns a net/http middleware recording a sample of requests and responses into the given buffer
+// Bodies are truncated to the configured limit, and configured headers and JSON fields are redacted
+// config: debug log configuration
+// buffer: ring buffer receiving the recorded entries
+func DebugLog(config config.DebugLogConfig, buffer *ring.Buffer[models.RequestLogEntry]) func(http.Handler) http.Handler {
+	redactHeaders := make(map[string]bool, len(config.RedactHeaders))
+	for _, header := range config.RedactHeaders {
+		redactHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	// matches "field": "value" pairs of the redacted fields, also in truncated JSON
+	var redactFields *regexp.Regexp
+	if len(config.RedactFields) > 0 {
+		names := make([]string, len(config.RedactFields))
+		for i, field := range config.RedactFields {
+			names[i] = regexp.QuoteMeta(field)
+		}
+		redactFields = regexp.MustCompile(`("(?:` + strings.Join(names, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\s]+)`)
+	}
+
+	redactBody := func(body string) string {
+		if redactFields == nil {
+			return body
+		}
+		return redactFields.ReplaceAllString(body, `$1"[REDACTED]"`)
+	}
+
+	copyHeaders := func(header http.Header) map[string][]string {
+		result := make(map[string][]string, len(header))
+		for key, values := range header {
+			if redactHeaders[key] {
+				result[key] = []string{"[REDACTED]"}
+			} else {
+				result[key] = values
+			}
+		}
+		return result
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rand.Float64() >= config.SampleRate {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			entry := models.RequestLogEntry{
+				RequestID:      middleware.GetReqID(r.Context()),
+				Time:           time.Now().UnixMilli(),
+				Method:         r.Method,
+				URL:            r.URL.RequestURI(),
+				RequestHeaders: copyHeaders(r.Header),
+			}
+
+			// uploads are binary and large, only note that they were sent
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+				entry.RequestBody = "[multipart body omitted]"
+			} else if r.Body != nil {
+				head, err := io.ReadAll(io.LimitReader(r.Body, config.BodyLimit))
+				if err != nil {
+					log.Printf("error reading request body for debug log: %v", err)
+				}
+				entry.RequestBody = redactBody(string(head))
+				// let the handler read the whole body, including the part consumed above
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+			}
+
+			body := &limitedBuffer{limit: config.BodyLimit}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(body)
+
+			start := time.Now()
+			defer func() {
+				entry.Duration = time.Since(start).Milliseconds()
+				entry.Status = ww.Status()
+				if entry.Status == 0 {
+					entry.Status = http.StatusOK
+				}
+				entry.ResponseHeaders = copyHeaders(ww.Header())
+				entry.ResponseBody = redactBody(body.String())
+				buffer.Push(entry)
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - int64(b.Len()); remaining > 0 {
+		b.Buffer.Write(p[:min(int64(len(p)), remaining)])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+	"github.com/cymoo/mote/internal/testutil"
+)
+
+func TestOriginMatcher(t *testing.T) {
+	allow := originMatcher([]string{"https://app.example.com", "https://*.example.org"})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://other.example.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"http://a.example.org", false},
+		{"https://evil.com/.example.org", false},
+		{"https://a.example.org.evil.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := allow(tt.origin); got != tt.want {
+			t.Errorf("allow(%q) = %v; want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	handler := CORS(config.CORSConfig{AllowedOrigins: []string{"https://*.example.com"}, MaxAge: 60})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+	)
+
+	req := httptest.NewRequest("OPTIONS", "/api/get-posts", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected preflight to be answered with 204, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("unexpected Access-Control-Allow-Origin %q", got)
+	}
+	if got := rec.Header().Values("Vary"); len(got) == 0 || got[0] != "Origin" {
+		t.Errorf("expected Vary: Origin, got %v", got)
+	}
+
+	// Disallowed origins get no CORS headers and reach the handler
+	req = httptest.NewRequest("GET", "/api/get-posts", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTeapot || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected disallowed origin to pass through without CORS headers, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestSignUploadURLs(t *testing.T) {
+	signer := services.NewURLSigner([]byte("0123456789abcdef0123456789abcdef"), time.Hour, "/uploads")
+
+	var received string
+	handler := SignUploadURLs(signer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "24")
+		w.Write([]byte(`{"url":"/uploads/a.jpg"}`))
+	}))
+
+	// The signatures sent back are removed, and the URLs in the response signed
+	signed := signer.Sign("/uploads/a.jpg")
+	req := httptest.NewRequest("POST", "/api/update-post", strings.NewReader(`{"url":"`+signed+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if received != `{"url":"/uploads/a.jpg"}` {
+		t.Errorf("expected the signature to be removed from the request, got %s", received)
+	}
+	if got := rec.Body.String(); got != `{"url":"`+signed+`"}` {
+		t.Errorf("expected the URL to be signed in the response, got %s", got)
+	}
+	if rec.Header().Get("Content-Length") != "" {
+		t.Errorf("expected the Content-Length to be removed, got %s", rec.Header().Get("Content-Length"))
+	}
+
+	// The uploads are only served with a valid signature
+	uploads := RequireSignedUploads(signer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range []struct {
+		url  string
+		code int
+	}{{signed, http.StatusOK}, {"/uploads/a.jpg", http.StatusForbidden}, {"/uploads/b.jpg?" + strings.SplitN(signed, "?", 2)[1], http.StatusForbidden}} {
+		rec := httptest.NewRecorder()
+		uploads.ServeHTTP(rec, httptest.NewRequest("GET", tt.url, nil))
+		if rec.Code != tt.code {
+			t.Errorf("GET %s: expected %d, got %d", tt.url, tt.code, rec.Code)
+		}
+	}
+}
+
+func TestRequestTx(t *testing.T) {
+	db := services.NewDB(testutil.NewDB(t))
+	posts := services.NewPostService(db)
+
+	// The handler creates a post, then responds with the status of the query
+	handler := RequestTx(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := posts.Create(r.Context(), models.CreatePostRequest{Content: "<p>hello</p>"}); err != nil {
+			t.Fatalf("Create() = %v", err)
+		}
+		code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		w.Header().Set("X-Test", "kept")
+		w.WriteHeader(code)
+		w.Write([]byte("done"))
+	}))
+
+	for _, tt := range []struct {
+		code  int
+		posts int
+	}{{http.StatusBadRequest, 0}, {http.StatusOK, 1}, {http.StatusInternalServerError, 1}} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/create-post?code="+strconv.Itoa(tt.code), nil))
+		if rec.Code != tt.code || rec.Body.String() != "done" || rec.Header().Get("X-Test") != "kept" {
+			t.Errorf("code %d: expected the response of the handler, got %d %q", tt.code, rec.Code, rec.Body.String())
+		}
+
+		var count int
+		if err := db.Get(&count, "SELECT COUNT(*) FROM posts"); err != nil {
+			t.Fatal(err)
+		}
+		if count != tt.posts {
+			t.Errorf("code %d: expected %d posts, got %d", tt.code, tt.posts, count)
+		}
+	}
+}
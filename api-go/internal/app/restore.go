@@ -0,0 +1,31 @@
+package app
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/services"
+)
+
+// Restore restores the data of an encrypted export into the database, the uploads and the full-text index of the
+// configuration, see services.Restore
+// The app must not be running: the database is replaced without being opened, only Redis is connected to.
+func Restore(cfg *config.Config, r io.Reader, passphrase string) (*services.ExportReport, error) {
+	app := &App{config: cfg}
+	defer app.Close()
+	if err := app.initRedis(); err != nil {
+		return nil, err
+	}
+	if err := app.initFullTextSearch(); err != nil {
+		return nil, err
+	}
+	return services.Restore(context.Background(), r, passphrase, sqlitePath(cfg.DB.URL), cfg.Upload.BasePath, app.fts)
+}
+
+// sqlitePath returns the path of the file of a database URL, e.g. "data/app.db" for "file:data/app.db?mode=rwc"
+func sqlitePath(dbURL string) string {
+	path, _, _ := strings.Cut(strings.TrimPrefix(dbURL, "file:"), "?")
+	return path
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -8,40 +9,83 @@ import (
 	"github.com/cymoo/mote/assets"
 	e "github.com/cymoo/mote/internal/errors"
 	"github.com/cymoo/mote/internal/handlers"
+	"github.com/cymoo/mote/internal/importer"
 	"github.com/cymoo/mote/internal/models"
 	"github.com/cymoo/mote/internal/services"
+	"github.com/cymoo/mote/internal/tasks"
+	"github.com/cymoo/mote/pkg/fulltext"
+	"github.com/cymoo/mote/pkg/util/safego"
 	"github.com/go-chi/chi/v5"
 )
 
+// maxIndexMemorySample bounds the keys of each class measured by /get-index-memory, a MEMORY USAGE each
+const maxIndexMemorySample = 10000
+
 // NewApiRouter creates and returns a router for API endpoints
 func NewApiRouter(app *App) *chi.Mux {
 	r := chi.NewRouter()
 
+	// the counts of the sidebar, shared by the handlers of posts and tags
+	statsCache := services.NewStatsCache(app.db, app.config.Post.StatsCacheTTL)
+
 	tagService := services.NewTagService(app.db)
-	tagHandler := handlers.NewTagHandler(tagService)
+	tagHandler := handlers.NewTagHandler(tagService, app.fts, &app.config.Post, statsCache)
+
+	uploadService := services.NewUploadService(&app.config.Upload, app.images)
+	uploadHandler := handlers.NewUploadHandler(uploadService)
 
+	aliasScanner := services.NewTagAliasScanner(app.config.Post.TagAliases)
+	archiveService := services.NewArchiveService(app.db, uploadService, &app.config.Archive)
 	postService := services.NewPostService(app.db)
-	postHandler := handlers.NewPostHandler(postService, tagService, app.fts)
+	postHandler := handlers.NewPostHandler(
+		postService,
+		tagService,
+		uploadService,
+		app.fts,
+		&app.config.Post,
+		aliasScanner,
+		archiveService,
+		statsCache,
+		services.NewViewService(app.redis),
+	)
 
-	uploadService := services.NewUploadService(&app.config.Upload)
-	uploadHandler := handlers.NewUploadHandler(uploadService)
+	clipService := services.NewClipService(uploadService, &app.config.Clip)
+	clipHandler := handlers.NewClipHandler(clipService, uploadService, postHandler)
+	templateHandler := handlers.NewTemplateHandler(services.NewTemplateService(app.db), postHandler)
+	draftHandler := handlers.NewDraftHandler(services.NewDraftService(app.db, app.config.Post.DraftTTL), postHandler)
 
-	authService := services.NewAuthService()
+	authService := services.NewAuthService(app.redis, &app.config.Auth)
+	sessionService := services.NewSessionService(app.redis, &app.config.Session)
+	totpKey, _ := app.config.Auth.DecodeTOTPKey()
+	twoFactorService := services.NewTwoFactorService(app.db, totpKey)
+	authHandler := handlers.NewAuthHandler(
+		authService,
+		sessionService,
+		twoFactorService,
+		app.config.AppName,
+		&app.config.Session,
+	)
 
-	// Use simple auth check middleware for all routes except /api/login
-	r.Use(SimpleAuthCheck(authService, "/api/login"))
+	// Admin operations require a second factor once two-factor auth is enabled
+	requireTwoFactor := RequireTwoFactor(twoFactorService)
 
-	// handleLogin processes login requests by validating the provided password
-	handleLogin := func(payload m.JSON[models.LoginRequest]) (m.StatusCode, error) {
-		if authService.IsValidToken(payload.Value.Password) {
-			return http.StatusNoContent, nil
-		} else {
-			return 0, e.Unauthorized("password is wrong")
-		}
-	}
+	adminHandler := handlers.NewAdminHandler(app.db)
+	linkService := services.NewLinkService(app.db)
+	importHandler := handlers.NewImportHandler(importer.New(app.db, uploadService, app.fts, &app.config.Post))
+	activityHandler := handlers.NewActivityHandler(services.NewActivityService(app.db), &app.config.Post)
+
+	// Check the session or token for all routes except /api/login and /api/logout
+	r.Use(SimpleAuthCheck(authService, sessionService, app.config.Session.SecureCookie, "/api/login", "/api/logout"))
 
 	// Use rate limiting middleware for login route
-	r.With(RateLimit(app.redis, 60*time.Second, 5)).Post("/login", m.H(handleLogin))
+	r.With(RateLimit(app.redis, 60*time.Second, 5)).Post("/login", m.H(authHandler.Login))
+	r.Post("/logout", m.H(authHandler.Logout))
+	r.Get("/session", m.H(authHandler.GetSession))
+
+	r.Get("/2fa/status", m.H(authHandler.GetTwoFactorStatus))
+	r.With(requireTwoFactor).Post("/2fa/enroll", m.H(authHandler.EnrollTwoFactor))
+	r.With(requireTwoFactor).Post("/2fa/confirm", m.H(authHandler.ConfirmTwoFactor))
+	r.With(requireTwoFactor).Post("/2fa/disable", m.H(authHandler.DisableTwoFactor))
 
 	// A simple endpoint to verify authentication
 	// Nginx can use this to check if the token is valid, and handle uploads accordingly
@@ -51,22 +95,136 @@ func NewApiRouter(app *App) *chi.Mux {
 
 	r.Get("/hello", m.H(postHandler.HelloWorld))
 
+	// The writes of posts and tags commit together with the activities and tags they bring, or not at all
+	requestTx := RequestTx(app.db)
+
 	r.Get("/get-tags", m.H(tagHandler.GetTags))
-	r.Post("/rename-tag", m.H(tagHandler.RenameTag))
-	r.Post("/delete-tag", m.H(tagHandler.DeleteTag))
-	r.Post("/stick-tag", m.H(tagHandler.StickTag))
+	r.With(requestTx).Post("/rename-tag", m.H(tagHandler.RenameTag))
+	r.With(requestTx).Post("/delete-tag", m.H(tagHandler.DeleteTag))
+	r.With(requestTx).Post("/stick-tag", m.H(tagHandler.StickTag))
+	r.Get("/get-deleted-tags", m.H(tagHandler.GetDeletedTags))
+	r.With(requestTx).Post("/restore-tag", m.H(tagHandler.RestoreTag))
+	r.Post("/suggest-tags", m.H(postHandler.SuggestTags))
+	r.With(requestTx).Post("/tags/retag", m.H(tagHandler.RetagPosts))
+	r.Get("/tags/{name}/posts", m.H(tagHandler.GetPosts))
 
 	r.Get("/search", m.H(postHandler.SearchPosts))
+	r.Get("/posts/quick-search", m.H(postHandler.QuickSearch))
+	r.Get("/posts/recently-viewed", m.H(postHandler.GetRecentlyViewed))
+	r.Get("/posts/most-viewed", m.H(postHandler.GetMostViewed))
 	r.Get("/get-posts", m.H(postHandler.GetPosts))
 	r.Get("/get-post", m.H(postHandler.GetPost))
-	r.Post("/create-post", m.H(postHandler.CreatePost))
-	r.Post("/update-post", m.H(postHandler.UpdatePost))
-	r.Post("/delete-post", m.H(postHandler.DeletePost))
-	r.Post("/restore-post", m.H(postHandler.RestorePost))
-	r.Post("/clear-posts", m.H(postHandler.ClearPosts))
+	r.Get("/posts/{id}/thread", m.H(postHandler.GetThread))
+	r.With(requestTx).Post("/create-post", m.H(postHandler.CreatePost))
+	r.With(requestTx).Post("/update-post", m.H(postHandler.UpdatePost))
+	r.With(requestTx).Post("/update-post-files", m.H(postHandler.UpdateFiles))
+	r.With(requestTx).Post("/delete-post", m.H(postHandler.DeletePost))
+	r.With(requestTx).Post("/restore-post", m.H(postHandler.RestorePost))
+	r.Post("/clip", m.H(clipHandler.ClipPage))
+	r.With(requireTwoFactor).Post("/clear-posts", m.H(postHandler.ClearPosts))
+
+	r.Get("/get-templates", m.H(templateHandler.GetTemplates))
+	r.Post("/create-template", m.H(templateHandler.CreateTemplate))
+	r.Post("/update-template", m.H(templateHandler.UpdateTemplate))
+	r.Post("/delete-template", m.H(templateHandler.DeleteTemplate))
+	r.With(requestTx).Post("/create-post-from-template", m.H(templateHandler.CreatePostFromTemplate))
+
+	r.Get("/get-drafts", m.H(draftHandler.GetDrafts))
+	r.Get("/get-draft", m.H(draftHandler.GetDraft))
+	r.Post("/save-draft", m.H(draftHandler.SaveDraft))
+	r.Post("/delete-draft", m.H(draftHandler.DeleteDraft))
+
+	r.Get("/palette", m.H(postHandler.GetPalette))
 
 	r.Get("/get-overall-counts", m.H(postHandler.GetStats))
 	r.Get("/get-daily-post-counts", m.H(postHandler.GetDailyCounts))
+	r.Get("/get-grouped-post-counts", m.H(postHandler.GetGroupedCounts))
+	r.Get("/get-activities", m.H(activityHandler.GetActivities))
+
+	// Latest results reported by background tasks
+	r.With(requireTwoFactor).Get("/get-task-results", m.H(func() (map[string]tasks.Result, error) {
+		return app.taskResults.All(), nil
+	}))
+
+	// Last runs of a background task, for debugging flaky ones
+	r.With(requireTwoFactor).Get("/get-task-history", m.H(func(query m.Query[models.Name]) ([]tasks.TaskRun, error) {
+		history, err := app.tm.GetTaskHistory(query.Value.Name)
+		if err != nil {
+			return nil, e.NotFound(err.Error())
+		}
+		return history, nil
+	}))
+
+	// The tasks as JSON, next to the pages of /tasks
+	r.With(requireTwoFactor).Mount("/tasks", app.tm.APIHandler("/api"))
+
+	r.With(requireTwoFactor).Get("/get-db-stats", m.H(adminHandler.GetDBStats))
+	r.With(requireTwoFactor).Get("/get-image-pool-stats", m.H(uploadHandler.GetImagePoolStats))
+
+	// Panics recovered in the goroutines run in the background by the handlers and the tasks
+	r.With(requireTwoFactor).Get("/get-background-panics", m.H(func() ([]safego.Stat, error) {
+		return safego.Stats(), nil
+	}))
+
+	// Children counts of posts checked against their live children, fixed unless dry_run
+	r.With(requireTwoFactor).Post("/recompute-children-counts", m.H(adminHandler.RecomputeChildrenCounts))
+
+	// Size of the full-text index and its stop tokens, see the manage-stop-tokens task
+	r.With(requireTwoFactor).Get("/get-index-stats", m.H(func(r *http.Request) (*fulltext.IndexStats, error) {
+		return app.fts.Stats(r.Context())
+	}))
+	// Memory used by the full-text index in Redis by class of keys, estimated from a sample of each
+	r.With(requireTwoFactor).Get("/get-index-memory", m.H(func(r *http.Request, query m.Query[models.IndexMemoryRequest]) (*fulltext.MemoryStats, error) {
+		if query.Value.Sample < 0 || query.Value.Sample > maxIndexMemorySample {
+			return nil, e.BadRequest(fmt.Sprintf("sample must be between 0 and %d", maxIndexMemorySample))
+		}
+		return app.fts.MemoryStats(r.Context(), query.Value.Sample)
+	}))
+	r.With(requireTwoFactor).Post("/demote-stop-token", m.H(func(r *http.Request, payload m.JSON[models.StopTokenRequest]) (m.StatusCode, error) {
+		demoted, err := app.fts.DemoteStopToken(r.Context(), payload.Value.Token)
+		if err != nil {
+			return 0, err
+		}
+		if !demoted {
+			return 0, e.NotFound("not a stop token")
+		}
+		return m.StatusCode(204), nil
+	}))
+
+	// Checks of the dependencies for debugging a broken deployment, also run by `mote doctor`
+	r.With(requireTwoFactor).Get("/admin/selftest", m.H(func(r *http.Request) (*models.SelfTestReport, error) {
+		return app.SelfTest(r.Context()), nil
+	}))
+
+	// External links of posts that failed their latest check
+	r.Get("/get-broken-links", m.H(func(r *http.Request) ([]models.BrokenLink, error) {
+		return linkService.FindBroken(r.Context())
+	}))
+
+	// Imports of notes exported from other apps
+	r.With(requireTwoFactor).Post("/import", m.H(importHandler.ImportNotes))
+	r.With(requireTwoFactor).Get("/get-import", m.H(importHandler.GetImport))
+
+	// Requests recorded by the debug log, newest first
+	r.With(requireTwoFactor).Get("/get-request-log", m.H(func() ([]models.RequestLogEntry, error) {
+		if app.requestLog == nil {
+			return nil, e.NotFound("debug log is disabled")
+		}
+		return app.requestLog.Items(), nil
+	}))
+
+	// Requests made with the keys of the public API on the last days, 7 by default
+	publicAPIService := services.NewPublicAPIService(app.redis, &app.config.PublicAPI)
+	r.With(requireTwoFactor).Get("/get-api-key-usage", m.H(func(r *http.Request, query m.Query[models.APIKeyUsageRequest]) ([]models.APIKeyUsage, error) {
+		days := query.Value.Days
+		if days == 0 {
+			days = 7
+		}
+		if days < 0 || days > 31 {
+			return nil, e.BadRequest("days must be between 1 and 31")
+		}
+		return publicAPIService.GetUsage(r.Context(), days, time.Now())
+	}))
 
 	r.Post("/upload", m.H(uploadHandler.UploadFile))
 	r.Get("/upload", m.H(uploadHandler.SimpleFileForm))
@@ -74,17 +232,84 @@ func NewApiRouter(app *App) *chi.Mux {
 	return r
 }
 
+// NewAdminRouter creates and returns a router for the admin dashboard
+// It requires a session or token like the API, and a second factor once two-factor auth is enabled
+func NewAdminRouter(app *App) *chi.Mux {
+	r := chi.NewRouter()
+
+	authService := services.NewAuthService(app.redis, &app.config.Auth)
+	sessionService := services.NewSessionService(app.redis, &app.config.Session)
+	totpKey, _ := app.config.Auth.DecodeTOTPKey()
+	twoFactorService := services.NewTwoFactorService(app.db, totpKey)
+
+	r.Use(SimpleAuthCheck(authService, sessionService, app.config.Session.SecureCookie))
+	r.Use(RequireTwoFactor(twoFactorService))
+
+	dashboard := NewDashboard(app)
+	r.Get("/", dashboard.Index)
+	r.Post("/action", dashboard.Action)
+	r.Post("/export", dashboard.Export)
+
+	return r
+}
+
 // NewPageRouter creates and returns a router for page endpoints
 func NewPageRouter(app *App) *chi.Mux {
 	r := chi.NewRouter()
 
-	pageHandler, err := handlers.NewPostPageHandler(app.db, assets.TemplateFS())
+	uploadService := services.NewUploadService(&app.config.Upload, app.images)
+	archiveService := services.NewArchiveService(app.db, uploadService, &app.config.Archive)
+	pageHandler, err := handlers.NewPostPageHandler(app.db.Reader(), archiveService, services.NewViewService(app.redis),
+		assets.TemplateFS(), app.config.PostsPerPage)
 	if err != nil {
 		panic("failed to create page handler: " + err.Error())
 	}
 
 	r.Get("/", pageHandler.PostList)
 	r.Get("/{id}", pageHandler.PostItem)
+	r.Get("/tags/*", pageHandler.TagPostList)
+
+	return r
+}
+
+// NewExploreRouter creates and returns a router for the read-only pages of the whole vault, with search, tags and
+// feeds, see Config.PublicExplore
+func NewExploreRouter(app *App) *chi.Mux {
+	r := chi.NewRouter()
+
+	uploadService := services.NewUploadService(&app.config.Upload, app.images)
+	archiveService := services.NewArchiveService(app.db, uploadService, &app.config.Archive)
+	pageHandler, err := handlers.NewPostPageHandler(app.db.Reader(), archiveService, services.NewViewService(app.redis),
+		assets.TemplateFS(), app.config.PostsPerPage)
+	if err != nil {
+		panic("failed to create page handler: " + err.Error())
+	}
+	exploreHandler := pageHandler.Explore(app.db.Reader(), app.fts)
+
+	r.Get("/", exploreHandler.PostList)
+	r.Get("/feed.atom", exploreHandler.Feed)
+	r.Get("/search", exploreHandler.Search)
+	r.Get("/tags", exploreHandler.TagList)
+	r.Get("/tags/*", exploreHandler.TagPostList)
+	r.Get("/{id}", exploreHandler.PostItem)
+
+	return r
+}
+
+// NewPublicRouter creates and returns a router for the read-only JSON API of the shared posts
+// Every request needs a key of the public API and counts against its daily quota
+func NewPublicRouter(app *App) *chi.Mux {
+	r := chi.NewRouter()
+
+	uploadService := services.NewUploadService(&app.config.Upload, app.images)
+	archiveService := services.NewArchiveService(app.db, uploadService, &app.config.Archive)
+	publicHandler := handlers.NewPublicHandler(app.db.Reader(), archiveService, services.NewViewService(app.redis), app.config.PostsPerPage)
+
+	r.Use(RequireAPIKey(services.NewPublicAPIService(app.redis, &app.config.PublicAPI)))
+
+	r.Get("/posts", m.H(publicHandler.GetPosts))
+	r.Get("/posts/{id}", m.H(publicHandler.GetPost))
+	r.Get("/tags/*", m.H(publicHandler.GetTagPosts))
 
 	return r
 }
@@ -0,0 +1,272 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mote/assets"
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+)
+
+var errNotInitialized = errors.New("not initialized")
+
+// maxClockSkew is the largest difference tolerated between the clocks of the server and Redis
+const maxClockSkew = 5 * time.Second
+
+// SelfTest runs a battery of checks against the dependencies of the app and reports each outcome
+// The checks leave no trace: the Redis key, the scratch full-text index and the upload probe are removed.
+func (app *App) SelfTest(ctx context.Context) *models.SelfTestReport {
+	report := &models.SelfTestReport{OK: true, Time: time.Now().UnixMilli(), Checks: []models.SelfTestCheck{}}
+	checks := []struct {
+		name string
+		run  func(context.Context) (string, error)
+	}{
+		{"migrations", app.checkMigrations},
+		{"pragmas", app.checkPragmas},
+		{"redis", app.checkRedis},
+		{"fulltext", app.checkFullText},
+		{"uploads", app.checkUploads},
+		{"clock", app.checkClock},
+	}
+	for _, check := range checks {
+		runCheck(ctx, report, check.name, check.run)
+	}
+	return report
+}
+
+// Doctor opens the dependencies of the app without migrating the database and runs the self-test
+// Unlike New, it reports a dependency that can't be opened instead of failing.
+func Doctor(cfg *config.Config) *models.SelfTestReport {
+	doctorConfig := *cfg
+	doctorConfig.DB.AutoMigrate = false
+	app := &App{config: &doctorConfig}
+	defer app.Close()
+
+	ctx := context.Background()
+	report := &models.SelfTestReport{OK: true, Time: time.Now().UnixMilli(), Checks: []models.SelfTestCheck{}}
+	runCheck(ctx, report, "database", func(context.Context) (string, error) {
+		return cfg.DB.URL, recoverError(app.initDatabase)
+	})
+	runCheck(ctx, report, "redis connection", func(context.Context) (string, error) {
+		if err := app.initRedis(); err != nil {
+			return cfg.Redis.URL, err
+		}
+		return cfg.Redis.URL, app.initFullTextSearch()
+	})
+
+	selfTest := app.SelfTest(ctx)
+	report.OK = report.OK && selfTest.OK
+	report.Checks = append(report.Checks, selfTest.Checks...)
+	return report
+}
+
+// runCheck runs a check and adds its outcome to the report
+func runCheck(ctx context.Context, report *models.SelfTestReport, name string, run func(context.Context) (string, error)) {
+	start := time.Now()
+	detail, err := run(ctx)
+	check := models.SelfTestCheck{Name: name, OK: err == nil, Detail: detail, Duration: time.Since(start).Milliseconds()}
+	if err != nil {
+		report.OK = false
+		if check.Detail != "" {
+			check.Detail += ": "
+		}
+		check.Detail += err.Error()
+	}
+	report.Checks = append(report.Checks, check)
+}
+
+// recoverError runs fn and turns a panic into an error, the database verifications panic on failure
+func recoverError(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return fn()
+}
+
+// checkMigrations verifies that the database schema is at the latest embedded migration and not dirty
+func (app *App) checkMigrations(ctx context.Context) (string, error) {
+	if app.db == nil {
+		return "", errNotInitialized
+	}
+
+	latest, err := latestMigration()
+	if err != nil {
+		return "", err
+	}
+
+	var applied struct {
+		Version int64 `db:"version"`
+		Dirty   bool  `db:"dirty"`
+	}
+	if err := app.db.GetContext(ctx, &applied, "SELECT version, dirty FROM schema_migrations LIMIT 1"); err != nil {
+		return "", fmt.Errorf("no migration applied: %w", err)
+	}
+
+	detail := fmt.Sprintf("version %d of %d", applied.Version, latest)
+	switch {
+	case applied.Dirty:
+		return detail, fmt.Errorf("migration %d failed halfway, fix the schema and force the version", applied.Version)
+	case applied.Version < latest:
+		return detail, fmt.Errorf("%d migrations pending", latest-applied.Version)
+	case applied.Version > latest:
+		return detail, fmt.Errorf("the database is newer than this build")
+	}
+	return detail, nil
+}
+
+// latestMigration returns the version of the last embedded migration
+func latestMigration() (int64, error) {
+	entries, err := fs.ReadDir(assets.MigrationFS(), "migrations")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int64
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(path.Base(entry.Name()), "_")
+		if !ok {
+			continue
+		}
+		if version, err := strconv.ParseInt(prefix, 10, 64); err == nil {
+			latest = max(latest, version)
+		}
+	}
+	return latest, nil
+}
+
+// checkPragmas verifies the settings SQLite runs with against the config
+func (app *App) checkPragmas(ctx context.Context) (string, error) {
+	if app.db == nil {
+		return "", errNotInitialized
+	}
+
+	var pragmas struct {
+		JournalMode string `db:"journal_mode"`
+		ForeignKeys int    `db:"foreign_keys"`
+		BusyTimeout int64  `db:"timeout"`
+	}
+	query := `
+		SELECT
+			(SELECT journal_mode FROM pragma_journal_mode) AS journal_mode,
+			(SELECT foreign_keys FROM pragma_foreign_keys) AS foreign_keys,
+			(SELECT timeout FROM pragma_busy_timeout) AS timeout
+	`
+	if err := app.db.GetContext(ctx, &pragmas, query); err != nil {
+		return "", err
+	}
+
+	detail := fmt.Sprintf("journal_mode=%s foreign_keys=%d busy_timeout=%d",
+		pragmas.JournalMode, pragmas.ForeignKeys, pragmas.BusyTimeout)
+	var problems []string
+	if pragmas.JournalMode != "wal" {
+		problems = append(problems, "journal_mode is not wal")
+	}
+	if pragmas.ForeignKeys != 1 {
+		problems = append(problems, "foreign keys are disabled")
+	}
+	if expected := app.config.DB.BusyTimeout.Milliseconds(); pragmas.BusyTimeout != expected {
+		problems = append(problems, fmt.Sprintf("busy_timeout is not the configured %d", expected))
+	}
+	if len(problems) > 0 {
+		return detail, fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return detail, nil
+}
+
+// checkRedis writes, reads back and deletes a key
+func (app *App) checkRedis(ctx context.Context) (string, error) {
+	if app.redis == nil {
+		return "", errNotInitialized
+	}
+
+	key := fmt.Sprintf("selftest:%d", time.Now().UnixNano())
+	value := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := app.redis.Set(ctx, key, value, time.Minute).Err(); err != nil {
+		return "", fmt.Errorf("write failed: %w", err)
+	}
+	defer app.redis.Del(context.WithoutCancel(ctx), key)
+
+	read, err := app.redis.Get(ctx, key).Result()
+	if err != nil {
+		return "", fmt.Errorf("read failed: %w", err)
+	}
+	if read != value {
+		return "", fmt.Errorf("read %q, expected %q", read, value)
+	}
+	return "round trip ok", nil
+}
+
+// checkFullText indexes and searches a document in a scratch index next to the real one
+func (app *App) checkFullText(ctx context.Context) (string, error) {
+	if app.fts == nil {
+		return "", errNotInitialized
+	}
+
+	scratch := app.fts.WithPrefix(fmt.Sprintf("selftest:%d:", time.Now().UnixNano()))
+	defer scratch.ClearIndex(context.WithoutCancel(ctx))
+
+	if err := scratch.Index(ctx, 1, "doctor probe document"); err != nil {
+		return "", fmt.Errorf("index failed: %w", err)
+	}
+	_, results, err := scratch.Search(ctx, "probe", false, 1)
+	if err != nil {
+		return "", fmt.Errorf("search failed: %w", err)
+	}
+	if len(results) != 1 || results[0].ID != 1 {
+		return "", fmt.Errorf("indexed document not found")
+	}
+	return "index and search ok", nil
+}
+
+// checkUploads writes and removes a file in the upload directory
+func (app *App) checkUploads(ctx context.Context) (string, error) {
+	dir := app.config.Upload.BasePath
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return dir, err
+	}
+
+	file, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return dir, fmt.Errorf("not writable: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := file.WriteString("selftest"); err != nil {
+		return dir, fmt.Errorf("not writable: %w", err)
+	}
+	return dir, nil
+}
+
+// checkClock compares the clock of the server with the clock of Redis
+// Timestamps are written by the server, but sessions and rate limits expire on Redis time.
+func (app *App) checkClock(ctx context.Context) (string, error) {
+	now := time.Now()
+	if now.Year() < 2024 {
+		return now.Format(time.RFC3339), fmt.Errorf("the clock is not set")
+	}
+	if app.redis == nil {
+		return now.Format(time.RFC3339), nil
+	}
+
+	redisTime, err := app.redis.Time(ctx).Result()
+	if err != nil {
+		return now.Format(time.RFC3339), fmt.Errorf("failed to read the Redis clock: %w", err)
+	}
+	skew := redisTime.Sub(now).Round(time.Millisecond)
+	detail := fmt.Sprintf("%s, Redis skew %s", now.Format(time.RFC3339), skew)
+	if skew.Abs() > maxClockSkew {
+		return detail, fmt.Errorf("the clocks of the server and Redis differ by %s", skew)
+	}
+	return detail, nil
+}
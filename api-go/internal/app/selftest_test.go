@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+)
+
+func TestSelfTest(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		DB: config.DBConfig{
+			URL:         filepath.Join(dir, "app.db"),
+			PoolSize:    1,
+			AutoMigrate: true,
+			BusyTimeout: 5 * time.Second,
+		},
+		Upload: config.UploadConfig{BasePath: filepath.Join(dir, "uploads")},
+	}
+
+	app := &App{config: cfg}
+	if err := app.initDatabase(); err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	defer app.Close()
+
+	report := app.SelfTest(context.Background())
+	if report.OK {
+		t.Error("expected the report to fail without Redis")
+	}
+
+	expected := map[string]bool{
+		"migrations": true,
+		"pragmas":    true,
+		"redis":      false,
+		"fulltext":   false,
+		"uploads":    true,
+		"clock":      true,
+	}
+	if len(report.Checks) != len(expected) {
+		t.Fatalf("expected %d checks, got %+v", len(expected), report.Checks)
+	}
+	for _, check := range report.Checks {
+		if check.OK != expected[check.Name] {
+			t.Errorf("expected check %s ok=%v, got %+v", check.Name, expected[check.Name], check)
+		}
+	}
+}
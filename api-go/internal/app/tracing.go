@@ -0,0 +1,37 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// initTracing sets the global tracer provider, exporting the spans of the app with OTLP over HTTP
+// The spans of task runs are created with the global provider, see tasks.withSpan.
+func (app *App) initTracing() error {
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to create the OTLP exporter: %w", err)
+	}
+
+	res := resource.NewSchemaless(
+		semconv.ServiceName(app.config.AppName),
+		semconv.ServiceVersion(app.config.AppVersion),
+		semconv.DeploymentEnvironment(app.config.AppEnv),
+	)
+
+	app.tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(app.config.Tracing.SampleRatio))),
+	)
+	otel.SetTracerProvider(app.tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return nil
+}
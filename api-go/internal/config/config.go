@@ -1,17 +1,24 @@
 package config
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cymoo/mote/pkg/util/env"
 )
 
+var hexColorRegex = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
 type Config struct {
 	// Basic app info
 	AppName    string
@@ -23,14 +30,69 @@ type Config struct {
 	StaticURL    string
 	StaticPath   string
 
+	// PublicExplore serves every live post read-only under /public, with search, tags and feeds, for a vault run as a
+	// public digital garden. It replaces the public API there.
+	PublicExplore bool
+
+	// Post settings
+	Post PostConfig
+
 	// Server settings
-	HTTP   HTTPConfig
-	Upload UploadConfig
+	HTTP      HTTPConfig
+	PublicAPI PublicAPIConfig
+	Upload    UploadConfig
+	Clip      ClipConfig
+	Archive   ArchiveConfig
+	Search    SearchConfig
 
 	DB    DBConfig
 	Redis RedisConfig
 
-	Log LogConfig
+	Auth    AuthConfig
+	Session SessionConfig
+
+	Log     LogConfig
+	Tracing TracingConfig
+
+	Task   TaskConfig
+	Notify NotifyConfig
+}
+
+type PostConfig struct {
+	// MaxSize is the maximum content size in bytes
+	MaxSize int64
+	// IndexSize is the content size in bytes above which only a truncated version is indexed
+	IndexSize  int64
+	Palette    []PaletteColor
+	TagAliases map[string]string
+
+	// PerPage is the number of posts on a page of the API when none is requested, it is PostsPerPage
+	PerPage int
+	// MaxPerPage caps the number of posts a client can request on a page of the API
+	MaxPerPage int
+
+	// RetentionDays is the number of days a deleted post is kept before being purged
+	RetentionDays int
+	// PurgeBatchSize is the number of posts purged per transaction
+	PurgeBatchSize int
+	// PurgeDryRun only reports the posts that would be purged
+	PurgeDryRun bool
+	// TagRetentionDays is the number of days a deleted or merged tag can be restored before being purged
+	TagRetentionDays int
+	// ActivityRetentionDays is the number of days the activities of the vault are kept before being pruned
+	ActivityRetentionDays int
+
+	// StatsCacheTTL is how long the counts of posts and tags are cached when they don't change, 0 to not cache them
+	StatsCacheTTL time.Duration
+
+	// DraftTTL is how long the draft of a post autosaved by the editor is kept after its last save
+	DraftTTL time.Duration
+}
+
+// PaletteColor is a named post color with its hex value
+type PaletteColor struct {
+	Name string `json:"name"`
+	Hex  string `json:"hex"`
 }
 
 type UploadConfig struct {
@@ -38,12 +100,111 @@ type UploadConfig struct {
 	BasePath     string
 	ImageFormats []string
 	ThumbWidth   uint32
+	// ThumbRegenDelay is the pause after each thumbnail regenerated by the regenerate-thumbnails task
+	ThumbRegenDelay time.Duration
+	// ImageWorkers is the number of images processed at once, ImageQueueSize the number of images waiting for a
+	// worker, each for ImageQueueTimeout at most, before uploads are refused with a 503
+	ImageWorkers      int
+	ImageQueueSize    int
+	ImageQueueTimeout time.Duration
+	// SigningKey is the base64 encoded 32-byte key signing the URLs of the uploads, which are then only served with
+	// a signature expiring after SignedURLTTL. The uploads are served publicly without it.
+	SigningKey   string
+	SignedURLTTL time.Duration
+}
+
+// DecodeSigningKey returns the raw key signing the URLs of the uploads, or nil if none is set
+func (c UploadConfig) DecodeSigningKey() ([]byte, error) {
+	if c.SigningKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(c.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("expected 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// ClipConfig limits the fetching of web pages clipped into posts
+type ClipConfig struct {
+	Timeout      time.Duration
+	MaxPageSize  int64
+	MaxImages    int
+	MaxImageSize int64
+	UserAgent    string
+}
+
+// ArchiveConfig controls the snapshots of the pages linked from posts
+type ArchiveConfig struct {
+	// Enabled snapshots the external links of a post when it is created
+	Enabled     bool
+	Timeout     time.Duration
+	MaxPageSize int64
+	UserAgent   string
+}
+
+// SearchConfig controls the maintenance of the full-text index
+type SearchConfig struct {
+	// StopTokenRatio is the fraction of documents above which a token is reported as too frequent
+	StopTokenRatio float64
+	// StopTokenMinDocs is the number of documents below which frequent tokens are not looked for
+	StopTokenMinDocs int64
+	// PromoteStopTokens turns the frequent tokens into stop tokens, ignored in queries
+	PromoteStopTokens bool
+	// DocEncoding is how the token frequencies of documents are stored: "json", "gzip" or "hash"
+	// Documents stored before a change keep their encoding until `mote reencode-index` is run.
+	DocEncoding string
+	// Tokenizer is the name of the tokenizer registered in pkg/fulltext that documents and queries are analyzed with
+	// The index must be rebuilt after a change.
+	Tokenizer string
+	// DictPaths are the dictionaries loaded by the tokenizer, its default ones if empty
+	DictPaths []string
+	// PostingLimit is the number of documents of a token read in queries, its most recent ones, 0 for all
+	// The index must be rebuilt after setting it for the tokens already indexed.
+	PostingLimit int
 }
 
 type DBConfig struct {
 	URL         string
 	PoolSize    int
 	AutoMigrate bool
+
+	// BusyTimeout is how long a connection waits for a lock before failing with "database is locked"
+	BusyTimeout time.Duration
+	// CacheSize is the page cache size of each connection in KiB
+	CacheSize int64
+	// MmapSize is the number of bytes of the database file that are memory-mapped, 0 disables it
+	MmapSize int64
+
+	// ReadURL is an optional read-only database, e.g. a litestream replica or the same file,
+	// serving read queries so that they do not compete with writes for the main pool
+	ReadURL      string
+	ReadPoolSize int
+
+	// CheckpointCommand is run through the shell after each WAL checkpoint around heavy writes,
+	// with CHECKPOINT_OPERATION and CHECKPOINT_PHASE set, e.g. to trigger a backup snapshot
+	CheckpointCommand string
+	// BackupWindow is a daily "HH:MM-HH:MM" local time range during which write-heavy tasks are paused
+	BackupWindow string
+	// BackupPath is the directory of the backups taken on demand from the admin dashboard
+	BackupPath string
+}
+
+// InBackupWindow reports whether t falls within the backup window
+func (c DBConfig) InBackupWindow(t time.Time) bool {
+	start, end, err := parseBackupWindow(c.BackupWindow)
+	if err != nil {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	// The window may wrap around midnight, e.g. 23:00-01:00
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
 }
 
 type RedisConfig struct {
@@ -60,18 +221,143 @@ type CORSConfig struct {
 	MaxAge           int
 }
 
+type AuthConfig struct {
+	// MaxFailures is the number of failed attempts from an IP within FailureWindow before it is locked out
+	MaxFailures     int
+	FailureWindow   time.Duration
+	LockoutDuration time.Duration
+	// TOTPKey is the base64 encoded 32-byte key encrypting the TOTP secret, two-factor auth is unavailable without it
+	TOTPKey string
+}
+
+// DecodeTOTPKey returns the raw TOTP encryption key, or nil if none is set
+func (c AuthConfig) DecodeTOTPKey() ([]byte, error) {
+	if c.TOTPKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(c.TOTPKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("expected 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+type SessionConfig struct {
+	// TTL is the lifetime of a session, RememberTTL is used instead when logging in with remember-me
+	TTL         time.Duration
+	RememberTTL time.Duration
+	// RotateInterval is how often the session ID is replaced while the session is in use
+	RotateInterval time.Duration
+	// SecureCookie marks the session cookie as HTTPS only
+	SecureCookie bool
+}
+
+// TaskConfig controls the background tasks
+type TaskConfig struct {
+	// StateStore is where the state of tasks is kept across restarts: "sqlite", "redis" or "none"
+	StateStore string
+	// StateSaveInterval is how often the state of tasks is saved, it is also saved once a task is enabled or disabled
+	// and on shutdown
+	StateSaveInterval time.Duration
+	// DistributedLock runs each task on one instance at a time, with a lock in Redis, for replicas sharing a database
+	DistributedLock bool
+	// Jitter is the maximum random delay of the scheduled runs of tasks, so that replicas don't run them at once
+	Jitter time.Duration
+	// ShutdownTimeout is how long the runs in progress are waited for on shutdown
+	ShutdownTimeout time.Duration
+	// Workers is the number of runs in progress at a time of the tasks without a group with a limit
+	Workers int
+	// QueueSize bounds the runs of each group of tasks with a limit, and of the workers, waiting for their turn, and
+	// QueuePolicy tells what a run coming to a full queue does: "block", "drop" or "coalesce". A run blocked by a full
+	// queue is skipped after QueueTimeout.
+	QueueSize    int
+	QueuePolicy  string
+	QueueTimeout time.Duration
+}
+
+// NotifyConfig controls where the notifications are delivered, e.g. the failures of the background tasks
+// Each channel is enabled by its settings, the notifications go to all the enabled ones.
+type NotifyConfig struct {
+	// WebhookURL receives the notifications as JSON
+	WebhookURL string
+	// NtfyURL is the URL of a topic of ntfy, e.g. https://ntfy.sh/my-topic, NtfyToken its access token if any
+	NtfyURL   string
+	NtfyToken string
+	// TelegramToken is the token of the bot sending the notifications to the chat TelegramChatID
+	TelegramToken  string
+	TelegramChatID string
+	// SMTPAddr is the host:port of the server sending the notifications by email from EmailFrom to EmailTo
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	EmailFrom    string
+	EmailTo      []string
+	// Timeout is how long a delivery is waited for
+	Timeout time.Duration
+	// TaskFailures notifies the failed runs of the background tasks and the tasks disabled after failing
+	TaskFailures bool
+}
+
+// TracingConfig controls the OpenTelemetry traces of the background tasks and the Redis calls
+// The spans are exported with OTLP over HTTP, configured by the standard OTEL_EXPORTER_OTLP_* variables.
+type TracingConfig struct {
+	Enabled bool
+	// SampleRatio is the fraction of traces recorded, between 0 and 1
+	SampleRatio float64
+}
+
 type LogConfig struct {
 	LogRequests bool
+
+	// Debug settings record request and response bodies into an in-memory buffer, for troubleshooting clients
+	Debug DebugLogConfig
+}
+
+type DebugLogConfig struct {
+	Enabled bool
+	// SampleRate is the fraction of requests recorded, between 0 and 1
+	SampleRate float64
+	// BodyLimit is the number of bytes of each body that is kept
+	BodyLimit int64
+	// BufferSize is the number of most recent requests that are kept
+	BufferSize int
+	// RedactHeaders are headers whose values are replaced, RedactFields are JSON fields whose values are replaced
+	RedactHeaders []string
+	RedactFields  []string
 }
 
 type HTTPConfig struct {
+	// TrustProxy takes the client IP from X-Forwarded-For or X-Real-IP, only enable it behind a reverse proxy
+	TrustProxy   bool
 	IP           string
 	Port         int
 	MaxBodySize  int64
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
-	CORS         CORSConfig
+	// CORS applies to the API and uploads, SharedCORS to the shared pages
+	// Shared pages send no CORS headers unless SharedCORS has allowed origins
+	CORS       CORSConfig
+	SharedCORS CORSConfig
+}
+
+// PublicAPIConfig controls the read-only API serving the shared posts to third-party readers
+// The API is disabled unless keys are set.
+type PublicAPIConfig struct {
+	// Keys are the API keys allowed to read the shared posts
+	Keys []APIKey
+	// Tiers map the tier of a key to its number of requests per day, counted in UTC
+	Tiers map[string]int64
+}
+
+// APIKey is a key of the public API, its name identifies it in the usage reports without disclosing it
+type APIKey struct {
+	Name string
+	Tier string
+	Key  string
 }
 
 // Load loads the configuration from environment variables and config files
@@ -85,38 +371,104 @@ func Load() *Config {
 	config.AppVersion = env.GetString("APP_VERSION", "1.0.0")
 
 	config.PostsPerPage = env.GetInt("POSTS_PER_PAGE", 20)
+	config.PublicExplore = env.GetBool("PUBLIC_EXPLORE", false)
 
 	config.StaticURL = env.GetString("STATIC_URL", "/static")
 	// If StaticPath is not set, then static files will be served from embedded FS
 	config.StaticPath = env.GetString("STATIC_PATH", "")
 
+	config.Post = PostConfig{
+		MaxSize:    env.GetByteSize("POST_MAX_SIZE", 1024*1024),
+		IndexSize:  env.GetByteSize("POST_INDEX_SIZE", 256*1024),
+		Palette:    parsePalette(env.GetSlice("COLOR_PALETTE", []string{"red:#ef4444", "green:#22c55e", "blue:#3b82f6"})),
+		TagAliases: parseTagAliases(env.GetSlice("TAG_ALIASES", []string{})),
+
+		PerPage:    config.PostsPerPage,
+		MaxPerPage: env.GetInt("POSTS_MAX_PER_PAGE", 100),
+
+		RetentionDays:  env.GetInt("POST_RETENTION_DAYS", 30),
+		PurgeBatchSize: env.GetInt("POST_PURGE_BATCH_SIZE", 500),
+		PurgeDryRun:    env.GetBool("POST_PURGE_DRY_RUN", false),
+
+		TagRetentionDays:      env.GetInt("TAG_RETENTION_DAYS", 30),
+		ActivityRetentionDays: env.GetInt("ACTIVITY_RETENTION_DAYS", 90),
+
+		StatsCacheTTL: env.GetDuration("STATS_CACHE_TTL", 30*time.Second),
+
+		DraftTTL: env.GetDuration("DRAFT_TTL", 7*24*time.Hour),
+	}
+
 	config.HTTP = HTTPConfig{
+		TrustProxy:   env.GetBool("HTTP_TRUST_PROXY", false),
 		IP:           env.GetString("HTTP_IP", "127.0.0.1"),
 		Port:         env.GetInt("HTTP_PORT", 8000),
 		MaxBodySize:  env.GetByteSize("HTTP_MAX_BODY_SIZE", 1024*1024*10),
 		ReadTimeout:  env.GetDuration("HTTP_READ_TIMEOUT", 10*time.Second),
 		WriteTimeout: env.GetDuration("HTTP_WRITE_TIMEOUT", 10*time.Second),
 		IdleTimeout:  env.GetDuration("HTTP_IDLE_TIMEOUT", 30*time.Second),
-		CORS: CORSConfig{
-			AllowedOrigins:   env.GetSlice("CORS_ALLOWED_ORIGINS", []string{}),
-			AllowedMethods:   env.GetSlice("CORS_ALLOWED_METHODS", []string{}),
-			AllowedHeaders:   env.GetSlice("CORS_ALLOWED_HEADERS", []string{}),
-			AllowCredentials: env.GetBool("CORS_ALLOW_CREDENTIALS", false),
-			MaxAge:           env.GetInt("CORS_MAX_AGE", 3600*24),
-		},
+		CORS:         loadCORSConfig("CORS_"),
+		SharedCORS:   loadCORSConfig("SHARED_CORS_"),
+	}
+
+	config.PublicAPI = PublicAPIConfig{
+		Keys:  parseAPIKeys(env.GetSlice("PUBLIC_API_KEYS", []string{})),
+		Tiers: parseAPITiers(env.GetSlice("PUBLIC_API_TIERS", []string{"free:1000", "pro:100000"})),
 	}
 
 	config.Upload = UploadConfig{
-		BaseURL:      env.GetString("UPLOAD_URL", "/uploads"),
-		BasePath:     env.GetString("UPLOAD_PATH", "./uploads"),
-		ImageFormats: env.GetSlice("UPLOAD_IMAGE_FORMATS", []string{"jpg", "jpeg", "png", "webp", "gif"}),
-		ThumbWidth:   uint32(env.GetInt("UPLOAD_THUMB_WIDTH", 128)),
+		BaseURL:         env.GetString("UPLOAD_URL", "/uploads"),
+		BasePath:        env.GetString("UPLOAD_PATH", "./uploads"),
+		ImageFormats:    env.GetSlice("UPLOAD_IMAGE_FORMATS", []string{"jpg", "jpeg", "png", "webp", "gif"}),
+		ThumbWidth:      uint32(env.GetInt("UPLOAD_THUMB_WIDTH", 128)),
+		ThumbRegenDelay: env.GetDuration("UPLOAD_THUMB_REGEN_DELAY", 100*time.Millisecond),
+
+		ImageWorkers:      env.GetInt("UPLOAD_IMAGE_WORKERS", runtime.NumCPU()),
+		ImageQueueSize:    env.GetInt("UPLOAD_IMAGE_QUEUE_SIZE", 16),
+		ImageQueueTimeout: env.GetDuration("UPLOAD_IMAGE_QUEUE_TIMEOUT", 10*time.Second),
+
+		SigningKey:   env.GetString("UPLOAD_SIGNING_KEY", ""),
+		SignedURLTTL: env.GetDuration("UPLOAD_SIGNED_URL_TTL", time.Hour),
+	}
+
+	config.Clip = ClipConfig{
+		Timeout:      env.GetDuration("CLIP_TIMEOUT", 15*time.Second),
+		MaxPageSize:  env.GetByteSize("CLIP_MAX_PAGE_SIZE", 5*1024*1024),
+		MaxImages:    env.GetInt("CLIP_MAX_IMAGES", 20),
+		MaxImageSize: env.GetByteSize("CLIP_MAX_IMAGE_SIZE", 10*1024*1024),
+		UserAgent:    env.GetString("CLIP_USER_AGENT", "Mozilla/5.0 (compatible; "+config.AppName+")"),
+	}
+
+	config.Archive = ArchiveConfig{
+		Enabled:     env.GetBool("ARCHIVE_ENABLED", false),
+		Timeout:     env.GetDuration("ARCHIVE_TIMEOUT", 15*time.Second),
+		MaxPageSize: env.GetByteSize("ARCHIVE_MAX_PAGE_SIZE", 2*1024*1024),
+		UserAgent:   env.GetString("ARCHIVE_USER_AGENT", "Mozilla/5.0 (compatible; "+config.AppName+")"),
+	}
+
+	config.Search = SearchConfig{
+		StopTokenRatio:    env.GetFloat("SEARCH_STOP_TOKEN_RATIO", 0.5),
+		StopTokenMinDocs:  int64(env.GetInt("SEARCH_STOP_TOKEN_MIN_DOCS", 200)),
+		PromoteStopTokens: env.GetBool("SEARCH_PROMOTE_STOP_TOKENS", false),
+		DocEncoding:       env.GetString("SEARCH_DOC_ENCODING", "json"),
+		Tokenizer:         env.GetString("SEARCH_TOKENIZER", "gse"),
+		DictPaths:         env.GetSlice("SEARCH_DICT_PATHS", []string{}),
+		PostingLimit:      env.GetInt("SEARCH_POSTING_LIMIT", 0),
 	}
 
 	config.DB = DBConfig{
 		URL:         env.GetString("DATABASE_URL", "app.db"),
 		PoolSize:    env.GetInt("DATABASE_POOL_SIZE", 5),
 		AutoMigrate: env.GetBool("DATABASE_AUTO_MIGRATE", true),
+		BusyTimeout: env.GetDuration("DATABASE_BUSY_TIMEOUT", 5*time.Second),
+		CacheSize:   env.GetByteSize("DATABASE_CACHE_SIZE", 2*1024*1024) / 1024,
+		MmapSize:    env.GetByteSize("DATABASE_MMAP_SIZE", 0),
+
+		ReadURL:      env.GetString("DATABASE_READ_URL", ""),
+		ReadPoolSize: env.GetInt("DATABASE_READ_POOL_SIZE", 10),
+
+		CheckpointCommand: env.GetString("DATABASE_CHECKPOINT_COMMAND", ""),
+		BackupWindow:      env.GetString("DATABASE_BACKUP_WINDOW", ""),
+		BackupPath:        env.GetString("DATABASE_BACKUP_PATH", "./backups"),
 	}
 
 	config.Redis = RedisConfig{
@@ -125,8 +477,62 @@ func Load() *Config {
 		DB:       env.GetInt("REDIS_DB", 0),
 	}
 
+	config.Auth = AuthConfig{
+		MaxFailures:     env.GetInt("AUTH_MAX_FAILURES", 10),
+		FailureWindow:   env.GetDuration("AUTH_FAILURE_WINDOW", 15*time.Minute),
+		LockoutDuration: env.GetDuration("AUTH_LOCKOUT_DURATION", 15*time.Minute),
+		TOTPKey:         env.GetString("AUTH_TOTP_KEY", ""),
+	}
+
+	config.Session = SessionConfig{
+		TTL:            env.GetDuration("SESSION_TTL", 24*time.Hour),
+		RememberTTL:    env.GetDuration("SESSION_REMEMBER_TTL", 30*24*time.Hour),
+		RotateInterval: env.GetDuration("SESSION_ROTATE_INTERVAL", time.Hour),
+		SecureCookie:   env.GetBool("SESSION_SECURE_COOKIE", false),
+	}
+
 	config.Log = LogConfig{
 		LogRequests: env.GetBool("LOG_REQUESTS", true),
+		Debug: DebugLogConfig{
+			Enabled:       env.GetBool("LOG_DEBUG", false),
+			SampleRate:    env.GetFloat("LOG_DEBUG_SAMPLE_RATE", 1),
+			BodyLimit:     env.GetByteSize("LOG_DEBUG_BODY_LIMIT", 4*1024),
+			BufferSize:    env.GetInt("LOG_DEBUG_BUFFER_SIZE", 200),
+			RedactHeaders: env.GetSlice("LOG_DEBUG_REDACT_HEADERS", []string{"Authorization", "Cookie", "Set-Cookie", "X-TOTP-Code"}),
+			RedactFields:  env.GetSlice("LOG_DEBUG_REDACT_FIELDS", []string{"password", "code"}),
+		},
+	}
+
+	config.Tracing = TracingConfig{
+		Enabled:     env.GetBool("TRACING_ENABLED", false),
+		SampleRatio: env.GetFloat("TRACING_SAMPLE_RATIO", 1),
+	}
+
+	config.Task = TaskConfig{
+		StateStore:        env.GetString("TASK_STATE_STORE", "sqlite"),
+		StateSaveInterval: env.GetDuration("TASK_STATE_SAVE_INTERVAL", time.Minute),
+		DistributedLock:   env.GetBool("TASK_DISTRIBUTED_LOCK", false),
+		Jitter:            env.GetDuration("TASK_JITTER", 0),
+		ShutdownTimeout:   env.GetDuration("TASK_SHUTDOWN_TIMEOUT", 30*time.Second),
+		Workers:           env.GetInt("TASK_WORKERS", 16),
+		QueueSize:         env.GetInt("TASK_QUEUE_SIZE", 16),
+		QueuePolicy:       env.GetString("TASK_QUEUE_POLICY", "coalesce"),
+		QueueTimeout:      env.GetDuration("TASK_QUEUE_TIMEOUT", time.Minute),
+	}
+
+	config.Notify = NotifyConfig{
+		WebhookURL:     env.GetString("NOTIFY_WEBHOOK_URL", ""),
+		NtfyURL:        env.GetString("NOTIFY_NTFY_URL", ""),
+		NtfyToken:      env.GetString("NOTIFY_NTFY_TOKEN", ""),
+		TelegramToken:  env.GetString("NOTIFY_TELEGRAM_TOKEN", ""),
+		TelegramChatID: env.GetString("NOTIFY_TELEGRAM_CHAT_ID", ""),
+		SMTPAddr:       env.GetString("NOTIFY_SMTP_ADDR", ""),
+		SMTPUsername:   env.GetString("NOTIFY_SMTP_USERNAME", ""),
+		SMTPPassword:   env.GetString("NOTIFY_SMTP_PASSWORD", ""),
+		EmailFrom:      env.GetString("NOTIFY_EMAIL_FROM", ""),
+		EmailTo:        env.GetSlice("NOTIFY_EMAIL_TO", []string{}),
+		Timeout:        env.GetDuration("NOTIFY_TIMEOUT", 10*time.Second),
+		TaskFailures:   env.GetBool("NOTIFY_TASK_FAILURES", true),
 	}
 
 	config.validate()
@@ -134,6 +540,17 @@ func Load() *Config {
 	return config
 }
 
+// loadCORSConfig loads a CORS configuration from the environment variables with the given prefix
+func loadCORSConfig(prefix string) CORSConfig {
+	return CORSConfig{
+		AllowedOrigins:   env.GetSlice(prefix+"ALLOWED_ORIGINS", []string{}),
+		AllowedMethods:   env.GetSlice(prefix+"ALLOWED_METHODS", []string{}),
+		AllowedHeaders:   env.GetSlice(prefix+"ALLOWED_HEADERS", []string{}),
+		AllowCredentials: env.GetBool(prefix+"ALLOW_CREDENTIALS", false),
+		MaxAge:           env.GetInt(prefix+"MAX_AGE", 3600*24),
+	}
+}
+
 // ToJSON returns the configuration as a JSON string, optionally hiding sensitive information
 func (c *Config) ToJSON(hideSensitive bool) (string, error) {
 	// Create a copy to avoid exposing sensitive info
@@ -143,6 +560,17 @@ func (c *Config) ToJSON(hideSensitive bool) (string, error) {
 		safe.DB.URL = maskSensitive(safe.DB.URL)
 		safe.Redis.URL = maskSensitive(safe.Redis.URL)
 		safe.Redis.Password = maskSecret(safe.Redis.Password)
+		safe.Auth.TOTPKey = maskSecret(safe.Auth.TOTPKey)
+		safe.Upload.SigningKey = maskSecret(safe.Upload.SigningKey)
+		safe.Notify.WebhookURL = maskSecret(safe.Notify.WebhookURL)
+		safe.Notify.NtfyToken = maskSecret(safe.Notify.NtfyToken)
+		safe.Notify.TelegramToken = maskSecret(safe.Notify.TelegramToken)
+		safe.Notify.SMTPPassword = maskSecret(safe.Notify.SMTPPassword)
+		safe.PublicAPI.Keys = make([]APIKey, len(c.PublicAPI.Keys))
+		for i, key := range c.PublicAPI.Keys {
+			key.Key = maskSecret(key.Key)
+			safe.PublicAPI.Keys[i] = key
+		}
 	}
 
 	data, err := json.MarshalIndent(safe, "", "  ")
@@ -183,6 +611,60 @@ func (c *Config) validate() {
 		errs = append(errs, "StaticURL cannot be empty")
 	}
 
+	// Validate post config
+	if c.Post.MaxSize <= 0 {
+		errs = append(errs, "Post.MaxSize must be greater than 0")
+	}
+	if c.Post.IndexSize <= 0 {
+		errs = append(errs, "Post.IndexSize must be greater than 0")
+	}
+	if c.Post.IndexSize > c.Post.MaxSize {
+		errs = append(errs, "Post.IndexSize cannot exceed Post.MaxSize")
+	}
+
+	if c.Post.MaxPerPage < c.PostsPerPage || c.Post.MaxPerPage > 1000 {
+		errs = append(errs, "Post.MaxPerPage must be between PostsPerPage and 1000")
+	}
+
+	if c.Post.RetentionDays < 0 {
+		errs = append(errs, "Post.RetentionDays cannot be negative")
+	}
+	if c.Post.TagRetentionDays < 0 {
+		errs = append(errs, "Post.TagRetentionDays cannot be negative")
+	}
+	if c.Post.ActivityRetentionDays < 0 {
+		errs = append(errs, "Post.ActivityRetentionDays cannot be negative")
+	}
+	if c.Post.StatsCacheTTL < 0 {
+		errs = append(errs, "Post.StatsCacheTTL cannot be negative")
+	}
+	if c.Post.DraftTTL <= 0 {
+		errs = append(errs, "Post.DraftTTL must be greater than 0")
+	}
+	if c.Post.PurgeBatchSize <= 0 {
+		errs = append(errs, "Post.PurgeBatchSize must be greater than 0")
+	}
+
+	colorNames := make(map[string]bool)
+	for _, color := range c.Post.Palette {
+		if color.Name == "" {
+			errs = append(errs, "Palette color name cannot be empty")
+		} else if colorNames[color.Name] {
+			errs = append(errs, fmt.Sprintf("duplicate palette color: %s", color.Name))
+		}
+		colorNames[color.Name] = true
+
+		if !hexColorRegex.MatchString(color.Hex) {
+			errs = append(errs, fmt.Sprintf("invalid hex value '%s' for palette color '%s'", color.Hex, color.Name))
+		}
+	}
+
+	for keyword, tag := range c.Post.TagAliases {
+		if keyword == "" || tag == "" {
+			errs = append(errs, fmt.Sprintf("invalid tag alias '%s:%s'", keyword, tag))
+		}
+	}
+
 	// Validate HTTP config
 	if c.HTTP.IP == "" {
 		errs = append(errs, "HTTP.IP cannot be empty")
@@ -208,8 +690,39 @@ func (c *Config) validate() {
 	}
 
 	// Validate CORS config
-	if c.HTTP.CORS.MaxAge < 0 {
-		errs = append(errs, "CORS.MaxAge cannot be negative")
+	for name, cors := range map[string]CORSConfig{"CORS": c.HTTP.CORS, "SharedCORS": c.HTTP.SharedCORS} {
+		if cors.MaxAge < 0 {
+			errs = append(errs, fmt.Sprintf("%s.MaxAge cannot be negative", name))
+		}
+		for _, origin := range cors.AllowedOrigins {
+			if strings.Count(origin, "*") > 1 || (origin != "*" && strings.Contains(origin, "*") && !strings.Contains(origin, "://*.")) {
+				errs = append(errs, fmt.Sprintf("%s origin '%s' is invalid, wildcards are only allowed as '*' or 'scheme://*.domain'", name, origin))
+			}
+		}
+	}
+
+	// Validate public API config
+	if c.PublicExplore && len(c.PublicAPI.Keys) > 0 {
+		errs = append(errs, "PublicExplore and the public API keys can't be set together, both are served under /public")
+	}
+	for tier, quota := range c.PublicAPI.Tiers {
+		if tier == "" || quota <= 0 {
+			errs = append(errs, fmt.Sprintf("invalid public API tier '%s:%d', the quota must be greater than 0", tier, quota))
+		}
+	}
+	keyNames := make(map[string]bool)
+	for _, key := range c.PublicAPI.Keys {
+		if key.Name == "" || key.Key == "" {
+			errs = append(errs, "public API keys must be set as name:tier:key")
+			continue
+		}
+		if keyNames[key.Name] {
+			errs = append(errs, fmt.Sprintf("duplicate public API key name: %s", key.Name))
+		}
+		keyNames[key.Name] = true
+		if _, ok := c.PublicAPI.Tiers[key.Tier]; !ok {
+			errs = append(errs, fmt.Sprintf("unknown tier '%s' of public API key '%s'", key.Tier, key.Name))
+		}
 	}
 
 	// Validate Upload config
@@ -250,6 +763,65 @@ func (c *Config) validate() {
 	if c.Upload.ThumbWidth > 4096 {
 		errs = append(errs, "Upload.ThumbWidth cannot exceed 4096")
 	}
+	if c.Upload.ThumbRegenDelay < 0 {
+		errs = append(errs, "Upload.ThumbRegenDelay cannot be negative")
+	}
+	if c.Upload.ImageWorkers <= 0 {
+		errs = append(errs, "Upload.ImageWorkers must be greater than 0")
+	}
+	if c.Upload.ImageQueueSize < 0 {
+		errs = append(errs, "Upload.ImageQueueSize cannot be negative")
+	}
+	if c.Upload.ImageQueueTimeout <= 0 {
+		errs = append(errs, "Upload.ImageQueueTimeout must be greater than 0")
+	}
+	if _, err := c.Upload.DecodeSigningKey(); err != nil {
+		errs = append(errs, fmt.Sprintf("Upload.SigningKey is invalid: %v", err))
+	}
+	if c.Upload.SignedURLTTL < time.Second {
+		errs = append(errs, "Upload.SignedURLTTL must be at least 1s")
+	}
+
+	// Validate Clip config
+	if c.Clip.Timeout <= 0 {
+		errs = append(errs, "Clip.Timeout must be greater than 0")
+	}
+	if c.Clip.MaxPageSize <= 0 {
+		errs = append(errs, "Clip.MaxPageSize must be greater than 0")
+	}
+	if c.Clip.MaxImages < 0 {
+		errs = append(errs, "Clip.MaxImages cannot be negative")
+	}
+	if c.Clip.MaxImageSize <= 0 {
+		errs = append(errs, "Clip.MaxImageSize must be greater than 0")
+	}
+
+	// Validate Archive config
+	if c.Archive.Timeout <= 0 {
+		errs = append(errs, "Archive.Timeout must be greater than 0")
+	}
+	if c.Archive.MaxPageSize <= 0 {
+		errs = append(errs, "Archive.MaxPageSize must be greater than 0")
+	}
+
+	// Validate Search config
+	if c.Search.StopTokenRatio <= 0 || c.Search.StopTokenRatio > 1 {
+		errs = append(errs, "Search.StopTokenRatio must be between 0 and 1")
+	}
+	if c.Search.StopTokenMinDocs < 0 {
+		errs = append(errs, "Search.StopTokenMinDocs cannot be negative")
+	}
+	if c.Search.PostingLimit < 0 {
+		errs = append(errs, "Search.PostingLimit cannot be negative")
+	}
+	switch c.Search.DocEncoding {
+	case "json", "gzip", "hash":
+	default:
+		errs = append(errs, "Search.DocEncoding must be json, gzip or hash")
+	}
+	if c.Search.Tokenizer == "" {
+		errs = append(errs, "Search.Tokenizer is required")
+	}
 
 	// Validate DB config
 	if c.DB.URL == "" {
@@ -261,6 +833,21 @@ func (c *Config) validate() {
 	if c.DB.PoolSize > 1000 {
 		errs = append(errs, "DB.PoolSize cannot exceed 1000")
 	}
+	if c.DB.ReadURL != "" && (c.DB.ReadPoolSize <= 0 || c.DB.ReadPoolSize > 1000) {
+		errs = append(errs, "DB.ReadPoolSize must be between 1 and 1000")
+	}
+	if c.DB.BusyTimeout < 0 {
+		errs = append(errs, "DB.BusyTimeout cannot be negative")
+	}
+	if c.DB.CacheSize <= 0 {
+		errs = append(errs, "DB.CacheSize must be at least 1K")
+	}
+	if c.DB.MmapSize < 0 {
+		errs = append(errs, "DB.MmapSize cannot be negative")
+	}
+	if _, _, err := parseBackupWindow(c.DB.BackupWindow); c.DB.BackupWindow != "" && err != nil {
+		errs = append(errs, fmt.Sprintf("invalid DB.BackupWindow: %v", err))
+	}
 
 	// Validate Redis config
 	if c.Redis.URL == "" {
@@ -273,12 +860,184 @@ func (c *Config) validate() {
 		errs = append(errs, "Redis.DB cannot exceed 15")
 	}
 
+	// Validate auth config
+	if c.Auth.MaxFailures <= 0 {
+		errs = append(errs, "Auth.MaxFailures must be greater than 0")
+	}
+	if c.Auth.FailureWindow <= 0 {
+		errs = append(errs, "Auth.FailureWindow must be greater than 0")
+	}
+	if c.Auth.LockoutDuration <= 0 {
+		errs = append(errs, "Auth.LockoutDuration must be greater than 0")
+	}
+	if _, err := c.Auth.DecodeTOTPKey(); err != nil {
+		errs = append(errs, fmt.Sprintf("Auth.TOTPKey is invalid: %v", err))
+	}
+
+	// Validate session config
+	if c.Session.TTL <= 0 {
+		errs = append(errs, "Session.TTL must be greater than 0")
+	}
+	if c.Session.RememberTTL < c.Session.TTL {
+		errs = append(errs, "Session.RememberTTL cannot be shorter than Session.TTL")
+	}
+	if c.Session.RotateInterval <= 0 {
+		errs = append(errs, "Session.RotateInterval must be greater than 0")
+	}
+
+	// Validate Task config
+	switch c.Task.StateStore {
+	case "sqlite", "redis", "none":
+	default:
+		errs = append(errs, "Task.StateStore must be sqlite, redis or none")
+	}
+	if c.Task.StateSaveInterval <= 0 {
+		errs = append(errs, "Task.StateSaveInterval must be greater than 0")
+	}
+	if c.Task.Jitter < 0 {
+		errs = append(errs, "Task.Jitter cannot be negative")
+	}
+	if c.Task.ShutdownTimeout <= 0 {
+		errs = append(errs, "Task.ShutdownTimeout must be greater than 0")
+	}
+	if c.Task.Workers <= 0 {
+		errs = append(errs, "Task.Workers must be greater than 0")
+	}
+	if c.Task.QueueSize <= 0 {
+		errs = append(errs, "Task.QueueSize must be greater than 0")
+	}
+	if c.Task.QueueTimeout <= 0 {
+		errs = append(errs, "Task.QueueTimeout must be greater than 0")
+	}
+	switch c.Task.QueuePolicy {
+	case "block", "drop", "coalesce":
+	default:
+		errs = append(errs, "Task.QueuePolicy must be block, drop or coalesce")
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, "Tracing.SampleRatio must be between 0 and 1")
+	}
+
+	// Validate notify config
+	for _, setting := range [][2]string{{"Notify.WebhookURL", c.Notify.WebhookURL}, {"Notify.NtfyURL", c.Notify.NtfyURL}} {
+		u, err := url.Parse(setting[1])
+		if setting[1] != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https")) {
+			errs = append(errs, fmt.Sprintf("%s must be an http or https URL", setting[0]))
+		}
+	}
+	if (c.Notify.TelegramToken == "") != (c.Notify.TelegramChatID == "") {
+		errs = append(errs, "Notify.TelegramToken and Notify.TelegramChatID must be set together")
+	}
+	if c.Notify.SMTPAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Notify.SMTPAddr); err != nil {
+			errs = append(errs, fmt.Sprintf("Notify.SMTPAddr '%s' must be host:port", c.Notify.SMTPAddr))
+		}
+		if c.Notify.EmailFrom == "" || len(c.Notify.EmailTo) == 0 {
+			errs = append(errs, "Notify.EmailFrom and Notify.EmailTo are required with Notify.SMTPAddr")
+		}
+	}
+	if c.Notify.Timeout <= 0 {
+		errs = append(errs, "Notify.Timeout must be greater than 0")
+	}
+
+	// Validate debug log config
+	if c.Log.Debug.SampleRate < 0 || c.Log.Debug.SampleRate > 1 {
+		errs = append(errs, "Log.Debug.SampleRate must be between 0 and 1")
+	}
+	if c.Log.Debug.BodyLimit < 0 {
+		errs = append(errs, "Log.Debug.BodyLimit cannot be negative")
+	}
+	if c.Log.Debug.BufferSize <= 0 {
+		errs = append(errs, "Log.Debug.BufferSize must be greater than 0")
+	}
+
 	// If there are validation errors, panic with all of them
 	if len(errs) > 0 {
 		panic(fmt.Sprintf("configuration validation failed:\n  - %s", strings.Join(errs, "\n  - ")))
 	}
 }
 
+// parseBackupWindow parses a "HH:MM-HH:MM" range into minutes since midnight
+func parseBackupWindow(window string) (start, end int, err error) {
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not in HH:MM-HH:MM format", window)
+	}
+	if start, err = parseClock(from); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseClock(to); err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("%q is empty", window)
+	}
+	return start, end, nil
+}
+
+// parseClock parses a "HH:MM" time of day into minutes since midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parsePalette parses "name:#hex" entries into palette colors
+func parsePalette(entries []string) []PaletteColor {
+	palette := make([]PaletteColor, 0, len(entries))
+	for _, entry := range entries {
+		name, hex, _ := strings.Cut(entry, ":")
+		palette = append(palette, PaletteColor{
+			Name: strings.TrimSpace(name),
+			Hex:  strings.TrimSpace(hex),
+		})
+	}
+	return palette
+}
+
+// parseTagAliases parses "keyword:tag" entries into a keyword to tag mapping
+func parseTagAliases(entries []string) map[string]string {
+	aliases := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		keyword, tag, _ := strings.Cut(entry, ":")
+		aliases[strings.TrimSpace(keyword)] = strings.TrimSpace(tag)
+	}
+	return aliases
+}
+
+// parseAPIKeys parses "name:tier:key" entries into public API keys, the key itself may contain colons
+func parseAPIKeys(entries []string) []APIKey {
+	keys := make([]APIKey, 0, len(entries))
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 3 {
+			keys = append(keys, APIKey{})
+			continue
+		}
+		keys = append(keys, APIKey{
+			Name: strings.TrimSpace(parts[0]),
+			Tier: strings.TrimSpace(parts[1]),
+			Key:  strings.TrimSpace(parts[2]),
+		})
+	}
+	return keys
+}
+
+// parseAPITiers parses "tier:requests" entries into the daily quotas of the public API tiers
+// An invalid quota is parsed as 0, which is reported by the validation
+func parseAPITiers(entries []string) map[string]int64 {
+	tiers := make(map[string]int64, len(entries))
+	for _, entry := range entries {
+		tier, quota, _ := strings.Cut(entry, ":")
+		n, _ := strconv.ParseInt(strings.TrimSpace(quota), 10, 64)
+		tiers[strings.TrimSpace(tier)] = n
+	}
+	return tiers
+}
+
 // maskSensitive masks sensitive information in URLs
 func maskSensitive(url string) string {
 	// Check if it contains "://"
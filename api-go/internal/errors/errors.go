@@ -31,6 +31,30 @@ func Unauthorized(message ...string) error {
 	return m.HTTPError{Code: 401, Err: "unauthorized", Message: msg}
 }
 
+func Forbidden(message ...string) error {
+	msg := ""
+	if len(message) > 0 {
+		msg = message[0]
+	}
+	return m.HTTPError{Code: 403, Err: "forbidden", Message: msg}
+}
+
+func TooManyRequests(message ...string) error {
+	msg := ""
+	if len(message) > 0 {
+		msg = message[0]
+	}
+	return m.HTTPError{Code: 429, Err: "too_many_attempts", Message: msg}
+}
+
+func ContentTooLarge(message ...string) error {
+	msg := ""
+	if len(message) > 0 {
+		msg = message[0]
+	}
+	return m.HTTPError{Code: 413, Err: "content_too_large", Message: msg}
+}
+
 func InternalError(message ...string) error {
 	msg := ""
 	if len(message) > 0 {
@@ -39,6 +63,14 @@ func InternalError(message ...string) error {
 	return m.HTTPError{Code: 500, Err: "internal_error", Message: msg}
 }
 
+func ServiceUnavailable(message ...string) error {
+	msg := ""
+	if len(message) > 0 {
+		msg = message[0]
+	}
+	return m.HTTPError{Code: 503, Err: "service_unavailable", Message: msg}
+}
+
 func SendJSONError(w http.ResponseWriter, code int, err string, message ...string) {
 	msg := ""
 	if len(message) > 0 {
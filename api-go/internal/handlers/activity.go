@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	m "github.com/cymoo/mint"
+	"github.com/cymoo/mote/internal/config"
+	e "github.com/cymoo/mote/internal/errors"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+)
+
+type ActivityHandler struct {
+	activityService *services.ActivityService
+	config          *config.PostConfig
+}
+
+func NewActivityHandler(activityService *services.ActivityService, config *config.PostConfig) *ActivityHandler {
+	return &ActivityHandler{
+		activityService: activityService,
+		config:          config,
+	}
+}
+
+// GetActivities returns a page of the activity stream of the vault, newest first
+// It returns a BadRequest error for an unknown activity type.
+func (h *ActivityHandler) GetActivities(r *http.Request, query m.Query[models.ActivityRequest]) (*models.ActivityPage, error) {
+	pageSize, err := postPageSize(query.Value.Limit, h.config)
+	if err != nil {
+		return nil, err
+	}
+
+	activities, err := h.activityService.List(r.Context(), query.Value, pageSize)
+	if errors.Is(err, services.ErrInvalidFilter) {
+		return nil, e.BadRequest(err.Error())
+	}
+	if err != nil {
+		log.Printf("error getting activities: %v", err)
+		return nil, e.InternalError()
+	}
+
+	cursor := int64(-1)
+	if len(activities) > 0 {
+		cursor = activities[len(activities)-1].ID
+	}
+	return &models.ActivityPage{Activities: activities, Cursor: cursor}, nil
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	m "github.com/cymoo/mint"
+	e "github.com/cymoo/mote/internal/errors"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+)
+
+type AdminHandler struct {
+	db *services.DB
+}
+
+func NewAdminHandler(db *services.DB) *AdminHandler {
+	return &AdminHandler{db: db}
+}
+
+// GetDBStats reports the connection pool statistics and the effective SQLite settings
+// Growing wait counts under write bursts point at a pool that is too small or a busy timeout that is too short
+func (h *AdminHandler) GetDBStats(r *http.Request) (models.DBStats, error) {
+	stats := h.db.Stats()
+	result := models.DBStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		WriteQueue:         h.db.WriteQueue().Stats(),
+	}
+
+	// Pragmas are per connection, this reads them from whichever connection the pool hands out
+	pragmas := map[string]any{
+		"journal_mode": &result.Pragmas.JournalMode,
+		"busy_timeout": &result.Pragmas.BusyTimeout,
+		"cache_size":   &result.Pragmas.CacheSize,
+		"mmap_size":    &result.Pragmas.MmapSize,
+		"foreign_keys": &result.Pragmas.ForeignKeys,
+	}
+	for name, dest := range pragmas {
+		if err := h.db.GetContext(r.Context(), dest, "PRAGMA "+name); err != nil {
+			log.Printf("error reading pragma %s: %v", name, err)
+			return models.DBStats{}, err
+		}
+	}
+
+	return result, nil
+}
+
+// RecomputeChildrenCounts reports the posts whose children count drifted, and fixes them unless it is a dry run
+func (h *AdminHandler) RecomputeChildrenCounts(r *http.Request, payload m.JSON[models.RecomputeRequest]) (*models.ChildrenCountReport, error) {
+	report, err := services.NewPostService(h.db).RecomputeChildrenCounts(r.Context(), payload.Value.DryRun)
+	if err != nil {
+		log.Printf("error recomputing children counts: %v", err)
+		return nil, e.InternalError()
+	}
+	return report, nil
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	m "github.com/cymoo/mint"
+	"github.com/cymoo/mote/internal/config"
+	e "github.com/cymoo/mote/internal/errors"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+	"github.com/cymoo/mote/pkg/util/totp"
+)
+
+// SessionCookieName is the name of the cookie holding the session ID
+const SessionCookieName = "session"
+
+type AuthHandler struct {
+	authService      *services.AuthService
+	sessionService   *services.SessionService
+	twoFactorService *services.TwoFactorService
+	appName          string
+	config           *config.SessionConfig
+}
+
+func NewAuthHandler(
+	authService *services.AuthService,
+	sessionService *services.SessionService,
+	twoFactorService *services.TwoFactorService,
+	appName string,
+	config *config.SessionConfig,
+) *AuthHandler {
+	return &AuthHandler{
+		authService:      authService,
+		sessionService:   sessionService,
+		twoFactorService: twoFactorService,
+		appName:          appName,
+		config:           config,
+	}
+}
+
+// Login validates the password, and the TOTP or recovery code if two-factor auth is enabled, then starts a new session
+// Any session the client already had is discarded, so a session ID can't be fixed before login
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request, payload m.JSON[models.LoginRequest]) (m.StatusCode, error) {
+	ctx := r.Context()
+	ip := services.ClientIP(r)
+
+	remaining, err := h.authService.LockoutRemaining(ctx, ip)
+	if err != nil {
+		return 0, err
+	}
+	if remaining > 0 {
+		return 0, e.TooManyRequests()
+	}
+
+	if !h.authService.IsValidToken(payload.Value.Password) {
+		h.authService.RecordRequestFailure(r)
+		return 0, e.Unauthorized("password is wrong")
+	}
+
+	twoFactor, err := h.twoFactorService.IsEnabled(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if twoFactor {
+		if payload.Value.Code == "" {
+			return 0, m.HTTPError{Code: 401, Err: "two_factor_required", Message: "a two-factor code is required"}
+		}
+
+		ok, err := h.twoFactorService.Verify(ctx, payload.Value.Code)
+		if err != nil {
+			log.Printf("error verifying two-factor code: %v", err)
+			return 0, err
+		}
+		if !ok {
+			h.authService.RecordRequestFailure(r)
+			return 0, e.Unauthorized("two-factor code is wrong")
+		}
+	}
+
+	if err := h.authService.ResetFailures(ctx, ip); err != nil {
+		log.Printf("error resetting auth failures: %v", err)
+	}
+
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		if err := h.sessionService.Delete(ctx, cookie.Value); err != nil {
+			log.Printf("error deleting previous session: %v", err)
+		}
+	}
+
+	session, err := h.sessionService.Create(ctx, payload.Value.RememberMe, twoFactor)
+	if err != nil {
+		log.Printf("error creating session: %v", err)
+		return 0, err
+	}
+	SetSessionCookie(w, session, h.config.SecureCookie)
+
+	return http.StatusNoContent, nil
+}
+
+// Logout ends the current session and clears its cookie
+// It only accepts same-origin requests, so another site can't log the user out
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) (m.StatusCode, error) {
+	if !isSameOrigin(r) {
+		return 0, e.Forbidden("cross-origin logout is not allowed")
+	}
+
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		if err := h.sessionService.Delete(r.Context(), cookie.Value); err != nil {
+			log.Printf("error deleting session: %v", err)
+			return 0, err
+		}
+	}
+	clearSessionCookie(w, h.config.SecureCookie)
+
+	return http.StatusNoContent, nil
+}
+
+// GetSession describes how the current request is authenticated
+func (h *AuthHandler) GetSession(r *http.Request) (models.SessionInfo, error) {
+	session := services.SessionFromContext(r.Context())
+	if session == nil {
+		return models.SessionInfo{Method: "token"}, nil
+	}
+
+	createdAt := session.CreatedAt.UnixMilli()
+	expiresAt := session.ExpiresAt.UnixMilli()
+	return models.SessionInfo{
+		Method:     "session",
+		CreatedAt:  &createdAt,
+		ExpiresAt:  &expiresAt,
+		RememberMe: session.RememberMe,
+		TwoFactor:  session.TwoFactor,
+	}, nil
+}
+
+// GetTwoFactorStatus reports whether two-factor auth can be enrolled and whether it is enabled
+func (h *AuthHandler) GetTwoFactorStatus(r *http.Request) (models.TwoFactorStatus, error) {
+	enabled, err := h.twoFactorService.IsEnabled(r.Context())
+	if err != nil {
+		return models.TwoFactorStatus{}, err
+	}
+	return models.TwoFactorStatus{
+		Available: h.twoFactorService.IsAvailable(),
+		Enabled:   enabled,
+	}, nil
+}
+
+// EnrollTwoFactor generates a pending TOTP secret, which must be confirmed with a code before it is enforced
+func (h *AuthHandler) EnrollTwoFactor(r *http.Request) (models.TwoFactorEnrollment, error) {
+	secret, err := h.twoFactorService.Enroll(r.Context())
+	if err != nil {
+		log.Printf("error enrolling two-factor auth: %v", err)
+		return models.TwoFactorEnrollment{}, e.BadRequest(err.Error())
+	}
+	return models.TwoFactorEnrollment{
+		Secret: secret,
+		URL:    totp.URL(h.appName, "admin", secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables two-factor auth and returns the recovery codes, which are only shown this once
+func (h *AuthHandler) ConfirmTwoFactor(r *http.Request, payload m.JSON[models.TwoFactorCode]) (models.RecoveryCodes, error) {
+	codes, ok, err := h.twoFactorService.Confirm(r.Context(), payload.Value.Code)
+	if errors.Is(err, services.ErrTwoFactorNotEnrolled) {
+		return models.RecoveryCodes{}, e.BadRequest(err.Error())
+	}
+	if err != nil {
+		log.Printf("error confirming two-factor auth: %v", err)
+		return models.RecoveryCodes{}, err
+	}
+	if !ok {
+		return models.RecoveryCodes{}, e.BadRequest("two-factor code is wrong")
+	}
+	return models.RecoveryCodes{Codes: codes}, nil
+}
+
+// DisableTwoFactor removes the TOTP secret and recovery codes
+func (h *AuthHandler) DisableTwoFactor(r *http.Request) (m.StatusCode, error) {
+	if err := h.twoFactorService.Disable(r.Context()); err != nil {
+		log.Printf("error disabling two-factor auth: %v", err)
+		return 0, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// SetSessionCookie sends the session ID in an HttpOnly cookie
+// Remember-me sessions persist until they expire, others end with the browser session
+func SetSessionCookie(w http.ResponseWriter, session *services.Session, secure bool) {
+	cookie := &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    session.ID,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	}
+	if session.RememberMe {
+		cookie.Expires = session.ExpiresAt
+	}
+	http.SetCookie(w, cookie)
+}
+
+// clearSessionCookie tells the browser to drop the session cookie
+func clearSessionCookie(w http.ResponseWriter, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// isSameOrigin checks that the request was not sent by another site
+// Browsers always send Origin on cross-origin POST requests, so a missing Origin is a same-origin or non-browser client
+func isSameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+		return false
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
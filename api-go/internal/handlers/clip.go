@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	m "github.com/cymoo/mint"
+	e "github.com/cymoo/mote/internal/errors"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+)
+
+type ClipHandler struct {
+	clipService   *services.ClipService
+	uploadService *services.UploadService
+	postHandler   *PostHandler
+}
+
+func NewClipHandler(clipService *services.ClipService, uploadService *services.UploadService, postHandler *PostHandler) *ClipHandler {
+	return &ClipHandler{
+		clipService:   clipService,
+		uploadService: uploadService,
+		postHandler:   postHandler,
+	}
+}
+
+// ClipPage creates a post from the readable content of a web page
+// A bookmarklet can send the URL of the current page, or its HTML for pages behind a login.
+// It returns a BadRequest error if the page can't be fetched or has no readable content,
+// and a ContentTooLarge error if the page or the resulting post is too large.
+func (h *ClipHandler) ClipPage(w http.ResponseWriter, r *http.Request, body m.JSON[models.ClipRequest]) (*models.CreateResponse, error) {
+	req, err := h.clipService.Clip(r.Context(), body.Value)
+	switch {
+	case errors.Is(err, services.ErrClipTooLarge):
+		return nil, e.ContentTooLarge(err.Error())
+	case errors.Is(err, services.ErrInvalidClipURL), errors.Is(err, services.ErrClipSource),
+		errors.Is(err, services.ErrClipFetchFailed), errors.Is(err, services.ErrClipEmpty):
+		return nil, e.BadRequest(err.Error())
+	case err != nil:
+		log.Printf("error clipping page: %v", err)
+		return nil, err
+	}
+
+	rv, err := h.postHandler.CreatePost(w, r, m.JSON[models.CreatePostRequest]{Value: *req})
+	if err != nil {
+		h.uploadService.DeleteFiles(req.Files)
+		return nil, err
+	}
+	return rv, nil
+}
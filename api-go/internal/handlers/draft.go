@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	m "github.com/cymoo/mint"
+	e "github.com/cymoo/mote/internal/errors"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+)
+
+type DraftHandler struct {
+	draftService *services.DraftService
+	postHandler  *PostHandler
+}
+
+func NewDraftHandler(draftService *services.DraftService, postHandler *PostHandler) *DraftHandler {
+	return &DraftHandler{
+		draftService: draftService,
+		postHandler:  postHandler,
+	}
+}
+
+// SaveDraft autosaves the content of the editor without creating or updating a post
+// It returns a BadRequest error for an invalid key, and a ContentTooLarge error if the content exceeds the maximum
+// size of a post.
+func (h *DraftHandler) SaveDraft(r *http.Request, body m.JSON[models.SaveDraftRequest]) (*models.Draft, error) {
+	if err := h.postHandler.validateSize(body.Value.Content); err != nil {
+		return nil, err
+	}
+
+	draft, err := h.draftService.Save(r.Context(), body.Value)
+	if errors.Is(err, services.ErrInvalidDraftKey) {
+		return nil, e.BadRequest(err.Error())
+	}
+	if err != nil {
+		log.Printf("error saving draft %q: %v", body.Value.Key, err)
+		return nil, err
+	}
+	return draft, nil
+}
+
+// GetDraft retrieves a draft, or returns a NotFound error if it doesn't exist or expired
+func (h *DraftHandler) GetDraft(r *http.Request, query m.Query[models.DraftKey]) (*models.Draft, error) {
+	draft, err := h.draftService.Get(r.Context(), query.Value.Key)
+	if errors.Is(err, services.ErrDraftNotFound) {
+		return nil, e.NotFound(err.Error())
+	}
+	if err != nil {
+		log.Printf("error getting draft %q: %v", query.Value.Key, err)
+		return nil, err
+	}
+	return draft, nil
+}
+
+// GetDrafts retrieves the drafts that didn't expire, the last saved first
+func (h *DraftHandler) GetDrafts(r *http.Request) ([]models.Draft, error) {
+	drafts, err := h.draftService.List(r.Context())
+	if err != nil {
+		log.Printf("error getting drafts: %v", err)
+		return nil, err
+	}
+	return drafts, nil
+}
+
+// DeleteDraft deletes a draft, e.g. once saved as a post
+// It returns a 204 No Content status, whether or not the draft existed.
+func (h *DraftHandler) DeleteDraft(r *http.Request, payload m.JSON[models.DraftKey]) (m.StatusCode, error) {
+	if err := h.draftService.Delete(r.Context(), payload.Value.Key); err != nil {
+		log.Printf("error deleting draft %q: %v", payload.Value.Key, err)
+		return 0, err
+	}
+	return 204, nil
+}
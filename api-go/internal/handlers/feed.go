@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+// atomFeed is an Atom feed, see RFC 4287
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Base    string      `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Link      atomLink    `xml:"link"`
+	Summary   string      `xml:"summary,omitempty"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Feed serves the Atom feed of the latest posts
+func (h *PostPageHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	posts, err := h.posts.GetPosts(r.Context(), h.perPage, 0)
+	if err != nil {
+		h.render500(w, err)
+		return
+	}
+	h.writeFeed(w, r, "mote", h.basePath+"/", h.basePath+"/feed.atom", posts)
+}
+
+// tagFeed serves the Atom feed of the latest visible posts under a tag
+func (h *PostPageHandler) tagFeed(w http.ResponseWriter, r *http.Request, name string) {
+	posts, err := h.posts.GetTagPosts(r.Context(), name, h.perPage, 0)
+	if err != nil {
+		h.render500(w, err)
+		return
+	}
+	// A tag without visible posts is not disclosed
+	if len(posts) == 0 {
+		h.render404(w)
+		return
+	}
+	tagPath := h.basePath + "/tags/" + escapeTagPath(name)
+	h.writeFeed(w, r, "#"+name, tagPath, tagPath+".atom", posts)
+}
+
+// writeFeed writes the Atom feed at feedPath of the posts listed by the page at pagePath
+// Links in the content are relative, they resolve against the xml:base of the feed
+func (h *PostPageHandler) writeFeed(w http.ResponseWriter, r *http.Request, title, pagePath, feedPath string, posts []models.Post) {
+	origin := requestOrigin(r)
+	pageURL := origin + pagePath
+	feedURL := origin + feedPath
+	feed := atomFeed{
+		Base:   origin + "/",
+		ID:     feedURL,
+		Title:  title,
+		Author: atomAuthor{Name: "mote"},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: feedURL},
+			{Rel: "alternate", Type: "text/html", Href: pageURL},
+		},
+	}
+
+	var updated int64
+	for _, post := range posts {
+		feed.Entries = append(feed.Entries, h.atomEntry(r, origin, post))
+		updated = max(updated, post.UpdatedAt)
+	}
+	feed.Updated = atomTime(updated)
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		h.render500(w, err)
+	}
+}
+
+// atomEntry converts a post to a feed entry
+func (h *PostPageHandler) atomEntry(r *http.Request, origin string, post models.Post) atomEntry {
+	postURL := origin + h.basePath + "/" + strconv.FormatInt(post.ID, 10)
+	title := post.Title.String
+	if title == "" {
+		title = "Untitled"
+	}
+
+	return atomEntry{
+		ID:        postURL,
+		Title:     title,
+		Published: atomTime(post.CreatedAt),
+		Updated:   atomTime(post.UpdatedAt),
+		Link:      atomLink{Rel: "alternate", Type: "text/html", Href: postURL},
+		Summary:   post.Description.String,
+		Content:   atomContent{Type: "html", Body: h.archiveService.UseArchives(r.Context(), post.Content)},
+	}
+}
+
+// requestOrigin returns the scheme and host the request was sent to
+// Behind a reverse proxy terminating TLS, the scheme is taken from X-Forwarded-Proto
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// atomTime formats a timestamp in milliseconds as an RFC 3339 date
+func atomTime(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+}
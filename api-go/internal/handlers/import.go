@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+
+	e "github.com/cymoo/mote/internal/errors"
+	"github.com/cymoo/mote/internal/importer"
+	"github.com/cymoo/mote/pkg/util/safego"
+)
+
+type ImportHandler struct {
+	importer *importer.Importer
+
+	mu      sync.Mutex
+	running bool
+	latest  *importer.Progress
+}
+
+func NewImportHandler(importer *importer.Importer) *ImportHandler {
+	return &ImportHandler{importer: importer}
+}
+
+// ImportNotes starts importing an export uploaded as a zip archive in the "file" field
+// The "format" field names the app the export comes from, and "dry_run" only checks it.
+// The import runs in the background, its progress is reported by GetImport.
+// Returns a BadRequest error if the format is unknown or another import is running.
+func (h *ImportHandler) ImportNotes(r *http.Request) (*importer.Progress, error) {
+	format := r.FormValue("format")
+	if !slices.Contains(importer.Formats(), format) {
+		return nil, e.BadRequest("unknown import format: " + format)
+	}
+	dryRun, _ := strconv.ParseBool(r.FormValue("dry_run"))
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, e.BadRequest("an export archive is required")
+	}
+	defer file.Close()
+
+	// The upload is only valid during the request, keep a copy for the background import
+	archive, err := os.CreateTemp("", "import-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(archive, file); err != nil {
+		archive.Close()
+		os.Remove(archive.Name())
+		return nil, err
+	}
+	archive.Close()
+
+	fsys, closeSource, err := importer.OpenSource(archive.Name())
+	if err != nil {
+		os.Remove(archive.Name())
+		return nil, e.BadRequest("the export must be a zip archive")
+	}
+
+	h.mu.Lock()
+	if h.running {
+		h.mu.Unlock()
+		closeSource()
+		os.Remove(archive.Name())
+		return nil, e.BadRequest("an import is already running")
+	}
+	h.running = true
+	h.latest = &importer.Progress{Format: format, DryRun: dryRun, Errors: []string{}}
+	progress := *h.latest
+	h.mu.Unlock()
+
+	safego.Go("import-notes", func() {
+		defer os.Remove(archive.Name())
+		defer closeSource()
+
+		// Another import can start even if this one panics
+		rv := &importer.Progress{Format: format, DryRun: dryRun, Errors: []string{"import aborted"}, Finished: true}
+		defer func() {
+			h.mu.Lock()
+			h.running = false
+			h.latest = rv
+			h.mu.Unlock()
+		}()
+
+		result, err := h.importer.Run(context.Background(), format, fsys, importer.Options{
+			DryRun:     dryRun,
+			OnProgress: h.setProgress,
+		})
+		if err != nil {
+			log.Printf("error importing %s export: %v", format, err)
+			result = &importer.Progress{Format: format, DryRun: dryRun, Errors: []string{err.Error()}, Finished: true}
+		}
+		rv = result
+	})
+
+	return &progress, nil
+}
+
+// GetImport returns the progress of the running or latest import
+// Returns a NotFound error if nothing has been imported since the server started.
+func (h *ImportHandler) GetImport() (*importer.Progress, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.latest == nil {
+		return nil, e.NotFound("no import has been run")
+	}
+	progress := *h.latest
+	return &progress, nil
+}
+
+func (h *ImportHandler) setProgress(progress importer.Progress) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.latest = &progress
+}
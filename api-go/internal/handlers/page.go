@@ -8,23 +8,19 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
-	"regexp"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+	"github.com/cymoo/mote/pkg/fulltext"
 	"github.com/cymoo/mote/pkg/util/env"
 	"github.com/go-chi/chi/v5"
 	"github.com/jmoiron/sqlx"
 )
 
-var (
-	// regex patterns to extract header and bold paragraph
-	headerAndBoldParagraphPattern = regexp.MustCompile(`<h[1-3][^>]*>(.*?)</h[1-3]>\s*(?:<p[^>]*><strong>(.*?)</strong></p>)?`)
-	// regex pattern to remove strong tags
-	strongTagPattern = regexp.MustCompile(`</?strong>`)
-)
-
 // PostMetaData represents post metadata for list view
 type PostMetaData struct {
 	ID          int64  `json:"id"`
@@ -33,13 +29,29 @@ type PostMetaData struct {
 	CreatedAt   string `json:"created_at"`
 }
 
+// PostPageHandler renders the pages and feeds of the posts visible to the public, the shared ones under /shared, see
+// Explore for the whole vault
 type PostPageHandler struct {
-	db        *sqlx.DB
-	templates map[string]*template.Template
+	posts          *services.PublicPostService
+	archiveService *services.ArchiveService
+	viewService    *services.ViewService
+	templates      map[string]*template.Template
+	perPage        int
+	// basePath is the path the pages are served under
+	basePath string
+	// fts searches the posts, nil if the pages have no search
+	fts *fulltext.FullTextSearch
 }
 
-// NewPostPageHandler creates a new PostHandler
-func NewPostPageHandler(db *sqlx.DB, templateFS fs.FS) (*PostPageHandler, error) {
+// NewPostPageHandler creates a new PostHandler serving the shared posts under /shared
+// perPage is the number of posts on a page
+func NewPostPageHandler(
+	db *sqlx.DB,
+	archiveService *services.ArchiveService,
+	viewService *services.ViewService,
+	templateFS fs.FS,
+	perPage int,
+) (*PostPageHandler, error) {
 	templates := make(map[string]*template.Template)
 
 	// safe function to prevent HTML escaping
@@ -47,12 +59,14 @@ func NewPostPageHandler(db *sqlx.DB, templateFS fs.FS) (*PostPageHandler, error)
 		"safe": func(s string) template.HTML {
 			return template.HTML(s)
 		},
+		"tagPath": escapeTagPath,
 	}
 
 	// Define pages and their associated template files
 	pages := map[string][]string{
 		"post-list": {"templates/layout.tpl", "templates/post-list.tpl"},
 		"post-item": {"templates/layout.tpl", "templates/post-item.tpl"},
+		"tag-list":  {"templates/layout.tpl", "templates/tag-list.tpl"},
 		"error":     {"templates/error.tpl"},
 	}
 
@@ -66,46 +80,161 @@ func NewPostPageHandler(db *sqlx.DB, templateFS fs.FS) (*PostPageHandler, error)
 	}
 
 	return &PostPageHandler{
-		db:        db,
-		templates: templates,
+		posts:          services.NewPublicPostService(db, services.VisibilityShared),
+		archiveService: archiveService,
+		viewService:    viewService,
+		templates:      templates,
+		perPage:        perPage,
+		basePath:       "/shared",
 	}, nil
 }
 
-// PostList handles the post list page
+// Explore returns a PostPageHandler sharing the templates and services, serving every live post read-only under
+// /public with search, see Config.PublicExplore
+// The posts are read by a PublicPostService of VisibilityAll, the drafts, the deleted posts and everything but the
+// posts stay private.
+func (h *PostPageHandler) Explore(db *sqlx.DB, fts *fulltext.FullTextSearch) *PostPageHandler {
+	explore := *h
+	explore.posts = services.NewPublicPostService(db, services.VisibilityAll)
+	explore.basePath = "/public"
+	explore.fts = fts
+	return &explore
+}
+
+// pageData returns the data shared by the pages
+func (h *PostPageHandler) pageData() map[string]any {
+	data := map[string]any{
+		"about_url": env.GetString("ABOUT_URL", ""),
+		"base_path": h.basePath,
+	}
+	if h.fts != nil {
+		data["search_url"] = h.basePath + "/search"
+	}
+	return data
+}
+
+// PostList handles the page of the latest posts, the page number is the "page" query parameter
 func (h *PostPageHandler) PostList(w http.ResponseWriter, r *http.Request) {
-	var posts []models.Post
-	query := `
-		SELECT * FROM posts
-		WHERE shared = 1 AND deleted_at IS NULL
-		ORDER BY created_at DESC
-	`
-
-	// Fetch posts from the database
-	err := h.db.Select(&posts, query)
+	page, ok := pageParam(r)
+	if !ok {
+		h.render404(w)
+		return
+	}
+
+	// One more post is fetched to know if there is a next page
+	posts, err := h.posts.GetPosts(r.Context(), h.perPage+1, (page-1)*h.perPage)
 	if err != nil {
 		h.render500(w, err)
 		return
 	}
 
-	// Extract metadata for each post
-	result := make([]PostMetaData, 0, len(posts))
-	for _, post := range posts {
-		title, description := extractHeaderAndDescriptionFromHTML(post.Content)
-		result = append(result, PostMetaData{
-			ID:          post.ID,
-			Title:       title,
-			Description: description,
-			CreatedAt:   timestampToLocalDate(post.CreatedAt / 1000),
-		})
+	data := h.pageData()
+	data["feed_url"] = h.basePath + "/feed.atom"
+	h.renderList(w, data, posts, page, h.basePath+"/?")
+}
+
+// TagPostList handles the page of the shared posts under a tag, including its subtags
+// The tag is the rest of the path, e.g. /tags/tech/golang, and the page number is the "page" query parameter
+// A path ending with .atom serves the Atom feed of the latest posts instead
+func (h *PostPageHandler) TagPostList(w http.ResponseWriter, r *http.Request) {
+	name, ok := tagFromPath(r)
+	if !ok {
+		h.render404(w)
+		return
+	}
+	if feedName, isFeed := strings.CutSuffix(name, ".atom"); isFeed {
+		h.tagFeed(w, r, feedName)
+		return
 	}
 
-	aboutURL := env.GetString("ABOUT_URL", "")
+	page, ok := pageParam(r)
+	if !ok {
+		h.render404(w)
+		return
+	}
 
-	data := map[string]any{
-		"about_url": aboutURL,
-		"posts":     result,
+	// One more post is fetched to know if there is a next page
+	posts, err := h.posts.GetTagPosts(r.Context(), name, h.perPage+1, (page-1)*h.perPage)
+	if err != nil {
+		h.render500(w, err)
+		return
+	}
+	// A tag without visible posts is not disclosed
+	if len(posts) == 0 {
+		h.render404(w)
+		return
+	}
+
+	tagURL := h.basePath + "/tags/" + escapeTagPath(name)
+	data := h.pageData()
+	data["tag"] = name
+	data["feed_url"] = tagURL + ".atom"
+	h.renderList(w, data, posts, page, tagURL+"?")
+}
+
+// TagList handles the page of the tags with visible posts
+func (h *PostPageHandler) TagList(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.posts.GetTags(r.Context())
+	if err != nil {
+		h.render500(w, err)
+		return
+	}
+
+	data := h.pageData()
+	data["tags"] = tags
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates["tag-list"].ExecuteTemplate(w, "layout", data); err != nil {
+		h.render500(w, err)
+	}
+}
+
+// Search handles the page of the posts matching the "q" query parameter, best match first
+// The page number is the "page" query parameter. Pages without search serve 404.
+func (h *PostPageHandler) Search(w http.ResponseWriter, r *http.Request) {
+	page, ok := pageParam(r)
+	if h.fts == nil || !ok {
+		h.render404(w)
+		return
+	}
+
+	data := h.pageData()
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	data["query"] = query
+	if query == "" {
+		h.renderList(w, data, nil, page, "")
+		return
 	}
 
+	_, results, err := h.fts.Search(r.Context(), query, false, 0)
+	if err != nil {
+		h.render500(w, err)
+		return
+	}
+	ids := make([]int64, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	// One more post is fetched to know if there is a next page
+	posts, _, err := h.posts.GetPage(r.Context(), ids, h.perPage+1, (page-1)*h.perPage)
+	if err != nil {
+		h.render500(w, err)
+		return
+	}
+	h.renderList(w, data, posts, page, h.basePath+"/search?"+url.Values{"q": {query}}.Encode()+"&")
+}
+
+// renderList renders a page of posts, fetched with one more post than a page
+// pageURL is the URL of the list ending with "?" or "&", to which the page number is appended
+func (h *PostPageHandler) renderList(w http.ResponseWriter, data map[string]any, posts []models.Post, page int, pageURL string) {
+	if len(posts) > h.perPage {
+		posts = posts[:h.perPage]
+		data["next_url"] = fmt.Sprintf("%spage=%d", pageURL, page+1)
+	}
+	if page > 1 {
+		data["prev_url"] = fmt.Sprintf("%spage=%d", pageURL, page-1)
+	}
+	data["posts"] = postMetaData(posts)
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := h.templates["post-list"].ExecuteTemplate(w, "layout", data); err != nil {
 		h.render500(w, err)
@@ -122,13 +251,7 @@ func (h *PostPageHandler) PostItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var post models.Post
-	query := `
-		SELECT * FROM posts
-		WHERE id = ? AND deleted_at IS NULL AND shared = 1
-	`
-	// Fetch the post from the database
-	err = h.db.Get(&post, query, id)
+	post, err := h.posts.GetPost(r.Context(), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			h.render404(w)
@@ -138,9 +261,6 @@ func (h *PostPageHandler) PostItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract title from post content
-	title, _ := extractHeaderAndDescriptionFromHTML(post.Content)
-
 	var images []models.FileInfo
 	if post.Files.Valid && len(post.Files.RawMessage) > 0 {
 		if err := json.Unmarshal(post.Files.RawMessage, &images); err != nil {
@@ -148,19 +268,22 @@ func (h *PostPageHandler) PostItem(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	aboutURL := env.GetString("ABOUT_URL", "")
+	if err := h.viewService.RecordView(r.Context(), id, false, time.Now()); err != nil {
+		log.Printf("error recording a view of public post %d: %v", id, err)
+	}
+
+	// Links that died since the post was shared point to their snapshot
+	post.Content = h.archiveService.UseArchives(r.Context(), post.Content)
 
-	titleStr := title
+	titleStr := post.Title.String
 	if titleStr == "" {
 		titleStr = "mote"
 	}
 
-	data := map[string]any{
-		"about_url": aboutURL,
-		"post":      post,
-		"title":     titleStr,
-		"images":    images,
-	}
+	data := h.pageData()
+	data["post"] = post
+	data["title"] = titleStr
+	data["images"] = images
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := h.templates["post-item"].ExecuteTemplate(w, "layout", data); err != nil {
@@ -197,21 +320,52 @@ func (h *PostPageHandler) render500(w http.ResponseWriter, err error) {
 	}
 }
 
-// extractHeaderAndDescriptionFromHTML extracts title and description from HTML
-func extractHeaderAndDescriptionFromHTML(html string) (string, string) {
-	matches := headerAndBoldParagraphPattern.FindStringSubmatch(html)
-	if len(matches) < 2 {
-		return "", ""
+// postMetaData extracts the metadata of posts for list views
+func postMetaData(posts []models.Post) []PostMetaData {
+	result := make([]PostMetaData, 0, len(posts))
+	for _, post := range posts {
+		result = append(result, PostMetaData{
+			ID:          post.ID,
+			Title:       post.Title.String,
+			Description: post.Description.String,
+			CreatedAt:   timestampToLocalDate(post.CreatedAt / 1000),
+		})
 	}
+	return result
+}
 
-	title := matches[1]
-	var description string
+// pageParam returns the page number of the "page" query parameter, 1 if not set, and whether it is valid
+func pageParam(r *http.Request) (int, bool) {
+	pageStr := r.URL.Query().Get("page")
+	if pageStr == "" {
+		return 1, true
+	}
+	page, err := strconv.Atoi(pageStr)
+	return page, err == nil && page >= 1
+}
 
-	if len(matches) > 2 && matches[2] != "" {
-		description = strongTagPattern.ReplaceAllString(matches[2], "")
+// tagFromPath returns the tag name captured by the wildcard of the route
+// chi matches the escaped path when it differs from the decoded one, so it is decoded here
+func tagFromPath(r *http.Request) (string, bool) {
+	name := chi.URLParam(r, "*")
+	if r.URL.RawPath != "" {
+		decoded, err := url.PathUnescape(name)
+		if err != nil {
+			return "", false
+		}
+		name = decoded
 	}
+	name = strings.Trim(name, "/")
+	return name, name != ""
+}
 
-	return title, description
+// escapeTagPath escapes each level of a tag name for use in a URL path
+func escapeTagPath(name string) string {
+	levels := strings.Split(name, "/")
+	for i, level := range levels {
+		levels[i] = url.PathEscape(level)
+	}
+	return strings.Join(levels, "/")
 }
 
 // timestampToLocalDate converts Unix timestamp to local date string
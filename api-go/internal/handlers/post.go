@@ -2,31 +2,77 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	m "github.com/cymoo/mint"
+	"github.com/cymoo/mote/internal/config"
 	e "github.com/cymoo/mote/internal/errors"
 	"github.com/cymoo/mote/internal/models"
 	"github.com/cymoo/mote/internal/services"
+	"github.com/go-chi/chi/v5"
 
 	"github.com/cymoo/mote/pkg/fulltext"
+	"github.com/cymoo/mote/pkg/util/cache"
+	"github.com/cymoo/mote/pkg/util/safego"
+)
+
+const (
+	// quickSearchLimit is the maximum number of quick search results
+	quickSearchLimit = 10
+	// quickSearchTitleLength is the maximum length in runes of a title snippet
+	quickSearchTitleLength = 60
+	// maxCaptionLength is the maximum length in runes of a file caption
+	maxCaptionLength = 500
 )
 
 type PostHandler struct {
-	postService *services.PostService
-	tagService  *services.TagService
-	fts         *fulltext.FullTextSearch
+	postService      *services.PostService
+	tagService       *services.TagService
+	uploadService    *services.UploadService
+	fts              fulltext.Index
+	config           *config.PostConfig
+	aliasScanner     *services.TagAliasScanner
+	archiveService   *services.ArchiveService
+	tagSuggester     *services.TagSuggester
+	quickSearchCache *cache.TTLCache[string, []models.PostSummary]
+	statsCache       *services.StatsCache
+	viewService      *services.ViewService
 }
 
-func NewPostHandler(postService *services.PostService, tagService *services.TagService, fts *fulltext.FullTextSearch) *PostHandler {
-	return &PostHandler{postService: postService, tagService: tagService, fts: fts}
+func NewPostHandler(
+	postService *services.PostService,
+	tagService *services.TagService,
+	uploadService *services.UploadService,
+	fts fulltext.Index,
+	config *config.PostConfig,
+	aliasScanner *services.TagAliasScanner,
+	archiveService *services.ArchiveService,
+	statsCache *services.StatsCache,
+	viewService *services.ViewService,
+) *PostHandler {
+	return &PostHandler{
+		postService:      postService,
+		tagService:       tagService,
+		uploadService:    uploadService,
+		fts:              fts,
+		config:           config,
+		aliasScanner:     aliasScanner,
+		archiveService:   archiveService,
+		tagSuggester:     services.NewTagSuggester(tagService, fts.Tokenizer()),
+		quickSearchCache: cache.New[string, []models.PostSummary](30*time.Second, 256),
+		statsCache:       statsCache,
+		viewService:      viewService,
+	}
 }
 
 func (h *PostHandler) HelloWorld() string {
@@ -38,11 +84,33 @@ func (h *PostHandler) HelloWorld() string {
 // Returns a PostPagination containing the matched posts.
 // If no posts match, returns an empty PostPagination.
 // The search supports partial matching and limits the number of results.
+// With group_threads, the posts of a thread are collapsed into the best-scoring one, see services.GroupByThread.
+// Operators in the query, e.g. tag:tech or before:2024-01-01, filter the posts, see services.ParseSearchQuery. A query
+// of operators only returns the latest posts matching them, without scores.
 func (h *PostHandler) SearchPosts(r *http.Request, query m.Query[models.SearchRequest]) (*models.PostPagination, error) {
 	ctx := r.Context()
 
-	// Perform the search using full-text search service
-	tokens, results, err := h.fts.Search(ctx, query.Value.Query, query.Value.Partial, query.Value.Limit)
+	loc := time.FixedZone("", query.Value.Offset*60)
+	if tz := query.Value.Timezone; tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, e.BadRequest(fmt.Sprintf("invalid timezone '%s'", tz))
+		}
+	}
+	text, filter, err := services.ParseSearchQuery(query.Value.Query, loc)
+	if err != nil {
+		return nil, e.BadRequest(err.Error())
+	}
+	if filter != nil && text == "" {
+		return h.filterPosts(ctx, *filter, query.Value.Limit)
+	}
+
+	// Perform the search using full-text search service, all the results are filtered before the limit applies
+	limit := query.Value.Limit
+	if filter != nil {
+		limit = 0
+	}
+	tokens, results, err := h.fts.Search(ctx, text, query.Value.Partial, limit)
 	if err != nil {
 		log.Printf("error searching posts with query %q: %v", query.Value.Query, err)
 		return nil, e.InternalError()
@@ -65,6 +133,17 @@ func (h *PostHandler) SearchPosts(r *http.Request, query m.Query[models.SearchRe
 		idToScore[result.ID] = result.Score
 		ids = append(ids, result.ID)
 	}
+	if filter != nil {
+		matched, err := h.postService.FilterIDs(ctx, ids, *filter)
+		if err != nil {
+			log.Printf("error filtering posts with ids %v: %v", ids, err)
+			return nil, e.InternalError()
+		}
+		ids = matched
+		if query.Value.Limit > 0 && len(ids) > query.Value.Limit {
+			ids = ids[:query.Value.Limit]
+		}
+	}
 
 	// Get posts by IDs
 	posts, err := h.postService.FindByIDs(ctx, ids)
@@ -99,6 +178,9 @@ func (h *PostHandler) SearchPosts(r *http.Request, query m.Query[models.SearchRe
 		}
 		return scoreI > scoreJ
 	})
+	if query.Value.GroupThreads {
+		posts = services.GroupByThread(posts)
+	}
 
 	size := int64(len(posts))
 
@@ -109,27 +191,134 @@ func (h *PostHandler) SearchPosts(r *http.Request, query m.Query[models.SearchRe
 	}, nil
 }
 
+// filterPosts returns the latest posts matching the operators of a search query without text
+func (h *PostHandler) filterPosts(ctx context.Context, filter models.FilterPostRequest, limit int) (*models.PostPagination, error) {
+	var requested *int
+	if limit > 0 {
+		requested = &limit
+	}
+	pageSize, err := postPageSize(requested, h.config)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := h.postService.Filter(ctx, filter, pageSize)
+	if err != nil {
+		log.Printf("error filtering posts: %v", err)
+		return nil, e.InternalError()
+	}
+	return &models.PostPagination{Posts: posts, Cursor: -1, Size: int64(len(posts))}, nil
+}
+
+// QuickSearch handles search-as-you-type requests
+// It returns at most 10 lightweight summaries (ID, title snippet and tags) ordered by relevance,
+// without parents or full content. Results are cached briefly per query.
+func (h *PostHandler) QuickSearch(r *http.Request, query m.Query[models.QuickSearchRequest]) ([]models.PostSummary, error) {
+	q := strings.ToLower(strings.TrimSpace(query.Value.Query))
+	if q == "" {
+		return []models.PostSummary{}, nil
+	}
+
+	if summaries, ok := h.quickSearchCache.Get(q); ok {
+		return summaries, nil
+	}
+
+	ctx := r.Context()
+
+	_, results, err := h.fts.Search(ctx, q, true, quickSearchLimit)
+	if err != nil {
+		log.Printf("error quick searching posts with query %q: %v", q, err)
+		return nil, e.InternalError()
+	}
+
+	ids := make([]int64, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+
+	posts, err := h.postService.FindBriefsByIDs(ctx, ids)
+	if err != nil {
+		log.Printf("error finding posts with ids %v: %v", ids, err)
+		return nil, err
+	}
+
+	postMap := make(map[int64]*models.Post, len(posts))
+	for i := range posts {
+		postMap[posts[i].ID] = &posts[i]
+	}
+
+	// Keep the relevance order of the search results
+	summaries := make([]models.PostSummary, 0, len(posts))
+	for _, id := range ids {
+		if post, ok := postMap[id]; ok {
+			summaries = append(summaries, models.PostSummary{
+				ID:    post.ID,
+				Title: services.SummarizeContent(post.Content, quickSearchTitleLength),
+				Tags:  post.Tags,
+			})
+		}
+	}
+
+	h.quickSearchCache.Set(q, summaries)
+	return summaries, nil
+}
+
 // GetPosts retrieves posts with filtering and pagination
 // It returns a PostPagination containing the posts and pagination info.
 func (h *PostHandler) GetPosts(r *http.Request, query m.Query[models.FilterPostRequest]) (*models.PostPagination, error) {
-	posts, err := h.postService.Filter(r.Context(), query.Value, 10)
+	pageSize, err := postPageSize(query.Value.Limit, h.config)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := h.postService.Filter(r.Context(), query.Value, pageSize)
+	if errors.Is(err, services.ErrInvalidFilter) {
+		return nil, e.BadRequest(err.Error())
+	}
 	if err != nil {
 		log.Printf("error getting posts: %v", err)
 		return nil, e.InternalError()
 	}
 
-	// Determine the new cursor based on the last post's CreatedAt
+	return paginate(posts, query.Value.OrderBy, pageSize), nil
+}
+
+// postPageSize returns the number of posts on a page, the requested limit capped by the maximum or the default
+func postPageSize(limit *int, config *config.PostConfig) (int, error) {
+	if limit == nil {
+		return config.PerPage, nil
+	}
+	if *limit <= 0 {
+		return 0, e.BadRequest("limit must be greater than 0")
+	}
+	return min(*limit, config.MaxPerPage), nil
+}
+
+// paginate returns a page of posts with the cursor of the next page, based on the order column of the last post
+func paginate(posts []models.Post, orderBy string, pageSize int) *models.PostPagination {
 	size := len(posts)
-	cursor := int64(-1)
+	cursor, cursorID := int64(-1), int64(-1)
 	if size > 0 {
-		cursor = posts[size-1].CreatedAt
+		last := posts[size-1]
+		cursorID = last.ID
+		switch orderBy {
+		case "updated_at":
+			cursor = last.UpdatedAt
+		case "deleted_at":
+			cursor = last.DeletedAt.Int64
+		case "children_count":
+			cursor = last.ChildrenCount
+		default:
+			cursor = last.CreatedAt
+		}
 	}
 
 	return &models.PostPagination{
-		Posts:  posts,
-		Cursor: cursor,
-		Size:   int64(size),
-	}, nil
+		Posts:    posts,
+		Cursor:   cursor,
+		CursorID: cursorID,
+		Size:     int64(size),
+		PageSize: pageSize,
+	}
 }
 
 // GetPost retrieves a single post by ID
@@ -145,25 +334,115 @@ func (h *PostHandler) GetPost(r *http.Request, query m.Query[models.ID]) (*model
 	if post == nil {
 		return nil, e.NotFound("post not found")
 	}
+	if err := h.viewService.RecordView(r.Context(), id, true, time.Now()); err != nil {
+		log.Printf("error recording a view of post %d: %v", id, err)
+	}
 	return post, nil
 }
 
+// GetRecentlyViewed retrieves the posts viewed last, latest first
+func (h *PostHandler) GetRecentlyViewed(r *http.Request, query m.Query[models.ViewedPostsRequest]) ([]models.Post, error) {
+	limit, err := postPageSize(query.Value.Limit, h.config)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := h.viewService.RecentlyViewed(r.Context(), limit)
+	if err != nil {
+		log.Printf("error getting the recently viewed posts: %v", err)
+		return nil, e.InternalError()
+	}
+	return h.viewedPosts(r.Context(), ids)
+}
+
+// GetMostViewed retrieves the posts viewed the most in the last 30 days, the recent views counting more
+func (h *PostHandler) GetMostViewed(r *http.Request, query m.Query[models.ViewedPostsRequest]) ([]models.Post, error) {
+	limit, err := postPageSize(query.Value.Limit, h.config)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := h.viewService.MostViewed(r.Context(), limit, time.Now())
+	if err != nil {
+		log.Printf("error getting the most viewed posts: %v", err)
+		return nil, e.InternalError()
+	}
+	return h.viewedPosts(r.Context(), ids)
+}
+
+// viewedPosts returns the posts with the given IDs in their order, the deleted ones left out
+func (h *PostHandler) viewedPosts(ctx context.Context, ids []int64) ([]models.Post, error) {
+	posts, err := h.postService.FindByIDs(ctx, ids)
+	if err != nil {
+		log.Printf("error finding posts with ids %v: %v", ids, err)
+		return nil, e.InternalError()
+	}
+	order := make(map[int64]int, len(ids))
+	for i, id := range ids {
+		order[id] = i
+	}
+	sort.Slice(posts, func(i, j int) bool { return order[posts[i].ID] < order[posts[j].ID] })
+	return posts, nil
+}
+
+// UpdateFiles reorders the files of a post and sets their captions without resubmitting its content
+func (h *PostHandler) UpdateFiles(r *http.Request, body m.JSON[models.UpdateFilesRequest]) ([]models.FileInfo, error) {
+	for _, caption := range body.Value.Captions {
+		if utf8.RuneCountInString(caption) > maxCaptionLength {
+			return nil, e.BadRequest(fmt.Sprintf("caption cannot exceed %d characters", maxCaptionLength))
+		}
+	}
+
+	files, err := h.postService.UpdateFiles(r.Context(), body.Value)
+	switch {
+	case errors.Is(err, services.ErrPostNotFound):
+		return nil, e.NotFound("post not found")
+	case errors.Is(err, services.ErrInvalidFiles):
+		return nil, e.BadRequest(err.Error())
+	case err != nil:
+		log.Printf("error updating files of post %d: %v", body.Value.ID, err)
+		return nil, e.InternalError()
+	}
+	return files, nil
+}
+
+// GetThread retrieves the thread of a post, from the post at its top, in one query
+func (h *PostHandler) GetThread(r *http.Request) (*models.Thread, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return nil, e.BadRequest("invalid post id")
+	}
+
+	thread, err := h.postService.GetThread(r.Context(), id)
+	if errors.Is(err, services.ErrPostNotFound) {
+		return nil, e.NotFound("post not found")
+	}
+	if err != nil {
+		log.Printf("error getting thread of post %d: %v", id, err)
+		return nil, e.InternalError()
+	}
+	return thread, nil
+}
+
 // GetStats retrieves statistics about posts and tags
-// It returns a PostStats containing counts of posts, tags, and active days.
-func (h *PostHandler) GetStats(r *http.Request) (*models.PostStats, error) {
-	postCount, err := h.postService.GetCount(r.Context())
+// It returns a PostStats containing counts of posts, tags, and active days, cached until posts or tags change
+// unless refresh is set.
+func (h *PostHandler) GetStats(r *http.Request, query m.Query[models.StatsRequest]) (*models.PostStats, error) {
+	return services.CachedStats(r.Context(), h.statsCache, "stats", query.Value.Refresh, h.computeStats)
+}
+
+func (h *PostHandler) computeStats(ctx context.Context) (*models.PostStats, error) {
+	postCount, err := h.postService.GetCount(ctx)
 	if err != nil {
 		log.Printf("error getting post count: %v", err)
 		return nil, err
 	}
 
-	tagCount, err := h.tagService.GetCount(r.Context())
+	tagCount, err := h.tagService.GetCount(ctx)
 	if err != nil {
 		log.Printf("error getting tag count: %v", err)
 		return nil, err
 	}
 
-	dayCount, err := h.postService.GetActiveDays(r.Context())
+	dayCount, err := h.postService.GetActiveDays(ctx)
 	if err != nil {
 		log.Printf("error getting active days: %v", err)
 		return nil, err
@@ -176,18 +455,38 @@ func (h *PostHandler) GetStats(r *http.Request) (*models.PostStats, error) {
 	}, nil
 }
 
+// GetGroupedCounts retrieves post counts grouped by month, color and top-level tag
+// The offset query parameter (in minutes) determines the timezone used for months.
+func (h *PostHandler) GetGroupedCounts(r *http.Request, query m.Query[models.TimezoneOffset]) (*models.GroupedPostCounts, error) {
+	counts, err := h.postService.GetGroupedCounts(r.Context(), query.Value.Offset*60)
+	if err != nil {
+		log.Printf("error getting grouped post counts: %v", err)
+		return nil, err
+	}
+	return counts, nil
+}
+
 // GetDailyCounts retrieves daily post counts within a date range
-// It returns a slice of counts corresponding to each day in the range.
-// If the date range is invalid, it returns a BadRequest error.
+// It returns a slice of counts corresponding to each day in the range, a calendar day of the IANA timezone
+// given by tz, or of the fixed offset (in minutes) if tz is empty.
+// If the date range or the timezone is invalid, it returns a BadRequest error.
 func (h *PostHandler) GetDailyCounts(r *http.Request, query m.Query[models.DateRange]) ([]int64, error) {
+	loc := time.FixedZone("", query.Value.Offset*60)
+	if tz := query.Value.Timezone; tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, e.BadRequest(fmt.Sprintf("invalid timezone '%s'", tz))
+		}
+	}
+
 	startDateStr := query.Value.StartDate
 	endDateStr := query.Value.EndDate
-	startDate, err := time.Parse(time.DateOnly, startDateStr)
+	startDate, err := time.ParseInLocation(time.DateOnly, startDateStr, loc)
 	if err != nil {
 		return nil, e.BadRequest(fmt.Sprintf("invalid date '%s': must be in YYYY-MM-DD format", startDateStr))
 	}
 
-	endDate, err := time.Parse(time.DateOnly, endDateStr)
+	endDate, err := time.ParseInLocation(time.DateOnly, endDateStr, loc)
 	if err != nil {
 		return nil, e.BadRequest(fmt.Sprintf("invalid date '%s': must be in YYYY-MM-DD format", endDateStr))
 	}
@@ -199,7 +498,7 @@ func (h *PostHandler) GetDailyCounts(r *http.Request, query m.Query[models.DateR
 		return nil, e.BadRequest("end_date must be after start_date")
 	}
 
-	counts, err := h.postService.GetDailyCounts(r.Context(), startDate, endDate, query.Value.Offset*60)
+	counts, err := h.postService.GetDailyCounts(r.Context(), startDate, endDate)
 	if err != nil {
 		log.Printf("error getting daily post counts: %v", err)
 		return nil, err
@@ -207,69 +506,163 @@ func (h *PostHandler) GetDailyCounts(r *http.Request, query m.Query[models.DateR
 	return counts, nil
 }
 
+// GetPalette retrieves the configured color palette
+// It returns each color with the count of non-deleted posts marked with it.
+func (h *PostHandler) GetPalette(r *http.Request) ([]models.PaletteColorWithPostCount, error) {
+	counts, err := h.postService.GetColorCounts(r.Context())
+	if err != nil {
+		log.Printf("error getting color counts: %v", err)
+		return nil, err
+	}
+
+	colors := make([]models.PaletteColorWithPostCount, 0, len(h.config.Palette))
+	for _, color := range h.config.Palette {
+		colors = append(colors, models.PaletteColorWithPostCount{
+			Name:      color.Name,
+			Hex:       color.Hex,
+			PostCount: counts[color.Name],
+		})
+	}
+	return colors, nil
+}
+
 // CreatePost creates a new post
 // It returns the created post's ID.
-// After creation, it indexes the post content in the background.
-func (h *PostHandler) CreatePost(r *http.Request, body m.JSON[models.CreatePostRequest]) (*models.CreateResponse, error) {
+// If the color is not in the palette, it returns a BadRequest error.
+// If DetectTags is true, tags whose aliases appear in the content are appended as hash tags.
+// If the content exceeds the maximum size, it returns a ContentTooLarge error.
+// After creation, it indexes the post content in the background;
+// content above the index size is indexed from a truncated version and flagged with
+// the X-Index-Truncated response header.
+func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request, body m.JSON[models.CreatePostRequest]) (*models.CreateResponse, error) {
+	if err := h.validateSize(body.Value.Content); err != nil {
+		return nil, err
+	}
+
+	if body.Value.Color != nil {
+		if err := h.validateColor(*body.Value.Color); err != nil {
+			return nil, err
+		}
+	}
+
+	var detectedTags []string
+	if body.Value.DetectTags {
+		body.Value.Content, detectedTags = h.aliasScanner.Apply(body.Value.Content)
+	}
+
 	rv, err := h.postService.Create(r.Context(), body.Value)
 	if err != nil {
 		log.Printf("error creating post: %v", err)
 		return nil, err
 	}
+	rv.DetectedTags = detectedTags
 
-	go func() {
-		ctx := context.Background()
-		if err := h.fts.Index(ctx, rv.ID, body.Value.Content); err != nil {
-			log.Printf("error indexing post %d: %v", rv.ID, err)
+	indexContent, truncated := services.TruncateContent(body.Value.Content, h.config.IndexSize)
+	if truncated {
+		w.Header().Set("X-Index-Truncated", "true")
+	}
+
+	services.AfterCommit(r.Context(), func() {
+		safego.Go("index-post", func() {
+			ctx := context.Background()
+			if err := h.fts.Index(ctx, rv.ID, indexContent); err != nil {
+				log.Printf("error indexing post %d: %v", rv.ID, err)
+			}
+		})
+
+		if h.archiveService.Enabled() {
+			safego.Go("archive-links", func() {
+				h.archiveService.ArchiveLinks(context.Background(), body.Value.Content)
+			})
 		}
-	}()
+	})
 
 	return rv, nil
 }
 
 // UpdatePost updates an existing post
 // It returns a 204 No Content status on success.
-// If the post content is updated, it reindexes the content in the background.
-func (h *PostHandler) UpdatePost(r *http.Request, body m.JSON[models.UpdatePostRequest]) (m.StatusCode, error) {
+// If the color is not in the palette, it returns a BadRequest error.
+// If DetectTags is true, tags whose aliases appear in the new content are appended as hash tags.
+// If the content exceeds the maximum size, it returns a ContentTooLarge error.
+// If the post content is updated, it reindexes the content in the background;
+// content above the index size is indexed from a truncated version and flagged with
+// the X-Index-Truncated response header.
+func (h *PostHandler) UpdatePost(w http.ResponseWriter, r *http.Request, body m.JSON[models.UpdatePostRequest]) (m.StatusCode, error) {
 	id := body.Value.ID
+
+	if body.Value.Content != nil {
+		if err := h.validateSize(*body.Value.Content); err != nil {
+			return 0, err
+		}
+	}
+
+	if color, ok := body.Value.Color.Get(); ok {
+		if err := h.validateColor(color); err != nil {
+			return 0, err
+		}
+	}
+
+	if body.Value.DetectTags && body.Value.Content != nil {
+		content, _ := h.aliasScanner.Apply(*body.Value.Content)
+		body.Value.Content = &content
+	}
+
 	err := h.postService.Update(r.Context(), body.Value)
+	if errors.Is(err, services.ErrParentCycle) {
+		return 0, e.BadRequest(err.Error())
+	}
 	if err != nil {
 		log.Printf("error updating post %d: %v", id, err)
 		return 0, err
 	}
 
 	if body.Value.Content != nil {
-		go func() {
-			ctx := context.Background()
-			if err := h.fts.Reindex(ctx, id, *body.Value.Content); err != nil {
-				log.Printf("error reindexing post %d: %v", id, err)
-			}
-		}()
+		indexContent, truncated := services.TruncateContent(*body.Value.Content, h.config.IndexSize)
+		if truncated {
+			w.Header().Set("X-Index-Truncated", "true")
+		}
+
+		services.AfterCommit(r.Context(), func() {
+			safego.Go("reindex-post", func() {
+				ctx := context.Background()
+				if err := h.fts.Reindex(ctx, id, indexContent); err != nil {
+					log.Printf("error reindexing post %d: %v", id, err)
+				}
+			})
+		})
 	}
 
 	return 204, nil
 }
 
 // DeletePost deletes a post
-// If Hard is true, it permanently deletes the post and removes it from the index.
+// If Hard is true, it permanently deletes the post, removes it from the index and deletes its files.
 // If Hard is false, it marks the post as deleted.
 // Returns a 204 No Content status on success.
 func (h *PostHandler) DeletePost(r *http.Request, payload m.JSON[models.DeletePostRequest]) (m.StatusCode, error) {
 	id := payload.Value.ID
 
 	if payload.Value.Hard {
-		err := h.postService.HardDelete(r.Context(), id)
+		files, err := h.postService.HardDelete(r.Context(), id)
 		if err != nil {
 			log.Printf("error hard deleting post %d: %v", id, err)
 			return 0, err
 		}
 
-		go func() {
-			ctx := context.Background()
-			if err := h.fts.Deindex(ctx, id); err != nil {
-				log.Printf("error deleting post %d from index: %v", id, err)
-			}
-		}()
+		// The files go once the post is gone for good, not if its deletion rolls back
+		services.AfterCommit(r.Context(), func() {
+			safego.Go("deindex-post", func() {
+				ctx := context.Background()
+				if err := h.fts.Deindex(ctx, id); err != nil {
+					log.Printf("error deleting post %d from index: %v", id, err)
+				}
+
+				if reclaimed := h.uploadService.DeleteFiles(files); reclaimed > 0 {
+					log.Printf("deleted %d files of post %d, reclaimed %d bytes", len(files), id, reclaimed)
+				}
+			})
+		})
 
 	} else {
 		err := h.postService.Delete(r.Context(), id)
@@ -296,29 +689,72 @@ func (h *PostHandler) RestorePost(r *http.Request, payload m.JSON[models.ID]) (m
 
 // ClearPosts permanently deletes all soft-deleted posts
 // It returns a 204 No Content status on success.
-// After clearing, it removes the posts from the full-text index in the background.
+// After clearing, it removes the posts from the full-text index and deletes their files in the background.
 func (h *PostHandler) ClearPosts(r *http.Request) (m.StatusCode, error) {
-	ids, err := h.postService.ClearAll(r.Context())
+	ids, files, err := h.postService.ClearAll(r.Context())
 	if err != nil {
 		log.Printf("error clearing posts: %v", err)
 		return 0, err
 	}
 	log.Printf("cleared posts: %v", ids)
 
-	go func() {
+	safego.Go("clear-posts", func() {
 		ctx := context.Background()
 		for _, id := range ids {
 			if err := h.fts.Deindex(ctx, id); err != nil {
 				log.Printf("error deleting post %d from index: %v", id, err)
 			}
 		}
-	}()
+
+		if reclaimed := h.uploadService.DeleteFiles(files); reclaimed > 0 {
+			log.Printf("deleted %d files of cleared posts, reclaimed %d bytes", len(files), reclaimed)
+		}
+	})
 
 	return 204, nil
 }
 
 // Helper functions
 
+// validateColor checks that the color is one of the palette colors
+func (h *PostHandler) validateColor(color string) error {
+	for _, c := range h.config.Palette {
+		if c.Name == color {
+			return nil
+		}
+	}
+	return e.BadRequest(fmt.Sprintf("invalid color %q", color))
+}
+
+// SuggestTags suggests tags for draft content, with their confidence
+// It returns at most limit suggestions, 5 by default and 20 at most.
+func (h *PostHandler) SuggestTags(r *http.Request, payload m.JSON[models.SuggestTagsRequest]) ([]models.TagSuggestion, error) {
+	if err := h.validateSize(payload.Value.Content); err != nil {
+		return nil, err
+	}
+
+	limit := payload.Value.Limit
+	if limit <= 0 {
+		limit = 5
+	}
+	limit = min(limit, 20)
+
+	suggestions, err := h.tagSuggester.Suggest(r.Context(), payload.Value.Content, limit)
+	if err != nil {
+		log.Printf("error suggesting tags: %v", err)
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+// validateSize checks that the content does not exceed the maximum post size
+func (h *PostHandler) validateSize(content string) error {
+	if int64(len(content)) > h.config.MaxSize {
+		return e.ContentTooLarge(fmt.Sprintf("content size %d exceeds the maximum of %d bytes", len(content), h.config.MaxSize))
+	}
+	return nil
+}
+
 // IsChineseCharacter checks if a rune is a Chinese character
 func isChineseCharacter(c rune) bool {
 	return c >= '\u4e00' && c <= '\u9fff'
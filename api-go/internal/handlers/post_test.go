@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	m "github.com/cymoo/mint"
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+	"github.com/cymoo/mote/internal/testutil"
+)
+
+// newTestPostHandler returns a PostHandler on a database of the test, indexing the posts in a fake index
+func newTestPostHandler(t *testing.T) (*PostHandler, *services.DB, *testutil.FakeIndex) {
+	t.Helper()
+	db := services.NewDB(testutil.NewDB(t))
+	client, _ := testutil.NewRedis(t)
+	index := testutil.NewFakeIndex(nil)
+	upload := &config.UploadConfig{BasePath: t.TempDir()}
+	uploads := services.NewUploadService(upload, services.NewImagePool(upload))
+
+	h := NewPostHandler(
+		services.NewPostService(db),
+		services.NewTagService(db),
+		uploads,
+		index,
+		&config.PostConfig{MaxSize: 1 << 20, IndexSize: 64},
+		services.NewTagAliasScanner(nil),
+		services.NewArchiveService(db, uploads, &config.ArchiveConfig{}),
+		services.NewStatsCache(db, 0),
+		services.NewViewService(client),
+	)
+	return h, db, index
+}
+
+// waitSearch waits for the posts matching the query in the index to be want, the index is written in the background
+func waitSearch(t *testing.T, index *testutil.FakeIndex, query string, want ...int64) {
+	t.Helper()
+	var ids []int64
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		_, results, _ := index.Search(context.Background(), query, false, 0)
+		ids = ids[:0]
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+		slices.Sort(ids)
+		if slices.Equal(ids, want) {
+			return
+		}
+	}
+	t.Fatalf("expected %q to match posts %v, got %v", query, want, ids)
+}
+
+func TestPostIndexing(t *testing.T) {
+	h, _, index := newTestPostHandler(t)
+	r := httptest.NewRequest("POST", "/", nil)
+
+	created, err := h.CreatePost(httptest.NewRecorder(), r, m.JSON[models.CreatePostRequest]{Value: models.CreatePostRequest{Content: "<p>hello channels</p>"}})
+	if err != nil {
+		t.Fatalf("CreatePost failed: %v", err)
+	}
+	waitSearch(t, index, "channels", created.ID)
+
+	content := "<p>hello goroutines</p>"
+	update := models.UpdatePostRequest{ID: created.ID, Content: &content}
+	if _, err := h.UpdatePost(httptest.NewRecorder(), r, m.JSON[models.UpdatePostRequest]{Value: update}); err != nil {
+		t.Fatalf("UpdatePost failed: %v", err)
+	}
+	waitSearch(t, index, "goroutines", created.ID)
+	waitSearch(t, index, "channels")
+
+	// A soft-deleted post stays indexed until it's deleted for good
+	for _, hard := range []bool{false, true} {
+		body := m.JSON[models.DeletePostRequest]{Value: models.DeletePostRequest{ID: created.ID, Hard: hard}}
+		if _, err := h.DeletePost(r, body); err != nil {
+			t.Fatalf("DeletePost failed: %v", err)
+		}
+		if !hard {
+			waitSearch(t, index, "goroutines", created.ID)
+		}
+	}
+	waitSearch(t, index, "hello")
+}
+
+func TestPostIndexTruncated(t *testing.T) {
+	h, _, index := newTestPostHandler(t)
+	r := httptest.NewRequest("POST", "/", nil)
+
+	// Only the start of the content fits the index size
+	content := "<p>start " + strings.Repeat("padding ", 10) + "end</p>"
+	w := httptest.NewRecorder()
+	created, err := h.CreatePost(w, r, m.JSON[models.CreatePostRequest]{Value: models.CreatePostRequest{Content: content}})
+	if err != nil {
+		t.Fatalf("CreatePost failed: %v", err)
+	}
+	if w.Header().Get("X-Index-Truncated") != "true" {
+		t.Error("expected the created post to be flagged as truncated")
+	}
+	waitSearch(t, index, "start", created.ID)
+	waitSearch(t, index, "end")
+
+	// The update is flagged the same way
+	content = "<p>again " + strings.Repeat("padding ", 10) + "end</p>"
+	w = httptest.NewRecorder()
+	update := models.UpdatePostRequest{ID: created.ID, Content: &content}
+	if _, err := h.UpdatePost(w, r, m.JSON[models.UpdatePostRequest]{Value: update}); err != nil {
+		t.Fatalf("UpdatePost failed: %v", err)
+	}
+	if w.Header().Get("X-Index-Truncated") != "true" {
+		t.Error("expected the updated post to be flagged as truncated")
+	}
+	waitSearch(t, index, "again", created.ID)
+}
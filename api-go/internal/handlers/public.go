@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	m "github.com/cymoo/mint"
+	e "github.com/cymoo/mote/internal/errors"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+// PublicHandler serves the shared posts as JSON to third-party readers, see the public API keys
+type PublicHandler struct {
+	posts          *services.PublicPostService
+	archiveService *services.ArchiveService
+	viewService    *services.ViewService
+	perPage        int
+}
+
+// NewPublicHandler creates a new PublicHandler
+// perPage is the number of posts on a page
+func NewPublicHandler(db *sqlx.DB, archiveService *services.ArchiveService, viewService *services.ViewService, perPage int) *PublicHandler {
+	return &PublicHandler{
+		posts:          services.NewPublicPostService(db, services.VisibilityShared),
+		archiveService: archiveService,
+		viewService:    viewService,
+		perPage:        perPage,
+	}
+}
+
+// GetPosts retrieves a page of the shared posts, newest first
+func (h *PublicHandler) GetPosts(r *http.Request, query m.Query[models.SharedPostsRequest]) (*models.SharedPostPage, error) {
+	page, err := pageNumber(query.Value.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	// One more post is fetched to know if there is a next page
+	posts, err := h.posts.GetPosts(r.Context(), h.perPage+1, (page-1)*h.perPage)
+	if err != nil {
+		log.Printf("error getting shared posts: %v", err)
+		return nil, e.InternalError()
+	}
+	return h.sharedPostPage(r.Context(), posts, page), nil
+}
+
+// GetPost retrieves a shared post
+func (h *PublicHandler) GetPost(r *http.Request) (*models.SharedPost, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return nil, e.BadRequest("invalid post id")
+	}
+
+	post, err := h.posts.GetPost(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, e.NotFound("post not found")
+	}
+	if err != nil {
+		log.Printf("error getting shared post %d: %v", id, err)
+		return nil, e.InternalError()
+	}
+
+	if err := h.viewService.RecordView(r.Context(), id, false, time.Now()); err != nil {
+		log.Printf("error recording a view of shared post %d: %v", id, err)
+	}
+	shared := h.sharedPost(r.Context(), post)
+	return &shared, nil
+}
+
+// GetTagPosts retrieves a page of the shared posts under a tag, including its subtags, newest first
+// The tag is the rest of the path, e.g. /tags/tech/golang
+func (h *PublicHandler) GetTagPosts(r *http.Request, query m.Query[models.SharedPostsRequest]) (*models.SharedPostPage, error) {
+	name, ok := tagFromPath(r)
+	if !ok {
+		return nil, e.BadRequest("tag is required")
+	}
+	page, err := pageNumber(query.Value.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := h.posts.GetTagPosts(r.Context(), name, h.perPage+1, (page-1)*h.perPage)
+	if err != nil {
+		log.Printf("error getting shared posts of tag %q: %v", name, err)
+		return nil, e.InternalError()
+	}
+	// A tag without shared posts is not disclosed
+	if len(posts) == 0 && page == 1 {
+		return nil, e.NotFound("tag not found")
+	}
+	return h.sharedPostPage(r.Context(), posts, page), nil
+}
+
+// sharedPostPage converts a page of posts, fetched with one more post than a page, to a SharedPostPage
+func (h *PublicHandler) sharedPostPage(ctx context.Context, posts []models.Post, page int) *models.SharedPostPage {
+	result := &models.SharedPostPage{Posts: make([]models.SharedPost, 0, len(posts))}
+	if len(posts) > h.perPage {
+		posts = posts[:h.perPage]
+		next := page + 1
+		result.NextPage = &next
+	}
+	for _, post := range posts {
+		result.Posts = append(result.Posts, h.sharedPost(ctx, post))
+	}
+	return result
+}
+
+// sharedPost converts a post to a SharedPost, its links that died since it was shared point to their snapshot
+func (h *PublicHandler) sharedPost(ctx context.Context, post models.Post) models.SharedPost {
+	return models.SharedPost{
+		ID:          post.ID,
+		Title:       post.Title.String,
+		Description: post.Description.String,
+		Content:     h.archiveService.UseArchives(ctx, post.Content),
+		Files:       post.Files,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+	}
+}
+
+// pageNumber returns the requested page number, the first page if none is given
+func pageNumber(page int) (int, error) {
+	if page < 0 {
+		return 0, e.BadRequest("page must be positive")
+	}
+	return max(page, 1), nil
+}
@@ -1,28 +1,38 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 
 	m "github.com/cymoo/mint"
+	"github.com/cymoo/mote/internal/config"
 	e "github.com/cymoo/mote/internal/errors"
 	"github.com/cymoo/mote/internal/models"
 	"github.com/cymoo/mote/internal/services"
+	"github.com/cymoo/mote/pkg/fulltext"
+	"github.com/cymoo/mote/pkg/util/safego"
+	"github.com/go-chi/chi/v5"
 )
 
 type TagHandler struct {
 	tagService *services.TagService
+	fts        fulltext.Indexer
+	config     *config.PostConfig
+	statsCache *services.StatsCache
 }
 
-func NewTagHandler(tagService *services.TagService) *TagHandler {
-	return &TagHandler{tagService: tagService}
+func NewTagHandler(tagService *services.TagService, fts fulltext.Indexer, config *config.PostConfig, statsCache *services.StatsCache) *TagHandler {
+	return &TagHandler{tagService: tagService, fts: fts, config: config, statsCache: statsCache}
 }
 
-// GetTags retrieves all tags with their post counts
-func (h *TagHandler) GetTags(r *http.Request) ([]models.TagWithPostCount, error) {
-	tags, err := h.tagService.GetAllWithPostCount(r.Context())
+// GetTags retrieves all tags with their post counts, cached until posts or tags change unless refresh is set
+func (h *TagHandler) GetTags(r *http.Request, query m.Query[models.StatsRequest]) ([]models.TagWithPostCount, error) {
+	tags, err := services.CachedStats(r.Context(), h.statsCache, "tags", query.Value.Refresh, h.tagService.GetAllWithPostCount)
 	if err != nil {
 		log.Printf("error getting tags: %v", err)
 		return nil, err
@@ -30,6 +40,34 @@ func (h *TagHandler) GetTags(r *http.Request) ([]models.TagWithPostCount, error)
 	return tags, nil
 }
 
+// GetPosts retrieves a page of the posts under a tag, including its subtags, with cursor pagination like GetPosts
+// The tag is path-escaped in the URL, e.g. /tags/tech%2Fgolang/posts
+func (h *TagHandler) GetPosts(r *http.Request, query m.Query[models.TagPostsRequest]) (*models.PostPagination, error) {
+	// chi matches the escaped path when it differs from the decoded one, see tagFromPath
+	name := chi.URLParam(r, "name")
+	if r.URL.RawPath != "" {
+		decoded, err := url.PathUnescape(name)
+		if err != nil {
+			return nil, e.BadRequest("invalid tag name")
+		}
+		name = decoded
+	}
+	pageSize, err := postPageSize(query.Value.Limit, h.config)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := h.tagService.GetPosts(r.Context(), name, query.Value, pageSize)
+	if errors.Is(err, services.ErrInvalidFilter) {
+		return nil, e.BadRequest(err.Error())
+	}
+	if err != nil {
+		log.Printf("error getting posts of tag %q: %v", name, err)
+		return nil, e.InternalError()
+	}
+	return paginate(posts, query.Value.OrderBy, pageSize), nil
+}
+
 // RenameTag renames or merges a tag
 // It checks for invalid hierarchy and returns a BadRequest error if detected.
 // The old tag name is replaced with the new tag name in all associated posts.
@@ -53,7 +91,7 @@ func (h *TagHandler) RenameTag(r *http.Request, payload m.JSON[models.RenameTagR
 	return m.StatusCode(204), nil
 }
 
-// DeleteTag deletes a tag and removes its association from all posts
+// DeleteTag puts a tag and its subtags in the trash, deleting their posts
 // It returns a 204 No Content status on success.
 func (h *TagHandler) DeleteTag(r *http.Request, payload m.JSON[models.Name]) (m.StatusCode, error) {
 	tagName := payload.Value.Name
@@ -65,6 +103,85 @@ func (h *TagHandler) DeleteTag(r *http.Request, payload m.JSON[models.Name]) (m.
 	return m.StatusCode(204), nil
 }
 
+// GetDeletedTags retrieves the deleted and merged tags that can still be restored
+func (h *TagHandler) GetDeletedTags(r *http.Request) ([]models.Tag, error) {
+	tags, err := h.tagService.GetDeleted(r.Context())
+	if err != nil {
+		log.Printf("error getting deleted tags: %v", err)
+		return nil, err
+	}
+	return tags, nil
+}
+
+// RestoreTag takes a tag out of the trash, undoing its deletion or merge
+// It returns a 204 No Content status on success.
+func (h *TagHandler) RestoreTag(r *http.Request, payload m.JSON[models.Name]) (m.StatusCode, error) {
+	tagName := payload.Value.Name
+	err := h.tagService.Restore(r.Context(), tagName)
+	if errors.Is(err, services.ErrTagNotFound) {
+		return 0, e.NotFound("tag not found in the trash")
+	}
+	if errors.Is(err, services.ErrTagTargetDeleted) {
+		return 0, e.BadRequest(fmt.Sprintf("cannot restore %q: %v", tagName, err))
+	}
+	if err != nil {
+		log.Printf("error restoring tag %q: %v", tagName, err)
+		return 0, err
+	}
+	return m.StatusCode(204), nil
+}
+
+// RetagPosts adds and removes tags across the posts given by IDs or matching a filter
+// With dry_run, it returns the changes that would be made without making them. Otherwise the changed posts are
+// reindexed in the background, like UpdatePost does.
+func (h *TagHandler) RetagPosts(r *http.Request, payload m.JSON[models.RetagRequest]) (*models.RetagResult, error) {
+	req := payload.Value
+	if len(req.IDs) == 0 && req.Filter == nil {
+		return nil, e.BadRequest("either ids or filter is required")
+	}
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		return nil, e.BadRequest("no tag to add or remove")
+	}
+
+	removed := make(map[string]bool, len(req.Remove))
+	for _, name := range req.Remove {
+		if !validTagName(name) {
+			return nil, e.BadRequest(fmt.Sprintf("invalid tag name %q", name))
+		}
+		removed[name] = true
+	}
+	for _, name := range req.Add {
+		if !validTagName(name) {
+			return nil, e.BadRequest(fmt.Sprintf("invalid tag name %q", name))
+		}
+		if removed[name] {
+			return nil, e.BadRequest(fmt.Sprintf("cannot both add and remove %q", name))
+		}
+	}
+
+	result, err := h.tagService.Retag(r.Context(), req)
+	if err != nil {
+		log.Printf("error retagging posts: %v", err)
+		return nil, err
+	}
+	if req.DryRun || len(result.Changes) == 0 {
+		return result, nil
+	}
+
+	services.AfterCommit(r.Context(), func() {
+		safego.Go("reindex-retagged-posts", func() {
+			ctx := context.Background()
+			for _, change := range result.Changes {
+				indexContent, _ := services.TruncateContent(change.Content, h.config.IndexSize)
+				if err := h.fts.Reindex(ctx, change.ID, indexContent); err != nil {
+					log.Printf("error reindexing post %d: %v", change.ID, err)
+				}
+			}
+		})
+	})
+	return result, nil
+}
+
 // StickTag sets or unsets a tag as sticky
 // It returns a 204 No Content status on success.
 func (h *TagHandler) StickTag(r *http.Request, payload m.JSON[models.StickyTagRequest]) (m.StatusCode, error) {
@@ -76,3 +193,9 @@ func (h *TagHandler) StickTag(r *http.Request, payload m.JSON[models.StickyTagRe
 	}
 	return m.StatusCode(204), nil
 }
+
+// validTagName checks that a name can be written in a hash-tag span
+func validTagName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "/") && !strings.HasSuffix(name, "/") &&
+		!strings.ContainsAny(name, " \t\r\n<>&\"#")
+}
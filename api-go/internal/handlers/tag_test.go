@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	m "github.com/cymoo/mint"
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+)
+
+func TestRetagPostsReindex(t *testing.T) {
+	posts, db, index := newTestPostHandler(t)
+	h := NewTagHandler(services.NewTagService(db), index, &config.PostConfig{IndexSize: 1 << 10}, services.NewStatsCache(db, 0))
+	r := httptest.NewRequest("POST", "/", nil)
+
+	content := `<p>notes <span class="hash-tag">#draft</span></p>`
+	created, err := posts.CreatePost(httptest.NewRecorder(), r, m.JSON[models.CreatePostRequest]{Value: models.CreatePostRequest{Content: content}})
+	if err != nil {
+		t.Fatalf("CreatePost failed: %v", err)
+	}
+	waitSearch(t, index, "#draft", created.ID)
+
+	retag := func(dryRun bool) {
+		t.Helper()
+		req := models.RetagRequest{IDs: []int64{created.ID}, Add: []string{"golang"}, Remove: []string{"draft"}, DryRun: dryRun}
+		result, err := h.RetagPosts(r, m.JSON[models.RetagRequest]{Value: req})
+		if err != nil || len(result.Changes) != 1 {
+			t.Fatalf("RetagPosts = %+v, %v, want a change", result, err)
+		}
+	}
+
+	// A dry run leaves the index as it is
+	retag(true)
+	waitSearch(t, index, "#golang")
+
+	retag(false)
+	waitSearch(t, index, "#golang", created.ID)
+	waitSearch(t, index, "#draft")
+	waitSearch(t, index, "notes", created.ID)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	m "github.com/cymoo/mint"
+	e "github.com/cymoo/mote/internal/errors"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+)
+
+type TemplateHandler struct {
+	templateService *services.TemplateService
+	postHandler     *PostHandler
+}
+
+func NewTemplateHandler(templateService *services.TemplateService, postHandler *PostHandler) *TemplateHandler {
+	return &TemplateHandler{
+		templateService: templateService,
+		postHandler:     postHandler,
+	}
+}
+
+// GetTemplates retrieves the templates of posts, by name
+func (h *TemplateHandler) GetTemplates(r *http.Request) ([]models.PostTemplate, error) {
+	templates, err := h.templateService.GetAll(r.Context())
+	if err != nil {
+		log.Printf("error getting templates: %v", err)
+		return nil, err
+	}
+	return templates, nil
+}
+
+// CreateTemplate creates a template of posts
+// It returns a BadRequest error for a template without name, with an invalid tag or color, or a name already taken,
+// and a ContentTooLarge error if the content exceeds the maximum size of a post.
+func (h *TemplateHandler) CreateTemplate(r *http.Request, body m.JSON[models.PostTemplateRequest]) (*models.PostTemplate, error) {
+	if err := h.validate(body.Value); err != nil {
+		return nil, err
+	}
+
+	template, err := h.templateService.Create(r.Context(), body.Value)
+	if err != nil {
+		return nil, templateError(err)
+	}
+	return template, nil
+}
+
+// UpdateTemplate replaces the name, content, tags and color of a template
+// It returns a 204 No Content status on success, a NotFound error if the template doesn't exist,
+// and the errors of CreateTemplate for an invalid template.
+func (h *TemplateHandler) UpdateTemplate(r *http.Request, body m.JSON[models.PostTemplateRequest]) (m.StatusCode, error) {
+	if err := h.validate(body.Value); err != nil {
+		return 0, err
+	}
+
+	if err := h.templateService.Update(r.Context(), body.Value); err != nil {
+		return 0, templateError(err)
+	}
+	return 204, nil
+}
+
+// DeleteTemplate deletes a template, the posts created from it are kept
+// It returns a 204 No Content status on success, and a NotFound error if the template doesn't exist.
+func (h *TemplateHandler) DeleteTemplate(r *http.Request, payload m.JSON[models.ID]) (m.StatusCode, error) {
+	if err := h.templateService.Delete(r.Context(), payload.Value.ID); err != nil {
+		return 0, templateError(err)
+	}
+	return 204, nil
+}
+
+// CreatePostFromTemplate creates a post from a template, like CreatePost
+// The date placeholders of the template are expanded at the current time in the requested timezone,
+// see services.ExpandTemplate. It returns a NotFound error if the template doesn't exist.
+func (h *TemplateHandler) CreatePostFromTemplate(w http.ResponseWriter, r *http.Request, body m.JSON[models.CreateFromTemplateRequest]) (*models.CreateResponse, error) {
+	loc := time.Local
+	if tz := body.Value.Timezone; tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, e.BadRequest(fmt.Sprintf("invalid timezone '%s'", tz))
+		}
+	}
+
+	template, err := h.templateService.Get(r.Context(), body.Value.ID)
+	if err != nil {
+		return nil, templateError(err)
+	}
+
+	req := services.PostFromTemplate(template, time.Now().In(loc))
+	req.ParentID = body.Value.ParentID
+	return h.postHandler.CreatePost(w, r, m.JSON[models.CreatePostRequest]{Value: req})
+}
+
+// validate checks the content and color of a template like the ones of a post
+func (h *TemplateHandler) validate(req models.PostTemplateRequest) error {
+	if err := h.postHandler.validateSize(req.Content); err != nil {
+		return err
+	}
+	if req.Color != nil {
+		return h.postHandler.validateColor(*req.Color)
+	}
+	return nil
+}
+
+// templateError maps the errors of the template service to HTTP errors
+func templateError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrTemplateNotFound):
+		return e.NotFound(err.Error())
+	case errors.Is(err, services.ErrInvalidTemplate), errors.Is(err, services.ErrTemplateNameTaken):
+		return e.BadRequest(err.Error())
+	}
+	log.Printf("error saving template: %v", err)
+	return err
+}
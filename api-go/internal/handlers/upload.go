@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 
@@ -20,7 +21,8 @@ func NewUploadHandler(uploadService *services.UploadService) *UploadHandler {
 
 // UploadFile handles file uploads
 // It processes the uploaded file and returns its FileInfo.
-// Returns a BadRequest error if the file is invalid.
+// Returns a BadRequest error if the file is invalid, and a ServiceUnavailable error if too many images are being
+// processed to take another one.
 func (h *UploadHandler) UploadFile(r *http.Request) (*models.FileInfo, error) {
 	file, header, err := r.FormFile("file")
 	if err != nil {
@@ -33,7 +35,10 @@ func (h *UploadHandler) UploadFile(r *http.Request) (*models.FileInfo, error) {
 		return nil, e.NotFound("invalid upload file name")
 	}
 
-	fileInfo, err := h.uploadService.UploadFile(header)
+	fileInfo, err := h.uploadService.UploadFile(r.Context(), header)
+	if errors.Is(err, services.ErrImagePoolBusy) {
+		return nil, e.ServiceUnavailable(err.Error())
+	}
 	if err != nil {
 		log.Printf("error handling uploaded file: %v", err)
 		return nil, err
@@ -41,6 +46,12 @@ func (h *UploadHandler) UploadFile(r *http.Request) (*models.FileInfo, error) {
 	return fileInfo, nil
 }
 
+// GetImagePoolStats reports the metrics of the workers processing the uploaded images
+// A growing count of rejected images points at too few workers, or a queue too short for the bursts of uploads
+func (h *UploadHandler) GetImagePoolStats(r *http.Request) (models.ImagePoolStats, error) {
+	return h.uploadService.ImagePoolStats(), nil
+}
+
 // SimpleFileForm returns a simple HTML form for file upload
 // This is useful for testing file uploads via a web browser.
 func (h *UploadHandler) SimpleFileForm() m.HTML {
@@ -0,0 +1,79 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/cymoo/mote/pkg/util/markdown"
+)
+
+var (
+	// Day One escapes Markdown characters of plain text
+	dayOneEscapeRegex = regexp.MustCompile(`\\([\\.\-!#*_()\[\]{}+>|~` + "`" + `])`)
+	dayOneMomentRegex = regexp.MustCompile(`!\[[^\]]*\]\(dayone-moment:/+[^)]*\)`)
+)
+
+// DayOne reads the JSON export of Day One, a journal file with its photos directory
+// Photos are attached to their entries, other media are skipped.
+type DayOne struct{}
+
+type dayOneJournal struct {
+	Entries []struct {
+		Text         string    `json:"text"`
+		CreationDate time.Time `json:"creationDate"`
+		ModifiedDate time.Time `json:"modifiedDate"`
+		Tags         []string  `json:"tags"`
+		Photos       []struct {
+			MD5  string `json:"md5"`
+			Type string `json:"type"`
+		} `json:"photos"`
+	} `json:"entries"`
+}
+
+func (DayOne) Read(fsys fs.FS) ([]Note, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no journal JSON file found")
+	}
+
+	var notes []Note
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		var journal dayOneJournal
+		if err := json.Unmarshal(data, &journal); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		dir := path.Dir(file)
+		for _, entry := range journal.Entries {
+			text := dayOneMomentRegex.ReplaceAllString(entry.Text, "")
+			text = dayOneEscapeRegex.ReplaceAllString(text, "$1")
+
+			note := Note{
+				Content:   markdown.ToHTML(text),
+				CreatedAt: entry.CreationDate,
+				UpdatedAt: entry.ModifiedDate,
+				Tags:      entry.Tags,
+			}
+			for _, photo := range entry.Photos {
+				name := path.Join(dir, "photos", photo.MD5+"."+photo.Type)
+				if _, err := fs.Stat(fsys, name); err == nil {
+					note.Files = append(note.Files, name)
+				}
+			}
+			notes = append(notes, note)
+		}
+	}
+	return notes, nil
+}
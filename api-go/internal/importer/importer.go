@@ -0,0 +1,314 @@
+// Package importer brings notes exported from other apps into posts
+//
+// Each export format is read by a Source, which maps the notes to post content, tags and attachments.
+// Sources are registered by name, so new formats can be plugged in without touching the runner.
+package importer
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/services"
+	"github.com/cymoo/mote/pkg/fulltext"
+)
+
+// maxErrors is the number of errors kept in the progress of an import
+const maxErrors = 100
+
+var (
+	imageRegex      = regexp.MustCompile(`!\[[^\]]*\]\(<?([^)\s>]+)>?(?:\s+"[^"]*")?\)`)
+	whitespaceRegex = regexp.MustCompile(`\s+`)
+)
+
+// Note is a note read from an export
+type Note struct {
+	// Content is the HTML of the post
+	Content   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Tags are added to the content unless it already contains them
+	Tags []string
+	// Files are the paths of the attachments within the export
+	Files []string
+}
+
+// Source reads the notes of an export format
+type Source interface {
+	Read(fsys fs.FS) ([]Note, error)
+}
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = map[string]Source{}
+)
+
+// Register makes a source available under the format name
+func Register(format string, source Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources[format] = source
+}
+
+// Formats returns the names of the registered formats
+func Formats() []string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+
+	formats := make([]string, 0, len(sources))
+	for format := range sources {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func lookupSource(format string) (Source, bool) {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	source, ok := sources[format]
+	return source, ok
+}
+
+func init() {
+	Register("memos", Memos{})
+	Register("dayone", DayOne{})
+	Register("markdown", MarkdownFolder{})
+}
+
+// Progress reports the state of an import
+type Progress struct {
+	Format   string   `json:"format"`
+	DryRun   bool     `json:"dry_run"`
+	Total    int      `json:"total"`
+	Done     int      `json:"done"`
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Files    int      `json:"files"`
+	Errors   []string `json:"errors"`
+	Finished bool     `json:"finished"`
+}
+
+func (p *Progress) addError(format string, args ...any) {
+	if len(p.Errors) < maxErrors {
+		p.Errors = append(p.Errors, fmt.Sprintf(format, args...))
+	}
+}
+
+// Options controls an import
+type Options struct {
+	// DryRun reads and checks the notes without creating anything
+	DryRun bool
+	// OnProgress is called after each note with a snapshot of the progress
+	OnProgress func(Progress)
+}
+
+// Importer creates posts from the notes of an export
+type Importer struct {
+	db         *services.DB
+	posts      *services.PostService
+	activities *services.ActivityService
+	uploads    *services.UploadService
+	fts        fulltext.Indexer
+	config     *config.PostConfig
+}
+
+func New(db *services.DB, uploads *services.UploadService, fts fulltext.Indexer, config *config.PostConfig) *Importer {
+	return &Importer{
+		db:         db,
+		posts:      services.NewPostService(db),
+		activities: services.NewActivityService(db),
+		uploads:    uploads,
+		fts:        fts,
+		config:     config,
+	}
+}
+
+// Run imports the notes of an export in the given format
+// A note that fails is reported in the progress and skipped, the import carries on with the next one.
+func (im *Importer) Run(ctx context.Context, format string, fsys fs.FS, opts Options) (*Progress, error) {
+	source, ok := lookupSource(format)
+	if !ok {
+		return nil, fmt.Errorf("unknown import format %q, expected one of %s", format, strings.Join(Formats(), ", "))
+	}
+
+	notes, err := source.Read(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s export: %w", format, err)
+	}
+
+	progress := &Progress{Format: format, DryRun: opts.DryRun, Total: len(notes), Errors: []string{}}
+	report := func() {
+		if opts.OnProgress != nil {
+			snapshot := *progress
+			snapshot.Errors = slices.Clone(progress.Errors)
+			opts.OnProgress(snapshot)
+		}
+	}
+
+	run := func() error {
+		for i, note := range notes {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := im.importNote(ctx, fsys, note, progress, opts.DryRun); err != nil {
+				progress.Skipped++
+				progress.addError("note %d: %v", i+1, err)
+			} else {
+				progress.Imported++
+			}
+			progress.Done++
+			report()
+		}
+		return nil
+	}
+
+	if opts.DryRun {
+		err = run()
+	} else {
+		err = services.WithCheckpoints(ctx, im.db, "import", run)
+		if progress.Imported > 0 {
+			summary := fmt.Sprintf("imported %d notes from %s, %d skipped", progress.Imported, format, progress.Skipped)
+			if err := im.activities.Record(context.WithoutCancel(ctx), models.ActivityImportCompleted, summary); err != nil {
+				log.Printf("error recording import activity: %v", err)
+			}
+		}
+	}
+
+	progress.Finished = true
+	report()
+	return progress, err
+}
+
+func (im *Importer) importNote(ctx context.Context, fsys fs.FS, note Note, progress *Progress, dryRun bool) error {
+	content := withTags(note.Content, note.Tags)
+	if strings.TrimSpace(content) == "" && len(note.Files) == 0 {
+		return fmt.Errorf("note is empty")
+	}
+	if int64(len(content)) > im.config.MaxSize {
+		return fmt.Errorf("content size %d exceeds the maximum of %d bytes", len(content), im.config.MaxSize)
+	}
+
+	if dryRun {
+		for _, file := range note.Files {
+			if _, err := fs.Stat(fsys, file); err != nil {
+				return fmt.Errorf("attachment %s: %w", file, err)
+			}
+			progress.Files++
+		}
+		return nil
+	}
+
+	var files []models.FileInfo
+	for _, file := range note.Files {
+		info, err := im.saveFile(ctx, fsys, file)
+		if err != nil {
+			im.uploads.DeleteFiles(files)
+			return fmt.Errorf("attachment %s: %w", file, err)
+		}
+		files = append(files, *info)
+	}
+
+	createdAt := note.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	updatedAt := note.UpdatedAt
+	if updatedAt.Before(createdAt) {
+		updatedAt = createdAt
+	}
+
+	rv, err := im.posts.Import(ctx, models.CreatePostRequest{Content: content, Files: files},
+		createdAt.UnixMilli(), updatedAt.UnixMilli())
+	if err != nil {
+		im.uploads.DeleteFiles(files)
+		return err
+	}
+	progress.Files += len(files)
+
+	indexContent, _ := services.TruncateContent(content, im.config.IndexSize)
+	if err := im.fts.Index(ctx, rv.ID, indexContent); err != nil {
+		log.Printf("error indexing imported post %d: %v", rv.ID, err)
+	}
+	return nil
+}
+
+func (im *Importer) saveFile(ctx context.Context, fsys fs.FS, name string) (*models.FileInfo, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return im.uploads.SaveFile(ctx, path.Base(name), "", file)
+}
+
+// OpenSource opens an export, either a directory or a zip archive
+// The returned function releases the export once the import is done.
+func OpenSource(name string) (fs.FS, func() error, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return os.DirFS(name), func() error { return nil }, nil
+	}
+
+	archive, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("export must be a directory or a zip archive: %w", err)
+	}
+	return archive, archive.Close, nil
+}
+
+// withTags appends the tags missing from the content as hash tags
+func withTags(content string, tags []string) string {
+	var spans []string
+	for _, tag := range tags {
+		tag = whitespaceRegex.ReplaceAllString(strings.Trim(strings.TrimSpace(tag), "#"), "_")
+		if tag == "" {
+			continue
+		}
+		span := `<span class="hash-tag">#` + html.EscapeString(tag) + `</span>`
+		if !strings.Contains(content, span) && !slices.Contains(spans, span) {
+			spans = append(spans, span)
+		}
+	}
+	if len(spans) == 0 {
+		return content
+	}
+	return content + "<p>" + strings.Join(spans, " ") + "</p>"
+}
+
+// extractImages removes the local images of Markdown text and returns their paths
+// resolve maps an image reference to a path within the export, or returns false to keep the image
+func extractImages(text string, resolve func(ref string) (string, bool)) (string, []string) {
+	var files []string
+	text = imageRegex.ReplaceAllStringFunc(text, func(image string) string {
+		ref := imageRegex.FindStringSubmatch(image)[1]
+		if strings.Contains(ref, "://") {
+			return image
+		}
+		file, ok := resolve(ref)
+		if !ok {
+			return image
+		}
+		if !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+		return ""
+	})
+	return text, files
+}
@@ -0,0 +1,160 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/services"
+)
+
+func TestMemosRead(t *testing.T) {
+	fsys := fstest.MapFS{
+		"memos.json": {Data: []byte(`{"memos": [
+			{"content": "hello #inbox", "createTime": "2024-01-02T03:04:05Z", "resources": [{"filename": "a.png"}]},
+			{"content": "gone", "state": "DELETED"}
+		]}`)},
+		"resources/a.png": {Data: []byte("png")},
+	}
+
+	notes, err := Memos{}.Read(fsys)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(notes) != 1 {
+		t.Fatalf("expected 1 note, got %d", len(notes))
+	}
+	note := notes[0]
+	if note.Content != `<p>hello <span class="hash-tag">#inbox</span></p>` {
+		t.Errorf("unexpected content: %q", note.Content)
+	}
+	if !note.CreatedAt.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected creation time: %v", note.CreatedAt)
+	}
+	if len(note.Files) != 1 || note.Files[0] != "resources/a.png" {
+		t.Errorf("unexpected files: %v", note.Files)
+	}
+}
+
+func TestMemosReadLegacyArray(t *testing.T) {
+	fsys := fstest.MapFS{
+		"memos.json": {Data: []byte(`[{"content": "old", "createdTs": 1700000000}]`)},
+	}
+
+	notes, err := Memos{}.Read(fsys)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(notes) != 1 || notes[0].CreatedAt.Unix() != 1700000000 {
+		t.Errorf("unexpected notes: %+v", notes)
+	}
+}
+
+func TestDayOneRead(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Journal.json": {Data: []byte(`{"entries": [{
+			"text": "![](dayone-moment://ABC)\n\nA day\\. Fine\\!",
+			"creationDate": "2023-05-06T07:08:09Z",
+			"tags": ["travel", "road trip"],
+			"photos": [{"md5": "abc", "type": "jpeg"}, {"md5": "missing", "type": "jpeg"}]
+		}]}`)},
+		"photos/abc.jpeg": {Data: []byte("jpeg")},
+	}
+
+	notes, err := DayOne{}.Read(fsys)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(notes) != 1 {
+		t.Fatalf("expected 1 note, got %d", len(notes))
+	}
+	note := notes[0]
+	if note.Content != "<p>A day. Fine!</p>" {
+		t.Errorf("unexpected content: %q", note.Content)
+	}
+	if len(note.Files) != 1 || note.Files[0] != "photos/abc.jpeg" {
+		t.Errorf("unexpected files: %v", note.Files)
+	}
+
+	content := withTags(note.Content, note.Tags)
+	if !strings.HasSuffix(content, `<p><span class="hash-tag">#travel</span> <span class="hash-tag">#road_trip</span></p>`) {
+		t.Errorf("expected tags to be appended, got %q", content)
+	}
+}
+
+func TestMarkdownFolderRead(t *testing.T) {
+	modTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"notes/trip.md":     {Data: []byte("---\ntitle: Trip\ndate: 2021-03-04\ntags:\n  - travel\n  - family\n---\nWe went ![photo](img/sea.png) there."), ModTime: modTime},
+		"notes/img/sea.png": {Data: []byte("png")},
+		"plain.md":          {Data: []byte("just text ![remote](https://example.com/a.png)"), ModTime: modTime},
+		"other.txt":         {Data: []byte("ignored")},
+		".obsidian/x.md":    {Data: []byte("ignored")},
+	}
+
+	notes, err := MarkdownFolder{}.Read(fsys)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(notes) != 2 {
+		t.Fatalf("expected 2 notes, got %d", len(notes))
+	}
+
+	trip := notes[0]
+	if trip.Content != "<h1>Trip</h1><p>We went  there.</p>" {
+		t.Errorf("unexpected content: %q", trip.Content)
+	}
+	if trip.CreatedAt.Year() != 2021 || !trip.UpdatedAt.Equal(modTime) {
+		t.Errorf("unexpected times: %v %v", trip.CreatedAt, trip.UpdatedAt)
+	}
+	if len(trip.Tags) != 2 || trip.Tags[0] != "travel" || trip.Tags[1] != "family" {
+		t.Errorf("unexpected tags: %v", trip.Tags)
+	}
+	if len(trip.Files) != 1 || trip.Files[0] != "notes/img/sea.png" {
+		t.Errorf("unexpected files: %v", trip.Files)
+	}
+
+	plain := notes[1]
+	if len(plain.Files) != 0 || !plain.CreatedAt.Equal(modTime) {
+		t.Errorf("expected remote images to stay in the content, got %+v", plain)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	fsys := fstest.MapFS{
+		"memos.json": {Data: []byte(`[
+			{"content": "one", "resourceList": [{"filename": "a.png"}]},
+			{"content": ""},
+			{"content": "` + strings.Repeat("x", 100) + `"}
+		]`)},
+		"a.png": {Data: []byte("png")},
+	}
+
+	im := New(services.NewDB(nil), nil, nil, &config.PostConfig{MaxSize: 64})
+
+	var reports []Progress
+	progress, err := im.Run(context.Background(), "memos", fsys, Options{
+		DryRun:     true,
+		OnProgress: func(p Progress) { reports = append(reports, p) },
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if progress.Total != 3 || progress.Imported != 1 || progress.Skipped != 2 || progress.Files != 1 {
+		t.Errorf("unexpected progress: %+v", progress)
+	}
+	if len(progress.Errors) != 2 || !progress.Finished {
+		t.Errorf("expected 2 errors and a finished import, got %+v", progress)
+	}
+	if len(reports) != 4 || reports[0].Done != 1 {
+		t.Errorf("expected a report per note and a final one, got %d", len(reports))
+	}
+
+	if _, err := im.Run(context.Background(), "unknown", fsys, Options{DryRun: true}); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+}
@@ -0,0 +1,151 @@
+package importer
+
+import (
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mote/pkg/util/markdown"
+)
+
+// frontMatterDateLayouts are the date formats accepted in front matter
+var frontMatterDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// MarkdownFolder reads a folder of Markdown files, one note per file
+// A YAML-like front matter may give the title, tags and dates, otherwise the modification time is used.
+// Local images are attached to their note.
+type MarkdownFolder struct{}
+
+func (MarkdownFolder) Read(fsys fs.FS) ([]Note, error) {
+	var notes []Note
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name != "." && strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(path.Ext(name))
+		if ext != ".md" && ext != ".markdown" {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		notes = append(notes, markdownNote(fsys, name, string(data), info.ModTime()))
+		return nil
+	})
+	return notes, err
+}
+
+func markdownNote(fsys fs.FS, name, text string, modTime time.Time) Note {
+	meta, body := splitFrontMatter(text)
+	note := Note{CreatedAt: modTime, UpdatedAt: modTime}
+
+	for _, key := range []string{"created", "date"} {
+		if t, ok := parseFrontMatterDate(meta[key]); ok {
+			note.CreatedAt = t
+			break
+		}
+	}
+	if t, ok := parseFrontMatterDate(meta["updated"]); ok {
+		note.UpdatedAt = t
+	}
+	note.Tags = parseFrontMatterList(meta["tags"])
+
+	if title := meta["title"]; title != "" && !strings.HasPrefix(strings.TrimSpace(body), "#") {
+		body = "# " + title + "\n\n" + body
+	}
+
+	dir := path.Dir(name)
+	body, note.Files = extractImages(body, func(ref string) (string, bool) {
+		if unescaped, err := url.PathUnescape(ref); err == nil {
+			ref = unescaped
+		}
+		file := path.Join(dir, ref)
+		if !fs.ValidPath(file) {
+			return "", false
+		}
+		if _, err := fs.Stat(fsys, file); err != nil {
+			return "", false
+		}
+		return file, true
+	})
+
+	note.Content = markdown.ToHTML(body)
+	return note
+}
+
+// splitFrontMatter separates the "key: value" front matter from the body of a Markdown file
+// List values are joined with commas.
+func splitFrontMatter(text string) (map[string]string, string) {
+	meta := map[string]string{}
+	text = strings.TrimPrefix(text, "\ufeff")
+	if !strings.HasPrefix(text, "---\n") && !strings.HasPrefix(text, "---\r\n") {
+		return meta, text
+	}
+
+	lines := strings.Split(text, "\n")
+	var key string
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if line == "---" {
+			return meta, strings.Join(lines[i+1:], "\n")
+		}
+
+		if item, ok := strings.CutPrefix(strings.TrimSpace(line), "- "); ok && key != "" {
+			if meta[key] != "" {
+				meta[key] += ","
+			}
+			meta[key] += item
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(k))
+		meta[key] = strings.Trim(strings.TrimSpace(v), `"'`)
+	}
+
+	// No closing delimiter, it wasn't front matter
+	return map[string]string{}, text
+}
+
+func parseFrontMatterDate(value string) (time.Time, bool) {
+	for _, layout := range frontMatterDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseFrontMatterList(value string) []string {
+	value = strings.Trim(value, "[]")
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.Trim(strings.TrimSpace(item), `"'`); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
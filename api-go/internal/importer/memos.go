@@ -0,0 +1,103 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mote/pkg/util/markdown"
+)
+
+// Memos reads the memos listed by the Memos API, saved as JSON files
+// Both {"memos": [...]} responses of the v1 API and the plain arrays of older versions are accepted.
+// Attachments are looked up by file name next to the JSON file or in its resources directory.
+type Memos struct{}
+
+type memo struct {
+	Content string `json:"content"`
+	// v1 API
+	CreateTime time.Time `json:"createTime"`
+	UpdateTime time.Time `json:"updateTime"`
+	Resources  []struct {
+		Filename string `json:"filename"`
+	} `json:"resources"`
+	// Older versions
+	CreatedTs    int64 `json:"createdTs"`
+	UpdatedTs    int64 `json:"updatedTs"`
+	ResourceList []struct {
+		Filename string `json:"filename"`
+	} `json:"resourceList"`
+	RowStatus string `json:"rowStatus"`
+	State     string `json:"state"`
+}
+
+func (Memos) Read(fsys fs.FS) ([]Note, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no JSON file found")
+	}
+
+	var notes []Note
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		var memos []memo
+		if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+			err = json.Unmarshal(data, &memos)
+		} else {
+			var page struct {
+				Memos []memo `json:"memos"`
+			}
+			err = json.Unmarshal(data, &page)
+			memos = page.Memos
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		dir := path.Dir(file)
+		for _, m := range memos {
+			// Archived memos are imported too, deleted ones are not
+			if m.RowStatus == "DELETED" || m.State == "DELETED" {
+				continue
+			}
+			notes = append(notes, m.note(fsys, dir))
+		}
+	}
+	return notes, nil
+}
+
+func (m memo) note(fsys fs.FS, dir string) Note {
+	note := Note{CreatedAt: m.CreateTime, UpdatedAt: m.UpdateTime}
+	if m.CreatedTs > 0 {
+		note.CreatedAt = time.Unix(m.CreatedTs, 0)
+	}
+	if m.UpdatedTs > 0 {
+		note.UpdatedAt = time.Unix(m.UpdatedTs, 0)
+	}
+
+	resources := append(m.Resources, m.ResourceList...)
+	for _, resource := range resources {
+		for _, candidate := range []string{
+			path.Join(dir, resource.Filename),
+			path.Join(dir, "resources", resource.Filename),
+		} {
+			if _, err := fs.Stat(fsys, candidate); err == nil {
+				note.Files = append(note.Files, candidate)
+				break
+			}
+		}
+	}
+
+	note.Content = markdown.ToHTML(m.Content)
+	return note
+}
@@ -86,9 +86,12 @@ func (n *NullRawMessage) Scan(value interface{}) error {
 }
 
 // Post represents a post entity
+// RootID is the post at the top of its thread, the post itself without parent, and Depth the number of parents above it.
 type Post struct {
 	ID            int64          `json:"id" db:"id"`
 	Content       string         `json:"content" db:"content"`
+	Title         NullString     `json:"title" db:"title"`
+	Description   NullString     `json:"description" db:"description"`
 	Files         NullRawMessage `json:"files,omitempty" db:"files"`
 	Color         NullString     `json:"color,omitempty" db:"color"`
 	Shared        bool           `json:"shared" db:"shared"`
@@ -97,11 +100,15 @@ type Post struct {
 	UpdatedAt     int64          `json:"updated_at" db:"updated_at"`
 	ParentID      NullInt64      `json:"-" db:"parent_id"`
 	ChildrenCount int64          `json:"children_count" db:"children_count"`
+	RootID        NullInt64      `json:"root_id" db:"root_id"`
+	Depth         int64          `json:"depth" db:"depth"`
 
 	// Additional fields not in DB
 	Parent *Post    `json:"parent,omitempty"`
 	Score  *float64 `json:"score,omitempty"`
 	Tags   []string `json:"tags"`
+	// ThreadMatches is the number of posts of its thread matching a search grouped by thread, see SearchRequest
+	ThreadMatches int64 `json:"thread_matches,omitempty"`
 }
 
 // FileInfo represents file metadata
@@ -111,15 +118,21 @@ type FileInfo struct {
 	Size     *uint64 `json:"size,omitempty"`
 	Width    *uint32 `json:"width,omitempty"`
 	Height   *uint32 `json:"height,omitempty"`
+	Caption  *string `json:"caption,omitempty"`
+	// ContentType is detected from the content of the file when it is uploaded
+	ContentType *string `json:"content_type,omitempty"`
 }
 
 // Tag represents a tag entity
 type Tag struct {
-	ID        int64  `json:"id" db:"id"`
-	Name      string `json:"name" db:"name"`
-	Sticky    bool   `json:"sticky" db:"sticky"`
-	CreatedAt int64  `json:"created_at" db:"created_at"`
-	UpdatedAt int64  `json:"updated_at" db:"updated_at"`
+	ID        int64     `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Sticky    bool      `json:"sticky" db:"sticky"`
+	CreatedAt int64     `json:"created_at" db:"created_at"`
+	UpdatedAt int64     `json:"updated_at" db:"updated_at"`
+	DeletedAt NullInt64 `json:"deleted_at,omitempty" db:"deleted_at"`
+	// MergedInto is the ID of the tag a merged tag was moved into
+	MergedInto NullInt64 `json:"merged_into,omitempty" db:"merged_into"`
 }
 
 // TagWithPostCount represents a tag with its post count
@@ -135,6 +148,49 @@ type RenameTagRequest struct {
 	NewName string `json:"new_name"`
 }
 
+// SuggestTagsRequest represents the request to suggest tags for draft content
+type SuggestTagsRequest struct {
+	Content string `json:"content"`
+	Limit   int    `json:"limit"`
+}
+
+// TagSuggestion represents a tag suggested for draft content
+type TagSuggestion struct {
+	Name string `json:"name"`
+	// Confidence is between 0 and 1
+	Confidence float64 `json:"confidence"`
+	// Reasons are the signals behind the suggestion: "name", "content" or "co-occurrence"
+	Reasons []string `json:"reasons"`
+}
+
+// RetagRequest represents the request to add and remove tags across posts
+// The posts are given by their IDs or, without IDs, by a filter
+type RetagRequest struct {
+	IDs    []int64            `json:"ids"`
+	Filter *FilterPostRequest `json:"filter"`
+	Add    []string           `json:"add"`
+	Remove []string           `json:"remove"`
+	// DryRun previews the changes without writing them
+	DryRun bool `json:"dry_run"`
+}
+
+// RetagResult represents the outcome of a retag
+type RetagResult struct {
+	// Matched is the number of posts selected by the request
+	Matched int           `json:"matched"`
+	Changes []RetagChange `json:"changes"`
+	DryRun  bool          `json:"dry_run"`
+}
+
+// RetagChange represents the tags added to and removed from a post by a retag
+type RetagChange struct {
+	ID      int64    `json:"id"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	// Content is the retagged content of the post, to reindex it
+	Content string `json:"-"`
+}
+
 // StickyTagRequest represents the request to set a tag's sticky status
 type StickyTagRequest struct {
 	Name   string `json:"name"`
@@ -146,6 +202,30 @@ type SearchRequest struct {
 	Query   string `schema:"query"`
 	Limit   int    `schema:"limit"`
 	Partial bool   `schema:"partial"`
+	// GroupThreads keeps the best-scoring post of each thread, with the number of posts of the thread that matched
+	GroupThreads bool `schema:"group_threads"`
+	// Offset and Timezone are the timezone of the dates of the before: and after: operators of the query, see
+	// DateRange
+	Offset   int    `schema:"offset"` // in minutes
+	Timezone string `schema:"tz"`
+}
+
+// ViewedPostsRequest represents the query of the recently or most viewed posts
+type ViewedPostsRequest struct {
+	// Limit is the number of posts, the configured page size if not set, capped by its maximum
+	Limit *int `schema:"limit"`
+}
+
+// QuickSearchRequest represents the request to search posts as the user types
+type QuickSearchRequest struct {
+	Query string `schema:"q"`
+}
+
+// PostSummary represents a lightweight post used in quick search results
+type PostSummary struct {
+	ID    int64    `json:"id"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
 }
 
 // CreatePostRequest represents the request to create a post
@@ -155,6 +235,18 @@ type CreatePostRequest struct {
 	Color    *string    `json:"color"`
 	Shared   *bool      `json:"shared"`
 	ParentID *int64     `json:"parent_id"`
+
+	// DetectTags adds tags whose configured aliases appear in the content
+	DetectTags bool `json:"detect_tags"`
+}
+
+// UpdateFilesRequest patches the metadata of the files of a post, leaving its content alone
+type UpdateFilesRequest struct {
+	ID int64 `json:"id"`
+	// Order lists the URLs of all the files of the post in their new order, the order is kept if empty
+	Order []string `json:"order"`
+	// Captions sets the captions of files by URL, an empty caption removes it
+	Captions map[string]string `json:"captions"`
 }
 
 // UpdatePostRequest represents the request to update a post
@@ -166,6 +258,16 @@ type UpdatePostRequest struct {
 	Files    t.Optional[[]FileInfo] `json:"files"`
 	Color    t.Optional[string]     `json:"color"`
 	ParentID t.Optional[int64]      `json:"parent_id"`
+
+	// DetectTags adds tags whose configured aliases appear in the updated content
+	DetectTags bool `json:"detect_tags"`
+}
+
+// ClipRequest represents the request to clip a web page into a post
+// HTML is the page as rendered by the browser, the page is fetched from URL if it is empty
+type ClipRequest struct {
+	URL  string `json:"url"`
+	HTML string `json:"html"`
 }
 
 type DeletePostRequest struct {
@@ -175,24 +277,60 @@ type DeletePostRequest struct {
 
 // FilterPostRequest represents filtering options for posts
 type FilterPostRequest struct {
-	Cursor    *int64  `schema:"cursor"`
-	Deleted   bool    `schema:"deleted"`
-	ParentID  *int64  `schema:"parent_id"`
-	Color     *string `schema:"color"`
-	Tag       *string `schema:"tag"`
-	Shared    *bool   `schema:"shared"`
-	HasFiles  *bool   `schema:"has_files"`
-	OrderBy   string  `schema:"order_by"`
-	Ascending bool    `schema:"ascending"`
-	StartDate *int64  `schema:"start_date"`
-	EndDate   *int64  `schema:"end_date"`
+	Cursor *int64 `schema:"cursor" json:"cursor"`
+	// CursorID is the ID of the last post of the previous page, it breaks ties between posts with the cursor value
+	CursorID *int64  `schema:"cursor_id" json:"cursor_id"`
+	Deleted  bool    `schema:"deleted" json:"deleted"`
+	ParentID *int64  `schema:"parent_id" json:"parent_id"`
+	Color    *string `schema:"color" json:"color"`
+	Tag      *string `schema:"tag" json:"tag"`
+	Shared   *bool   `schema:"shared" json:"shared"`
+	HasFiles *bool   `schema:"has_files" json:"has_files"`
+	// OrderBy is created_at, the default, updated_at, deleted_at or children_count
+	OrderBy   string `schema:"order_by" json:"order_by"`
+	Ascending bool   `schema:"ascending" json:"ascending"`
+	StartDate *int64 `schema:"start_date" json:"start_date"`
+	EndDate   *int64 `schema:"end_date" json:"end_date"`
+
+	// Brief omits the content of posts, for list views that only show titles
+	Brief bool `schema:"brief" json:"brief"`
+	// Limit is the number of posts on the page, the configured page size if not set, capped by its maximum
+	Limit *int `schema:"limit" json:"limit"`
+}
+
+// TagPostsRequest represents the query of a page of the posts under a tag
+type TagPostsRequest struct {
+	Cursor   *int64 `schema:"cursor"`
+	CursorID *int64 `schema:"cursor_id"`
+	// OrderBy is created_at, the default, updated_at or children_count
+	OrderBy   string `schema:"order_by"`
+	Ascending bool   `schema:"ascending"`
+	// Limit is the number of posts on the page, the configured page size if not set, capped by its maximum
+	Limit *int `schema:"limit"`
+}
+
+// Thread is a post at the top of a thread with all the posts below it
+type Thread struct {
+	RootID int64 `json:"root_id"`
+	// Posts are ordered by depth, then creation, deleted ones are left out
+	Posts []ThreadPost `json:"posts"`
+}
+
+// ThreadPost is a post of a thread with the ID of its parent, to build the tree
+type ThreadPost struct {
+	Post
+	ParentID *int64 `json:"parent_id"`
 }
 
 // PostPagination represents paginated posts
 type PostPagination struct {
-	Posts  []Post `json:"posts"`
-	Cursor int64  `json:"cursor"`
-	Size   int64  `json:"size"`
+	Posts []Post `json:"posts"`
+	// Cursor is the value of the order column of the last post, -1 if there are none
+	Cursor   int64 `json:"cursor"`
+	CursorID int64 `json:"cursor_id"`
+	Size     int64 `json:"size"`
+	// PageSize is the effective number of posts per page, a page with fewer posts is the last one
+	PageSize int `json:"page_size,omitempty"`
 }
 
 // PostStats represents statistics about posts
@@ -202,11 +340,151 @@ type PostStats struct {
 	DayCount  int64 `json:"day_count"`
 }
 
+// GroupCount represents a post count for a group key such as a month, color or tag
+type GroupCount struct {
+	Key   string `json:"key" db:"key"`
+	Count int64  `json:"count" db:"count"`
+}
+
+// GroupedPostCounts represents post counts grouped by month, color and top-level tag
+type GroupedPostCounts struct {
+	ByMonth []GroupCount `json:"by_month"`
+	ByColor []GroupCount `json:"by_color"`
+	ByTag   []GroupCount `json:"by_tag"`
+}
+
+// StatsRequest represents the query string parameters of cached counts
+type StatsRequest struct {
+	// Refresh recomputes the counts instead of returning the cached ones
+	Refresh bool `schema:"refresh"`
+}
+
+// TimezoneOffset represents a timezone offset query string parameter
+type TimezoneOffset struct {
+	Offset int `schema:"offset"` // in minutes
+}
+
+// PaletteColorWithPostCount represents a palette color with its post count
+type PaletteColorWithPostCount struct {
+	Name      string `json:"name"`
+	Hex       string `json:"hex"`
+	PostCount int64  `json:"post_count"`
+}
+
 // CreateResponse represents the response after creating a post
 type CreateResponse struct {
 	ID        int64 `json:"id"`
 	CreatedAt int64 `json:"created_at"`
 	UpdatedAt int64 `json:"updated_at"`
+
+	// DetectedTags lists the tags added by alias detection
+	DetectedTags []string `json:"detected_tags,omitempty"`
+}
+
+// Types of activities
+const (
+	ActivityPostCreated     = "post_created"
+	ActivityPostUpdated     = "post_updated"
+	ActivityTagRenamed      = "tag_renamed"
+	ActivityImportCompleted = "import_completed"
+	ActivityBackupTaken     = "backup_taken"
+)
+
+// ActivityTypes are the types of activities, in the order they are listed
+var ActivityTypes = []string{
+	ActivityPostCreated, ActivityPostUpdated, ActivityTagRenamed, ActivityImportCompleted, ActivityBackupTaken,
+}
+
+// Activity represents something that happened in the vault
+type Activity struct {
+	ID   int64  `json:"id" db:"id"`
+	Type string `json:"type" db:"type"`
+	// SubjectID is the ID of the post or tag the activity is about
+	SubjectID NullInt64 `json:"subject_id" db:"subject_id"`
+	Summary   string    `json:"summary" db:"summary"`
+	CreatedAt int64     `json:"created_at" db:"created_at"`
+}
+
+// ActivityRequest represents the query of a page of activities, newest first
+type ActivityRequest struct {
+	// Cursor is the ID of the last activity of the previous page
+	Cursor *int64 `schema:"cursor"`
+	// Types filters the activities by type, all types if empty
+	Types []string `schema:"type"`
+	Limit *int     `schema:"limit"`
+}
+
+// ActivityPage represents a page of activities
+type ActivityPage struct {
+	Activities []Activity `json:"activities"`
+	// Cursor is the ID of the last activity, -1 if there are none
+	Cursor int64 `json:"cursor"`
+}
+
+// PostTemplate represents a reusable skeleton of a post
+// Its content holds placeholders like {{date}}, expanded when a post is created from it, and its tags and color are
+// given to the post.
+type PostTemplate struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Content   string     `json:"content"`
+	Tags      []string   `json:"tags"`
+	Color     NullString `json:"color"`
+	CreatedAt int64      `json:"created_at"`
+	UpdatedAt int64      `json:"updated_at"`
+}
+
+// PostTemplateRequest represents the request to create a template, or to update the one with the ID
+type PostTemplateRequest struct {
+	ID      int64    `json:"id"`
+	Name    string   `json:"name"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags"`
+	Color   *string  `json:"color"`
+}
+
+// CreateFromTemplateRequest represents the request to create a post from a template
+type CreateFromTemplateRequest struct {
+	ID       int64  `json:"id"`
+	ParentID *int64 `json:"parent_id"`
+	// Timezone is the IANA timezone name the date placeholders are expanded in, the one of the server if empty
+	Timezone string `json:"tz"`
+}
+
+// Draft represents the unsaved content of a post autosaved by the editor
+type Draft struct {
+	// Key is chosen by the editor, e.g. new for a new post or post-42 for an edit of post 42
+	Key     string `json:"key" db:"key"`
+	Content string `json:"content" db:"content"`
+	// PostID is the post the draft edits, null for a new post
+	PostID    NullInt64 `json:"post_id" db:"post_id"`
+	UpdatedAt int64     `json:"updated_at" db:"updated_at"`
+	ExpiresAt int64     `json:"expires_at" db:"expires_at"`
+}
+
+// SaveDraftRequest represents the request to save a draft, replacing the one with the key
+type SaveDraftRequest struct {
+	Key     string `json:"key"`
+	Content string `json:"content"`
+	PostID  *int64 `json:"post_id"`
+}
+
+// DraftKey represents the key of a draft, in a query string or a body
+type DraftKey struct {
+	Key string `json:"key" schema:"key"`
+}
+
+// TaskState represents the state of a background task kept across restarts
+type TaskState struct {
+	Name       string    `json:"name" db:"name"`
+	Enabled    bool      `json:"enabled" db:"enabled"`
+	RunCount   int64     `json:"run_count" db:"run_count"`
+	ErrorCount int64     `json:"error_count" db:"error_count"`
+	Retries    int64     `json:"retries" db:"retries"`
+	LastRun    NullInt64 `json:"last_run,omitempty" db:"last_run"`
+	LastError  string    `json:"last_error" db:"last_error"`
+	// TrippedUntil is the end of the cooldown of a task disabled by its circuit breaker, in milliseconds
+	TrippedUntil NullInt64 `json:"tripped_until,omitempty" db:"tripped_until"`
 }
 
 // ID represents a simple ID query string parameter
@@ -219,14 +497,213 @@ type Name struct {
 	Name string `schema:"name"`
 }
 
+// StopTokenRequest represents the request to make a stop token searchable again
+type StopTokenRequest struct {
+	Token string `json:"token"`
+}
+
+// IndexMemoryRequest represents the query of the memory used by the full-text index
+type IndexMemoryRequest struct {
+	// Sample is the number of keys of each class measured, see fulltext.DefaultMemorySample
+	Sample int `schema:"sample"`
+}
+
 // DateRange represents a date range with start and end dates
 type DateRange struct {
 	StartDate string `schema:"start_date"`
 	EndDate   string `schema:"end_date"`
 	Offset    int    `schema:"offset"` // in minutes
+	// Timezone is an IANA timezone name, e.g. Europe/Paris, taking precedence over Offset
+	Timezone string `schema:"tz"`
 }
 
 // LoginRequest represents a login request with password
 type LoginRequest struct {
-	Password string `json:"password"`
+	Password   string `json:"password"`
+	RememberMe bool   `json:"remember_me"`
+	// Code is a TOTP or recovery code, required when two-factor auth is enabled
+	Code string `json:"code"`
+}
+
+// TwoFactorCode carries a TOTP or recovery code
+type TwoFactorCode struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorStatus reports whether two-factor auth is available and enabled
+type TwoFactorStatus struct {
+	Available bool `json:"available"`
+	Enabled   bool `json:"enabled"`
+}
+
+// TwoFactorEnrollment is the pending secret to add to an authenticator app
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
+// RecoveryCodes are single-use codes replacing a TOTP code when the authenticator is lost
+type RecoveryCodes struct {
+	Codes []string `json:"codes"`
+}
+
+// SessionInfo describes how the current request is authenticated
+type SessionInfo struct {
+	// Method is either "session" or "token"
+	Method     string `json:"method"`
+	CreatedAt  *int64 `json:"created_at,omitempty"`
+	ExpiresAt  *int64 `json:"expires_at,omitempty"`
+	RememberMe bool   `json:"remember_me"`
+	TwoFactor  bool   `json:"two_factor"`
+}
+
+// RequestLogEntry is a request and its response recorded by the debug log
+type RequestLogEntry struct {
+	RequestID       string              `json:"request_id"`
+	Time            int64               `json:"time"`
+	Method          string              `json:"method"`
+	URL             string              `json:"url"`
+	Status          int                 `json:"status"`
+	Duration        int64               `json:"duration_ms"`
+	RequestHeaders  map[string][]string `json:"request_headers"`
+	RequestBody     string              `json:"request_body"`
+	ResponseHeaders map[string][]string `json:"response_headers"`
+	ResponseBody    string              `json:"response_body"`
+}
+
+// BrokenLink represents an external link that failed its last check, with the posts containing it
+type BrokenLink struct {
+	URL          string     `json:"url" db:"url"`
+	Status       int        `json:"status" db:"status"`
+	Error        NullString `json:"error" db:"error"`
+	Failures     int64      `json:"failures" db:"failures"`
+	CheckedAt    int64      `json:"checked_at" db:"checked_at"`
+	FailingSince NullInt64  `json:"failing_since" db:"failing_since"`
+	PostIDs      []int64    `json:"post_ids"`
+}
+
+// SelfTestCheck represents the outcome of a single self-test check
+type SelfTestCheck struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Detail   string `json:"detail"`
+	Duration int64  `json:"duration_ms"`
+}
+
+// SelfTestReport represents the outcome of the self-test of a deployment
+type SelfTestReport struct {
+	OK     bool            `json:"ok"`
+	Time   int64           `json:"time"`
+	Checks []SelfTestCheck `json:"checks"`
+}
+
+// ChildrenCountDrift is a post whose stored children count differs from its live children
+type ChildrenCountDrift struct {
+	ID     int64 `json:"id" db:"id"`
+	Stored int64 `json:"stored" db:"stored"`
+	Actual int64 `json:"actual" db:"actual"`
+}
+
+// ChildrenCountReport reports the posts whose children count drifted, and whether they were fixed
+type ChildrenCountReport struct {
+	Drifts []ChildrenCountDrift `json:"drifts"`
+	Fixed  bool                 `json:"fixed"`
+}
+
+// RecomputeRequest asks to recompute derived columns, only reporting the discrepancies with DryRun
+type RecomputeRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// DBStats represents the database connection pool statistics and SQLite settings
+type DBStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDuration       int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+
+	Pragmas    SQLitePragmas   `json:"pragmas"`
+	WriteQueue WriteQueueStats `json:"write_queue"`
+}
+
+// SQLitePragmas represents the effective SQLite settings of a connection
+type SQLitePragmas struct {
+	JournalMode string `json:"journal_mode"`
+	BusyTimeout int64  `json:"busy_timeout"`
+	CacheSize   int64  `json:"cache_size"`
+	MmapSize    int64  `json:"mmap_size"`
+	ForeignKeys bool   `json:"foreign_keys"`
+}
+
+// WriteQueueStats represents the metrics of the queue serializing SQLite writes
+type WriteQueueStats struct {
+	// Depth is the number of writers waiting or writing
+	Depth     int64 `json:"depth"`
+	Completed int64 `json:"completed"`
+	// WaitAvg and WaitMax are the average and maximum time a writer waited for its turn, in milliseconds
+	WaitAvg float64 `json:"wait_avg_ms"`
+	WaitMax float64 `json:"wait_max_ms"`
+}
+
+// ImagePoolStats represents the metrics of the workers processing the uploaded images
+type ImagePoolStats struct {
+	// Workers is the number of images processed at once at most, and Active the number being processed
+	Workers int `json:"workers"`
+	Active  int `json:"active"`
+	// Queued is the number of images waiting for a worker, at most QueueSize
+	Queued    int64 `json:"queued"`
+	QueueSize int64 `json:"queue_size"`
+	Completed int64 `json:"completed"`
+	// Rejected is the number of images turned away because the queue was full or the wait timed out
+	Rejected int64 `json:"rejected"`
+	// WaitAvg and WaitMax are the average and maximum time an image waited for a worker, in milliseconds
+	WaitAvg float64 `json:"wait_avg_ms"`
+	WaitMax float64 `json:"wait_max_ms"`
+}
+
+// SharedPost is a shared post as served by the public API
+type SharedPost struct {
+	ID          int64          `json:"id"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Content     string         `json:"content"`
+	Files       NullRawMessage `json:"files,omitempty"`
+	CreatedAt   int64          `json:"created_at"`
+	UpdatedAt   int64          `json:"updated_at"`
+}
+
+// SharedPostPage is a page of shared posts, newest first
+type SharedPostPage struct {
+	Posts    []SharedPost `json:"posts"`
+	NextPage *int         `json:"next_page"`
+}
+
+// SharedPostsRequest represents the query of a page of shared posts
+type SharedPostsRequest struct {
+	Page int `schema:"page"`
+}
+
+// APIKeyUsage reports the requests made with a key of the public API on the last days
+type APIKeyUsage struct {
+	Name  string `json:"name"`
+	Tier  string `json:"tier"`
+	Quota int64  `json:"quota"`
+	// Daily are the numbers of requests per UTC day, from the oldest day to today
+	Daily []DailyUsage `json:"daily"`
+}
+
+// DailyUsage is the number of requests made with a key of the public API on a UTC day
+type DailyUsage struct {
+	Date     string `json:"date"`
+	Requests int64  `json:"requests"`
+}
+
+// APIKeyUsageRequest represents the query of the usage of the public API keys
+type APIKeyUsageRequest struct {
+	Days int `schema:"days"`
 }
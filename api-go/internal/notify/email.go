@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Email sends the notifications by email through an SMTP server, with STARTTLS if the server offers it
+type Email struct {
+	// addr is the host:port of the server
+	addr               string
+	username, password string
+	from               string
+	to                 []string
+}
+
+// NewEmail creates an Email notifier, it authenticates to the server unless username is empty
+func NewEmail(addr, username, password, from string, to []string) *Email {
+	return &Email{addr: addr, username: username, password: password, from: from, to: to}
+}
+
+func (e *Email) Notify(ctx context.Context, msg Message) error {
+	if err := e.send(ctx, e.message(msg, time.Now())); err != nil {
+		return fmt.Errorf("email: %w", err)
+	}
+	return nil
+}
+
+// message returns the email of a notification, the title as its subject
+func (e *Email) message(msg Message, now time.Time) []byte {
+	var b strings.Builder
+	// A title can't add headers
+	subject := strings.Join(strings.Fields(msg.Title), " ")
+	fmt.Fprintf(&b, "From: %s\r\n", e.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	if msg.Priority == PriorityHigh {
+		b.WriteString("X-Priority: 1\r\n")
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// send sends an email like smtp.SendMail, giving up once the context is done
+func (e *Email) send(ctx context.Context, message []byte) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(e.addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if e.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.username, e.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(e.from); err != nil {
+		return err
+	}
+	for _, to := range e.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
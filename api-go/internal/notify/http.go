@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Webhook posts the notifications as JSON to a URL, e.g. of a chat or an automation service:
+//
+//	{"title": "...", "body": "...", "priority": "high"}
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string, client *http.Client) *Webhook {
+	return &Webhook{url: url, client: client}
+}
+
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	payload, _ := json.Marshal(map[string]string{
+		"title":    msg.Title,
+		"body":     msg.Body,
+		"priority": msg.Priority.String(),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return post(w.client, req, "webhook")
+}
+
+// Ntfy publishes the notifications to a topic of ntfy, e.g. https://ntfy.sh/my-topic
+type Ntfy struct {
+	url string
+	// token is the access token of the topic, empty for a public one
+	token  string
+	client *http.Client
+}
+
+func NewNtfy(url, token string, client *http.Client) *Ntfy {
+	return &Ntfy{url: url, token: token, client: client}
+}
+
+func (n *Ntfy) Notify(ctx context.Context, msg Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(msg.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", msg.Title)
+	req.Header.Set("Priority", msg.Priority.String())
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	return post(n.client, req, "ntfy")
+}
+
+// telegramAPI is the URL of the Bot API of Telegram
+const telegramAPI = "https://api.telegram.org"
+
+// Telegram sends the notifications to a chat with a bot of Telegram
+type Telegram struct {
+	token  string
+	chatID string
+	client *http.Client
+	// baseURL is the URL of the Bot API, another one in tests
+	baseURL string
+}
+
+func NewTelegram(token, chatID string, client *http.Client) *Telegram {
+	return &Telegram{token: token, chatID: chatID, client: client, baseURL: telegramAPI}
+}
+
+func (t *Telegram) Notify(ctx context.Context, msg Message) error {
+	payload, _ := json.Marshal(map[string]any{
+		"chat_id": t.chatID,
+		"text":    msg.Title + "\n\n" + msg.Body,
+		// A notification of default priority doesn't ring
+		"disable_notification": msg.Priority != PriorityHigh,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/bot"+t.token+"/sendMessage", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return post(t.client, req, "telegram")
+}
@@ -0,0 +1,113 @@
+// Package notify delivers notifications, e.g. the failures of the background tasks, by email, webhook, ntfy or
+// Telegram, so that the features telling the owner about something share their delivery
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/pkg/util/safego"
+)
+
+// Priority tells how urgent a notification is, the channels supporting it show the urgent ones first
+type Priority int
+
+const (
+	PriorityDefault Priority = iota
+	// PriorityHigh is for what needs attention, e.g. a failure
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	if p == PriorityHigh {
+		return "high"
+	}
+	return "default"
+}
+
+// Message is a notification
+type Message struct {
+	Title    string
+	Body     string
+	Priority Priority
+}
+
+// Notifier delivers notifications to a channel
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// multi delivers notifications to several channels
+type multi []Notifier
+
+// Multi delivers notifications to all the notifiers, a failed delivery doesn't stop the others
+// The error joins the errors of the failed deliveries. Without notifiers, nothing is delivered.
+func Multi(notifiers ...Notifier) Notifier {
+	return multi(notifiers)
+}
+
+func (m multi) Notify(ctx context.Context, msg Message) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// New creates a notifier delivering notifications to the channels set in the configuration, see config.NotifyConfig
+// Enabled tells whether any channel is set.
+func New(cfg *config.NotifyConfig) (n Notifier, enabled bool) {
+	client := &http.Client{Timeout: cfg.Timeout}
+	var notifiers multi
+	if cfg.WebhookURL != "" {
+		notifiers = append(notifiers, NewWebhook(cfg.WebhookURL, client))
+	}
+	if cfg.NtfyURL != "" {
+		notifiers = append(notifiers, NewNtfy(cfg.NtfyURL, cfg.NtfyToken, client))
+	}
+	if cfg.TelegramToken != "" {
+		notifiers = append(notifiers, NewTelegram(cfg.TelegramToken, cfg.TelegramChatID, client))
+	}
+	if cfg.SMTPAddr != "" {
+		notifiers = append(notifiers, NewEmail(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.EmailFrom, cfg.EmailTo))
+	}
+	return notifiers, len(notifiers) > 0
+}
+
+// Go delivers a notification in the background with the given timeout, e.g. from a hook that mustn't wait for it
+// The error of the delivery is passed to onError, if not nil.
+func Go(n Notifier, msg Message, timeout time.Duration, onError func(error)) {
+	safego.Go("notify", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := n.Notify(ctx, msg); err != nil && onError != nil {
+			onError(err)
+		}
+	})
+}
+
+// post sends a request to a channel, the responses out of the 2xx range are errors with the start of their body
+func post(client *http.Client, req *http.Request, channel string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL may hold a token, e.g. the one of a bot of Telegram
+		if urlErr := (*url.Error)(nil); errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %w", channel, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: unexpected status %d: %s", channel, resp.StatusCode, body)
+	}
+	return nil
+}
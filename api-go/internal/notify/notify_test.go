@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder is a server recording the requests it receives
+type recorder struct {
+	*httptest.Server
+	requests chan *http.Request
+	bodies   chan string
+}
+
+func newRecorder(t *testing.T, status int) *recorder {
+	r := &recorder{requests: make(chan *http.Request, 1), bodies: make(chan string, 1)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.requests <- req
+		r.bodies <- string(body)
+		w.WriteHeader(status)
+		w.Write([]byte("nope"))
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+var failure = Message{Title: "task failed", Body: "boom", Priority: PriorityHigh}
+
+func TestWebhook(t *testing.T) {
+	server := newRecorder(t, http.StatusNoContent)
+	if err := NewWebhook(server.URL, server.Client()).Notify(context.Background(), failure); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	var payload map[string]string
+	json.Unmarshal([]byte(<-server.bodies), &payload)
+	if payload["title"] != "task failed" || payload["body"] != "boom" || payload["priority"] != "high" {
+		t.Errorf("expected the message as JSON, got %v", payload)
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	server := newRecorder(t, http.StatusOK)
+	if err := NewNtfy(server.URL+"/alerts", "tk", server.Client()).Notify(context.Background(), failure); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	req, body := <-server.requests, <-server.bodies
+	if req.URL.Path != "/alerts" || req.Header.Get("Title") != "task failed" || req.Header.Get("Priority") != "high" ||
+		req.Header.Get("Authorization") != "Bearer tk" || body != "boom" {
+		t.Errorf("expected the message published to the topic, got %s %v %q", req.URL.Path, req.Header, body)
+	}
+}
+
+func TestTelegram(t *testing.T) {
+	server := newRecorder(t, http.StatusOK)
+	telegram := NewTelegram("123:abc", "42", server.Client())
+	telegram.baseURL = server.URL
+	if err := telegram.Notify(context.Background(), Message{Title: "digest", Body: "3 posts"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	req, body := <-server.requests, <-server.bodies
+	var payload map[string]any
+	json.Unmarshal([]byte(body), &payload)
+	if req.URL.Path != "/bot123:abc/sendMessage" || payload["chat_id"] != "42" || payload["text"] != "digest\n\n3 posts" ||
+		payload["disable_notification"] != true {
+		t.Errorf("expected the message sent to the chat, got %s %v", req.URL.Path, payload)
+	}
+}
+
+func TestTelegramHidesToken(t *testing.T) {
+	telegram := NewTelegram("123:secret", "42", &http.Client{Timeout: time.Second})
+	telegram.baseURL = "http://127.0.0.1:1"
+	err := telegram.Notify(context.Background(), failure)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected an error without the token, got %v", err)
+	}
+}
+
+func TestMulti(t *testing.T) {
+	ok := newRecorder(t, http.StatusOK)
+	broken := newRecorder(t, http.StatusInternalServerError)
+	n := Multi(NewWebhook(broken.URL, broken.Client()), NewWebhook(ok.URL, ok.Client()))
+
+	err := n.Notify(context.Background(), failure)
+	if err == nil || !strings.Contains(err.Error(), "webhook: unexpected status 500: nope") {
+		t.Errorf("expected the error of the broken channel, got %v", err)
+	}
+	select {
+	case <-ok.requests:
+	default:
+		t.Error("expected the other channel to get the message")
+	}
+
+	if err := Multi().Notify(context.Background(), failure); err != nil {
+		t.Errorf("expected no error without notifiers, got %v", err)
+	}
+}
+
+func TestGo(t *testing.T) {
+	broken := newRecorder(t, http.StatusBadGateway)
+	errs := make(chan error, 1)
+	Go(NewWebhook(broken.URL, broken.Client()), failure, time.Second, func(err error) { errs <- err })
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "502") {
+			t.Errorf("expected the error of the delivery, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the delivery to fail")
+	}
+}
+
+func TestEmailMessage(t *testing.T) {
+	email := NewEmail("smtp.example.com:587", "", "", "mote@example.com", []string{"a@example.com", "b@example.com"})
+	msg := string(email.message(Message{Title: "task\r\nBcc: x@example.com failed", Body: "line 1\nline 2", Priority: PriorityHigh},
+		time.Date(2024, 6, 15, 9, 0, 0, 0, time.UTC)))
+
+	for _, want := range []string{
+		"From: mote@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: task Bcc: x@example.com failed\r\n",
+		"Date: Sat, 15 Jun 2024 09:00:00 +0000\r\n",
+		"X-Priority: 1\r\n",
+		"\r\n\r\nline 1\r\nline 2\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected the email to contain %q, got %q", want, msg)
+		}
+	}
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Errorf("expected the title not to add headers, got %q", msg)
+	}
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// activitySummaryLength is the maximum number of characters of the summary of an activity
+const activitySummaryLength = 100
+
+// ActivityService keeps the activity stream of the vault
+// The writes of posts and tags record their activity in their own transaction, see recordActivity.
+type ActivityService struct {
+	db     *DB
+	reader *sqlx.DB
+	writes *WriteQueue
+}
+
+func NewActivityService(db *DB) *ActivityService {
+	return &ActivityService{db: db, reader: db.reader, writes: db.writes}
+}
+
+// Record adds an activity that isn't part of a write of posts or tags, such as an import or a backup
+func (s *ActivityService) Record(ctx context.Context, activityType string, summary string) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return recordActivity(ctx, execerFor(ctx, s.db), activityType, 0, summary)
+}
+
+// List returns a page of activities of the given types, all if none, newest first
+// Invalid options return an error wrapping ErrInvalidFilter.
+func (s *ActivityService) List(ctx context.Context, options models.ActivityRequest, limit int) ([]models.Activity, error) {
+	for _, activityType := range options.Types {
+		if !slices.Contains(models.ActivityTypes, activityType) {
+			return nil, fmt.Errorf("%w: unknown activity type %q", ErrInvalidFilter, activityType)
+		}
+	}
+
+	var conditions []string
+	var args []any
+	if options.Cursor != nil {
+		conditions = append(conditions, "id < ?")
+		args = append(args, *options.Cursor)
+	}
+	if len(options.Types) > 0 {
+		conditions = append(conditions, "type IN (?"+strings.Repeat(", ?", len(options.Types)-1)+")")
+		for _, activityType := range options.Types {
+			args = append(args, activityType)
+		}
+	}
+
+	query := "SELECT * FROM activities"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	activities := make([]models.Activity, 0)
+	err := s.reader.SelectContext(ctx, &activities, query, args...)
+	return activities, err
+}
+
+// PruneBefore deletes the activities older than the given time, in milliseconds, and returns their count
+func (s *ActivityService) PruneBefore(ctx context.Context, before int64) (int64, error) {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	result, err := execerFor(ctx, s.db).ExecContext(ctx, "DELETE FROM activities WHERE created_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// recordActivity adds an activity about the post or tag with the given ID, 0 if it's about neither
+// It is called by the writes of posts and tags within their transaction, which holds the write queue.
+func recordActivity(ctx context.Context, exec sqlx.ExecerContext, activityType string, subjectID int64, summary string) error {
+	var subject models.NullInt64
+	if subjectID != 0 {
+		subject = models.NullInt64{NullInt64: sql.NullInt64{Int64: subjectID, Valid: true}}
+	}
+	if runes := []rune(summary); len(runes) > activitySummaryLength {
+		summary = string(runes[:activitySummaryLength-1]) + "…"
+	}
+
+	_, err := exec.ExecContext(ctx,
+		"INSERT INTO activities (type, subject_id, summary, created_at) VALUES (?, ?, ?, ?)",
+		activityType, subject, summary, time.Now().UnixMilli())
+	return err
+}
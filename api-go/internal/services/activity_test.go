@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+func TestActivities(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	posts := NewPostService(db)
+	activities := NewActivityService(db)
+
+	created, err := posts.Create(ctx, models.CreatePostRequest{Content: `<h1>Hello</h1><p>a note <span class="hash-tag">#go</span></p>`})
+	if err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	content := "<p>an updated note</p>"
+	if err := posts.Update(ctx, models.UpdatePostRequest{ID: created.ID, Content: &content}); err != nil {
+		t.Fatalf("failed to update post: %v", err)
+	}
+	if _, err := posts.Import(ctx, models.CreatePostRequest{Content: "imported"}, 1, 1); err != nil {
+		t.Fatalf("failed to import post: %v", err)
+	}
+	if err := NewTagService(db).RenameOrMerge(ctx, "go", "golang"); err != nil {
+		t.Fatalf("failed to rename tag: %v", err)
+	}
+	if err := activities.Record(ctx, models.ActivityBackupTaken, "backup.db"); err != nil {
+		t.Fatalf("failed to record activity: %v", err)
+	}
+
+	list, err := activities.List(ctx, models.ActivityRequest{}, 10)
+	if err != nil {
+		t.Fatalf("failed to list activities: %v", err)
+	}
+	expected := []struct{ activityType, summary string }{
+		{models.ActivityBackupTaken, "backup.db"},
+		{models.ActivityTagRenamed, "renamed go to golang"},
+		{models.ActivityPostUpdated, "an updated note"},
+		{models.ActivityPostCreated, "Hello"},
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("expected %d activities, got %+v", len(expected), list)
+	}
+	for i, want := range expected {
+		if list[i].Type != want.activityType || list[i].Summary != want.summary {
+			t.Errorf("activity %d: expected %s %q, got %s %q", i, want.activityType, want.summary, list[i].Type, list[i].Summary)
+		}
+	}
+	if !list[3].SubjectID.Valid || list[3].SubjectID.Int64 != created.ID || list[0].SubjectID.Valid {
+		t.Errorf("expected the subject of the post activity only, got %+v and %+v", list[3].SubjectID, list[0].SubjectID)
+	}
+
+	t.Run("pages and types", func(t *testing.T) {
+		page, err := activities.List(ctx, models.ActivityRequest{Cursor: &list[1].ID}, 1)
+		if err != nil || len(page) != 1 || page[0].ID != list[2].ID {
+			t.Errorf("expected the activity after the cursor, got %+v: %v", page, err)
+		}
+
+		page, err = activities.List(ctx, models.ActivityRequest{Types: []string{models.ActivityPostCreated, models.ActivityTagRenamed}}, 10)
+		if err != nil || len(page) != 2 {
+			t.Errorf("expected the activities of the types, got %+v: %v", page, err)
+		}
+
+		_, err = activities.List(ctx, models.ActivityRequest{Types: []string{"unknown"}}, 10)
+		if !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("expected ErrInvalidFilter, got %v", err)
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		count, err := activities.PruneBefore(ctx, list[1].CreatedAt+1)
+		if err != nil || count < 3 {
+			t.Fatalf("expected the older activities to be pruned, got %d: %v", count, err)
+		}
+	})
+}
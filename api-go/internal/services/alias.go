@@ -0,0 +1,92 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// tagAlias pairs a keyword pattern with the tag it maps to
+type tagAlias struct {
+	pattern *regexp.Regexp
+	tag     string
+}
+
+// TagAliasScanner detects configured keywords in post content and maps them to tags
+// It lets plain text (e.g. imports) be organized without the hash-tag syntax
+type TagAliasScanner struct {
+	aliases []tagAlias
+}
+
+// NewTagAliasScanner creates a scanner from a keyword to tag mapping
+// ASCII keywords match whole words case-insensitively, other keywords match anywhere
+func NewTagAliasScanner(aliases map[string]string) *TagAliasScanner {
+	keywords := make([]string, 0, len(aliases))
+	for keyword := range aliases {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+
+	scanner := &TagAliasScanner{}
+	for _, keyword := range keywords {
+		pattern := regexp.QuoteMeta(keyword)
+		if isASCIIWord(keyword) {
+			pattern = `\b` + pattern + `\b`
+		}
+		scanner.aliases = append(scanner.aliases, tagAlias{
+			pattern: regexp.MustCompile(`(?i)` + pattern),
+			tag:     aliases[keyword],
+		})
+	}
+	return scanner
+}
+
+// Detect returns the tags whose keywords appear in the content
+// Tags that are already present as hash tags are not returned
+func (s *TagAliasScanner) Detect(content string) []string {
+	existing := extractHashTags(content)
+	text := html.UnescapeString(htmlTagRegex.ReplaceAllString(hashTagRegex.ReplaceAllString(content, " "), " "))
+
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, alias := range s.aliases {
+		if existing[alias.tag] || seen[alias.tag] {
+			continue
+		}
+		if alias.pattern.MatchString(text) {
+			seen[alias.tag] = true
+			tags = append(tags, alias.tag)
+		}
+	}
+	return tags
+}
+
+// Apply appends hash tags for the detected tags to the content
+// The tags are added as hash-tag spans so they survive later edits
+func (s *TagAliasScanner) Apply(content string) (string, []string) {
+	tags := s.Detect(content)
+	if len(tags) == 0 {
+		return content, tags
+	}
+
+	spans := make([]string, len(tags))
+	for i, tag := range tags {
+		spans[i] = fmt.Sprintf(`<span class="hash-tag">#%s</span>`, html.EscapeString(tag))
+	}
+	return content + "<p>" + strings.Join(spans, " ") + "</p>", tags
+}
+
+// isASCIIWord checks if the keyword consists only of ASCII letters, digits and spaces
+func isASCIIWord(s string) bool {
+	for _, c := range s {
+		if c > unicode.MaxASCII || !(unicode.IsLetter(c) || unicode.IsDigit(c) || c == ' ') {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTagAliasScanner_Detect(t *testing.T) {
+	scanner := NewTagAliasScanner(map[string]string{
+		"golang": "programming/go",
+		"Go":     "programming/go",
+		"python": "programming/python",
+		"猫":      "animal/cat",
+	})
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"whole word", "<p>I like Golang a lot</p>", []string{"programming/go"}},
+		{"no partial word", "<p>gopher and pythonic</p>", []string{}},
+		{"chinese keyword", "<p>我的猫很可爱</p>", []string{"animal/cat"}},
+		{"multiple", "<p>go and python</p>", []string{"programming/go", "programming/python"}},
+		{"existing hash tag", `<p>python <span class="hash-tag">#programming/python</span></p>`, []string{}},
+		{"ignores markup", `<p class="golang">text</p>`, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scanner.Detect(tt.content)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Detect(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagAliasScanner_Apply(t *testing.T) {
+	scanner := NewTagAliasScanner(map[string]string{"golang": "go"})
+
+	content, tags := scanner.Apply("<p>golang</p>")
+	if !reflect.DeepEqual(tags, []string{"go"}) {
+		t.Fatalf("expected [go], got %v", tags)
+	}
+	if !strings.HasSuffix(content, `<p><span class="hash-tag">#go</span></p>`) {
+		t.Errorf("unexpected content: %s", content)
+	}
+	if got := extractHashTags(content); !got["go"] {
+		t.Errorf("expected appended tag to be extracted, got %v", got)
+	}
+
+	unchanged, tags := scanner.Apply("<p>nothing</p>")
+	if unchanged != "<p>nothing</p>" || len(tags) != 0 {
+		t.Errorf("expected content unchanged, got %q %v", unchanged, tags)
+	}
+}
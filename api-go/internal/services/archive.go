@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/pkg/util/cache"
+	"github.com/cymoo/mote/pkg/util/robots"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrArchiveDisallowed = errors.New("archiving is disallowed by robots.txt")
+	ErrArchiveNotHTML    = errors.New("page is not HTML")
+)
+
+// maxRobotsSize is the size of robots.txt files read, larger files are truncated
+const maxRobotsSize = 512 * 1024
+
+// ArchiveService snapshots the pages linked from posts, so they can be served once the originals die
+type ArchiveService struct {
+	db      *DB
+	reader  *sqlx.DB
+	writes  *WriteQueue
+	uploads *UploadService
+	config  *config.ArchiveConfig
+	client  *http.Client
+	// robots caches the robots.txt rules of each host
+	robots *cache.TTLCache[string, *robots.Rules]
+}
+
+func NewArchiveService(db *DB, uploads *UploadService, config *config.ArchiveConfig) *ArchiveService {
+	return &ArchiveService{
+		db:      db,
+		reader:  db.reader,
+		writes:  db.writes,
+		uploads: uploads,
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		robots:  cache.New[string, *robots.Rules](time.Hour, 1024),
+	}
+}
+
+// Enabled reports whether links are archived when posts are created
+func (s *ArchiveService) Enabled() bool {
+	return s.config.Enabled
+}
+
+// ArchiveLinks snapshots the external links of a post content that were not archived yet
+// Links that can't be archived are logged and skipped.
+func (s *ArchiveService) ArchiveLinks(ctx context.Context, content string) {
+	links := ExtractLinks(content)
+	if len(links) == 0 {
+		return
+	}
+
+	archived, err := s.findArchived(ctx, links)
+	if err != nil {
+		log.Printf("error finding archived links: %v", err)
+		return
+	}
+
+	for _, link := range links {
+		if _, ok := archived[link]; ok {
+			continue
+		}
+		if err := s.Archive(ctx, link); err != nil {
+			log.Printf("error archiving %s: %v", link, err)
+		}
+	}
+}
+
+// Archive fetches a page if robots.txt allows it and stores its snapshot
+func (s *ArchiveService) Archive(ctx context.Context, link string) error {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidClipURL
+	}
+
+	if !s.allowed(ctx, u) {
+		return ErrArchiveDisallowed
+	}
+
+	resp, err := s.get(ctx, link)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" &&
+		mediaType != "application/xhtml+xml" {
+		return ErrArchiveNotHTML
+	}
+
+	data, err := readLimited(resp.Body, s.config.MaxPageSize)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if _, err := s.uploads.SaveArchive(hash, data); err != nil {
+		return err
+	}
+
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	query := `
+		INSERT INTO link_archives (url, hash, size, archived_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET
+			hash = excluded.hash,
+			size = excluded.size,
+			archived_at = excluded.archived_at
+	`
+	_, err = execerFor(ctx, s.db).ExecContext(ctx, query, link, hash, len(data), time.Now().UnixMilli())
+	return err
+}
+
+// FindBrokenArchives returns the snapshot URLs of the links that failed their latest check, keyed by link
+func (s *ArchiveService) FindBrokenArchives(ctx context.Context, links []string) (map[string]string, error) {
+	archives := map[string]string{}
+	if len(links) == 0 {
+		return archives, nil
+	}
+
+	type row struct {
+		URL  string `db:"url"`
+		Hash string `db:"hash"`
+	}
+	var rows []row
+
+	linksJSON, _ := json.Marshal(links)
+	query := `
+		SELECT a.url, a.hash
+		FROM link_archives a
+		JOIN link_checks c ON c.url = a.url
+		WHERE c.failures > 0 AND a.url IN (SELECT value FROM json_each(?))
+	`
+	if err := s.reader.SelectContext(ctx, &rows, query, string(linksJSON)); err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		archives[r.URL] = s.uploads.ArchiveURL(r.Hash)
+	}
+	return archives, nil
+}
+
+// UseArchives points the broken links of a post content to their snapshots
+func (s *ArchiveService) UseArchives(ctx context.Context, content string) string {
+	archives, err := s.FindBrokenArchives(ctx, ExtractLinks(content))
+	if err != nil {
+		log.Printf("error finding link archives: %v", err)
+		return content
+	}
+	return ReplaceLinks(content, archives)
+}
+
+// ReplaceLinks rewrites the href of the links found in replacements
+func ReplaceLinks(content string, replacements map[string]string) string {
+	if len(replacements) == 0 {
+		return content
+	}
+	return externalLinkRegex.ReplaceAllStringFunc(content, func(href string) string {
+		link := externalLinkRegex.FindStringSubmatch(href)[1]
+		replacement, ok := replacements[html.UnescapeString(link)]
+		if !ok {
+			return href
+		}
+		return `href="` + replacement + `" data-original-href="` + link + `"`
+	})
+}
+
+func (s *ArchiveService) findArchived(ctx context.Context, links []string) (map[string]bool, error) {
+	var urls []string
+	linksJSON, _ := json.Marshal(links)
+	err := s.reader.SelectContext(ctx, &urls,
+		`SELECT url FROM link_archives WHERE url IN (SELECT value FROM json_each(?))`, string(linksJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	archived := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		archived[u] = true
+	}
+	return archived, nil
+}
+
+// allowed checks robots.txt of the host, a missing or unreadable robots.txt allows everything
+func (s *ArchiveService) allowed(ctx context.Context, u *url.URL) bool {
+	origin := u.Scheme + "://" + u.Host
+	rules, ok := s.robots.Get(origin)
+	if !ok {
+		rules = s.fetchRobots(ctx, origin)
+		s.robots.Set(origin, rules)
+	}
+	return rules.Allowed(u.RequestURI())
+}
+
+func (s *ArchiveService) fetchRobots(ctx context.Context, origin string) *robots.Rules {
+	empty := &robots.Rules{}
+
+	resp, err := s.get(ctx, origin+"/robots.txt")
+	if err != nil {
+		return empty
+	}
+	defer resp.Body.Close()
+
+	rules, err := robots.Parse(io.LimitReader(resp.Body, maxRobotsSize), s.config.UserAgent)
+	if err != nil {
+		return empty
+	}
+	return rules
+}
+
+func (s *ArchiveService) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", s.config.UserAgent)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+)
+
+func TestArchive(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><body><p>Snapshot</p></body></html>"))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(strings.Repeat("x", 2048)))
+	})
+	mux.HandleFunc("/private/page", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the disallowed page not to be fetched")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	basePath := t.TempDir()
+	upload := &config.UploadConfig{BaseURL: "/uploads", BasePath: basePath, ThumbWidth: 16}
+	uploads := NewUploadService(upload, NewImagePool(upload))
+	service := NewArchiveService(db, uploads, &config.ArchiveConfig{
+		Enabled:     true,
+		Timeout:     5 * time.Second,
+		MaxPageSize: 1024,
+		UserAgent:   "test",
+	})
+
+	ctx := context.Background()
+	page := server.URL + "/page"
+	content := `<p><a href="` + page + `">page</a> <a href="` + server.URL + `/private/page">private</a> ` +
+		`<a href="` + server.URL + `/large">large</a></p>`
+	service.ArchiveLinks(ctx, content)
+
+	var hashes []string
+	if err := db.Select(&hashes, "SELECT hash FROM link_archives"); err != nil {
+		t.Fatalf("failed to query archives: %v", err)
+	}
+	if len(hashes) != 1 {
+		t.Fatalf("expected only the allowed page to be archived, got %d archives", len(hashes))
+	}
+	if _, err := os.Stat(filepath.Join(basePath, ArchiveDir, hashes[0]+".html")); err != nil {
+		t.Errorf("expected the snapshot to be stored: %v", err)
+	}
+
+	if err := service.Archive(ctx, server.URL+"/private/page"); !errors.Is(err, ErrArchiveDisallowed) {
+		t.Errorf("expected ErrArchiveDisallowed, got %v", err)
+	}
+	if err := service.Archive(ctx, server.URL+"/large"); !errors.Is(err, ErrClipTooLarge) {
+		t.Errorf("expected ErrClipTooLarge, got %v", err)
+	}
+
+	// Links are served from their snapshot only once they are broken
+	if rewritten := service.UseArchives(ctx, content); rewritten != content {
+		t.Errorf("expected live links to be kept, got %s", rewritten)
+	}
+	if err := NewLinkService(db).SaveCheck(ctx, page, 404, nil); err != nil {
+		t.Fatalf("SaveCheck failed: %v", err)
+	}
+	rewritten := service.UseArchives(ctx, content)
+	expected := `href="` + uploads.ArchiveURL(hashes[0]) + `" data-original-href="` + page + `"`
+	if !strings.Contains(rewritten, expected) {
+		t.Errorf("expected the broken link to point to its snapshot, got %s", rewritten)
+	}
+}
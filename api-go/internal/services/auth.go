@@ -1,18 +1,120 @@
 package services
 
-import "os"
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
 
-type AuthService struct{}
+	"github.com/cymoo/mote/internal/config"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/redis/go-redis/v9"
+)
 
-func NewAuthService() *AuthService {
-	return &AuthService{}
+type AuthService struct {
+	client *redis.Client
+	config *config.AuthConfig
+}
+
+func NewAuthService(client *redis.Client, config *config.AuthConfig) *AuthService {
+	return &AuthService{client: client, config: config}
 }
 
 // IsValidToken checks if the provided token matches the password set in the environment variable
+// The comparison takes constant time, so the password can't be guessed from response timing
 func (s *AuthService) IsValidToken(token string) bool {
 	password := os.Getenv("MOTE_PASSWORD")
 	if password == "" {
 		panic("password is not set")
 	}
-	return token == password
+
+	// Compare digests, so that the length of the password doesn't leak either
+	tokenDigest := sha256.Sum256([]byte(token))
+	passwordDigest := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(tokenDigest[:], passwordDigest[:]) == 1
+}
+
+// LockoutRemaining returns how long the given IP stays locked out, or 0 if it is not locked out
+func (s *AuthService) LockoutRemaining(ctx context.Context, ip string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, s.lockoutKey(ip)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// PTTL returns a negative duration if the key doesn't exist
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// RecordFailure counts a failed authentication attempt from the given IP
+// The IP is locked out once it reaches the maximum number of failures within the window
+// It returns true if the IP is now locked out
+func (s *AuthService) RecordFailure(ctx context.Context, ip string) (bool, error) {
+	key := s.failuresKey(ip)
+
+	pipe := s.client.Pipeline()
+	incrCmd := pipe.Incr(ctx, key)
+	// Only start the window on the first failure
+	pipe.ExpireNX(ctx, key, s.config.FailureWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("redis pipeline error: %w", err)
+	}
+
+	if incrCmd.Val() < int64(s.config.MaxFailures) {
+		return false, nil
+	}
+
+	pipe = s.client.Pipeline()
+	pipe.Set(ctx, s.lockoutKey(ip), 1, s.config.LockoutDuration)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return true, nil
+}
+
+// RecordRequestFailure logs a failed authentication attempt with its request ID and counts it against the client IP
+func (s *AuthService) RecordRequestFailure(r *http.Request) {
+	ip := ClientIP(r)
+	requestID := middleware.GetReqID(r.Context())
+
+	locked, err := s.RecordFailure(r.Context(), ip)
+	if err != nil {
+		log.Printf("error recording auth failure: %v", err)
+	}
+
+	if locked {
+		log.Printf("auth failure: request_id=%s ip=%s path=%s, ip is locked out", requestID, ip, r.URL.Path)
+	} else {
+		log.Printf("auth failure: request_id=%s ip=%s path=%s", requestID, ip, r.URL.Path)
+	}
+}
+
+// ResetFailures clears the failed attempts of the given IP after a successful authentication
+func (s *AuthService) ResetFailures(ctx context.Context, ip string) error {
+	return s.client.Del(ctx, s.failuresKey(ip)).Err()
+}
+
+func (s *AuthService) failuresKey(ip string) string {
+	return "auth:failures:" + ip
+}
+
+func (s *AuthService) lockoutKey(ip string) string {
+	return "auth:lockout:" + ip
+}
+
+// ClientIP returns the IP address of the client, without the port
+// It relies on middleware.RealIP to rewrite RemoteAddr when running behind a trusted proxy
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -0,0 +1,25 @@
+package services
+
+import "testing"
+
+func TestIsValidToken(t *testing.T) {
+	t.Setenv("MOTE_PASSWORD", "secret")
+	service := NewAuthService(nil, nil)
+
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{"secret", true},
+		{"Secret", false},
+		{"secre", false},
+		{"secret ", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := service.IsValidToken(tt.token); got != tt.want {
+			t.Errorf("IsValidToken(%q) = %v; want %v", tt.token, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+// Backup writes a consistent copy of the database into dir and returns its path
+// The copy is made with VACUUM INTO, so it is compacted and readers and writers are not blocked.
+func Backup(ctx context.Context, db *DB, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(dir, "backup-"+time.Now().Format("20060102-150405")+".db")
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("backup %s already exists", path)
+	}
+
+	err := WithCheckpoints(ctx, db, "backup", func() error {
+		_, err := db.ExecContext(ctx, "VACUUM INTO ?", path)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("backup failed: %w", err)
+	}
+
+	if err := NewActivityService(db).Record(ctx, models.ActivityBackupTaken, filepath.Base(path)); err != nil {
+		log.Printf("error recording backup activity: %v", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	createTestPost(t, db, "<p>backed up</p>", nil)
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	path, err := Backup(context.Background(), db, dir)
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if filepath.Dir(path) != dir {
+		t.Errorf("expected the backup in %s, got %s", dir, path)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Errorf("expected a non-empty backup file: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CheckpointResult is the outcome of a WAL checkpoint
+type CheckpointResult struct {
+	// Busy is 1 if the checkpoint could not complete because of concurrent readers or writers
+	Busy int `json:"busy" db:"busy"`
+	// Log is the number of frames in the WAL, Checkpointed the number copied into the database
+	Log          int `json:"log" db:"log"`
+	Checkpointed int `json:"checkpointed" db:"checkpointed"`
+}
+
+// CheckpointEvent is emitted before and after a heavy write operation, once the WAL is checkpointed
+// Continuous-backup tools can snapshot the database at these consistent points.
+type CheckpointEvent struct {
+	Operation  string            `json:"operation"`
+	Phase      string            `json:"phase"` // "before" or "after"
+	Time       int64             `json:"time"`
+	Checkpoint *CheckpointResult `json:"checkpoint,omitempty"`
+	// Error is the error of the checkpoint or, after the operation, of the operation itself
+	Error string `json:"error,omitempty"`
+}
+
+// CheckpointHook receives the checkpoint events
+type CheckpointHook func(ctx context.Context, event CheckpointEvent)
+
+var (
+	checkpointHooksMu sync.RWMutex
+	checkpointHooks   []CheckpointHook
+)
+
+// OnCheckpoint registers a hook called with every checkpoint event
+func OnCheckpoint(hook CheckpointHook) {
+	checkpointHooksMu.Lock()
+	defer checkpointHooksMu.Unlock()
+	checkpointHooks = append(checkpointHooks, hook)
+}
+
+// Checkpoint copies the WAL into the database and truncates it
+// It waits for the write queue, so that no write of this process is in flight.
+func Checkpoint(ctx context.Context, db *DB) (*CheckpointResult, error) {
+	release, err := db.writes.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var result CheckpointResult
+	if err := db.GetContext(ctx, &result, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return nil, fmt.Errorf("wal checkpoint failed: %w", err)
+	}
+	return &result, nil
+}
+
+// WithCheckpoints runs a heavy write operation between two checkpoints, emitting an event after each
+// A failed checkpoint is reported in the event but does not prevent the operation.
+func WithCheckpoints(ctx context.Context, db *DB, operation string, fn func() error) error {
+	emitCheckpoint(ctx, db, operation, "before", nil)
+	err := fn()
+	emitCheckpoint(ctx, db, operation, "after", err)
+	return err
+}
+
+func emitCheckpoint(ctx context.Context, db *DB, operation, phase string, opErr error) {
+	result, err := Checkpoint(ctx, db)
+	event := CheckpointEvent{
+		Operation:  operation,
+		Phase:      phase,
+		Time:       time.Now().UnixMilli(),
+		Checkpoint: result,
+	}
+	if opErr != nil {
+		event.Error = opErr.Error()
+	} else if err != nil {
+		event.Error = err.Error()
+	}
+
+	checkpointHooksMu.RLock()
+	hooks := checkpointHooks
+	checkpointHooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(ctx, event)
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWithCheckpoints(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var events []CheckpointEvent
+	OnCheckpoint(func(ctx context.Context, event CheckpointEvent) {
+		if event.Operation == "test-checkpoints" {
+			events = append(events, event)
+		}
+	})
+
+	errFailed := errors.New("failed")
+	ran := false
+	err := WithCheckpoints(context.Background(), db, "test-checkpoints", func() error {
+		ran = true
+		if len(events) != 1 || events[0].Phase != "before" {
+			t.Errorf("expected the before event to be emitted first, got %+v", events)
+		}
+		return errFailed
+	})
+
+	if !ran {
+		t.Fatal("expected the operation to run")
+	}
+	if err != errFailed {
+		t.Errorf("expected the error of the operation, got %v", err)
+	}
+	if len(events) != 2 || events[1].Phase != "after" {
+		t.Fatalf("expected before and after events, got %+v", events)
+	}
+	if events[1].Error != "failed" {
+		t.Errorf("expected the after event to report the error, got %q", events[1].Error)
+	}
+}
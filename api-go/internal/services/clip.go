@@ -0,0 +1,186 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/pkg/util/readability"
+	"golang.org/x/net/html/charset"
+)
+
+var (
+	ErrInvalidClipURL  = errors.New("invalid URL, expected an http or https URL")
+	ErrClipSource      = errors.New("a URL or the HTML of a page is required")
+	ErrClipTooLarge    = errors.New("page is too large")
+	ErrClipFetchFailed = errors.New("failed to fetch the page")
+	ErrClipEmpty       = errors.New("no readable content found")
+)
+
+// ClipService turns web pages into posts
+type ClipService struct {
+	uploads *UploadService
+	config  *config.ClipConfig
+	client  *http.Client
+}
+
+func NewClipService(uploads *UploadService, config *config.ClipConfig) *ClipService {
+	return &ClipService{
+		uploads: uploads,
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// Clip extracts the readable content of a page into a post
+// The page is fetched unless its HTML is given. Its images are downloaded and attached to the post,
+// and a link to the source is appended to the content.
+func (s *ClipService) Clip(ctx context.Context, req models.ClipRequest) (*models.CreatePostRequest, error) {
+	var base *url.URL
+	if req.URL != "" {
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, ErrInvalidClipURL
+		}
+		base = u
+	}
+
+	var page io.Reader
+	switch {
+	case req.HTML != "":
+		page = strings.NewReader(req.HTML)
+	case base != nil:
+		body, err := s.fetchPage(ctx, base)
+		if err != nil {
+			return nil, err
+		}
+		page = body
+	default:
+		return nil, ErrClipSource
+	}
+
+	article, err := readability.Extract(page, base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the page: %w", err)
+	}
+	if article.Content == "" {
+		return nil, ErrClipEmpty
+	}
+
+	var content strings.Builder
+	if article.Title != "" {
+		content.WriteString("<h1>" + html.EscapeString(article.Title) + "</h1>")
+	}
+	content.WriteString(article.Content)
+	if base != nil {
+		source := html.EscapeString(base.String())
+		content.WriteString(`<p>Source: <a href="` + source + `">` + source + `</a></p>`)
+	}
+
+	files := []models.FileInfo{}
+	for i, image := range article.Images {
+		if i >= s.config.MaxImages {
+			break
+		}
+		file, err := s.fetchImage(ctx, image)
+		if err != nil {
+			log.Printf("error clipping image %s: %v", image, err)
+			continue
+		}
+		files = append(files, *file)
+	}
+
+	return &models.CreatePostRequest{Content: content.String(), Files: files}, nil
+}
+
+// fetchPage downloads a page and returns its HTML decoded to UTF-8
+func (s *ClipService) fetchPage(ctx context.Context, u *url.URL) (io.Reader, error) {
+	resp, err := s.get(ctx, u.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClipFetchFailed, err)
+	}
+	defer resp.Body.Close()
+
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "" &&
+		mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("%w: unsupported content type %s", ErrClipFetchFailed, mediaType)
+	}
+
+	data, err := readLimited(resp.Body, s.config.MaxPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := charset.NewReader(bytes.NewReader(data), contentType)
+	if err != nil {
+		return bytes.NewReader(data), nil
+	}
+	return page, nil
+}
+
+// fetchImage downloads an image and stores it with the uploads
+func (s *ClipService) fetchImage(ctx context.Context, image string) (*models.FileInfo, error) {
+	resp, err := s.get(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	data, err := readLimited(resp.Body, s.config.MaxImageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	name := path.Base(resp.Request.URL.Path)
+	if name == "/" || name == "." {
+		name = "image"
+	}
+	return s.uploads.SaveFile(ctx, name, contentType, bytes.NewReader(data))
+}
+
+func (s *ClipService) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", s.config.UserAgent)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// readLimited reads a body of at most limit bytes
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClipFetchFailed, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrClipTooLarge, limit)
+	}
+	return data, nil
+}
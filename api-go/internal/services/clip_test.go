@@ -0,0 +1,98 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+)
+
+func newTestClipService(t *testing.T) *ClipService {
+	upload := &config.UploadConfig{
+		BaseURL:      "/uploads",
+		BasePath:     t.TempDir(),
+		ImageFormats: []string{"png"},
+		ThumbWidth:   16,
+	}
+	uploads := NewUploadService(upload, NewImagePool(upload))
+	return NewClipService(uploads, &config.ClipConfig{
+		Timeout:      5 * time.Second,
+		MaxPageSize:  1024,
+		MaxImages:    1,
+		MaxImageSize: 1024 * 1024,
+		UserAgent:    "test",
+	})
+}
+
+func TestClipFetchesPageAndImages(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>A <page></title></head><body><article>
+			<p>Clipped text with enough words to be content.</p>
+			<img src="/a.png"><img src="/b.png">
+		</article></body></html>`))
+	})
+	mux.HandleFunc("/a.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(buf.Bytes())
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	service := newTestClipService(t)
+	req, err := service.Clip(context.Background(), models.ClipRequest{URL: server.URL + "/article"})
+	if err != nil {
+		t.Fatalf("Clip failed: %v", err)
+	}
+
+	if !strings.HasPrefix(req.Content, "<h1>A &lt;page&gt;</h1><p>Clipped text") {
+		t.Errorf("unexpected content: %s", req.Content)
+	}
+	if !strings.HasSuffix(req.Content, `<p>Source: <a href="`+server.URL+`/article">`+server.URL+`/article</a></p>`) {
+		t.Errorf("expected the source link, got %s", req.Content)
+	}
+	// The second image is beyond the limit
+	if len(req.Files) != 1 || req.Files[0].ThumbURL == nil {
+		t.Errorf("expected the first image to be stored, got %+v", req.Files)
+	}
+}
+
+func TestClipErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(strings.Repeat("<p>long</p>", 200)))
+	}))
+	defer server.Close()
+
+	service := newTestClipService(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		req  models.ClipRequest
+		want error
+	}{
+		{models.ClipRequest{}, ErrClipSource},
+		{models.ClipRequest{URL: "file:///etc/passwd"}, ErrInvalidClipURL},
+		{models.ClipRequest{URL: server.URL}, ErrClipTooLarge},
+		{models.ClipRequest{URL: server.URL + "/x", HTML: "<html><body></body></html>"}, ErrClipEmpty},
+	}
+
+	for _, tt := range tests {
+		if _, err := service.Clip(ctx, tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("Clip(%+v) = %v, want %v", tt.req, err, tt.want)
+		}
+	}
+}
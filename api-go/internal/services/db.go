@@ -0,0 +1,39 @@
+package services
+
+import (
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DB is a database with what the services built on it share: the queue serializing its writes, the handle to read
+// from, and the count of the writes of posts and tags, see StatsCache
+// The services of a database must be built on the same DB, so that their writes wait for each other.
+type DB struct {
+	*sqlx.DB
+	reader  *sqlx.DB
+	writes  *WriteQueue
+	changes *atomic.Int64
+}
+
+// NewDB returns the DB of a database, which reads from it until UseReadReplica is called
+func NewDB(db *sqlx.DB) *DB {
+	return &DB{DB: db, reader: db, writes: newWriteQueue(), changes: &atomic.Int64{}}
+}
+
+// UseReadReplica makes the services built on the DB afterwards run their read queries against replica
+// The replica may be a litestream replica or the same file opened read-only. Reads that must
+// observe the latest writes, such as those within write paths and consistency checks, stay on the database.
+func (db *DB) UseReadReplica(replica *sqlx.DB) {
+	db.reader = replica
+}
+
+// Reader returns the handle to read from, the replica if one is used or the database itself
+func (db *DB) Reader() *sqlx.DB {
+	return db.reader
+}
+
+// WriteQueue returns the queue serializing the writes to the database
+func (db *DB) WriteQueue() *WriteQueue {
+	return db.writes
+}
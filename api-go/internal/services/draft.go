@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxDraftKeyLength is the maximum length of the key of a draft, in bytes
+const maxDraftKeyLength = 100
+
+var (
+	// ErrDraftNotFound is returned when a draft does not exist or expired
+	ErrDraftNotFound = errors.New("draft not found")
+	// ErrInvalidDraftKey is returned for an empty or too long key
+	ErrInvalidDraftKey = errors.New("invalid draft key")
+)
+
+// DraftService keeps the drafts autosaved by the editor, until they expire ttl after their last save
+// Expired drafts are no longer returned, and deleted by PurgeExpired.
+type DraftService struct {
+	db     *DB
+	reader *sqlx.DB
+	writes *WriteQueue
+	ttl    time.Duration
+}
+
+func NewDraftService(db *DB, ttl time.Duration) *DraftService {
+	return &DraftService{db: db, reader: db.reader, writes: db.writes, ttl: ttl}
+}
+
+// Save saves a draft, replacing the one with the same key, and returns it
+// It returns an error wrapping ErrInvalidDraftKey for an empty or too long key.
+func (s *DraftService) Save(ctx context.Context, req models.SaveDraftRequest) (*models.Draft, error) {
+	if req.Key == "" || len(req.Key) > maxDraftKeyLength {
+		return nil, fmt.Errorf("%w: it must have 1 to %d characters", ErrInvalidDraftKey, maxDraftKeyLength)
+	}
+
+	now := time.Now()
+	draft := &models.Draft{
+		Key:       req.Key,
+		Content:   req.Content,
+		UpdatedAt: now.UnixMilli(),
+		ExpiresAt: now.Add(s.ttl).UnixMilli(),
+	}
+	if req.PostID != nil {
+		draft.PostID = models.NullInt64{NullInt64: sql.NullInt64{Int64: *req.PostID, Valid: true}}
+	}
+
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query := `
+		INSERT INTO drafts (key, content, post_id, updated_at, expires_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			content = excluded.content, post_id = excluded.post_id,
+			updated_at = excluded.updated_at, expires_at = excluded.expires_at
+	`
+	_, err = execerFor(ctx, s.db).ExecContext(ctx, query, draft.Key, draft.Content, draft.PostID, draft.UpdatedAt, draft.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// Get returns a draft, or ErrDraftNotFound if it doesn't exist or expired
+func (s *DraftService) Get(ctx context.Context, key string) (*models.Draft, error) {
+	var draft models.Draft
+	err := s.reader.GetContext(ctx, &draft,
+		"SELECT * FROM drafts WHERE key = ? AND expires_at > ?", key, time.Now().UnixMilli())
+	if err == sql.ErrNoRows {
+		return nil, ErrDraftNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &draft, nil
+}
+
+// List returns the drafts that didn't expire, the last saved first
+// The editor lists them after a crash, to restore the content that wasn't saved as a post.
+func (s *DraftService) List(ctx context.Context) ([]models.Draft, error) {
+	drafts := make([]models.Draft, 0)
+	err := s.reader.SelectContext(ctx, &drafts,
+		"SELECT * FROM drafts WHERE expires_at > ? ORDER BY updated_at DESC", time.Now().UnixMilli())
+	return drafts, err
+}
+
+// Delete deletes a draft, e.g. once saved as a post, deleting a draft that doesn't exist is not an error
+func (s *DraftService) Delete(ctx context.Context, key string) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = execerFor(ctx, s.db).ExecContext(ctx, "DELETE FROM drafts WHERE key = ?", key)
+	return err
+}
+
+// PurgeExpired deletes the expired drafts and returns their count
+func (s *DraftService) PurgeExpired(ctx context.Context) (int64, error) {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	result, err := execerFor(ctx, s.db).ExecContext(ctx, "DELETE FROM drafts WHERE expires_at <= ?", time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
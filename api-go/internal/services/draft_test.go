@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+func TestDrafts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	drafts := NewDraftService(db, time.Hour)
+
+	postID := int64(42)
+	if _, err := drafts.Save(ctx, models.SaveDraftRequest{Key: "new", Content: "first"}); err != nil {
+		t.Fatalf("failed to save draft: %v", err)
+	}
+	if _, err := drafts.Save(ctx, models.SaveDraftRequest{Key: "post-42", Content: "edit", PostID: &postID}); err != nil {
+		t.Fatalf("failed to save draft: %v", err)
+	}
+	// Saving again replaces the draft
+	time.Sleep(2 * time.Millisecond)
+	if _, err := drafts.Save(ctx, models.SaveDraftRequest{Key: "new", Content: "second"}); err != nil {
+		t.Fatalf("failed to save draft: %v", err)
+	}
+
+	draft, err := drafts.Get(ctx, "new")
+	if err != nil || draft.Content != "second" || draft.PostID.Valid || draft.ExpiresAt <= draft.UpdatedAt {
+		t.Errorf("expected the last save of the draft, got %+v: %v", draft, err)
+	}
+	list, err := drafts.List(ctx)
+	if err != nil || len(list) != 2 || list[0].Key != "new" || list[1].PostID.Int64 != postID {
+		t.Errorf("expected the drafts, the last saved first, got %+v: %v", list, err)
+	}
+
+	for _, key := range []string{"", strings.Repeat("k", maxDraftKeyLength+1)} {
+		if _, err := drafts.Save(ctx, models.SaveDraftRequest{Key: key}); !errors.Is(err, ErrInvalidDraftKey) {
+			t.Errorf("expected ErrInvalidDraftKey for %q, got %v", key, err)
+		}
+	}
+
+	if err := drafts.Delete(ctx, "new"); err != nil {
+		t.Fatalf("failed to delete draft: %v", err)
+	}
+	if _, err := drafts.Get(ctx, "new"); !errors.Is(err, ErrDraftNotFound) {
+		t.Errorf("expected ErrDraftNotFound, got %v", err)
+	}
+	if err := drafts.Delete(ctx, "new"); err != nil {
+		t.Errorf("expected deleting a missing draft to succeed, got %v", err)
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		expiring := NewDraftService(db, -time.Minute)
+		if _, err := expiring.Save(ctx, models.SaveDraftRequest{Key: "old", Content: "old"}); err != nil {
+			t.Fatalf("failed to save draft: %v", err)
+		}
+		if _, err := drafts.Get(ctx, "old"); !errors.Is(err, ErrDraftNotFound) {
+			t.Errorf("expected an expired draft to be missing, got %v", err)
+		}
+
+		count, err := drafts.PurgeExpired(ctx)
+		if err != nil || count != 1 {
+			t.Errorf("expected the expired draft to be purged, got %d: %v", count, err)
+		}
+		if list, _ := drafts.List(ctx); len(list) != 1 || list[0].Key != "post-42" {
+			t.Errorf("expected the other draft to be kept, got %+v", list)
+		}
+	})
+}
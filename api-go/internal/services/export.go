@@ -0,0 +1,299 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"filippo.io/age"
+	"github.com/cymoo/mote/internal/models"
+)
+
+// The entries of an encrypted export
+const (
+	exportDBEntry      = "mote.db"
+	exportUploadsDir   = "uploads/"
+	exportIndexEntry   = "fulltext.snapshot"
+	exportTempPattern  = "mote-export-*"
+	restoreTempPattern = ".restore-*"
+
+	// MinPassphraseLength is the length of the shortest passphrase an export is encrypted with
+	MinPassphraseLength = 8
+)
+
+var (
+	// ErrWeakPassphrase is returned when exporting with a passphrase shorter than MinPassphraseLength
+	ErrWeakPassphrase = fmt.Errorf("passphrase must be at least %d characters", MinPassphraseLength)
+	// ErrPassphrase is returned when restoring with the wrong passphrase
+	ErrPassphrase = errors.New("wrong passphrase")
+)
+
+// exportWorkFactor is the cost of deriving the key of an export from its passphrase, log2 of the N parameter of
+// scrypt, lower in tests
+var exportWorkFactor = 18
+
+// IndexSnapshotter writes and restores a snapshot of the full-text index, see fulltext.FullTextSearch
+type IndexSnapshotter interface {
+	Snapshot(ctx context.Context, w io.Writer) (int, error)
+	RestoreSnapshot(ctx context.Context, r io.Reader) (int, error)
+}
+
+// ExportReport counts what an encrypted export holds
+type ExportReport struct {
+	Files     int   `json:"files"`
+	Bytes     int64 `json:"bytes"`
+	IndexKeys int   `json:"index_keys"`
+}
+
+// Export writes an encrypted archive of the database, the uploaded files and the full-text index to w, e.g. for a
+// backup kept off-site, see Restore
+// The archive is a gzipped tar encrypted with the passphrase by age, so that it can also be decrypted with the age
+// command: it can't be read without it, and it can't be altered unnoticed. The index is skipped if nil, it can be rebuilt from the database anyway.
+func Export(ctx context.Context, db *DB, uploadDir string, index IndexSnapshotter, w io.Writer, passphrase string) (*ExportReport, error) {
+	if err := CheckPassphrase(passphrase); err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", exportTempPattern)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	recipient.SetWorkFactor(exportWorkFactor)
+	encrypted, err := age.Encrypt(w, recipient)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(encrypted)
+	archive := tar.NewWriter(gz)
+	report := &ExportReport{}
+
+	dbPath := filepath.Join(tmpDir, exportDBEntry)
+	err = WithCheckpoints(ctx, db, "export", func() error {
+		_, err := db.ExecContext(ctx, "VACUUM INTO ?", dbPath)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot the database: %w", err)
+	}
+	if err := addExportFile(archive, exportDBEntry, dbPath, report); err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(uploadDir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == uploadDir {
+			return fs.SkipAll
+		}
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(uploadDir, path)
+		if err != nil {
+			return err
+		}
+		return addExportFile(archive, exportUploadsDir+filepath.ToSlash(rel), path, report)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export the uploads: %w", err)
+	}
+
+	if index != nil {
+		// A tar entry needs its size first
+		snapshotPath := filepath.Join(tmpDir, exportIndexEntry)
+		if report.IndexKeys, err = snapshotIndex(ctx, index, snapshotPath); err != nil {
+			return nil, fmt.Errorf("failed to snapshot the full-text index: %w", err)
+		}
+		if err := addExportFile(archive, exportIndexEntry, snapshotPath, report); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range []io.Closer{archive, gz, encrypted} {
+		if err := c.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := NewActivityService(db).Record(ctx, models.ActivityBackupTaken, "encrypted export"); err != nil {
+		log.Printf("error recording export activity: %v", err)
+	}
+	return report, nil
+}
+
+// Restore replaces the database, and adds the uploaded files and the full-text index of an archive written by
+// Export, and returns what it held
+// The app must not be running. The database is replaced only once the whole archive is read and authenticated, but
+// the files and the index are restored as they are read: if the archive is corrupted, they are partly restored and the
+// database is left as is. A wrong passphrase returns ErrPassphrase before anything is restored.
+func Restore(ctx context.Context, r io.Reader, passphrase string, dbPath, uploadDir string, index IndexSnapshotter) (*ExportReport, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := age.Decrypt(r, identity)
+	if noMatch := (*age.NoIdentityMatchError)(nil); errors.As(err, &noMatch) {
+		return nil, ErrPassphrase
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	gz, err := gzip.NewReader(decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	archive := tar.NewReader(gz)
+	report := &ExportReport{}
+
+	var restoredDB string
+	defer func() {
+		if restoredDB != "" {
+			os.Remove(restoredDB)
+		}
+	}()
+
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		switch name := header.Name; {
+		case name == exportDBEntry:
+			if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+				return nil, err
+			}
+			if restoredDB, err = writeRestoredFile(filepath.Dir(dbPath), archive); err != nil {
+				return nil, fmt.Errorf("failed to restore the database: %w", err)
+			}
+		case strings.HasPrefix(name, exportUploadsDir):
+			rel := filepath.FromSlash(strings.TrimPrefix(name, exportUploadsDir))
+			if !filepath.IsLocal(rel) {
+				return nil, fmt.Errorf("invalid archive: unsafe path %s", name)
+			}
+			path := filepath.Join(uploadDir, rel)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return nil, err
+			}
+			tmp, err := writeRestoredFile(filepath.Dir(path), archive)
+			if err != nil {
+				return nil, fmt.Errorf("failed to restore %s: %w", name, err)
+			}
+			if err := os.Rename(tmp, path); err != nil {
+				os.Remove(tmp)
+				return nil, err
+			}
+		case name == exportIndexEntry:
+			if index == nil {
+				continue
+			}
+			if report.IndexKeys, err = index.RestoreSnapshot(ctx, archive); err != nil {
+				return nil, fmt.Errorf("failed to restore the full-text index: %w", err)
+			}
+		default:
+			continue
+		}
+		report.Files++
+		report.Bytes += header.Size
+	}
+
+	// The end of the tar may come before the end of the stream, which authenticates its last chunk
+	if _, err := io.Copy(io.Discard, decrypted); err != nil {
+		return nil, err
+	}
+	if restoredDB == "" {
+		return nil, errors.New("invalid archive: no database")
+	}
+	// The log of the replaced database mustn't be applied to the restored one
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if err := os.Rename(restoredDB, dbPath); err != nil {
+		return nil, fmt.Errorf("failed to replace the database: %w", err)
+	}
+	restoredDB = ""
+	return report, nil
+}
+
+// CheckPassphrase returns ErrWeakPassphrase if the passphrase is too short to encrypt an export with
+func CheckPassphrase(passphrase string) error {
+	if utf8.RuneCountInString(passphrase) < MinPassphraseLength {
+		return ErrWeakPassphrase
+	}
+	return nil
+}
+
+// addExportFile adds a file to the archive under the name
+func addExportFile(archive *tar.Writer, name, path string, report *ExportReport) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(archive, file); err != nil {
+		return fmt.Errorf("failed to export %s: %w", name, err)
+	}
+	report.Files++
+	report.Bytes += info.Size()
+	return nil
+}
+
+// snapshotIndex writes a snapshot of the index to a file, and returns the number of its keys
+func snapshotIndex(ctx context.Context, index IndexSnapshotter, path string) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := index.Snapshot(ctx, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// writeRestoredFile writes r to a temporary file in dir and returns its path, to be renamed once complete
+func writeRestoredFile(dir string, r io.Reader) (string, error) {
+	file, err := os.CreateTemp(dir, restoreTempPattern)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
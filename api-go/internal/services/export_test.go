@@ -0,0 +1,102 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// memoryIndex keeps a snapshot of the full-text index in memory
+type memoryIndex struct {
+	snapshot []byte
+}
+
+func (m *memoryIndex) Snapshot(ctx context.Context, w io.Writer) (int, error) {
+	_, err := w.Write(m.snapshot)
+	return 1, err
+}
+
+func (m *memoryIndex) RestoreSnapshot(ctx context.Context, r io.Reader) (int, error) {
+	var err error
+	m.snapshot, err = io.ReadAll(r)
+	return 1, err
+}
+
+func TestExportRestore(t *testing.T) {
+	exportWorkFactor = 10
+	db := setupTestDB(t)
+	ctx := context.Background()
+	createTestPost(t, db, "<p>exported</p>", nil)
+
+	uploadDir := filepath.Join(t.TempDir(), "uploads")
+	if err := os.MkdirAll(filepath.Join(uploadDir, "thumbs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(uploadDir, "a.png"), []byte("image"), 0644)
+	os.WriteFile(filepath.Join(uploadDir, "thumbs", "a.png"), []byte("thumb"), 0644)
+
+	var archive bytes.Buffer
+	if _, err := Export(ctx, db, uploadDir, nil, &archive, "short"); !errors.Is(err, ErrWeakPassphrase) {
+		t.Errorf("expected ErrWeakPassphrase with a short passphrase, got %v", err)
+	}
+	report, err := Export(ctx, db, uploadDir, &memoryIndex{snapshot: []byte("index")}, &archive, "correct horse")
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if report.Files != 4 || report.IndexKeys != 1 {
+		t.Errorf("expected 4 files and 1 index key exported, got %+v", report)
+	}
+	if bytes.Contains(archive.Bytes(), []byte("exported")) || !bytes.HasPrefix(archive.Bytes(), []byte("age-encryption.org/v1\n")) {
+		t.Error("expected the archive to be encrypted by age")
+	}
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "data", "app.db")
+	restoredUploads := filepath.Join(dir, "uploads")
+	index := &memoryIndex{}
+
+	if _, err := Restore(ctx, bytes.NewReader(archive.Bytes()), "wrong", dbPath, restoredUploads, index); !errors.Is(err, ErrPassphrase) {
+		t.Errorf("expected ErrPassphrase with a wrong passphrase, got %v", err)
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		t.Error("expected nothing restored with a wrong passphrase")
+	}
+
+	// The files of the vault are replaced
+	os.WriteFile(dbPath+"-wal", []byte("stale"), 0644)
+	report, err = Restore(ctx, bytes.NewReader(archive.Bytes()), "correct horse", dbPath, restoredUploads, index)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if report.Files != 4 {
+		t.Errorf("expected 4 files restored, got %+v", report)
+	}
+	if string(index.snapshot) != "index" {
+		t.Errorf("expected the index restored, got %q", index.snapshot)
+	}
+	if data, _ := os.ReadFile(filepath.Join(restoredUploads, "thumbs", "a.png")); string(data) != "thumb" {
+		t.Errorf("expected the uploads restored, got %q", data)
+	}
+	if _, err := os.Stat(dbPath + "-wal"); err == nil {
+		t.Error("expected the log of the replaced database removed")
+	}
+
+	restored, err := sqlx.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	var content string
+	if err := restored.Get(&content, "SELECT content FROM posts"); err != nil || content != "<p>exported</p>" {
+		t.Errorf("expected the post restored, got %q, %v", content, err)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, "data", restoreTempPattern)); len(entries) != 0 {
+		t.Errorf("expected no temporary files left, got %v", entries)
+	}
+}
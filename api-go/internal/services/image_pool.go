@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+)
+
+// ErrImagePoolBusy is returned when an image can't be processed because all workers are busy and the queue is full,
+// or because it waited too long for a worker
+var ErrImagePoolBusy = errors.New("too many images are being processed, retry later")
+
+// ImagePool bounds the number of images decoded, rotated and thumbnailed at once
+// Each image takes a worker for the time of its processing. Parallel uploads otherwise spike the CPU and memory,
+// an image being decoded to its full size. The callers waiting for a worker are bounded too, so that a burst is
+// turned away early instead of piling up requests that would time out anyway.
+type ImagePool struct {
+	workers      chan struct{}
+	queueSize    int64
+	queueTimeout time.Duration
+
+	queued    atomic.Int64
+	completed atomic.Int64
+	rejected  atomic.Int64
+	waitTotal atomic.Int64 // nanoseconds
+	waitMax   atomic.Int64 // nanoseconds
+}
+
+// NewImagePool creates the image pool of the upload settings
+// The app creates one and shares it between all the services storing uploads, so that they share its bounds.
+func NewImagePool(config *config.UploadConfig) *ImagePool {
+	return newImagePool(config.ImageWorkers, config.ImageQueueSize, config.ImageQueueTimeout)
+}
+
+// newImagePool creates a pool of workers, one per CPU if workers is not positive
+// At most queueSize callers wait for a worker, each for queueTimeout at most, or until its context is done if
+// queueTimeout is 0.
+func newImagePool(workers, queueSize int, queueTimeout time.Duration) *ImagePool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &ImagePool{
+		workers:      make(chan struct{}, workers),
+		queueSize:    int64(max(queueSize, 0)),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Acquire waits for a worker, and returns ErrImagePoolBusy if the queue is full or the wait times out
+// The returned function must be called once the image is processed.
+func (p *ImagePool) Acquire(ctx context.Context) (func(), error) {
+	start := time.Now()
+	select {
+	case p.workers <- struct{}{}:
+	default:
+		if p.queued.Add(1) > p.queueSize {
+			p.queued.Add(-1)
+			p.rejected.Add(1)
+			return nil, ErrImagePoolBusy
+		}
+		err := p.wait(ctx)
+		p.queued.Add(-1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	wait := int64(time.Since(start))
+	p.waitTotal.Add(wait)
+	for {
+		current := p.waitMax.Load()
+		if wait <= current || p.waitMax.CompareAndSwap(current, wait) {
+			break
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-p.workers
+			p.completed.Add(1)
+		})
+	}, nil
+}
+
+func (p *ImagePool) wait(ctx context.Context) error {
+	var timeout <-chan time.Time
+	if p.queueTimeout > 0 {
+		timer := time.NewTimer(p.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case p.workers <- struct{}{}:
+		return nil
+	case <-timeout:
+		p.rejected.Add(1)
+		return ErrImagePoolBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the metrics of the pool
+func (p *ImagePool) Stats() models.ImagePoolStats {
+	stats := models.ImagePoolStats{
+		Workers:   cap(p.workers),
+		Active:    len(p.workers),
+		Queued:    p.queued.Load(),
+		QueueSize: p.queueSize,
+		Completed: p.completed.Load(),
+		Rejected:  p.rejected.Load(),
+		WaitMax:   float64(p.waitMax.Load()) / float64(time.Millisecond),
+	}
+	if stats.Completed > 0 {
+		stats.WaitAvg = float64(p.waitTotal.Load()) / float64(stats.Completed) / float64(time.Millisecond)
+	}
+	return stats
+}
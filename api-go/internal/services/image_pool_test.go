@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+)
+
+func TestImagePoolBoundsWorkers(t *testing.T) {
+	p := newImagePool(2, 10, 0)
+	ctx := context.Background()
+
+	var active, maxActive atomic.Int64
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := p.Acquire(ctx)
+			if err != nil {
+				t.Errorf("Acquire failed: %v", err)
+				return
+			}
+			defer release()
+
+			n := active.Add(1)
+			for {
+				current := maxActive.Load()
+				if n <= current || maxActive.CompareAndSwap(current, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			active.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if maxActive.Load() > 2 {
+		t.Errorf("expected at most 2 images at once, got %d", maxActive.Load())
+	}
+	stats := p.Stats()
+	if stats.Completed != 8 || stats.Active != 0 || stats.Queued != 0 || stats.Rejected != 0 || stats.Workers != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestImagePoolRejectsWhenSaturated(t *testing.T) {
+	p := newImagePool(1, 1, 0)
+
+	release, _ := p.Acquire(context.Background())
+
+	// The only place of the queue is taken by a waiting caller
+	acquired := make(chan error)
+	go func() {
+		release, err := p.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	for p.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := p.Acquire(context.Background()); !errors.Is(err, ErrImagePoolBusy) {
+		t.Errorf("expected ErrImagePoolBusy with a full queue, got %v", err)
+	}
+	if stats := p.Stats(); stats.Rejected != 1 || stats.Active != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	release()
+	if err := <-acquired; err != nil {
+		t.Errorf("expected the waiting caller to get the worker, got %v", err)
+	}
+}
+
+func TestImagePoolQueueTimeout(t *testing.T) {
+	p := newImagePool(1, 5, 10*time.Millisecond)
+
+	release, _ := p.Acquire(context.Background())
+	defer release()
+
+	if _, err := p.Acquire(context.Background()); !errors.Is(err, ErrImagePoolBusy) {
+		t.Errorf("expected ErrImagePoolBusy after the queue timeout, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+	if stats := p.Stats(); stats.Queued != 0 || stats.Rejected != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestSaveFileWhenImagePoolBusy(t *testing.T) {
+	upload := &config.UploadConfig{
+		BaseURL: "/uploads", BasePath: t.TempDir(), ImageFormats: []string{"png"}, ThumbWidth: 16, ImageWorkers: 1,
+	}
+	uploads := NewUploadService(upload, NewImagePool(upload))
+
+	release, _ := uploads.images.Acquire(context.Background())
+	defer release()
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 32, 32)))
+	if _, err := uploads.SaveFile(context.Background(), "busy.png", "", &buf); !errors.Is(err, ErrImagePoolBusy) {
+		t.Fatalf("expected ErrImagePoolBusy, got %v", err)
+	}
+	if entries, _ := os.ReadDir(upload.BasePath); len(entries) != 0 {
+		t.Errorf("expected the refused image not to be kept, got %d files", len(entries))
+	}
+
+	// Other files don't need a worker
+	if _, err := uploads.SaveFile(context.Background(), "notes.txt", "", bytes.NewReader([]byte("notes"))); err != nil {
+		t.Errorf("failed to save file: %v", err)
+	}
+}
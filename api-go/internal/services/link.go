@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+var externalLinkRegex = regexp.MustCompile(`href="(https?://[^"]+)"`)
+
+// ExtractLinks returns the external links of HTML content, without duplicates
+func ExtractLinks(content string) []string {
+	var links []string
+	seen := map[string]bool{}
+	for _, m := range externalLinkRegex.FindAllStringSubmatch(content, -1) {
+		link := html.UnescapeString(m[1])
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// IsBrokenStatus reports whether the status of a link check means the link is broken
+// A status of 0 means the request failed.
+func IsBrokenStatus(status int) bool {
+	return status == 0 || status >= 400
+}
+
+// CheckLink requests a link and returns its HTTP status
+// Servers that don't support HEAD requests are sent a GET request instead.
+func CheckLink(ctx context.Context, client *http.Client, userAgent, link string) (int, error) {
+	status, err := requestLink(ctx, client, http.MethodHead, userAgent, link)
+	if err == nil && status != http.StatusMethodNotAllowed && status != http.StatusForbidden &&
+		status != http.StatusNotImplemented {
+		return status, nil
+	}
+	return requestLink(ctx, client, http.MethodGet, userAgent, link)
+}
+
+func requestLink(ctx context.Context, client *http.Client, method, userAgent, link string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return resp.StatusCode, nil
+}
+
+// LinkService keeps the checks of the external links found in posts
+type LinkService struct {
+	db     *DB
+	reader *sqlx.DB
+	writes *WriteQueue
+}
+
+func NewLinkService(db *DB) *LinkService {
+	return &LinkService{db: db, reader: db.reader, writes: db.writes}
+}
+
+// FindLinks returns the external links of non-deleted posts
+func (s *LinkService) FindLinks(ctx context.Context) ([]string, error) {
+	query := `SELECT content FROM posts WHERE deleted_at IS NULL AND content LIKE '%href="http%'`
+
+	rows, err := s.reader.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []string
+	seen := map[string]bool{}
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			return nil, err
+		}
+		for _, link := range ExtractLinks(content) {
+			if !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+	return links, rows.Err()
+}
+
+// DueForCheck returns at most limit links never checked or last checked before the given time
+// Links never checked come first, then the least recently checked ones.
+func (s *LinkService) DueForCheck(ctx context.Context, links []string, before int64, limit int) ([]string, error) {
+	if len(links) == 0 {
+		return []string{}, nil
+	}
+
+	linksJSON, _ := json.Marshal(links)
+	query := `
+		SELECT l.value
+		FROM json_each(?) l
+		LEFT JOIN link_checks c ON c.url = l.value
+		WHERE c.checked_at IS NULL OR c.checked_at < ?
+		ORDER BY c.checked_at IS NOT NULL, c.checked_at
+		LIMIT ?
+	`
+
+	due := []string{}
+	err := s.reader.SelectContext(ctx, &due, query, string(linksJSON), before, limit)
+	return due, err
+}
+
+// SaveCheck records the status of a link, 0 if the request failed with checkErr
+func (s *LinkService) SaveCheck(ctx context.Context, link string, status int, checkErr error) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	now := time.Now().UnixMilli()
+	failures := 0
+	var failingSince *int64
+	if IsBrokenStatus(status) {
+		failures = 1
+		failingSince = &now
+	}
+
+	var errorText *string
+	if checkErr != nil {
+		text := checkErr.Error()
+		errorText = &text
+	}
+
+	query := `
+		INSERT INTO link_checks (url, status, error, failures, checked_at, failing_since)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET
+			status = excluded.status,
+			error = excluded.error,
+			failures = CASE WHEN excluded.failures = 0 THEN 0 ELSE link_checks.failures + 1 END,
+			checked_at = excluded.checked_at,
+			failing_since = CASE
+				WHEN excluded.failures = 0 THEN NULL
+				ELSE COALESCE(link_checks.failing_since, excluded.failing_since)
+			END
+	`
+	_, err = execerFor(ctx, s.db).ExecContext(ctx, query, link, status, errorText, failures, now, failingSince)
+	return err
+}
+
+// PruneChecks deletes the checks of links no longer found in any post
+func (s *LinkService) PruneChecks(ctx context.Context, links []string) (int64, error) {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	linksJSON, _ := json.Marshal(links)
+	result, err := execerFor(ctx, s.db).ExecContext(ctx,
+		`DELETE FROM link_checks WHERE url NOT IN (SELECT value FROM json_each(?))`, string(linksJSON))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// FindBroken returns the links whose last check failed, with the non-deleted posts containing them
+// Links failing the longest come first.
+func (s *LinkService) FindBroken(ctx context.Context) ([]models.BrokenLink, error) {
+	query := `
+		SELECT url, status, error, failures, checked_at, failing_since
+		FROM link_checks
+		WHERE failures > 0
+		ORDER BY failing_since, url
+	`
+
+	links := []models.BrokenLink{}
+	if err := s.reader.SelectContext(ctx, &links, query); err != nil {
+		return nil, err
+	}
+
+	for i := range links {
+		// Links are stored unescaped, but ampersands are escaped in the content
+		escaped := strings.ReplaceAll(links[i].URL, "&", "&amp;")
+		links[i].PostIDs = []int64{}
+		err := s.reader.SelectContext(ctx, &links[i].PostIDs,
+			`SELECT id FROM posts WHERE deleted_at IS NULL AND instr(content, ?) > 0 ORDER BY id`, escaped)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
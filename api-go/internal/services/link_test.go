@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExtractLinks(t *testing.T) {
+	content := `<p><a href="https://example.com/a?x=1&amp;y=2">a</a> <a href="/local">local</a></p>` +
+		`<p><a href="http://example.com/b">b</a> <a href="https://example.com/a?x=1&amp;y=2">again</a></p>`
+
+	links := ExtractLinks(content)
+	expected := []string{"https://example.com/a?x=1&y=2", "http://example.com/b"}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("expected %v, got %v", expected, links)
+	}
+}
+
+func TestCheckLink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	tests := map[string]int{"/ok": 200, "/no-head": 200, "/gone": 404}
+	for path, expected := range tests {
+		status, err := CheckLink(ctx, server.Client(), "", server.URL+path)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", path, err)
+		}
+		if status != expected {
+			t.Errorf("%s: expected status %d, got %d", path, expected, status)
+		}
+	}
+
+	status, err := CheckLink(ctx, server.Client(), "", "http://127.0.0.1:1/unreachable")
+	if err == nil || status != 0 {
+		t.Errorf("expected an error and status 0 for an unreachable link, got %d, %v", status, err)
+	}
+}
+
+func TestLinkChecks(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	service := NewLinkService(db)
+
+	postID := createTestPost(t, db, `<p><a href="https://example.com/a?x=1&amp;y=2">a</a> <a href="https://example.com/b">b</a></p>`, nil)
+	deletedAt := time.Now().UnixMilli()
+	createTestPost(t, db, `<p><a href="https://example.com/c">c</a></p>`, &deletedAt)
+
+	links, err := service.FindLinks(ctx)
+	if err != nil {
+		t.Fatalf("FindLinks failed: %v", err)
+	}
+	if len(links) != 2 {
+		t.Fatalf("expected the links of the live post, got %v", links)
+	}
+
+	broken := "https://example.com/a?x=1&y=2"
+	if err := service.SaveCheck(ctx, broken, 0, errors.New("timeout")); err != nil {
+		t.Fatalf("SaveCheck failed: %v", err)
+	}
+	if err := service.SaveCheck(ctx, broken, 404, nil); err != nil {
+		t.Fatalf("SaveCheck failed: %v", err)
+	}
+	if err := service.SaveCheck(ctx, "https://example.com/b", 200, nil); err != nil {
+		t.Fatalf("SaveCheck failed: %v", err)
+	}
+
+	due, err := service.DueForCheck(ctx, links, time.Now().Add(-time.Hour).UnixMilli(), 10)
+	if err != nil {
+		t.Fatalf("DueForCheck failed: %v", err)
+	}
+	if len(due) != 0 {
+		t.Errorf("expected no link due for a check, got %v", due)
+	}
+
+	report, err := service.FindBroken(ctx)
+	if err != nil {
+		t.Fatalf("FindBroken failed: %v", err)
+	}
+	if len(report) != 1 {
+		t.Fatalf("expected 1 broken link, got %+v", report)
+	}
+	if report[0].URL != broken || report[0].Status != 404 || report[0].Failures != 2 {
+		t.Errorf("unexpected broken link %+v", report[0])
+	}
+	if report[0].Error.Valid || !report[0].FailingSince.Valid {
+		t.Errorf("expected the latest error and the first failure time, got %+v", report[0])
+	}
+	if !reflect.DeepEqual(report[0].PostIDs, []int64{postID}) {
+		t.Errorf("expected post %d, got %v", postID, report[0].PostIDs)
+	}
+
+	// A successful check clears the failures
+	if err := service.SaveCheck(ctx, broken, 200, nil); err != nil {
+		t.Fatalf("SaveCheck failed: %v", err)
+	}
+	if report, _ := service.FindBroken(ctx); len(report) != 0 {
+		t.Errorf("expected no broken link after a successful check, got %+v", report)
+	}
+
+	removed, err := service.PruneChecks(ctx, []string{broken})
+	if err != nil {
+		t.Fatalf("PruneChecks failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 check to be removed, got %d", removed)
+	}
+}
@@ -1,30 +1,55 @@
 package services
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/pkg/fulltext"
 	"github.com/jmoiron/sqlx"
 )
 
 var (
 	ErrPostNotFound = errors.New("post not found")
-	hashTagRegex    = regexp.MustCompile(`<span class="hash-tag">#(.+?)</span>`)
+	// ErrParentCycle is returned when a post would become a parent of one of its parents
+	ErrParentCycle = errors.New("a post cannot be moved below itself")
+	// ErrInvalidFiles is returned when a patch of the files of a post doesn't match them
+	ErrInvalidFiles = errors.New("invalid files")
+	// ErrInvalidFilter wraps the reason filter options are rejected
+	ErrInvalidFilter = errors.New("invalid filter")
+	// postOrderColumns are the columns posts can be ordered by
+	postOrderColumns = map[string]string{
+		"created_at":     "p.created_at",
+		"updated_at":     "p.updated_at",
+		"deleted_at":     "p.deleted_at",
+		"children_count": "p.children_count",
+	}
+	hashTagRegex = regexp.MustCompile(`<span class="hash-tag">#(.+?)</span>`)
+	// regex patterns to extract header and bold paragraph
+	headerAndBoldParagraphRegex = regexp.MustCompile(`<h[1-3][^>]*>(.*?)</h[1-3]>\s*(?:<p[^>]*><strong>(.*?)</strong></p>)?`)
+	// regex pattern to remove strong tags
+	strongTagRegex = regexp.MustCompile(`</?strong>`)
 )
 
 type PostService struct {
-	db *sqlx.DB
+	db     *DB
+	reader *sqlx.DB
+	writes contentWrites
 }
 
-func NewPostService(db *sqlx.DB) *PostService {
-	return &PostService{db: db}
+func NewPostService(db *DB) *PostService {
+	return &PostService{db: db, reader: db.reader, writes: contentWritesFor(db)}
 }
 
 // FindWithParent retrieves a post with its parent
@@ -55,7 +80,7 @@ func (s *PostService) FindByID(ctx context.Context, id int64) (*models.Post, err
 	query := `SELECT * FROM posts WHERE id = ? AND deleted_at IS NULL`
 
 	var post models.Post
-	err := s.db.GetContext(ctx, &post, query, id)
+	err := s.reader.GetContext(ctx, &post, query, id)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -82,7 +107,7 @@ func (s *PostService) FindByIDs(ctx context.Context, ids []int64) ([]models.Post
 	`
 
 	posts := []models.Post{}
-	err := s.db.SelectContext(ctx, &posts, query, string(idsJSON))
+	err := s.reader.SelectContext(ctx, &posts, query, string(idsJSON))
 	if err != nil {
 		return nil, err
 	}
@@ -98,15 +123,175 @@ func (s *PostService) FindByIDs(ctx context.Context, ids []int64) ([]models.Post
 	return posts, nil
 }
 
+// FilterIDs returns the IDs of the posts among ids matching the filter options, e.g. to narrow the results of a search
+// The order of the IDs is kept, invalid options return an error wrapping ErrInvalidFilter.
+func (s *PostService) FilterIDs(ctx context.Context, ids []int64, options models.FilterPostRequest) ([]int64, error) {
+	if err := ValidateFilter(options); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []int64{}, nil
+	}
+
+	from, conditions, args := filterConditions(options)
+	idsJSON, _ := json.Marshal(ids)
+	conditions = append(conditions, "p.id IN (SELECT value FROM json_each(?))")
+	args = append(args, string(idsJSON))
+
+	var matched []int64
+	query := "SELECT DISTINCT p.id " + from + " WHERE " + strings.Join(conditions, " AND ")
+	if err := s.reader.SelectContext(ctx, &matched, query, args...); err != nil {
+		return nil, err
+	}
+
+	keep := make(map[int64]bool, len(matched))
+	for _, id := range matched {
+		keep[id] = true
+	}
+	return slices.DeleteFunc(slices.Clone(ids), func(id int64) bool { return !keep[id] }), nil
+}
+
+// FindBriefsByIDs retrieves multiple posts by their IDs with tags but without parents
+// It is intended for lightweight listings where parent posts are not needed
+func (s *PostService) FindBriefsByIDs(ctx context.Context, ids []int64) ([]models.Post, error) {
+	if len(ids) == 0 {
+		return []models.Post{}, nil
+	}
+
+	idsJSON, _ := json.Marshal(ids)
+	query := `
+		SELECT *
+		FROM posts
+		WHERE id IN (SELECT value FROM json_each(?))
+		AND deleted_at IS NULL
+	`
+
+	posts := []models.Post{}
+	err := s.reader.SelectContext(ctx, &posts, query, string(idsJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attachTags(ctx, posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
 // GetCount returns the total count of non-deleted posts
 func (s *PostService) GetCount(ctx context.Context) (int64, error) {
 	query := `SELECT COUNT(*) FROM posts WHERE deleted_at IS NULL`
 
 	var count int64
-	err := s.db.GetContext(ctx, &count, query)
+	err := s.reader.GetContext(ctx, &count, query)
 	return count, err
 }
 
+// GetColorCounts returns the count of non-deleted posts for each color
+func (s *PostService) GetColorCounts(ctx context.Context) (map[string]int64, error) {
+	query := `
+		SELECT color, COUNT(*) AS count
+		FROM posts
+		WHERE deleted_at IS NULL AND color IS NOT NULL
+		GROUP BY color
+	`
+
+	type colorCount struct {
+		Color string `db:"color"`
+		Count int64  `db:"count"`
+	}
+
+	var results []colorCount
+	if err := s.reader.SelectContext(ctx, &results, query); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(results))
+	for _, r := range results {
+		counts[r.Color] = r.Count
+	}
+	return counts, nil
+}
+
+// GetGroupedCounts returns counts of non-deleted posts grouped by month, color and top-level tag
+// Months are formatted as YYYY-MM in the timezone given by offsetSeconds
+// Tag counts include posts of subtags, e.g. "animal/mammal" is counted under "animal"
+func (s *PostService) GetGroupedCounts(ctx context.Context, offsetSeconds int) (*models.GroupedPostCounts, error) {
+	query := `
+		SELECT 'month' AS kind,
+			strftime('%Y-%m', created_at / 1000 + ?, 'unixepoch') AS key,
+			COUNT(*) AS count
+		FROM posts
+		WHERE deleted_at IS NULL
+		GROUP BY key
+
+		UNION ALL
+
+		SELECT 'color' AS kind, color AS key, COUNT(*) AS count
+		FROM posts
+		WHERE deleted_at IS NULL AND color IS NOT NULL
+		GROUP BY key
+
+		UNION ALL
+
+		SELECT 'tag' AS kind,
+			CASE WHEN instr(t.name, '/') > 0
+				THEN substr(t.name, 1, instr(t.name, '/') - 1)
+				ELSE t.name
+			END AS key,
+			COUNT(DISTINCT p.id) AS count
+		FROM tags t
+		INNER JOIN tag_post_assoc tp ON tp.tag_id = t.id
+		INNER JOIN posts p ON p.id = tp.post_id AND p.deleted_at IS NULL
+		GROUP BY key
+	`
+
+	type groupRow struct {
+		Kind  string `db:"kind"`
+		Key   string `db:"key"`
+		Count int64  `db:"count"`
+	}
+
+	var rows []groupRow
+	if err := s.reader.SelectContext(ctx, &rows, query, offsetSeconds); err != nil {
+		return nil, err
+	}
+
+	result := &models.GroupedPostCounts{
+		ByMonth: []models.GroupCount{},
+		ByColor: []models.GroupCount{},
+		ByTag:   []models.GroupCount{},
+	}
+
+	for _, row := range rows {
+		count := models.GroupCount{Key: row.Key, Count: row.Count}
+		switch row.Kind {
+		case "month":
+			result.ByMonth = append(result.ByMonth, count)
+		case "color":
+			result.ByColor = append(result.ByColor, count)
+		case "tag":
+			result.ByTag = append(result.ByTag, count)
+		}
+	}
+
+	// Months in chronological order, colors and tags by count descending
+	sort.Slice(result.ByMonth, func(i, j int) bool {
+		return result.ByMonth[i].Key < result.ByMonth[j].Key
+	})
+	for _, counts := range [][]models.GroupCount{result.ByColor, result.ByTag} {
+		sort.SliceStable(counts, func(i, j int) bool {
+			if counts[i].Count != counts[j].Count {
+				return counts[i].Count > counts[j].Count
+			}
+			return counts[i].Key < counts[j].Key
+		})
+	}
+
+	return result, nil
+}
+
 // GetActiveDays returns the count of distinct days with posts
 func (s *PostService) GetActiveDays(ctx context.Context) (int64, error) {
 	query := `
@@ -116,73 +301,164 @@ func (s *PostService) GetActiveDays(ctx context.Context) (int64, error) {
 	`
 
 	var count int64
-	err := s.db.GetContext(ctx, &count, query)
+	err := s.reader.GetContext(ctx, &count, query)
 	return count, err
 }
 
 // GetDailyCounts returns daily post counts within a date range
-func (s *PostService) GetDailyCounts(ctx context.Context, startDate, endDate time.Time, offsetSeconds int) ([]int64, error) {
-	offsetMs := int64(offsetSeconds) * 1000
-	startTs := startDate.UnixMilli()
-	endTs := endDate.UnixMilli()
-	dayMs := int64(3600 * 24 * 1000)
+// The days are the calendar days in the location of startDate, from the day of startDate until the midnight of
+// endDate, or the next one, so that a day lasts 23 or 25 hours across a daylight saving transition.
+func (s *PostService) GetDailyCounts(ctx context.Context, startDate, endDate time.Time) ([]int64, error) {
+	loc := startDate.Location()
+	year, month, day := startDate.Date()
+
+	// The start of each day, and the end of the last one
+	var bounds []int64
+	for i := 0; ; i++ {
+		start := time.Date(year, month, day+i, 0, 0, 0, 0, loc)
+		bounds = append(bounds, start.UnixMilli())
+		if !start.Before(endDate) {
+			break
+		}
+	}
+	counts := make([]int64, len(bounds)-1)
+	if len(counts) == 0 {
+		return counts, nil
+	}
 
 	query := `
-		SELECT (created_at + ?) / ? as local_day, COUNT(*) as count
+		SELECT created_at
 		FROM posts
 		WHERE deleted_at IS NULL
-			AND created_at BETWEEN ? AND ?
-		GROUP BY local_day
-		ORDER BY local_day
+			AND created_at >= ? AND created_at < ?
+		ORDER BY created_at
 	`
 
-	type dayCount struct {
-		LocalDay int64 `db:"local_day"`
-		Count    int64 `db:"count"`
+	var createdAts []int64
+	err := s.reader.SelectContext(ctx, &createdAts, query, bounds[0], bounds[len(bounds)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	// Both are sorted, the posts are counted in their day as the days go by
+	day = 0
+	for _, createdAt := range createdAts {
+		for createdAt >= bounds[day+1] {
+			day++
+		}
+		counts[day]++
+	}
+	return counts, nil
+}
+
+// Filter retrieves posts based on filter options
+// Invalid options return an error wrapping ErrInvalidFilter.
+func (s *PostService) Filter(ctx context.Context, options models.FilterPostRequest, perPage int) ([]models.Post, error) {
+	if err := ValidateFilter(options); err != nil {
+		return nil, err
+	}
+	from, conditions, args := filterConditions(options)
+
+	// Select distinct posts when the tag join can yield duplicates
+	baseQuery := "SELECT p.* " + from
+	if options.Tag != nil {
+		baseQuery = "SELECT DISTINCT p.* " + from
+	}
+
+	// Build WHERE clause
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Order field
+	orderBy := postOrderColumn(options.OrderBy)
+
+	// Cursor pagination, posts with the cursor value are told apart by their ID
+	operator := "<"
+	if options.Ascending {
+		operator = ">"
+	}
+	if options.Cursor != nil && options.CursorID != nil {
+		whereClause += fmt.Sprintf(" AND (%s %s ? OR (%s = ? AND p.id %s ?))", orderBy, operator, orderBy, operator)
+		args = append(args, *options.Cursor, *options.Cursor, *options.CursorID)
+	} else if options.Cursor != nil {
+		whereClause += fmt.Sprintf(" AND %s %s ?", orderBy, operator)
+		args = append(args, *options.Cursor)
+	}
+
+	// Direction
+	direction := "DESC"
+	if options.Ascending {
+		direction = "ASC"
 	}
 
-	var results []dayCount
-	err := s.db.SelectContext(ctx, &results, query, offsetMs, dayMs, startTs, endTs)
+	// Final query
+	query := fmt.Sprintf("%s%s ORDER BY %s %s, p.id %s LIMIT %d",
+		baseQuery, whereClause, orderBy, direction, direction, perPage)
+	posts := make([]models.Post, 0)
+
+	err := s.reader.SelectContext(ctx, &posts, query, args...)
+
 	if err != nil {
 		return nil, err
 	}
 
-	// Create map for quick lookup
-	countMap := make(map[int64]int64)
-	for _, r := range results {
-		countMap[r.LocalDay] = r.Count
+	if options.Brief {
+		for i := range posts {
+			posts[i].Content = ""
+		}
 	}
 
-	// Calculate range and fill missing days with 0
-	days := (endDate.Sub(startDate).Hours() / 24) + 1
-	startDay := (startTs + offsetMs) / dayMs
-	endDay := startDay + int64(days) - 1
+	if err := s.attachParents(ctx, posts); err != nil {
+		return nil, err
+	}
 
-	counts := make([]int64, 0, int(days))
-	for day := startDay; day <= endDay; day++ {
-		counts = append(counts, countMap[day])
+	if err := s.attachTags(ctx, posts); err != nil {
+		return nil, err
 	}
 
-	return counts, nil
+	return posts, nil
 }
 
-// Filter retrieves posts based on filter options
-func (s *PostService) Filter(ctx context.Context, options models.FilterPostRequest, perPage int) ([]models.Post, error) {
+// ValidateFilter checks the ordering, pagination and date range of filter options
+func ValidateFilter(options models.FilterPostRequest) error {
+	if _, ok := postOrderColumns[options.OrderBy]; options.OrderBy != "" && !ok {
+		return fmt.Errorf("%w: order_by must be created_at, updated_at, deleted_at or children_count", ErrInvalidFilter)
+	}
+	if options.Cursor != nil && *options.Cursor < 0 {
+		return fmt.Errorf("%w: cursor cannot be negative", ErrInvalidFilter)
+	}
+	if options.CursorID != nil && options.Cursor == nil {
+		return fmt.Errorf("%w: cursor_id requires a cursor", ErrInvalidFilter)
+	}
+	if options.StartDate != nil && options.EndDate != nil && *options.StartDate > *options.EndDate {
+		return fmt.Errorf("%w: start_date cannot be after end_date", ErrInvalidFilter)
+	}
+	return nil
+}
+
+// postOrderColumn returns the column of an order_by option checked by ValidateFilter, created_at if not set
+func postOrderColumn(orderBy string) string {
+	return postOrderColumns[cmp.Or(orderBy, "created_at")]
+}
+
+// filterConditions returns the FROM clause, the conditions and their arguments selecting the posts matching the options
+// Ordering and pagination are left to the caller.
+func filterConditions(options models.FilterPostRequest) (string, []string, []interface{}) {
 	var args []interface{}
 	var conditions []string
 
 	// Base query with optional tag join
-	var baseQuery string
+	from := "FROM posts p"
 	if options.Tag != nil {
-		baseQuery = `
-			SELECT DISTINCT p.* FROM posts p
+		from = `
+			FROM posts p
 			INNER JOIN tag_post_assoc tp ON p.id = tp.post_id
 			INNER JOIN tags t ON tp.tag_id = t.id
 		`
 		conditions = append(conditions, "(t.name = ? OR t.name LIKE ?)")
 		args = append(args, *options.Tag, *options.Tag+"/%")
-	} else {
-		baseQuery = "SELECT p.* FROM posts p"
 	}
 
 	// Deleted filter
@@ -229,54 +505,7 @@ func (s *PostService) Filter(ctx context.Context, options models.FilterPostReque
 		}
 	}
 
-	// Build WHERE clause
-	whereClause := ""
-	if len(conditions) > 0 {
-		whereClause = " WHERE " + strings.Join(conditions, " AND ")
-	}
-
-	// Order field
-	orderBy := "p.created_at"
-	if options.OrderBy != "" {
-		orderBy = "p." + options.OrderBy
-	}
-
-	// Cursor pagination
-	if options.Cursor != nil {
-		operator := "<"
-		if options.Ascending {
-			operator = ">"
-		}
-		whereClause += fmt.Sprintf(" AND %s %s ?", orderBy, operator)
-		args = append(args, *options.Cursor)
-	}
-
-	// Direction
-	direction := "DESC"
-	if options.Ascending {
-		direction = "ASC"
-	}
-
-	// Final query
-	query := fmt.Sprintf("%s%s ORDER BY %s %s LIMIT %d",
-		baseQuery, whereClause, orderBy, direction, perPage)
-	posts := make([]models.Post, 0)
-
-	err := s.db.SelectContext(ctx, &posts, query, args...)
-
-	if err != nil {
-		return nil, err
-	}
-
-	if err := s.attachParents(ctx, posts); err != nil {
-		return nil, err
-	}
-
-	if err := s.attachTags(ctx, posts); err != nil {
-		return nil, err
-	}
-
-	return posts, nil
+	return from, conditions, args
 }
 
 // Create creates a new post
@@ -284,8 +513,23 @@ func (s *PostService) Filter(ctx context.Context, options models.FilterPostReque
 // Returns the created post's ID and timestamps
 func (s *PostService) Create(ctx context.Context, req models.CreatePostRequest) (*models.CreateResponse, error) {
 	now := time.Now().UnixMilli()
+	return s.create(ctx, req, now, now, true)
+}
+
+// Import creates a post brought from another app, keeping its original timestamps
+// It records no activity of its own, the import records one once completed.
+func (s *PostService) Import(ctx context.Context, req models.CreatePostRequest, createdAt, updatedAt int64) (*models.CreateResponse, error) {
+	return s.create(ctx, req, createdAt, updatedAt, false)
+}
 
-	tx, err := s.db.BeginTxx(ctx, nil)
+func (s *PostService) create(ctx context.Context, req models.CreatePostRequest, createdAt, updatedAt int64, record bool) (*models.CreateResponse, error) {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	tx, err := beginTx(ctx, s.db)
 	if err != nil {
 		return nil, err
 	}
@@ -314,13 +558,16 @@ func (s *PostService) Create(ctx context.Context, req models.CreatePostRequest)
 		parentID = models.NullInt64{NullInt64: sql.NullInt64{Int64: *req.ParentID, Valid: true}}
 	}
 
+	title, description := ExtractTitleAndDescription(req.Content)
+
 	// Insert post
 	query := `
-		INSERT INTO posts (content, files, color, shared, parent_id, created_at, updated_at, children_count)
-		VALUES (?, ?, ?, ?, ?, ?, ?, 0)
+		INSERT INTO posts (content, title, description, files, color, shared, parent_id, created_at, updated_at, children_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
 	`
 
-	result, err := tx.ExecContext(ctx, query, req.Content, filesJSON, color, shared, parentID, now, now)
+	result, err := tx.ExecContext(ctx, query,
+		req.Content, title, description, filesJSON, color, shared, parentID, createdAt, updatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -335,7 +582,7 @@ func (s *PostService) Create(ctx context.Context, req models.CreatePostRequest)
 	tagService := NewTagService(s.db)
 
 	for tagName := range hashTags {
-		tag, err := tagService.findOrCreate(ctx, tx, tagName)
+		tag, err := tagService.findOrCreate(ctx, tx.Tx, tagName)
 		if err != nil {
 			return nil, err
 		}
@@ -350,7 +597,18 @@ func (s *PostService) Create(ctx context.Context, req models.CreatePostRequest)
 
 	// Update parent children count
 	if req.ParentID != nil {
-		if err := s.updateChildrenCount(ctx, tx, *req.ParentID, true); err != nil {
+		if err := s.updateChildrenCount(ctx, tx.Tx, *req.ParentID, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.rethread(ctx, tx.Tx, postID, parentID); err != nil {
+		return nil, err
+	}
+
+	if record {
+		summary := SummarizeContent(req.Content, activitySummaryLength)
+		if err := recordActivity(ctx, tx, models.ActivityPostCreated, postID, summary); err != nil {
 			return nil, err
 		}
 	}
@@ -361,8 +619,8 @@ func (s *PostService) Create(ctx context.Context, req models.CreatePostRequest)
 
 	return &models.CreateResponse{
 		ID:        postID,
-		CreatedAt: now,
-		UpdatedAt: now,
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
 	}, nil
 }
 
@@ -370,9 +628,15 @@ func (s *PostService) Create(ctx context.Context, req models.CreatePostRequest)
 // It also updates tag associations if the content changes
 // It updates the parent children counts if the parent_id changes
 func (s *PostService) Update(ctx context.Context, req models.UpdatePostRequest) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	now := time.Now().UnixMilli()
 
-	tx, err := s.db.BeginTxx(ctx, nil)
+	tx, err := beginTx(ctx, s.db)
 	if err != nil {
 		return err
 	}
@@ -397,8 +661,9 @@ func (s *PostService) Update(ctx context.Context, req models.UpdatePostRequest)
 	args := []interface{}{now}
 
 	if req.Content != nil {
-		updates = append(updates, "content = ?")
-		args = append(args, *req.Content)
+		title, description := ExtractTitleAndDescription(*req.Content)
+		updates = append(updates, "content = ?", "title = ?", "description = ?")
+		args = append(args, *req.Content, title, description)
 	}
 	if req.Shared != nil {
 		updates = append(updates, "shared = ?")
@@ -467,17 +732,27 @@ func (s *PostService) Update(ctx context.Context, req models.UpdatePostRequest)
 		return err
 	}
 
+	if req.ParentID.IsPresent() {
+		var parentID models.NullInt64
+		if !req.ParentID.IsNull() {
+			parentID = models.NullInt64{NullInt64: sql.NullInt64{Int64: req.ParentID.MustGet(), Valid: true}}
+		}
+		if err := s.rethread(ctx, tx.Tx, req.ID, parentID); err != nil {
+			return err
+		}
+	}
+
 	// Update parent children counts
 	// if req.ParentID != nil {
 	if req.ParentID.IsPresent() {
 		if oldParentID.Valid {
-			if err := s.updateChildrenCount(ctx, tx, oldParentID.Int64, false); err != nil {
+			if err := s.updateChildrenCount(ctx, tx.Tx, oldParentID.Int64, false); err != nil {
 				return err
 			}
 		}
 		// if *req.ParentID != 0 {
 		if !req.ParentID.IsNull() {
-			if err := s.updateChildrenCount(ctx, tx, req.ParentID.MustGet(), true); err != nil {
+			if err := s.updateChildrenCount(ctx, tx.Tx, req.ParentID.MustGet(), true); err != nil {
 				return err
 			}
 		}
@@ -496,7 +771,7 @@ func (s *PostService) Update(ctx context.Context, req models.UpdatePostRequest)
 
 		// Add new associations
 		for tagName := range hashTags {
-			tag, err := tagService.findOrCreate(ctx, tx, tagName)
+			tag, err := tagService.findOrCreate(ctx, tx.Tx, tagName)
 			if err != nil {
 				return err
 			}
@@ -510,15 +785,115 @@ func (s *PostService) Update(ctx context.Context, req models.UpdatePostRequest)
 		}
 	}
 
+	var content string
+	err = tx.GetContext(ctx, &content, "SELECT content FROM posts WHERE id = ?", req.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil {
+		summary := SummarizeContent(content, activitySummaryLength)
+		if err := recordActivity(ctx, tx, models.ActivityPostUpdated, req.ID, summary); err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
+// UpdateFiles reorders the files of a post and sets their captions
+// It returns the files in their new order, or an error wrapping ErrInvalidFiles if the patch names files the post
+// doesn't have, or doesn't list all of them in the order.
+func (s *PostService) UpdateFiles(ctx context.Context, req models.UpdateFilesRequest) ([]models.FileInfo, error) {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var raw models.NullRawMessage
+	err = tx.GetContext(ctx, &raw, "SELECT files FROM posts WHERE id = ? AND deleted_at IS NULL", req.ID)
+	if err == sql.ErrNoRows {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := []models.FileInfo{}
+	if raw.Valid && len(raw.RawMessage) > 0 {
+		if err := json.Unmarshal(raw.RawMessage, &files); err != nil {
+			return nil, fmt.Errorf("failed to decode files: %w", err)
+		}
+	}
+
+	// A post without files keeps NULL, which the has_files filter relies on
+	if len(files) == 0 && len(req.Captions) == 0 && len(req.Order) == 0 {
+		return files, nil
+	}
+
+	byURL := make(map[string]int, len(files))
+	for i, file := range files {
+		byURL[file.URL] = i
+	}
+
+	for url, caption := range req.Captions {
+		i, ok := byURL[url]
+		if !ok {
+			return nil, fmt.Errorf("%w: the post has no file %s", ErrInvalidFiles, url)
+		}
+		files[i].Caption = nil
+		if caption != "" {
+			files[i].Caption = &caption
+		}
+	}
+
+	if len(req.Order) > 0 {
+		if len(req.Order) != len(files) {
+			return nil, fmt.Errorf("%w: the order must list the %d files of the post", ErrInvalidFiles, len(files))
+		}
+		ordered := make([]models.FileInfo, 0, len(files))
+		seen := make(map[string]bool, len(files))
+		for _, url := range req.Order {
+			i, ok := byURL[url]
+			if !ok || seen[url] {
+				return nil, fmt.Errorf("%w: the order must list each file of the post once", ErrInvalidFiles)
+			}
+			seen[url] = true
+			ordered = append(ordered, files[i])
+		}
+		files = ordered
+	}
+
+	filesBytes, _ := json.Marshal(files)
+	_, err = tx.ExecContext(ctx, "UPDATE posts SET files = ?, updated_at = ? WHERE id = ?",
+		string(filesBytes), time.Now().UnixMilli(), req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
 // Delete soft deletes a post
 // It sets the deleted_at timestamp and updates parent children count
 func (s *PostService) Delete(ctx context.Context, id int64) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	now := time.Now().UnixMilli()
 
-	tx, err := s.db.BeginTxx(ctx, nil)
+	tx, err := beginTx(ctx, s.db)
 	if err != nil {
 		return err
 	}
@@ -535,7 +910,7 @@ func (s *PostService) Delete(ctx context.Context, id int64) error {
 	}
 
 	if post.ParentID.Valid {
-		if err := s.updateChildrenCount(ctx, tx, post.ParentID.Int64, false); err != nil {
+		if err := s.updateChildrenCount(ctx, tx.Tx, post.ParentID.Int64, false); err != nil {
 			return err
 		}
 	}
@@ -545,8 +920,15 @@ func (s *PostService) Delete(ctx context.Context, id int64) error {
 
 // Restore restores a soft-deleted post
 // It clears the deleted_at timestamp and updates parent children count
+// The deleted tags of the post are taken out of the trash along with it
 func (s *PostService) Restore(ctx context.Context, id int64) error {
-	tx, err := s.db.BeginTxx(ctx, nil)
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := beginTx(ctx, s.db)
 	if err != nil {
 		return err
 	}
@@ -562,8 +944,18 @@ func (s *PostService) Restore(ctx context.Context, id int64) error {
 		return err
 	}
 
+	tagQuery := `
+		UPDATE tags
+		SET deleted_at = NULL
+		WHERE deleted_at IS NOT NULL AND merged_into IS NULL
+		AND id IN (SELECT tag_id FROM tag_post_assoc WHERE post_id = ?)
+	`
+	if _, err := tx.ExecContext(ctx, tagQuery, id); err != nil {
+		return err
+	}
+
 	if post.ParentID.Valid {
-		if err := s.updateChildrenCount(ctx, tx, post.ParentID.Int64, true); err != nil {
+		if err := s.updateChildrenCount(ctx, tx.Tx, post.ParentID.Int64, true); err != nil {
 			return err
 		}
 	}
@@ -573,24 +965,306 @@ func (s *PostService) Restore(ctx context.Context, id int64) error {
 
 // HardDelete permanently deletes a post
 // It only deletes posts that are already soft-deleted
-func (s *PostService) HardDelete(ctx context.Context, id int64) error {
-	query := `DELETE FROM posts WHERE id = ? AND deleted_at IS NOT NULL`
-	_, err := s.db.ExecContext(ctx, query, id)
-	return err
+// It returns the files of the deleted post that are no longer referenced by any other post
+// Like the purged posts, its replies start threads of their own, see purge.
+func (s *PostService) HardDelete(ctx context.Context, id int64) ([]models.FileInfo, error) {
+	query := `DELETE FROM posts WHERE id = ? AND deleted_at IS NOT NULL RETURNING id, files`
+	_, files, err := s.purge(ctx, query, id)
+	return files, err
 }
 
 // ClearAll permanently deletes all soft-deleted posts
-// It returns the IDs of the deleted posts
-func (s *PostService) ClearAll(ctx context.Context) ([]int64, error) {
-	query := `DELETE FROM posts WHERE deleted_at IS NOT NULL RETURNING id`
+// It returns the IDs of the deleted posts and their files that are no longer referenced
+func (s *PostService) ClearAll(ctx context.Context) (ids []int64, files []models.FileInfo, err error) {
+	query := `DELETE FROM posts WHERE deleted_at IS NOT NULL RETURNING id, files`
+	err = WithCheckpoints(ctx, s.db, "clear-posts", func() error {
+		ids, files, err = s.purge(ctx, query)
+		return err
+	})
+	return ids, files, err
+}
+
+// PurgeDeletedBefore permanently deletes at most limit posts that were soft-deleted before the given timestamp
+// It returns the IDs of the deleted posts and their files that are no longer referenced
+func (s *PostService) PurgeDeletedBefore(ctx context.Context, before int64, limit int) ([]int64, []models.FileInfo, error) {
+	query := `
+		DELETE FROM posts
+		WHERE id IN (SELECT id FROM posts WHERE deleted_at < ? ORDER BY deleted_at LIMIT ?)
+		RETURNING id, files
+	`
+	return s.purge(ctx, query, before, limit)
+}
+
+// CountDeletedBefore returns the number of posts that were soft-deleted before the given timestamp
+func (s *PostService) CountDeletedBefore(ctx context.Context, before int64) (int64, error) {
+	var count int64
+	err := s.reader.GetContext(ctx, &count, "SELECT COUNT(*) FROM posts WHERE deleted_at < ?", before)
+	return count, err
+}
+
+// SampleIndexable returns up to limit randomly chosen non-deleted posts with their content
+func (s *PostService) SampleIndexable(ctx context.Context, limit int) ([]models.Post, error) {
+	query := `SELECT * FROM posts WHERE deleted_at IS NULL ORDER BY RANDOM() LIMIT ?`
+
+	posts := []models.Post{}
+	err := s.db.SelectContext(ctx, &posts, query, limit)
+	return posts, err
+}
+
+// DocumentSource returns the non-deleted posts as the documents of the full-text index, see fulltext.Rebuild
+// Their content is truncated to indexSize like when they are indexed.
+func (s *PostService) DocumentSource(indexSize int64) fulltext.DocumentSource {
+	return &postDocuments{posts: s, indexSize: indexSize}
+}
+
+// postDocuments lists the non-deleted posts for the full-text index
+type postDocuments struct {
+	posts     *PostService
+	indexSize int64
+}
+
+func (d *postDocuments) CountDocuments(ctx context.Context) (int64, error) {
+	return d.posts.GetCount(ctx)
+}
+
+func (d *postDocuments) Documents(ctx context.Context, afterID int64, limit int) ([]fulltext.Document, error) {
+	type postContent struct {
+		ID      int64  `db:"id"`
+		Content string `db:"content"`
+	}
+
+	var posts []postContent
+	query := `SELECT id, content FROM posts WHERE deleted_at IS NULL AND id > ? ORDER BY id LIMIT ?`
+	if err := d.posts.reader.SelectContext(ctx, &posts, query, afterID, limit); err != nil {
+		return nil, err
+	}
+
+	docs := make([]fulltext.Document, len(posts))
+	for i, post := range posts {
+		content, _ := TruncateContent(post.Content, d.indexSize)
+		docs[i] = fulltext.Document{ID: post.ID, Text: content}
+	}
+	return docs, nil
+}
+
+// FindLiveIDs returns the subset of the given IDs that belong to existing, non-deleted posts
+func (s *PostService) FindLiveIDs(ctx context.Context, ids []int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return []int64{}, nil
+	}
+
+	idsJSON, _ := json.Marshal(ids)
+	query := `
+		SELECT id
+		FROM posts
+		WHERE id IN (SELECT value FROM json_each(?))
+		AND deleted_at IS NULL
+	`
+
+	live := []int64{}
+	err := s.db.SelectContext(ctx, &live, query, string(idsJSON))
+	return live, err
+}
+
+// BackfillTitles extracts and stores the title and description of posts that have none yet
+// It processes posts in batches and returns the number of updated posts
+func (s *PostService) BackfillTitles(ctx context.Context, batchSize int) (int, error) {
+	type postContent struct {
+		ID      int64  `db:"id"`
+		Content string `db:"content"`
+	}
+
+	total := 0
+	for {
+		var posts []postContent
+		err := s.db.SelectContext(ctx, &posts,
+			"SELECT id, content FROM posts WHERE title IS NULL LIMIT ?", batchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(posts) == 0 {
+			return total, nil
+		}
+
+		// Each batch holds the write queue only for its own transaction, so other writes can interleave
+		err = func() error {
+			release, err := s.writes.Acquire(ctx)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			tx, err := beginTx(ctx, s.db)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			for _, post := range posts {
+				title, description := ExtractTitleAndDescription(post.Content)
+				_, err := tx.ExecContext(ctx,
+					"UPDATE posts SET title = ?, description = ? WHERE id = ?",
+					title, description, post.ID)
+				if err != nil {
+					return err
+				}
+			}
+
+			return tx.Commit()
+		}()
+		if err != nil {
+			return total, err
+		}
+		total += len(posts)
+	}
+}
+
+// RecomputeChildrenCounts compares the children count of every post with its live children in one pass
+// and, unless dryRun, sets the drifted counts right. The counts drift when a crash or a racing restore
+// leaves an update of the parent behind the update of its child.
+func (s *PostService) RecomputeChildrenCounts(ctx context.Context, dryRun bool) (*models.ChildrenCountReport, error) {
+	if !dryRun {
+		release, err := s.writes.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT p.id, p.children_count AS stored, COALESCE(c.actual, 0) AS actual
+		FROM posts p
+		LEFT JOIN (
+			SELECT parent_id, COUNT(*) AS actual
+			FROM posts
+			WHERE parent_id IS NOT NULL AND deleted_at IS NULL
+			GROUP BY parent_id
+		) c ON c.parent_id = p.id
+		WHERE p.children_count != COALESCE(c.actual, 0)
+		ORDER BY p.id
+	`
+	report := &models.ChildrenCountReport{Drifts: []models.ChildrenCountDrift{}}
+	if err := tx.SelectContext(ctx, &report.Drifts, query); err != nil {
+		return nil, err
+	}
+	if dryRun || len(report.Drifts) == 0 {
+		return report, nil
+	}
+
+	for _, drift := range report.Drifts {
+		_, err := tx.ExecContext(ctx, "UPDATE posts SET children_count = ? WHERE id = ?", drift.Actual, drift.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	report.Fixed = true
+	return report, nil
+}
+
+// GetThread returns the thread a post belongs to, from the post at its top
+func (s *PostService) GetThread(ctx context.Context, id int64) (*models.Thread, error) {
+	var rootID models.NullInt64
+	err := s.reader.GetContext(ctx, &rootID, "SELECT root_id FROM posts WHERE id = ? AND deleted_at IS NULL", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	root := cmp.Or(rootID.Int64, id)
+
+	query := `
+		SELECT * FROM posts
+		WHERE (root_id = ? OR id = ?) AND deleted_at IS NULL
+		ORDER BY depth, created_at
+	`
+	posts := []models.Post{}
+	if err := s.reader.SelectContext(ctx, &posts, query, root, root); err != nil {
+		return nil, err
+	}
+	if err := s.attachTags(ctx, posts); err != nil {
+		return nil, err
+	}
 
-	var ids []int64
-	err := s.db.SelectContext(ctx, &ids, query)
-	return ids, err
+	thread := &models.Thread{RootID: root, Posts: make([]models.ThreadPost, len(posts))}
+	for i, post := range posts {
+		thread.Posts[i] = models.ThreadPost{Post: post}
+		if post.ParentID.Valid {
+			thread.Posts[i].ParentID = &post.ParentID.Int64
+		}
+	}
+	return thread, nil
 }
 
 // Helper functions
 
+// rootOrphansQuery sets the root and depth of the posts below posts that lost their parent
+const rootOrphansQuery = `
+	WITH RECURSIVE thread(id, root_id, depth) AS (
+		SELECT id, id, 0 FROM posts WHERE parent_id IS NULL AND (root_id IS NOT id OR depth != 0)
+		UNION ALL
+		SELECT p.id, t.root_id, t.depth + 1 FROM posts p JOIN thread t ON p.parent_id = t.id
+	)
+	UPDATE posts SET root_id = thread.root_id, depth = thread.depth FROM thread WHERE posts.id = thread.id
+`
+
+// rethread sets the root and depth of a post placed under a parent, or at the top of a thread, and of the posts below it
+// It returns ErrParentCycle if the parent is the post or below it.
+func (s *PostService) rethread(ctx context.Context, tx *sqlx.Tx, id int64, parentID models.NullInt64) error {
+	rootID, depth := id, int64(0)
+	if parentID.Valid {
+		var parent struct {
+			RootID models.NullInt64 `db:"root_id"`
+			Depth  int64            `db:"depth"`
+		}
+		err := tx.GetContext(ctx, &parent, "SELECT root_id, depth FROM posts WHERE id = ?", parentID.Int64)
+		if err == sql.ErrNoRows {
+			return ErrPostNotFound
+		}
+		if err != nil {
+			return err
+		}
+		rootID, depth = cmp.Or(parent.RootID.Int64, parentID.Int64), parent.Depth+1
+	}
+
+	// UNION stops at posts seen before, so that the walk ends even if the parent is below the post
+	query := `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT ?
+			UNION
+			SELECT p.id FROM posts p JOIN subtree s ON p.parent_id = s.id
+		)
+		SELECT id FROM subtree
+	`
+	var subtree []int64
+	if err := tx.SelectContext(ctx, &subtree, query, id); err != nil {
+		return err
+	}
+	if parentID.Valid && slices.Contains(subtree, parentID.Int64) {
+		return ErrParentCycle
+	}
+
+	query = `
+		WITH RECURSIVE subtree(id, depth) AS (
+			SELECT ?, ?
+			UNION ALL
+			SELECT p.id, s.depth + 1 FROM posts p JOIN subtree s ON p.parent_id = s.id
+		)
+		UPDATE posts SET root_id = ?, depth = subtree.depth FROM subtree WHERE posts.id = subtree.id
+	`
+	_, err := tx.ExecContext(ctx, query, id, depth, rootID)
+	return err
+}
+
 // updateChildrenCount updates the children_count of a parent post
 // If increment is true, it increments the count; otherwise, it decrements it
 func (s *PostService) updateChildrenCount(ctx context.Context, tx *sqlx.Tx, parentID int64, increment bool) error {
@@ -603,9 +1277,102 @@ func (s *PostService) updateChildrenCount(ctx context.Context, tx *sqlx.Tx, pare
 	return err
 }
 
+// purge runs a DELETE ... RETURNING id, files query
+// It returns the deleted IDs and the files that are no longer referenced
+func (s *PostService) purge(ctx context.Context, query string, args ...any) ([]int64, []models.FileInfo, error) {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	type deletedPost struct {
+		ID    int64                 `db:"id"`
+		Files models.NullRawMessage `db:"files"`
+	}
+
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var deleted []deletedPost
+	if err := tx.SelectContext(ctx, &deleted, query, args...); err != nil {
+		return nil, nil, err
+	}
+	// The children of the deleted posts lost their parent, they start threads of their own
+	if _, err := tx.ExecContext(ctx, rootOrphansQuery); err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]int64, 0, len(deleted))
+	files := make([]models.NullRawMessage, 0, len(deleted))
+	for _, post := range deleted {
+		ids = append(ids, post.ID)
+		files = append(files, post.Files)
+	}
+
+	// The references are counted in the transaction, which sees the posts it deleted gone
+	orphans, err := orphanedFiles(ctx, tx, files)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return ids, orphans, nil
+}
+
+// orphanedFiles decodes the files of deleted posts
+// It drops files that are still referenced by a remaining post, so shared blobs are kept
+func orphanedFiles(ctx context.Context, q sqlx.QueryerContext, raws []models.NullRawMessage) ([]models.FileInfo, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM posts, json_each(posts.files)
+		WHERE json_extract(json_each.value, '$.url') = ?
+	`
+
+	orphans := []models.FileInfo{}
+	seen := make(map[string]bool)
+
+	for _, raw := range raws {
+		if !raw.Valid || len(raw.RawMessage) == 0 {
+			continue
+		}
+
+		var files []models.FileInfo
+		if err := json.Unmarshal(raw.RawMessage, &files); err != nil {
+			return nil, fmt.Errorf("failed to decode files: %w", err)
+		}
+
+		for _, file := range files {
+			if seen[file.URL] {
+				continue
+			}
+			seen[file.URL] = true
+
+			var refs int64
+			if err := sqlx.GetContext(ctx, q, &refs, query, file.URL); err != nil {
+				return nil, err
+			}
+			if refs == 0 {
+				orphans = append(orphans, file)
+			}
+		}
+	}
+
+	return orphans, nil
+}
+
 // attachTags attaches tags to the given posts
 // It modifies the posts slice in place
 func (s *PostService) attachTags(ctx context.Context, posts []models.Post) error {
+	return attachTags(ctx, s.reader, posts)
+}
+
+// attachTags attaches tags to the given posts, read from the given database
+func attachTags(ctx context.Context, reader *sqlx.DB, posts []models.Post) error {
 	if len(posts) == 0 {
 		return nil
 	}
@@ -629,7 +1396,7 @@ func (s *PostService) attachTags(ctx context.Context, posts []models.Post) error
 	}
 
 	var assocs []tagAssoc
-	err := s.db.SelectContext(ctx, &assocs, query, string(idsJSON))
+	err := reader.SelectContext(ctx, &assocs, query, string(idsJSON))
 	if err != nil {
 		return err
 	}
@@ -681,7 +1448,7 @@ func (s *PostService) attachParents(ctx context.Context, posts []models.Post) er
 	`
 
 	var parents []models.Post
-	err := s.db.SelectContext(ctx, &parents, query, string(idsJSON))
+	err := s.reader.SelectContext(ctx, &parents, query, string(idsJSON))
 	if err != nil {
 		return err
 	}
@@ -705,6 +1472,83 @@ func (s *PostService) attachParents(ctx context.Context, posts []models.Post) er
 	return nil
 }
 
+// ExtractTitleAndDescription extracts the title and description from the post content
+// The title is the first h1-h3 header, the description is a bold paragraph right after it
+// Both are empty strings if not found
+func ExtractTitleAndDescription(content string) (string, string) {
+	matches := headerAndBoldParagraphRegex.FindStringSubmatch(content)
+	if len(matches) < 2 {
+		return "", ""
+	}
+
+	title := matches[1]
+	var description string
+
+	if len(matches) > 2 && matches[2] != "" {
+		description = strongTagRegex.ReplaceAllString(matches[2], "")
+	}
+
+	return title, description
+}
+
+// GroupByThread keeps the first post of each thread among posts ordered by relevance, e.g. the results of a search
+// The posts kept have the number of posts of their thread in the list as ThreadMatches, themselves included.
+func GroupByThread(posts []models.Post) []models.Post {
+	index := make(map[int64]int, len(posts))
+	grouped := make([]models.Post, 0, len(posts))
+	for _, post := range posts {
+		root := cmp.Or(post.RootID.Int64, post.ID)
+		if i, ok := index[root]; ok {
+			grouped[i].ThreadMatches++
+			continue
+		}
+		post.ThreadMatches = 1
+		index[root] = len(grouped)
+		grouped = append(grouped, post)
+	}
+	return grouped
+}
+
+// SummarizeContent returns a plain-text snippet of the HTML content
+// It prefers the first header and falls back to the leading text, truncated to maxLen runes
+func SummarizeContent(content string, maxLen int) string {
+	title, _ := ExtractTitleAndDescription(content)
+	if title == "" {
+		title = content
+	}
+
+	text := html.UnescapeString(htmlTagRegex.ReplaceAllString(title, " "))
+	text = strings.Join(strings.Fields(text), " ")
+
+	runes := []rune(text)
+	if len(runes) > maxLen {
+		return string(runes[:maxLen]) + "…"
+	}
+	return text
+}
+
+// TruncateContent truncates HTML content to at most maxSize bytes for indexing
+// It cuts at a rune boundary and drops a trailing partial tag
+// It returns the content and whether it was truncated
+func TruncateContent(content string, maxSize int64) (string, bool) {
+	if maxSize <= 0 || int64(len(content)) <= maxSize {
+		return content, false
+	}
+
+	cut := int(maxSize)
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	truncated := content[:cut]
+
+	// Drop an unclosed tag at the end, e.g. "<p cla"
+	if lt := strings.LastIndex(truncated, "<"); lt > strings.LastIndex(truncated, ">") {
+		truncated = truncated[:lt]
+	}
+
+	return truncated, true
+}
+
 // extractHashTags extracts hashtags from the post content
 // It returns a map of unique hashtag names
 func extractHashTags(content string) map[string]bool {
@@ -0,0 +1,615 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/testutil"
+	"github.com/cymoo/mote/pkg/fulltext"
+	"github.com/cymoo/mote/pkg/util/types"
+	"github.com/jmoiron/sqlx"
+)
+
+func createTestPostWithFiles(t *testing.T, db *DB, files string, deletedAt *int64) int64 {
+	post := models.Post{Files: models.NullRawMessage{RawMessage: []byte(files), Valid: true}}
+	if deletedAt != nil {
+		post.DeletedAt = models.NullInt64{NullInt64: sql.NullInt64{Int64: *deletedAt, Valid: true}}
+	}
+	return testutil.CreatePost(t, db, post).ID
+}
+
+func TestHardDeleteReturnsOrphanedFiles(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	deletedAt := time.Now().UnixMilli()
+	id := createTestPostWithFiles(t, db,
+		`[{"url":"/uploads/a.png","thumb_url":"/uploads/thumb_a.png"},{"url":"/uploads/b.png"}]`, &deletedAt)
+
+	// Another post still references b.png
+	createTestPostWithFiles(t, db, `[{"url":"/uploads/b.png"}]`, nil)
+
+	files, err := service.HardDelete(ctx, id)
+	if err != nil {
+		t.Fatalf("HardDelete failed: %v", err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("expected 1 orphaned file, got %d", len(files))
+	}
+	if files[0].URL != "/uploads/a.png" {
+		t.Errorf("expected /uploads/a.png, got %s", files[0].URL)
+	}
+	if files[0].ThumbURL == nil || *files[0].ThumbURL != "/uploads/thumb_a.png" {
+		t.Errorf("expected thumb url to be preserved, got %v", files[0].ThumbURL)
+	}
+}
+
+func TestHardDeleteIgnoresUndeletedPost(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	id := createTestPostWithFiles(t, db, `[{"url":"/uploads/a.png"}]`, nil)
+
+	files, err := service.HardDelete(ctx, id)
+	if err != nil {
+		t.Fatalf("HardDelete failed: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected no files, got %d", len(files))
+	}
+
+	post, err := service.FindByID(ctx, id)
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if post == nil {
+		t.Error("expected post to still exist")
+	}
+}
+
+func TestClearAllReturnsIDsAndFiles(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	deletedAt := time.Now().UnixMilli()
+	id1 := createTestPostWithFiles(t, db, `[{"url":"/uploads/a.png"}]`, &deletedAt)
+	id2 := createTestPostWithFiles(t, db, `[{"url":"/uploads/a.png"},{"url":"/uploads/c.png"}]`, &deletedAt)
+	createTestPost(t, db, "kept", nil)
+
+	ids, files, err := service.ClearAll(ctx)
+	if err != nil {
+		t.Fatalf("ClearAll failed: %v", err)
+	}
+
+	if len(ids) != 2 || !slices.Contains(ids, id1) || !slices.Contains(ids, id2) {
+		t.Errorf("expected ids [%d %d], got %v", id1, id2, ids)
+	}
+	if len(files) != 2 {
+		t.Errorf("expected 2 distinct files, got %d", len(files))
+	}
+}
+
+func TestGetGroupedCounts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	jan := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC).UnixMilli()
+	feb := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC).UnixMilli()
+
+	insert := func(createdAt int64, color any) int64 {
+		var id int64
+		err := db.QueryRow(`INSERT INTO posts (content, color, created_at, updated_at)
+			VALUES ('post', ?, ?, ?) RETURNING id`, color, createdAt, createdAt).Scan(&id)
+		if err != nil {
+			t.Fatalf("failed to create post: %v", err)
+		}
+		return id
+	}
+
+	p1 := insert(jan, "red")
+	p2 := insert(jan, "red")
+	p3 := insert(feb, nil)
+
+	animal := createTestTag(t, db, "animal", false)
+	mammal := createTestTag(t, db, "animal/mammal", false)
+	plant := createTestTag(t, db, "plant", false)
+	associateTagPost(t, db, animal, p1)
+	associateTagPost(t, db, mammal, p1)
+	associateTagPost(t, db, mammal, p2)
+	associateTagPost(t, db, plant, p3)
+
+	counts, err := service.GetGroupedCounts(ctx, 0)
+	if err != nil {
+		t.Fatalf("GetGroupedCounts failed: %v", err)
+	}
+
+	if len(counts.ByMonth) != 2 || counts.ByMonth[0].Key != "2024-01" || counts.ByMonth[0].Count != 2 {
+		t.Errorf("unexpected month counts: %+v", counts.ByMonth)
+	}
+	if len(counts.ByColor) != 1 || counts.ByColor[0].Key != "red" || counts.ByColor[0].Count != 2 {
+		t.Errorf("unexpected color counts: %+v", counts.ByColor)
+	}
+	if len(counts.ByTag) != 2 || counts.ByTag[0].Key != "animal" || counts.ByTag[0].Count != 2 {
+		t.Errorf("unexpected tag counts: %+v", counts.ByTag)
+	}
+}
+
+func TestTruncateContent(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		maxSize   int64
+		want      string
+		truncated bool
+	}{
+		{"short", "<p>hello</p>", 100, "<p>hello</p>", false},
+		{"exact", "<p>hello</p>", 12, "<p>hello</p>", false},
+		{"cut text", "<p>hello world</p>", 10, "<p>hello w", true},
+		{"cut partial tag", "<p>hi</p><p class=x>there</p>", 14, "<p>hi</p>", true},
+		{"rune boundary", "<p>你好</p>", 7, "<p>你", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := TruncateContent(tt.content, tt.maxSize)
+			if got != tt.want || truncated != tt.truncated {
+				t.Errorf("TruncateContent(%q, %d) = %q, %v; want %q, %v",
+					tt.content, tt.maxSize, got, truncated, tt.want, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestExtractTitleAndDescription(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		title       string
+		description string
+	}{
+		{"none", "<p>hello</p>", "", ""},
+		{"title only", "<h2>Hello</h2><p>world</p>", "Hello", ""},
+		{"title and description", "<h1>Hello</h1><p><strong>brief</strong></p>", "Hello", "brief"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, description := ExtractTitleAndDescription(tt.content)
+			if title != tt.title || description != tt.description {
+				t.Errorf("ExtractTitleAndDescription(%q) = %q, %q; want %q, %q",
+					tt.content, title, description, tt.title, tt.description)
+			}
+		})
+	}
+}
+
+func TestBackfillTitles(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	id := createTestPost(t, db, "<h1>Hello</h1><p><strong>brief</strong></p>", nil)
+	createTestPost(t, db, "<p>no title</p>", nil)
+
+	count, err := service.BackfillTitles(ctx, 1)
+	if err != nil {
+		t.Fatalf("BackfillTitles failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 backfilled posts, got %d", count)
+	}
+
+	post, err := service.FindByID(ctx, id)
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if post.Title.String != "Hello" || post.Description.String != "brief" {
+		t.Errorf("unexpected title %q and description %q", post.Title.String, post.Description.String)
+	}
+
+	// Already backfilled posts are skipped
+	count, err = service.BackfillTitles(ctx, 1)
+	if err != nil || count != 0 {
+		t.Errorf("expected nothing to backfill, got %d, %v", count, err)
+	}
+}
+
+func TestFindLiveIDs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	deletedAt := time.Now().UnixMilli()
+	live := createTestPost(t, db, "live", nil)
+	deleted := createTestPost(t, db, "deleted", &deletedAt)
+
+	ids, err := service.FindLiveIDs(ctx, []int64{live, deleted, 9999})
+	if err != nil {
+		t.Fatalf("FindLiveIDs failed: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != live {
+		t.Errorf("expected [%d], got %v", live, ids)
+	}
+}
+
+func TestDocumentSource(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	deletedAt := time.Now().UnixMilli()
+	first := createTestPost(t, db, "first post", nil)
+	createTestPost(t, db, "deleted post", &deletedAt)
+	second := createTestPost(t, db, "second post with a long content", nil)
+
+	index := testutil.NewFakeIndex(nil)
+	index.Index(ctx, 9999, "stale")
+	var progress [][2]int
+	done, err := fulltext.Rebuild(ctx, index, NewPostService(db).DocumentSource(15), func(done, total int) {
+		progress = append(progress, [2]int{done, total})
+	})
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	if done != 2 || len(progress) != 1 || progress[0] != [2]int{2, 2} {
+		t.Errorf("expected the 2 live posts in one batch, got %d and %v", done, progress)
+	}
+	ids, _ := index.IndexedIDs(ctx)
+	slices.Sort(ids)
+	if !slices.Equal(ids, []int64{first, second}) {
+		t.Errorf("expected the live posts only, got %v", ids)
+	}
+	_, found, _ := index.Search(ctx, "second", false, 10)
+	_, truncated, _ := index.Search(ctx, "content", false, 10)
+	if len(found) != 1 || len(truncated) != 0 {
+		t.Errorf("expected the content to be truncated to the index size, got %v and %v", found, truncated)
+	}
+}
+
+func TestReadReplica(t *testing.T) {
+	db := NewDB(&sqlx.DB{})
+	replica := &sqlx.DB{}
+
+	if service := NewPostService(db); service.reader != db.DB {
+		t.Error("expected reads to use the main database without a replica")
+	}
+
+	db.UseReadReplica(replica)
+
+	post := NewPostService(db)
+	if post.reader != replica || post.db != db {
+		t.Error("expected reads to use the replica and writes the main database")
+	}
+	if tag := NewTagService(db); tag.reader != replica || tag.db != db {
+		t.Error("expected tag reads to use the replica and writes the main database")
+	}
+}
+
+func TestFilterOrderByChildrenCount(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	// Two posts share the children count the first page ends on
+	counts := []int64{3, 1, 1, 0}
+	ids := make([]int64, len(counts))
+	for i, count := range counts {
+		ids[i] = createTestPost(t, db, "post", nil)
+		db.MustExec("UPDATE posts SET children_count = ? WHERE id = ?", count, ids[i])
+	}
+
+	first, err := service.Filter(ctx, models.FilterPostRequest{OrderBy: "children_count"}, 2)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	if len(first) != 2 || first[0].ID != ids[0] || first[1].ID != ids[2] {
+		t.Fatalf("expected posts %d and %d, got %+v", ids[0], ids[2], first)
+	}
+
+	cursor, cursorID := first[1].ChildrenCount, first[1].ID
+	second, err := service.Filter(ctx, models.FilterPostRequest{OrderBy: "children_count", Cursor: &cursor, CursorID: &cursorID}, 2)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	if len(second) != 2 || second[0].ID != ids[1] || second[1].ID != ids[3] {
+		t.Errorf("expected posts %d and %d, got %+v", ids[1], ids[3], second)
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	negative, start, end := int64(-1), int64(2), int64(1)
+	invalid := []models.FilterPostRequest{
+		{OrderBy: "id; DROP TABLE posts"},
+		{Cursor: &negative},
+		{CursorID: &start},
+		{StartDate: &start, EndDate: &end},
+	}
+	for _, options := range invalid {
+		if err := ValidateFilter(options); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("expected %+v to be invalid, got %v", options, err)
+		}
+	}
+
+	if err := ValidateFilter(models.FilterPostRequest{OrderBy: "updated_at"}); err != nil {
+		t.Errorf("expected updated_at to be valid, got %v", err)
+	}
+}
+
+func TestRecomputeChildrenCounts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	deletedAt := time.Now().UnixMilli()
+	parent := createTestPost(t, db, "parent", nil)
+	child := createTestPost(t, db, "child", nil)
+	deleted := createTestPost(t, db, "deleted child", &deletedAt)
+	db.MustExec("UPDATE posts SET parent_id = ? WHERE id IN (?, ?)", parent, child, deleted)
+	// The parent counts the deleted child, the child counts a child it doesn't have
+	db.MustExec("UPDATE posts SET children_count = 2 WHERE id = ?", parent)
+	db.MustExec("UPDATE posts SET children_count = 1 WHERE id = ?", child)
+
+	report, err := service.RecomputeChildrenCounts(ctx, true)
+	if err != nil {
+		t.Fatalf("RecomputeChildrenCounts failed: %v", err)
+	}
+	expected := []models.ChildrenCountDrift{{ID: parent, Stored: 2, Actual: 1}, {ID: child, Stored: 1, Actual: 0}}
+	if !slices.Equal(report.Drifts, expected) || report.Fixed {
+		t.Fatalf("expected %+v to be reported, got %+v", expected, report)
+	}
+
+	if _, err := service.RecomputeChildrenCounts(ctx, false); err != nil {
+		t.Fatalf("RecomputeChildrenCounts failed: %v", err)
+	}
+	report, _ = service.RecomputeChildrenCounts(ctx, true)
+	if len(report.Drifts) != 0 {
+		t.Errorf("expected the counts to be fixed, got %+v", report.Drifts)
+	}
+}
+
+func TestGetThread(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	create := func(parentID *int64) int64 {
+		resp, err := service.Create(ctx, models.CreatePostRequest{Content: "<p>post</p>", ParentID: parentID})
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		return resp.ID
+	}
+	root := create(nil)
+	reply := create(&root)
+	nested := create(&reply)
+	other := create(nil)
+
+	thread, err := service.GetThread(ctx, nested)
+	if err != nil {
+		t.Fatalf("GetThread failed: %v", err)
+	}
+	if thread.RootID != root || len(thread.Posts) != 3 {
+		t.Fatalf("expected the 3 posts of the thread of %d, got %+v", root, thread)
+	}
+	if thread.Posts[2].ID != nested || thread.Posts[2].Depth != 2 || *thread.Posts[2].ParentID != reply {
+		t.Errorf("expected the nested reply last at depth 2, got %+v", thread.Posts[2])
+	}
+
+	// Moving a reply moves the posts below it
+	if err := service.Update(ctx, models.UpdatePostRequest{ID: reply, ParentID: types.Some(other)}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	thread, _ = service.GetThread(ctx, nested)
+	if thread.RootID != other || thread.Posts[2].Depth != 2 {
+		t.Errorf("expected the nested reply to move to the thread of %d, got %+v", other, thread)
+	}
+
+	err = service.Update(ctx, models.UpdatePostRequest{ID: other, ParentID: types.Some(nested)})
+	if !errors.Is(err, ErrParentCycle) {
+		t.Errorf("expected a post not to move below itself, got %v", err)
+	}
+
+	// The replies of a purged post start threads of their own, the app enables foreign keys
+	db.MustExec("PRAGMA foreign_keys = ON")
+	db.MustExec("UPDATE posts SET deleted_at = 1 WHERE id = ?", other)
+	if _, _, err := service.ClearAll(ctx); err != nil {
+		t.Fatalf("ClearAll failed: %v", err)
+	}
+	thread, _ = service.GetThread(ctx, nested)
+	if thread.RootID != reply || thread.Posts[1].Depth != 1 {
+		t.Errorf("expected the reply to become a root, got %+v", thread)
+	}
+
+	// Likewise for a single post deleted for good
+	db.MustExec("UPDATE posts SET deleted_at = 1 WHERE id = ?", reply)
+	if _, err := service.HardDelete(ctx, reply); err != nil {
+		t.Fatalf("HardDelete failed: %v", err)
+	}
+	thread, _ = service.GetThread(ctx, nested)
+	if thread.RootID != nested || len(thread.Posts) != 1 || thread.Posts[0].Depth != 0 {
+		t.Errorf("expected the nested reply to become a root, got %+v", thread)
+	}
+
+	if _, err := service.GetThread(ctx, 9999); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("expected ErrPostNotFound, got %v", err)
+	}
+}
+
+func TestUpdateFiles(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	id := createTestPostWithFiles(t, db, `[{"url":"/uploads/a.png","width":10},{"url":"/uploads/b.png"}]`, nil)
+
+	files, err := service.UpdateFiles(ctx, models.UpdateFilesRequest{
+		ID:       id,
+		Order:    []string{"/uploads/b.png", "/uploads/a.png"},
+		Captions: map[string]string{"/uploads/a.png": "a cat"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateFiles failed: %v", err)
+	}
+	if len(files) != 2 || files[0].URL != "/uploads/b.png" || files[1].Caption == nil || *files[1].Caption != "a cat" {
+		t.Fatalf("expected the files reordered with a caption, got %+v", files)
+	}
+	if files[1].Width == nil || *files[1].Width != 10 {
+		t.Errorf("expected the other metadata to be kept, got %+v", files[1])
+	}
+
+	post, _ := service.FindByID(ctx, id)
+	if !strings.Contains(string(post.Files.RawMessage), `"caption":"a cat"`) {
+		t.Errorf("expected the caption to be saved, got %s", post.Files.RawMessage)
+	}
+
+	invalid := []models.UpdateFilesRequest{
+		{ID: id, Captions: map[string]string{"/uploads/c.png": "missing"}},
+		{ID: id, Order: []string{"/uploads/a.png"}},
+		{ID: id, Order: []string{"/uploads/a.png", "/uploads/a.png"}},
+	}
+	for _, req := range invalid {
+		if _, err := service.UpdateFiles(ctx, req); !errors.Is(err, ErrInvalidFiles) {
+			t.Errorf("expected %+v to be invalid, got %v", req, err)
+		}
+	}
+
+	if _, err := service.UpdateFiles(ctx, models.UpdateFilesRequest{ID: 9999}); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("expected ErrPostNotFound, got %v", err)
+	}
+}
+
+func TestGetDailyCountsAcrossDST(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+	at := func(month time.Month, day, hour, min int) int64 {
+		return time.Date(2024, month, day, hour, min, 0, 0, loc).UnixMilli()
+	}
+	deletedAt := models.NullInt64{NullInt64: sql.NullInt64{Int64: at(3, 10, 12, 0), Valid: true}}
+
+	for _, post := range []models.Post{
+		{CreatedAt: at(3, 9, 23, 59)},
+		{CreatedAt: at(3, 10, 0, 30)},
+		// The first hour of the day after the clocks moved forward, the last one of the day before in EST
+		{CreatedAt: at(3, 11, 0, 30)},
+		{CreatedAt: at(3, 11, 12, 0), DeletedAt: deletedAt},
+		{CreatedAt: at(3, 12, 0, 0)},
+		// The 25th hour of the day the clocks moved back, the first one of the next day in EDT
+		{CreatedAt: at(11, 3, 23, 30)},
+		{CreatedAt: at(11, 4, 0, 0)},
+	} {
+		testutil.CreatePost(t, db, post)
+	}
+
+	tests := []struct {
+		start, end time.Time
+		expected   []int64
+	}{
+		{time.Date(2024, 3, 9, 0, 0, 0, 0, loc), time.Date(2024, 3, 12, 0, 0, 0, 0, loc), []int64{1, 1, 1}},
+		{time.Date(2024, 3, 10, 0, 0, 0, 0, loc), time.Date(2024, 3, 13, 0, 0, 0, 0, loc), []int64{1, 1, 1}},
+		{time.Date(2024, 11, 3, 0, 0, 0, 0, loc), time.Date(2024, 11, 5, 0, 0, 0, 0, loc), []int64{1, 1}},
+		{time.Date(2024, 11, 3, 0, 0, 0, 0, loc), time.Date(2024, 11, 3, 0, 0, 0, 0, loc), []int64{}},
+	}
+	for _, tt := range tests {
+		counts, err := service.GetDailyCounts(ctx, tt.start, tt.end)
+		if err != nil {
+			t.Fatalf("GetDailyCounts failed: %v", err)
+		}
+		if !slices.Equal(counts, tt.expected) {
+			t.Errorf("expected %v from %v to %v, got %v", tt.expected, tt.start, tt.end, counts)
+		}
+	}
+}
+
+func TestGroupByThread(t *testing.T) {
+	root := func(id int64) models.NullInt64 {
+		return models.NullInt64{NullInt64: sql.NullInt64{Int64: id, Valid: true}}
+	}
+	// Ordered by relevance: two replies of thread 1, a post alone, thread 1 itself, a reply of thread 5
+	posts := []models.Post{
+		{ID: 3, RootID: root(1)},
+		{ID: 4},
+		{ID: 2, RootID: root(1)},
+		{ID: 1, RootID: root(1)},
+		{ID: 6, RootID: root(5)},
+	}
+
+	grouped := GroupByThread(posts)
+	var got [][2]int64
+	for _, post := range grouped {
+		got = append(got, [2]int64{post.ID, post.ThreadMatches})
+	}
+	expected := [][2]int64{{3, 3}, {4, 1}, {6, 1}}
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected the best post of each thread with its matches %v, got %v", expected, got)
+	}
+}
+
+func TestFilterIDs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewPostService(db)
+	ctx := context.Background()
+
+	red := "red"
+	first := testutil.CreatePost(t, db, models.Post{Color: models.NullString{NullString: sql.NullString{String: red, Valid: true}}})
+	second := testutil.CreatePost(t, db, models.Post{})
+	third := testutil.CreatePost(t, db, models.Post{Color: models.NullString{NullString: sql.NullString{String: red, Valid: true}}})
+	tag := testutil.CreateTag(t, db, models.Tag{Name: "tech"})
+	testutil.TagPost(t, db, tag.ID, third.ID)
+
+	ids, err := service.FilterIDs(ctx, []int64{third.ID, second.ID, first.ID}, models.FilterPostRequest{Color: &red})
+	if err != nil {
+		t.Fatalf("FilterIDs failed: %v", err)
+	}
+	if expected := []int64{third.ID, first.ID}; !slices.Equal(ids, expected) {
+		t.Errorf("expected the red posts in the given order %v, got %v", expected, ids)
+	}
+
+	name := "tech"
+	ids, err = service.FilterIDs(ctx, []int64{first.ID, second.ID, third.ID}, models.FilterPostRequest{Color: &red, Tag: &name})
+	if err != nil {
+		t.Fatalf("FilterIDs failed: %v", err)
+	}
+	if expected := []int64{third.ID}; !slices.Equal(ids, expected) {
+		t.Errorf("expected the red posts under tech %v, got %v", expected, ids)
+	}
+}
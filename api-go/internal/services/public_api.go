@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// usageTTL is how long the daily request counts of the public API keys are kept for the usage reports
+const usageTTL = 32 * 24 * time.Hour
+
+// PublicAPIService checks the keys of the public API and counts their requests against the daily quotas of their tiers
+type PublicAPIService struct {
+	client *redis.Client
+	config *config.PublicAPIConfig
+}
+
+func NewPublicAPIService(client *redis.Client, config *config.PublicAPIConfig) *PublicAPIService {
+	return &PublicAPIService{client: client, config: config}
+}
+
+// LookupKey returns the public API key matching the given one, or nil if there is none
+// All keys are compared in constant time, so that a key can't be guessed from response timing.
+func (s *PublicAPIService) LookupKey(key string) *config.APIKey {
+	if key == "" {
+		return nil
+	}
+	digest := sha256.Sum256([]byte(key))
+	var found *config.APIKey
+	for i := range s.config.Keys {
+		candidate := sha256.Sum256([]byte(s.config.Keys[i].Key))
+		if subtle.ConstantTimeCompare(digest[:], candidate[:]) == 1 {
+			found = &s.config.Keys[i]
+		}
+	}
+	return found
+}
+
+// Quota returns the number of requests per day allowed to the given key
+func (s *PublicAPIService) Quota(key *config.APIKey) int64 {
+	return s.config.Tiers[key.Tier]
+}
+
+// CountRequest counts a request made with the given key today, and returns the number of requests made today
+// Requests over the quota are counted too, so the usage reports show how far a reader went past it.
+func (s *PublicAPIService) CountRequest(ctx context.Context, key *config.APIKey, now time.Time) (int64, error) {
+	usageKey := s.usageKey(key.Name, now)
+
+	pipe := s.client.Pipeline()
+	incrCmd := pipe.Incr(ctx, usageKey)
+	pipe.ExpireNX(ctx, usageKey, usageTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return incrCmd.Val(), nil
+}
+
+// GetUsage reports the requests made with each key on the given number of days up to today
+func (s *PublicAPIService) GetUsage(ctx context.Context, days int, now time.Time) ([]models.APIKeyUsage, error) {
+	usages := make([]models.APIKeyUsage, 0, len(s.config.Keys))
+	if len(s.config.Keys) == 0 {
+		return usages, nil
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make([][]*redis.StringCmd, len(s.config.Keys))
+	for i, key := range s.config.Keys {
+		cmds[i] = make([]*redis.StringCmd, days)
+		for d := range days {
+			cmds[i][d] = pipe.Get(ctx, s.usageKey(key.Name, now.AddDate(0, 0, d-days+1)))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("redis pipeline error: %w", err)
+	}
+
+	for i, key := range s.config.Keys {
+		usage := models.APIKeyUsage{
+			Name:  key.Name,
+			Tier:  key.Tier,
+			Quota: s.Quota(&key),
+			Daily: make([]models.DailyUsage, days),
+		}
+		for d, cmd := range cmds[i] {
+			// A day without requests has no count
+			requests, err := cmd.Int64()
+			if err != nil && err != redis.Nil {
+				return nil, fmt.Errorf("error reading the usage of key %q: %w", key.Name, err)
+			}
+			usage.Daily[d] = models.DailyUsage{
+				Date:     now.AddDate(0, 0, d-days+1).UTC().Format(time.DateOnly),
+				Requests: requests,
+			}
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+// QuotaReset returns when the daily quotas are reset after the given time, at the next UTC midnight
+func QuotaReset(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+func (s *PublicAPIService) usageKey(name string, day time.Time) string {
+	return "public:usage:" + name + ":" + day.UTC().Format(time.DateOnly)
+}
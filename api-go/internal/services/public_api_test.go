@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+)
+
+func TestLookupKey(t *testing.T) {
+	service := NewPublicAPIService(nil, &config.PublicAPIConfig{
+		Keys: []config.APIKey{
+			{Name: "blog", Tier: "free", Key: "k1"},
+			{Name: "reader", Tier: "pro", Key: "k2:with:colons"},
+		},
+		Tiers: map[string]int64{"free": 10, "pro": 100},
+	})
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"k1", "blog"},
+		{"k2:with:colons", "reader"},
+		{"k2", ""},
+		{"K1", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got := service.LookupKey(tt.key)
+		if tt.want == "" {
+			if got != nil {
+				t.Errorf("LookupKey(%q) = %q; want none", tt.key, got.Name)
+			}
+			continue
+		}
+		if got == nil || got.Name != tt.want {
+			t.Errorf("LookupKey(%q) = %v; want %q", tt.key, got, tt.want)
+		}
+	}
+
+	if quota := service.Quota(service.LookupKey("k2:with:colons")); quota != 100 {
+		t.Errorf("expected the quota of the pro tier, got %d", quota)
+	}
+}
+
+func TestQuotaReset(t *testing.T) {
+	tz := time.FixedZone("UTC+8", 8*3600)
+
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC), time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Still March 10 in UTC
+		{time.Date(2024, 3, 11, 7, 0, 0, 0, tz), time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := QuotaReset(tt.now); !got.Equal(tt.want) {
+			t.Errorf("QuotaReset(%v) = %v; want %v", tt.now, got, tt.want)
+		}
+	}
+}
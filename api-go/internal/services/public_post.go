@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/cymoo/mote/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// Visibility is what the public pages and feeds disclose of the vault
+type Visibility int
+
+const (
+	// VisibilityShared discloses the shared posts only
+	VisibilityShared Visibility = iota
+	// VisibilityAll discloses every live post, for a vault run as a public digital garden, see Config.PublicExplore
+	VisibilityAll
+)
+
+// PublicTag is a tag with the number of its posts visible to the public, including the ones of its subtags
+type PublicTag struct {
+	Name  string `db:"name"`
+	Posts int    `db:"posts"`
+}
+
+// PublicPostService reads the posts visible to the public, the only ones the public pages and feeds get to see
+// The visibility is set when the service is created, every query of the service applies it, and the service has no
+// methods writing, so that a route can't disclose or change more than it should whatever it asks.
+type PublicPostService struct {
+	reader     *sqlx.DB
+	visibility Visibility
+}
+
+func NewPublicPostService(reader *sqlx.DB, visibility Visibility) *PublicPostService {
+	return &PublicPostService{reader: reader, visibility: visibility}
+}
+
+// Visibility returns what the service discloses of the vault
+func (s *PublicPostService) Visibility() Visibility {
+	return s.visibility
+}
+
+// visible is the condition of the posts visible to the public, as p
+func (s *PublicPostService) visible() string {
+	if s.visibility == VisibilityAll {
+		return "p.deleted_at IS NULL"
+	}
+	return "p.shared = 1 AND p.deleted_at IS NULL"
+}
+
+// GetPosts retrieves a page of the visible posts, newest first
+func (s *PublicPostService) GetPosts(ctx context.Context, limit, offset int) ([]models.Post, error) {
+	query := `SELECT p.* FROM posts p WHERE ` + s.visible() + ` ORDER BY p.created_at DESC LIMIT ? OFFSET ?`
+	posts := []models.Post{}
+	err := s.reader.SelectContext(ctx, &posts, query, limit, offset)
+	return posts, err
+}
+
+// GetPost retrieves a visible post, it returns sql.ErrNoRows if the post isn't visible
+func (s *PublicPostService) GetPost(ctx context.Context, id int64) (models.Post, error) {
+	var post models.Post
+	err := s.reader.GetContext(ctx, &post, `SELECT p.* FROM posts p WHERE p.id = ? AND `+s.visible(), id)
+	return post, err
+}
+
+// GetTagPosts retrieves a page of the visible posts associated with a tag (including subtags), newest first
+func (s *PublicPostService) GetTagPosts(ctx context.Context, name string, limit, offset int) ([]models.Post, error) {
+	namePattern := escapeLike(name) + "/%"
+	query := `
+		SELECT p.*
+		FROM posts p
+		WHERE EXISTS (
+			SELECT 1
+			FROM tags t
+			JOIN tag_post_assoc tp ON t.id = tp.tag_id
+			WHERE tp.post_id = p.id
+			AND (t.name = ? OR t.name LIKE ? ESCAPE '\')
+			AND t.deleted_at IS NULL
+		)
+		AND ` + s.visible() + `
+		ORDER BY p.created_at DESC
+		LIMIT ? OFFSET ?
+	`
+
+	posts := []models.Post{}
+	err := s.reader.SelectContext(ctx, &posts, query, name, namePattern, limit, offset)
+	return posts, err
+}
+
+// GetTags retrieves the live tags with visible posts, by name
+// The posts of a tag count its own and the ones of its subtags, a tag whose posts are all under its subtags is listed
+// too, so that the tree of tags can be browsed.
+func (s *PublicPostService) GetTags(ctx context.Context) ([]PublicTag, error) {
+	query := `
+		SELECT t.name, COUNT(DISTINCT p.id) AS posts
+		FROM tags t
+		JOIN tags d ON (d.name = t.name OR d.name LIKE (t.name || '/%')) AND d.deleted_at IS NULL
+		JOIN tag_post_assoc tp ON tp.tag_id = d.id
+		JOIN posts p ON p.id = tp.post_id AND ` + s.visible() + `
+		WHERE t.deleted_at IS NULL
+		GROUP BY t.id
+		ORDER BY t.name
+	`
+	tags := []PublicTag{}
+	err := s.reader.SelectContext(ctx, &tags, query)
+	return tags, err
+}
+
+// GetPage retrieves a page of the visible posts among the IDs, in their order, e.g. the matches of a search
+// It returns the number of visible posts among the IDs too.
+func (s *PublicPostService) GetPage(ctx context.Context, ids []int64, limit, offset int) ([]models.Post, int, error) {
+	ids, err := s.visibleIDs(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(ids)
+	posts, err := s.getByIDs(ctx, ids[min(offset, total):min(offset+limit, total)])
+	return posts, total, err
+}
+
+// visibleIDs keeps the IDs of the visible posts, in their order
+func (s *PublicPostService) visibleIDs(ctx context.Context, ids []int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return []int64{}, nil
+	}
+	idsJSON, _ := json.Marshal(ids)
+	var matched []int64
+	query := `SELECT p.id FROM posts p WHERE p.id IN (SELECT value FROM json_each(?)) AND ` + s.visible()
+	if err := s.reader.SelectContext(ctx, &matched, query, string(idsJSON)); err != nil {
+		return nil, err
+	}
+
+	keep := make(map[int64]bool, len(matched))
+	for _, id := range matched {
+		keep[id] = true
+	}
+	visible := make([]int64, 0, len(matched))
+	for _, id := range ids {
+		if keep[id] {
+			visible = append(visible, id)
+		}
+	}
+	return visible, nil
+}
+
+// getByIDs retrieves the visible posts of the IDs, in their order
+func (s *PublicPostService) getByIDs(ctx context.Context, ids []int64) ([]models.Post, error) {
+	posts := make([]models.Post, 0, len(ids))
+	for _, id := range ids {
+		post, err := s.GetPost(ctx, id)
+		if err == sql.ErrNoRows {
+			// Deleted or unshared since it was searched
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+func postIDs(posts []models.Post) []int64 {
+	ids := make([]int64, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	return ids
+}
+
+func TestPublicPostService(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	tagID := createTestTag(t, db, "tech", false)
+	subtagID := createTestTag(t, db, "tech/golang", false)
+	deletedAt := time.Now().UnixMilli()
+
+	shared := createTestPost(t, db, "shared", nil)
+	db.MustExec("UPDATE posts SET shared = 1, created_at = 1 WHERE id = ?", shared)
+	associateTagPost(t, db, subtagID, shared)
+	private := createTestPost(t, db, "private", nil)
+	db.MustExec("UPDATE posts SET created_at = 2 WHERE id = ?", private)
+	associateTagPost(t, db, tagID, private)
+	deleted := createTestPost(t, db, "deleted", &deletedAt)
+	db.MustExec("UPDATE posts SET shared = 1 WHERE id = ?", deleted)
+	associateTagPost(t, db, tagID, deleted)
+
+	tests := []struct {
+		visibility Visibility
+		want       []int64
+		tags       []PublicTag
+	}{
+		{VisibilityShared, []int64{shared}, []PublicTag{{"tech", 1}, {"tech/golang", 1}}},
+		{VisibilityAll, []int64{private, shared}, []PublicTag{{"tech", 2}, {"tech/golang", 1}}},
+	}
+	for _, tt := range tests {
+		service := NewPublicPostService(db.DB, tt.visibility)
+
+		posts, err := service.GetPosts(ctx, 10, 0)
+		if err != nil {
+			t.Fatalf("GetPosts failed: %v", err)
+		}
+		if got := postIDs(posts); !slices.Equal(got, tt.want) {
+			t.Errorf("visibility %d: expected the posts %v, got %v", tt.visibility, tt.want, got)
+		}
+
+		posts, err = service.GetTagPosts(ctx, "tech", 10, 0)
+		if err != nil {
+			t.Fatalf("GetTagPosts failed: %v", err)
+		}
+		if got := postIDs(posts); !slices.Equal(got, tt.want) {
+			t.Errorf("visibility %d: expected the posts %v under the tag, got %v", tt.visibility, tt.want, got)
+		}
+
+		tags, err := service.GetTags(ctx)
+		if err != nil {
+			t.Fatalf("GetTags failed: %v", err)
+		}
+		if len(tags) != len(tt.tags) || tags[0] != tt.tags[0] || tags[1] != tt.tags[1] {
+			t.Errorf("visibility %d: expected the tags %v, got %v", tt.visibility, tt.tags, tags)
+		}
+
+		// The matches of a search keep their order
+		posts, total, err := service.GetPage(ctx, []int64{deleted, shared, private}, 1, 0)
+		if err != nil {
+			t.Fatalf("GetPage failed: %v", err)
+		}
+		if total != len(tt.want) || len(posts) != 1 || posts[0].ID != shared {
+			t.Errorf("visibility %d: expected the first of %d visible matches, got %v of %d",
+				tt.visibility, len(tt.want), postIDs(posts), total)
+		}
+
+		if _, err := service.GetPost(ctx, deleted); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("visibility %d: expected a deleted post to be hidden, got %v", tt.visibility, err)
+		}
+		_, err = service.GetPost(ctx, private)
+		if visible := err == nil; visible != (tt.visibility == VisibilityAll) {
+			t.Errorf("visibility %d: expected the private post visible only to all, got %v", tt.visibility, err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// removedSpan marks the place of a removed hash-tag span until the emptied paragraphs are dropped
+const removedSpan = "\x00"
+
+// emptiedParagraphRegex matches a paragraph left with nothing but removed spans and whitespace
+var emptiedParagraphRegex = regexp.MustCompile(`<p>(?:\s|&nbsp;|\x00)*\x00(?:\s|&nbsp;|\x00)*</p>`)
+
+// Retag adds and removes tags across posts in one transaction
+// Added tags are appended to the content as hash-tag spans and removed ones are stripped from it,
+// the tag associations follow the content. Removing a tag leaves its subtags in place.
+// With DryRun, the changes are computed but nothing is written.
+func (s *TagService) Retag(ctx context.Context, req models.RetagRequest) (*models.RetagResult, error) {
+	if !req.DryRun {
+		release, err := s.writes.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids, err := s.retagTargets(ctx, tx.Tx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.RetagResult{Matched: len(ids), Changes: []models.RetagChange{}, DryRun: req.DryRun}
+	now := time.Now().UnixMilli()
+
+	for _, id := range ids {
+		var content string
+		if err := tx.GetContext(ctx, &content, "SELECT content FROM posts WHERE id = ?", id); err != nil {
+			return nil, err
+		}
+
+		updated, change := retagContent(content, req.Add, req.Remove)
+		if len(change.Added) == 0 && len(change.Removed) == 0 {
+			continue
+		}
+		change.ID, change.Content = id, updated
+		result.Changes = append(result.Changes, change)
+		if req.DryRun {
+			continue
+		}
+
+		title, description := ExtractTitleAndDescription(updated)
+		_, err := tx.ExecContext(ctx,
+			"UPDATE posts SET content = ?, title = ?, description = ?, updated_at = ? WHERE id = ?",
+			updated, title, description, now, id)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range change.Added {
+			tag, err := s.findOrCreate(ctx, tx.Tx, name)
+			if err != nil {
+				return nil, err
+			}
+			_, err = tx.ExecContext(ctx,
+				"INSERT OR IGNORE INTO tag_post_assoc (post_id, tag_id) VALUES (?, ?)", id, tag.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, name := range change.Removed {
+			_, err := tx.ExecContext(ctx,
+				"DELETE FROM tag_post_assoc WHERE post_id = ? AND tag_id IN (SELECT id FROM tags WHERE name = ?)",
+				id, name)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if req.DryRun {
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// retagTargets returns the IDs of the posts selected by a retag request
+// Posts given by ID are only selected if they are not deleted
+func (s *TagService) retagTargets(ctx context.Context, tx *sqlx.Tx, req models.RetagRequest) ([]int64, error) {
+	ids := make([]int64, 0)
+
+	if len(req.IDs) > 0 {
+		idsJSON, _ := json.Marshal(req.IDs)
+		query := `
+			SELECT id FROM posts
+			WHERE id IN (SELECT value FROM json_each(?)) AND deleted_at IS NULL
+			ORDER BY id
+		`
+		err := tx.SelectContext(ctx, &ids, query, string(idsJSON))
+		return ids, err
+	}
+
+	if req.Filter == nil {
+		return ids, nil
+	}
+
+	from, conditions, args := filterConditions(*req.Filter)
+	query := "SELECT DISTINCT p.id " + from
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY p.id"
+
+	err := tx.SelectContext(ctx, &ids, query, args...)
+	return ids, err
+}
+
+// retagContent adds and removes hash tags in the content of a post
+// It returns the new content and the tags actually added and removed.
+func retagContent(content string, add, remove []string) (string, models.RetagChange) {
+	change := models.RetagChange{Added: []string{}, Removed: []string{}}
+	current := extractHashTags(content)
+
+	for _, name := range remove {
+		if !current[name] {
+			continue
+		}
+		span := fmt.Sprintf(`<span class="hash-tag">#%s</span>`, name)
+		content = strings.ReplaceAll(content, span, removedSpan)
+		delete(current, name)
+		change.Removed = append(change.Removed, name)
+	}
+	if len(change.Removed) > 0 {
+		content = emptiedParagraphRegex.ReplaceAllString(content, "")
+		content = strings.ReplaceAll(content, removedSpan, "")
+	}
+
+	var spans []string
+	for _, name := range add {
+		if current[name] {
+			continue
+		}
+		spans = append(spans, fmt.Sprintf(`<span class="hash-tag">#%s</span>`, name))
+		current[name] = true
+		change.Added = append(change.Added, name)
+	}
+	if len(spans) > 0 {
+		content += "<p>" + strings.Join(spans, " ") + "</p>"
+	}
+
+	return content, change
+}
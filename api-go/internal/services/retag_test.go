@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+func TestRetagContent(t *testing.T) {
+	content := `<p>Hello <span class="hash-tag">#a</span> world</p><p><span class="hash-tag">#b</span> <span class="hash-tag">#a</span></p>`
+
+	updated, change := retagContent(content, []string{"c", "b"}, []string{"a", "missing"})
+	expected := `<p>Hello  world</p><p><span class="hash-tag">#b</span> </p><p><span class="hash-tag">#c</span></p>`
+	if updated != expected {
+		t.Errorf("unexpected content:\n got %s\nwant %s", updated, expected)
+	}
+	if len(change.Added) != 1 || change.Added[0] != "c" {
+		t.Errorf("expected c to be added, got %v", change.Added)
+	}
+	if len(change.Removed) != 1 || change.Removed[0] != "a" {
+		t.Errorf("expected a to be removed, got %v", change.Removed)
+	}
+
+	// A paragraph holding only the removed tag is dropped
+	updated, _ = retagContent(`<p>Text</p><p><span class="hash-tag">#a</span></p><p></p>`, nil, []string{"a"})
+	if updated != `<p>Text</p><p></p>` {
+		t.Errorf("expected the emptied paragraph to be dropped, got %s", updated)
+	}
+
+	// Subtags are left in place
+	updated, change = retagContent(`<p><span class="hash-tag">#a/b</span></p>`, nil, []string{"a"})
+	if updated != `<p><span class="hash-tag">#a/b</span></p>` || len(change.Removed) != 0 {
+		t.Errorf("expected the subtag to be kept, got %s", updated)
+	}
+}
+
+func TestRetag(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewTagService(db)
+	ctx := context.Background()
+
+	oldID := createTestTag(t, db, "old", false)
+	first := createTestPost(t, db, `<p>First <span class="hash-tag">#old</span></p>`, nil)
+	second := createTestPost(t, db, `<p>Second</p>`, nil)
+	deletedAt := int64(1)
+	deleted := createTestPost(t, db, `<p>Deleted</p>`, &deletedAt)
+	associateTagPost(t, db, oldID, first)
+
+	req := models.RetagRequest{
+		IDs:    []int64{first, second, deleted},
+		Add:    []string{"new"},
+		Remove: []string{"old"},
+		DryRun: true,
+	}
+
+	// Dry run
+	result, err := service.Retag(ctx, req)
+	if err != nil {
+		t.Fatalf("Retag failed: %v", err)
+	}
+	if result.Matched != 2 || len(result.Changes) != 2 || !result.DryRun {
+		t.Fatalf("expected 2 matched and changed posts, got %+v", result)
+	}
+	var content string
+	db.Get(&content, "SELECT content FROM posts WHERE id = ?", first)
+	if content != `<p>First <span class="hash-tag">#old</span></p>` {
+		t.Errorf("expected a dry run to leave the content, got %s", content)
+	}
+	var count int
+	db.Get(&count, "SELECT COUNT(*) FROM tags WHERE name = 'new'")
+	if count != 0 {
+		t.Errorf("expected a dry run not to create tags")
+	}
+
+	// Apply
+	req.DryRun = false
+	if _, err := service.Retag(ctx, req); err != nil {
+		t.Fatalf("Retag failed: %v", err)
+	}
+	db.Get(&content, "SELECT content FROM posts WHERE id = ?", first)
+	if content != `<p>First </p><p><span class="hash-tag">#new</span></p>` {
+		t.Errorf("unexpected content: %s", content)
+	}
+
+	var names []string
+	db.Select(&names, `
+		SELECT t.name FROM tags t JOIN tag_post_assoc tpa ON tpa.tag_id = t.id
+		WHERE tpa.post_id = ? ORDER BY t.name`, first)
+	if len(names) != 1 || names[0] != "new" {
+		t.Errorf("expected the post to be tagged new only, got %v", names)
+	}
+	db.Get(&count, `
+		SELECT COUNT(*) FROM tag_post_assoc tpa JOIN tags t ON t.id = tpa.tag_id
+		WHERE t.name = 'new'`)
+	if count != 2 {
+		t.Errorf("expected 2 posts tagged new, got %d", count)
+	}
+
+	// Filter
+	newTag := "new"
+	result, err = service.Retag(ctx, models.RetagRequest{
+		Filter: &models.FilterPostRequest{Tag: &newTag},
+		Add:    []string{"new"},
+	})
+	if err != nil {
+		t.Fatalf("Retag failed: %v", err)
+	}
+	if result.Matched != 2 || len(result.Changes) != 0 {
+		t.Errorf("expected 2 matched posts already tagged, got %+v", result)
+	}
+}
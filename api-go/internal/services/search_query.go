@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+// ParseSearchQuery parses the operators out of the text of a search query into filter options, e.g.
+// "tag:tech before:2024-01-01 color:red golang" searches "golang" in the red posts under tech created before 2024
+// The operators are:
+//
+//	tag:NAME        the posts under the tag or its subtags
+//	color:NAME      the posts of the color
+//	before:DATE     the posts created before the day, as YYYY-MM-DD in loc
+//	after:DATE      the posts created on the day or after it
+//	is:shared       the shared posts
+//	has:files       the posts with files
+//
+// The names of the operators are case-insensitive, the last one wins if an operator is repeated. The words looking
+// like operators but unknown, e.g. "http://example.com", are left in the text. The filter is nil without operators,
+// and invalid values return an error wrapping ErrInvalidFilter.
+func ParseSearchQuery(query string, loc *time.Location) (string, *models.FilterPostRequest, error) {
+	var words []string
+	var filter models.FilterPostRequest
+	found := false
+	for _, word := range strings.Fields(query) {
+		name, value, ok := strings.Cut(word, ":")
+		if !ok || value == "" {
+			words = append(words, word)
+			continue
+		}
+
+		switch strings.ToLower(name) {
+		case "tag":
+			filter.Tag = &value
+		case "color":
+			filter.Color = &value
+		case "before", "after":
+			day, err := time.ParseInLocation(time.DateOnly, value, loc)
+			if err != nil {
+				return "", nil, fmt.Errorf("%w: invalid date '%s' in %s:, must be in YYYY-MM-DD format",
+					ErrInvalidFilter, value, name)
+			}
+			if strings.EqualFold(name, "before") {
+				end := day.UnixMilli() - 1
+				filter.EndDate = &end
+			} else {
+				start := day.UnixMilli()
+				filter.StartDate = &start
+			}
+		case "is", "has":
+			switch strings.ToLower(name + ":" + value) {
+			case "is:shared":
+				shared := true
+				filter.Shared = &shared
+			case "has:files":
+				hasFiles := true
+				filter.HasFiles = &hasFiles
+			default:
+				return "", nil, fmt.Errorf("%w: unknown operator '%s', expected is:shared or has:files", ErrInvalidFilter, word)
+			}
+		default:
+			words = append(words, word)
+			continue
+		}
+		found = true
+	}
+
+	text := strings.Join(words, " ")
+	if !found {
+		return text, nil, nil
+	}
+	if err := ValidateFilter(filter); err != nil {
+		return "", nil, err
+	}
+	return text, &filter, nil
+}
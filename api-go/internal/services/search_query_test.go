@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	loc := time.FixedZone("", 8*3600)
+	text, filter, err := ParseSearchQuery("golang Tag:tech before:2024-01-01 after:2023-06-01 color:red is:shared https://go.dev", loc)
+	if err != nil {
+		t.Fatalf("ParseSearchQuery failed: %v", err)
+	}
+	if text != "golang https://go.dev" {
+		t.Errorf("expected the text without the operators, got %q", text)
+	}
+	if filter == nil || *filter.Tag != "tech" || *filter.Color != "red" || !*filter.Shared || filter.HasFiles != nil {
+		t.Fatalf("expected the tag, color and shared filters, got %+v", filter)
+	}
+	before := time.Date(2024, 1, 1, 0, 0, 0, 0, loc).UnixMilli() - 1
+	after := time.Date(2023, 6, 1, 0, 0, 0, 0, loc).UnixMilli()
+	if *filter.EndDate != before || *filter.StartDate != after {
+		t.Errorf("expected the dates %d to %d, got %d to %d", after, before, *filter.StartDate, *filter.EndDate)
+	}
+
+	if text, filter, err := ParseSearchQuery("note: rust", loc); err != nil || filter != nil || text != "note: rust" {
+		t.Errorf("expected a query without operators to be left as is, got %q, %+v, %v", text, filter, err)
+	}
+
+	for _, query := range []string{"before:yesterday", "is:pinned", "after:2024-02-01 before:2024-01-01"} {
+		if _, _, err := ParseSearchQuery(query, loc); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("expected %q to be invalid, got %v", query, err)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Session is a server-side login session, identified by a random ID stored in a cookie
+type Session struct {
+	ID         string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	RotatedAt  time.Time `json:"rotated_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	RememberMe bool      `json:"remember_me"`
+	// TwoFactor is set if a second factor was verified at login
+	TwoFactor bool `json:"two_factor"`
+	// Superseded is set once the session is rotated, its ID is then accepted until the end of the grace period and
+	// never rotated again, see Rotate
+	Superseded bool `json:"superseded,omitempty"`
+}
+
+type sessionContextKey struct{}
+
+// WithSession returns a copy of ctx carrying the given session
+func WithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, session)
+}
+
+// SessionFromContext returns the session of the current request, or nil if it was not authenticated by one
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return session
+}
+
+type SessionService struct {
+	client *redis.Client
+	config *config.SessionConfig
+}
+
+func NewSessionService(client *redis.Client, config *config.SessionConfig) *SessionService {
+	return &SessionService{client: client, config: config}
+}
+
+// Create starts a new session, which lives longer if rememberMe is set
+func (s *SessionService) Create(ctx context.Context, rememberMe, twoFactor bool) (*Session, error) {
+	now := time.Now()
+	session := &Session{
+		CreatedAt:  now,
+		RotatedAt:  now,
+		RememberMe: rememberMe,
+		TwoFactor:  twoFactor,
+	}
+	session.ExpiresAt = now.Add(s.ttl(session))
+
+	if err := s.save(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Get returns the session with the given ID, or nil if it does not exist or has expired
+func (s *SessionService) Get(ctx context.Context, id string) (*Session, error) {
+	return s.load(ctx, s.client, id)
+}
+
+// load reads the session with the given ID with c, e.g. in a transaction, or nil if it does not exist
+func (s *SessionService) load(ctx context.Context, c redis.Cmdable, id string) (*Session, error) {
+	data, err := c.Get(ctx, s.key(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	session.ID = id
+	return &session, nil
+}
+
+// NeedsRotation reports whether the session ID is older than the rotation interval, and not superseded yet
+func (s *SessionService) NeedsRotation(session *Session) bool {
+	return !session.Superseded && time.Since(session.RotatedAt) > s.config.RotateInterval
+}
+
+// rotationGrace is how long the old ID of a rotated session stays valid, for the requests sent in parallel with it
+const rotationGrace = 10 * time.Second
+
+// errSuperseded is returned when rotating a session already rotated by another request
+var errSuperseded = errors.New("session already rotated")
+
+// Rotate replaces the session with a new ID and extends its expiration
+// The old ID is marked as superseded and stays valid for a few seconds, so that the requests already sent with it
+// don't fail, and then expires, which limits the use of a leaked cookie. A session is rotated once: rotating a
+// superseded one, or one rotated meanwhile by a request sent in parallel, returns it as it is.
+func (s *SessionService) Rotate(ctx context.Context, session *Session) (*Session, error) {
+	if session.Superseded {
+		return session, nil
+	}
+
+	now := time.Now()
+	rotated := &Session{
+		CreatedAt:  session.CreatedAt,
+		RotatedAt:  now,
+		RememberMe: session.RememberMe,
+		TwoFactor:  session.TwoFactor,
+	}
+	rotated.ExpiresAt = now.Add(s.ttl(rotated))
+
+	if err := s.save(ctx, rotated); err != nil {
+		return nil, err
+	}
+
+	// The old record is superseded before it expires, in a transaction: of the requests rotating it at once, one wins
+	key := s.key(session.ID)
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		old, err := s.load(ctx, tx, session.ID)
+		if err != nil {
+			return err
+		}
+		if old == nil || old.Superseded {
+			return errSuperseded
+		}
+		old.Superseded = true
+		old.ExpiresAt = now.Add(rotationGrace)
+		data, err := json.Marshal(old)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, rotationGrace)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		if delErr := s.Delete(ctx, rotated.ID); delErr != nil {
+			return nil, delErr
+		}
+		if errors.Is(err, errSuperseded) || errors.Is(err, redis.TxFailedErr) {
+			return session, nil
+		}
+		return nil, err
+	}
+	return rotated, nil
+}
+
+// Delete ends the session with the given ID
+func (s *SessionService) Delete(ctx context.Context, id string) error {
+	return s.client.Del(ctx, s.key(id)).Err()
+}
+
+// save assigns a new random ID to the session and stores it until it expires
+func (s *SessionService) save(ctx context.Context, session *Session) error {
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.Set(ctx, s.key(id), data, time.Until(session.ExpiresAt)).Err(); err != nil {
+		return err
+	}
+	session.ID = id
+	return nil
+}
+
+func (s *SessionService) ttl(session *Session) time.Duration {
+	if session.RememberMe {
+		return s.config.RememberTTL
+	}
+	return s.config.TTL
+}
+
+func (s *SessionService) key(id string) string {
+	return "session:" + id
+}
+
+// newSessionID generates a URL-safe random session ID with 256 bits of entropy
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/testutil"
+)
+
+func TestRotateSession(t *testing.T) {
+	client, server := testutil.NewRedis(t)
+	service := NewSessionService(client, &config.SessionConfig{TTL: time.Hour, RememberTTL: 24 * time.Hour})
+	ctx := context.Background()
+
+	session, err := service.Create(ctx, false, false)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	// Requests sent at once with the same cookie read the session before either rotates it
+	parallel, _ := service.Get(ctx, session.ID)
+
+	rotated, err := service.Rotate(ctx, session)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if rotated.ID == session.ID {
+		t.Fatal("expected a new session ID")
+	}
+	if again, err := service.Rotate(ctx, parallel); err != nil || again.ID != session.ID {
+		t.Errorf("expected the session rotated meanwhile to be returned as it is, got %+v, %v", again, err)
+	}
+
+	// The old ID is accepted during the grace period, and replaying it neither rotates it nor extends it
+	server.FastForward(rotationGrace / 2)
+	old, err := service.Get(ctx, session.ID)
+	if err != nil || old == nil || !old.Superseded {
+		t.Fatalf("expected the old session to be accepted as superseded, got %+v, %v", old, err)
+	}
+	if service.NeedsRotation(old) {
+		t.Error("expected a superseded session to need no rotation")
+	}
+	if replayed, err := service.Rotate(ctx, old); err != nil || replayed.ID != session.ID {
+		t.Errorf("expected a superseded session not to be rotated again, got %+v, %v", replayed, err)
+	}
+	if ttl := server.TTL(service.key(session.ID)); ttl > rotationGrace/2 {
+		t.Errorf("expected the grace period not to be extended, got %v left", ttl)
+	}
+	if keys := server.Keys(); len(keys) != 2 {
+		t.Errorf("expected the old and the rotated session only, got %v", keys)
+	}
+
+	server.FastForward(rotationGrace / 2)
+	if old, _ := service.Get(ctx, session.ID); old != nil {
+		t.Errorf("expected the old session to expire after the grace period, got %+v", old)
+	}
+	if current, _ := service.Get(ctx, rotated.ID); current == nil || current.Superseded {
+		t.Errorf("expected the rotated session to stay valid, got %+v", current)
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/cymoo/mote/internal/models"
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// ContentSniffer detects the content type of a file from its magic numbers
+type ContentSniffer interface {
+	// Sniff returns the media type of the content, without parameters, e.g. "image/webp"
+	// It returns "application/octet-stream" for an unknown content.
+	Sniff(r io.Reader) (string, error)
+}
+
+// MagicSniffer detects the content type with a library of magic numbers, knowing many more formats than
+// http.DetectContentType, e.g. the animated and lossless variants of WEBP, HEIC and the Office documents
+type MagicSniffer struct{}
+
+func (MagicSniffer) Sniff(r io.Reader) (string, error) {
+	mime, err := mimetype.DetectReader(r)
+	if err != nil {
+		return "", err
+	}
+	return mediaType(mime.String()), nil
+}
+
+// HTTPSniffer detects the content type with http.DetectContentType, the algorithm of browsers
+type HTTPSniffer struct{}
+
+func (HTTPSniffer) Sniff(r io.Reader) (string, error) {
+	// Read 512 bytes as per http.DetectContentType documentation
+	buffer := make([]byte, 512)
+	n, err := io.ReadFull(r, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return mediaType(http.DetectContentType(buffer[:n])), nil
+}
+
+// unknownContentType is the content type of a file that couldn't be recognized
+const unknownContentType = "application/octet-stream"
+
+// mediaType strips the parameters of a content type, e.g. the charset of a text
+func mediaType(contentType string) string {
+	media, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(media))
+}
+
+// detectContentType detects the content type of a file from its first bytes
+func (s *UploadService) detectContentType(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return s.sniffer.Sniff(file)
+}
+
+// contentType returns the content type of an uploaded file, kept with the file since it was first detected
+// It returns true if it was detected now, the file then carrying it to be saved with the post.
+func (s *UploadService) contentType(file *models.FileInfo, filePath string) (string, bool, error) {
+	if file.ContentType != nil {
+		return *file.ContentType, false, nil
+	}
+	contentType, err := s.detectContentType(filePath)
+	if err != nil {
+		return "", false, err
+	}
+	file.ContentType = &contentType
+	return contentType, true, nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+)
+
+// heicHeader is the start of a HEIC image, its ftyp box
+var heicHeader = []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+
+// webpLossless is the start of a lossless WEBP image
+var webpLossless = []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+
+func docx(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"[Content_Types].xml", "word/document.xml"} {
+		f, _ := w.Create(name)
+		f.Write([]byte("<xml/>"))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to write docx: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestMagicSniffer(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"webp lossless", webpLossless, "image/webp"},
+		{"heic", heicHeader, "image/heic"},
+		{"docx", docx(t), "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"text", []byte("notes"), "text/plain"},
+		{"unknown", []byte{0x00, 0x01, 0x02, 0x03}, unknownContentType},
+	}
+	for _, tt := range tests {
+		got, err := MagicSniffer{}.Sniff(bytes.NewReader(tt.content))
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Sniff() = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	// The algorithm of browsers doesn't know HEIC
+	if got, _ := (HTTPSniffer{}).Sniff(bytes.NewReader(heicHeader)); got != unknownContentType {
+		t.Errorf("HTTPSniffer: Sniff() = %q, want %q", got, unknownContentType)
+	}
+}
+
+// countingSniffer counts the contents sniffed
+type countingSniffer struct {
+	ContentSniffer
+	calls int
+}
+
+func (s *countingSniffer) Sniff(r io.Reader) (string, error) {
+	s.calls++
+	return s.ContentSniffer.Sniff(r)
+}
+
+func TestUploadContentTypes(t *testing.T) {
+	upload := &config.UploadConfig{
+		BaseURL: "/uploads", BasePath: t.TempDir(), ImageFormats: []string{"png", "heic"}, ThumbWidth: 16,
+	}
+	uploads := NewUploadService(upload, NewImagePool(upload))
+	ctx := context.Background()
+
+	// The content type sent by the client is not trusted
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 32, 32)))
+	img, err := uploads.SaveFile(ctx, "photo.jpg", "application/pdf", &buf)
+	if err != nil {
+		t.Fatalf("failed to save image: %v", err)
+	}
+	if img.ContentType == nil || *img.ContentType != "image/png" || img.ThumbURL == nil {
+		t.Errorf("expected a PNG with a thumbnail, got %+v", img)
+	}
+
+	// An image that can't be decoded is kept like a regular file
+	heic, err := uploads.SaveFile(ctx, "photo.heic", "", bytes.NewReader(heicHeader))
+	if err != nil {
+		t.Fatalf("failed to save HEIC: %v", err)
+	}
+	if heic.ContentType == nil || *heic.ContentType != "image/heic" || heic.ThumbURL != nil {
+		t.Errorf("expected a HEIC without thumbnail, got %+v", heic)
+	}
+
+	// An unknown content keeps the content type sent by the client
+	blob, err := uploads.SaveFile(ctx, "data.bin", "application/x-custom; v=1", bytes.NewReader([]byte{0, 1, 2, 3}))
+	if err != nil {
+		t.Fatalf("failed to save file: %v", err)
+	}
+	if blob.ContentType == nil || *blob.ContentType != "application/x-custom" {
+		t.Errorf("expected the content type of the client, got %+v", blob)
+	}
+
+	// The content type saved with a file isn't detected again
+	sniffer := &countingSniffer{ContentSniffer: MagicSniffer{}}
+	uploads.sniffer = sniffer
+	if _, changed, err := uploads.RegenerateThumbnail(ctx, *heic); err != nil || changed || sniffer.calls != 0 {
+		t.Errorf("expected the saved content type to be used, got changed=%v err=%v calls=%d", changed, err, sniffer.calls)
+	}
+
+	// The content type of a file uploaded before it was saved is detected once
+	legacy := filepath.Join(upload.BasePath, "legacy.txt")
+	os.WriteFile(legacy, []byte("notes"), 0644)
+	file, changed, err := uploads.RegenerateThumbnail(ctx, models.FileInfo{URL: "/uploads/legacy.txt"})
+	if err != nil || !changed || file.ContentType == nil || *file.ContentType != "text/plain" {
+		t.Errorf("expected the content type to be detected, got %+v changed=%v err=%v", file, changed, err)
+	}
+	if _, changed, _ := uploads.RegenerateThumbnail(ctx, file); changed || sniffer.calls != 1 {
+		t.Errorf("expected the content type to be detected once, got changed=%v calls=%d", changed, sniffer.calls)
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cymoo/mote/pkg/util/cache"
+)
+
+// contentWrites is the write queue of a database for the writes of posts and tags, counting them once finished
+// A failed write is counted as well, which only costs a cache miss.
+type contentWrites struct {
+	queue   *WriteQueue
+	changes *atomic.Int64
+}
+
+func contentWritesFor(db *DB) contentWrites {
+	return contentWrites{queue: db.writes, changes: db.changes}
+}
+
+// Acquire waits for the turn of the caller to write, like WriteQueue.Acquire
+func (w contentWrites) Acquire(ctx context.Context) (func(), error) {
+	release, err := w.queue.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			release()
+			w.changes.Add(1)
+		})
+	}, nil
+}
+
+// StatsCache caches the aggregate counts of posts and tags for a short TTL, until posts or tags change
+// The cache is in-memory: the writes of other instances sharing the database only show once the TTL expires.
+type StatsCache struct {
+	ttl     time.Duration
+	entries *cache.TTLCache[string, statsEntry]
+	changes *atomic.Int64
+}
+
+// statsEntry is a cached value, valid while the count of changes is the one it was computed at
+type statsEntry struct {
+	value   any
+	changes int64
+}
+
+// NewStatsCache creates a StatsCache of the counts of the database, a ttl of 0 disables it
+func NewStatsCache(db *DB, ttl time.Duration) *StatsCache {
+	return &StatsCache{
+		ttl:     ttl,
+		entries: cache.New[string, statsEntry](ttl, 64),
+		changes: db.changes,
+	}
+}
+
+// CachedStats returns the value cached under the key, or computes and caches it if posts or tags changed since,
+// it expired, or refresh is true
+func CachedStats[V any](ctx context.Context, c *StatsCache, key string, refresh bool, compute func(context.Context) (V, error)) (V, error) {
+	// Read before computing, so that a change during the computation makes the value stale
+	changes := c.changes.Load()
+	if !refresh && c.ttl > 0 {
+		if entry, ok := c.entries.Get(key); ok && entry.changes == changes {
+			return entry.value.(V), nil
+		}
+	}
+
+	value, err := compute(ctx)
+	if err != nil {
+		return value, err
+	}
+	if c.ttl <= 0 {
+		return value, nil
+	}
+	c.entries.Set(key, statsEntry{value: value, changes: changes})
+	return value, nil
+}
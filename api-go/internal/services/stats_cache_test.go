@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/testutil"
+)
+
+func TestCachedStats(t *testing.T) {
+	db := setupTestDB(t)
+	cache := NewStatsCache(db, time.Minute)
+	tagService := NewTagService(db)
+	ctx := context.Background()
+
+	computed := 0
+	count := func(ctx context.Context) (int64, error) {
+		computed++
+		return tagService.GetCount(ctx)
+	}
+	get := func(refresh bool) int64 {
+		t.Helper()
+		n, err := CachedStats(ctx, cache, "tags", refresh, count)
+		if err != nil {
+			t.Fatalf("CachedStats failed: %v", err)
+		}
+		return n
+	}
+
+	get(false)
+	if n := get(false); n != 0 || computed != 1 {
+		t.Errorf("expected the count to be cached, got %d computed %d times", n, computed)
+	}
+
+	// A write of a tag makes the count stale
+	if err := tagService.InsertOrUpdate(ctx, "go", false); err != nil {
+		t.Fatalf("InsertOrUpdate failed: %v", err)
+	}
+	if n := get(false); n != 1 || computed != 2 {
+		t.Errorf("expected the count to be computed again, got %d computed %d times", n, computed)
+	}
+
+	// A write outside of the services isn't seen until refreshed
+	testutil.CreateTag(t, db.DB, models.Tag{Name: "rust"})
+	if n := get(false); n != 1 {
+		t.Errorf("expected the cached count, got %d", n)
+	}
+	if n := get(true); n != 2 || computed != 3 {
+		t.Errorf("expected a refresh to compute the count, got %d computed %d times", n, computed)
+	}
+
+	// Without a TTL nothing is cached
+	cache = NewStatsCache(db, 0)
+	get(false)
+	get(false)
+	if computed != 5 {
+		t.Errorf("expected the count to be computed each time, computed %d times", computed)
+	}
+}
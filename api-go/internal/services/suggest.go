@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/pkg/fulltext"
+)
+
+const (
+	// tagProfileTTL is how long the statistics of tagged posts are reused before being rebuilt
+	tagProfileTTL = 10 * time.Minute
+	// minProfilePosts is the number of posts a tag needs for its content to be compared with drafts
+	minProfilePosts = 2
+	// minSuggestionConfidence is the confidence below which a tag is not suggested
+	minSuggestionConfidence = 0.1
+	// nameMatchConfidence is the confidence of a tag whose name appears in the draft
+	nameMatchConfidence = 0.6
+	// coOccurrenceWeight scales the share of posts with a present tag that also have the suggested tag
+	coOccurrenceWeight = 0.8
+)
+
+// tagStats holds what is known about the posts of a tag
+type tagStats struct {
+	posts int
+	// tokenPosts counts the posts of the tag containing each token
+	tokenPosts map[string]int
+	// norm is the length of the tf-idf vector of the tag
+	norm float64
+}
+
+// tagProfile holds the statistics of all tagged posts
+type tagProfile struct {
+	names []string
+	stats map[string]*tagStats
+	// docs is the number of tagged posts, docFreq counts the tagged posts containing each token
+	docs    int
+	docFreq map[string]int
+	// cooccur counts the posts having both tags
+	cooccur map[string]map[string]int
+}
+
+// TagSuggester suggests tags for draft content
+// It combines three signals: tag names found in the draft, the similarity of the draft to the posts
+// of each tag, and the tags often used together with the tags already in the draft
+type TagSuggester struct {
+	tagService *TagService
+	tokenizer  fulltext.Tokenizer
+
+	mu      sync.Mutex
+	profile *tagProfile
+	builtAt time.Time
+}
+
+// NewTagSuggester creates a suggester analyzing content with the full-text tokenizer
+func NewTagSuggester(tagService *TagService, tokenizer fulltext.Tokenizer) *TagSuggester {
+	return &TagSuggester{tagService: tagService, tokenizer: tokenizer}
+}
+
+// Suggest returns at most limit tags for the content, by decreasing confidence
+// Tags already in the content are not suggested
+func (s *TagSuggester) Suggest(ctx context.Context, content string, limit int) ([]models.TagSuggestion, error) {
+	profile, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	present := extractHashTags(content)
+	tokens := s.tokens(content)
+
+	suggestions := []models.TagSuggestion{}
+	for _, name := range profile.names {
+		if present[name] {
+			continue
+		}
+
+		var reasons []string
+		var nameScore, contentScore, coScore float64
+		if s.nameMatches(name, tokens) {
+			nameScore = nameMatchConfidence
+			reasons = append(reasons, "name")
+		}
+		if stats := profile.stats[name]; stats != nil && stats.posts >= minProfilePosts {
+			contentScore = profile.similarity(stats, tokens)
+			if contentScore >= minSuggestionConfidence/2 {
+				reasons = append(reasons, "content")
+			}
+		}
+		for tag := range present {
+			if stats := profile.stats[tag]; stats != nil {
+				coScore = max(coScore, float64(profile.cooccur[tag][name])/float64(stats.posts))
+			}
+		}
+		if coScore > 0 {
+			reasons = append(reasons, "co-occurrence")
+		}
+
+		// The signals are independent evidence, they are combined as a noisy-or
+		confidence := 1 - (1-nameScore)*(1-contentScore)*(1-coOccurrenceWeight*coScore)
+		if confidence < minSuggestionConfidence || len(reasons) == 0 {
+			continue
+		}
+		suggestions = append(suggestions, models.TagSuggestion{
+			Name:       name,
+			Confidence: math.Round(confidence*100) / 100,
+			Reasons:    reasons,
+		})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Confidence != suggestions[j].Confidence {
+			return suggestions[i].Confidence > suggestions[j].Confidence
+		}
+		return suggestions[i].Name < suggestions[j].Name
+	})
+	return suggestions[:min(len(suggestions), limit)], nil
+}
+
+// tokens returns the distinct tokens of the content, ignoring its hash tags
+func (s *TagSuggester) tokens(content string) map[string]bool {
+	text := hashTagRegex.ReplaceAllString(content, " ")
+	tokens := make(map[string]bool)
+	for _, token := range s.tokenizer.Analyze(text) {
+		tokens[token] = true
+	}
+	return tokens
+}
+
+// nameMatches checks if all tokens of the last level of a tag name are in the tokens
+func (s *TagSuggester) nameMatches(name string, tokens map[string]bool) bool {
+	leaf := name[strings.LastIndex(name, "/")+1:]
+	nameTokens := s.tokenizer.Analyze(leaf)
+	for _, token := range nameTokens {
+		if !tokens[token] {
+			return false
+		}
+	}
+	return len(nameTokens) > 0
+}
+
+// load returns the profile of tagged posts, rebuilding it once it is older than tagProfileTTL
+func (s *TagSuggester) load(ctx context.Context) (*tagProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.profile != nil && time.Since(s.builtAt) < tagProfileTTL {
+		return s.profile, nil
+	}
+
+	profile, err := s.build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.profile, s.builtAt = profile, time.Now()
+	return profile, nil
+}
+
+// build tokenizes the tagged posts and counts tokens per tag and tags used together
+func (s *TagSuggester) build(ctx context.Context) (*tagProfile, error) {
+	names, err := s.tagService.GetNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := s.tagService.GetTaggedPosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &tagProfile{
+		names:   names,
+		stats:   make(map[string]*tagStats),
+		docs:    len(posts),
+		docFreq: make(map[string]int),
+		cooccur: make(map[string]map[string]int),
+	}
+	for _, post := range posts {
+		tokens := s.tokens(post.Content)
+		for token := range tokens {
+			profile.docFreq[token]++
+		}
+
+		tags := strings.Split(post.Tags, tagSeparator)
+		for _, tag := range tags {
+			stats := profile.stats[tag]
+			if stats == nil {
+				stats = &tagStats{tokenPosts: make(map[string]int)}
+				profile.stats[tag] = stats
+			}
+			stats.posts++
+			for token := range tokens {
+				stats.tokenPosts[token]++
+			}
+
+			for _, other := range tags {
+				if other == tag {
+					continue
+				}
+				if profile.cooccur[tag] == nil {
+					profile.cooccur[tag] = make(map[string]int)
+				}
+				profile.cooccur[tag][other]++
+			}
+		}
+	}
+
+	for _, stats := range profile.stats {
+		var norm float64
+		for token := range stats.tokenPosts {
+			norm += math.Pow(profile.weight(stats, token), 2)
+		}
+		stats.norm = math.Sqrt(norm)
+	}
+	return profile, nil
+}
+
+// idf is the inverse document frequency of a token among tagged posts
+func (p *tagProfile) idf(token string) float64 {
+	return math.Log(1 + float64(p.docs)/float64(1+p.docFreq[token]))
+}
+
+// weight is the weight of a token in the vector of a tag: the share of its posts containing the token,
+// scaled by the rarity of the token
+func (p *tagProfile) weight(stats *tagStats, token string) float64 {
+	return float64(stats.tokenPosts[token]) / float64(stats.posts) * p.idf(token)
+}
+
+// similarity is the cosine similarity of the tf-idf vectors of a draft and of the posts of a tag
+// Tokens never seen in tagged posts are ignored, they say nothing about which tag fits
+func (p *tagProfile) similarity(stats *tagStats, tokens map[string]bool) float64 {
+	var dot, norm float64
+	for token := range tokens {
+		if p.docFreq[token] == 0 {
+			continue
+		}
+		idf := p.idf(token)
+		norm += idf * idf
+		dot += idf * p.weight(stats, token)
+	}
+	if norm == 0 || stats.norm == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(norm) * stats.norm)
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fieldsTokenizer splits lowercased text on whitespace, standing in for the full-text tokenizer
+type fieldsTokenizer struct{}
+
+func (fieldsTokenizer) Cut(text string) []string {
+	return strings.Fields(text)
+}
+
+func (fieldsTokenizer) Analyze(text string) []string {
+	return strings.Fields(strings.ToLower(htmlTagRegex.ReplaceAllString(text, " ")))
+}
+
+func TestTagSuggester(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	goID := createTestTag(t, db, "programming/go", false)
+	webID := createTestTag(t, db, "web", false)
+	cookingID := createTestTag(t, db, "cooking", false)
+	createTestTag(t, db, "travel", false)
+
+	for _, content := range []string{"goroutines and channels", "channels select goroutines", "goroutines leak"} {
+		id := createTestPost(t, db, content, nil)
+		associateTagPost(t, db, goID, id)
+		associateTagPost(t, db, webID, id)
+	}
+	for _, content := range []string{"bake bread flour", "flour water salt"} {
+		associateTagPost(t, db, cookingID, createTestPost(t, db, content, nil))
+	}
+
+	suggester := NewTagSuggester(NewTagService(db), fieldsTokenizer{})
+
+	suggestions, err := suggester.Suggest(ctx, "<p>a post about goroutines written while on travel</p>", 5)
+	if err != nil {
+		t.Fatalf("Suggest failed: %v", err)
+	}
+	names := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		names[i] = suggestion.Name
+	}
+	if len(names) < 2 || !slices.Contains(names, "programming/go") || !slices.Contains(names, "travel") {
+		t.Fatalf("expected programming/go by content and travel by name, got %+v", suggestions)
+	}
+	if slices.Contains(names, "cooking") {
+		t.Errorf("expected no unrelated tag, got %+v", suggestions)
+	}
+	for i := 1; i < len(suggestions); i++ {
+		if suggestions[i].Confidence > suggestions[i-1].Confidence {
+			t.Errorf("expected suggestions by decreasing confidence, got %+v", suggestions)
+		}
+	}
+
+	// A tag in the draft is not suggested again, and its companions are
+	suggestions, err = suggester.Suggest(ctx, `<p>notes <span class="hash-tag">#programming/go</span></p>`, 5)
+	if err != nil {
+		t.Fatalf("Suggest failed: %v", err)
+	}
+	if len(suggestions) != 1 || suggestions[0].Name != "web" || suggestions[0].Reasons[0] != "co-occurrence" {
+		t.Errorf("expected web by co-occurrence, got %+v", suggestions)
+	}
+
+	suggestions, _ = suggester.Suggest(ctx, "goroutines travel", 1)
+	if len(suggestions) != 1 {
+		t.Errorf("expected the limit to be applied, got %d suggestions", len(suggestions))
+	}
+}
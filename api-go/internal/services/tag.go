@@ -15,22 +15,26 @@ import (
 
 var (
 	ErrTagNotFound = errors.New("tag not found")
+	// ErrTagTargetDeleted is returned when restoring a merged tag whose target is no longer live
+	ErrTagTargetDeleted = errors.New("the tag it was merged into is deleted")
 )
 
 type TagService struct {
-	db *sqlx.DB
+	db     *DB
+	reader *sqlx.DB
+	writes contentWrites
 }
 
-func NewTagService(db *sqlx.DB) *TagService {
-	return &TagService{db: db}
+func NewTagService(db *DB) *TagService {
+	return &TagService{db: db, reader: db.reader, writes: contentWritesFor(db)}
 }
 
-// GetCount returns the total count of tags
+// GetCount returns the total count of tags, excluding tags in the trash
 func (s *TagService) GetCount(ctx context.Context) (int64, error) {
-	query := `SELECT COUNT(*) FROM tags`
+	query := `SELECT COUNT(*) FROM tags WHERE deleted_at IS NULL`
 
 	var count int64
-	err := s.db.GetContext(ctx, &count, query)
+	err := s.reader.GetContext(ctx, &count, query)
 	return count, err
 }
 
@@ -42,11 +46,12 @@ func (s *TagService) GetAllWithPostCount(ctx context.Context) ([]models.TagWithP
 		FROM tags t
 		LEFT JOIN tags child ON child.name = t.name OR child.name LIKE (t.name || '/%')
 		LEFT JOIN tag_post_assoc tpa ON tpa.tag_id = child.id
+		WHERE t.deleted_at IS NULL
 		GROUP BY t.name, t.sticky
 	`
 
 	tags := []models.TagWithPostCount{}
-	err := s.db.SelectContext(ctx, &tags, query)
+	err := s.reader.SelectContext(ctx, &tags, query)
 	return tags, err
 }
 
@@ -61,19 +66,49 @@ func (s *TagService) GetAllWithUndeletedPostCount(ctx context.Context) ([]models
 		LEFT JOIN tags child ON child.name = t.name OR child.name LIKE (t.name || '/%')
 		LEFT JOIN tag_post_assoc tpa ON tpa.tag_id = child.id
 		LEFT JOIN posts p ON tpa.post_id = p.id AND p.deleted_at IS NULL
+		WHERE t.deleted_at IS NULL
 		GROUP BY t.name, t.sticky
 	`
 
 	var tags []models.TagWithPostCount
-	err := s.db.SelectContext(ctx, &tags, query)
+	err := s.reader.SelectContext(ctx, &tags, query)
 	return tags, err
 }
 
-// GetPosts retrieves all posts associated with a tag (including subtags)
+// GetPosts retrieves a page of the posts associated with a tag (including subtags), with their tags
 // For example, the tag "animal" will include posts tagged with "animal/mammal"
-func (s *TagService) GetPosts(ctx context.Context, name string) ([]models.Post, error) {
+// Posts are ordered like PostService.Filter, invalid options return an error wrapping ErrInvalidFilter.
+func (s *TagService) GetPosts(ctx context.Context, name string, options models.TagPostsRequest, limit int) ([]models.Post, error) {
+	filter := models.FilterPostRequest{
+		Cursor: options.Cursor, CursorID: options.CursorID, OrderBy: options.OrderBy, Ascending: options.Ascending,
+	}
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	// The posts of a tag are never deleted
+	if options.OrderBy == "deleted_at" {
+		return nil, fmt.Errorf("%w: the posts of a tag can't be ordered by deleted_at", ErrInvalidFilter)
+	}
+	orderBy := postOrderColumn(options.OrderBy)
+
 	namePattern := escapeLike(name) + "/%"
-	query := `
+	args := []any{name, namePattern}
+	cursorClause := ""
+
+	// Cursor pagination, posts with the cursor value are told apart by their ID
+	operator, direction := "<", "DESC"
+	if options.Ascending {
+		operator, direction = ">", "ASC"
+	}
+	if options.Cursor != nil && options.CursorID != nil {
+		cursorClause = fmt.Sprintf("AND (%s %s ? OR (%s = ? AND p.id %s ?))", orderBy, operator, orderBy, operator)
+		args = append(args, *options.Cursor, *options.Cursor, *options.CursorID)
+	} else if options.Cursor != nil {
+		cursorClause = fmt.Sprintf("AND %s %s ?", orderBy, operator)
+		args = append(args, *options.Cursor)
+	}
+
+	query := fmt.Sprintf(`
 		SELECT p.*
 		FROM posts p
 		WHERE EXISTS (
@@ -84,21 +119,82 @@ func (s *TagService) GetPosts(ctx context.Context, name string) ([]models.Post,
 			AND (t.name = ? OR t.name LIKE ? ESCAPE '\')
 		)
 		AND p.deleted_at IS NULL
-	`
-
-	var posts []models.Post
-	err := s.db.SelectContext(ctx, &posts, query, name, namePattern)
-	if err != nil {
+		%s
+		ORDER BY %s %s, p.id %s
+		LIMIT ?
+	`, cursorClause, orderBy, direction, direction)
+	args = append(args, limit)
+
+	posts := []models.Post{}
+	if err := s.reader.SelectContext(ctx, &posts, query, args...); err != nil {
+		return nil, err
+	}
+	if err := attachTags(ctx, s.reader, posts); err != nil {
 		return nil, err
 	}
-
 	return posts, nil
 }
 
+// GetSharedPosts retrieves a page of the shared posts associated with a tag (including subtags), newest first
+func (s *TagService) GetSharedPosts(ctx context.Context, name string, limit, offset int) ([]models.Post, error) {
+	return NewPublicPostService(s.reader, VisibilityShared).GetTagPosts(ctx, name, limit, offset)
+}
+
+// tagSeparator joins the tag names of a TaggedPost, it is char(31) in SQL
+const tagSeparator = "\x1f"
+
+// TaggedPost is a live post with the names of its live tags
+type TaggedPost struct {
+	ID      int64  `db:"id"`
+	Content string `db:"content"`
+	Tags    string `db:"tags"`
+}
+
+// GetNames retrieves the names of all live tags
+func (s *TagService) GetNames(ctx context.Context) ([]string, error) {
+	names := []string{}
+	err := s.reader.SelectContext(ctx, &names, `SELECT name FROM tags WHERE deleted_at IS NULL`)
+	return names, err
+}
+
+// GetTaggedPosts retrieves the non-deleted posts that have tags
+// The tag names of a post are joined with tagSeparator
+func (s *TagService) GetTaggedPosts(ctx context.Context) ([]TaggedPost, error) {
+	query := `
+		SELECT p.id, p.content, GROUP_CONCAT(t.name, char(31)) AS tags
+		FROM posts p
+		JOIN tag_post_assoc tp ON tp.post_id = p.id
+		JOIN tags t ON t.id = tp.tag_id AND t.deleted_at IS NULL
+		WHERE p.deleted_at IS NULL
+		GROUP BY p.id
+	`
+
+	var posts []TaggedPost
+	err := s.reader.SelectContext(ctx, &posts, query)
+	return posts, err
+}
+
 // InsertOrUpdate inserts a new tag or updates its sticky status
 // If the tag already exists, its sticky status is updated
 // If it does not exist, a new tag is created
+// If it is in the trash, it is taken out of the trash
 func (s *TagService) InsertOrUpdate(ctx context.Context, name string, sticky bool) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := s.revive(ctx, tx.Tx, name); err != nil {
+		return err
+	}
+
 	now := time.Now().UnixMilli()
 
 	query := `
@@ -109,32 +205,139 @@ func (s *TagService) InsertOrUpdate(ctx context.Context, name string, sticky boo
 			updated_at = excluded.updated_at
 	`
 
-	_, err := s.db.ExecContext(ctx, query, name, sticky, now, now)
-	return err
+	if _, err := tx.ExecContext(ctx, query, name, sticky, now, now); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// DeleteAssociatedPosts soft-deletes all posts associated with a tag
-// It sets the deleted_at field to the current timestamp for posts linked to the specified tag and its subtags
+// DeleteAssociatedPosts soft-deletes a tag with its subtags and all posts associated with them
+// It sets the deleted_at field to the current timestamp for the tags and the posts linked to them,
+// so that Restore can bring back the posts deleted together with the tags
 func (s *TagService) DeleteAssociatedPosts(ctx context.Context, name string) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	now := time.Now().UnixMilli()
 	namePattern := escapeLike(name) + "/%"
 
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE posts
 		SET deleted_at = ?
-		WHERE id IN (
+		WHERE deleted_at IS NULL
+		AND id IN (
 			SELECT post_id
 			FROM tag_post_assoc
 			WHERE tag_id IN (
 				SELECT id
 				FROM tags
-				WHERE name = ? OR name LIKE ? ESCAPE '\'
+				WHERE (name = ? OR name LIKE ? ESCAPE '\') AND deleted_at IS NULL
 			)
 		)
 	`
 
-	_, err := s.db.ExecContext(ctx, query, now, name, namePattern)
-	return err
+	if _, err := tx.ExecContext(ctx, query, now, name, namePattern); err != nil {
+		return err
+	}
+
+	tagQuery := `
+		UPDATE tags
+		SET deleted_at = ?, updated_at = ?
+		WHERE (name = ? OR name LIKE ? ESCAPE '\') AND deleted_at IS NULL
+	`
+
+	if _, err := tx.ExecContext(ctx, tagQuery, now, now, name, namePattern); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetDeleted retrieves the tags in the trash, most recently deleted first
+func (s *TagService) GetDeleted(ctx context.Context) ([]models.Tag, error) {
+	query := `SELECT * FROM tags WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, name`
+
+	tags := []models.Tag{}
+	err := s.reader.SelectContext(ctx, &tags, query)
+	return tags, err
+}
+
+// Restore takes a tag out of the trash, together with its subtags trashed by the same operation
+// A deleted tag gets back the posts deleted with it
+// A merged tag gets back its posts from the tag it was merged into: the content of a post is reset
+// to its version before the merge if it wasn't edited since, otherwise the tag is renamed back in it
+// It returns ErrTagTargetDeleted if the tag it was merged into is no longer live
+func (s *TagService) Restore(ctx context.Context, name string) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT * FROM tags
+		WHERE (name = ? OR name LIKE ? ESCAPE '\')
+		AND deleted_at = (SELECT deleted_at FROM tags WHERE name = ? AND deleted_at IS NOT NULL)
+		ORDER BY name
+	`
+
+	var tags []models.Tag
+	if err := tx.SelectContext(ctx, &tags, query, name, escapeLike(name)+"/%", name); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return ErrTagNotFound
+	}
+
+	now := time.Now().UnixMilli()
+	for i := range tags {
+		tag := &tags[i]
+		if tag.MergedInto.Valid {
+			err = s.unmerge(ctx, tx.Tx, tag)
+		} else {
+			err = s.undelete(ctx, tx.Tx, tag)
+		}
+		if err != nil {
+			return err
+		}
+
+		updateQuery := `UPDATE tags SET deleted_at = NULL, merged_into = NULL, updated_at = ? WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, updateQuery, now, tag.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PurgeDeletedBefore permanently deletes the tags that were put in the trash before the given timestamp
+// It returns the number of purged tags
+func (s *TagService) PurgeDeletedBefore(ctx context.Context, before int64) (int64, error) {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	result, err := execerFor(ctx, s.db).ExecContext(ctx, `DELETE FROM tags WHERE deleted_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 // RenameOrMerge renames a tag or merges it with an existing tag
@@ -147,6 +350,12 @@ func (s *TagService) DeleteAssociatedPosts(ctx context.Context, name string) err
 // If "creature/mammal" does not exist, "animal/mammal" will be renamed to "creature/mammal"
 // The operation is atomic; if any part fails, no changes are made
 func (s *TagService) RenameOrMerge(ctx context.Context, oldName, newName string) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	if oldName == newName {
 		return nil
 	}
@@ -159,14 +368,20 @@ func (s *TagService) RenameOrMerge(ctx context.Context, oldName, newName string)
 
 	namePattern := escapeLike(oldName) + "/%"
 
-	// Get all affected tags
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Get all affected tags, in the transaction to see the writes of the request made before, if any
 	query := `
 		SELECT * FROM tags
-		WHERE name = ? OR name = ? OR name LIKE ? ESCAPE '\'
+		WHERE (name = ? OR name LIKE ? ESCAPE '\') AND deleted_at IS NULL
 	`
 
 	var affectedTags []models.Tag
-	err := s.db.SelectContext(ctx, &affectedTags, query, oldName, newName, namePattern)
+	err = tx.SelectContext(ctx, &affectedTags, query, oldName, namePattern)
 	if err != nil {
 		return err
 	}
@@ -183,72 +398,78 @@ func (s *TagService) RenameOrMerge(ctx context.Context, oldName, newName string)
 		return ErrTagNotFound
 	}
 
-	tx, err := s.db.BeginTxx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
 	// Find source and target tags
+	// A target in the trash is taken out of it, so that the source is merged into it
 	var sourceTag *models.Tag
-	var targetTag *models.Tag
 	descendants := make([]*models.Tag, 0)
 
 	for i := range affectedTags {
 		tag := &affectedTags[i]
-		switch tag.Name {
-		case oldName:
+		if tag.Name == oldName {
 			sourceTag = tag
-		case newName:
-			targetTag = tag
-		default:
+		} else {
 			descendants = append(descendants, tag)
 		}
 	}
 
+	targetTag, err := s.findOrRevive(ctx, tx.Tx, newName)
+	if err != nil {
+		return err
+	}
+
 	// Sort descendants by depth (deepest first)
 	sort.Slice(descendants, func(i, j int) bool {
 		return strings.Count(descendants[i].Name, "/") > strings.Count(descendants[j].Name, "/")
 	})
 
+	// Merged tags share the time they were put in the trash, so that they are restored together
+	now := time.Now().UnixMilli()
+
 	// Process descendants
 	for _, descendant := range descendants {
 		newDescendantName := replacePrefix(descendant.Name, oldName, newName)
-		targetDescendant, err := s.findByName(ctx, tx, newDescendantName)
+		targetDescendant, err := s.findOrRevive(ctx, tx.Tx, newDescendantName)
 		if err != nil {
 			return err
 		}
 
 		if targetDescendant != nil {
 			// Target exists - merge
-			if err := s.merge(ctx, tx, descendant, targetDescendant); err != nil {
+			if err := s.merge(ctx, tx.Tx, descendant, targetDescendant, now); err != nil {
 				return err
 			}
 		} else {
 			// Target doesn't exist - rename
-			if err := s.rename(ctx, tx, descendant, newDescendantName); err != nil {
+			if err := s.rename(ctx, tx.Tx, descendant, newDescendantName); err != nil {
 				return err
 			}
 		}
 	}
 
 	// Process source tag
+	summary := fmt.Sprintf("renamed %s to %s", oldName, newName)
 	if targetTag != nil {
-		if err := s.merge(ctx, tx, sourceTag, targetTag); err != nil {
+		if err := s.merge(ctx, tx.Tx, sourceTag, targetTag, now); err != nil {
 			return err
 		}
+		summary = fmt.Sprintf("merged %s into %s", oldName, newName)
 	} else {
-		if err := s.rename(ctx, tx, sourceTag, newName); err != nil {
+		if err := s.rename(ctx, tx.Tx, sourceTag, newName); err != nil {
 			return err
 		}
 	}
 
+	if err := recordActivity(ctx, tx, models.ActivityTagRenamed, sourceTag.ID, summary); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
 // findOrCreate finds a tag by name or creates it if it doesn't exist
+// A tag in the trash is taken out of it
 func (s *TagService) findOrCreate(ctx context.Context, tx *sqlx.Tx, name string) (*models.Tag, error) {
-	tag, err := s.findByName(ctx, tx, name)
+	tag, err := s.findOrRevive(ctx, tx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -261,9 +482,44 @@ func (s *TagService) findOrCreate(ctx context.Context, tx *sqlx.Tx, name string)
 
 // Helper functions
 
-// findByName finds a tag by its name
+// findOrRevive finds a live tag by its name, or takes it out of the trash
+// It returns nil if no tag has the name
+func (s *TagService) findOrRevive(ctx context.Context, tx *sqlx.Tx, name string) (*models.Tag, error) {
+	tag, err := s.findByName(ctx, tx, name)
+	if err != nil || tag != nil {
+		return tag, err
+	}
+	return s.revive(ctx, tx, name)
+}
+
+// revive takes a tag out of the trash without restoring it, as its name is used again
+// The record of its merge is dropped, it returns nil if no tag in the trash has the name
+func (s *TagService) revive(ctx context.Context, tx *sqlx.Tx, name string) (*models.Tag, error) {
+	query := `
+		UPDATE tags
+		SET deleted_at = NULL, merged_into = NULL, updated_at = ?
+		WHERE name = ? AND deleted_at IS NOT NULL
+		RETURNING *
+	`
+
+	var tag models.Tag
+	err := tx.GetContext(ctx, &tag, query, time.Now().UnixMilli(), name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tag_merged_posts WHERE tag_id = ?`, tag.ID); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// findByName finds a live tag by its name
 func (s *TagService) findByName(ctx context.Context, tx *sqlx.Tx, name string) (*models.Tag, error) {
-	query := `SELECT * FROM tags WHERE name = ?`
+	query := `SELECT * FROM tags WHERE name = ? AND deleted_at IS NULL`
 
 	var tag models.Tag
 	err := tx.GetContext(ctx, &tag, query, name)
@@ -334,8 +590,23 @@ func (s *TagService) rename(ctx context.Context, tx *sqlx.Tx, tag *models.Tag, n
 
 // merge merges a source tag into a target tag
 // It updates post contents to replace source tag with target tag
-// It also updates tag associations and deletes the source tag
-func (s *TagService) merge(ctx context.Context, tx *sqlx.Tx, sourceTag, targetTag *models.Tag) error {
+// It also updates tag associations and puts the source tag in the trash, recording the moved posts
+func (s *TagService) merge(ctx context.Context, tx *sqlx.Tx, sourceTag, targetTag *models.Tag, now int64) error {
+	// Record the posts before they are moved, so that the merge can be undone
+	recordQuery := `
+		INSERT OR REPLACE INTO tag_merged_posts (tag_id, post_id, content, had_target)
+		SELECT tpa.tag_id, p.id, p.content,
+			EXISTS (SELECT 1 FROM tag_post_assoc WHERE tag_id = ? AND post_id = p.id)
+		FROM tag_post_assoc tpa
+		JOIN posts p ON p.id = tpa.post_id
+		WHERE tpa.tag_id = ?
+	`
+
+	_, err := tx.ExecContext(ctx, recordQuery, targetTag.ID, sourceTag.ID)
+	if err != nil {
+		return err
+	}
+
 	// Update post content
 	sourcePattern := fmt.Sprintf(">#%s<", sourceTag.Name)
 	targetPattern := fmt.Sprintf(">#%s<", targetTag.Name)
@@ -350,7 +621,7 @@ func (s *TagService) merge(ctx context.Context, tx *sqlx.Tx, sourceTag, targetTa
 		)
 	`
 
-	_, err := tx.ExecContext(ctx, updateQuery, sourcePattern, targetPattern, sourceTag.ID)
+	_, err = tx.ExecContext(ctx, updateQuery, sourcePattern, targetPattern, sourceTag.ID)
 	if err != nil {
 		return err
 	}
@@ -375,9 +646,86 @@ func (s *TagService) merge(ctx context.Context, tx *sqlx.Tx, sourceTag, targetTa
 		return err
 	}
 
-	// Delete the source tag itself
-	deleteTagQuery := `DELETE FROM tags WHERE id = ?`
-	_, err = tx.ExecContext(ctx, deleteTagQuery, sourceTag.ID)
+	// Put the source tag itself in the trash
+	trashQuery := `UPDATE tags SET deleted_at = ?, merged_into = ?, updated_at = ? WHERE id = ?`
+	_, err = tx.ExecContext(ctx, trashQuery, now, targetTag.ID, now, sourceTag.ID)
+	return err
+}
+
+// unmerge moves the posts of a merged tag back from the tag it was merged into
+// The content of a post is reset if it wasn't edited since the merge, otherwise the target tag is renamed
+// back to the source tag, unless the post already had the target tag before the merge
+func (s *TagService) unmerge(ctx context.Context, tx *sqlx.Tx, tag *models.Tag) error {
+	var target models.Tag
+	query := `SELECT * FROM tags WHERE id = ? AND deleted_at IS NULL`
+	err := tx.GetContext(ctx, &target, query, tag.MergedInto.Int64)
+	if err == sql.ErrNoRows {
+		return ErrTagTargetDeleted
+	}
+	if err != nil {
+		return err
+	}
+
+	sourcePattern := fmt.Sprintf(">#%s<", tag.Name)
+	targetPattern := fmt.Sprintf(">#%s<", target.Name)
+
+	updateQuery := `
+		UPDATE posts
+		SET content = CASE
+			WHEN posts.content = REPLACE(m.content, ?, ?) THEN m.content
+			WHEN m.had_target THEN posts.content
+			ELSE REPLACE(posts.content, ?, ?)
+		END
+		FROM tag_merged_posts m
+		WHERE m.post_id = posts.id AND m.tag_id = ?
+	`
+
+	_, err = tx.ExecContext(ctx, updateQuery, sourcePattern, targetPattern, targetPattern, sourcePattern, tag.ID)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `
+		INSERT OR IGNORE INTO tag_post_assoc (post_id, tag_id)
+		SELECT post_id, tag_id
+		FROM tag_merged_posts
+		WHERE tag_id = ?
+	`
+
+	if _, err := tx.ExecContext(ctx, insertQuery, tag.ID); err != nil {
+		return err
+	}
+
+	// Posts that no longer mention the target tag lose it
+	deleteQuery := `
+		DELETE FROM tag_post_assoc
+		WHERE tag_id = ?
+		AND post_id IN (
+			SELECT m.post_id
+			FROM tag_merged_posts m
+			JOIN posts p ON p.id = m.post_id
+			WHERE m.tag_id = ? AND NOT m.had_target AND instr(p.content, ?) = 0
+		)
+	`
+
+	if _, err := tx.ExecContext(ctx, deleteQuery, target.ID, tag.ID, targetPattern); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tag_merged_posts WHERE tag_id = ?`, tag.ID)
+	return err
+}
+
+// undelete restores the posts that were deleted together with a tag
+func (s *TagService) undelete(ctx context.Context, tx *sqlx.Tx, tag *models.Tag) error {
+	query := `
+		UPDATE posts
+		SET deleted_at = NULL
+		WHERE deleted_at = ?
+		AND id IN (SELECT post_id FROM tag_post_assoc WHERE tag_id = ?)
+	`
+
+	_, err := tx.ExecContext(ctx, query, tag.DeletedAt.Int64, tag.ID)
 	return err
 }
 
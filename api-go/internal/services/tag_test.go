@@ -3,94 +3,34 @@ package services
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/cymoo/mote/internal/models"
-	"github.com/jmoiron/sqlx"
-	_ "modernc.org/sqlite"
+	"github.com/cymoo/mote/internal/testutil"
 )
 
-func setupTestDB(t *testing.T) *sqlx.DB {
-	// Use shared cache mode to allow multiple connections to the same in-memory database
-	db, err := sqlx.Open("sqlite", "file::memory:?cache=shared")
-	if err != nil {
-		t.Fatalf("failed to open database: %v", err)
-	}
-
-	// Set connection pool to 1 for in-memory database to ensure consistency
-	db.SetMaxOpenConns(1)
-
-	schema := `
-	CREATE TABLE IF NOT EXISTS posts (
-		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
-		content TEXT NOT NULL,
-		files TEXT,
-		color TEXT,
-		shared Boolean NOT NULL DEFAULT FALSE,
-		deleted_at BIGINT,
-		created_at BIGINT NOT NULL,
-		updated_at BIGINT NOT NULL,
-		parent_id INTEGER,
-		children_count INTEGER NOT NULL DEFAULT 0,
-		FOREIGN KEY (parent_id) REFERENCES posts (id) ON DELETE SET NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS tags (
-		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
-		name TEXT NOT NULL UNIQUE,
-		sticky BOOLEAN NOT NULL DEFAULT FALSE,
-		created_at BIGINT NOT NULL,
-		updated_at BIGINT NOT NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS tag_post_assoc (
-		tag_id INTEGER NOT NULL,
-		post_id INTEGER NOT NULL,
-		FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE,
-		FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
-		UNIQUE (tag_id, post_id)
-	);
-	`
-
-	if _, err := db.Exec(schema); err != nil {
-		t.Fatalf("failed to create schema: %v", err)
-	}
-
-	return db
+// setupTestDB opens a database of the test with the schema of the migrations
+func setupTestDB(t *testing.T) *DB {
+	return NewDB(testutil.NewDB(t))
 }
 
-func createTestPost(t *testing.T, db *sqlx.DB, content string, deletedAt *int64) int64 {
-	now := time.Now().UnixMilli()
-	query := `INSERT INTO posts (content, shared, created_at, updated_at, deleted_at)
-	          VALUES (?, false, ?, ?, ?) RETURNING id`
-
-	var id int64
-	err := db.QueryRow(query, content, now, now, deletedAt).Scan(&id)
-	if err != nil {
-		t.Fatalf("failed to create post: %v", err)
+func createTestPost(t *testing.T, db *DB, content string, deletedAt *int64) int64 {
+	post := models.Post{Content: content}
+	if deletedAt != nil {
+		post.DeletedAt = models.NullInt64{NullInt64: sql.NullInt64{Int64: *deletedAt, Valid: true}}
 	}
-	return id
+	return testutil.CreatePost(t, db, post).ID
 }
 
-func createTestTag(t *testing.T, db *sqlx.DB, name string, sticky bool) int64 {
-	now := time.Now().UnixMilli()
-	query := `INSERT INTO tags (name, sticky, created_at, updated_at)
-	          VALUES (?, ?, ?, ?) RETURNING id`
-
-	var id int64
-	err := db.QueryRow(query, name, sticky, now, now).Scan(&id)
-	if err != nil {
-		t.Fatalf("failed to create tag: %v", err)
-	}
-	return id
+func createTestTag(t *testing.T, db *DB, name string, sticky bool) int64 {
+	return testutil.CreateTag(t, db, models.Tag{Name: name, Sticky: sticky}).ID
 }
 
-func associateTagPost(t *testing.T, db *sqlx.DB, tagID, postID int64) {
-	query := `INSERT INTO tag_post_assoc (tag_id, post_id) VALUES (?, ?)`
-	if _, err := db.Exec(query, tagID, postID); err != nil {
-		t.Fatalf("failed to associate tag and post: %v", err)
-	}
+func associateTagPost(t *testing.T, db *DB, tagID, postID int64) {
+	testutil.TagPost(t, db, tagID, postID)
 }
 
 func TestGetCount(t *testing.T) {
@@ -237,7 +177,7 @@ func TestGetPosts(t *testing.T) {
 	associateTagPost(t, db, tag1ID, post4ID) // deleted post
 
 	// Get posts for "tech" (should include subtags)
-	posts, err := service.GetPosts(ctx, "tech")
+	posts, err := service.GetPosts(ctx, "tech", models.TagPostsRequest{}, 10)
 	if err != nil {
 		t.Fatalf("GetPosts failed: %v", err)
 	}
@@ -247,7 +187,7 @@ func TestGetPosts(t *testing.T) {
 	}
 
 	// Get posts for "tech/golang"
-	posts, err = service.GetPosts(ctx, "tech/golang")
+	posts, err = service.GetPosts(ctx, "tech/golang", models.TagPostsRequest{}, 10)
 	if err != nil {
 		t.Fatalf("GetPosts failed: %v", err)
 	}
@@ -274,7 +214,7 @@ func TestGetPostsWithSpecialCharacters(t *testing.T) {
 	otherPostID := createTestPost(t, db, "Post 2", nil)
 	associateTagPost(t, db, otherTagID, otherPostID)
 
-	posts, err := service.GetPosts(ctx, "c%")
+	posts, err := service.GetPosts(ctx, "c%", models.TagPostsRequest{}, 10)
 	if err != nil {
 		t.Fatalf("GetPosts failed: %v", err)
 	}
@@ -284,6 +224,68 @@ func TestGetPostsWithSpecialCharacters(t *testing.T) {
 	}
 }
 
+func TestGetPostsPagination(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewTagService(db)
+	ctx := context.Background()
+
+	tagID := createTestTag(t, db, "tech", false)
+	subtagID := createTestTag(t, db, "tech/go", false)
+	var ids []int64
+	for i := range 5 {
+		id := createTestPost(t, db, "Post", nil)
+		// Two posts share each creation time, to check the ID tie-break
+		if _, err := db.Exec("UPDATE posts SET created_at = ?, updated_at = ? WHERE id = ?", 1000+i/2, 2000-i, id); err != nil {
+			t.Fatal(err)
+		}
+		associateTagPost(t, db, tagID, id)
+		ids = append(ids, id)
+	}
+	associateTagPost(t, db, subtagID, ids[0])
+
+	// Newest first, page by page
+	var seen []int64
+	options := models.TagPostsRequest{}
+	for {
+		posts, err := service.GetPosts(ctx, "tech", options, 2)
+		if err != nil {
+			t.Fatalf("GetPosts failed: %v", err)
+		}
+		if len(posts) == 0 {
+			break
+		}
+		for _, post := range posts {
+			seen = append(seen, post.ID)
+		}
+		last := posts[len(posts)-1]
+		options.Cursor, options.CursorID = &last.CreatedAt, &last.ID
+	}
+	expected := []int64{ids[4], ids[3], ids[2], ids[1], ids[0]}
+	if !slices.Equal(seen, expected) {
+		t.Errorf("expected %v, got %v", expected, seen)
+	}
+
+	// Ordered by update time, oldest first, with the tags of each post
+	posts, err := service.GetPosts(ctx, "tech", models.TagPostsRequest{OrderBy: "updated_at", Ascending: true}, 1)
+	if err != nil {
+		t.Fatalf("GetPosts failed: %v", err)
+	}
+	if len(posts) != 1 || posts[0].ID != ids[4] {
+		t.Fatalf("expected the least recently updated post, got %+v", posts)
+	}
+	if len(posts[0].Tags) != 1 || posts[0].Tags[0] != "tech" {
+		t.Errorf("expected the tags of the post, got %v", posts[0].Tags)
+	}
+
+	for _, options := range []models.TagPostsRequest{{OrderBy: "deleted_at"}, {OrderBy: "title"}, {CursorID: &ids[0]}} {
+		if _, err := service.GetPosts(ctx, "tech", options, 2); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("expected ErrInvalidFilter for %+v, got %v", options, err)
+		}
+	}
+}
+
 func TestInsertOrUpdate(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -446,12 +448,16 @@ func TestRenameOrMerge_Merge(t *testing.T) {
 		t.Fatalf("RenameOrMerge failed: %v", err)
 	}
 
-	// Verify golang tag was deleted
+	// Verify golang tag was put in the trash
 	var tag models.Tag
-	err = db.Get(&tag, "SELECT * FROM tags WHERE name = ?", "golang")
+	err = db.Get(&tag, "SELECT * FROM tags WHERE name = ? AND deleted_at IS NULL", "golang")
 	if err != sql.ErrNoRows {
 		t.Error("golang tag should be deleted after merge")
 	}
+	err = db.Get(&tag, "SELECT * FROM tags WHERE name = ?", "golang")
+	if err != nil || tag.MergedInto.Int64 != tag2ID {
+		t.Errorf("golang tag should be in the trash, merged into go: %v", err)
+	}
 
 	// Verify go tag still exists
 	err = db.Get(&tag, "SELECT * FROM tags WHERE name = ?", "go")
@@ -551,7 +557,7 @@ func TestRenameOrMerge_MergeWithSubtags(t *testing.T) {
 
 	// Verify source tags were deleted
 	var count int
-	err = db.Get(&count, "SELECT COUNT(*) FROM tags WHERE name = 'tech' OR name LIKE 'tech/%'")
+	err = db.Get(&count, "SELECT COUNT(*) FROM tags WHERE (name = 'tech' OR name LIKE 'tech/%') AND deleted_at IS NULL")
 	if err != nil {
 		t.Fatalf("failed to count tags: %v", err)
 	}
@@ -785,7 +791,7 @@ func TestEdgeCases(t *testing.T) {
 
 		associateTagPost(t, db, tagID, postID)
 
-		posts, err := service.GetPosts(ctx, "a")
+		posts, err := service.GetPosts(ctx, "a", models.TagPostsRequest{}, 10)
 		if err != nil {
 			t.Fatalf("GetPosts failed: %v", err)
 		}
@@ -823,3 +829,241 @@ func TestEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestRestore_Merge(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewTagService(db)
+	ctx := context.Background()
+
+	sourceID := createTestTag(t, db, "golang", false)
+	targetID := createTestTag(t, db, "go", false)
+
+	post1ID := createTestPost(t, db, "<p>>#golang<</p>", nil)
+	post2ID := createTestPost(t, db, "<p>>#golang< and >#go<</p>", nil)
+	post3ID := createTestPost(t, db, "<p>>#golang< edited later</p>", nil)
+	associateTagPost(t, db, sourceID, post1ID)
+	associateTagPost(t, db, sourceID, post2ID)
+	associateTagPost(t, db, targetID, post2ID)
+	associateTagPost(t, db, sourceID, post3ID)
+
+	if err := service.RenameOrMerge(ctx, "golang", "go"); err != nil {
+		t.Fatalf("RenameOrMerge failed: %v", err)
+	}
+	if _, err := db.Exec("UPDATE posts SET content = ? WHERE id = ?", "<p>>#go< edited</p>", post3ID); err != nil {
+		t.Fatalf("failed to edit post: %v", err)
+	}
+
+	deleted, err := service.GetDeleted(ctx)
+	if err != nil {
+		t.Fatalf("GetDeleted failed: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].Name != "golang" {
+		t.Fatalf("expected golang in the trash, got %+v", deleted)
+	}
+
+	if err := service.Restore(ctx, "golang"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	expected := map[int64]string{
+		post1ID: "<p>>#golang<</p>",
+		post2ID: "<p>>#golang< and >#go<</p>",
+		post3ID: "<p>>#golang< edited</p>",
+	}
+	for id, content := range expected {
+		var post models.Post
+		if err := db.Get(&post, "SELECT * FROM posts WHERE id = ?", id); err != nil {
+			t.Fatalf("failed to get post: %v", err)
+		}
+		if post.Content != content {
+			t.Errorf("expected content %q for post %d, got %q", content, id, post.Content)
+		}
+	}
+
+	var sourceCount, targetCount int
+	db.Get(&sourceCount, "SELECT COUNT(*) FROM tag_post_assoc WHERE tag_id = ?", sourceID)
+	db.Get(&targetCount, "SELECT COUNT(*) FROM tag_post_assoc WHERE tag_id = ?", targetID)
+	if sourceCount != 3 || targetCount != 1 {
+		t.Errorf("expected 3 posts for golang and 1 for go, got %d and %d", sourceCount, targetCount)
+	}
+
+	count, err := service.GetCount(ctx)
+	if err != nil {
+		t.Fatalf("GetCount failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 live tags after restore, got %d", count)
+	}
+
+	if err := service.Restore(ctx, "golang"); err != ErrTagNotFound {
+		t.Errorf("expected ErrTagNotFound for a live tag, got %v", err)
+	}
+}
+
+func TestRestore_Delete(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewTagService(db)
+	ctx := context.Background()
+
+	tagID := createTestTag(t, db, "tech", false)
+	subtagID := createTestTag(t, db, "tech/golang", false)
+
+	deletedAt := int64(1000)
+	post1ID := createTestPost(t, db, "Post 1", nil)
+	post2ID := createTestPost(t, db, "Post 2", nil)
+	post3ID := createTestPost(t, db, "Post 3", &deletedAt)
+	associateTagPost(t, db, tagID, post1ID)
+	associateTagPost(t, db, subtagID, post2ID)
+	associateTagPost(t, db, tagID, post3ID)
+
+	if err := service.DeleteAssociatedPosts(ctx, "tech"); err != nil {
+		t.Fatalf("DeleteAssociatedPosts failed: %v", err)
+	}
+
+	count, err := service.GetCount(ctx)
+	if err != nil {
+		t.Fatalf("GetCount failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected deleted tags to be excluded, got %d", count)
+	}
+
+	if err := service.Restore(ctx, "tech"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	var live []int64
+	if err := db.Select(&live, "SELECT id FROM posts WHERE deleted_at IS NULL ORDER BY id"); err != nil {
+		t.Fatalf("failed to query posts: %v", err)
+	}
+	if len(live) != 2 || live[0] != post1ID || live[1] != post2ID {
+		t.Errorf("expected the posts deleted with the tag to be restored, got %v", live)
+	}
+
+	var post models.Post
+	db.Get(&post, "SELECT * FROM posts WHERE id = ?", post3ID)
+	if post.DeletedAt.Int64 != deletedAt {
+		t.Error("a post deleted before the tag should stay deleted")
+	}
+
+	count, _ = service.GetCount(ctx)
+	if count != 2 {
+		t.Errorf("expected the tag and its subtag to be restored, got %d tags", count)
+	}
+}
+
+func TestRevive(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewTagService(db)
+	ctx := context.Background()
+
+	sourceID := createTestTag(t, db, "old", false)
+	createTestTag(t, db, "new", false)
+	associateTagPost(t, db, sourceID, createTestPost(t, db, ">#old<", nil))
+
+	if err := service.RenameOrMerge(ctx, "old", "new"); err != nil {
+		t.Fatalf("RenameOrMerge failed: %v", err)
+	}
+
+	// Using the name again takes the tag out of the trash, and forgets its merge
+	if err := service.InsertOrUpdate(ctx, "old", true); err != nil {
+		t.Fatalf("InsertOrUpdate failed: %v", err)
+	}
+
+	var tag models.Tag
+	if err := db.Get(&tag, "SELECT * FROM tags WHERE name = ?", "old"); err != nil {
+		t.Fatalf("failed to get tag: %v", err)
+	}
+	if tag.ID != sourceID || tag.DeletedAt.Valid || tag.MergedInto.Valid || !tag.Sticky {
+		t.Errorf("expected the tag to be revived, got %+v", tag)
+	}
+
+	var records int
+	db.Get(&records, "SELECT COUNT(*) FROM tag_merged_posts")
+	if records != 0 {
+		t.Errorf("expected the merge record to be dropped, got %d", records)
+	}
+}
+
+func TestPurgeDeletedTags(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewTagService(db)
+	ctx := context.Background()
+
+	createTestTag(t, db, "kept", false)
+	createTestTag(t, db, "trashed", false)
+	if err := service.DeleteAssociatedPosts(ctx, "trashed"); err != nil {
+		t.Fatalf("DeleteAssociatedPosts failed: %v", err)
+	}
+
+	purged, err := service.PurgeDeletedBefore(ctx, 0)
+	if err != nil {
+		t.Fatalf("PurgeDeletedBefore failed: %v", err)
+	}
+	if purged != 0 {
+		t.Errorf("expected recently deleted tags to be kept, purged %d", purged)
+	}
+
+	purged, err = service.PurgeDeletedBefore(ctx, time.Now().Add(time.Minute).UnixMilli())
+	if err != nil {
+		t.Fatalf("PurgeDeletedBefore failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 purged tag, got %d", purged)
+	}
+
+	var count int
+	db.Get(&count, "SELECT COUNT(*) FROM tags")
+	if count != 1 {
+		t.Errorf("expected only the live tag to remain, got %d", count)
+	}
+}
+
+func TestGetSharedPosts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewTagService(db)
+	ctx := context.Background()
+
+	tagID := createTestTag(t, db, "tech", false)
+	subtagID := createTestTag(t, db, "tech/golang", false)
+
+	var shared []int64
+	for i, tag := range []int64{tagID, subtagID, tagID} {
+		id := createTestPost(t, db, "Post", nil)
+		db.MustExec("UPDATE posts SET shared = 1, created_at = ? WHERE id = ?", i, id)
+		associateTagPost(t, db, tag, id)
+		shared = append(shared, id)
+	}
+	associateTagPost(t, db, tagID, createTestPost(t, db, "Private post", nil))
+
+	posts, err := service.GetSharedPosts(ctx, "tech", 2, 0)
+	if err != nil {
+		t.Fatalf("GetSharedPosts failed: %v", err)
+	}
+	if len(posts) != 2 || posts[0].ID != shared[2] || posts[1].ID != shared[1] {
+		t.Errorf("expected the 2 newest shared posts, got %+v", posts)
+	}
+
+	posts, err = service.GetSharedPosts(ctx, "tech", 2, 2)
+	if err != nil {
+		t.Fatalf("GetSharedPosts failed: %v", err)
+	}
+	if len(posts) != 1 || posts[0].ID != shared[0] {
+		t.Errorf("expected the oldest shared post on the second page, got %+v", posts)
+	}
+
+	posts, _ = service.GetSharedPosts(ctx, "tech/golang", 10, 0)
+	if len(posts) != 1 {
+		t.Errorf("expected 1 shared post under the subtag, got %d", len(posts))
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+// TaskStateService keeps the state of the background tasks in SQLite, so that it survives restarts
+type TaskStateService struct {
+	db     *DB
+	writes *WriteQueue
+}
+
+func NewTaskStateService(db *DB) *TaskStateService {
+	return &TaskStateService{db: db, writes: db.writes}
+}
+
+// Load returns the saved state of all tasks
+func (s *TaskStateService) Load(ctx context.Context) ([]models.TaskState, error) {
+	states := make([]models.TaskState, 0)
+	query := `
+		SELECT name, enabled, run_count, error_count, retries, last_run, last_error, tripped_until
+		FROM task_states
+	`
+	err := s.db.SelectContext(ctx, &states, query)
+	return states, err
+}
+
+// Save replaces the saved state of the given tasks
+func (s *TaskStateService) Save(ctx context.Context, states []models.TaskState) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixMilli()
+	query := `
+		INSERT INTO task_states
+			(name, enabled, run_count, error_count, retries, last_run, last_error, tripped_until, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			enabled = excluded.enabled,
+			run_count = excluded.run_count,
+			error_count = excluded.error_count,
+			retries = excluded.retries,
+			last_run = excluded.last_run,
+			last_error = excluded.last_error,
+			tripped_until = excluded.tripped_until,
+			updated_at = excluded.updated_at
+	`
+	for _, state := range states {
+		_, err := tx.ExecContext(ctx, query,
+			state.Name, state.Enabled, state.RunCount, state.ErrorCount, state.Retries,
+			state.LastRun, state.LastError, state.TrippedUntil, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
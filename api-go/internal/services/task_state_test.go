@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+func TestTaskStateService(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.MustExec("DELETE FROM task_states")
+
+	service := NewTaskStateService(db)
+	ctx := context.Background()
+
+	states := []models.TaskState{
+		{Name: "check-links", Enabled: false, RunCount: 3, ErrorCount: 1, LastError: "timeout",
+			LastRun:      models.NullInt64{NullInt64: sql.NullInt64{Int64: 1000, Valid: true}},
+			TrippedUntil: models.NullInt64{NullInt64: sql.NullInt64{Int64: 2000, Valid: true}}},
+		{Name: "backfill-post-titles", Enabled: true},
+	}
+	if err := service.Save(ctx, states); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	states[0].RunCount = 4
+	if err := service.Save(ctx, states[:1]); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := service.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded) != 2 {
+		t.Fatalf("expected 2 states, got %+v", loaded)
+	}
+	for _, state := range loaded {
+		if state.Name == "check-links" && (state.Enabled || state.RunCount != 4 || state.LastRun.Int64 != 1000 || state.LastError != "timeout" || state.TrippedUntil.Int64 != 2000) {
+			t.Errorf("unexpected state %+v", state)
+		}
+		if state.Name == "backfill-post-titles" && (!state.Enabled || state.LastRun.Valid || state.TrippedUntil.Valid) {
+			t.Errorf("unexpected state %+v", state)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrTemplateNotFound is returned when a template does not exist
+	ErrTemplateNotFound = errors.New("template not found")
+	// ErrTemplateNameTaken is returned when another template has the name
+	ErrTemplateNameTaken = errors.New("a template with this name already exists")
+	// ErrInvalidTemplate is returned for a template without name or with an invalid tag
+	ErrInvalidTemplate = errors.New("invalid template")
+)
+
+var placeholderRegex = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// ExpandTemplate replaces the date placeholders of the content of a template with their value at the given time:
+//
+//	{{date}}      2006-01-02
+//	{{time}}      15:04
+//	{{datetime}}  2006-01-02 15:04
+//	{{weekday}}   Monday
+//	{{week}}      2006-W01, the ISO week
+//	{{yesterday}} and {{tomorrow}}, like {{date}}
+//
+// Unknown placeholders are left as they are.
+func ExpandTemplate(content string, now time.Time) string {
+	return placeholderRegex.ReplaceAllStringFunc(content, func(placeholder string) string {
+		switch placeholderRegex.FindStringSubmatch(placeholder)[1] {
+		case "date":
+			return now.Format(time.DateOnly)
+		case "time":
+			return now.Format("15:04")
+		case "datetime":
+			return now.Format("2006-01-02 15:04")
+		case "weekday":
+			return now.Weekday().String()
+		case "week":
+			year, week := now.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		case "yesterday":
+			return now.AddDate(0, 0, -1).Format(time.DateOnly)
+		case "tomorrow":
+			return now.AddDate(0, 0, 1).Format(time.DateOnly)
+		}
+		return placeholder
+	})
+}
+
+// PostFromTemplate returns the request to create a post from a template at the given time
+// The placeholders of its content are expanded and its tags appended as hash tags, see ExpandTemplate.
+func PostFromTemplate(template *models.PostTemplate, now time.Time) models.CreatePostRequest {
+	content, _ := retagContent(ExpandTemplate(template.Content, now), template.Tags, nil)
+	req := models.CreatePostRequest{Content: content}
+	if template.Color.Valid {
+		req.Color = &template.Color.String
+	}
+	return req
+}
+
+// TemplateService keeps the templates of posts
+type TemplateService struct {
+	db     *DB
+	reader *sqlx.DB
+	writes *WriteQueue
+}
+
+func NewTemplateService(db *DB) *TemplateService {
+	return &TemplateService{db: db, reader: db.reader, writes: db.writes}
+}
+
+// templateRow is a template as stored, with its tags as a JSON array
+type templateRow struct {
+	ID        int64             `db:"id"`
+	Name      string            `db:"name"`
+	Content   string            `db:"content"`
+	Tags      string            `db:"tags"`
+	Color     models.NullString `db:"color"`
+	CreatedAt int64             `db:"created_at"`
+	UpdatedAt int64             `db:"updated_at"`
+}
+
+func (row templateRow) template() (models.PostTemplate, error) {
+	template := models.PostTemplate{
+		ID:        row.ID,
+		Name:      row.Name,
+		Content:   row.Content,
+		Color:     row.Color,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+	}
+	if err := json.Unmarshal([]byte(row.Tags), &template.Tags); err != nil {
+		return template, fmt.Errorf("failed to decode tags of template %d: %w", row.ID, err)
+	}
+	return template, nil
+}
+
+// GetAll returns the templates, by name
+func (s *TemplateService) GetAll(ctx context.Context) ([]models.PostTemplate, error) {
+	var rows []templateRow
+	if err := s.reader.SelectContext(ctx, &rows, "SELECT * FROM post_templates ORDER BY name"); err != nil {
+		return nil, err
+	}
+
+	templates := make([]models.PostTemplate, len(rows))
+	for i, row := range rows {
+		template, err := row.template()
+		if err != nil {
+			return nil, err
+		}
+		templates[i] = template
+	}
+	return templates, nil
+}
+
+// Get returns a template, or ErrTemplateNotFound
+func (s *TemplateService) Get(ctx context.Context, id int64) (*models.PostTemplate, error) {
+	var row templateRow
+	err := s.reader.GetContext(ctx, &row, "SELECT * FROM post_templates WHERE id = ?", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := row.template()
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// Create creates a template and returns it
+// It returns an error wrapping ErrInvalidTemplate for a request without name or with an invalid tag,
+// and ErrTemplateNameTaken if another template has the name.
+func (s *TemplateService) Create(ctx context.Context, req models.PostTemplateRequest) (*models.PostTemplate, error) {
+	tags, err := templateTags(req)
+	if err != nil {
+		return nil, err
+	}
+	tagsJSON, _ := json.Marshal(tags)
+
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := s.checkName(ctx, req.Name, 0); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	result, err := execerFor(ctx, s.db).ExecContext(ctx,
+		"INSERT INTO post_templates (name, content, tags, color, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		req.Name, req.Content, string(tagsJSON), req.Color, now, now)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	template := models.PostTemplate{ID: id, Name: req.Name, Content: req.Content, Tags: tags, CreatedAt: now, UpdatedAt: now}
+	if req.Color != nil {
+		template.Color = models.NullString{NullString: sql.NullString{String: *req.Color, Valid: true}}
+	}
+	return &template, nil
+}
+
+// Update replaces the name, content, tags and color of a template
+// It returns ErrTemplateNotFound if the template doesn't exist, and the errors of Create for an invalid request.
+func (s *TemplateService) Update(ctx context.Context, req models.PostTemplateRequest) error {
+	tags, err := templateTags(req)
+	if err != nil {
+		return err
+	}
+	tagsJSON, _ := json.Marshal(tags)
+
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var exists bool
+	err = s.db.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM post_templates WHERE id = ?)", req.ID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrTemplateNotFound
+	}
+	if err := s.checkName(ctx, req.Name, req.ID); err != nil {
+		return err
+	}
+
+	_, err = execerFor(ctx, s.db).ExecContext(ctx,
+		"UPDATE post_templates SET name = ?, content = ?, tags = ?, color = ?, updated_at = ? WHERE id = ?",
+		req.Name, req.Content, string(tagsJSON), req.Color, time.Now().UnixMilli(), req.ID)
+	return err
+}
+
+// Delete deletes a template, or returns ErrTemplateNotFound
+func (s *TemplateService) Delete(ctx context.Context, id int64) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	result, err := execerFor(ctx, s.db).ExecContext(ctx, "DELETE FROM post_templates WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// checkName returns ErrTemplateNameTaken if a template other than the one with the ID has the name
+func (s *TemplateService) checkName(ctx context.Context, name string, id int64) error {
+	var count int
+	err := s.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM post_templates WHERE name = ? AND id != ?", name, id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTemplateNameTaken
+	}
+	return nil
+}
+
+// templateTags checks the name and tags of a template and returns its tags
+// The tags are given without their leading #, which is trimmed if present.
+func templateTags(req models.PostTemplateRequest) ([]string, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("%w: name cannot be empty", ErrInvalidTemplate)
+	}
+
+	tags := make([]string, 0, len(req.Tags))
+	for _, tag := range req.Tags {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+		if tag == "" || strings.ContainsAny(tag, " \t\n<>&\"") {
+			return nil, fmt.Errorf("%w: invalid tag %q", ErrInvalidTemplate, tag)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 9, 5, 0, 0, time.UTC)
+	content := "<p>{{date}} {{ time }} {{weekday}} {{week}}</p><p>{{yesterday}} {{tomorrow}} {{unknown}}</p>"
+
+	expanded := ExpandTemplate(content, now)
+	expected := "<p>2026-01-01 09:05 Thursday 2026-W01</p><p>2025-12-31 2026-01-02 {{unknown}}</p>"
+	if expanded != expected {
+		t.Errorf("unexpected content:\n got %s\nwant %s", expanded, expected)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	templates := NewTemplateService(db)
+
+	color := "red"
+	template, err := templates.Create(ctx, models.PostTemplateRequest{
+		Name:    "daily",
+		Content: "<h1>{{date}}</h1>",
+		Tags:    []string{"#journal", "daily"},
+		Color:   &color,
+	})
+	if err != nil {
+		t.Fatalf("failed to create template: %v", err)
+	}
+
+	if _, err := templates.Create(ctx, models.PostTemplateRequest{Name: "daily"}); !errors.Is(err, ErrTemplateNameTaken) {
+		t.Errorf("expected ErrTemplateNameTaken, got %v", err)
+	}
+	if _, err := templates.Create(ctx, models.PostTemplateRequest{Name: "meeting", Tags: []string{"a b"}}); !errors.Is(err, ErrInvalidTemplate) {
+		t.Errorf("expected ErrInvalidTemplate, got %v", err)
+	}
+
+	got, err := templates.Get(ctx, template.ID)
+	if err != nil || got.Name != "daily" || len(got.Tags) != 2 || got.Tags[0] != "journal" || got.Color.String != "red" {
+		t.Fatalf("expected the template, got %+v: %v", got, err)
+	}
+
+	req := PostFromTemplate(got, time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC))
+	expected := `<h1>2026-03-04</h1><p><span class="hash-tag">#journal</span> <span class="hash-tag">#daily</span></p>`
+	if req.Content != expected || req.Color == nil || *req.Color != "red" {
+		t.Errorf("unexpected post:\n got %s\nwant %s", req.Content, expected)
+	}
+
+	update := models.PostTemplateRequest{ID: template.ID, Name: "journal", Content: "<p>{{weekday}}</p>"}
+	if err := templates.Update(ctx, update); err != nil {
+		t.Fatalf("failed to update template: %v", err)
+	}
+	all, err := templates.GetAll(ctx)
+	if err != nil || len(all) != 1 || all[0].Name != "journal" || len(all[0].Tags) != 0 || all[0].Color.Valid {
+		t.Errorf("expected the updated template, got %+v: %v", all, err)
+	}
+
+	update.ID = template.ID + 1
+	if err := templates.Update(ctx, update); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound, got %v", err)
+	}
+	if err := templates.Delete(ctx, template.ID); err != nil {
+		t.Fatalf("failed to delete template: %v", err)
+	}
+	if _, err := templates.Get(ctx, template.ID); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+// ThumbnailProgress reports the state of a regeneration of thumbnails
+type ThumbnailProgress struct {
+	// Posts is the number of posts with files, and Done the number of them checked
+	Posts int `json:"posts"`
+	Done  int `json:"done"`
+	// Regenerated is the number of files saved, the ones whose content type was detected for the first time included
+	Regenerated int      `json:"regenerated"`
+	Failed      int      `json:"failed"`
+	Errors      []string `json:"errors"`
+}
+
+func (p *ThumbnailProgress) addError(format string, args ...any) {
+	if len(p.Errors) < maxThumbnailErrors {
+		p.Errors = append(p.Errors, fmt.Sprintf(format, args...))
+	}
+}
+
+// maxThumbnailErrors is the number of errors kept in a ThumbnailProgress
+const maxThumbnailErrors = 20
+
+// RegenerateThumbnails brings the thumbnails of the files of all posts, deleted ones included, up to date with the
+// current thumbnail width and image formats, see UploadService.RegenerateThumbnail
+// It waits delay after each regenerated file so that the images don't hog the CPU and disk, and calls onProgress,
+// if not nil, after each post. A file that fails is reported in the progress and skipped.
+func RegenerateThumbnails(ctx context.Context, db *DB, uploads *UploadService, delay time.Duration,
+	onProgress func(ThumbnailProgress)) (*ThumbnailProgress, error) {
+	var ids []int64
+	if err := db.SelectContext(ctx, &ids, "SELECT id FROM posts WHERE files IS NOT NULL ORDER BY id"); err != nil {
+		return nil, err
+	}
+
+	progress := &ThumbnailProgress{Posts: len(ids), Errors: []string{}}
+	for _, id := range ids {
+		var raw models.NullRawMessage
+		err := db.GetContext(ctx, &raw, "SELECT files FROM posts WHERE id = ?", id)
+		if err != nil {
+			return progress, err
+		}
+
+		var files []models.FileInfo
+		if raw.Valid {
+			if err := json.Unmarshal(raw.RawMessage, &files); err != nil {
+				progress.Failed++
+				progress.addError("post %d: failed to decode files: %v", id, err)
+			}
+		}
+
+		// The images are processed outside of the write queue, and only the changed files are saved
+		changed := map[string]models.FileInfo{}
+		for _, file := range files {
+			regenerated, ok, err := uploads.RegenerateThumbnail(ctx, file)
+			if err != nil {
+				progress.Failed++
+				progress.addError("post %d: %s: %v", id, file.URL, err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			changed[file.URL] = regenerated
+			progress.Regenerated++
+
+			select {
+			case <-ctx.Done():
+				return progress, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		if len(changed) > 0 {
+			if err := replaceFiles(ctx, db, id, changed); err != nil {
+				return progress, fmt.Errorf("failed to save files of post %d: %w", id, err)
+			}
+		}
+
+		progress.Done++
+		if onProgress != nil {
+			snapshot := *progress
+			snapshot.Errors = append([]string{}, progress.Errors...)
+			onProgress(snapshot)
+		}
+	}
+	return progress, nil
+}
+
+// StrayThumbnails reports the thumbnails deleted by DeleteStrayThumbnails
+type StrayThumbnails struct {
+	Deleted        int64 `json:"deleted"`
+	BytesReclaimed int64 `json:"bytes_reclaimed"`
+}
+
+// DeleteStrayThumbnails deletes the thumbnails left in the upload directory after their original was deleted
+// A thumbnail is paired with its original by name. The files of the posts, deleted ones included, are kept even
+// without original, e.g. an upload named like a thumbnail. Nothing is deleted if dryRun is true.
+func DeleteStrayThumbnails(ctx context.Context, db *DB, uploads *UploadService, dryRun bool) (*StrayThumbnails, error) {
+	rows, err := db.QueryxContext(ctx, "SELECT files FROM posts WHERE files IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	referenced := map[string]bool{}
+	for rows.Next() {
+		var raw models.NullRawMessage
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var files []models.FileInfo
+		if err := json.Unmarshal(raw.RawMessage, &files); err != nil {
+			continue
+		}
+		for _, file := range files {
+			referenced[file.URL] = true
+			if file.ThumbURL != nil {
+				referenced[*file.ThumbURL] = true
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	deleted, reclaimed, err := uploads.deleteStrayThumbnails(referenced, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return &StrayThumbnails{Deleted: deleted, BytesReclaimed: reclaimed}, nil
+}
+
+// replaceFiles replaces the files of a post with the changed ones having the same URL
+// The files are read again in the transaction, so that an edit made meanwhile, e.g. a caption, isn't lost.
+func replaceFiles(ctx context.Context, db *DB, id int64, changed map[string]models.FileInfo) error {
+	release, err := db.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := beginTx(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The post may have been deleted for good, or lost its files, meanwhile
+	var raw models.NullRawMessage
+	err = tx.GetContext(ctx, &raw, "SELECT files FROM posts WHERE id = ?", id)
+	if err == sql.ErrNoRows || (err == nil && !raw.Valid) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var files []models.FileInfo
+	if err := json.Unmarshal(raw.RawMessage, &files); err != nil {
+		return err
+	}
+
+	for i, file := range files {
+		if regenerated, ok := changed[file.URL]; ok {
+			regenerated.Caption = file.Caption
+			files[i] = regenerated
+		}
+	}
+	data, err := json.Marshal(files)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE posts SET files = ? WHERE id = ?", string(data), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/internal/testutil"
+)
+
+func TestRegenerateThumbnails(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	upload := &config.UploadConfig{BaseURL: "/uploads", BasePath: t.TempDir(), ImageFormats: []string{"png"}, ThumbWidth: 128}
+	uploads := NewUploadService(upload, NewImagePool(upload))
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 300, 100)))
+	wide, err := uploads.SaveFile(context.Background(), "wide.png", "", bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to save image: %v", err)
+	}
+	caption := "a wide image"
+	wide.Caption = &caption
+	text, err := uploads.SaveFile(context.Background(), "notes.txt", "", bytes.NewReader([]byte("notes")))
+	if err != nil {
+		t.Fatalf("failed to save file: %v", err)
+	}
+	post := testutil.CreatePost(t, db, models.Post{Files: testutil.Files(t, *wide, *text)})
+
+	files := func() []models.FileInfo {
+		var raw models.NullRawMessage
+		if err := db.Get(&raw, "SELECT files FROM posts WHERE id = ?", post.ID); err != nil {
+			t.Fatalf("failed to get files: %v", err)
+		}
+		var files []models.FileInfo
+		json.Unmarshal(raw.RawMessage, &files)
+		return files
+	}
+
+	// Up to date thumbnails are left alone
+	progress, err := RegenerateThumbnails(context.Background(), db, uploads, 0, nil)
+	if err != nil || progress.Posts != 1 || progress.Done != 1 || progress.Regenerated != 0 {
+		t.Fatalf("expected nothing to regenerate, got %+v: %v", progress, err)
+	}
+
+	upload.ThumbWidth = 64
+	var reported []ThumbnailProgress
+	progress, err = RegenerateThumbnails(context.Background(), db, uploads, 0, func(p ThumbnailProgress) {
+		reported = append(reported, p)
+	})
+	if err != nil || progress.Regenerated != 1 || progress.Failed != 0 || len(reported) != 1 {
+		t.Fatalf("expected the thumbnail to be regenerated, got %+v: %v", progress, err)
+	}
+	got := files()
+	thumbPath, _ := uploads.resolveFilePath(*got[0].ThumbURL)
+	if width, _ := imageWidth(thumbPath); width != 64 || got[0].Caption == nil || *got[0].Caption != caption {
+		t.Errorf("expected a thumbnail 64 pixels wide keeping the caption, got %d: %+v", width, got[0])
+	}
+
+	// An image no longer wider than the thumbnails is its own thumbnail
+	upload.ThumbWidth = 400
+	if _, err := RegenerateThumbnails(context.Background(), db, uploads, 0, nil); err != nil {
+		t.Fatalf("failed to regenerate thumbnails: %v", err)
+	}
+	got = files()
+	if *got[0].ThumbURL != got[0].URL || got[1].ThumbURL != nil {
+		t.Errorf("expected the image to be its own thumbnail and the text file to be left alone, got %+v", got)
+	}
+	if _, ok := imageWidth(thumbPath); ok {
+		t.Error("expected the old thumbnail to be deleted")
+	}
+}
+
+func TestDeleteStrayThumbnails(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	dir := t.TempDir()
+	upload := &config.UploadConfig{BaseURL: "/uploads", BasePath: dir}
+	uploads := NewUploadService(upload, NewImagePool(upload))
+
+	old := time.Now().Add(-2 * strayThumbnailAge)
+	write := func(name string, modTime time.Time) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("image"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		os.Chtimes(path, modTime, modTime)
+	}
+	write("kept.png", old)
+	write("thumb_kept.png", old)
+	write("thumb_gone.png", old)
+	write("thumb_recent.png", time.Now())
+	write("thumb_upload.png", old)
+	testutil.CreatePost(t, db, models.Post{Files: testutil.Files(t, models.FileInfo{URL: "/uploads/thumb_upload.png"})})
+
+	result, err := DeleteStrayThumbnails(context.Background(), db, uploads, true)
+	if err != nil || result.Deleted != 1 || result.BytesReclaimed != 5 {
+		t.Fatalf("expected one thumbnail to be deleted, got %+v: %v", result, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "thumb_gone.png")); err != nil {
+		t.Errorf("expected a dry run to keep the thumbnail, got %v", err)
+	}
+
+	if _, err := DeleteStrayThumbnails(context.Background(), db, uploads, false); err != nil {
+		t.Fatalf("failed to delete stray thumbnails: %v", err)
+	}
+	for name, kept := range map[string]bool{
+		"thumb_kept.png": true, "thumb_gone.png": false, "thumb_recent.png": true, "thumb_upload.png": true,
+	} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != kept {
+			t.Errorf("%s: expected kept=%v, got %v", name, kept, err)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mote/pkg/util/totp"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorNotConfigured = errors.New("two-factor authentication is not configured")
+	ErrTwoFactorNotEnrolled   = errors.New("two-factor authentication is not enrolled")
+)
+
+type twoFactorRecord struct {
+	ID            int64  `db:"id"`
+	Secret        string `db:"secret"`
+	Enabled       bool   `db:"enabled"`
+	RecoveryCodes string `db:"recovery_codes"`
+	LastStep      int64  `db:"last_step"`
+	CreatedAt     int64  `db:"created_at"`
+	UpdatedAt     int64  `db:"updated_at"`
+}
+
+// TwoFactorService manages the TOTP secret and recovery codes of the instance
+// The secret is encrypted at rest with AES-GCM, recovery codes are stored hashed
+type TwoFactorService struct {
+	db     *DB
+	writes *WriteQueue
+	key    []byte
+}
+
+// NewTwoFactorService creates a TwoFactorService, key is the 32-byte encryption key
+// With an empty key, two-factor authentication can't be enrolled
+func NewTwoFactorService(db *DB, key []byte) *TwoFactorService {
+	return &TwoFactorService{db: db, writes: db.writes, key: key}
+}
+
+// IsAvailable reports whether an encryption key is configured, which enrolling requires
+func (s *TwoFactorService) IsAvailable() bool {
+	return len(s.key) > 0
+}
+
+// IsEnabled reports whether two-factor authentication is enrolled and confirmed
+func (s *TwoFactorService) IsEnabled(ctx context.Context) (bool, error) {
+	record, err := s.get(ctx)
+	if err != nil || record == nil {
+		return false, err
+	}
+	return record.Enabled, nil
+}
+
+// Enroll generates a new secret, which is only enforced after it is confirmed with a valid code
+// Re-enrolling replaces a pending secret, but not an enabled one
+func (s *TwoFactorService) Enroll(ctx context.Context) (string, error) {
+	if len(s.key) == 0 {
+		return "", ErrTwoFactorNotConfigured
+	}
+
+	record, err := s.get(ctx)
+	if err != nil {
+		return "", err
+	}
+	if record != nil && record.Enabled {
+		return "", errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := s.encrypt(secret)
+	if err != nil {
+		return "", err
+	}
+
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	now := time.Now().UnixMilli()
+	query := `
+		INSERT INTO two_factor (id, secret, enabled, recovery_codes, last_step, created_at, updated_at)
+		VALUES (1, ?, FALSE, '[]', 0, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET secret = excluded.secret, updated_at = excluded.updated_at
+	`
+	if _, err := execerFor(ctx, s.db).ExecContext(ctx, query, encrypted, now, now); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Confirm enables two-factor authentication if the code matches the pending secret
+// It returns the recovery codes, which are only shown this once
+func (s *TwoFactorService) Confirm(ctx context.Context, code string) ([]string, bool, error) {
+	record, err := s.get(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if record == nil {
+		return nil, false, ErrTwoFactorNotEnrolled
+	}
+
+	ok, err := s.verifyCode(ctx, record, code)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, false, err
+	}
+
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
+	_, err = execerFor(ctx, s.db).ExecContext(ctx,
+		"UPDATE two_factor SET enabled = TRUE, recovery_codes = ?, updated_at = ? WHERE id = 1",
+		hashes, time.Now().UnixMilli())
+	if err != nil {
+		return nil, false, err
+	}
+	return codes, true, nil
+}
+
+// Verify checks a TOTP code or, failing that, consumes a recovery code
+func (s *TwoFactorService) Verify(ctx context.Context, code string) (bool, error) {
+	record, err := s.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	if record == nil || !record.Enabled {
+		return false, ErrTwoFactorNotEnrolled
+	}
+
+	ok, err := s.verifyCode(ctx, record, code)
+	if err != nil || ok {
+		return ok, err
+	}
+	return s.useRecoveryCode(ctx, record, code)
+}
+
+// Disable removes the secret and recovery codes
+func (s *TwoFactorService) Disable(ctx context.Context) error {
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = execerFor(ctx, s.db).ExecContext(ctx, "DELETE FROM two_factor")
+	return err
+}
+
+// verifyCode checks a TOTP code and records its time step, so the same code can't be used twice
+func (s *TwoFactorService) verifyCode(ctx context.Context, record *twoFactorRecord, code string) (bool, error) {
+	secret, err := s.decrypt(record.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(secret, strings.TrimSpace(code), time.Now(), 1)
+	if !ok {
+		return false, nil
+	}
+
+	release, err := s.writes.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	// The condition makes concurrent uses of the same code race for a single row update
+	result, err := execerFor(ctx, s.db).ExecContext(ctx,
+		"UPDATE two_factor SET last_step = ? WHERE id = 1 AND last_step < ?", step, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// useRecoveryCode removes the matching recovery code, each one can be used only once
+func (s *TwoFactorService) useRecoveryCode(ctx context.Context, record *twoFactorRecord, code string) (bool, error) {
+	var hashes []string
+	if err := json.Unmarshal([]byte(record.RecoveryCodes), &hashes); err != nil {
+		return false, err
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, h := range hashes {
+		if h != hash {
+			continue
+		}
+
+		release, err := s.writes.Acquire(ctx)
+		if err != nil {
+			return false, err
+		}
+		defer release()
+
+		remaining, _ := json.Marshal(append(hashes[:i:i], hashes[i+1:]...))
+		result, err := execerFor(ctx, s.db).ExecContext(ctx,
+			"UPDATE two_factor SET recovery_codes = ?, updated_at = ? WHERE id = 1 AND recovery_codes = ?",
+			string(remaining), time.Now().UnixMilli(), record.RecoveryCodes)
+		if err != nil {
+			return false, err
+		}
+		affected, err := result.RowsAffected()
+		return affected == 1, err
+	}
+	return false, nil
+}
+
+func (s *TwoFactorService) get(ctx context.Context) (*twoFactorRecord, error) {
+	var record twoFactorRecord
+	err := s.db.GetContext(ctx, &record, "SELECT * FROM two_factor WHERE id = 1")
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// encrypt seals the plaintext with AES-GCM and returns the nonce and ciphertext in base64
+func (s *TwoFactorService) encrypt(plaintext string) (string, error) {
+	gcm, err := s.cipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a value sealed by encrypt
+func (s *TwoFactorService) decrypt(encoded string) (string, error) {
+	gcm, err := s.cipher()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret, was the key changed? %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func (s *TwoFactorService) cipher() (cipher.AEAD, error) {
+	if len(s.key) == 0 {
+		return nil, ErrTwoFactorNotConfigured
+	}
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// generateRecoveryCodes returns new recovery codes and the JSON array of their hashes
+func generateRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, "", err
+		}
+		code := hex.EncodeToString(b)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	data, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, "", err
+	}
+	return codes, string(data), nil
+}
+
+// hashRecoveryCode normalizes the code, so that it is accepted with or without the dash and in any case
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
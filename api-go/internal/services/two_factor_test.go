@@ -0,0 +1,75 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/pkg/util/totp"
+)
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewTwoFactorService(db, bytes.Repeat([]byte{1}, 32))
+	ctx := context.Background()
+
+	secret, err := service.Enroll(ctx)
+	if err != nil {
+		t.Fatalf("Enroll failed: %v", err)
+	}
+
+	// The secret must not be stored in plain text
+	var stored string
+	if err := db.Get(&stored, "SELECT secret FROM two_factor"); err != nil {
+		t.Fatalf("failed to read secret: %v", err)
+	}
+	if stored == secret {
+		t.Error("expected secret to be encrypted")
+	}
+
+	if enabled, _ := service.IsEnabled(ctx); enabled {
+		t.Error("expected two-factor auth to be pending until confirmed")
+	}
+
+	code, _ := totp.Code(secret, totp.Step(time.Now()))
+	codes, ok, err := service.Confirm(ctx, code)
+	if err != nil || !ok {
+		t.Fatalf("Confirm failed: %v, %v", ok, err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+
+	// A code can't be used twice
+	if ok, _ := service.Verify(ctx, code); ok {
+		t.Error("expected replayed code to be rejected")
+	}
+
+	// Recovery codes are single-use
+	if ok, err := service.Verify(ctx, codes[0]); err != nil || !ok {
+		t.Errorf("expected recovery code to be accepted, got %v, %v", ok, err)
+	}
+	if ok, _ := service.Verify(ctx, codes[0]); ok {
+		t.Error("expected used recovery code to be rejected")
+	}
+
+	if err := service.Disable(ctx); err != nil {
+		t.Fatalf("Disable failed: %v", err)
+	}
+	if enabled, _ := service.IsEnabled(ctx); enabled {
+		t.Error("expected two-factor auth to be disabled")
+	}
+}
+
+func TestTwoFactorRequiresKey(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := NewTwoFactorService(db, nil)
+	if _, err := service.Enroll(context.Background()); err != ErrTwoFactorNotConfigured {
+		t.Errorf("expected ErrTwoFactorNotConfigured, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// requestTx is the transaction of a request, which the writes of the services to its database join, see BeginRequestTx
+type requestTx struct {
+	db *DB
+	tx *sqlx.Tx
+
+	mu          sync.Mutex
+	afterCommit []func()
+}
+
+type requestTxKey struct{}
+
+// requestTxOf returns the transaction of the request of the context, nil if it has none
+func requestTxOf(ctx context.Context) *requestTx {
+	rt, _ := ctx.Value(requestTxKey{}).(*requestTx)
+	return rt
+}
+
+// requestTxFor returns the transaction of the request of the context if it writes to the database, nil otherwise
+func requestTxFor(ctx context.Context, db *DB) *requestTx {
+	if rt := requestTxOf(ctx); rt != nil && rt.db == db {
+		return rt
+	}
+	return nil
+}
+
+// errTxEnded is returned by the end of a request transaction called more than once
+var errTxEnded = errors.New("the transaction of the request already ended")
+
+// BeginRequestTx waits for the turn of a request to write to the database and begins a transaction, which the writes
+// of the services join through the returned context, so that a request writing with several services is atomic.
+// The request holds the write queue until end is called, once, with whether to commit or roll back; it returns the
+// error of the commit or rollback. The functions given to AfterCommit are called once committed.
+// A context already in a transaction of the database joins it, end is then left to the one who began it.
+func BeginRequestTx(ctx context.Context, db *DB) (context.Context, func(commit bool) error, error) {
+	if requestTxFor(ctx, db) != nil {
+		return ctx, func(bool) error { return nil }, nil
+	}
+
+	release, err := contentWritesFor(db).Acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+
+	rt := &requestTx{db: db, tx: tx}
+	var once sync.Once
+	end := func(commit bool) error {
+		err := errTxEnded
+		once.Do(func() {
+			if !commit {
+				err = tx.Rollback()
+				release()
+				return
+			}
+			err = tx.Commit()
+			// The queue is released first, the functions may set off writes of their own
+			release()
+			if err == nil {
+				rt.mu.Lock()
+				fns := rt.afterCommit
+				rt.mu.Unlock()
+				for _, fn := range fns {
+					fn()
+				}
+			}
+		})
+		return err
+	}
+	return context.WithValue(ctx, requestTxKey{}, rt), end, nil
+}
+
+// RunInTx runs fn in a transaction of the database, see BeginRequestTx, committed if fn returns nil
+func RunInTx(ctx context.Context, db *DB, fn func(ctx context.Context) error) error {
+	ctx, end, err := BeginRequestTx(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			end(false)
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx); err != nil {
+		end(false)
+		return err
+	}
+	return end(true)
+}
+
+// AfterCommit calls fn once the transaction of the request of the context commits, and never if it rolls back, so
+// that the side effects of a write, e.g. indexing a post or deleting its files, don't outrun it
+// Outside a transaction, fn is called right away.
+func AfterCommit(ctx context.Context, fn func()) {
+	rt := requestTxOf(ctx)
+	if rt == nil {
+		fn()
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.afterCommit = append(rt.afterCommit, fn)
+}
+
+// serviceTx is the transaction of a write of a service, or the one of the request it joins, whose commit and
+// rollback are then left to the request
+type serviceTx struct {
+	*sqlx.Tx
+	joined bool
+}
+
+// beginTx begins a transaction of the database for a write, joining the one of the request if any
+// The caller holds the write queue, which the request does for a joined transaction, see WriteQueue.Acquire.
+func beginTx(ctx context.Context, db *DB) (*serviceTx, error) {
+	if rt := requestTxFor(ctx, db); rt != nil {
+		return &serviceTx{Tx: rt.tx, joined: true}, nil
+	}
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &serviceTx{Tx: tx}, nil
+}
+
+// Commit commits the transaction, unless it's the one of the request
+func (t *serviceTx) Commit() error {
+	if t.joined {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+// Rollback rolls back the transaction, unless it's the one of the request, which rolls back once its handler fails
+func (t *serviceTx) Rollback() error {
+	if t.joined {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
+
+// execerFor returns the transaction of the request writing to the database if any, the database otherwise, for the
+// writes of a single statement
+func execerFor(ctx context.Context, db *DB) sqlx.ExecerContext {
+	if rt := requestTxFor(ctx, db); rt != nil {
+		return rt.tx
+	}
+	return db
+}
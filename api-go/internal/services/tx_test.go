@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+func TestRunInTx(t *testing.T) {
+	db := setupTestDB(t)
+	posts := NewPostService(db)
+	activities := NewActivityService(db)
+	ctx := context.Background()
+
+	write := func(ctx context.Context) (*bool, error) {
+		committed := new(bool)
+		if _, err := posts.Create(ctx, models.CreatePostRequest{Content: `<p>hello <span class="hash-tag">#greeting</span></p>`}); err != nil {
+			return nil, err
+		}
+		if err := activities.Record(ctx, models.ActivityImportCompleted, "imported"); err != nil {
+			return nil, err
+		}
+		AfterCommit(ctx, func() { *committed = true })
+		return committed, nil
+	}
+	counts := func() (postCount, activityCount, tagCount int) {
+		db.Get(&postCount, "SELECT COUNT(*) FROM posts")
+		db.Get(&activityCount, "SELECT COUNT(*) FROM activities")
+		db.Get(&tagCount, "SELECT COUNT(*) FROM tags")
+		return
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		var committed *bool
+		errFailed := errors.New("failed")
+		err := RunInTx(ctx, db, func(ctx context.Context) error {
+			var err error
+			if committed, err = write(ctx); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		if !errors.Is(err, errFailed) {
+			t.Fatalf("RunInTx() = %v, want %v", err, errFailed)
+		}
+		if p, a, g := counts(); p != 0 || a != 0 || g != 0 {
+			t.Errorf("counts after rollback = %d posts, %d activities, %d tags, want none", p, a, g)
+		}
+		if *committed {
+			t.Error("AfterCommit function called after a rollback")
+		}
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		var committed *bool
+		err := RunInTx(ctx, db, func(ctx context.Context) error {
+			var err error
+			committed, err = write(ctx)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("RunInTx() = %v", err)
+		}
+		// A post, its activity and the one recorded, and its tag
+		if p, a, g := counts(); p != 1 || a != 2 || g != 1 {
+			t.Errorf("counts after commit = %d posts, %d activities, %d tags, want 1, 2 and 1", p, a, g)
+		}
+		if !*committed {
+			t.Error("AfterCommit function not called after the commit")
+		}
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		err := RunInTx(ctx, db, func(ctx context.Context) error {
+			// The inner one joins the outer one, which rolls back both
+			if err := RunInTx(ctx, db, func(ctx context.Context) error {
+				_, err := posts.Create(ctx, models.CreatePostRequest{Content: "<p>inner</p>"})
+				return err
+			}); err != nil {
+				return err
+			}
+			return errors.New("failed")
+		})
+		if err == nil {
+			t.Fatal("RunInTx() = nil, want the error of the outer function")
+		}
+		if p, _, _ := counts(); p != 1 {
+			t.Errorf("post count = %d, want 1", p)
+		}
+	})
+
+	t.Run("read after write", func(t *testing.T) {
+		tags := NewTagService(db)
+		deletedAt := int64(1)
+		deleted := createTestPostWithFiles(t, db, `[{"url":"/uploads/a.png"}]`, &deletedAt)
+
+		errFailed := errors.New("failed")
+		err := RunInTx(ctx, db, func(ctx context.Context) error {
+			// The tag created by the post is renamed, and the files of the deleted post found orphaned
+			_, err := posts.Create(ctx, models.CreatePostRequest{Content: `<p><span class="hash-tag">#draft</span></p>`})
+			if err != nil {
+				return err
+			}
+			if err := tags.RenameOrMerge(ctx, "draft", "final"); err != nil {
+				return err
+			}
+			files, err := posts.HardDelete(ctx, deleted)
+			if err != nil {
+				return err
+			}
+			if len(files) != 1 {
+				t.Errorf("orphaned files = %+v, want a.png", files)
+			}
+			return errFailed
+		})
+		if !errors.Is(err, errFailed) {
+			t.Fatalf("RunInTx() = %v, want %v", err, errFailed)
+		}
+
+		// The hard delete rolled back with the rest
+		var count int
+		db.Get(&count, "SELECT COUNT(*) FROM posts WHERE id = ?", deleted)
+		if count != 1 {
+			t.Error("expected the post deleted for good to be back after the rollback")
+		}
+	})
+
+	t.Run("outside", func(t *testing.T) {
+		called := false
+		AfterCommit(ctx, func() { called = true })
+		if !called {
+			t.Error("AfterCommit function not called right away outside a transaction")
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/jpeg"
@@ -8,12 +9,12 @@ import (
 	"io"
 	"log"
 	"mime/multipart"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/cymoo/mote/internal/config"
 	"github.com/cymoo/mote/internal/models"
@@ -26,10 +27,13 @@ import (
 var invalidCharsRegex = regexp.MustCompile(`[^\w\-.\p{Han}]+`)
 
 type UploadService struct {
-	config *config.UploadConfig
+	config  *config.UploadConfig
+	images  *ImagePool
+	sniffer ContentSniffer
 }
 
-func NewUploadService(config *config.UploadConfig) *UploadService {
+// NewUploadService creates the service storing the uploads, processing the images with the given pool
+func NewUploadService(config *config.UploadConfig, images *ImagePool) *UploadService {
 	if config.ThumbWidth == 0 {
 		config.ThumbWidth = 200
 	}
@@ -40,20 +44,30 @@ func NewUploadService(config *config.UploadConfig) *UploadService {
 	}
 
 	return &UploadService{
-		config: config,
+		config:  config,
+		images:  images,
+		sniffer: MagicSniffer{},
 	}
 }
 
 // UploadFile handles the file upload process
 // It saves the file, processes images, and returns FileInfo
-func (s *UploadService) UploadFile(fileHeader *multipart.FileHeader) (*models.FileInfo, error) {
+func (s *UploadService) UploadFile(ctx context.Context, fileHeader *multipart.FileHeader) (*models.FileInfo, error) {
 	file, err := fileHeader.Open()
 	if err != nil {
 		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
 	}
 	defer file.Close()
 
-	secureFileName := generateSecureFilename(fileHeader.Filename, 8)
+	return s.SaveFile(ctx, fileHeader.Filename, fileHeader.Header.Get("Content-Type"), file)
+}
+
+// SaveFile stores the content of a file under a secure name, processes images, and returns FileInfo
+// The content type is detected from the content, the given one only being kept for a content that isn't recognized,
+// and saved with the file. An image waits for a worker of the image pool, and the file is not kept
+// if the pool is busy, see ImagePool.Acquire.
+func (s *UploadService) SaveFile(ctx context.Context, name, contentType string, file io.Reader) (*models.FileInfo, error) {
+	secureFileName := generateSecureFilename(name, 8)
 	filePath := filepath.Join(s.config.BasePath, secureFileName)
 
 	// Create the destination file
@@ -70,24 +84,28 @@ func (s *UploadService) UploadFile(fileHeader *multipart.FileHeader) (*models.Fi
 	}
 	dst.Close()
 
-	// Get content type from header
-	contentType := fileHeader.Header.Get("Content-Type")
-	if contentType == "" {
-		// detectContentType reads the first 512 bytes of the file to determine its content type.
-		if detectedType, err := detectContentType(filePath); err == nil {
-			contentType = detectedType
-		}
+	// The content type sent by the client is not trusted, but says more than an unknown content
+	if detected, err := s.detectContentType(filePath); err == nil && (detected != unknownContentType || contentType == "") {
+		contentType = detected
+	} else {
+		contentType = mediaType(contentType)
 	}
 
 	if s.isImage(contentType) {
+		release, err := s.images.Acquire(ctx)
+		if err != nil {
+			os.Remove(filePath)
+			return nil, err
+		}
+		defer release()
 		return s.processImageFile(filePath, contentType)
 	}
-	return s.processRegularFile(filePath)
+	return s.processRegularFile(filePath, contentType)
 }
 
 // processRegularFile handles non-image files
-// It simply returns the FileInfo with URL and size
-func (s *UploadService) processRegularFile(filePath string) (*models.FileInfo, error) {
+// It simply returns the FileInfo with URL, size and content type
+func (s *UploadService) processRegularFile(filePath, contentType string) (*models.FileInfo, error) {
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get file info: %w", err)
@@ -97,13 +115,14 @@ func (s *UploadService) processRegularFile(filePath string) (*models.FileInfo, e
 	size := uint64(fileInfo.Size())
 
 	return &models.FileInfo{
-		URL:  s.buildFileURL(fileName),
-		Size: &size,
+		URL:         s.buildFileURL(fileName),
+		Size:        &size,
+		ContentType: &contentType,
 	}, nil
 }
 
 // processImageFile handles image-specific processing like EXIF rotation and thumbnail generation
-// It returns the FileInfo with URL, thumbnail URL, size, width, and height
+// It returns the FileInfo with URL, thumbnail URL, size, width, height, and content type
 func (s *UploadService) processImageFile(filePath, contentType string) (*models.FileInfo, error) {
 	// Read the image
 	img, err := decodeImage(filePath, contentType)
@@ -139,11 +158,12 @@ func (s *UploadService) processImageFile(filePath, contentType string) (*models.
 	height := uint32(bounds.Dy())
 
 	return &models.FileInfo{
-		URL:      s.buildFileURL(fileName),
-		ThumbURL: &thumbURL,
-		Size:     &size,
-		Width:    &width,
-		Height:   &height,
+		URL:         s.buildFileURL(fileName),
+		ThumbURL:    &thumbURL,
+		Size:        &size,
+		Width:       &width,
+		Height:      &height,
+		ContentType: &contentType,
 	}, nil
 }
 
@@ -162,7 +182,7 @@ func (s *UploadService) generateThumbnail(originalPath string, img image.Image)
 	thumbnail := imaging.Thumbnail(img, int(s.config.ThumbWidth), thumbHeight, imaging.Lanczos)
 
 	fileName := filepath.Base(originalPath)
-	thumbFileName := "thumb_" + fileName
+	thumbFileName := thumbPrefix + fileName
 	thumbPath := filepath.Join(s.config.BasePath, thumbFileName)
 
 	if err := saveImage(thumbPath, thumbnail); err != nil {
@@ -172,20 +192,248 @@ func (s *UploadService) generateThumbnail(originalPath string, img image.Image)
 	return s.buildFileURL(thumbFileName), nil
 }
 
+// RegenerateThumbnail makes the thumbnail of an uploaded image match the current thumbnail width and image formats
+// It returns the file with its new thumbnail and true if it changed, or the file and false if its thumbnail is up
+// to date or it isn't an uploaded image. A file uploaded before its format was an image format is processed like a
+// new upload. The image waits for a worker of the image pool like an upload.
+// The content type of a file uploaded before it was saved with the files is detected, the file then changing too.
+func (s *UploadService) RegenerateThumbnail(ctx context.Context, file models.FileInfo) (models.FileInfo, bool, error) {
+	filePath, ok := s.resolveFilePath(file.URL)
+	if !ok {
+		return file, false, nil
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		if os.IsNotExist(err) {
+			return file, false, nil
+		}
+		return file, false, err
+	}
+	contentType, detected, err := s.contentType(&file, filePath)
+	if err != nil {
+		return file, false, err
+	}
+	if !s.isImage(contentType) {
+		return file, detected, nil
+	}
+
+	if file.ThumbURL == nil {
+		release, err := s.images.Acquire(ctx)
+		if err != nil {
+			return file, false, err
+		}
+		defer release()
+		processed, err := s.processImageFile(filePath, contentType)
+		if err != nil {
+			return file, false, err
+		}
+		processed.Caption = file.Caption
+		return *processed, true, nil
+	}
+
+	if s.thumbnailUpToDate(file, filePath) {
+		return file, detected, nil
+	}
+
+	release, err := s.images.Acquire(ctx)
+	if err != nil {
+		return file, false, err
+	}
+	defer release()
+
+	img, err := decodeImage(filePath, contentType)
+	if err != nil {
+		return file, false, fmt.Errorf("failed to decode image: %w", err)
+	}
+	thumbURL, err := s.generateThumbnail(filePath, img)
+	if err != nil {
+		return file, false, fmt.Errorf("failed to generate thumbnail: %w", err)
+	}
+	// An image no longer wider than the thumbnails is its own thumbnail
+	if thumbURL == file.URL && *file.ThumbURL != file.URL {
+		s.DeleteFiles([]models.FileInfo{{URL: *file.ThumbURL}})
+	}
+
+	bounds := img.Bounds()
+	width, height := uint32(bounds.Dx()), uint32(bounds.Dy())
+	file.ThumbURL, file.Width, file.Height = &thumbURL, &width, &height
+	return file, true, nil
+}
+
+// thumbnailUpToDate reports whether the thumbnail of an image is the one generateThumbnail would make
+// Only the headers of the images are read.
+func (s *UploadService) thumbnailUpToDate(file models.FileInfo, filePath string) bool {
+	width, ok := imageWidth(filePath)
+	if !ok {
+		return false
+	}
+	if width <= int(s.config.ThumbWidth) {
+		return *file.ThumbURL == file.URL
+	}
+
+	thumbPath, ok := s.resolveFilePath(*file.ThumbURL)
+	if !ok || *file.ThumbURL == file.URL {
+		return false
+	}
+	thumbWidth, ok := imageWidth(thumbPath)
+	return ok && thumbWidth == int(s.config.ThumbWidth)
+}
+
+// ImagePoolStats returns the metrics of the workers processing the images
+func (s *UploadService) ImagePoolStats() models.ImagePoolStats {
+	return s.images.Stats()
+}
+
+// DeleteFiles removes the given files and their thumbnails from disk
+// Files that are not served from the upload directory are ignored
+// It returns the number of bytes reclaimed
+func (s *UploadService) DeleteFiles(files []models.FileInfo) int64 {
+	var reclaimed int64
+
+	for _, file := range files {
+		urls := []string{file.URL}
+		if file.ThumbURL != nil && *file.ThumbURL != file.URL {
+			urls = append(urls, *file.ThumbURL)
+		}
+
+		for _, url := range urls {
+			filePath, ok := s.resolveFilePath(url)
+			if !ok {
+				continue
+			}
+
+			info, err := os.Stat(filePath)
+			if err != nil {
+				if !os.IsNotExist(err) {
+					log.Printf("failed to stat file %s: %v", filePath, err)
+				}
+				continue
+			}
+
+			if err := os.Remove(filePath); err != nil {
+				log.Printf("failed to remove file %s: %v", filePath, err)
+				continue
+			}
+			reclaimed += info.Size()
+		}
+	}
+
+	return reclaimed
+}
+
+// thumbPrefix starts the names of the thumbnails, followed by the names of their originals
+const thumbPrefix = "thumb_"
+
+// strayThumbnailAge is how old a thumbnail without original must be to be deleted, so that an upload whose name
+// starts with thumbPrefix isn't deleted before the post referencing it is saved
+const strayThumbnailAge = 24 * time.Hour
+
+// deleteStrayThumbnails deletes the thumbnails in the upload directory whose original is gone, unless referenced
+// It returns the number of thumbnails deleted and the bytes reclaimed, or the ones that would be if dryRun is true.
+func (s *UploadService) deleteStrayThumbnails(referenced map[string]bool, dryRun bool) (int64, int64, error) {
+	entries, err := os.ReadDir(s.config.BasePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var deleted, reclaimed int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, thumbPrefix) || referenced[s.buildFileURL(name)] {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(s.config.BasePath, strings.TrimPrefix(name, thumbPrefix))); !os.IsNotExist(err) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < strayThumbnailAge {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(filepath.Join(s.config.BasePath, name)); err != nil {
+				log.Printf("failed to remove thumbnail %s: %v", name, err)
+				continue
+			}
+		}
+		deleted++
+		reclaimed += info.Size()
+	}
+	return deleted, reclaimed, nil
+}
+
+// resolveFilePath maps a file URL back to its path in the upload directory
+// It returns false if the URL does not point to a file in the upload directory
+func (s *UploadService) resolveFilePath(url string) (string, bool) {
+	prefix := s.config.BaseURL + "/"
+	if !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+
+	fileName := strings.TrimPrefix(url, prefix)
+	if fileName == "" || fileName != filepath.Base(fileName) || fileName == ".." {
+		return "", false
+	}
+
+	return filepath.Join(s.config.BasePath, fileName), true
+}
+
+// ArchiveDir is the directory of the upload storage holding the snapshots of linked pages
+const ArchiveDir = "archive"
+
+// SaveArchive stores a page snapshot under the hash of its content and returns its URL
+// Snapshots are content-addressed, a snapshot already stored is not written again
+func (s *UploadService) SaveArchive(hash string, data []byte) (string, error) {
+	dir := filepath.Join(s.config.BasePath, ArchiveDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	filePath := filepath.Join(dir, hash+".html")
+	if _, err := os.Stat(filePath); err == nil {
+		return s.ArchiveURL(hash), nil
+	}
+
+	// Write to a temporary file first, so a snapshot is never served half written
+	tmp, err := os.CreateTemp(dir, hash+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to save file: %w", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to save file: %w", err)
+	}
+
+	return s.ArchiveURL(hash), nil
+}
+
+// ArchiveURL returns the URL of the snapshot with the given hash
+func (s *UploadService) ArchiveURL(hash string) string {
+	return s.buildFileURL(ArchiveDir + "/" + hash + ".html")
+}
+
 // buildFileURL constructs the file URL
 func (s *UploadService) buildFileURL(fileName string) string {
 	return s.config.BaseURL + "/" + fileName
 }
 
-// isImage checks if the content type represents an image
+// decodableImages are the formats of the images that can be decoded, and so rotated and thumbnailed
+// Other images, e.g. HEIC, are kept like regular files.
+var decodableImages = []string{"jpeg", "jpg", "png", "webp", "gif"}
+
+// isImage checks if the content type represents an image of the configured formats that can be decoded
 func (s *UploadService) isImage(contentType string) bool {
 	if !strings.HasPrefix(contentType, "image/") {
 		return false
 	}
 
-	format := strings.ToLower(strings.TrimPrefix(contentType, "image/"))
-	return slices.Contains(s.config.ImageFormats, format)
-
+	format := strings.ToLower(strings.TrimPrefix(mediaType(contentType), "image/"))
+	return slices.Contains(s.config.ImageFormats, format) && slices.Contains(decodableImages, format)
 }
 
 // needsExifRotation only applies to JPEG images
@@ -260,6 +508,21 @@ func decodeImage(filePath, contentType string) (image.Image, error) {
 	}
 }
 
+// imageWidth returns the width of an image from its header, or false if it can't be read
+func imageWidth(filePath string) (int, bool) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, false
+	}
+	return config.Width, true
+}
+
 // saveImage saves the image in the appropriate format based on the file extension
 func saveImage(filePath string, img image.Image) error {
 	file, err := os.Create(filePath)
@@ -279,23 +542,6 @@ func saveImage(filePath string, img image.Image) error {
 	}
 }
 
-// detectContentType detects the content type of a file by reading its first 512 bytes
-func detectContentType(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	// Read 512 bytes as per http.DetectContentType documentation
-	buffer := make([]byte, 512)
-	if _, err := file.Read(buffer); err != nil {
-		return "", err
-	}
-
-	return http.DetectContentType(buffer), nil
-}
-
 // generateSecureFilename generates a secure filename with UUID suffix
 // It preserves Chinese characters and common filename characters
 // uuidLength should be between 8 and 32
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidSignature is returned for an upload URL without signature, or with a wrong one
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrSignatureExpired is returned for an upload URL whose signature expired
+	ErrSignatureExpired = errors.New("signature expired")
+)
+
+// signatureLength is the number of bytes of the HMAC kept in a signature
+const signatureLength = 16
+
+// URLSigner signs the URLs of the uploads with an expiry, so that the files can only be fetched through the URLs
+// handed out by the API, and not guessed or kept forever
+// The URLs are signed with an HMAC of their path and expiry, added to their query as "expires" and "sig". They are
+// stored unsigned: the URLs are signed in the responses, and their signatures stripped from the requests.
+// A nil URLSigner leaves the URLs as they are, for deployments serving the uploads publicly.
+type URLSigner struct {
+	key     []byte
+	ttl     time.Duration
+	baseURL string
+	// uploadURL matches the URLs of the uploads in a text, e.g. a JSON response or the content of a post
+	uploadURL *regexp.Regexp
+	// signedURL matches the signed URLs of the uploads, the ampersand possibly escaped for HTML or JSON
+	signedURL *regexp.Regexp
+}
+
+// NewURLSigner creates a signer of the URLs of the uploads under baseURL
+// The signed URLs stay valid for ttl to twice ttl: their expiry is rounded up, so that a file keeps the same URL
+// for a while and is cached by browsers.
+func NewURLSigner(key []byte, ttl time.Duration, baseURL string) *URLSigner {
+	prefix := regexp.QuoteMeta(strings.TrimSuffix(baseURL, "/") + "/")
+	return &URLSigner{
+		key:       key,
+		ttl:       ttl,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		uploadURL: regexp.MustCompile(prefix + `[^\s"'\\<>()?#&]+`),
+		signedURL: regexp.MustCompile(`(` + prefix + `[^\s"'\\<>()?#&]+)\?expires=\d+(?:&amp;|\\u0026|&)sig=[\w-]+`),
+	}
+}
+
+// Sign returns the URL of an upload with a signature expiring after the TTL of the signer
+// Other URLs are returned as they are.
+func (s *URLSigner) Sign(u string) string {
+	if s == nil || !strings.HasPrefix(u, s.baseURL+"/") || strings.ContainsAny(u, "?#") {
+		return u
+	}
+	return s.sign(u, time.Now())
+}
+
+func (s *URLSigner) sign(u string, now time.Time) string {
+	ttl := int64(max(s.ttl/time.Second, 1))
+	expires := (now.Unix()/ttl + 2) * ttl
+	return u + "?expires=" + strconv.FormatInt(expires, 10) + "&sig=" + s.signature(u, expires)
+}
+
+// signature returns the HMAC of the unescaped path of a URL and its expiry
+func (s *URLSigner) signature(u string, expires int64) string {
+	if unescaped, err := url.PathUnescape(u); err == nil {
+		u = unescaped
+	}
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(u + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureLength])
+}
+
+// Verify checks the signature of a request for an upload, with its path and query
+// It returns ErrInvalidSignature or ErrSignatureExpired for a request that must be refused.
+func (s *URLSigner) Verify(path string, query url.Values) error {
+	if s == nil {
+		return nil
+	}
+	return s.verify(path, query, time.Now())
+}
+
+func (s *URLSigner) verify(path string, query url.Values, now time.Time) error {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(s.signature(path, expires))) {
+		return ErrInvalidSignature
+	}
+	if now.Unix() > expires {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+// SignText signs the URLs of the uploads found in a text, the ones already signed are left as they are
+func (s *URLSigner) SignText(text []byte) []byte {
+	if s == nil {
+		return text
+	}
+	now := time.Now()
+	var buf bytes.Buffer
+	last := 0
+	for _, loc := range s.uploadURL.FindAllIndex(text, -1) {
+		// A URL of another site may have the same path, e.g. https://example.com/uploads/
+		if bytes.HasPrefix(text[loc[1]:], []byte("?expires=")) || (loc[0] > 0 && isURLByte(text[loc[0]-1])) {
+			continue
+		}
+		buf.Write(text[last:loc[0]])
+		buf.WriteString(s.sign(string(text[loc[0]:loc[1]]), now))
+		last = loc[1]
+	}
+	if last == 0 {
+		return text
+	}
+	buf.Write(text[last:])
+	return buf.Bytes()
+}
+
+// isURLByte tells whether a byte can be part of a URL before its path, so that the path isn't the start of the URL
+func isURLByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || strings.IndexByte("-._~:/%@", b) >= 0
+}
+
+// StripText removes the signatures of the URLs of the uploads found in a text, e.g. the body of a request sending
+// back the files or the content of a post, so that only unsigned URLs are stored
+func (s *URLSigner) StripText(text []byte) []byte {
+	if s == nil {
+		return text
+	}
+	return s.signedURL.ReplaceAll(text, []byte("$1"))
+}
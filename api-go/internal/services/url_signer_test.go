@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigner() *URLSigner {
+	return NewURLSigner([]byte("0123456789abcdef0123456789abcdef"), time.Hour, "/uploads")
+}
+
+func parseSigned(t *testing.T, u string) (string, url.Values) {
+	t.Helper()
+	parsed, err := url.Parse(u)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", u, err)
+	}
+	return parsed.Path, parsed.Query()
+}
+
+func TestURLSigner(t *testing.T) {
+	s := newTestSigner()
+	now := time.Date(2024, 6, 15, 12, 30, 0, 0, time.UTC)
+
+	signed := s.sign("/uploads/a%20photo.jpg", now)
+	path, query := parseSigned(t, signed)
+	if err := s.verify(path, query, now); err != nil {
+		t.Fatalf("expected %q to be valid, got %v", signed, err)
+	}
+
+	// The expiry is rounded up, so that the URL is the same for a while
+	if again := s.sign("/uploads/a%20photo.jpg", now.Add(10*time.Minute)); again != signed {
+		t.Errorf("expected the same URL within the TTL, got %q and %q", signed, again)
+	}
+
+	if err := s.verify(path, query, now.Add(3*time.Hour)); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("expected the signature to expire, got %v", err)
+	}
+	if err := s.verify("/uploads/other.jpg", query, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected the signature to be for another path, got %v", err)
+	}
+
+	tampered := url.Values{"expires": {"9999999999"}, "sig": {query.Get("sig")}}
+	if err := s.verify(path, tampered, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected a tampered expiry to be refused, got %v", err)
+	}
+	if err := s.verify(path, url.Values{}, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected a URL without signature to be refused, got %v", err)
+	}
+
+	other := NewURLSigner([]byte("fedcba9876543210fedcba9876543210"), time.Hour, "/uploads")
+	if err := other.verify(path, query, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected a signature with another key to be refused, got %v", err)
+	}
+
+	for _, u := range []string{"/static/app.js", "/uploads/a.jpg?v=1", "https://example.com/uploads/a.jpg"} {
+		if got := s.Sign(u); got != u {
+			t.Errorf("expected %q to be left as it is, got %q", u, got)
+		}
+	}
+}
+
+func TestURLSignerText(t *testing.T) {
+	s := newTestSigner()
+
+	text := `{"url":"/uploads/a.jpg","thumb_url":"/uploads/a_thumb.jpg","link":"https://example.com/uploads/b.jpg",` +
+		`"content":"<img src=\"/uploads/c.png\">"}`
+	signed := string(s.SignText([]byte(text)))
+	for _, name := range []string{"a.jpg", "a_thumb.jpg", "c.png"} {
+		if !strings.Contains(signed, "/uploads/"+name+"?expires=") {
+			t.Errorf("expected /uploads/%s to be signed in %s", name, signed)
+		}
+	}
+	if !strings.Contains(signed, `"https://example.com/uploads/b.jpg"`) {
+		t.Errorf("expected the URL of another site to be left as it is in %s", signed)
+	}
+	if again := string(s.SignText([]byte(signed))); again != signed {
+		t.Errorf("expected the signed URLs to be left as they are, got %s", again)
+	}
+
+	if stripped := string(s.StripText([]byte(signed))); stripped != text {
+		t.Errorf("expected the signatures to be removed, got %s", stripped)
+	}
+
+	// The ampersand may be escaped in HTML or JSON
+	for _, sep := range []string{"&amp;", `\u0026`} {
+		escaped := strings.ReplaceAll(signed, "&", sep)
+		if stripped := string(s.StripText([]byte(escaped))); stripped != text {
+			t.Errorf("expected the signatures with %s to be removed, got %s", sep, stripped)
+		}
+	}
+}
+
+func TestNilURLSigner(t *testing.T) {
+	var s *URLSigner
+	text := []byte(`{"url":"/uploads/a.jpg"}`)
+	if got := s.SignText(text); string(got) != string(text) {
+		t.Errorf("expected a nil signer to leave the text as it is, got %s", got)
+	}
+	if got := s.Sign("/uploads/a.jpg"); got != "/uploads/a.jpg" {
+		t.Errorf("expected a nil signer to leave the URL as it is, got %s", got)
+	}
+	if err := s.Verify("/uploads/a.jpg", url.Values{}); err != nil {
+		t.Errorf("expected a nil signer to accept every URL, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// recentViewsKey holds the posts viewed by the owner, scored by the time of their last view
+	recentViewsKey = "views:recent"
+	// recentViewsSize is the number of posts kept in the recently viewed ones
+	recentViewsSize = 100
+	// viewDays is the number of days the views of the posts count for the most viewed ones
+	viewDays = 30
+	// viewHalfLife is the number of days after which a view counts half as much for the most viewed posts
+	viewHalfLife = 7
+)
+
+// ViewService records the views of the posts in Redis, for the recently viewed and the most viewed posts
+// The views are counted by day and kept for 30 days, a view counting half as much every week, so that the most viewed
+// posts follow what is read now. A nil ViewService records nothing.
+type ViewService struct {
+	client *redis.Client
+}
+
+func NewViewService(client *redis.Client) *ViewService {
+	return &ViewService{client: client}
+}
+
+// RecordView records a view of a post at the given time
+// The views of the owner are kept in the recently viewed posts too, the ones of the visitors of the shared posts only
+// count for the most viewed posts.
+func (s *ViewService) RecordView(ctx context.Context, id int64, owner bool, now time.Time) error {
+	if s == nil {
+		return nil
+	}
+	member := strconv.FormatInt(id, 10)
+	dayKey := viewDayKey(now)
+
+	pipe := s.client.Pipeline()
+	pipe.ZIncrBy(ctx, dayKey, 1, member)
+	pipe.ExpireNX(ctx, dayKey, (viewDays+1)*24*time.Hour)
+	if owner {
+		pipe.ZAdd(ctx, recentViewsKey, redis.Z{Score: float64(now.UnixMilli()), Member: member})
+		pipe.ZRemRangeByRank(ctx, recentViewsKey, 0, -recentViewsSize-1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return nil
+}
+
+// RecentlyViewed returns the IDs of the posts the owner viewed last, latest first
+func (s *ViewService) RecentlyViewed(ctx context.Context, limit int) ([]int64, error) {
+	if s == nil {
+		return []int64{}, nil
+	}
+	members, err := s.client.ZRevRange(ctx, recentViewsKey, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseViewMembers(members), nil
+}
+
+// MostViewed returns the IDs of the posts viewed the most in the last 30 days up to the given time, most viewed first
+func (s *ViewService) MostViewed(ctx context.Context, limit int, now time.Time) ([]int64, error) {
+	if s == nil {
+		return []int64{}, nil
+	}
+	keys, weights := viewWeights(now)
+	scores, err := s.client.ZUnionWithScores(ctx, redis.ZStore{Keys: keys, Weights: weights, Aggregate: "SUM"}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(scores, func(a, b redis.Z) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	members := make([]string, 0, min(limit, len(scores)))
+	for _, z := range scores[:min(limit, len(scores))] {
+		members = append(members, z.Member.(string))
+	}
+	return parseViewMembers(members), nil
+}
+
+// viewWeights returns the keys of the views of the last 30 days up to the given time, today first, and the weights
+// of their views
+func viewWeights(now time.Time) ([]string, []float64) {
+	keys := make([]string, viewDays)
+	weights := make([]float64, viewDays)
+	for d := range viewDays {
+		keys[d] = viewDayKey(now.AddDate(0, 0, -d))
+		weights[d] = math.Pow(0.5, float64(d)/viewHalfLife)
+	}
+	return keys, weights
+}
+
+func viewDayKey(day time.Time) string {
+	return "views:day:" + day.UTC().Format(time.DateOnly)
+}
+
+// parseViewMembers returns the IDs of the posts stored as members of the sorted sets, skipping the invalid ones
+func parseViewMembers(members []string) []int64 {
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		if id, err := strconv.ParseInt(member, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestViewWeights(t *testing.T) {
+	now := time.Date(2024, 3, 1, 23, 30, 0, 0, time.FixedZone("", -5*3600))
+	keys, weights := viewWeights(now)
+	if len(keys) != viewDays || len(weights) != viewDays {
+		t.Fatalf("expected %d days, got %d keys and %d weights", viewDays, len(keys), len(weights))
+	}
+	// The days are UTC ones, 23:30 in New York is the next day
+	if keys[0] != "views:day:2024-03-02" || keys[1] != "views:day:2024-03-01" || keys[2] != "views:day:2024-02-29" {
+		t.Errorf("expected the keys of the last days, today first, got %v", keys[:3])
+	}
+	if weights[0] != 1 || math.Abs(weights[viewHalfLife]-0.5) > 1e-9 || math.Abs(weights[2*viewHalfLife]-0.25) > 1e-9 {
+		t.Errorf("expected the weights to halve every %d days, got %v", viewHalfLife, weights)
+	}
+}
+
+func TestParseViewMembers(t *testing.T) {
+	if ids := parseViewMembers([]string{"3", "x", "1"}); !slices.Equal(ids, []int64{3, 1}) {
+		t.Errorf("expected the valid IDs in order, got %v", ids)
+	}
+}
+
+func TestNilViewService(t *testing.T) {
+	var s *ViewService
+	ctx := context.Background()
+	if err := s.RecordView(ctx, 1, true, time.Now()); err != nil {
+		t.Errorf("expected a nil service to record nothing, got %v", err)
+	}
+	if ids, err := s.MostViewed(ctx, 10, time.Now()); err != nil || len(ids) != 0 {
+		t.Errorf("expected no posts from a nil service, got %v, %v", ids, err)
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+)
+
+// WriteQueue serializes writes to a database
+// SQLite allows a single writer at a time, concurrent writers otherwise contend on the database lock
+// and fail with SQLITE_BUSY once the busy timeout expires. Queueing them in-process is fair and keeps
+// bursts such as imports and bulk operations reliable.
+type WriteQueue struct {
+	slot chan struct{}
+
+	depth     atomic.Int64
+	completed atomic.Int64
+	waitTotal atomic.Int64 // nanoseconds
+	waitMax   atomic.Int64 // nanoseconds
+}
+
+func newWriteQueue() *WriteQueue {
+	return &WriteQueue{slot: make(chan struct{}, 1)}
+}
+
+// Acquire waits for the turn of the caller to write, or until ctx is done
+// The returned function must be called once the write is finished
+// A request in a transaction of the database already holds the queue, its writes go on, see BeginRequestTx.
+func (q *WriteQueue) Acquire(ctx context.Context) (func(), error) {
+	if rt := requestTxOf(ctx); rt != nil && rt.db.writes == q {
+		return func() {}, nil
+	}
+
+	q.depth.Add(1)
+	start := time.Now()
+
+	select {
+	case q.slot <- struct{}{}:
+	case <-ctx.Done():
+		q.depth.Add(-1)
+		return nil, ctx.Err()
+	}
+
+	wait := int64(time.Since(start))
+	q.waitTotal.Add(wait)
+	for {
+		current := q.waitMax.Load()
+		if wait <= current || q.waitMax.CompareAndSwap(current, wait) {
+			break
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-q.slot
+			q.depth.Add(-1)
+			q.completed.Add(1)
+		})
+	}, nil
+}
+
+// Stats returns the metrics of the queue
+func (q *WriteQueue) Stats() models.WriteQueueStats {
+	stats := models.WriteQueueStats{
+		Depth:     q.depth.Load(),
+		Completed: q.completed.Load(),
+		WaitMax:   float64(q.waitMax.Load()) / float64(time.Millisecond),
+	}
+	if stats.Completed > 0 {
+		stats.WaitAvg = float64(q.waitTotal.Load()) / float64(stats.Completed) / float64(time.Millisecond)
+	}
+	return stats
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriteQueueSerializesWriters(t *testing.T) {
+	q := &WriteQueue{slot: make(chan struct{}, 1)}
+	ctx := context.Background()
+
+	var active, maxActive atomic.Int64
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := q.Acquire(ctx)
+			if err != nil {
+				t.Errorf("Acquire failed: %v", err)
+				return
+			}
+			defer release()
+
+			n := active.Add(1)
+			if n > maxActive.Load() {
+				maxActive.Store(n)
+			}
+			time.Sleep(time.Millisecond)
+			active.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if maxActive.Load() != 1 {
+		t.Errorf("expected a single writer at a time, got %d", maxActive.Load())
+	}
+
+	stats := q.Stats()
+	if stats.Completed != 10 || stats.Depth != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.WaitMax <= 0 {
+		t.Errorf("expected waits to be recorded, got %+v", stats)
+	}
+}
+
+func TestWriteQueueAcquireCanceled(t *testing.T) {
+	q := &WriteQueue{slot: make(chan struct{}, 1)}
+
+	release, _ := q.Acquire(context.Background())
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := q.Acquire(ctx); err == nil {
+		t.Error("expected Acquire to fail when the context is done")
+	}
+	if q.Stats().Depth != 1 {
+		t.Errorf("expected canceled writer to leave the queue, depth %d", q.Stats().Depth)
+	}
+}
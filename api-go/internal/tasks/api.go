@@ -0,0 +1,266 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	e "github.com/cymoo/mote/internal/errors"
+)
+
+// TaskStatus is the state of a task served by the JSON API
+type TaskStatus struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	// Description is the schedule in plain English, see Describe
+	Description  string         `json:"description"`
+	Enabled      bool           `json:"enabled"`
+	Running      bool           `json:"running"`
+	AddedAt      time.Time      `json:"added_at"`
+	LastRun      *time.Time     `json:"last_run,omitempty"`
+	NextRun      *time.Time     `json:"next_run,omitempty"`
+	RunCount     int64          `json:"run_count"`
+	ErrorCount   int64          `json:"error_count"`
+	LastError    string         `json:"last_error,omitempty"`
+	MaxAttempts  int            `json:"max_attempts"`
+	Retries      int64          `json:"retries"`
+	LastAttempts int            `json:"last_attempts"`
+	Skipped      int64          `json:"skipped"`
+	Durations    DurationStatus `json:"durations"`
+	Labels       []string       `json:"labels,omitempty"`
+	Group        string         `json:"group,omitempty"`
+	TrippedUntil *time.Time     `json:"tripped_until,omitempty"`
+}
+
+// DurationStatus are the statistics of the durations of the runs of a task served by the JSON API, in milliseconds
+type DurationStatus struct {
+	Count  int64   `json:"count"`
+	Min    int64   `json:"min"`
+	Max    int64   `json:"max"`
+	Avg    int64   `json:"avg"`
+	P95    int64   `json:"p95"`
+	Recent []int64 `json:"recent"`
+}
+
+func newDurationStatus(stats DurationStats) DurationStatus {
+	status := DurationStatus{
+		Count:  stats.Count,
+		Min:    stats.Min.Milliseconds(),
+		Max:    stats.Max.Milliseconds(),
+		Avg:    stats.Avg.Milliseconds(),
+		P95:    stats.P95.Milliseconds(),
+		Recent: make([]int64, len(stats.Recent)),
+	}
+	for i, d := range stats.Recent {
+		status.Recent[i] = d.Milliseconds()
+	}
+	return status
+}
+
+func newTaskStatus(task *TaskInfo) TaskStatus {
+	status := TaskStatus{
+		Name:         task.Name,
+		Schedule:     task.Schedule,
+		Description:  Describe(task.Schedule),
+		Enabled:      task.Enabled,
+		Running:      task.Running,
+		AddedAt:      task.AddedAt,
+		RunCount:     task.RunCount,
+		ErrorCount:   task.ErrorCount,
+		LastError:    task.LastError,
+		MaxAttempts:  task.MaxAttempts,
+		Retries:      task.Retries,
+		LastAttempts: task.LastAttempts,
+		Skipped:      task.Skipped,
+		Durations:    newDurationStatus(task.Durations),
+		Labels:       task.Labels,
+		Group:        task.Group,
+	}
+	if !task.LastRun.IsZero() {
+		status.LastRun = &task.LastRun
+	}
+	if !task.NextRun.IsZero() {
+		status.NextRun = &task.NextRun
+	}
+	if !task.TrippedUntil.IsZero() {
+		status.TrippedUntil = &task.TrippedUntil
+	}
+	return status
+}
+
+// APIHandler creates an HTTP handler serving the tasks as JSON, next to the HTML pages of WebHandler
+// The baseURL is the URL prefix the handler is mounted at, e.g. "/api" serves:
+//
+//	GET    /api/tasks                the tasks, by name, with all the labels given as ?label=db&label=maintenance
+//	GET    /api/tasks/labels         the statistics of the tasks by label, see LabelStats
+//	GET    /api/tasks/groups         the statistics of the tasks by group, see GroupStats
+//	GET    /api/tasks/workers        the statistics of the workers running the tasks without a group with a limit,
+//	                                 see WorkerStats
+//	GET    /api/tasks/events         the starts and ends of the runs and the tasks added or removed, as server-sent
+//	                                 events, see TaskEvent
+//	GET    /api/tasks/{name}         a task
+//	GET    /api/tasks/{name}/history the last runs of a task, newest first
+//	POST   /api/tasks/{name}/run     starts a run of a task, 202 once started, with the args of a JSON object body
+//	POST   /api/tasks/{name}/enable  enables a task
+//	POST   /api/tasks/{name}/disable disables a task
+//	DELETE /api/tasks/{name}         removes a task, 204 once removed
+//	POST   /api/tasks/pause          pauses the runs of all tasks, see Manager.Pause, 204 once paused
+//	POST   /api/tasks/resume         resumes the runs of all tasks, 204 once resumed
+//	POST   /api/tasks/groups/{group}/enable   enables the tasks of a group, 204 once enabled
+//	POST   /api/tasks/groups/{group}/disable  disables the tasks of a group, 204 once disabled
+//	POST   /api/tasks/groups/{group}/run      starts a run of each task of a group, 202 once started
+//
+// An unknown task or group is a 404, and running a task that is disabled or already running a 409, as is running a
+// group of which a task can't run, the others being started. The args of a run, see
+// Manager.RunTaskNowWithArgs, that aren't a JSON object are a 400.
+func (m *Manager) APIHandler(baseURL string) *http.ServeMux {
+	baseURL = "/" + strings.Trim(baseURL, "/")
+	if baseURL == "/" {
+		baseURL = ""
+	}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET "+baseURL+"/tasks", func(w http.ResponseWriter, r *http.Request) {
+		tasks := m.ListTasks(r.URL.Query()["label"]...)
+		statuses := make([]TaskStatus, len(tasks))
+		for i, task := range tasks {
+			statuses[i] = newTaskStatus(task)
+		}
+		slices.SortFunc(statuses, func(a, b TaskStatus) int { return strings.Compare(a.Name, b.Name) })
+		sendJSON(w, http.StatusOK, statuses)
+	})
+
+	mux.HandleFunc("GET "+baseURL+"/tasks/labels", func(w http.ResponseWriter, r *http.Request) {
+		sendJSON(w, http.StatusOK, labelStats(m.ListTasks()))
+	})
+
+	mux.HandleFunc("GET "+baseURL+"/tasks/groups", func(w http.ResponseWriter, r *http.Request) {
+		sendJSON(w, http.StatusOK, m.groupStats(m.ListTasks()))
+	})
+
+	mux.HandleFunc("GET "+baseURL+"/tasks/workers", func(w http.ResponseWriter, r *http.Request) {
+		sendJSON(w, http.StatusOK, m.workerStats())
+	})
+
+	mux.HandleFunc("GET "+baseURL+"/tasks/events", m.serveEvents)
+
+	mux.HandleFunc("GET "+baseURL+"/tasks/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if task, ok := m.findTask(w, r); ok {
+			sendJSON(w, http.StatusOK, newTaskStatus(task))
+		}
+	})
+
+	mux.HandleFunc("GET "+baseURL+"/tasks/{name}/history", func(w http.ResponseWriter, r *http.Request) {
+		history, err := m.GetTaskHistory(r.PathValue("name"))
+		if err != nil {
+			e.SendJSONError(w, http.StatusNotFound, "not_found", err.Error())
+			return
+		}
+		sendJSON(w, http.StatusOK, history)
+	})
+
+	mux.HandleFunc("POST "+baseURL+"/tasks/{name}/run", func(w http.ResponseWriter, r *http.Request) {
+		task, ok := m.findTask(w, r)
+		if !ok {
+			return
+		}
+		// A run without body runs with the defaults of the task
+		var args map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&args); err != nil && !errors.Is(err, io.EOF) {
+			e.SendJSONError(w, http.StatusBadRequest, "bad_request", "args must be a JSON object")
+			return
+		}
+		// The task is known, the run is refused because it's disabled or already running
+		if err := m.RunTaskNowWithArgs(task.Name, args); err != nil {
+			e.SendJSONError(w, http.StatusConflict, "conflict", err.Error())
+			return
+		}
+		m.sendTask(w, http.StatusAccepted, task.Name)
+	})
+
+	mux.HandleFunc("POST "+baseURL+"/tasks/{name}/enable", func(w http.ResponseWriter, r *http.Request) {
+		if task, ok := m.findTask(w, r); ok {
+			m.EnableTask(task.Name)
+			m.sendTask(w, http.StatusOK, task.Name)
+		}
+	})
+
+	mux.HandleFunc("POST "+baseURL+"/tasks/{name}/disable", func(w http.ResponseWriter, r *http.Request) {
+		if task, ok := m.findTask(w, r); ok {
+			m.DisableTask(task.Name)
+			m.sendTask(w, http.StatusOK, task.Name)
+		}
+	})
+
+	mux.HandleFunc("DELETE "+baseURL+"/tasks/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if err := m.RemoveTask(r.PathValue("name")); err != nil {
+			e.SendJSONError(w, http.StatusNotFound, "not_found", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST "+baseURL+"/tasks/pause", func(w http.ResponseWriter, r *http.Request) {
+		m.Pause()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST "+baseURL+"/tasks/resume", func(w http.ResponseWriter, r *http.Request) {
+		m.Resume()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST "+baseURL+"/tasks/groups/{group}/enable", m.serveGroup(m.EnableGroup, http.StatusNoContent))
+	mux.HandleFunc("POST "+baseURL+"/tasks/groups/{group}/disable", m.serveGroup(m.DisableGroup, http.StatusNoContent))
+	mux.HandleFunc("POST "+baseURL+"/tasks/groups/{group}/run", m.serveGroup(m.RunGroupNow, http.StatusAccepted))
+
+	return mux
+}
+
+// findTask returns the task named in the path, or sends a 404 if there is none
+func (m *Manager) findTask(w http.ResponseWriter, r *http.Request) (*TaskInfo, bool) {
+	task, err := m.GetTask(r.PathValue("name"))
+	if err != nil {
+		e.SendJSONError(w, http.StatusNotFound, "not_found", err.Error())
+		return nil, false
+	}
+	return task, true
+}
+
+// serveGroup calls fn with the group named in the path and sends the code, a 404 if there is no such group or a 409
+// with the errors of fn
+func (m *Manager) serveGroup(fn func(group string) error, code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group := r.PathValue("group")
+		if len(m.groupTasks(group)) == 0 {
+			e.SendJSONError(w, http.StatusNotFound, "not_found", fmt.Sprintf("group '%s' not found", group))
+			return
+		}
+		if err := fn(group); err != nil {
+			e.SendJSONError(w, http.StatusConflict, "conflict", err.Error())
+			return
+		}
+		w.WriteHeader(code)
+	}
+}
+
+// sendTask sends the state of a task after it changed, a 404 if it was removed meanwhile
+func (m *Manager) sendTask(w http.ResponseWriter, code int, name string) {
+	task, err := m.GetTask(name)
+	if err != nil {
+		e.SendJSONError(w, http.StatusNotFound, "not_found", err.Error())
+		return
+	}
+	sendJSON(w, code, newTaskStatus(task))
+}
+
+func sendJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
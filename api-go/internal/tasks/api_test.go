@@ -0,0 +1,69 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cymoo/mita"
+)
+
+func TestAPIHandler(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	release := make(chan struct{})
+	defer close(release)
+	m.AddTask("sync", mita.Every().Day(), func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	m.AddTask("cleanup", mita.Every().Day(), func(ctx context.Context) error { return nil })
+	handler := m.APIHandler("/api")
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := do("GET", "/api/tasks")
+	var statuses []TaskStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("expected the tasks, got %d %s", rec.Code, rec.Body)
+	}
+	if len(statuses) != 2 || statuses[0].Name != "cleanup" || statuses[1].Name != "sync" || !statuses[1].Enabled {
+		t.Errorf("expected the tasks by name, got %+v", statuses)
+	}
+
+	cases := []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/api/tasks/missing", http.StatusNotFound},
+		{"POST", "/api/tasks/missing/run", http.StatusNotFound},
+		{"GET", "/api/tasks/sync/run", http.StatusMethodNotAllowed},
+		{"POST", "/api/tasks/sync/run", http.StatusAccepted},
+		// The run holds the task until released
+		{"POST", "/api/tasks/sync/run", http.StatusConflict},
+		{"POST", "/api/tasks/cleanup/disable", http.StatusOK},
+		{"POST", "/api/tasks/cleanup/run", http.StatusConflict},
+		{"POST", "/api/tasks/cleanup/enable", http.StatusOK},
+		{"GET", "/api/tasks/cleanup/history", http.StatusOK},
+		{"DELETE", "/api/tasks/cleanup", http.StatusNoContent},
+		{"GET", "/api/tasks/cleanup", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		if rec := do(c.method, c.path); rec.Code != c.code {
+			t.Errorf("%s %s: expected %d, got %d %s", c.method, c.path, c.code, rec.Code, rec.Body)
+		}
+	}
+
+	rec = do("GET", "/api/tasks/sync")
+	var status TaskStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || !status.Running || status.LastRun == nil {
+		t.Errorf("expected the task to be running, got %s", rec.Body)
+	}
+}
@@ -0,0 +1,121 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cymoo/mita"
+	"github.com/cymoo/mote/pkg/util/safego"
+)
+
+// WithCircuitBreaker disables the task for cooldown once failureThreshold runs in a row failed, e.g. for a task
+// calling a service that is down, instead of failing every minute until someone looks at it
+// The OnTripped hooks are called with the error of the last run, see Hooks. Once the cooldown is over the task is
+// enabled again, and a run failing then disables it again at once, a successful run resets the count. A task that
+// tripped stays disabled across a restart until the end of its cooldown if the state of the tasks is kept, see
+// Persist. A task enabled or disabled by hand during its cooldown is left as it is.
+func WithCircuitBreaker(failureThreshold int, cooldown time.Duration) TaskOption {
+	return func(o *taskOptions) {
+		o.failureThreshold = max(failureThreshold, 0)
+		o.cooldown = max(cooldown, 0)
+	}
+}
+
+// withBreaker counts the failed runs of the task in a row, and disables it for its cooldown once they reach its
+// threshold, see WithCircuitBreaker
+func (m *Manager) withBreaker(name string, stats *taskStats, task mita.Task) mita.Task {
+	return func(ctx context.Context) error {
+		err := task(ctx)
+		if ctx.Err() != nil {
+			return err
+		}
+
+		m.mu.Lock()
+		if err == nil {
+			stats.failures = 0
+			m.mu.Unlock()
+			return nil
+		}
+		stats.failures++
+		tripped := stats.failures >= stats.options.failureThreshold
+		if tripped {
+			stats.trips++
+			stats.trippedUntil = m.clock.Now().Add(stats.options.cooldown)
+		}
+		trips, failures, until := stats.trips, stats.failures, stats.trippedUntil
+		m.mu.Unlock()
+
+		if tripped {
+			m.trip(name, GetRunID(ctx), stats, trips, failures, until, err)
+		}
+		return err
+	}
+}
+
+// trip disables a task whose circuit breaker tripped, and enables it again after the cooldown, see
+// enableAfterCooldown
+func (m *Manager) trip(name, runID string, stats *taskStats, trips int64, failures int, until time.Time, err error) {
+	if err := m.TaskManager.DisableTask(name); err != nil {
+		m.logger.Error("error disabling a task", "task", name, "run_id", runID, "error", err)
+		return
+	}
+	m.tellStateChanged()
+	m.logger.Warn("task failed too many times in a row, disabling it", "task", name, "run_id", runID,
+		"failures", failures, "until", until, "error", err)
+	m.callHooks(name, runID, stats, stageTripped, fmt.Errorf("failed %d times in a row: %w", failures, err))
+	m.enableAfterCooldown(name, trips, until)
+}
+
+// enableAfterCooldown enables a task disabled by its circuit breaker once its cooldown is over, unless it tripped
+// again, was enabled or disabled by hand, or was removed in the meantime
+func (m *Manager) enableAfterCooldown(name string, trips int64, until time.Time) {
+	safego.Go("enable-tripped-task", func() {
+		select {
+		case <-m.clock.After(until.Sub(m.clock.Now())):
+		case <-m.stopped:
+			return
+		}
+
+		// The task may have been rescheduled, with new stats
+		m.mu.Lock()
+		stats, current := m.stats[name]
+		current = current && stats.trips == trips && stats.trippedUntil.Equal(until)
+		if current {
+			stats.trippedUntil = time.Time{}
+		}
+		m.mu.Unlock()
+		if !current {
+			return
+		}
+		if err := m.TaskManager.EnableTask(name); err != nil {
+			m.logger.Error("error enabling a task after its cooldown", "task", name, "error", err)
+			return
+		}
+		m.tellStateChanged()
+		m.logger.Info("task enabled after its cooldown", "task", name)
+	})
+}
+
+// restoreTrip disables again a task whose circuit breaker tripped before the restart, until the end of its cooldown
+// A task whose cooldown is already over is left enabled.
+func (m *Manager) restoreTrip(name string, until time.Time) error {
+	if !until.After(m.clock.Now()) {
+		return nil
+	}
+	m.mu.Lock()
+	stats, ok := m.stats[name]
+	if !ok {
+		m.mu.Unlock()
+		return nil
+	}
+	stats.trippedUntil = until
+	trips := stats.trips
+	m.mu.Unlock()
+
+	if err := m.TaskManager.DisableTask(name); err != nil {
+		return err
+	}
+	m.enableAfterCooldown(name, trips, until)
+	return nil
+}
@@ -0,0 +1,138 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+	"github.com/cymoo/mote/internal/models"
+)
+
+func TestWithCircuitBreaker(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 6, 15, 9, 30, 0, 0, time.Local))
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	var fail atomic.Bool
+	fail.Store(true)
+	var trips atomic.Int32
+	m.AddTask("sync", mita.Every().Minute(), func(ctx context.Context) error {
+		if fail.Load() {
+			return errors.New("service down")
+		}
+		return nil
+	}, WithCircuitBreaker(3, time.Hour), WithHooks(Hooks{OnTripped: func(name, runID string, err error) {
+		trips.Add(1)
+	}}))
+
+	fire := func() *TaskInfo {
+		t.Helper()
+		if _, err := m.FireNext("sync"); err != nil {
+			t.Fatalf("FireNext failed: %v", err)
+		}
+		return waitIdle(t, m, "sync")
+	}
+
+	// A success resets the count
+	fire()
+	fire()
+	fail.Store(false)
+	fire()
+	fail.Store(true)
+	fire()
+	if info := fire(); !info.Enabled || trips.Load() != 0 {
+		t.Fatalf("expected the task to stay enabled after 2 failures in a row, got enabled %v and %d trips",
+			info.Enabled, trips.Load())
+	}
+
+	info := fire()
+	if info.Enabled || trips.Load() != 1 {
+		t.Fatalf("expected the third failure in a row to disable the task, got enabled %v and %d trips",
+			info.Enabled, trips.Load())
+	}
+	if want := clock.Now().Add(time.Hour); !info.TrippedUntil.Equal(want) {
+		t.Errorf("expected the task to be disabled until %v, got %v", want, info.TrippedUntil)
+	}
+
+	// The task is enabled again after the cooldown, and disabled again by the next failure
+	if err := clock.BlockUntil(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	deadline := time.Now().Add(time.Second)
+	for info, _ = m.GetTask("sync"); !info.Enabled && time.Now().Before(deadline); info, _ = m.GetTask("sync") {
+		time.Sleep(time.Millisecond)
+	}
+	if !info.Enabled || !info.TrippedUntil.IsZero() {
+		t.Fatalf("expected the task to be enabled after the cooldown, got %+v", info)
+	}
+	if info := fire(); info.Enabled || trips.Load() != 2 {
+		t.Errorf("expected a failure after the cooldown to disable the task, got enabled %v and %d trips",
+			info.Enabled, trips.Load())
+	}
+}
+
+func TestCircuitBreakerCooldown(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 6, 15, 9, 30, 0, 0, time.Local))
+	store := &memoryStore{states: map[string]models.TaskState{}}
+	failing := func(ctx context.Context) error { return errors.New("service down") }
+	newManager := func() *Manager {
+		t.Helper()
+		m := NewManager().WithClock(clock)
+		m.AddTask("sync", mita.Every().Minute(), failing, WithCircuitBreaker(1, time.Hour))
+		m.AddTask("fetch", mita.Every().Minute(), failing, WithCircuitBreaker(1, time.Hour))
+		if err := m.Persist(context.Background(), store, time.Hour); err != nil {
+			t.Fatalf("Persist failed: %v", err)
+		}
+		return m
+	}
+	waitEnabled := func(m *Manager, name string) *TaskInfo {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		info, _ := m.GetTask(name)
+		for ; !info.Enabled && time.Now().Before(deadline); info, _ = m.GetTask(name) {
+			time.Sleep(time.Millisecond)
+		}
+		return info
+	}
+
+	m := newManager()
+	for _, name := range []string{"sync", "fetch"} {
+		if _, err := m.FireNext(name); err != nil {
+			t.Fatalf("FireNext failed: %v", err)
+		}
+		waitIdle(t, m, name)
+	}
+	info, _ := m.GetTask("sync")
+	until := info.TrippedUntil
+	m.Stop()
+	if state := store.states["sync"]; state.Enabled || state.TrippedUntil.Int64 != until.UnixMilli() {
+		t.Fatalf("expected the end of the cooldown to be saved, got %+v", state)
+	}
+
+	// After a restart during the cooldown, the tasks are disabled until its end
+	m = newManager()
+	defer m.Stop()
+	if info, _ := m.GetTask("sync"); info.Enabled || !info.TrippedUntil.Equal(until) {
+		t.Fatalf("expected the task to be disabled until the end of its cooldown, got %+v", info)
+	}
+	// A task disabled by hand in the meantime stays disabled
+	if err := m.DisableTask("fetch"); err != nil {
+		t.Fatalf("DisableTask failed: %v", err)
+	}
+
+	if err := clock.BlockUntil(2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	if info := waitEnabled(m, "sync"); !info.Enabled || !info.TrippedUntil.IsZero() {
+		t.Errorf("expected the task to be enabled after the cooldown, got %+v", info)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if info, _ := m.GetTask("fetch"); info.Enabled {
+		t.Error("expected the task disabled by hand to stay disabled after the cooldown")
+	}
+}
@@ -0,0 +1,233 @@
+package tasks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mita"
+	"github.com/robfig/cron/v3"
+)
+
+// ScheduleBuilder builds schedules like mita.ScheduleBuilder, with several weekdays or days of the month, the last
+// day of the month, and windows of hours, e.g. Every().Hours(1).Between(9, 17).OnWeekdays(time.Monday, time.Friday)
+// The methods taking values out of range panic like the ones of mita.
+type ScheduleBuilder struct {
+	second  string
+	minute  string
+	hour    string
+	day     string
+	month   string
+	weekday string
+	// window is the first and last hour of the runs, see Between
+	window *[2]int
+	// lastDay runs the schedule on the last day of the month only, see LastDayOfMonth
+	lastDay bool
+}
+
+// Every creates a new ScheduleBuilder with default values (runs every minute), like mita.Every
+func Every() *ScheduleBuilder {
+	return &ScheduleBuilder{second: "0", minute: "*", hour: "*", day: "*", month: "*", weekday: "*"}
+}
+
+// String returns the cron expression of the schedule, with seconds
+// The day of the month is L for the last day of the month, which only the Manager can run.
+func (s *ScheduleBuilder) String() string {
+	day := s.day
+	if s.lastDay {
+		day = "L"
+	}
+	return fmt.Sprintf("%s %s %s %s %s %s", s.second, s.minute, s.windowHour(), day, s.month, s.weekday)
+}
+
+// windowHour returns the hour field, limited to the window of hours if any
+func (s *ScheduleBuilder) windowHour() string {
+	if s.window == nil {
+		return s.hour
+	}
+	span := fmt.Sprintf("%d-%d", s.window[0], s.window[1])
+	switch {
+	case s.hour == "*":
+		return span
+	case strings.HasPrefix(s.hour, "*/"):
+		return span + strings.TrimPrefix(s.hour, "*")
+	}
+	// A time of day set with At isn't limited
+	return s.hour
+}
+
+// Second configures the schedule to run every second
+func (s *ScheduleBuilder) Second() *ScheduleBuilder {
+	s.second, s.minute, s.hour = "*", "*", "*"
+	return s
+}
+
+// Minute configures the schedule to run every minute (at 0 seconds)
+func (s *ScheduleBuilder) Minute() *ScheduleBuilder {
+	s.second, s.minute, s.hour = "0", "*", "*"
+	return s
+}
+
+// Hour configures the schedule to run every hour (at 0 minutes, 0 seconds)
+func (s *ScheduleBuilder) Hour() *ScheduleBuilder {
+	s.second, s.minute, s.hour = "0", "0", "*"
+	return s
+}
+
+// Day configures the schedule to run every day (at midnight)
+func (s *ScheduleBuilder) Day() *ScheduleBuilder {
+	s.second, s.minute, s.hour, s.day = "0", "0", "0", "*"
+	s.lastDay = false
+	return s
+}
+
+// Seconds configures the schedule to run every interval seconds
+func (s *ScheduleBuilder) Seconds(interval int) *ScheduleBuilder {
+	mustBePositive(interval)
+	s.second, s.minute, s.hour = "*/"+strconv.Itoa(interval), "*", "*"
+	return s
+}
+
+// Minutes configures the schedule to run every interval minutes
+func (s *ScheduleBuilder) Minutes(interval int) *ScheduleBuilder {
+	mustBePositive(interval)
+	s.second, s.minute, s.hour = "0", "*/"+strconv.Itoa(interval), "*"
+	return s
+}
+
+// Hours configures the schedule to run every interval hours
+func (s *ScheduleBuilder) Hours(interval int) *ScheduleBuilder {
+	mustBePositive(interval)
+	s.second, s.minute, s.hour = "0", "0", "*/"+strconv.Itoa(interval)
+	return s
+}
+
+// Days configures the schedule to run every interval days at midnight
+func (s *ScheduleBuilder) Days(interval int) *ScheduleBuilder {
+	mustBePositive(interval)
+	s.second, s.minute, s.hour, s.day = "0", "0", "0", "*/"+strconv.Itoa(interval)
+	s.lastDay = false
+	return s
+}
+
+// At specifies a specific time of day for the schedule, e.g. At(14, 30) runs at 2:30 PM
+func (s *ScheduleBuilder) At(hour, minute int) *ScheduleBuilder {
+	if hour < 0 || hour > 23 {
+		panic("hour must be between 0 and 23")
+	}
+	if minute < 0 || minute > 59 {
+		panic("minute must be between 0 and 59")
+	}
+	s.second, s.minute, s.hour = "0", strconv.Itoa(minute), strconv.Itoa(hour)
+	return s
+}
+
+// Between limits the runs to the hours from first to last, both included, e.g. Between(9, 17).Hours(1) runs every
+// hour from 9:00 to 17:00. A time of day set with At isn't limited.
+func (s *ScheduleBuilder) Between(first, last int) *ScheduleBuilder {
+	if first < 0 || last > 23 || first > last {
+		panic("hours must be between 0 and 23, the first one before the last one")
+	}
+	s.window = &[2]int{first, last}
+	return s
+}
+
+// OnWeekday restricts the schedule to a specific day of the week
+func (s *ScheduleBuilder) OnWeekday(weekday time.Weekday) *ScheduleBuilder {
+	return s.OnWeekdays(weekday)
+}
+
+// OnWeekdays restricts the schedule to the days of the week, e.g. OnWeekdays(time.Monday, time.Wednesday, time.Friday)
+func (s *ScheduleBuilder) OnWeekdays(weekdays ...time.Weekday) *ScheduleBuilder {
+	if len(weekdays) == 0 {
+		panic("at least one weekday is required")
+	}
+	values := make([]string, len(weekdays))
+	for i, weekday := range weekdays {
+		if weekday < time.Sunday || weekday > time.Saturday {
+			panic("weekday must be between Sunday and Saturday")
+		}
+		values[i] = strconv.Itoa(int(weekday))
+	}
+	s.weekday = strings.Join(values, ",")
+	return s
+}
+
+// OnDay restricts the schedule to a specific day of the month
+func (s *ScheduleBuilder) OnDay(day int) *ScheduleBuilder {
+	return s.OnDays(day)
+}
+
+// OnDays restricts the schedule to the days of the month, e.g. OnDays(1, 15)
+// A month without one of the days, e.g. the 31st, skips it, see LastDayOfMonth.
+func (s *ScheduleBuilder) OnDays(days ...int) *ScheduleBuilder {
+	if len(days) == 0 {
+		panic("at least one day is required")
+	}
+	values := make([]string, len(days))
+	for i, day := range days {
+		if day < 1 || day > 31 {
+			panic("day must be between 1 and 31")
+		}
+		values[i] = strconv.Itoa(day)
+	}
+	s.day = strings.Join(values, ",")
+	s.lastDay = false
+	return s
+}
+
+// LastDayOfMonth restricts the schedule to the last day of the month, whatever its length, and if it is one of the
+// weekdays of the schedule. mita can't tell the last day of the month, the Manager starts the runs itself like
+// those of an Interval.
+func (s *ScheduleBuilder) LastDayOfMonth() *ScheduleBuilder {
+	s.day, s.lastDay = "*", true
+	return s
+}
+
+// schedule returns the schedule the Manager runs, a cron expression unless it runs on the last day of the month
+func (s *ScheduleBuilder) schedule() (mita.Schedule, error) {
+	if !s.lastDay {
+		return mita.Cron(s.String()), nil
+	}
+	// The last day of a month is one of 28 to 31, cron runs on either the days of the month or the weekdays if both
+	// are set
+	days := "28-31"
+	if s.weekday != "*" {
+		days = "*"
+	}
+	expr := fmt.Sprintf("%s %s %s %s %s %s", s.second, s.minute, s.windowHour(), days, s.month, s.weekday)
+	schedule, err := scheduleParser.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &lastDaySchedule{expr: s.String(), days: schedule}, nil
+}
+
+func mustBePositive(interval int) {
+	if interval <= 0 {
+		panic("interval must be positive")
+	}
+}
+
+// lastDaySchedule runs on the ticks of a schedule falling on the last day of the month
+type lastDaySchedule struct {
+	expr string
+	// days is the schedule on the days a month can end on
+	days cron.Schedule
+}
+
+func (s *lastDaySchedule) String() string {
+	return s.expr
+}
+
+func (s *lastDaySchedule) Next(from time.Time) time.Time {
+	// Like cron, it gives up after five years
+	limit := from.AddDate(5, 0, 0)
+	for next := s.days.Next(from); !next.IsZero() && next.Before(limit); next = s.days.Next(next) {
+		if next.AddDate(0, 0, 1).Day() == 1 {
+			return next
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduleBuilder(t *testing.T) {
+	tests := []struct {
+		schedule *ScheduleBuilder
+		want     string
+	}{
+		{Every().Day().At(2, 30), "0 30 2 * * *"},
+		{Every().Day().At(9, 0).OnWeekdays(time.Monday, time.Wednesday, time.Friday), "0 0 9 * * 1,3,5"},
+		{Every().Day().At(3, 0).OnDays(1, 15), "0 0 3 1,15 * *"},
+		{Every().Hours(1).Between(9, 17), "0 0 9-17/1 * * *"},
+		{Every().Between(9, 17).Minutes(30).OnWeekdays(time.Monday, time.Tuesday), "0 */30 9-17 * * 1,2"},
+		{Every().Between(9, 17).At(20, 0), "0 0 20 * * *"},
+		{Every().Day().At(23, 0).LastDayOfMonth(), "0 0 23 L * *"},
+	}
+	for _, tt := range tests {
+		if got := tt.schedule.String(); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+
+	if got := Describe(Every().Day().At(23, 0).LastDayOfMonth().String()); got != "at 23:00 on the last day of the month" {
+		t.Errorf("unexpected description %q", got)
+	}
+
+	for _, build := range []func(){
+		func() { Every().Between(17, 9) },
+		func() { Every().OnDays(32) },
+		func() { Every().OnWeekdays() },
+		func() { Every().Hours(0) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			build()
+		}()
+	}
+}
+
+func TestLastDayOfMonth(t *testing.T) {
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	var calls atomic.Int32
+	if err := m.AddTask("close-month", Every().Day().At(23, 0).LastDayOfMonth(), func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	runs, err := m.GetNextRuns("close-month", 3)
+	want := []time.Time{
+		time.Date(2024, 1, 31, 23, 0, 0, 0, time.UTC),
+		time.Date(2024, 2, 29, 23, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC),
+	}
+	if err != nil || !slices.EqualFunc(runs, want, time.Time.Equal) {
+		t.Errorf("expected the last days of the months, got %v: %v", runs, err)
+	}
+
+	// The Manager starts the runs itself
+	m.Start()
+	if err := clock.BlockUntil(1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	tick, err := m.FireNext("close-month")
+	if err != nil || !tick.Equal(want[0]) {
+		t.Fatalf("expected a tick on January 31, got %v: %v", tick, err)
+	}
+	waitNextRun(t, m, "close-month", want[1])
+	info := waitIdle(t, m, "close-month")
+	if calls.Load() != 1 || info.Schedule != "0 0 23 L * *" {
+		t.Errorf("expected one run, got %d with the schedule %q", calls.Load(), info.Schedule)
+	}
+	if history, _ := m.GetTaskHistory("close-month"); len(history) != 1 || history[0].Trigger != TriggerSchedule {
+		t.Errorf("expected a scheduled run, got %+v", history)
+	}
+
+	// Only the last day of a month on one of the weekdays, e.g. a Friday
+	m.AddTask("friday", Every().Day().At(18, 0).OnWeekday(time.Friday).LastDayOfMonth(), func(ctx context.Context) error { return nil })
+	if runs, _ := m.GetNextRuns("friday", 1); len(runs) != 1 || !runs[0].Equal(time.Date(2024, 5, 31, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected May 31, a Friday, got %v", runs)
+	}
+}
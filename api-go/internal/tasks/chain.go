@@ -0,0 +1,80 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cymoo/mita"
+)
+
+// TriggerUpstream marks a run started by the success of the task it runs after
+const TriggerUpstream = "upstream"
+
+// afterSchedule is the schedule given to mita for a task that only runs after another one or on an interval, Feb 30 never comes
+var afterSchedule = mita.Cron("0 0 0 30 2 *")
+
+// After runs the task each time the given task succeeds, e.g. export, then compress, then upload
+// A failed run of the upstream task skips the task and the tasks after it. The upstream task must be added first,
+// which keeps the chains free of cycles. Added with a nil schedule, the task only runs after the upstream one or manually.
+func After(upstream string) TaskOption {
+	return func(o *taskOptions) {
+		o.after = upstream
+	}
+}
+
+// withDependents starts the tasks after the task when a run succeeds, and skips them when it fails
+func (m *Manager) withDependents(name string, task mita.Task) mita.Task {
+	return func(ctx context.Context) error {
+		err := task(ctx)
+		if err != nil {
+			m.skipDependents(name, fmt.Errorf("skipped, '%s' failed", name))
+			return err
+		}
+
+		m.mu.RLock()
+		dependents := m.dependents[name]
+		m.mu.RUnlock()
+
+		for _, dependent := range dependents {
+			m.mu.Lock()
+			stats, ok := m.stats[dependent]
+			if ok {
+				stats.upstreamRuns++
+			}
+			m.mu.Unlock()
+			if !ok {
+				continue
+			}
+
+			if err := m.TaskManager.RunTaskNow(dependent); err != nil {
+				m.mu.Lock()
+				stats.upstreamRuns--
+				m.mu.Unlock()
+				m.logger.Error("error starting a dependent task", "task", dependent, "upstream", name,
+					"upstream_run_id", GetRunID(ctx), "error", err)
+			}
+		}
+		return nil
+	}
+}
+
+// skipDependents adds a skipped run to the history of the tasks after the task, recursively
+func (m *Manager) skipDependents(name string, reason error) {
+	m.mu.RLock()
+	dependents := m.dependents[name]
+	m.mu.RUnlock()
+
+	now := m.clock.Now()
+	for _, dependent := range dependents {
+		m.mu.RLock()
+		stats, ok := m.stats[dependent]
+		m.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		id := newRunID()
+		stats.history.Push(TaskRun{ID: id, Start: now, End: now, Trigger: TriggerUpstream, Error: reason.Error()})
+		m.callHooks(dependent, id, stats, stageSkipped, reason)
+		m.skipDependents(dependent, reason)
+	}
+}
@@ -0,0 +1,164 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the Manager and waits for it, a FakeClock drives the Manager in tests
+// mita fires the schedules on the real clock, see FireNext to fire them on a FakeClock.
+type Clock interface {
+	Now() time.Time
+	// After sends the time on the returned channel once d has elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the clock of the system
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// WithClock makes the Manager tell the time with the given clock, it must be called before adding tasks
+// The clock tells the trigger and the duration of runs, and times the waits between attempts, the jitter and
+// the renewals of the locks.
+func (m *Manager) WithClock(clock Clock) *Manager {
+	m.clock = clock
+	return m
+}
+
+// FakeClock is a Clock that only moves when told to, for tests
+// Waits end once the clock is advanced past them, tests can wait for them to begin with BlockUntil.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	// changed is closed and replaced each time a wait begins
+	changed chan struct{}
+}
+
+type fakeWaiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+// NewFakeClock returns a FakeClock telling the given time
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, changed: make(chan struct{})}
+}
+
+// Now returns the time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After sends the time on the returned channel once the clock is advanced by d, right away if d is not positive
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{until: c.now.Add(d), ch: ch})
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return ch
+}
+
+// Advance moves the clock forward by d, ending the waits that are over, earliest first
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setLocked(c.now.Add(d))
+}
+
+// Set moves the clock to the given time, which can't be before the time of the clock
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.Before(c.now) {
+		panic("a fake clock can't go back in time")
+	}
+	c.setLocked(t)
+}
+
+func (c *FakeClock) setLocked(t time.Time) {
+	c.now = t
+	sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].until.Before(c.waiters[j].until) })
+	kept := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.until.After(t) {
+			kept = append(kept, w)
+			continue
+		}
+		w.ch <- t
+	}
+	c.waiters = kept
+}
+
+// BlockUntil waits until n waits are pending on the clock, or fails after timeout of real time
+// A test calls it before advancing the clock, so that the Manager has begun the wait it advances past.
+func (c *FakeClock) BlockUntil(n int, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		pending, changed := len(c.waiters), c.changed
+		c.mu.Unlock()
+		if pending >= n {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return fmt.Errorf("%d waits pending after %v, expected %d", pending, timeout, n)
+		}
+	}
+}
+
+// errNoFakeClock is returned by FireNext on a Manager telling the real time
+var errNoFakeClock = errors.New("the manager has no fake clock")
+
+// FireNext moves the fake clock of the Manager to the next tick of the schedule of a task, and starts the run
+// of that tick like mita would, so that tests drive schedules without waiting for them. It returns the tick.
+func (m *Manager) FireNext(name string) (time.Time, error) {
+	clock, ok := m.clock.(*FakeClock)
+	if !ok {
+		return time.Time{}, errNoFakeClock
+	}
+
+	m.mu.RLock()
+	stats, ok := m.stats[name]
+	m.mu.RUnlock()
+	if !ok {
+		return time.Time{}, fmt.Errorf("task '%s' not found", name)
+	}
+	// The Manager starts the run of a timed schedule itself once the clock reaches the tick
+	if stats.timed != nil {
+		m.mu.RLock()
+		next := stats.nextRun
+		m.mu.RUnlock()
+		if next.IsZero() {
+			return time.Time{}, fmt.Errorf("task '%s' has no next run, the manager isn't started", name)
+		}
+		clock.Set(next)
+		return next, nil
+	}
+	if stats.schedule == nil {
+		return time.Time{}, fmt.Errorf("task '%s' has no schedule", name)
+	}
+
+	next := stats.schedule.Next(clock.Now())
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("task '%s' has no next run", name)
+	}
+	clock.Set(next)
+	return next, m.TaskManager.RunTaskNow(name)
+}
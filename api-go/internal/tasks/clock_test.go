@@ -0,0 +1,95 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	later := clock.After(time.Hour)
+	sooner := clock.After(time.Minute)
+	if ch := clock.After(0); len(ch) != 1 {
+		t.Error("expected a wait of 0 to end right away")
+	}
+	if err := clock.BlockUntil(2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(30 * time.Minute)
+	select {
+	case now := <-sooner:
+		if !now.Equal(start.Add(30 * time.Minute)) {
+			t.Errorf("expected the time of the clock, got %v", now)
+		}
+	default:
+		t.Error("expected the wait of a minute to be over")
+	}
+	select {
+	case <-later:
+		t.Error("expected the wait of an hour to go on")
+	default:
+	}
+
+	clock.Set(start.Add(time.Hour))
+	if len(later) != 1 {
+		t.Error("expected the wait of an hour to be over")
+	}
+	if err := clock.BlockUntil(1, 10*time.Millisecond); err == nil {
+		t.Error("expected no pending waits")
+	}
+}
+
+func TestManagerWithFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local))
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	// Waits of hours between attempts are driven by the clock
+	var calls atomic.Int32
+	flaky := func(ctx context.Context) error {
+		if calls.Add(1) < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	}
+	m.AddTask("flaky", mita.Every().Day().At(2, 0), flaky, WithRetry(3, time.Hour))
+
+	tick, err := m.FireNext("flaky")
+	if err != nil {
+		t.Fatalf("FireNext failed: %v", err)
+	}
+	if !tick.Equal(time.Date(2024, 6, 16, 2, 0, 0, 0, time.Local)) {
+		t.Errorf("expected the next tick at 2:00, got %v", tick)
+	}
+	for _, wait := range []time.Duration{time.Hour, 2 * time.Hour} {
+		if err := clock.BlockUntil(1, 2*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(wait)
+	}
+	waitIdle(t, m, "flaky")
+
+	history, _ := m.GetTaskHistory("flaky")
+	if len(history) != 1 {
+		t.Fatalf("expected one run, got %+v", history)
+	}
+	run := history[0]
+	if run.Trigger != TriggerSchedule || run.Attempts != 3 || run.Error != "" {
+		t.Errorf("expected a scheduled run succeeding on the third attempt, got %+v", run)
+	}
+	if !run.Start.Equal(tick) || run.Duration != (3*time.Hour).Milliseconds() {
+		t.Errorf("expected a run of 3 hours from the tick, got %+v", run)
+	}
+
+	if _, err := NewManager().FireNext("flaky"); !errors.Is(err, errNoFakeClock) {
+		t.Errorf("expected errNoFakeClock, got %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+package tasks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+// WithStandardCron reads the expressions of mita.Cron as five fields, like crontab, instead of telling the format
+// by the number of fields. The schedules built with mita.Every always have seconds.
+func (m *Manager) WithStandardCron() *Manager {
+	m.standardCron = true
+	return m
+}
+
+// cronFormat describes a format of cron expressions in the errors
+type cronFormat struct {
+	name   string
+	fields int
+	layout string
+}
+
+var (
+	secondsFormat  = cronFormat{"seconds", 6, "second minute hour day month weekday"}
+	standardFormat = cronFormat{"standard", 5, "minute hour day month weekday"}
+)
+
+// cronField is a field of a cron expression with seconds, and the values it takes
+type cronField struct {
+	name     string
+	min, max int
+	// names are the names of the values, e.g. JAN or MON, in upper case
+	names []string
+}
+
+var cronFields = []cronField{
+	{name: "second", min: 0, max: 59},
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{name: "weekday", min: 0, max: 6, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+}
+
+// ValidateCron checks a cron expression of five fields, six with seconds, or a descriptor like @daily
+// The error tells the field that is invalid and the format that was assumed, e.g.
+// "minute field '61' out of range (0-59)".
+func ValidateCron(expr string) error {
+	_, err := normalizeCron(expr, false)
+	return err
+}
+
+// normalizeSchedule returns the schedule mita runs for the cron expression of a schedule, with seconds
+// An expression of five fields runs on the first second of its minutes. Without WithStandardCron, an expression of
+// six fields has seconds, other expressions are refused. The other schedules are returned as they are.
+func (m *Manager) normalizeSchedule(schedule mita.Schedule) (mita.Schedule, error) {
+	switch s := schedule.(type) {
+	case *jitterSchedule:
+		inner, err := m.normalizeSchedule(s.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		return &jitterSchedule{Schedule: inner, maxDelay: s.maxDelay}, nil
+	case *mita.CronSchedule:
+		if s == afterSchedule {
+			return schedule, nil
+		}
+	case *ScheduleBuilder:
+		return s.schedule()
+	default:
+		return schedule, nil
+	}
+
+	expr, err := normalizeCron(schedule.String(), m.standardCron)
+	if err != nil {
+		return nil, err
+	}
+	return mita.Cron(expr), nil
+}
+
+// normalizeCron checks a cron expression and returns it with seconds, see normalizeSchedule
+func normalizeCron(expr string, standard bool) (string, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@") {
+		if _, err := scheduleParser.Parse(expr); err != nil {
+			return "", fmt.Errorf("invalid cron descriptor %q: %w", expr, err)
+		}
+		return expr, nil
+	}
+
+	fields := strings.Fields(expr)
+	format := standardFormat
+	if !standard && len(fields) == secondsFormat.fields {
+		format = secondsFormat
+	}
+	if len(fields) != format.fields {
+		if standard {
+			return "", fmt.Errorf("cron expression %q has %d fields, the standard format (%s) was assumed",
+				expr, len(fields), format.layout)
+		}
+		return "", fmt.Errorf("cron expression %q has %d fields, expected 5 (%s) or 6 (%s)",
+			expr, len(fields), standardFormat.layout, secondsFormat.layout)
+	}
+
+	if format == standardFormat {
+		fields = append([]string{"0"}, fields...)
+	}
+	for i, field := range cronFields {
+		if err := field.check(fields[i]); err != nil {
+			return "", fmt.Errorf("invalid cron expression %q, the %s format (%s) was assumed: %w",
+				expr, format.name, format.layout, err)
+		}
+	}
+	normalized := strings.Join(fields, " ")
+	// The checks above should catch what the parser refuses, it has the last word
+	if _, err := scheduleParser.Parse(normalized); err != nil {
+		return "", fmt.Errorf("invalid cron expression %q, the %s format (%s) was assumed: %w",
+			expr, format.name, format.layout, err)
+	}
+	return normalized, nil
+}
+
+// check checks the value of the field, a list of values, ranges and steps like 1,5-10,*/15
+func (f cronField) check(value string) error {
+	for part := range strings.SplitSeq(value, ",") {
+		span, step, hasStep := strings.Cut(part, "/")
+		if hasStep {
+			if n, err := strconv.Atoi(step); err != nil || n <= 0 {
+				return fmt.Errorf("%s field '%s' has an invalid step, expected a positive number", f.name, part)
+			}
+		}
+		if span == "*" || (span == "?" && (f.name == "day" || f.name == "weekday")) {
+			continue
+		}
+
+		low, high, isRange := strings.Cut(span, "-")
+		from, err := f.parse(low)
+		if err != nil {
+			return err
+		}
+		to := from
+		if isRange {
+			if to, err = f.parse(high); err != nil {
+				return err
+			}
+			if to < from {
+				return fmt.Errorf("%s field '%s' is a range ending before it starts", f.name, part)
+			}
+		}
+	}
+	return nil
+}
+
+// parse parses a value of the field, a number or a name
+func (f cronField) parse(value string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(value, name) {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		if value == "" {
+			return 0, fmt.Errorf("%s field has an empty value", f.name)
+		}
+		return 0, fmt.Errorf("%s field '%s' is not a number", f.name, value)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("%s field '%s' out of range (%d-%d)", f.name, value, f.min, f.max)
+	}
+	return n, nil
+}
+
+// cronDescriptors are the descriptions of the descriptors of cron
+var cronDescriptors = map[string]string{
+	"@yearly":   "every year on January 1 at 00:00",
+	"@annually": "every year on January 1 at 00:00",
+	"@monthly":  "every month on day 1 at 00:00",
+	"@weekly":   "every Sunday at 00:00",
+	"@daily":    "every day at 00:00",
+	"@midnight": "every day at 00:00",
+	"@hourly":   "every hour",
+}
+
+// Describe renders a schedule in plain English for the UI, e.g. "every day at 02:30" for "0 30 2 * * *"
+// It takes the expressions ValidateCron accepts and the ones of Interval, other expressions are returned as they are.
+func Describe(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if desc, ok := cronDescriptors[expr]; ok {
+		return desc
+	}
+	if every, ok := strings.CutPrefix(expr, "@every "); ok {
+		return "every " + every
+	}
+	// The last day of the month of ScheduleBuilder isn't cron, it is described as such below
+	fields := strings.Fields(expr)
+	lastDay := len(fields) >= 5 && fields[len(fields)-3] == "L"
+	if lastDay {
+		fields[len(fields)-3] = "*"
+	}
+	normalized, err := normalizeCron(strings.Join(fields, " "), false)
+	if err != nil {
+		return expr
+	}
+
+	f := strings.Fields(normalized)
+	second, minute, hour, day, month, weekday := f[0], f[1], f[2], f[3], f[4], f[5]
+	var parts []string
+
+	// The time of day, or how often the task runs during the day
+	fixed := isNumber(second) && isNumber(minute) && isNumber(hour)
+	switch {
+	case fixed:
+		h, _ := strconv.Atoi(hour)
+		m, _ := strconv.Atoi(minute)
+		at := fmt.Sprintf("at %02d:%02d", h, m)
+		if sec, _ := strconv.Atoi(second); sec != 0 {
+			at += fmt.Sprintf(":%02d", sec)
+		}
+		parts = append(parts, at)
+	case second == "0" && minute == "0" && hour != "*":
+		parts = append(parts, describeHour(hour, "every hour "))
+	default:
+		if second != "0" {
+			parts = append(parts, describeField(second, "second"))
+		}
+		if minute != "*" || second == "0" {
+			parts = append(parts, describeField(minute, "minute"))
+		}
+		if hour != "*" {
+			parts = append(parts, describeHour(hour, ""))
+		}
+	}
+
+	// The days the task runs on, every day unless told
+	if lastDay {
+		parts = append(parts, "on the last day of the month")
+	} else if day != "*" && day != "?" {
+		parts = append(parts, "on "+describeField(day, "day")+" of the month")
+	}
+	if weekday != "*" && weekday != "?" {
+		parts = append(parts, "on "+describeValues(weekday, cronFields[5]))
+	}
+	if month != "*" {
+		parts = append(parts, "in "+describeValues(month, cronFields[4]))
+	}
+	if fixed && !lastDay && day == "*" && weekday == "*" && month == "*" {
+		parts = append([]string{"every day"}, parts...)
+	}
+	return strings.Join(parts, " ")
+}
+
+// describeField describes the value of a numeric field, e.g. "every 5 minutes" or "minutes 0 and 30"
+func describeField(value, unit string) string {
+	switch {
+	case value == "*":
+		return "every " + unit
+	case strings.HasPrefix(value, "*/"):
+		return fmt.Sprintf("every %s %ss", strings.TrimPrefix(value, "*/"), unit)
+	case !strings.ContainsAny(value, ",-/"):
+		return unit + " " + value
+	}
+	return unit + "s " + joinList(strings.Split(strings.ReplaceAll(value, "-", " through "), ","))
+}
+
+// describeHour describes the value of the hour field, e.g. "every 6 hours" or "during hours 9 through 17"
+// The hours a task runs during follow the prefix, e.g. "every hour ".
+func describeHour(value, prefix string) string {
+	desc := describeField(value, "hour")
+	if strings.HasPrefix(desc, "every ") {
+		return desc
+	}
+	return prefix + "during " + desc
+}
+
+// describeValues describes the value of a field with names, e.g. "Monday through Friday" or "January and July"
+func describeValues(value string, field cronField) string {
+	var items []string
+	for part := range strings.SplitSeq(value, ",") {
+		span, step, hasStep := strings.Cut(part, "/")
+		low, high, isRange := strings.Cut(span, "-")
+		var item string
+		switch {
+		case span == "*" && hasStep:
+			item = fmt.Sprintf("every %s %ss", step, field.name)
+		case span == "*":
+			item = "every " + field.name
+		case isRange:
+			item = valueName(low, field) + " through " + valueName(high, field)
+		default:
+			item = valueName(low, field)
+		}
+		if hasStep && span != "*" {
+			item += fmt.Sprintf(" every %s %ss", step, field.name)
+		}
+		items = append(items, item)
+	}
+	return joinList(items)
+}
+
+// valueName returns the English name of a value of the month or weekday field, e.g. "Monday" for MON or 1
+func valueName(value string, field cronField) string {
+	n, err := field.parse(value)
+	if err != nil {
+		return value
+	}
+	if field.name == "weekday" {
+		return time.Weekday(n).String()
+	}
+	return time.Month(n).String()
+}
+
+// joinList joins items like English, e.g. "a, b and c"
+func joinList(items []string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
+
+func isNumber(value string) bool {
+	_, err := strconv.Atoi(value)
+	return err == nil
+}
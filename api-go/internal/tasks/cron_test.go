@@ -0,0 +1,125 @@
+package tasks
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+func TestNormalizeSchedule(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+
+	tests := []struct {
+		standard bool
+		expr     string
+		want     string
+		err      string
+	}{
+		{false, "30 2 * * 1", "0 30 2 * * 1", ""},
+		{false, "15 30 2 * * 1", "15 30 2 * * 1", ""},
+		{false, "@daily", "@daily", ""},
+		{false, "* * *", "", "expected 5"},
+		{false, "61 2 * * 1", "", "the standard format"},
+		{false, "0 61 2 * * 1", "", "the seconds format"},
+		{true, "*/5  * * * *", "0 */5 * * * *", ""},
+		{true, "0 30 2 * * 1", "", "the standard format"},
+	}
+	for _, tt := range tests {
+		m := NewManager()
+		if tt.standard {
+			m.WithStandardCron()
+		}
+		err := m.AddTask("task", mita.Cron(tt.expr), noop)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: expected an error mentioning %q, got %v", tt.expr, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.expr, err)
+			continue
+		}
+		if info, _ := m.GetTask("task"); info.Schedule != tt.want {
+			t.Errorf("%q: expected the schedule %q, got %q", tt.expr, tt.want, info.Schedule)
+		}
+	}
+
+	// The schedules built with mita.Every and the jittered ones are read with seconds
+	m := NewManager().WithStandardCron()
+	if err := m.AddTask("built", mita.Every().Day().At(2, 0), noop); err != nil {
+		t.Errorf("expected a built schedule to be accepted, got %v", err)
+	}
+	if err := m.AddTask("jittered", Jitter(mita.Cron("0 2 * * *"), time.Minute), noop); err != nil {
+		t.Errorf("expected a jittered schedule to be accepted, got %v", err)
+	}
+	if err := m.RescheduleTask("built", mita.Cron("0 3 * * *")); err != nil {
+		t.Errorf("expected a standard expression to be accepted, got %v", err)
+	}
+	if info, _ := m.GetTask("built"); info.Schedule != "0 0 3 * * *" {
+		t.Errorf("expected the rescheduled task to run at 3:00, got %q", info.Schedule)
+	}
+}
+
+func TestValidateCron(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"30 2 * * 1-5", ""},
+		{"*/10 0,30 9-17 * JAN-jun ?", ""},
+		{"@every 90s", ""},
+		{"61 2 * * *", "minute field '61' out of range (0-59)"},
+		{"0 61 2 * * *", "minute field '61' out of range (0-59)"},
+		{"0 2 * * 7", "weekday field '7' out of range (0-6)"},
+		{"0 2 0 * *", "day field '0' out of range (1-31)"},
+		{"0 2 * FOO *", "month field 'FOO' is not a number"},
+		{"*/0 2 * * *", "minute field '*/0' has an invalid step"},
+		{"0 5-2 * * *", "hour field '5-2' is a range ending before it starts"},
+		{"0 2,,4 * * *", "hour field has an empty value"},
+		{"@fortnightly", "invalid cron descriptor"},
+	}
+	for _, tt := range tests {
+		err := ValidateCron(tt.expr)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", tt.expr, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: expected an error mentioning %q, got %v", tt.expr, tt.err, err)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"0 30 2 * * *", "every day at 02:30"},
+		{"30 2 * * *", "every day at 02:30"},
+		{"15 0 4 * * *", "every day at 04:00:15"},
+		{"0 0 2 * * 1-5", "at 02:00 on Monday through Friday"},
+		{"0 0 2 1 * *", "at 02:00 on day 1 of the month"},
+		{"0 0 0 1 1,7 *", "at 00:00 on day 1 of the month in January and July"},
+		{"0 */5 * * * *", "every 5 minutes"},
+		{"0 * * * * *", "every minute"},
+		{"*/10 * * * * *", "every 10 seconds"},
+		{"0 0 */6 * * *", "every 6 hours"},
+		{"0 0 9-17 * * MON-FRI", "every hour during hours 9 through 17 on Monday through Friday"},
+		{"0 0,30 9 * * *", "minutes 0 and 30 during hour 9"},
+		{"@daily", "every day at 00:00"},
+		{"@every 1m30s", "every 1m30s"},
+		{"not a schedule", "not a schedule"},
+	}
+	for _, tt := range tests {
+		if got := Describe(tt.expr); got != tt.want {
+			t.Errorf("Describe(%q) = %q; want %q", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package tasks
+
+import (
+	"slices"
+	"time"
+
+	"github.com/cymoo/mote/pkg/util/ring"
+)
+
+// recentDurations is the number of durations kept per task, that the 95th percentile is computed from
+const recentDurations = 20
+
+// DurationStats are the statistics of the durations of the runs of a task since the start of the Manager
+// A run lasts from its first attempt to the end of its last one, waits between attempts included.
+type DurationStats struct {
+	// Count is the number of runs measured
+	Count int64
+	Min   time.Duration
+	Max   time.Duration
+	Avg   time.Duration
+	// P95 is the 95th percentile of the recent durations
+	P95 time.Duration
+	// Recent are the durations of the last runs, newest first
+	Recent []time.Duration
+}
+
+// durationStats measures the durations of the runs of a task, guarded by the lock of the Manager
+type durationStats struct {
+	count  int64
+	total  time.Duration
+	min    time.Duration
+	max    time.Duration
+	recent *ring.Buffer[time.Duration]
+}
+
+func newDurationStats() *durationStats {
+	return &durationStats{recent: ring.New[time.Duration](recentDurations)}
+}
+
+func (d *durationStats) add(duration time.Duration) {
+	if d.count == 0 || duration < d.min {
+		d.min = duration
+	}
+	d.max = max(d.max, duration)
+	d.count++
+	d.total += duration
+	d.recent.Push(duration)
+}
+
+func (d *durationStats) snapshot() DurationStats {
+	stats := DurationStats{Count: d.count, Min: d.min, Max: d.max, Recent: d.recent.Items()}
+	if d.count > 0 {
+		stats.Avg = d.total / time.Duration(d.count)
+	}
+	stats.P95 = percentile(stats.Recent, 95)
+	return stats
+}
+
+// percentile returns the p-th percentile of the durations by the nearest-rank method, 0 without durations
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := slices.Sorted(slices.Values(durations))
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// GetStats returns the statistics of mita, with the durations of the runs of each task under "task_durations", the
+// statistics of the tasks by label under "task_labels", by group under "task_groups" and the ones of the workers under
+// "task_workers", see LabelStats, GroupStats and WorkerStats
+func (m *Manager) GetStats() map[string]any {
+	stats := m.TaskManager.GetStats()
+
+	m.mu.RLock()
+	durations := make(map[string]DurationStats, len(m.stats))
+	for name, task := range m.stats {
+		durations[name] = task.durations.snapshot()
+	}
+	m.mu.RUnlock()
+
+	stats["task_durations"] = durations
+	tasks := m.ListTasks()
+	stats["task_labels"] = labelStats(tasks)
+	stats["task_groups"] = m.groupStats(tasks)
+	stats["task_workers"] = m.workerStats()
+	return stats
+}
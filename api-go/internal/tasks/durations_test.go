@@ -0,0 +1,126 @@
+package tasks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := func(values ...int) []time.Duration {
+		durations := make([]time.Duration, len(values))
+		for i, v := range values {
+			durations[i] = time.Duration(v) * time.Millisecond
+		}
+		return durations
+	}
+
+	tests := []struct {
+		durations []time.Duration
+		want      time.Duration
+	}{
+		{nil, 0},
+		{ms(7), 7 * time.Millisecond},
+		{ms(30, 10, 20), 30 * time.Millisecond},
+		{ms(20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1), 19 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.durations, 95); got != tt.want {
+			t.Errorf("percentile(%v, 95) = %v, want %v", tt.durations, got, tt.want)
+		}
+	}
+}
+
+func TestRunDurations(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	// Each run lasts as long as the next duration on the fake clock
+	durations := []time.Duration{3 * time.Second, time.Second, 8 * time.Second}
+	runs := 0
+	m.AddTask("sync", mita.Every().Day(), func(ctx context.Context) error {
+		clock.Advance(durations[runs])
+		runs++
+		return nil
+	})
+	m.AddTask("idle", mita.Every().Day(), func(ctx context.Context) error { return nil })
+
+	for range durations {
+		m.RunTaskNow("sync")
+		waitIdle(t, m, "sync")
+	}
+
+	info, _ := m.GetTask("sync")
+	got := info.Durations
+	if got.Count != 3 || got.Min != time.Second || got.Max != 8*time.Second || got.Avg != 4*time.Second {
+		t.Errorf("expected 3 runs of 1s to 8s, 4s on average, got %+v", got)
+	}
+	if got.P95 != 8*time.Second {
+		t.Errorf("expected a 95th percentile of 8s, got %v", got.P95)
+	}
+	if want := []time.Duration{8 * time.Second, time.Second, 3 * time.Second}; !slices.Equal(got.Recent, want) {
+		t.Errorf("expected the recent durations newest first %v, got %v", want, got.Recent)
+	}
+
+	stats := m.GetStats()
+	byTask, ok := stats["task_durations"].(map[string]DurationStats)
+	if !ok || byTask["sync"].Count != 3 || byTask["idle"].Count != 0 {
+		t.Errorf("expected the durations of each task in the stats, got %+v", stats["task_durations"])
+	}
+	if stats["total_tasks"] != 2 {
+		t.Errorf("expected the stats of mita to be kept, got %+v", stats)
+	}
+
+	// The durations are kept when the task is rescheduled
+	if err := m.RescheduleTask("sync", mita.Every().Hour()); err != nil {
+		t.Fatalf("RescheduleTask failed: %v", err)
+	}
+	if info, _ := m.GetTask("sync"); info.Durations.Count != 3 {
+		t.Errorf("expected the durations to be kept, got %+v", info.Durations)
+	}
+}
+
+func TestStatsPageShowsDurations(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+	m.AddTask("sync", mita.Every().Day(), func(ctx context.Context) error { return nil })
+	m.RunTaskNow("sync")
+	waitIdle(t, m, "sync")
+
+	server := httptest.NewServer(m.WebHandler("/tasks"))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/tasks/stats")
+	if err != nil {
+		t.Fatalf("failed to get the page: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	page := string(body)
+
+	table := strings.Index(page, "Run Durations")
+	if resp.StatusCode != http.StatusOK || table < 0 {
+		t.Fatalf("expected the table of the durations, got %d %s", resp.StatusCode, page)
+	}
+	if table < strings.Index(page, "Task Performance") || table > strings.LastIndex(page, "</body>") {
+		t.Errorf("expected the table after the executions of the tasks, got %s", page)
+	}
+
+	resp, err = http.Get(server.URL + "/tasks/")
+	if err != nil {
+		t.Fatalf("failed to get the page: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ = io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "Run Durations") {
+		t.Error("expected the task list to be left as is")
+	}
+}
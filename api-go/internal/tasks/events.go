@@ -0,0 +1,201 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// States of a task told by a TaskEvent, the ones of its runs and its addition or removal
+const (
+	EventRunning   = "running"
+	EventCompleted = "completed"
+	EventFailed    = "failed"
+	EventSkipped   = "skipped"
+	EventTripped   = "tripped"
+	EventAdded     = "added"
+	EventRemoved   = "removed"
+)
+
+// TaskEvent is a change of the state of a task, told when a run starts, ends, is skipped, or trips the circuit breaker
+// of the task, and when the task is added or removed, without run ID
+type TaskEvent struct {
+	Task  string    `json:"task"`
+	RunID string    `json:"run_id"`
+	State string    `json:"state"`
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// eventBufferSize is the number of events a slow listener can fall behind before the next ones are dropped
+const eventBufferSize = 64
+
+// eventBroker tells the events of the runs to the listeners, like the event stream of the task API
+type eventBroker struct {
+	mu        sync.Mutex
+	listeners map[chan TaskEvent]struct{}
+	// closed tells whether the channels of the listeners were closed, see close
+	closed bool
+}
+
+// listen returns a channel of the events of the runs, and a function to stop listening
+// The events are dropped rather than blocking the runs when the listener falls behind.
+func (b *eventBroker) listen() (<-chan TaskEvent, func()) {
+	ch := make(chan TaskEvent, eventBufferSize)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.listeners == nil {
+		b.listeners = make(map[chan TaskEvent]struct{})
+	}
+	b.listeners[ch] = struct{}{}
+
+	return ch, func() { b.remove(ch) }
+}
+
+// remove stops a listener, closing its channel
+func (b *eventBroker) remove(ch <-chan TaskEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for listener := range b.listeners {
+		if listener == ch {
+			delete(b.listeners, listener)
+			close(listener)
+		}
+	}
+}
+
+// close closes the channels of the listeners, once no event is told anymore
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.listeners {
+		close(ch)
+	}
+	b.listeners, b.closed = nil, true
+}
+
+func (b *eventBroker) publish(event TaskEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.listeners {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// publishStage tells the listeners about a stage of a run, see callHooks
+func (m *Manager) publishStage(name, runID string, stage int, err error) {
+	event := TaskEvent{
+		Task:  name,
+		RunID: runID,
+		State: [...]string{stageStart: EventRunning, stageSuccess: EventCompleted, stageFailure: EventFailed, stageSkipped: EventSkipped, stageTripped: EventTripped}[stage],
+		Time:  m.clock.Now(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	m.events.publish(event)
+}
+
+// publishTask tells the listeners that a task was added or removed
+func (m *Manager) publishTask(name, state string) {
+	m.events.publish(TaskEvent{Task: name, State: state, Time: m.clock.Now()})
+}
+
+// Subscribe returns a channel of the events of the tasks, see TaskEvent, e.g. to broadcast them or keep an audit log
+// The events are dropped rather than blocking the runs when the subscriber falls behind by more than 64 events. The
+// channel is closed when the Manager stops, or by Unsubscribe.
+func (m *Manager) Subscribe() <-chan TaskEvent {
+	ch, _ := m.events.listen()
+	return ch
+}
+
+// Unsubscribe stops telling the events to a channel returned by Subscribe, and closes it
+func (m *Manager) Unsubscribe(ch <-chan TaskEvent) {
+	m.events.remove(ch)
+}
+
+// eventsHeartbeat is the interval of the comments sent on an idle event stream, so that proxies keep it open
+const eventsHeartbeat = 30 * time.Second
+
+// serveEvents streams the events of the runs as server-sent events named "task", until the client goes away
+func (m *Manager) serveEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// The stream outlives the write timeout of the server
+	rc.SetWriteDeadline(time.Time{})
+
+	events, stop := m.events.listen()
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-m.stopped:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: task\ndata: %s\n\n", data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// liveReloadScript reloads the page of the tasks when a run starts or ends, a burst of events reloading it once
+var liveReloadScript = template.Must(template.New("live").Parse(`<script>
+(function () {
+  var source = new EventSource({{.}});
+  var timer;
+  source.addEventListener("task", function () {
+    clearTimeout(timer);
+    timer = setTimeout(function () { location.reload(); }, 300);
+  });
+})();
+</script>
+`))
+
+// LiveWebHandler serves the pages of WebHandler, reloading the task list as soon as a run starts or ends, with the
+// event stream served at eventsURL by APIHandler, e.g. "/api/tasks/events"
+func (m *Manager) LiveWebHandler(baseURL, eventsURL string) http.Handler {
+	web := m.WebHandler(baseURL)
+	var script bytes.Buffer
+	liveReloadScript.Execute(&script, eventsURL)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			web.ServeHTTP(w, r)
+			return
+		}
+		rewritePage(w, r, web, func(page []byte) []byte {
+			return insertAt(page, bytes.LastIndex(page, []byte("</body>")), script.Bytes())
+		})
+	})
+}
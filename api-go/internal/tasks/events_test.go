@@ -0,0 +1,182 @@
+package tasks
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+func TestEventStream(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	m.AddTask("sync", mita.Every().Day(), func(ctx context.Context) error { return nil })
+	m.AddTask("broken", mita.Every().Day(), func(ctx context.Context) error { return errors.New("boom") })
+
+	server := httptest.NewServer(m.APIHandler("/api"))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/tasks/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open the stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+
+	events := make(chan TaskEvent)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var event TaskEvent
+			if err := json.Unmarshal([]byte(data), &event); err == nil {
+				events <- event
+			}
+		}
+		close(events)
+	}()
+	next := func() TaskEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for an event")
+			return TaskEvent{}
+		}
+	}
+
+	// The stream is open once the first comment is read, wait for the listener to be added
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		m.events.mu.Lock()
+		n := len(m.events.listeners)
+		m.events.mu.Unlock()
+		if n == 1 || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	m.RunTaskNow("sync")
+	started, completed := next(), next()
+	if started.Task != "sync" || started.State != EventRunning || started.RunID == "" {
+		t.Errorf("expected the start of the run, got %+v", started)
+	}
+	if completed.State != EventCompleted || completed.RunID != started.RunID {
+		t.Errorf("expected the end of the same run, got %+v", completed)
+	}
+
+	m.RunTaskNow("broken")
+	next()
+	if failed := next(); failed.State != EventFailed || failed.Error != "boom" {
+		t.Errorf("expected the failure of the run, got %+v", failed)
+	}
+
+	// The listener is removed when the client goes away
+	cancel()
+	for range events {
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		m.events.mu.Lock()
+		n := len(m.events.listeners)
+		m.events.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the listener to be removed")
+		}
+	}
+}
+
+func TestEventBrokerDropsWhenFull(t *testing.T) {
+	var b eventBroker
+	events, stop := b.listen()
+	defer stop()
+
+	for range eventBufferSize + 10 {
+		b.publish(TaskEvent{Task: "sync"})
+	}
+	if len(events) != eventBufferSize {
+		t.Errorf("expected %d buffered events, got %d", eventBufferSize, len(events))
+	}
+
+	stop()
+	b.publish(TaskEvent{Task: "sync"})
+	if len(events) != eventBufferSize {
+		t.Error("expected no event after stopping")
+	}
+}
+
+func TestLiveWebHandler(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+	m.AddTask("sync", mita.Every().Day(), func(ctx context.Context) error { return nil })
+
+	server := httptest.NewServer(m.LiveWebHandler("/tasks", "/api/tasks/events"))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/tasks")
+	if err != nil {
+		t.Fatalf("failed to get the page: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	page := string(body)
+
+	if resp.StatusCode != http.StatusOK || !strings.Contains(page, "sync") {
+		t.Fatalf("expected the task list, got %d %s", resp.StatusCode, page)
+	}
+	script := strings.Index(page, `new EventSource("/api/tasks/events")`)
+	if script < 0 || script > strings.LastIndex(page, "</body>") {
+		t.Errorf("expected the live reload script before </body>, got %s", page)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	m := NewManager()
+	events := m.Subscribe()
+
+	m.AddTask("sync", mita.Every().Day(), func(ctx context.Context) error { return errors.New("boom") })
+	m.RunTaskNow("sync")
+	waitIdle(t, m, "sync")
+	m.RemoveTask("sync")
+	m.Stop()
+
+	var states []string
+	for event := range events {
+		if event.Task != "sync" {
+			t.Errorf("unexpected event %+v", event)
+		}
+		states = append(states, event.State)
+	}
+	want := []string{EventAdded, EventRunning, EventFailed, EventRemoved}
+	if !slices.Equal(states, want) {
+		t.Errorf("expected the events %v until the manager stops, got %v", want, states)
+	}
+
+	other := NewManager()
+	defer other.Stop()
+	ch := other.Subscribe()
+	other.Unsubscribe(ch)
+	if _, ok := <-ch; ok {
+		t.Error("expected the channel to be closed once unsubscribed")
+	}
+}
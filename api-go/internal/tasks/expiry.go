@@ -0,0 +1,67 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+// errExpired is the reason of the run skipped once a task is past its expiry
+var errExpired = errors.New("the task expired")
+
+// WithMaxRuns disables the task once it ran n times, e.g. for a backfill job that is done afterwards
+// The runs skipped, e.g. during quiet hours, don't count. The count starts over with the Manager, but the task stays
+// disabled across restarts if the state of the tasks is kept, see Persist.
+func WithMaxRuns(n int) TaskOption {
+	return func(o *taskOptions) {
+		o.maxRuns = max(n, 0)
+	}
+}
+
+// WithExpiry disables the task once the deadline passed, e.g. for a temporary migration job
+// The first run due after the deadline is skipped, added to the history of the task, and disables it.
+func WithExpiry(deadline time.Time) TaskOption {
+	return func(o *taskOptions) {
+		o.expiry = deadline
+	}
+}
+
+// withExpiry disables the task once it ran as many times as allowed or is past its expiry, see WithMaxRuns and
+// WithExpiry
+func (m *Manager) withExpiry(name string, stats *taskStats, task mita.Task) mita.Task {
+	return func(ctx context.Context) error {
+		ctx, trigger := m.tellTrigger(ctx, stats)
+		if expiry := stats.options.expiry; !expiry.IsZero() && !m.clock.Now().Before(expiry) {
+			now := m.clock.Now()
+			m.mu.Lock()
+			stats.skipped++
+			m.mu.Unlock()
+			stats.history.Push(TaskRun{ID: GetRunID(ctx), Start: now, End: now, Trigger: trigger, Error: errExpired.Error()})
+			setOutcome(ctx, outcomeSkipped)
+			m.callHooks(name, GetRunID(ctx), stats, stageSkipped, errExpired)
+			m.disableDone(name, GetRunID(ctx), "it expired on "+expiry.Format(time.DateTime))
+			return nil
+		}
+
+		err := task(ctx)
+
+		m.mu.RLock()
+		runs := stats.runs
+		m.mu.RUnlock()
+		if limit := stats.options.maxRuns; limit > 0 && runs >= int64(limit) {
+			m.disableDone(name, GetRunID(ctx), "it ran as many times as allowed")
+		}
+		return err
+	}
+}
+
+// disableDone disables a task that is done after the given run, for the given reason
+func (m *Manager) disableDone(name, runID, reason string) {
+	if err := m.TaskManager.DisableTask(name); err != nil {
+		m.logger.Error("error disabling a task", "task", name, "run_id", runID, "error", err)
+		return
+	}
+	m.logger.Info("task disabled", "task", name, "run_id", runID, "reason", reason)
+}
@@ -0,0 +1,67 @@
+package tasks
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+func TestWithMaxRuns(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 6, 15, 9, 30, 0, 0, time.Local))
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	var runs atomic.Int32
+	m.AddTask("backfill", mita.Every().Hour(), func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}, WithMaxRuns(2))
+
+	for range 2 {
+		if _, err := m.FireNext("backfill"); err != nil {
+			t.Fatalf("FireNext failed: %v", err)
+		}
+		waitIdle(t, m, "backfill")
+	}
+	if info, _ := m.GetTask("backfill"); info.Enabled {
+		t.Errorf("expected the task to be disabled after 2 runs")
+	}
+	m.FireNext("backfill")
+	waitIdle(t, m, "backfill")
+	if runs.Load() != 2 {
+		t.Errorf("expected 2 runs, got %d", runs.Load())
+	}
+}
+
+func TestWithExpiry(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 6, 15, 9, 30, 0, 0, time.Local))
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	var runs atomic.Int32
+	m.AddTask("migrate", mita.Every().Hour(), func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}, WithExpiry(time.Date(2024, 6, 15, 11, 0, 0, 0, time.Local)))
+
+	// 10:00 runs, 11:00 is past the expiry
+	for range 2 {
+		if _, err := m.FireNext("migrate"); err != nil {
+			t.Fatalf("FireNext failed: %v", err)
+		}
+		waitIdle(t, m, "migrate")
+	}
+	if runs.Load() != 1 {
+		t.Errorf("expected 1 run, got %d", runs.Load())
+	}
+	history, _ := m.GetTaskHistory("migrate")
+	if len(history) != 2 || history[0].Error != errExpired.Error() {
+		t.Errorf("expected the run past the expiry to be skipped, got %+v", history)
+	}
+	if info, _ := m.GetTask("migrate"); info.Enabled {
+		t.Errorf("expected the task to be disabled once expired")
+	}
+}
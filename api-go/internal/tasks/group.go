@@ -0,0 +1,393 @@
+package tasks
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cymoo/mita"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithGroup makes the task share a semaphore with the other tasks of the named group, so that at most limit runs
+// of the group are in progress at a time, e.g. WithGroup("db-heavy", 1) serializes the tasks heavy on the database
+// while the other tasks run on the workers, see WithWorkers. The limit is the one the group was created with, a task
+// giving another one isn't added. A run waits for its turn after its jitter and before taking its lock, and holds it
+// between attempts.
+// A limit of 0 doesn't limit the runs of the group, which take a worker like the tasks without a group, see
+// WithWorkers: the group only gathers tasks enabled, disabled or run together, e.g. WithGroup("reporting", 0), see
+// EnableGroup.
+func WithGroup(name string, limit int) TaskOption {
+	return func(o *taskOptions) {
+		o.group = name
+		o.groupLimit = max(limit, 0)
+	}
+}
+
+// WithPriority makes the runs of the task take a free slot of its group before the waiting runs of the tasks of a
+// lower priority, the default being 0. The runs of the same priority take their turn in the order they came.
+// The priority only matters to a task of a group, see WithGroup.
+func WithPriority(priority int) TaskOption {
+	return func(o *taskOptions) {
+		o.priority = priority
+	}
+}
+
+// GroupStats are the statistics of the tasks of a group, see WithGroup
+type GroupStats struct {
+	// Limit is the number of runs of the group in progress at a time, 0 for no limit
+	Limit int `json:"limit"`
+	// QueueStats are the ones of the queue of the group, the runs of a group without a limit wait for the workers
+	// instead, see WorkerStats
+	QueueStats
+	LabelStats
+}
+
+// EnableGroup enables the tasks of a group, e.g. after a migration they were disabled during
+func (m *Manager) EnableGroup(name string) error {
+	return m.forGroup(name, m.EnableTask)
+}
+
+// DisableGroup disables the tasks of a group, their runs in progress go on, see EnableGroup
+func (m *Manager) DisableGroup(name string) error {
+	return m.forGroup(name, m.DisableTask)
+}
+
+// RunGroupNow starts a run of each task of the group, like RunTaskNow
+// The tasks that can't run, e.g. being disabled or already running, are skipped and their errors joined, the others
+// are started anyway. The runs of a group with a limit wait for their turn like the scheduled ones.
+func (m *Manager) RunGroupNow(name string) error {
+	return m.forGroup(name, m.RunTaskNow)
+}
+
+// forGroup calls fn with each task of the group by name, and returns their errors joined
+// A group is known as long as one of its tasks is, an unknown one is an error.
+func (m *Manager) forGroup(name string, fn func(task string) error) error {
+	tasks := m.groupTasks(name)
+	if len(tasks) == 0 {
+		return fmt.Errorf("group '%s' not found", name)
+	}
+	var errs []error
+	for _, task := range tasks {
+		if err := fn(task); err != nil {
+			errs = append(errs, fmt.Errorf("task '%s': %w", task, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// groupTasks returns the names of the tasks of a group, sorted
+func (m *Manager) groupTasks(name string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var tasks []string
+	for task, stats := range m.stats {
+		if stats.options.group == name {
+			tasks = append(tasks, task)
+		}
+	}
+	slices.Sort(tasks)
+	return tasks
+}
+
+// groupStats aggregates the statistics of the tasks by group, with the ones of the queues of the groups
+func (m *Manager) groupStats(tasks []*TaskInfo) map[string]GroupStats {
+	stats := make(map[string]GroupStats)
+	for _, task := range tasks {
+		if task.Group == "" {
+			continue
+		}
+		s := stats[task.Group]
+		s.Limit = task.GroupLimit
+		s.add(task)
+		stats[task.Group] = s
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for name, s := range stats {
+		if sem, ok := m.groups[name]; ok && sem.limit > 0 {
+			_, s.QueueStats = sem.stats()
+			stats[name] = s
+		}
+	}
+	return stats
+}
+
+// group returns the semaphore of a group, created with the given limit the first time a task joins it
+func (m *Manager) group(name string, limit int) (*semaphore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sem, ok := m.groups[name]
+	if !ok {
+		sem = newSemaphore(limit, m.clock)
+		sem.setQueue(m.queueCapacity, m.queuePolicy, m.queueTimeout)
+		m.groups[name] = sem
+	}
+	if sem.limit != limit {
+		return nil, fmt.Errorf("group '%s' runs %d tasks at a time, not %d", name, sem.limit, limit)
+	}
+	return sem, nil
+}
+
+// workerSlots returns the semaphore of the workers, created the first time a task without a group with a limit is
+// added
+func (m *Manager) workerSlots() *semaphore {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.workers == nil {
+		m.workers = newSemaphore(m.workerLimit, m.clock)
+		m.workers.setQueue(m.queueCapacity, m.queuePolicy, m.queueTimeout)
+	}
+	return m.workers
+}
+
+// withQueue waits for a slot of the semaphore of the group of the task, or of the workers, before a run, the runs the
+// queue doesn't take are skipped, see WithQueue
+// The trigger is told before waiting, as a run that waited no longer starts on a tick of the schedule.
+func (m *Manager) withQueue(name string, stats *taskStats, sem *semaphore, task mita.Task) mita.Task {
+	return func(ctx context.Context) error {
+		ctx, trigger := m.tellTrigger(ctx, stats)
+
+		start := m.clock.Now()
+		if err := sem.acquire(ctx, name, stats.options.priority, m.stopped); err != nil {
+			switch {
+			case errors.Is(err, errStopped):
+				// The run is dropped like the ones that didn't start before the manager stopped
+				return nil
+			case errors.Is(err, errQueueFull), errors.Is(err, errQueueTimeout), errors.Is(err, errCoalesced):
+				m.mu.Lock()
+				stats.skipped++
+				m.mu.Unlock()
+				stats.history.Push(TaskRun{ID: GetRunID(ctx), Start: start, End: start, Trigger: trigger, Error: err.Error()})
+				setOutcome(ctx, outcomeSkipped)
+				m.callHooks(name, GetRunID(ctx), stats, stageSkipped, err)
+				return nil
+			}
+			return err
+		}
+		defer sem.release()
+
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.String("task.group", stats.options.group),
+			attribute.Int("task.priority", stats.options.priority),
+			attribute.Int64("task.group_wait_ms", m.clock.Now().Sub(start).Milliseconds()),
+		)
+		return task(ctx)
+	}
+}
+
+// errStopped is returned by semaphore.acquire when the manager stopped before a slot was free
+var errStopped = errors.New("the manager stopped")
+
+// semaphore limits the runs of a group, or of the workers, in progress, giving a free slot to the waiting run of the
+// highest priority
+// The waiting runs are bounded by the capacity of the queue, if any, see WithQueue.
+type semaphore struct {
+	mu      sync.Mutex
+	limit   int
+	held    int
+	waiters waiterQueue
+	// seq orders the waiters of the same priority by their arrival
+	seq uint64
+	// clock times the wait of the runs blocked by the full queue
+	clock Clock
+
+	capacity int
+	policy   QueuePolicy
+	timeout  time.Duration
+	// freed is closed when a waiter leaves the queue, for the runs blocked by the full queue, nil if none is
+	freed   chan struct{}
+	blocked int
+	dropped int64
+}
+
+func newSemaphore(limit int, clock Clock) *semaphore {
+	return &semaphore{limit: limit, clock: clock}
+}
+
+// setQueue bounds the waiters to capacity, 0 for no bound, the policy telling what a run coming to a full queue does
+// and timeout how long it is blocked at most, 0 for no limit
+func (s *semaphore) setQueue(capacity int, policy QueuePolicy, timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capacity, s.policy, s.timeout = capacity, policy, timeout
+	// The runs blocked check the new capacity
+	s.freeLocked()
+}
+
+// setLimit changes the number of slots, the waiters taking the new ones
+func (s *semaphore) setLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.wakeLocked()
+}
+
+// stats returns the number of slots held and the statistics of the queue
+func (s *semaphore) stats() (int, QueueStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.held, QueueStats{Queued: len(s.waiters), Blocked: s.blocked, Dropped: s.dropped}
+}
+
+// acquire waits for a slot for a run of the task until the context is done or stopped is closed
+// It returns errQueueFull, errQueueTimeout or errCoalesced for a run the queue doesn't take, see QueuePolicy.
+func (s *semaphore) acquire(ctx context.Context, task string, priority int, stopped <-chan struct{}) error {
+	s.mu.Lock()
+	// timeout ends the wait of a run blocked by the full queue, it starts the first time the run is blocked
+	var timeout <-chan time.Time
+	for {
+		if s.held < s.limit && len(s.waiters) == 0 {
+			s.held++
+			s.mu.Unlock()
+			return nil
+		}
+		if s.policy == QueueCoalesce && slices.ContainsFunc(s.waiters, func(w *waiter) bool { return w.task == task }) {
+			return s.dropLocked(errCoalesced)
+		}
+		if s.capacity == 0 || len(s.waiters) < s.capacity {
+			break
+		}
+		if s.policy != QueueBlock {
+			return s.dropLocked(errQueueFull)
+		}
+
+		if s.freed == nil {
+			s.freed = make(chan struct{})
+		}
+		if timeout == nil && s.timeout > 0 {
+			timeout = s.clock.After(s.timeout)
+		}
+		freed := s.freed
+		s.blocked++
+		s.mu.Unlock()
+		var err error
+		select {
+		case <-freed:
+		case <-timeout:
+			err = errQueueTimeout
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-stopped:
+			err = errStopped
+		}
+		s.mu.Lock()
+		s.blocked--
+		if errors.Is(err, errQueueTimeout) {
+			return s.dropLocked(err)
+		}
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	s.seq++
+	w := &waiter{task: task, priority: priority, seq: s.seq, ready: make(chan struct{})}
+	heap.Push(&s.waiters, w)
+	s.mu.Unlock()
+
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-stopped:
+		err = errStopped
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w.index < 0 {
+		// The slot was given to the waiter as it gave up, it goes to the next one
+		s.held--
+		s.wakeLocked()
+	} else {
+		heap.Remove(&s.waiters, w.index)
+		s.freeLocked()
+	}
+	return err
+}
+
+// dropLocked counts a run the queue doesn't take and returns the error telling why, it unlocks the semaphore
+func (s *semaphore) dropLocked(err error) error {
+	s.dropped++
+	s.mu.Unlock()
+	return err
+}
+
+// freeLocked wakes up the runs blocked by the full queue, as a waiter left it
+func (s *semaphore) freeLocked() {
+	if s.freed != nil {
+		close(s.freed)
+		s.freed = nil
+	}
+}
+
+// release frees a slot, given to the waiting run of the highest priority if any
+func (s *semaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held--
+	s.wakeLocked()
+}
+
+func (s *semaphore) wakeLocked() {
+	for s.held < s.limit && len(s.waiters) > 0 {
+		w := heap.Pop(&s.waiters).(*waiter)
+		s.held++
+		close(w.ready)
+		s.freeLocked()
+	}
+}
+
+// waiter is a run waiting for a slot, whose ready channel is closed once it's given one
+type waiter struct {
+	task     string
+	priority int
+	seq      uint64
+	ready    chan struct{}
+	// index is the position of the waiter in the queue, -1 once it left it
+	index int
+}
+
+// waiterQueue is a heap of waiters, the highest priority first and then the earliest
+type waiterQueue []*waiter
+
+func (q waiterQueue) Len() int { return len(q) }
+
+func (q waiterQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waiterQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waiterQueue) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waiterQueue) Pop() any {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*q = old[:n-1]
+	return w
+}
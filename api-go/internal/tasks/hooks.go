@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/cymoo/mita"
+)
+
+// Hook is called with the name of a task, the ID of its run, and the error of a failed or the reason of a skipped run
+type Hook func(name, runID string, err error)
+
+// Hooks are called around the runs of tasks, e.g. to report failures by email, any of them can be nil
+// They are called in the goroutine of the run, so a slow hook delays the end of the run.
+type Hooks struct {
+	OnStart   Hook
+	OnSuccess Hook
+	OnFailure Hook
+	// OnSkipped is called for a run that didn't happen, because another instance held the lock of the task
+	// or the task it runs after failed
+	OnSkipped Hook
+	// OnTripped is called after a failed run that disabled the task, see WithCircuitBreaker
+	OnTripped Hook
+}
+
+// Stages of a run that hooks are called for
+const (
+	stageStart = iota
+	stageSuccess
+	stageFailure
+	stageSkipped
+	stageTripped
+)
+
+// errLockHeld is the reason of a run skipped because another instance holds the lock of the task
+var errLockHeld = errors.New("another instance holds the lock")
+
+// runIDKey is the key of the ID of a run in the context of the task
+type runIDKey struct{}
+
+// WithHooks calls the hooks around the runs of the task, after the hooks added to the Manager
+func WithHooks(hooks Hooks) TaskOption {
+	return func(o *taskOptions) {
+		o.hooks = append(o.hooks, hooks)
+	}
+}
+
+// AddHooks calls the hooks around the runs of all tasks, before the hooks of each task
+func (m *Manager) AddHooks(hooks Hooks) {
+	m.mu.Lock()
+	m.hooks = append(m.hooks, hooks)
+	m.mu.Unlock()
+}
+
+// withRunID gives each run of the task an ID, that its history, hooks and log lines refer to
+// The ID of the run that just ended is kept for the messages mita logs once the task returns, see mitaWriter.
+func (m *Manager) withRunID(name string, task mita.Task) mita.Task {
+	return func(ctx context.Context) error {
+		id := newRunID()
+		defer m.endedRuns.Store(name, id)
+		return task(context.WithValue(ctx, runIDKey{}, id))
+	}
+}
+
+// GetRunID returns the ID of the run of a task from its context, empty outside of a run
+// A task can log it to tell its own log lines apart from the ones of its other runs, the Manager logs it as "run_id".
+func GetRunID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+// callHooks calls the hooks of a stage of a run, a panicking hook doesn't stop the others
+func (m *Manager) callHooks(name, runID string, stats *taskStats, stage int, err error) {
+	m.publishStage(name, runID, stage, err)
+
+	m.mu.RLock()
+	hooks := append(append([]Hooks{}, m.hooks...), stats.options.hooks...)
+	m.mu.RUnlock()
+
+	for _, h := range hooks {
+		hook := [...]Hook{stageStart: h.OnStart, stageSuccess: h.OnSuccess, stageFailure: h.OnFailure, stageSkipped: h.OnSkipped, stageTripped: h.OnTripped}[stage]
+		if hook == nil {
+			continue
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					m.logger.Error("hook panicked", "task", name, "run_id", runID, "panic", r)
+				}
+			}()
+			hook(name, runID, err)
+		}()
+	}
+}
+
+// newRunID returns a random ID of a run
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
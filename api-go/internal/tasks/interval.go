@@ -0,0 +1,160 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cymoo/mita"
+	"github.com/cymoo/mote/pkg/util/safego"
+)
+
+// IntervalSchedule runs a task every fixed duration, see Interval
+type IntervalSchedule struct {
+	every time.Duration
+	// afterCompletion counts the interval from the end of the previous run instead of its start
+	afterCompletion bool
+}
+
+// Interval runs a task every d from the start of the previous run, e.g. Interval(90 * time.Second)
+// Unlike mita's builder, it isn't tied to the fields of cron, so sub-minute and odd intervals tick evenly.
+// The Manager times the ticks with its clock, starting from Start. A tick is skipped while the task is running
+// or disabled. d must be positive, otherwise the function panics.
+func Interval(d time.Duration) *IntervalSchedule {
+	if d <= 0 {
+		panic("interval must be positive")
+	}
+	return &IntervalSchedule{every: d}
+}
+
+// AfterCompletion counts the interval from the end of the previous run, so that runs are d apart however long they take
+func (s *IntervalSchedule) AfterCompletion() *IntervalSchedule {
+	s.afterCompletion = true
+	return s
+}
+
+// String describes the schedule like the @every descriptor of cron
+func (s *IntervalSchedule) String() string {
+	if s.afterCompletion {
+		return fmt.Sprintf("@every %v after completion", s.every)
+	}
+	return fmt.Sprintf("@every %v", s.every)
+}
+
+// Next returns the tick of the interval after from
+func (s *IntervalSchedule) Next(from time.Time) time.Time {
+	return from.Add(s.every)
+}
+
+// Schedule is a schedule telling its ticks itself, whose runs the Manager starts as mita only knows cron, e.g. an
+// interval, or custom logic cron can't express like the first business day of the month or a holiday calendar
+// String describes the schedule in the UI. A schedule with a Next method passed to AddTask or RescheduleTask is timed
+// by the Manager like an interval, see ScheduleFunc.
+type Schedule interface {
+	mita.Schedule
+	// Next returns the tick after the given time, or the zero time if there is none, a tick not after the given time
+	// ends the schedule too
+	Next(after time.Time) time.Time
+}
+
+// funcSchedule is a schedule whose ticks are told by a function, see ScheduleFunc
+type funcSchedule struct {
+	description string
+	next        func(after time.Time) time.Time
+}
+
+// ScheduleFunc returns a schedule whose ticks are told by next, described by description in the UI, e.g.
+//
+//	ScheduleFunc("first business day of the month at 09:00", firstBusinessDay)
+//
+// next returns the tick after the given time, or the zero time if there is none, see Schedule. It panics if next is nil.
+func ScheduleFunc(description string, next func(after time.Time) time.Time) Schedule {
+	if next == nil {
+		panic("next cannot be nil")
+	}
+	return &funcSchedule{description: description, next: next}
+}
+
+func (s *funcSchedule) String() string {
+	return s.description
+}
+
+func (s *funcSchedule) Next(after time.Time) time.Time {
+	return s.next(after)
+}
+
+// withCompletion tells the interval loop of the task that a run ended
+func withCompletion(stats *taskStats, task mita.Task) mita.Task {
+	return func(ctx context.Context) error {
+		defer func() {
+			select {
+			case stats.completed <- struct{}{}:
+			default:
+			}
+		}()
+		return task(ctx)
+	}
+}
+
+// Start starts the scheduler of mita and the ticks of the tasks with a schedule timed by the Manager, see Schedule
+func (m *Manager) Start() {
+	m.TaskManager.Start()
+
+	m.mu.Lock()
+	m.started = true
+	for name, stats := range m.stats {
+		if stats.timed != nil {
+			safego.Go("run-timed-task", func() { m.runTimed(name, stats) })
+		}
+	}
+	m.mu.Unlock()
+}
+
+// runTimed starts the runs of a task with a schedule timed by the Manager until the manager stops or the task is
+// removed
+func (m *Manager) runTimed(name string, stats *taskStats) {
+	tick := m.armTimed(stats)
+	for {
+		select {
+		case <-m.stopped:
+			return
+		case <-stats.completed:
+			// Only a task whose interval counts from the end of its runs has the channel
+			tick = m.armTimed(stats)
+		case <-tick:
+			m.mu.Lock()
+			if m.stats[name] != stats {
+				m.mu.Unlock()
+				return
+			}
+			stats.timedRuns++
+			m.mu.Unlock()
+
+			// mita refuses runs of a disabled task or, unless it allows overlapping, of a running one
+			if err := m.TaskManager.RunTaskNow(name); err != nil {
+				m.mu.Lock()
+				stats.timedRuns--
+				m.mu.Unlock()
+			}
+			tick = m.armTimed(stats)
+		}
+	}
+}
+
+// armTimed returns a channel receiving the next tick of the schedule of the task, and records when it comes
+// The channel never receives anything if the schedule has no next tick.
+func (m *Manager) armTimed(stats *taskStats) <-chan time.Time {
+	now := m.clock.Now()
+	next := stats.timed.Next(now)
+	// A custom schedule telling a past tick would run the task in a loop
+	if !next.After(now) {
+		next = time.Time{}
+	}
+	m.mu.Lock()
+	stats.nextRun = next
+	m.mu.Unlock()
+	if next.IsZero() {
+		return nil
+	}
+	return m.clock.After(next.Sub(now))
+}
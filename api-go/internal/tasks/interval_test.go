@@ -0,0 +1,172 @@
+package tasks
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitNextRun waits for the next run of a task to be the given time
+func waitNextRun(t *testing.T, m *Manager, name string, next time.Time) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if info, _ := m.GetTask(name); info.NextRun.Equal(next) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	info, _ := m.GetTask(name)
+	t.Fatalf("expected the next run of %q at %v, got %v", name, next, info.NextRun)
+}
+
+func TestInterval(t *testing.T) {
+	start := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	var calls atomic.Int32
+	if err := m.AddTask("poll", Interval(90*time.Second), func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+	if _, err := m.FireNext("poll"); err == nil {
+		t.Error("expected no next run before the manager starts")
+	}
+
+	m.Start()
+	if err := clock.BlockUntil(1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	tick, err := m.FireNext("poll")
+	if err != nil {
+		t.Fatalf("FireNext failed: %v", err)
+	}
+	if !tick.Equal(start.Add(90 * time.Second)) {
+		t.Errorf("expected a tick 90s after the start, got %v", tick)
+	}
+	waitNextRun(t, m, "poll", start.Add(180*time.Second))
+	info := waitIdle(t, m, "poll")
+
+	if calls.Load() != 1 || info.Schedule != "@every 1m30s" {
+		t.Errorf("expected one run of an interval of 1m30s, got %d runs of %q", calls.Load(), info.Schedule)
+	}
+	history, _ := m.GetTaskHistory("poll")
+	if len(history) != 1 || history[0].Trigger != TriggerSchedule || !history[0].Start.Equal(tick) {
+		t.Errorf("expected a scheduled run on the tick, got %+v", history)
+	}
+}
+
+func TestIntervalAfterCompletion(t *testing.T) {
+	start := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	m := NewManager().WithClock(clock)
+	m.Start()
+	defer m.Stop()
+
+	// A run lasts 30s of the clock
+	slow := func(ctx context.Context) error {
+		<-clock.After(30 * time.Second)
+		return nil
+	}
+	if err := m.AddTask("sync", Interval(time.Minute).AfterCompletion(), slow); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	if err := clock.BlockUntil(1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	// The run waits next to the tick armed when it started
+	if err := clock.BlockUntil(2, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(30 * time.Second)
+	waitIdle(t, m, "sync")
+
+	waitNextRun(t, m, "sync", start.Add(2*time.Minute+30*time.Second))
+	if info, _ := m.GetTask("sync"); info.Schedule != "@every 1m0s after completion" {
+		t.Errorf("expected the schedule to be described, got %q", info.Schedule)
+	}
+}
+
+// firstBusinessDay returns 09:00 on the first weekday of the month after the given time
+func firstBusinessDay(after time.Time) time.Time {
+	for month := 0; ; month++ {
+		day := time.Date(after.Year(), after.Month()+time.Month(month), 1, 9, 0, 0, 0, after.Location())
+		for day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			day = day.AddDate(0, 0, 1)
+		}
+		if day.After(after) {
+			return day
+		}
+	}
+}
+
+func TestScheduleFunc(t *testing.T) {
+	// June 1, 2024 is a Saturday
+	start := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	var calls atomic.Int32
+	schedule := ScheduleFunc("first business day of the month at 09:00", firstBusinessDay)
+	if err := m.AddTask("report", schedule, func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	want := []time.Time{
+		time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 8, 1, 9, 0, 0, 0, time.UTC),
+	}
+	runs, err := m.GetNextRuns("report", 3)
+	if err != nil {
+		t.Fatalf("GetNextRuns failed: %v", err)
+	}
+	if len(runs) != 3 || !runs[0].Equal(want[0]) || !runs[1].Equal(want[1]) || !runs[2].Equal(want[2]) {
+		t.Errorf("expected the runs %v, got %v", want, runs)
+	}
+
+	m.Start()
+	if err := clock.BlockUntil(1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	tick, err := m.FireNext("report")
+	if err != nil {
+		t.Fatalf("FireNext failed: %v", err)
+	}
+	if !tick.Equal(want[0]) {
+		t.Errorf("expected a tick on %v, got %v", want[0], tick)
+	}
+	waitNextRun(t, m, "report", want[1])
+	info := waitIdle(t, m, "report")
+	if calls.Load() != 1 || info.Schedule != "first business day of the month at 09:00" {
+		t.Errorf("expected one run described by the schedule, got %d runs of %q", calls.Load(), info.Schedule)
+	}
+}
+
+func TestScheduleFuncPastTick(t *testing.T) {
+	start := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	m := NewManager().WithClock(NewFakeClock(start))
+	m.Start()
+	defer m.Stop()
+
+	// A tick not after the given time ends the schedule instead of running the task in a loop
+	stuck := ScheduleFunc("stuck", func(after time.Time) time.Time { return after })
+	if err := m.AddTask("stuck", stuck, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+	if runs, _ := m.GetNextRuns("stuck", 3); len(runs) != 0 {
+		t.Errorf("expected no next runs, got %v", runs)
+	}
+	waitNextRun(t, m, "stuck", time.Time{})
+}
@@ -0,0 +1,79 @@
+package tasks
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/cymoo/mita"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithJitter delays each scheduled run of the task by a random offset up to maxDelay
+// Replicas firing at the same tick then spread their runs, e.g. to not all hit the database at 02:00:00.
+// Runs started manually or by the task they run after are not delayed. Give it to SetDefaultOptions for all tasks.
+func WithJitter(maxDelay time.Duration) TaskOption {
+	return func(o *taskOptions) {
+		o.jitter = max(maxDelay, 0)
+	}
+}
+
+// jitterSchedule is a schedule whose runs are delayed by a random offset, see Jitter
+type jitterSchedule struct {
+	mita.Schedule
+	maxDelay time.Duration
+}
+
+// Jitter delays the runs of the schedule by a random offset up to maxDelay, like WithJitter
+// mita's builder can't take it as a method, so it wraps the built schedule, e.g. Jitter(mita.Every().Day().At(2, 0), time.Minute).
+func Jitter(schedule mita.Schedule, maxDelay time.Duration) mita.Schedule {
+	return &jitterSchedule{Schedule: schedule, maxDelay: maxDelay}
+}
+
+// triggerKey is the key of the trigger of a run in the context of the task, once it is known, see tellTrigger
+type triggerKey struct{}
+
+// withJitter waits a random offset up to the jitter of the task before a scheduled run
+// The trigger is told before waiting, as a delayed run no longer starts on a tick of the schedule.
+func (m *Manager) withJitter(stats *taskStats, task mita.Task) mita.Task {
+	return func(ctx context.Context) error {
+		ctx, trigger := m.tellTrigger(ctx, stats)
+		if trigger != TriggerSchedule {
+			return task(ctx)
+		}
+
+		delay := time.Duration(rand.Int64N(int64(stats.options.jitter) + 1))
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("task.jitter_ms", delay.Milliseconds()))
+		select {
+		case <-m.clock.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.stopped:
+			// The run is dropped like the ones that didn't start before the manager stopped
+			return nil
+		}
+		return task(ctx)
+	}
+}
+
+// tellTrigger tells the trigger of a run before it waits, and stores it in the context of the run with its args
+func (m *Manager) tellTrigger(ctx context.Context, stats *taskStats) (context.Context, string) {
+	if trigger, ok := ctx.Value(triggerKey{}).(string); ok {
+		return ctx, trigger
+	}
+	trigger, args := m.trigger(stats)
+	if args != nil {
+		ctx = context.WithValue(ctx, argsKey{}, args)
+	}
+	return context.WithValue(ctx, triggerKey{}, trigger), trigger
+}
+
+// runTrigger tells the trigger of a run, see trigger, unless it was told before the run waited, see tellTrigger
+func (m *Manager) runTrigger(ctx context.Context, stats *taskStats) string {
+	if trigger, ok := ctx.Value(triggerKey{}).(string); ok {
+		return trigger
+	}
+	trigger, _ := m.trigger(stats)
+	return trigger
+}
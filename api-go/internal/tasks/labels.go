@@ -0,0 +1,65 @@
+package tasks
+
+import (
+	"slices"
+)
+
+// WithLabels attaches labels to the task, e.g. WithLabels("maintenance", "db"), to list the tasks by label and
+// aggregate their statistics, see ListTasks and GetStats
+// The labels add up with the ones given before, e.g. by SetDefaultOptions.
+func WithLabels(labels ...string) TaskOption {
+	return func(o *taskOptions) {
+		for _, label := range labels {
+			if label != "" && !slices.Contains(o.labels, label) {
+				o.labels = append(o.labels, label)
+			}
+		}
+	}
+}
+
+// LabelStats are the statistics of the tasks with a label, see GetStats
+type LabelStats struct {
+	Tasks      int   `json:"tasks"`
+	Enabled    int   `json:"enabled"`
+	Running    int   `json:"running"`
+	RunCount   int64 `json:"run_count"`
+	ErrorCount int64 `json:"error_count"`
+	Skipped    int64 `json:"skipped"`
+}
+
+// hasLabels tells whether a task has all the labels
+func hasLabels(task *TaskInfo, labels []string) bool {
+	for _, label := range labels {
+		if !slices.Contains(task.Labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// labelStats aggregates the statistics of the tasks by label
+func labelStats(tasks []*TaskInfo) map[string]LabelStats {
+	stats := make(map[string]LabelStats)
+	for _, task := range tasks {
+		for _, label := range task.Labels {
+			s := stats[label]
+			s.add(task)
+			stats[label] = s
+		}
+	}
+	return stats
+}
+
+// add counts a task in the statistics
+func (s *LabelStats) add(task *TaskInfo) {
+	s.Tasks++
+	if task.Enabled {
+		s.Enabled++
+	}
+	if task.Running {
+		s.Running++
+	}
+	s.RunCount += task.RunCount
+	s.ErrorCount += task.ErrorCount
+	s.Skipped += task.Skipped
+}
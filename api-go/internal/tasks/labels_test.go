@@ -0,0 +1,56 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/cymoo/mita"
+)
+
+func TestWithLabels(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	noop := func(ctx context.Context) error { return nil }
+	m.SetDefaultOptions(WithLabels("maintenance"))
+	m.AddTask("purge", mita.Every().Day(), noop, WithLabels("db", "maintenance"))
+	m.AddTask("reindex", mita.Every().Day(), noop, WithLabels("search"))
+	m.AddTask("vacuum", mita.Every().Day(), noop, WithLabels("db"))
+	m.DisableTask("vacuum")
+
+	if info, _ := m.GetTask("purge"); !slices.Equal(info.Labels, []string{"maintenance", "db"}) {
+		t.Errorf("expected the labels to add up without duplicates, got %v", info.Labels)
+	}
+	names := func(tasks []*TaskInfo) []string {
+		var names []string
+		for _, task := range tasks {
+			names = append(names, task.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+	if got := names(m.ListTasks("maintenance", "db")); !slices.Equal(got, []string{"purge", "vacuum"}) {
+		t.Errorf("expected the tasks with both labels, got %v", got)
+	}
+	if got := names(m.ListTasks("search", "db")); got != nil {
+		t.Errorf("expected no task with both labels, got %v", got)
+	}
+
+	stats := m.GetStats()["task_labels"].(map[string]LabelStats)
+	if db := stats["db"]; db.Tasks != 2 || db.Enabled != 1 {
+		t.Errorf("expected 2 tasks with the db label, 1 enabled, got %+v", db)
+	}
+	if stats["maintenance"].Tasks != 3 || stats["search"].Tasks != 1 {
+		t.Errorf("unexpected statistics by label: %+v", stats)
+	}
+
+	rec := httptest.NewRecorder()
+	m.APIHandler("/api").ServeHTTP(rec, httptest.NewRequest("GET", "/api/tasks?label=db&label=maintenance", nil))
+	var statuses []TaskStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil || len(statuses) != 2 || statuses[0].Name != "purge" {
+		t.Errorf("expected the tasks with the labels, got %d %s", rec.Code, rec.Body)
+	}
+}
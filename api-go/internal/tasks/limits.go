@@ -0,0 +1,163 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+var (
+	// errDailyLimit is the reason of the runs skipped once a task ran as many times as allowed in a day
+	errDailyLimit = errors.New("the task ran as many times as allowed today")
+	// errQuietHours is the reason of the runs skipped during the quiet hours of a task
+	errQuietHours = errors.New("the task doesn't run during its quiet hours")
+	// errRunDays is the reason of the runs skipped on the days a task doesn't run
+	errRunDays = errors.New("the task doesn't run on this day")
+)
+
+// WithDailyLimit runs the task at most limit times a day, e.g. for a task calling a rate-limited API
+// The runs due afterwards are skipped until midnight, added to the history of the task. The runs started with
+// RunTaskNow still start, and count.
+func WithDailyLimit(limit int) TaskOption {
+	return func(o *taskOptions) {
+		o.dailyLimit = max(limit, 0)
+	}
+}
+
+// WithQuietHours skips the runs due from the time of day from until to, as durations since midnight, e.g.
+// WithQuietHours(22*time.Hour, 6*time.Hour) never runs the task between 22:00 and 06:00
+// The runs skipped are added to the history of the task, the runs started with RunTaskNow still start. Each call adds
+// a window to the ones of the task, see WithDeferredRuns to run the task once a window ends instead.
+func WithQuietHours(from, to time.Duration) TaskOption {
+	return func(o *taskOptions) {
+		o.quietHours = append(o.quietHours, [2]time.Duration{from % (24 * time.Hour), to % (24 * time.Hour)})
+	}
+}
+
+// WithRunDays skips the runs due on the other days of the week, like the quiet hours, e.g.
+// WithRunDays(time.Saturday, time.Sunday) for a task that only runs on weekends, see WithBusinessDays
+func WithRunDays(days ...time.Weekday) TaskOption {
+	return func(o *taskOptions) {
+		o.runDays = slices.Clone(days)
+	}
+}
+
+// WithBusinessDays skips the runs due on Saturdays and Sundays, like WithRunDays from Monday to Friday
+func WithBusinessDays() TaskOption {
+	return WithRunDays(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday)
+}
+
+// WithDeferredRuns defers the runs due during the quiet hours of the task or on the days it doesn't run to the end of
+// the window instead of skipping them, e.g. a sync every 10 minutes runs once at 06:00 after quiet hours ending then
+// The deferred run waits as a running run, so that the ones due meanwhile are skipped by mita as overlapping.
+func WithDeferredRuns() TaskOption {
+	return func(o *taskOptions) {
+		o.deferRuns = true
+	}
+}
+
+// dailyRuns counts the runs of a task in a day
+type dailyRuns struct {
+	// day is the date of the runs, midnight in the location of the clock
+	day  time.Time
+	runs int
+}
+
+// quiet tells whether a time of day is in the quiet hours, which may go past midnight
+func quiet(hours [2]time.Duration, now time.Time) bool {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	t := now.Sub(midnight)
+	from, to := hours[0], hours[1]
+	if from <= to {
+		return from <= t && t < to
+	}
+	return t >= from || t < to
+}
+
+// blackout tells whether a time is in a quiet window of a task or on a day it doesn't run, with the reason and the end
+// of the window, nil outside of them
+func blackout(o *taskOptions, t time.Time) (time.Time, error) {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if o.runDays != nil && !slices.Contains(o.runDays, t.Weekday()) {
+		return midnight.AddDate(0, 0, 1), errRunDays
+	}
+	for _, hours := range o.quietHours {
+		if !quiet(hours, t) {
+			continue
+		}
+		end := midnight.Add(hours[1])
+		if !end.After(t) {
+			end = midnight.AddDate(0, 0, 1).Add(hours[1])
+		}
+		return end, errQuietHours
+	}
+	return time.Time{}, nil
+}
+
+// nextAllowed returns the first time from t out of the windows of a task, see blackout
+func nextAllowed(o *taskOptions, t time.Time) time.Time {
+	// Windows following each other, e.g. quiet hours ending on a day the task doesn't run, are crossed one at a time,
+	// a bound keeps windows covering the whole week from looping forever
+	for range 64 {
+		end, reason := blackout(o, t)
+		if reason == nil {
+			break
+		}
+		t = end
+	}
+	return t
+}
+
+// withLimits skips the runs not started with RunTaskNow during the quiet hours of the task, on the days it doesn't
+// run, or once it ran as many times as allowed in the day, see WithQuietHours, WithRunDays and WithDailyLimit
+// The runs due in a window wait for its end instead with WithDeferredRuns.
+func (m *Manager) withLimits(name string, stats *taskStats, task mita.Task) mita.Task {
+	return func(ctx context.Context) error {
+		ctx, trigger := m.tellTrigger(ctx, stats)
+		now := m.clock.Now()
+		if _, reason := blackout(&stats.options, now); reason != nil && trigger != TriggerManual && stats.options.deferRuns {
+			until := nextAllowed(&stats.options, now)
+			m.logger.Info("run deferred to the end of its window", "task", name, "run_id", GetRunID(ctx),
+				"until", until, "reason", reason)
+			select {
+			case <-m.clock.After(until.Sub(now)):
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-m.stopped:
+				return nil
+			}
+			now = m.clock.Now()
+		}
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+		var reason error
+		m.mu.Lock()
+		if !stats.today.day.Equal(day) {
+			stats.today = dailyRuns{day: day}
+		}
+		if trigger != TriggerManual {
+			if limit := stats.options.dailyLimit; limit > 0 && stats.today.runs >= limit {
+				reason = errDailyLimit
+			} else if _, blackedOut := blackout(&stats.options, now); blackedOut != nil {
+				reason = blackedOut
+			}
+		}
+		if reason == nil {
+			stats.today.runs++
+		} else {
+			stats.skipped++
+		}
+		m.mu.Unlock()
+
+		if reason == nil {
+			return task(ctx)
+		}
+		stats.history.Push(TaskRun{ID: GetRunID(ctx), Start: now, End: now, Trigger: trigger, Error: reason.Error()})
+		setOutcome(ctx, outcomeSkipped)
+		m.callHooks(name, GetRunID(ctx), stats, stageSkipped, reason)
+		return nil
+	}
+}
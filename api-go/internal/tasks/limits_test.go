@@ -0,0 +1,193 @@
+package tasks
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+func TestWithDailyLimit(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 6, 15, 0, 30, 0, 0, time.Local))
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	var runs atomic.Int32
+	m.AddTask("poll", mita.Every().Hour(), func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}, WithDailyLimit(2))
+
+	for range 3 {
+		if _, err := m.FireNext("poll"); err != nil {
+			t.Fatalf("FireNext failed: %v", err)
+		}
+		waitIdle(t, m, "poll")
+	}
+	history, _ := m.GetTaskHistory("poll")
+	if runs.Load() != 2 || history[0].Error != errDailyLimit.Error() {
+		t.Errorf("expected the third run of the day to be skipped, got %d runs and %+v", runs.Load(), history)
+	}
+	if info, _ := m.GetTask("poll"); info.Skipped != 1 {
+		t.Errorf("expected one skipped run, got %d", info.Skipped)
+	}
+
+	// A manual run still starts
+	m.RunTaskNow("poll")
+	waitIdle(t, m, "poll")
+	if runs.Load() != 3 {
+		t.Errorf("expected the manual run to start, got %d runs", runs.Load())
+	}
+
+	// The limit starts over the next day
+	clock.Set(time.Date(2024, 6, 15, 23, 30, 0, 0, time.Local))
+	if _, err := m.FireNext("poll"); err != nil {
+		t.Fatalf("FireNext failed: %v", err)
+	}
+	waitIdle(t, m, "poll")
+	if runs.Load() != 4 {
+		t.Errorf("expected a run the next day, got %d runs", runs.Load())
+	}
+}
+
+func TestWithQuietHours(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 6, 15, 21, 30, 0, 0, time.Local))
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	var runs atomic.Int32
+	m.AddTask("sync", mita.Every().Hour(), func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}, WithQuietHours(22*time.Hour, 6*time.Hour))
+
+	// 22:00 and 23:00 are quiet, 06:00 isn't
+	for i, want := range []int32{0, 0, 1} {
+		if i == 2 {
+			clock.Set(time.Date(2024, 6, 16, 5, 30, 0, 0, time.Local))
+		}
+		if _, err := m.FireNext("sync"); err != nil {
+			t.Fatalf("FireNext failed: %v", err)
+		}
+		waitIdle(t, m, "sync")
+		if runs.Load() != want {
+			t.Errorf("at %v: expected %d runs, got %d", clock.Now(), want, runs.Load())
+		}
+	}
+	history, _ := m.GetTaskHistory("sync")
+	if len(history) != 3 || history[2].Error != errQuietHours.Error() || history[0].Error != "" {
+		t.Errorf("expected the quiet runs to be skipped, got %+v", history)
+	}
+
+	m.RunTaskNow("sync")
+	waitIdle(t, m, "sync")
+	if runs.Load() != 2 {
+		t.Errorf("expected the manual run to start, got %d runs", runs.Load())
+	}
+}
+
+func TestWithRunDays(t *testing.T) {
+	// A Friday
+	clock := NewFakeClock(time.Date(2024, 6, 14, 12, 0, 0, 0, time.Local))
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	var runs atomic.Int32
+	m.AddTask("report", mita.Every().Day().At(9, 0), func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}, WithBusinessDays())
+
+	// Saturday and Sunday are skipped, Monday isn't
+	for i, want := range []int32{0, 0, 1} {
+		if _, err := m.FireNext("report"); err != nil {
+			t.Fatalf("FireNext failed: %v", err)
+		}
+		waitIdle(t, m, "report")
+		if runs.Load() != want {
+			t.Errorf("run %d on %v: expected %d runs, got %d", i, clock.Now().Weekday(), want, runs.Load())
+		}
+	}
+	history, _ := m.GetTaskHistory("report")
+	if len(history) != 3 || history[2].Error != errRunDays.Error() {
+		t.Errorf("expected the runs of the weekend to be skipped, got %+v", history)
+	}
+}
+
+func TestWithDeferredRuns(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 6, 15, 21, 30, 0, 0, time.Local))
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	var runs atomic.Int32
+	m.AddTask("sync", mita.Every().Hour(), func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}, WithQuietHours(22*time.Hour, 6*time.Hour), WithQuietHours(12*time.Hour, 13*time.Hour), WithDeferredRuns())
+
+	// The run due at 22:00 waits for 06:00
+	if _, err := m.FireNext("sync"); err != nil {
+		t.Fatalf("FireNext failed: %v", err)
+	}
+	if err := clock.BlockUntil(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := m.GetTask("sync"); !info.Running || runs.Load() != 0 {
+		t.Fatalf("expected the run to wait for the end of the quiet hours, got running %v and %d runs", info.Running, runs.Load())
+	}
+	clock.Set(time.Date(2024, 6, 16, 6, 0, 0, 0, time.Local))
+	waitIdle(t, m, "sync")
+	if runs.Load() != 1 {
+		t.Fatalf("expected the deferred run at 06:00, got %d runs", runs.Load())
+	}
+	history, _ := m.GetTaskHistory("sync")
+	if len(history) != 1 || history[0].Error != "" || history[0].Trigger != TriggerSchedule {
+		t.Errorf("expected a scheduled run in the history, got %+v", history)
+	}
+}
+
+func TestNextAllowed(t *testing.T) {
+	at := func(day, h int) time.Time { return time.Date(2024, 6, day, h, 0, 0, 0, time.UTC) }
+	o := &taskOptions{
+		quietHours: [][2]time.Duration{{22 * time.Hour, 6 * time.Hour}, {6 * time.Hour, 8 * time.Hour}},
+		runDays:    []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	}
+	tests := []struct {
+		from, want time.Time
+	}{
+		// Wednesday
+		{at(12, 12), at(12, 12)},
+		{at(12, 23), at(13, 8)},
+		{at(12, 5), at(12, 8)},
+		// Friday night goes past the weekend
+		{at(14, 23), at(17, 8)},
+	}
+	for _, tt := range tests {
+		if got := nextAllowed(o, tt.from); !got.Equal(tt.want) {
+			t.Errorf("nextAllowed(%v) = %v; want %v", tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	day := func(h, min int) time.Time { return time.Date(2024, 6, 15, h, min, 0, 0, time.UTC) }
+	tests := []struct {
+		hours [2]time.Duration
+		now   time.Time
+		want  bool
+	}{
+		{[2]time.Duration{22 * time.Hour, 6 * time.Hour}, day(23, 0), true},
+		{[2]time.Duration{22 * time.Hour, 6 * time.Hour}, day(5, 59), true},
+		{[2]time.Duration{22 * time.Hour, 6 * time.Hour}, day(6, 0), false},
+		{[2]time.Duration{22 * time.Hour, 6 * time.Hour}, day(12, 0), false},
+		{[2]time.Duration{12 * time.Hour, 13*time.Hour + 30*time.Minute}, day(13, 15), true},
+		{[2]time.Duration{12 * time.Hour, 13*time.Hour + 30*time.Minute}, day(13, 30), false},
+	}
+	for _, tt := range tests {
+		if got := quiet(tt.hours, tt.now); got != tt.want {
+			t.Errorf("quiet(%v, %v) = %v; want %v", tt.hours, tt.now.Format("15:04"), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/cymoo/mita"
+	"github.com/cymoo/mote/pkg/util/safego"
+	"github.com/redis/go-redis/v9"
+)
+
+// lockTTL is how long the lock of a task is held if the instance running it stops renewing it
+const lockTTL = 30 * time.Second
+
+// lockHold is how long after a run started its lock is held at least, so that an instance
+// whose clock is a bit late doesn't run the same tick once the lock is released
+const lockHold = 5 * time.Second
+
+// locker takes the per-task locks shared by the instances of the app
+type locker interface {
+	// acquire takes the lock of a task for ttl, it returns false if another instance holds it
+	acquire(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+	// renew extends the lock for ttl, it returns false if the lock was lost
+	renew(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+	// release gives the lock back once hold is over, right away if hold is not positive
+	release(ctx context.Context, name, token string, hold time.Duration) error
+}
+
+// WithDistributedLock runs the task on only one instance of the app at a time, e.g. once per tick with replicas
+// A run takes a lock in Redis first and is skipped if another instance holds it. The lock expires
+// unless renewed while the task runs, so that it isn't held forever by an instance that went away.
+func WithDistributedLock(client *redis.Client) TaskOption {
+	return withLocker(&redisLocker{client: client, prefix: "tasks:lock:"})
+}
+
+func withLocker(l locker) TaskOption {
+	return func(o *taskOptions) {
+		o.locker = l
+	}
+}
+
+// renewLockScript extends a lock if it is still held with the given token
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLockScript deletes a lock held with the given token, or lets it expire after the given milliseconds
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return redis.call("DEL", KEYS[1])
+`)
+
+// redisLocker keeps the locks of tasks in Redis, one key per task holding the token of its owner
+type redisLocker struct {
+	client *redis.Client
+	prefix string
+}
+
+func (l *redisLocker) acquire(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	return l.client.SetNX(ctx, l.prefix+name, token, ttl).Result()
+}
+
+func (l *redisLocker) renew(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	renewed, err := renewLockScript.Run(ctx, l.client, []string{l.prefix + name}, token, ttl.Milliseconds()).Int()
+	return renewed == 1, err
+}
+
+func (l *redisLocker) release(ctx context.Context, name, token string, hold time.Duration) error {
+	return releaseLockScript.Run(ctx, l.client, []string{l.prefix + name}, token, max(hold.Milliseconds(), 0)).Err()
+}
+
+// withLock runs the task only if its lock is acquired, renewing the lock while the task runs
+// A skipped run isn't added to the history, and the task is cancelled if its lock is lost.
+func (m *Manager) withLock(name string, stats *taskStats, task mita.Task) mita.Task {
+	lock := stats.options.locker
+	return func(ctx context.Context) error {
+		start := m.clock.Now()
+		token := newLockToken()
+		acquired, err := lock.acquire(ctx, name, token, lockTTL)
+		if err != nil {
+			// The run may have been started with RunTaskNow, which mustn't mark the next run as manual
+			m.runTrigger(ctx, stats)
+			err = fmt.Errorf("error acquiring the lock: %w", err)
+			m.callHooks(name, GetRunID(ctx), stats, stageFailure, err)
+			return err
+		}
+		if !acquired {
+			m.skipRun(ctx, name, stats)
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		renewed := make(chan struct{})
+		safego.Go("renew-task-lock", func() {
+			defer close(renewed)
+			for {
+				select {
+				case <-m.clock.After(lockTTL / 3):
+					ok, err := lock.renew(ctx, name, token, lockTTL)
+					if err == nil && !ok {
+						m.logger.Warn("task lost its lock, cancelling it", "task", name, "run_id", GetRunID(ctx))
+						cancel()
+						return
+					}
+					if err != nil {
+						m.logger.Error("error renewing the lock of a task", "task", name, "run_id", GetRunID(ctx), "error", err)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+
+		defer func() {
+			cancel()
+			<-renewed
+			if err := lock.release(context.Background(), name, token, lockHold-m.clock.Now().Sub(start)); err != nil {
+				m.logger.Error("error releasing the lock of a task", "task", name, "run_id", GetRunID(ctx), "error", err)
+			}
+		}()
+		return task(ctx)
+	}
+}
+
+// skipRun counts a run skipped because another instance holds the lock of the task
+func (m *Manager) skipRun(ctx context.Context, name string, stats *taskStats) {
+	// The run may have been started with RunTaskNow, which mustn't mark the next run as manual
+	m.runTrigger(ctx, stats)
+
+	m.mu.Lock()
+	stats.skipped++
+	m.mu.Unlock()
+
+	setOutcome(ctx, outcomeSkipped)
+
+	m.callHooks(name, GetRunID(ctx), stats, stageSkipped, errLockHeld)
+}
+
+// newLockToken returns a random token telling the instance holding a lock
+func newLockToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,65 @@
+package tasks
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"regexp"
+)
+
+// Logger logs the events of the Manager with a level and key/value fields, *slog.Logger is one
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// WithLogger logs the events of the Manager and the messages of mita to the logger instead of slog.Default()
+func (m *Manager) WithLogger(logger Logger) *Manager {
+	if logger != nil {
+		m.logger = logger
+	}
+	return m
+}
+
+// mitaTaskName matches the name of the task in a message of mita, e.g. "Task 'sync' failed after 2s: timeout"
+var mitaTaskName = regexp.MustCompile(`(?i)task '([^']+)'`)
+
+// mitaWriter passes the messages mita prints to the logger of the Manager, with the name of their task as a field
+// The messages telling that a run completed or failed have the ID of the run that just ended as well. mita logs them
+// right after the run, unless two runs of the task end at once the ID is the one of the run.
+type mitaWriter struct {
+	m *Manager
+}
+
+// newMitaLogger creates the *log.Logger given to mita
+func newMitaLogger(m *Manager) *log.Logger {
+	return log.New(mitaWriter{m}, "", 0)
+}
+
+func (w mitaWriter) Write(p []byte) (int, error) {
+	msg := string(bytes.TrimSpace(p))
+	var args []any
+	if match := mitaTaskName.FindStringSubmatch(msg); match != nil {
+		args = append(args, "task", match[1])
+		if bytes.Contains(p, []byte(" completed ")) || bytes.Contains(p, []byte(" failed ")) {
+			if id, ok := w.m.endedRuns.Load(match[1]); ok {
+				args = append(args, "run_id", id)
+			}
+		}
+	}
+	args = append(args, "source", "mita")
+
+	switch {
+	case bytes.Contains(p, []byte(" failed ")):
+		w.m.logger.Error(msg, args...)
+	case bytes.Contains(p, []byte("Timeout")), bytes.Contains(p, []byte("already running")):
+		w.m.logger.Warn(msg, args...)
+	default:
+		w.m.logger.Info(msg, args...)
+	}
+	return len(p), nil
+}
+
+var _ Logger = (*slog.Logger)(nil)
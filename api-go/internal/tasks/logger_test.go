@@ -0,0 +1,92 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+// syncBuffer is a buffer written by the runs and read by the test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// records returns the JSON records logged
+func (b *syncBuffer) records(t *testing.T) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for line := range strings.SplitSeq(strings.TrimSpace(b.buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestWithLogger(t *testing.T) {
+	var out syncBuffer
+	m := NewManager().WithLogger(slog.New(slog.NewJSONHandler(&out, nil)))
+	defer m.Stop()
+
+	var id atomic.Value
+	m.AddTask("flaky", mita.Every().Day(), func(ctx context.Context) error {
+		id.Store(GetRunID(ctx))
+		return errors.New("boom")
+	}, WithRetry(2, time.Millisecond))
+	m.RunTaskNow("flaky")
+	waitIdle(t, m, "flaky")
+	// mita logs the end of the run once it is over
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(out.String(), `"level":"ERROR"`) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	var added, retried, failed bool
+	for _, record := range out.records(t) {
+		if record["task"] != "flaky" {
+			continue
+		}
+		msg := record["msg"].(string)
+		switch {
+		case strings.Contains(msg, "added with schedule"):
+			added = record["level"] == "INFO" && record["source"] == "mita"
+		case msg == "task failed, retrying":
+			retried = record["level"] == "WARN" && record["attempt"] == 1.0 && record["error"] == "boom" &&
+				record["run_id"] == id.Load()
+		case strings.Contains(msg, "failed after"):
+			failed = record["level"] == "ERROR" && record["run_id"] == id.Load()
+		}
+	}
+	if id.Load() == "" {
+		t.Error("expected the run to have an ID in its context")
+	}
+	if !added || !retried || !failed {
+		t.Errorf("expected the events with their level and fields, got added %v, retried %v, failed %v: %s",
+			added, retried, failed, out.String())
+	}
+}
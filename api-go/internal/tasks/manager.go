@@ -0,0 +1,697 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cymoo/mita"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/pkg/util/ring"
+	"github.com/cymoo/mote/pkg/util/safego"
+	"github.com/robfig/cron/v3"
+)
+
+// defaultHistorySize is the number of runs kept in the history of a task
+const defaultHistorySize = 20
+
+// scheduleTolerance is how late after a tick of its schedule a run still counts as scheduled
+const scheduleTolerance = 2 * time.Second
+
+// scheduleParser parses schedules like mita, with seconds
+var scheduleParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Triggers of a task run
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Manager schedules the tasks of the app on a mita.TaskManager
+// It adds per-task options that mita doesn't have, applied by decorating the task when it is added,
+// and keeps the statistics these options produce next to the ones of mita
+type Manager struct {
+	*mita.TaskManager
+
+	mu    sync.RWMutex
+	stats map[string]*taskStats
+	// defaults are the options of every task added, see SetDefaultOptions
+	defaults []TaskOption
+	// groups are the semaphores of the groups of tasks, see WithGroup
+	groups map[string]*semaphore
+	// workers are the slots of the runs of the tasks without a group with a limit, created with workerLimit slots
+	// once such a task is added, see WithWorkers
+	workers     *semaphore
+	workerLimit int
+	// queueCapacity bounds the runs waiting for a slot of each group and of the workers, queuePolicy tells what a run
+	// coming to a full queue does and queueTimeout how long it waits for a place at most, see WithQueue
+	queueCapacity int
+	queuePolicy   QueuePolicy
+	queueTimeout  time.Duration
+	// dependents are the names of the tasks running after each task, see After
+	dependents map[string][]string
+	// hooks are called around the runs of all tasks, see AddHooks
+	hooks []Hooks
+	// clock tells the time, see WithClock
+	clock Clock
+	// logger logs the events of the Manager and the messages of mita, see WithLogger
+	logger Logger
+	// endedRuns holds the ID of the last run of each task that ended, by name, see withRunID
+	endedRuns sync.Map
+	// events tells the starts and ends of the runs to the event stream, see APIHandler
+	events eventBroker
+	// started tells whether Start was called, after which the tasks added with an interval tick right away
+	started bool
+	// paused tells whether the runs of the tasks are skipped, see Pause
+	paused bool
+	// standardCron reads the cron expressions as five fields, see WithStandardCron
+	standardCron bool
+
+	// store saves the state of the tasks, see Persist, right away once stateChanged is told
+	store        StateStore
+	stateChanged chan struct{}
+	stopped      chan struct{}
+	stopOnce     sync.Once
+	persisting   sync.WaitGroup
+	// inflight counts the runs in progress, that StopContext waits for up to shutdownTimeout from Stop
+	inflight        runCounter
+	shutdownTimeout time.Duration
+}
+
+// TaskInfo is the state of a task, with the statistics kept by the Manager
+type TaskInfo struct {
+	*mita.TaskInfo
+	// MaxAttempts is the number of attempts of a run, 1 without a retry policy
+	MaxAttempts int
+	// Retries is the total number of attempts made after a failed one
+	Retries int64
+	// LastAttempts is the number of attempts of the latest run
+	LastAttempts int
+	// Skipped is the number of runs skipped because another instance held the lock of the task
+	Skipped int64
+	// Durations are the statistics of the durations of the runs since the start of the Manager
+	Durations DurationStats
+	// Labels are the labels of the task, see WithLabels
+	Labels []string
+	// Group is the group of the task, if any, and GroupLimit the number of its runs in progress at a time, see
+	// WithGroup
+	Group      string
+	GroupLimit int
+	// TrippedUntil is the end of the cooldown of a task disabled by its circuit breaker, zero otherwise, see
+	// WithCircuitBreaker
+	TrippedUntil time.Time
+}
+
+// TaskRun is a finished run of a task, kept in its history
+type TaskRun struct {
+	ID       string    `json:"id"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration int64     `json:"duration"` // in milliseconds
+	// Trigger is TriggerSchedule, TriggerManual or TriggerUpstream
+	Trigger  string `json:"trigger"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// taskStats holds the options of a task and the statistics of its runs
+type taskStats struct {
+	options      taskOptions
+	retries      int64
+	lastAttempts int
+	skipped      int64
+	history      *ring.Buffer[TaskRun]
+	durations    *durationStats
+	// schedule is the parsed schedule of the task, nil if mita accepts it but the parser here doesn't
+	schedule cron.Schedule
+	// manualRuns is the number of runs started with RunTaskNow that haven't begun yet
+	manualRuns int
+	// manualArgs are the args of these runs in the order they were started, nil for the ones without
+	manualArgs []map[string]any
+	// upstreamRuns is the number of runs started by the upstream task that haven't begun yet
+	upstreamRuns int
+	// timed is the schedule of a task timed by the Manager instead of mita, e.g. an interval, see Schedule
+	timed Schedule
+	// timedRuns is the number of runs started by a tick of that schedule that haven't begun yet
+	timedRuns int
+	// nextRun is the next tick of that schedule
+	nextRun time.Time
+	// runs is the number of runs since the start of the Manager, the skipped ones excluded
+	runs int64
+	// today counts the runs of the day, for the daily limit of the task
+	today dailyRuns
+	// failures is the number of runs in a row that failed, for the circuit breaker of the task
+	failures int
+	// trips is the number of times the circuit breaker tripped, trippedUntil the end of its last cooldown, zero once
+	// the task is enabled again
+	trips        int64
+	trippedUntil time.Time
+	// completed receives the end of the runs of a task whose interval counts from them
+	completed chan struct{}
+	// restored is the state saved before the last restart
+	restored models.TaskState
+	// task and opts are the ones the task was added with, to add it again with another schedule
+	task mita.Task
+	opts []TaskOption
+}
+
+type taskOptions struct {
+	maxAttempts int
+	backoff     time.Duration
+	historySize int
+	// locker is nil unless the task runs on one instance at a time
+	locker locker
+	// after is the task this one runs after, if any
+	after string
+	// jitter is the maximum random delay of scheduled runs
+	jitter time.Duration
+	// group is the name of the group of tasks sharing a semaphore of groupLimit slots, if any
+	group      string
+	groupLimit int
+	// priority orders the runs waiting for a slot of the group, see WithPriority
+	priority int
+	hooks    []Hooks
+	// dailyLimit is the maximum number of runs a day, 0 for no limit, see WithDailyLimit
+	dailyLimit int
+	// quietHours are the windows of times of day the task doesn't run during, see WithQuietHours
+	quietHours [][2]time.Duration
+	// runDays are the days of the week the task runs on, nil for all, see WithRunDays
+	runDays []time.Weekday
+	// deferRuns defers the runs due in the windows above to their end instead of skipping them, see WithDeferredRuns
+	deferRuns bool
+	// maxRuns is the number of runs after which the task is disabled, 0 for no limit, see WithMaxRuns
+	maxRuns int
+	// expiry is the time after which the task is disabled, zero for none, see WithExpiry
+	expiry time.Time
+	// labels are the labels of the task, see WithLabels
+	labels []string
+	// failureThreshold is the number of failed runs in a row that disables the task for cooldown, 0 for none,
+	// see WithCircuitBreaker
+	failureThreshold int
+	cooldown         time.Duration
+}
+
+// TaskOption configures a task added to the Manager
+type TaskOption func(*taskOptions)
+
+// WithRetry retries a failed run until it succeeds or maxAttempts attempts were made
+// The first retry waits backoff, and each next one waits twice as long as the previous one.
+// A run only counts as failed, with the error of its last attempt, once all attempts failed.
+func WithRetry(maxAttempts int, backoff time.Duration) TaskOption {
+	return func(o *taskOptions) {
+		o.maxAttempts = max(maxAttempts, 1)
+		o.backoff = max(backoff, 0)
+	}
+}
+
+// WithHistorySize keeps the last size runs of the task instead of the default 20
+func WithHistorySize(size int) TaskOption {
+	return func(o *taskOptions) {
+		o.historySize = max(size, 0)
+	}
+}
+
+// NewManager creates a Manager on top of a new mita.TaskManager
+func NewManager(opts ...mita.Option) *Manager {
+	m := &Manager{
+		stats:      make(map[string]*taskStats),
+		groups:     make(map[string]*semaphore),
+		dependents: make(map[string][]string),
+		clock:      realClock{},
+		logger:     slog.Default(),
+		stopped:    make(chan struct{}),
+
+		workerLimit:   defaultWorkers,
+		queueCapacity: defaultQueueCapacity,
+		queueTimeout:  defaultQueueTimeout,
+
+		stateChanged:    make(chan struct{}, 1),
+		shutdownTimeout: defaultShutdownTimeout,
+	}
+	// The messages of mita go to the logger of the Manager, unless a logger is given to mita
+	m.TaskManager = mita.New(append([]mita.Option{mita.WithLogger(newMitaLogger(m))}, opts...)...)
+	return m
+}
+
+// SetDefaultOptions sets options given to every task added afterwards, before the options of the task
+func (m *Manager) SetDefaultOptions(opts ...TaskOption) {
+	m.mu.Lock()
+	m.defaults = opts
+	m.mu.Unlock()
+}
+
+// AddTask registers a task with the given name, schedule and options
+// The schedule is run by mita from its cron expression, unless it tells its ticks itself, see Schedule.
+func (m *Manager) AddTask(name string, schedule mita.Schedule, task mita.Task, opts ...TaskOption) error {
+	m.mu.RLock()
+	opts = append(append([]TaskOption{}, m.defaults...), opts...)
+	m.mu.RUnlock()
+
+	schedule, err := m.normalizeSchedule(schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for task '%s': %w", name, err)
+	}
+	stats := newTaskStats(task, opts)
+	stats.history = ring.New[TaskRun](stats.options.historySize)
+	if upstream := stats.options.after; upstream != "" {
+		m.mu.RLock()
+		_, ok := m.stats[upstream]
+		m.mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("task '%s' runs after '%s', which must be added first", name, upstream)
+		}
+	}
+	if err := m.addTask(name, schedule, stats); err != nil {
+		return err
+	}
+
+	if upstream := stats.options.after; upstream != "" {
+		m.mu.Lock()
+		m.dependents[upstream] = append(m.dependents[upstream], name)
+		m.mu.Unlock()
+	}
+	m.publishTask(name, EventAdded)
+	return nil
+}
+
+// RescheduleTask replaces the schedule of a task, keeping its statistics, its history and whether it is enabled
+// mita can't change the schedule of a task, so the task is added to it again: the counters of mita are then kept
+// like the ones restored after a restart. A run in progress goes on.
+func (m *Manager) RescheduleTask(name string, schedule mita.Schedule) error {
+	m.mu.RLock()
+	old, ok := m.stats[name]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("task '%s' not found", name)
+	}
+	// The task is only removed from mita once the schedule is known to be valid
+	schedule, err := m.normalizeSchedule(schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for task '%s': %w", name, err)
+	}
+	if err := checkSchedule(schedule, old.options.after); err != nil {
+		return fmt.Errorf("invalid schedule for task '%s': %w", name, err)
+	}
+	info, err := m.TaskManager.GetTask(name)
+	if err != nil {
+		return err
+	}
+
+	stats := newTaskStats(old.task, old.opts)
+	m.mu.RLock()
+	stats.retries, stats.lastAttempts, stats.skipped = old.retries, old.lastAttempts, old.skipped
+	stats.manualRuns, stats.manualArgs, stats.upstreamRuns = old.manualRuns, old.manualArgs, old.upstreamRuns
+	stats.history, stats.durations, stats.today = old.history, old.durations, old.today
+	stats.runs = old.runs
+	stats.failures, stats.trips, stats.trippedUntil = old.failures, old.trips, old.trippedUntil
+	stats.restored = old.restored
+	m.mu.RUnlock()
+	stats.restored.RunCount += info.RunCount
+	stats.restored.ErrorCount += info.ErrorCount
+	if !info.LastRun.IsZero() {
+		stats.restored.LastRun = models.NullInt64{NullInt64: sql.NullInt64{Int64: info.LastRun.UnixMilli(), Valid: true}}
+		stats.restored.LastError = info.LastError
+	}
+
+	if err := m.TaskManager.RemoveTask(name); err != nil {
+		return err
+	}
+	if err := m.addTask(name, schedule, stats); err != nil {
+		return err
+	}
+	if !info.Enabled {
+		return m.TaskManager.DisableTask(name)
+	}
+	return nil
+}
+
+// checkSchedule tells whether mita, or the Manager for a timed schedule, can run a task on the schedule
+func checkSchedule(schedule mita.Schedule, after string) error {
+	if js, ok := schedule.(*jitterSchedule); ok {
+		schedule = js.Schedule
+	}
+	switch schedule.(type) {
+	case nil:
+		if after == "" {
+			return errors.New("schedule cannot be nil")
+		}
+		return nil
+	case Schedule:
+		return nil
+	}
+	_, err := scheduleParser.Parse(schedule.String())
+	return err
+}
+
+func newTaskStats(task mita.Task, opts []TaskOption) *taskStats {
+	stats := &taskStats{
+		options:   taskOptions{maxAttempts: 1, historySize: defaultHistorySize},
+		durations: newDurationStats(),
+		task:      task,
+		opts:      opts,
+	}
+	for _, opt := range opts {
+		opt(&stats.options)
+	}
+	return stats
+}
+
+// addTask adds a task to mita on the schedule, decorated with the options of its stats, and keeps its stats
+func (m *Manager) addTask(name string, schedule mita.Schedule, stats *taskStats) error {
+	if js, ok := schedule.(*jitterSchedule); ok {
+		stats.options.jitter = max(js.maxDelay, 0)
+		schedule = js.Schedule
+	}
+	if ts, ok := schedule.(Schedule); ok {
+		stats.timed = ts
+		if is, ok := ts.(*IntervalSchedule); ok && is.afterCompletion {
+			stats.completed = make(chan struct{}, 1)
+		}
+	}
+	if stats.options.after != "" && schedule == nil {
+		schedule = afterSchedule
+	}
+	if schedule != nil && stats.timed == nil {
+		stats.schedule, _ = scheduleParser.Parse(schedule.String())
+	}
+
+	var sem *semaphore
+	if group := stats.options.group; group != "" {
+		var err error
+		if sem, err = m.group(group, stats.options.groupLimit); err != nil {
+			return fmt.Errorf("task '%s' can't join its group: %w", name, err)
+		}
+	}
+	// The runs of a group without a limit take a worker like the ones of the tasks without a group
+	if sem == nil || sem.limit == 0 {
+		sem = m.workerSlots()
+	}
+
+	task := stats.task
+	if task != nil {
+		task = m.withAttempts(name, stats, task)
+		if stats.options.failureThreshold > 0 {
+			task = m.withBreaker(name, stats, task)
+		}
+		task = m.withDependents(name, task)
+		if stats.options.locker != nil {
+			task = m.withLock(name, stats, task)
+		}
+		task = m.withQueue(name, stats, sem, task)
+		if stats.options.dailyLimit > 0 || stats.options.quietHours != nil || stats.options.runDays != nil {
+			task = m.withLimits(name, stats, task)
+		}
+		if stats.options.maxRuns > 0 || !stats.options.expiry.IsZero() {
+			task = m.withExpiry(name, stats, task)
+		}
+		if stats.options.jitter > 0 {
+			task = m.withJitter(stats, task)
+		}
+		task = m.withPause(name, stats, task)
+		if stats.completed != nil {
+			task = withCompletion(stats, task)
+		}
+		task = withSpan(name, schedule, task)
+		task = m.withRunID(name, task)
+		task = m.withInflight(task)
+	}
+	// mita never fires a timed schedule, the Manager starts its runs
+	mitaSchedule := schedule
+	if stats.timed != nil {
+		mitaSchedule = afterSchedule
+	}
+	if err := m.TaskManager.AddTask(name, mitaSchedule, task); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.stats[name] = stats
+	if stats.timed != nil && m.started {
+		safego.Go("run-timed-task", func() { m.runTimed(name, stats) })
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// RunTaskNow starts a run of a task outside of its schedule, recorded as manual in its history
+func (m *Manager) RunTaskNow(name string) error {
+	return m.RunTaskNowWithArgs(name, nil)
+}
+
+// RunTaskNowWithArgs starts a run of a task like RunTaskNow, with args the task reads from its context, see Args
+// e.g. a date range instead of the defaults of the task.
+func (m *Manager) RunTaskNowWithArgs(name string, args map[string]any) error {
+	m.mu.Lock()
+	stats, ok := m.stats[name]
+	if ok {
+		stats.manualRuns++
+		stats.manualArgs = append(stats.manualArgs, maps.Clone(args))
+	}
+	m.mu.Unlock()
+
+	if err := m.TaskManager.RunTaskNow(name); err != nil {
+		if ok {
+			m.mu.Lock()
+			stats.manualRuns--
+			stats.manualArgs = stats.manualArgs[:len(stats.manualArgs)-1]
+			m.mu.Unlock()
+		}
+		return err
+	}
+	return nil
+}
+
+// argsKey is the key of the args of a run in the context of the task, see RunTaskNowWithArgs
+type argsKey struct{}
+
+// Args returns the args the run of a task was started with by RunTaskNowWithArgs, nil for the other runs
+func Args(ctx context.Context) map[string]any {
+	args, _ := ctx.Value(argsKey{}).(map[string]any)
+	return args
+}
+
+// RemoveTask removes a task and its statistics
+// The tasks running after it are kept, they no longer run unless scheduled or started manually.
+func (m *Manager) RemoveTask(name string) error {
+	if err := m.TaskManager.RemoveTask(name); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if stats, ok := m.stats[name]; ok && stats.options.after != "" {
+		upstream := stats.options.after
+		m.dependents[upstream] = slices.DeleteFunc(slices.Clone(m.dependents[upstream]), func(dependent string) bool { return dependent == name })
+	}
+	delete(m.stats, name)
+	delete(m.dependents, name)
+	m.mu.Unlock()
+	m.endedRuns.Delete(name)
+	m.publishTask(name, EventRemoved)
+	return nil
+}
+
+// GetTask returns a copy of the state of a task
+func (m *Manager) GetTask(name string) (*TaskInfo, error) {
+	info, err := m.TaskManager.GetTask(name)
+	if err != nil {
+		return nil, err
+	}
+	return m.taskInfo(info), nil
+}
+
+// ListTasks returns a copy of the state of all tasks, or of the tasks with all the labels if any, see WithLabels
+func (m *Manager) ListTasks(labels ...string) []*TaskInfo {
+	infos := m.TaskManager.ListTasks()
+	tasks := make([]*TaskInfo, 0, len(infos))
+	for _, info := range infos {
+		if task := m.taskInfo(info); hasLabels(task, labels) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// GetTaskHistory returns the last runs of a task, newest first
+func (m *Manager) GetTaskHistory(name string) ([]TaskRun, error) {
+	m.mu.RLock()
+	stats, ok := m.stats[name]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("task '%s' not found", name)
+	}
+	return stats.history.Items(), nil
+}
+
+// GetNextRuns returns the next n ticks of the schedule of a task, from now on
+// The ticks of an interval are counted from the next one, a run delayed by the jitter of the task or ending late
+// with an interval counted from the end of the runs starts later. A task that is disabled, or runs after another
+// task, has no next runs.
+func (m *Manager) GetNextRuns(name string, n int) ([]time.Time, error) {
+	info, err := m.TaskManager.GetTask(name)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	stats, ok := m.stats[name]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("task '%s' not found", name)
+	}
+	if !info.Enabled || n <= 0 {
+		return nil, nil
+	}
+
+	var runs []time.Time
+	var next func(time.Time) time.Time
+	from := m.clock.Now()
+	switch {
+	case stats.timed != nil:
+		next = stats.timed.Next
+		// The next tick is known once the Manager times it
+		m.mu.RLock()
+		armed := stats.nextRun
+		m.mu.RUnlock()
+		if !armed.IsZero() {
+			runs, from = append(runs, armed), armed
+		}
+	case stats.schedule != nil:
+		next = stats.schedule.Next
+	default:
+		return nil, nil
+	}
+
+	for len(runs) < n {
+		// A schedule that never comes, like the one of a task running after another, has no next tick
+		tick := next(from)
+		if tick.IsZero() || !tick.After(from) {
+			break
+		}
+		runs, from = append(runs, tick), tick
+	}
+	return runs, nil
+}
+
+func (m *Manager) taskInfo(info *mita.TaskInfo) *TaskInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	task := &TaskInfo{TaskInfo: info, MaxAttempts: 1}
+	if stats, ok := m.stats[info.Name]; ok {
+		task.MaxAttempts = stats.options.maxAttempts
+		task.Retries = stats.retries
+		task.LastAttempts = stats.lastAttempts
+		task.Skipped = stats.skipped
+		task.Durations = stats.durations.snapshot()
+		task.Labels = slices.Clone(stats.options.labels)
+		task.Group, task.GroupLimit = stats.options.group, stats.options.groupLimit
+		task.TrippedUntil = stats.trippedUntil
+		if stats.timed != nil {
+			task.Schedule = stats.timed.String()
+			task.NextRun = stats.nextRun
+		}
+		withRestored(task, stats.restored)
+	}
+	return task
+}
+
+// withAttempts runs the task as many times as its retry policy allows, counting the attempts
+// The waits between attempts end early when the manager stops. Each run is added to the history of the task.
+func (m *Manager) withAttempts(name string, stats *taskStats, task mita.Task) mita.Task {
+	return func(ctx context.Context) (err error) {
+		ctx, trigger := m.tellTrigger(ctx, stats)
+		run := TaskRun{ID: GetRunID(ctx), Start: m.clock.Now(), Trigger: trigger}
+		m.callHooks(name, run.ID, stats, stageStart, nil)
+		defer func() {
+			run.End = m.clock.Now()
+			run.Duration = run.End.Sub(run.Start).Milliseconds()
+			if err != nil {
+				run.Error = err.Error()
+			}
+			stats.history.Push(run)
+			m.mu.Lock()
+			stats.durations.add(run.End.Sub(run.Start))
+			stats.runs++
+			m.mu.Unlock()
+
+			if err != nil {
+				m.callHooks(name, run.ID, stats, stageFailure, err)
+			} else {
+				setOutcome(ctx, outcomeSuccess)
+				m.callHooks(name, run.ID, stats, stageSuccess, nil)
+			}
+		}()
+
+		wait := stats.options.backoff
+		for attempt := 1; ; attempt++ {
+			setAttempt(ctx, attempt, run.Trigger)
+			err := task(ctx)
+			run.Attempts = attempt
+
+			m.mu.Lock()
+			stats.lastAttempts = attempt
+			m.mu.Unlock()
+
+			if err == nil || ctx.Err() != nil {
+				return err
+			}
+			if attempt >= stats.options.maxAttempts {
+				if attempt > 1 {
+					return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+				}
+				return err
+			}
+
+			m.logger.Warn("task failed, retrying", "task", name, "run_id", GetRunID(ctx), "attempt", attempt,
+				"max_attempts", stats.options.maxAttempts, "wait", wait, "error", err)
+			select {
+			case <-m.clock.After(wait):
+			case <-ctx.Done():
+				return err
+			}
+			wait *= 2
+
+			m.mu.Lock()
+			stats.retries++
+			m.mu.Unlock()
+		}
+	}
+}
+
+// trigger tells whether the run of a task starting now was scheduled or started manually
+// Runs started with RunTaskNow are marked as manual, other runs, e.g. from the task web UI, are scheduled
+// if they start on a tick of the schedule. The args of a run started with RunTaskNowWithArgs are returned too.
+func (m *Manager) trigger(stats *taskStats) (string, map[string]any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stats.upstreamRuns > 0 {
+		stats.upstreamRuns--
+		return TriggerUpstream, nil
+	}
+	if stats.manualRuns > 0 {
+		stats.manualRuns--
+		var args map[string]any
+		if len(stats.manualArgs) > 0 {
+			args, stats.manualArgs = stats.manualArgs[0], stats.manualArgs[1:]
+		}
+		return TriggerManual, args
+	}
+	if stats.timedRuns > 0 {
+		stats.timedRuns--
+		return TriggerSchedule, nil
+	}
+	now := m.clock.Now()
+	// A schedule that never comes, like the one of a task running after another, has no next tick
+	if stats.schedule != nil {
+		if next := stats.schedule.Next(now.Add(-scheduleTolerance)); !next.IsZero() && !next.After(now) {
+			return TriggerSchedule, nil
+		}
+	}
+	return TriggerManual, nil
+}
@@ -0,0 +1,950 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+	"github.com/cymoo/mote/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// waitIdle waits for the run of a task started with RunTaskNow to finish
+func waitIdle(t *testing.T, m *Manager, name string) *TaskInfo {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		info, err := m.GetTask(name)
+		if err != nil {
+			t.Fatalf("GetTask failed: %v", err)
+		}
+		if !info.Running {
+			return info
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("task %q is still running", name)
+	return nil
+}
+
+func TestWithRetry(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	var calls atomic.Int32
+	flaky := func(ctx context.Context) error {
+		if calls.Add(1) < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	}
+	if err := m.AddTask("flaky", mita.Every().Day(), flaky, WithRetry(3, time.Millisecond)); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	if err := m.RunTaskNow("flaky"); err != nil {
+		t.Fatalf("RunTaskNow failed: %v", err)
+	}
+	info := waitIdle(t, m, "flaky")
+	if info.ErrorCount != 0 || info.Retries != 2 || info.LastAttempts != 3 || info.MaxAttempts != 3 {
+		t.Errorf("expected a successful run after 2 retries, got %+v", info)
+	}
+
+	failing := func(ctx context.Context) error { return errors.New("permanent") }
+	if err := m.AddTask("failing", mita.Every().Day(), failing, WithRetry(2, time.Millisecond)); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+	m.RunTaskNow("failing")
+	info = waitIdle(t, m, "failing")
+	if info.ErrorCount != 1 || info.Retries != 1 || info.LastError != "failed after 2 attempts: permanent" {
+		t.Errorf("expected one failed run after 2 attempts, got %+v", info)
+	}
+}
+
+func TestWithoutRetry(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	var calls atomic.Int32
+	task := func(ctx context.Context) error {
+		calls.Add(1)
+		return errors.New("failed")
+	}
+	if err := m.AddTask("once", mita.Every().Day(), task); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	m.RunTaskNow("once")
+	info := waitIdle(t, m, "once")
+	if calls.Load() != 1 || info.MaxAttempts != 1 || info.LastError != "failed" {
+		t.Errorf("expected a single attempt, got %d calls and %+v", calls.Load(), info)
+	}
+
+	if err := m.RemoveTask("once"); err != nil {
+		t.Fatalf("RemoveTask failed: %v", err)
+	}
+	if len(m.ListTasks()) != 0 {
+		t.Error("expected the task to be removed")
+	}
+}
+
+func TestGetTaskHistory(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	var calls atomic.Int32
+	task := func(ctx context.Context) error {
+		if calls.Add(1) == 2 {
+			return errors.New("flaky")
+		}
+		return nil
+	}
+	if err := m.AddTask("flaky", mita.Every().Day(), task, WithHistorySize(2)); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	for range 3 {
+		if err := m.RunTaskNow("flaky"); err != nil {
+			t.Fatalf("RunTaskNow failed: %v", err)
+		}
+		waitIdle(t, m, "flaky")
+	}
+
+	history, err := m.GetTaskHistory("flaky")
+	if err != nil {
+		t.Fatalf("GetTaskHistory failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected the last 2 runs, got %+v", history)
+	}
+	if history[0].Error != "" || history[1].Error != "flaky" {
+		t.Errorf("expected the newest run first, got %+v", history)
+	}
+	for _, run := range history {
+		if run.Trigger != TriggerManual || run.Attempts != 1 || run.End.Before(run.Start) {
+			t.Errorf("unexpected run %+v", run)
+		}
+	}
+
+	if _, err := m.GetTaskHistory("missing"); err == nil {
+		t.Error("expected an error for an unknown task")
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	m := NewManager().WithClock(NewFakeClock(time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local)))
+	defer m.Stop()
+
+	noop := func(ctx context.Context) error { return nil }
+	m.AddTask("secondly", mita.Every().Second(), noop)
+	m.AddTask("yearly", mita.Cron("0 0 0 1 1 *"), noop)
+
+	if trigger, _ := m.trigger(m.stats["secondly"]); trigger != TriggerSchedule {
+		t.Errorf("expected a run on a tick of the schedule to be scheduled, got %s", trigger)
+	}
+	if trigger, _ := m.trigger(m.stats["yearly"]); trigger != TriggerManual {
+		t.Errorf("expected a run off the schedule to be manual, got %s", trigger)
+	}
+
+	m.stats["secondly"].manualRuns = 1
+	if trigger, _ := m.trigger(m.stats["secondly"]); trigger != TriggerManual {
+		t.Errorf("expected a run started with RunTaskNow to be manual, got %s", trigger)
+	}
+}
+
+// memoryStore is a StateStore keeping the state in memory
+type memoryStore struct {
+	states map[string]models.TaskState
+}
+
+func (s *memoryStore) Load(ctx context.Context) ([]models.TaskState, error) {
+	states := make([]models.TaskState, 0, len(s.states))
+	for _, state := range s.states {
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func (s *memoryStore) Save(ctx context.Context, states []models.TaskState) error {
+	for _, state := range states {
+		s.states[state.Name] = state
+	}
+	return nil
+}
+
+func TestPersist(t *testing.T) {
+	store := &memoryStore{states: map[string]models.TaskState{}}
+	noop := func(ctx context.Context) error { return nil }
+
+	m := NewManager()
+	m.AddTask("noop", mita.Every().Day(), noop)
+	m.AddTask("paused", mita.Every().Day(), noop)
+	if err := m.Persist(context.Background(), store, time.Hour); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	m.RunTaskNow("noop")
+	waitIdle(t, m, "noop")
+	m.DisableTask("paused")
+	m.Stop()
+
+	if state := store.states["noop"]; state.RunCount != 1 || !state.LastRun.Valid || !state.Enabled {
+		t.Errorf("expected the run to be saved on stop, got %+v", state)
+	}
+
+	// After a restart
+	m = NewManager()
+	defer m.Stop()
+	m.AddTask("noop", mita.Every().Day(), noop)
+	m.AddTask("paused", mita.Every().Day(), noop)
+	if err := m.Persist(context.Background(), store, time.Hour); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+
+	info, _ := m.GetTask("noop")
+	if info.RunCount != 1 || info.LastRun.IsZero() {
+		t.Errorf("expected the run count to be restored, got %+v", info)
+	}
+	if info, _ := m.GetTask("paused"); info.Enabled {
+		t.Error("expected the disabled task to stay disabled")
+	}
+
+	m.RunTaskNow("noop")
+	if info := waitIdle(t, m, "noop"); info.RunCount != 2 {
+		t.Errorf("expected the restored run count to add up, got %d", info.RunCount)
+	}
+}
+
+// savedStates is a store telling the states saved on a channel
+type savedStates chan []models.TaskState
+
+func (s savedStates) Load(ctx context.Context) ([]models.TaskState, error) { return nil, nil }
+
+func (s savedStates) Save(ctx context.Context, states []models.TaskState) error {
+	s <- states
+	return nil
+}
+
+func TestPersistOnChange(t *testing.T) {
+	store := make(savedStates, 10)
+	noop := func(ctx context.Context) error { return nil }
+
+	m := NewManager()
+	m.AddTask("noop", mita.Every().Day(), noop)
+	if err := m.Persist(context.Background(), store, time.Hour); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	if err := m.DisableTask("missing"); err == nil {
+		t.Error("expected a missing task to be refused")
+	}
+	m.DisableTask("noop")
+
+	// The state is saved without waiting for the interval
+	select {
+	case states := <-store:
+		if len(states) != 1 || states[0].Enabled {
+			t.Errorf("expected the disabled task to be saved, got %+v", states)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the state to be saved once the task was disabled")
+	}
+	m.Stop()
+}
+
+func TestPersistOnWebToggle(t *testing.T) {
+	store := make(savedStates, 10)
+	m := NewManager()
+	defer m.Stop()
+	m.AddTask("noop", mita.Every().Day(), func(ctx context.Context) error { return nil })
+	if err := m.Persist(context.Background(), store, time.Hour); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	web := m.WebHandler("/tasks")
+
+	toggle := func(action string, enabled bool) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/tasks/action", strings.NewReader("name=noop&action="+action))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		web.ServeHTTP(rec, req)
+		if location := rec.Header().Get("Location"); rec.Code != http.StatusSeeOther || !strings.Contains(location, "status=success") {
+			t.Fatalf("expected a redirect to the task list, got %d %q", rec.Code, location)
+		}
+
+		// The state is saved as if the task was toggled with Manager
+		select {
+		case states := <-store:
+			if len(states) != 1 || states[0].Enabled != enabled {
+				t.Errorf("expected the task saved with enabled %v, got %+v", enabled, states)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected the state to be saved once the task was toggled to %s", action)
+		}
+	}
+	toggle("disable", false)
+	toggle("enable", true)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/tasks/action", strings.NewReader("name=noop&action=pause"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	web.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown action to be refused, got %d", rec.Code)
+	}
+}
+
+func TestRescheduleTask(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	var calls atomic.Int32
+	failing := func(ctx context.Context) error {
+		calls.Add(1)
+		return errors.New("boom")
+	}
+	m.AddTask("nightly", mita.Every().Day().At(2, 0), failing, WithRetry(2, time.Millisecond))
+	m.RunTaskNow("nightly")
+	waitIdle(t, m, "nightly")
+	m.DisableTask("nightly")
+
+	if err := m.RescheduleTask("nightly", mita.Cron("not a schedule")); err == nil {
+		t.Error("expected an invalid schedule to be refused")
+	}
+	if err := m.RescheduleTask("missing", mita.Every().Hour()); err == nil {
+		t.Error("expected a missing task to be refused")
+	}
+	if err := m.RescheduleTask("nightly", mita.Every().Hours(6)); err != nil {
+		t.Fatalf("RescheduleTask failed: %v", err)
+	}
+
+	info, err := m.GetTask("nightly")
+	if err != nil {
+		t.Fatalf("GetTask failed: %v", err)
+	}
+	if info.Schedule != "0 0 */6 * * *" || info.Enabled {
+		t.Errorf("expected the new schedule on a disabled task, got %q, enabled %v", info.Schedule, info.Enabled)
+	}
+	if info.RunCount != 1 || info.ErrorCount != 1 || info.Retries != 1 || info.LastRun.IsZero() || info.LastError == "" {
+		t.Errorf("expected the statistics to be kept, got %+v", info)
+	}
+	if history, _ := m.GetTaskHistory("nightly"); len(history) != 1 {
+		t.Errorf("expected the history to be kept, got %+v", history)
+	}
+
+	// The task keeps its options
+	m.EnableTask("nightly")
+	m.RunTaskNow("nightly")
+	info = waitIdle(t, m, "nightly")
+	if calls.Load() != 4 || info.RunCount != 2 || info.Retries != 2 {
+		t.Errorf("expected a second run of 2 attempts, got %d calls and %+v", calls.Load(), info)
+	}
+}
+
+// memoryLocker is a locker shared by managers standing for instances of the app
+type memoryLocker struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func (l *memoryLocker) acquire(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.tokens[name]; ok {
+		return false, nil
+	}
+	l.tokens[name] = token
+	return true, nil
+}
+
+func (l *memoryLocker) renew(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tokens[name] == token, nil
+}
+
+func (l *memoryLocker) release(ctx context.Context, name, token string, hold time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens[name] == token {
+		delete(l.tokens, name)
+	}
+	return nil
+}
+
+func TestWithLock(t *testing.T) {
+	lock := &memoryLocker{tokens: map[string]string{}}
+	first, second := NewManager(), NewManager()
+	defer first.Stop()
+	defer second.Stop()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	task := func(ctx context.Context) error {
+		calls.Add(1)
+		<-release
+		return nil
+	}
+	first.SetDefaultOptions(withLocker(lock))
+	second.SetDefaultOptions(withLocker(lock))
+	first.AddTask("locked", mita.Every().Day(), task)
+	second.AddTask("locked", mita.Every().Day(), task)
+
+	first.RunTaskNow("locked")
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second.RunTaskNow("locked")
+	info := waitIdle(t, second, "locked")
+	if info.Skipped != 1 || second.stats["locked"].manualRuns != 0 {
+		t.Errorf("expected the run to be skipped while the lock is held, got %+v", info)
+	}
+	if history, _ := second.GetTaskHistory("locked"); len(history) != 0 {
+		t.Errorf("expected a skipped run not to be in the history, got %+v", history)
+	}
+
+	close(release)
+	waitIdle(t, first, "locked")
+	if calls.Load() != 1 || len(lock.tokens) != 0 {
+		t.Errorf("expected one run and the lock to be released, got %d runs and %v", calls.Load(), lock.tokens)
+	}
+
+	second.RunTaskNow("locked")
+	waitIdle(t, second, "locked")
+	if calls.Load() != 2 {
+		t.Errorf("expected the task to run once the lock is released, got %d runs", calls.Load())
+	}
+}
+
+func TestLockRenewal(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 6, 15, 9, 30, 0, 0, time.Local))
+	lock := &memoryLocker{tokens: map[string]string{}}
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	started := make(chan struct{})
+	m.AddTask("locked", mita.Every().Day(), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, withLocker(lock))
+
+	m.RunTaskNow("locked")
+	<-started
+	// The lock is renewed on the clock of the Manager, and the run is cancelled once it is lost
+	if err := clock.BlockUntil(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	lock.mu.Lock()
+	lock.tokens["locked"] = "another instance"
+	lock.mu.Unlock()
+	clock.Advance(lockTTL / 3)
+
+	waitIdle(t, m, "locked")
+	history, _ := m.GetTaskHistory("locked")
+	if len(history) != 1 || !strings.Contains(history[0].Error, context.Canceled.Error()) {
+		t.Errorf("expected the run to be cancelled once its lock is lost, got %+v", history)
+	}
+}
+
+func TestAfter(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	var failing atomic.Bool
+	var uploads atomic.Int32
+	export := func(ctx context.Context) error {
+		if failing.Load() {
+			return errors.New("disk full")
+		}
+		return nil
+	}
+	noop := func(ctx context.Context) error { return nil }
+	upload := func(ctx context.Context) error {
+		uploads.Add(1)
+		return nil
+	}
+
+	if err := m.AddTask("compress", nil, noop, After("export")); err == nil {
+		t.Fatal("expected an error for a task running after one that isn't added")
+	}
+	m.AddTask("export", mita.Every().Day(), export)
+	if err := m.AddTask("compress", nil, noop, After("export")); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+	m.AddTask("upload", nil, upload, After("compress"))
+
+	m.RunTaskNow("export")
+	deadline := time.Now().Add(2 * time.Second)
+	for uploads.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	waitIdle(t, m, "upload")
+	history, _ := m.GetTaskHistory("upload")
+	if uploads.Load() != 1 || len(history) != 1 || history[0].Trigger != TriggerUpstream {
+		t.Fatalf("expected upload to run after compress, got %d runs and %+v", uploads.Load(), history)
+	}
+
+	failing.Store(true)
+	m.RunTaskNow("export")
+	waitIdle(t, m, "export")
+	history, _ = m.GetTaskHistory("upload")
+	if uploads.Load() != 1 || len(history) != 2 || history[0].Error != "skipped, 'export' failed" {
+		t.Errorf("expected upload to be skipped, got %d runs and %+v", uploads.Load(), history)
+	}
+}
+
+func TestWithHooks(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	var mu sync.Mutex
+	var events []string
+	record := func(stage string) Hook {
+		return func(name, runID string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if runID == "" {
+				t.Errorf("expected a run ID for %s of %s", stage, name)
+			}
+			events = append(events, stage+" "+name)
+		}
+	}
+	m.AddHooks(Hooks{OnStart: record("start"), OnFailure: record("failure")})
+
+	failing := func(ctx context.Context) error { return errors.New("failed") }
+	noop := func(ctx context.Context) error { return nil }
+	m.AddTask("failing", mita.Every().Day(), failing)
+	m.AddTask("after", nil, noop, After("failing"), WithHooks(Hooks{
+		OnSkipped: record("skipped"),
+		OnStart:   func(name, runID string, err error) { panic("not started") },
+	}))
+	m.AddTask("ok", mita.Every().Day(), noop, WithHooks(Hooks{OnSuccess: record("success")}))
+
+	m.RunTaskNow("failing")
+	waitIdle(t, m, "failing")
+	m.RunTaskNow("ok")
+	waitIdle(t, m, "ok")
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"start failing", "failure failing", "skipped after", "start ok", "success ok"}
+	if !slices.Equal(events, expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+
+	history, _ := m.GetTaskHistory("ok")
+	if len(history) != 1 || history[0].ID == "" {
+		t.Errorf("expected the run ID in the history, got %+v", history)
+	}
+}
+
+func TestWithSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	m := NewManager()
+	defer m.Stop()
+
+	var calls atomic.Int32
+	m.AddTask("flaky", mita.Every().Day(), func(ctx context.Context) error {
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			t.Error("expected the span in the context of the task")
+		}
+		if calls.Add(1) == 1 {
+			return errors.New("first attempt fails")
+		}
+		return nil
+	}, WithRetry(2, time.Millisecond))
+	m.AddTask("failing", mita.Every().Day(), func(ctx context.Context) error { return errors.New("failed") })
+
+	m.RunTaskNow("flaky")
+	waitIdle(t, m, "flaky")
+	m.RunTaskNow("failing")
+	waitIdle(t, m, "failing")
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	attrs := func(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		m := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes() {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+
+	flaky := attrs(spans[0])
+	if spans[0].Name() != "task flaky" || flaky["task.name"].AsString() != "flaky" {
+		t.Errorf("unexpected span %q with %v", spans[0].Name(), flaky)
+	}
+	if flaky["task.outcome"].AsString() != "success" || flaky["task.attempt"].AsInt64() != 2 {
+		t.Errorf("expected a success on the second attempt, got %v", flaky)
+	}
+	if flaky["task.trigger"].AsString() != TriggerManual || flaky["task.run_id"].AsString() == "" || flaky["task.schedule"].AsString() == "" {
+		t.Errorf("expected the trigger, run ID and schedule, got %v", flaky)
+	}
+	if spans[0].Status().Code == codes.Error {
+		t.Error("expected the span of a successful run not to be an error")
+	}
+
+	failing := attrs(spans[1])
+	if failing["task.outcome"].AsString() != "failure" || spans[1].Status().Code != codes.Error {
+		t.Errorf("expected a failure, got %v with status %v", failing, spans[1].Status())
+	}
+}
+
+func TestWithJitter(t *testing.T) {
+	m := NewManager()
+
+	var trigger string
+	task := func(ctx context.Context) error {
+		trigger = m.runTrigger(ctx, nil)
+		return nil
+	}
+	m.AddTask("secondly", Jitter(mita.Every().Second(), 50*time.Millisecond), task)
+	stats := m.stats["secondly"]
+	if stats.options.jitter != 50*time.Millisecond {
+		t.Fatalf("expected the jitter of the schedule, got %v", stats.options.jitter)
+	}
+
+	// A run on a tick is scheduled though it starts after the delay
+	start := time.Now()
+	if err := m.withJitter(stats, task)(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if trigger != TriggerSchedule || time.Since(start) > time.Second {
+		t.Errorf("expected a scheduled run delayed by at most the jitter, got %s after %v", trigger, time.Since(start))
+	}
+
+	// A manual run isn't delayed
+	m.AddTask("daily", mita.Every().Day(), task, WithJitter(time.Hour))
+	m.RunTaskNow("daily")
+	waitIdle(t, m, "daily")
+	if trigger != TriggerManual {
+		t.Errorf("expected a manual run, got %s", trigger)
+	}
+
+	// A delayed run is dropped when the manager stops
+	stats = m.stats["daily"]
+	stats.schedule = m.stats["secondly"].schedule
+	done := make(chan struct{})
+	trigger = ""
+	go func() {
+		m.withJitter(stats, task)(context.Background())
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	m.Stop()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the delayed run to end when the manager stops")
+	}
+	if trigger != "" {
+		t.Error("expected the delayed run not to happen")
+	}
+}
+
+func TestWithGroup(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	var running, maxRunning atomic.Int32
+	release := make(chan struct{})
+	heavy := func(ctx context.Context) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			prev := maxRunning.Load()
+			if n <= prev || maxRunning.CompareAndSwap(prev, n) {
+				break
+			}
+		}
+		<-release
+		return nil
+	}
+	m.AddTask("vacuum", mita.Every().Day(), heavy, WithGroup("db-heavy", 1))
+	m.AddTask("reindex", mita.Every().Day(), heavy, WithGroup("db-heavy", 1))
+	m.AddTask("fetch", mita.Every().Day(), heavy)
+
+	if err := m.AddTask("export", mita.Every().Day(), heavy, WithGroup("db-heavy", 2)); err == nil {
+		t.Error("expected a task giving the group another limit to be refused")
+	}
+
+	for _, name := range []string{"vacuum", "reindex", "fetch"} {
+		if err := m.RunTaskNow(name); err != nil {
+			t.Fatalf("RunTaskNow failed: %v", err)
+		}
+	}
+	// The task outside of the group runs next to the one of the group holding the semaphore
+	deadline := time.Now().Add(2 * time.Second)
+	for running.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if running.Load() != 2 {
+		t.Errorf("expected 2 runs in progress, got %d", running.Load())
+	}
+
+	close(release)
+	for _, name := range []string{"vacuum", "reindex", "fetch"} {
+		waitIdle(t, m, name)
+	}
+	if maxRunning.Load() != 2 {
+		t.Errorf("expected at most 2 runs at a time, got %d", maxRunning.Load())
+	}
+	for _, name := range []string{"vacuum", "reindex"} {
+		if history, _ := m.GetTaskHistory(name); len(history) != 1 || history[0].Trigger != TriggerManual {
+			t.Errorf("expected a manual run of %q, got %+v", name, history)
+		}
+	}
+}
+
+func TestTaskGroups(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	var runs atomic.Int32
+	count := func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}
+	m.AddTask("daily-report", mita.Every().Day(), count, WithGroup("reporting", 0))
+	m.AddTask("weekly-report", mita.Every().Day(), count, WithGroup("reporting", 0))
+	m.AddTask("vacuum", mita.Every().Day(), count)
+
+	if err := m.DisableGroup("reporting"); err != nil {
+		t.Fatalf("DisableGroup failed: %v", err)
+	}
+	for name, enabled := range map[string]bool{"daily-report": false, "weekly-report": false, "vacuum": true} {
+		if info, _ := m.GetTask(name); info.Enabled != enabled {
+			t.Errorf("expected %q enabled to be %v", name, enabled)
+		}
+	}
+	if err := m.RunGroupNow("reporting"); err == nil {
+		t.Error("expected the disabled tasks of the group to be refused")
+	}
+	if err := m.EnableGroup("missing"); err == nil {
+		t.Error("expected an unknown group to be an error")
+	}
+
+	if err := m.EnableGroup("reporting"); err != nil {
+		t.Fatalf("EnableGroup failed: %v", err)
+	}
+	// The runs of a group without limit run side by side
+	if err := m.RunGroupNow("reporting"); err != nil {
+		t.Fatalf("RunGroupNow failed: %v", err)
+	}
+	for _, name := range []string{"daily-report", "weekly-report"} {
+		waitIdle(t, m, name)
+	}
+	if runs.Load() != 2 {
+		t.Errorf("expected the 2 tasks of the group to run, got %d runs", runs.Load())
+	}
+
+	stats := m.GetStats()["task_groups"].(map[string]GroupStats)
+	if reporting := stats["reporting"]; reporting.Tasks != 2 || reporting.Enabled != 2 || reporting.Limit != 0 {
+		t.Errorf("unexpected statistics of the group: %+v", stats)
+	}
+
+	api := m.APIHandler("/api")
+	// In order, the group is run once disabled
+	for _, tt := range []struct {
+		path string
+		code int
+	}{
+		{"/api/tasks/groups/reporting/disable", http.StatusNoContent},
+		{"/api/tasks/groups/reporting/run", http.StatusConflict},
+		{"/api/tasks/groups/missing/enable", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest("POST", tt.path, nil))
+		if rec.Code != tt.code {
+			t.Errorf("POST %s: expected %d, got %d %s", tt.path, tt.code, rec.Code, rec.Body)
+		}
+	}
+
+	// The buttons of the statistics page post to the web handler, which goes back to the page
+	web := m.WebHandler("/tasks")
+	rec := httptest.NewRecorder()
+	web.ServeHTTP(rec, httptest.NewRequest("GET", "/tasks/stats", nil))
+	if !strings.Contains(rec.Body.String(), `action="groups/reporting/run"`) {
+		t.Errorf("expected the buttons of the group on the statistics page, got %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	web.ServeHTTP(rec, httptest.NewRequest("POST", "/tasks/groups/reporting/enable", nil))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/tasks/stats" {
+		t.Errorf("expected a redirect to the statistics page, got %d %v", rec.Code, rec.Header())
+	}
+	if info, _ := m.GetTask("daily-report"); !info.Enabled {
+		t.Error("expected the group to be enabled from the web page")
+	}
+}
+
+func TestWithPriority(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	var mu sync.Mutex
+	var order []string
+	release := make(chan struct{})
+	task := func(name string) mita.Task {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			if name == "blocker" {
+				<-release
+			}
+			return nil
+		}
+	}
+	m.AddTask("blocker", mita.Every().Day(), task("blocker"), WithGroup("db-heavy", 1))
+	m.AddTask("low", mita.Every().Day(), task("low"), WithGroup("db-heavy", 1), WithPriority(-1))
+	m.AddTask("normal", mita.Every().Day(), task("normal"), WithGroup("db-heavy", 1))
+	m.AddTask("high", mita.Every().Day(), task("high"), WithGroup("db-heavy", 1), WithPriority(10))
+
+	// The runs wait for the blocker in the order they came, lowest priority first
+	sem := m.groups["db-heavy"]
+	waiting := func(n int) {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			sem.mu.Lock()
+			held, waiters := sem.held, len(sem.waiters)
+			sem.mu.Unlock()
+			if held == 1 && waiters == n {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("expected %d runs waiting for the group", n)
+	}
+	for i, name := range []string{"blocker", "low", "normal", "high"} {
+		if err := m.RunTaskNow(name); err != nil {
+			t.Fatalf("RunTaskNow failed: %v", err)
+		}
+		waiting(i)
+	}
+
+	close(release)
+	for _, name := range []string{"blocker", "low", "normal", "high"} {
+		waitIdle(t, m, name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(order, []string{"blocker", "high", "normal", "low"}) {
+		t.Errorf("expected the waiting runs to start by priority, got %v", order)
+	}
+}
+
+func TestSemaphoreGiveUp(t *testing.T) {
+	sem := newSemaphore(1, realClock{})
+	stopped := make(chan struct{})
+	if err := sem.acquire(context.Background(), "task", 0, stopped); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	// A waiter that gives up leaves the queue, and doesn't keep the slot
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sem.acquire(ctx, "task", 5, stopped); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+	close(stopped)
+	if err := sem.acquire(context.Background(), "task", 0, stopped); !errors.Is(err, errStopped) {
+		t.Errorf("expected errStopped, got %v", err)
+	}
+
+	sem.release()
+	if sem.held != 0 || len(sem.waiters) != 0 {
+		t.Errorf("expected the semaphore to be free, got %d held and %d waiting", sem.held, len(sem.waiters))
+	}
+}
+
+func TestRunTaskNowWithArgs(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+
+	runs := make(chan map[string]any, 2)
+	m.AddTask("report", mita.Every().Day(), func(ctx context.Context) error {
+		runs <- Args(ctx)
+		return nil
+	})
+
+	args := map[string]any{"from": "2024-01-01", "to": "2024-01-31"}
+	if err := m.RunTaskNowWithArgs("report", args); err != nil {
+		t.Fatalf("RunTaskNowWithArgs failed: %v", err)
+	}
+	// The args are copied, a change afterwards doesn't reach the run
+	args["to"] = "2024-12-31"
+	if got := <-runs; got["from"] != "2024-01-01" || got["to"] != "2024-01-31" {
+		t.Errorf("expected the run to get its args, got %v", got)
+	}
+	waitIdle(t, m, "report")
+
+	m.RunTaskNow("report")
+	if got := <-runs; got != nil {
+		t.Errorf("expected no args for a run started with RunTaskNow, got %v", got)
+	}
+	waitIdle(t, m, "report")
+
+	// The API takes the args as the body of a run
+	rec := httptest.NewRecorder()
+	m.APIHandler("/api").ServeHTTP(rec, httptest.NewRequest("POST", "/api/tasks/report/run", strings.NewReader(`{"days":7}`)))
+	if got := <-runs; rec.Code != http.StatusAccepted || got["days"] != 7.0 {
+		t.Errorf("expected the run to get the args of the API, got %d and %v", rec.Code, got)
+	}
+	waitIdle(t, m, "report")
+
+	rec = httptest.NewRecorder()
+	m.APIHandler("/api").ServeHTTP(rec, httptest.NewRequest("POST", "/api/tasks/report/run", strings.NewReader(`[7]`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected args other than an object to be refused, got %d", rec.Code)
+	}
+}
+
+func TestGetNextRuns(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local))
+	m := NewManager().WithClock(clock)
+	noop := func(ctx context.Context) error { return nil }
+	m.AddTask("nightly", mita.Every().Day().At(2, 0), noop)
+	m.AddTask("report", nil, noop, After("nightly"))
+
+	runs, err := m.GetNextRuns("nightly", 3)
+	if err != nil {
+		t.Fatalf("GetNextRuns failed: %v", err)
+	}
+	want := []time.Time{
+		time.Date(2024, 6, 16, 2, 0, 0, 0, time.Local),
+		time.Date(2024, 6, 17, 2, 0, 0, 0, time.Local),
+		time.Date(2024, 6, 18, 2, 0, 0, 0, time.Local),
+	}
+	if !slices.EqualFunc(runs, want, time.Time.Equal) {
+		t.Errorf("expected the next 3 nights, got %v", runs)
+	}
+
+	if runs, err := m.GetNextRuns("report", 3); err != nil || len(runs) != 0 {
+		t.Errorf("expected no next run for a task running after another, got %v: %v", runs, err)
+	}
+	m.DisableTask("nightly")
+	if runs, err := m.GetNextRuns("nightly", 3); err != nil || len(runs) != 0 {
+		t.Errorf("expected no next run for a disabled task, got %v: %v", runs, err)
+	}
+	if _, err := m.GetNextRuns("missing", 3); err == nil {
+		t.Error("expected an error for a missing task")
+	}
+}
@@ -0,0 +1,252 @@
+package tasks
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+// Parse parses a schedule written by hand, e.g. in a config file, so that it doesn't have to be cron. It takes:
+//
+//	0 30 2 * * *                      a cron expression of five fields, or six with seconds, see ValidateCron
+//	@daily                            a descriptor of cron
+//	@every 5m                         an Interval, "@every 5m after completion" counts from the end of the runs
+//	every 5m                          an Interval too, any duration of time.ParseDuration
+//	every 15 minutes                  every second, minute or hour, or a number of them, on the clock like cron
+//	every hour between 9 and 17       the same limited to a window of hours, see ScheduleBuilder.Between
+//	every day at 9:00                 every day, week, or month at a time of day, 00:00 if not told
+//	every monday at 9:00              on weekdays, e.g. "every mon, wed and fri", "every weekday" or "every weekend"
+//	every month on day 1 and 15       on days of the month, or "every month on the last day at 23:00"
+//
+// The times of day are 24-hour, like 9:00, 18:30:15 or with am or pm, like 9am or 6:30pm. Words are case-insensitive.
+// Describe renders the schedules in plain English the other way around.
+func Parse(spec string) (mita.Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	lower := strings.ToLower(spec)
+	switch {
+	case spec == "":
+		return nil, fmt.Errorf("empty schedule")
+	case strings.HasPrefix(lower, "@every "):
+		return parseInterval(strings.TrimSpace(lower[len("@every "):]), spec)
+	case strings.HasPrefix(lower, "every "):
+		return parsePhrase(strings.FieldsFunc(lower, func(r rune) bool { return r == ' ' || r == ',' })[1:], spec)
+	}
+	if err := ValidateCron(spec); err != nil {
+		return nil, err
+	}
+	return mita.Cron(spec), nil
+}
+
+// parseInterval parses the duration of an interval, optionally followed by "after completion"
+func parseInterval(text, spec string) (mita.Schedule, error) {
+	text, afterCompletion := strings.CutSuffix(text, " after completion")
+	d, err := time.ParseDuration(strings.TrimSpace(text))
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid schedule %q: the interval must be a positive duration like 90s or 5m", spec)
+	}
+	if afterCompletion {
+		return Interval(d).AfterCompletion(), nil
+	}
+	return Interval(d), nil
+}
+
+// scheduleUnits are the units of the phrases running every number of them, and the largest number
+var scheduleUnits = map[string]struct {
+	max  int
+	unit func(*ScheduleBuilder, int) *ScheduleBuilder
+}{
+	"second": {59, (*ScheduleBuilder).Seconds},
+	"minute": {59, (*ScheduleBuilder).Minutes},
+	"hour":   {23, (*ScheduleBuilder).Hours},
+}
+
+// parsePhrase parses the words of a phrase following "every", see Parse
+func parsePhrase(words []string, spec string) (mita.Schedule, error) {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("invalid schedule %q: %s", spec, fmt.Sprintf(format, args...))
+	}
+	if len(words) == 1 {
+		if _, err := time.ParseDuration(words[0]); err == nil {
+			return parseInterval(words[0], spec)
+		}
+	}
+
+	// The time of day, or the window of hours, ends the phrase
+	var at *[3]int
+	var window *[2]int
+	if i := slices.Index(words, "at"); i >= 0 {
+		if i != len(words)-2 {
+			return nil, invalid("expected a time of day like 9:00 after 'at', at the end")
+		}
+		t, err := parseTimeOfDay(words[i+1])
+		if err != nil {
+			return nil, invalid("%v", err)
+		}
+		at, words = &t, words[:i]
+	} else if i := slices.Index(words, "between"); i >= 0 {
+		if i != len(words)-4 || words[i+2] != "and" {
+			return nil, invalid("expected hours like 'between 9 and 17' at the end")
+		}
+		first, err1 := strconv.Atoi(words[i+1])
+		last, err2 := strconv.Atoi(words[i+3])
+		if err1 != nil || err2 != nil || first < 0 || last > 23 || first > last {
+			return nil, invalid("the hours must be between 0 and 23, the first one before the last one")
+		}
+		window, words = &[2]int{first, last}, words[:i]
+	}
+	if len(words) == 0 {
+		return nil, invalid("expected what the task runs every, like 'day' or 'monday'")
+	}
+
+	b := Every()
+	// Every number of seconds, minutes or hours
+	n, count := 1, words
+	if v, err := strconv.Atoi(words[0]); err == nil && len(words) == 2 {
+		n, count = v, words[1:]
+	}
+	if unit, ok := scheduleUnits[strings.TrimSuffix(count[0], "s")]; ok && len(count) == 1 {
+		if at != nil {
+			return nil, invalid("a time of day can't be set on a task running every %s", count[0])
+		}
+		if n < 1 || n > unit.max {
+			return nil, invalid("the number of %ss must be between 1 and %d", strings.TrimSuffix(count[0], "s"), unit.max)
+		}
+		b = unit.unit(b, n)
+		if window != nil {
+			b.Between(window[0], window[1])
+		}
+		return b, nil
+	}
+	if window != nil {
+		return nil, invalid("a window of hours can only be set on a task running every number of seconds, minutes or hours")
+	}
+
+	switch {
+	case len(words) == 1 && words[0] == "day":
+	case len(words) == 1 && words[0] == "week":
+		b.OnWeekdays(time.Sunday)
+	case words[0] == "month":
+		days, err := parseMonthDays(words[1:])
+		if err != nil {
+			return nil, invalid("%v", err)
+		}
+		if days == nil {
+			b.LastDayOfMonth()
+		} else {
+			b.OnDays(days...)
+		}
+	default:
+		weekdays, err := parseWeekdays(words)
+		if err != nil {
+			return nil, invalid("%v", err)
+		}
+		b.OnWeekdays(weekdays...)
+	}
+
+	if at != nil {
+		b.At(at[0], at[1])
+		b.second = strconv.Itoa(at[2])
+	} else {
+		b.At(0, 0)
+	}
+	return b, nil
+}
+
+// parseTimeOfDay parses a time of day like 9:00, 18:30:15, 9am or 6:30pm into its hour, minute and second
+func parseTimeOfDay(text string) ([3]int, error) {
+	clock, pm := strings.CutSuffix(text, "pm")
+	clock, am := strings.CutSuffix(clock, "am")
+	parts := strings.Split(clock, ":")
+	invalid := fmt.Errorf("invalid time of day '%s', expected one like 9:00, 18:30:15 or 6:30pm", text)
+	if len(parts) > 3 || (len(parts) == 1 && !am && !pm) {
+		return [3]int{}, invalid
+	}
+
+	var t [3]int
+	limits := [3]int{23, 59, 59}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || n > limits[i] || (i > 0 && len(part) != 2) {
+			return [3]int{}, invalid
+		}
+		t[i] = n
+	}
+	if am || pm {
+		if t[0] < 1 || t[0] > 12 {
+			return [3]int{}, invalid
+		}
+		t[0] %= 12
+		if pm {
+			t[0] += 12
+		}
+	}
+	return t, nil
+}
+
+// parseMonthDays parses the days of the month after "every month", like "on day 1", "on days 1 and 15" or "on the
+// last day", it returns nil days for the last day
+func parseMonthDays(words []string) ([]int, error) {
+	words = slices.DeleteFunc(slices.Clone(words), func(w string) bool { return w == "on" || w == "the" || w == "and" })
+	switch {
+	case len(words) == 0:
+		return []int{1}, nil
+	case len(words) == 2 && words[0] == "last" && words[1] == "day":
+		return nil, nil
+	case words[0] != "day" && words[0] != "days":
+		return nil, fmt.Errorf("expected the days of the month like 'on day 1' or 'on the last day'")
+	}
+
+	days := make([]int, 0, len(words)-1)
+	for _, word := range words[1:] {
+		day, err := strconv.Atoi(word)
+		if err != nil || day < 1 || day > 31 {
+			return nil, fmt.Errorf("invalid day of the month '%s', expected 1 to 31", word)
+		}
+		days = append(days, day)
+	}
+	if len(days) == 0 {
+		return nil, fmt.Errorf("expected the days of the month like 'on day 1' or 'on the last day'")
+	}
+	return days, nil
+}
+
+// parseWeekdays parses a list of weekdays like "monday", "mon, wed and fri", "weekday" or "weekend"
+func parseWeekdays(words []string) ([]time.Weekday, error) {
+	var weekdays []time.Weekday
+	for _, word := range words {
+		switch word {
+		case "and":
+			continue
+		case "weekday", "weekdays":
+			weekdays = append(weekdays, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday)
+			continue
+		case "weekend", "weekends":
+			weekdays = append(weekdays, time.Saturday, time.Sunday)
+			continue
+		}
+		weekday, ok := parseWeekday(strings.TrimSuffix(word, "s"))
+		if !ok {
+			return nil, fmt.Errorf("unknown word '%s', expected a unit like 'day' or 'hour', or a weekday", word)
+		}
+		weekdays = append(weekdays, weekday)
+	}
+	if len(weekdays) == 0 {
+		return nil, fmt.Errorf("expected the weekdays the task runs on")
+	}
+	return weekdays, nil
+}
+
+// parseWeekday parses the English name of a weekday, or its first three letters
+func parseWeekday(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		full := strings.ToLower(d.String())
+		if name == full || name == full[:3] {
+			return d, true
+		}
+	}
+	return 0, false
+}
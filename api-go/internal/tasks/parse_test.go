@@ -0,0 +1,74 @@
+package tasks
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"0 30 2 * * *", "0 30 2 * * *"},
+		{"*/5 * * * *", "*/5 * * * *"},
+		{"@daily", "@daily"},
+		{"@every 5m", "@every 5m0s"},
+		{"@every 1h after completion", "@every 1h0m0s after completion"},
+		{"every 90s", "@every 1m30s"},
+		{"every minute", "0 */1 * * * *"},
+		{"every 15 minutes", "0 */15 * * * *"},
+		{"Every 2 Hours between 9 and 17", "0 0 9-17/2 * * *"},
+		{"every 10 seconds", "*/10 * * * * *"},
+		{"every day", "0 0 0 * * *"},
+		{"every day at 9:00", "0 0 9 * * *"},
+		{"every day at 18:30:15", "15 30 18 * * *"},
+		{"every day at 6:30pm", "0 30 18 * * *"},
+		{"every day at 12am", "0 0 0 * * *"},
+		{"every week", "0 0 0 * * 0"},
+		{"every Monday at 9:00", "0 0 9 * * 1"},
+		{"every mon, wed and fri at 8:15", "0 15 8 * * 1,3,5"},
+		{"every weekday at 7:00", "0 0 7 * * 1,2,3,4,5"},
+		{"every weekend", "0 0 0 * * 6,0"},
+		{"every month", "0 0 0 1 * *"},
+		{"every month on days 1 and 15 at 3:00", "0 0 3 1,15 * *"},
+		{"every month on the last day at 23:00", "0 0 23 L * *"},
+	}
+	for _, tt := range tests {
+		schedule, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.spec, err)
+			continue
+		}
+		if got := fmt.Sprint(schedule); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.spec, tt.want, got)
+		}
+	}
+
+	for _, spec := range []string{
+		"",
+		"@every",
+		"@every -5m",
+		"@every soon",
+		"@hourly-ish",
+		"* * *",
+		"every",
+		"every 0 minutes",
+		"every 60 minutes",
+		"every fortnight",
+		"every day at 25:00",
+		"every day at 9:5",
+		"every day at 9",
+		"every day at 13pm",
+		"every day at 9:00 on monday",
+		"every minute at 9:00",
+		"every day between 9 and 17",
+		"every hour between 17 and 9",
+		"every month on day 32",
+		"every month on the first day",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
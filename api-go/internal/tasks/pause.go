@@ -0,0 +1,53 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cymoo/mita"
+)
+
+// errPaused is the reason of the runs skipped while the manager is paused
+var errPaused = errors.New("the task manager is paused")
+
+// Pause stops starting the runs of the tasks until Resume, e.g. before a maintenance window
+// Unlike Stop, the schedules keep ticking: the runs due meanwhile are skipped, added to the history of their task,
+// rather than started once the manager resumes. The runs in progress go on, and RunTaskNow still starts a run.
+func (m *Manager) Pause() {
+	m.mu.Lock()
+	m.paused = true
+	m.mu.Unlock()
+}
+
+// Resume starts the runs of the tasks again from the next tick of their schedule, after Pause
+func (m *Manager) Resume() {
+	m.mu.Lock()
+	m.paused = false
+	m.mu.Unlock()
+}
+
+// IsPaused tells whether the runs of the tasks are paused, see Pause
+func (m *Manager) IsPaused() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.paused
+}
+
+// withPause skips the runs not started with RunTaskNow while the manager is paused
+func (m *Manager) withPause(name string, stats *taskStats, task mita.Task) mita.Task {
+	return func(ctx context.Context) error {
+		if !m.IsPaused() {
+			return task(ctx)
+		}
+		ctx, trigger := m.tellTrigger(ctx, stats)
+		if trigger == TriggerManual {
+			return task(ctx)
+		}
+
+		now := m.clock.Now()
+		stats.history.Push(TaskRun{ID: GetRunID(ctx), Start: now, End: now, Trigger: trigger, Error: errPaused.Error()})
+		setOutcome(ctx, outcomeSkipped)
+		m.callHooks(name, GetRunID(ctx), stats, stageSkipped, errPaused)
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package tasks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+func TestPauseResume(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local))
+	m := NewManager().WithClock(clock)
+	defer m.Stop()
+
+	var runs atomic.Int32
+	m.AddTask("sync", mita.Every().Day().At(2, 0), func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	var skipped atomic.Int32
+	m.AddHooks(Hooks{OnSkipped: func(name, runID string, err error) { skipped.Add(1) }})
+
+	m.Pause()
+	if !m.IsPaused() {
+		t.Fatal("expected the manager to be paused")
+	}
+
+	// A scheduled run is skipped, and added to the history
+	if _, err := m.FireNext("sync"); err != nil {
+		t.Fatalf("FireNext failed: %v", err)
+	}
+	waitIdle(t, m, "sync")
+	history, _ := m.GetTaskHistory("sync")
+	if runs.Load() != 0 || len(history) != 1 || history[0].Error != errPaused.Error() || history[0].Trigger != TriggerSchedule {
+		t.Errorf("expected a skipped scheduled run, got %d runs and %+v", runs.Load(), history)
+	}
+	if skipped.Load() != 1 {
+		t.Errorf("expected the skipped hooks to be called, got %d", skipped.Load())
+	}
+
+	// A run started with RunTaskNow still runs
+	m.RunTaskNow("sync")
+	waitIdle(t, m, "sync")
+	if runs.Load() != 1 {
+		t.Errorf("expected the manual run, got %d runs", runs.Load())
+	}
+
+	m.Resume()
+	if _, err := m.FireNext("sync"); err != nil {
+		t.Fatalf("FireNext failed: %v", err)
+	}
+	waitIdle(t, m, "sync")
+	history, _ = m.GetTaskHistory("sync")
+	if runs.Load() != 2 || history[0].Trigger != TriggerSchedule || history[0].Error != "" {
+		t.Errorf("expected the scheduled run once resumed, got %d runs and %+v", runs.Load(), history)
+	}
+}
+
+func TestPauseAPI(t *testing.T) {
+	m := NewManager()
+	defer m.Stop()
+	handler := m.APIHandler("/api")
+
+	for _, tt := range []struct {
+		path   string
+		paused bool
+	}{{"/api/tasks/pause", true}, {"/api/tasks/resume", false}} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", tt.path, nil))
+		if rec.Code != http.StatusNoContent || m.IsPaused() != tt.paused {
+			t.Errorf("POST %s: expected 204 and paused=%v, got %d and paused=%v", tt.path, tt.paused, rec.Code, m.IsPaused())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// QueuePolicy is what a run does when the queue of the runs waiting for a slot is full, see WithQueue
+type QueuePolicy int
+
+const (
+	// QueueBlock makes the run wait for a place in the queue, and skips it if none is freed before the timeout of the
+	// queue
+	QueueBlock QueuePolicy = iota
+	// QueueDrop skips the run
+	QueueDrop
+	// QueueCoalesce skips the run if one of the same task is already waiting, which stands for both, whether the queue
+	// is full or not, and skips it like QueueDrop otherwise: at most one run of a task waits
+	QueueCoalesce
+)
+
+// queuePolicies are the names of the policies, see ParseQueuePolicy
+var queuePolicies = [...]string{QueueBlock: "block", QueueDrop: "drop", QueueCoalesce: "coalesce"}
+
+func (p QueuePolicy) String() string {
+	if p < 0 || int(p) >= len(queuePolicies) {
+		return fmt.Sprintf("QueuePolicy(%d)", int(p))
+	}
+	return queuePolicies[p]
+}
+
+// ParseQueuePolicy returns the policy of a name, "block", "drop" or "coalesce", e.g. from the config
+func ParseQueuePolicy(name string) (QueuePolicy, error) {
+	for p, policyName := range queuePolicies {
+		if name == policyName {
+			return QueuePolicy(p), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown queue policy '%s', expected block, drop or coalesce", name)
+}
+
+var (
+	// errQueueFull skips a run coming to a full queue, see QueueDrop
+	errQueueFull = errors.New("the queue is full")
+	// errQueueTimeout skips a run blocked by a full queue for longer than the timeout of the queue, see QueueBlock
+	errQueueTimeout = errors.New("no place in the queue was freed in time")
+	// errCoalesced skips a run of a task already waiting in the queue, see QueueCoalesce
+	errCoalesced = errors.New("a run of the task is already waiting")
+)
+
+// Defaults of the queues, see WithQueue and WithWorkers
+const (
+	defaultQueueCapacity = 64
+	defaultQueueTimeout  = time.Minute
+	defaultWorkers       = 16
+)
+
+// WithQueue bounds the runs waiting for a slot to capacity, and tells what a run coming to a full queue does, see
+// QueuePolicy, a run blocked by a full queue being skipped after timeout
+// Every scheduled or manual run of a task waits for a slot in a goroutine of its own, the slot of its group if it has
+// a limit, see WithGroup, or one of the workers shared by the other tasks otherwise, see WithWorkers: a burst of
+// runs, e.g. of tasks allowing overlapping runs, would otherwise pile up behind them. Each group and the workers have
+// a queue of their own. A capacity or a timeout that isn't positive is the default, 64 runs and a minute, and the
+// default policy is QueueBlock. The runs skipped are recorded in the history of their task like the other skipped
+// runs, and the runs waiting and skipped are counted in the statistics, see GroupStats and WorkerStats.
+func (m *Manager) WithQueue(capacity int, policy QueuePolicy, timeout time.Duration) *Manager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queueCapacity, m.queueTimeout = queueDefaults(capacity, timeout)
+	m.queuePolicy = policy
+	for _, sem := range m.groups {
+		sem.setQueue(m.queueCapacity, m.queuePolicy, m.queueTimeout)
+	}
+	if m.workers != nil {
+		m.workers.setQueue(m.queueCapacity, m.queuePolicy, m.queueTimeout)
+	}
+	return m
+}
+
+// WithWorkers sets the number of runs in progress at a time of the tasks without a group with a limit, 16 by default
+// or if n isn't positive
+// The runs of these tasks wait for a worker in the queue of the workers, see WithQueue.
+func (m *Manager) WithWorkers(n int) *Manager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.workerLimit = n
+	if n <= 0 {
+		m.workerLimit = defaultWorkers
+	}
+	if m.workers != nil {
+		m.workers.setLimit(m.workerLimit)
+	}
+	return m
+}
+
+// queueDefaults returns the capacity and the timeout of a queue, the default ones for the ones that aren't positive
+func queueDefaults(capacity int, timeout time.Duration) (int, time.Duration) {
+	if capacity <= 0 {
+		capacity = defaultQueueCapacity
+	}
+	if timeout <= 0 {
+		timeout = defaultQueueTimeout
+	}
+	return capacity, timeout
+}
+
+// WorkerStats are the statistics of the workers running the tasks without a group with a limit, see WithWorkers
+type WorkerStats struct {
+	// Workers is the number of runs in progress at a time, and Running the number of runs in progress
+	Workers int `json:"workers"`
+	Running int `json:"running"`
+	QueueStats
+}
+
+// QueueStats are the statistics of a queue of runs waiting for a slot, see WithQueue
+type QueueStats struct {
+	// Queued is the number of runs waiting for a slot, and Blocked the number of runs waiting for a place in the full
+	// queue
+	Queued  int `json:"queued"`
+	Blocked int `json:"blocked"`
+	// Dropped is the number of runs skipped by the policy of the queue since the start, or blocked for too long
+	Dropped int64 `json:"dropped"`
+}
+
+// workerStats returns the statistics of the workers, none are in use before a task without a group with a limit is
+// added
+func (m *Manager) workerStats() WorkerStats {
+	m.mu.RLock()
+	sem, limit := m.workers, m.workerLimit
+	m.mu.RUnlock()
+	if sem == nil {
+		return WorkerStats{Workers: limit}
+	}
+	running, queue := sem.stats()
+	return WorkerStats{Workers: limit, Running: running, QueueStats: queue}
+}
@@ -0,0 +1,195 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+func TestParseQueuePolicy(t *testing.T) {
+	for _, policy := range []QueuePolicy{QueueBlock, QueueDrop, QueueCoalesce} {
+		if got, err := ParseQueuePolicy(policy.String()); err != nil || got != policy {
+			t.Errorf("expected %v, got %v %v", policy, got, err)
+		}
+	}
+	if _, err := ParseQueuePolicy("fifo"); err == nil {
+		t.Error("expected an unknown policy to be an error")
+	}
+}
+
+// waitQueued waits for n runs waiting for a slot of the semaphore, and blocked ones waiting for a place in its queue
+func waitQueued(t *testing.T, sem *semaphore, n, blocked int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, queue := sem.stats(); queue.Queued == n && queue.Blocked == blocked {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_, queue := sem.stats()
+	t.Fatalf("expected %d runs queued and %d blocked, got %d and %d", n, blocked, queue.Queued, queue.Blocked)
+}
+
+func TestSemaphoreQueue(t *testing.T) {
+	stopped := make(chan struct{})
+	ctx := context.Background()
+	// acquire waits for a slot in the background, the channel receives the result
+	acquire := func(sem *semaphore, task string) chan error {
+		done := make(chan error, 1)
+		go func() { done <- sem.acquire(ctx, task, 0, stopped) }()
+		return done
+	}
+
+	sem := newSemaphore(1, realClock{})
+	sem.setQueue(1, QueueDrop, 0)
+	sem.acquire(ctx, "blocker", 0, stopped)
+	waiting := acquire(sem, "a")
+	waitQueued(t, sem, 1, 0)
+	if err := sem.acquire(ctx, "b", 0, stopped); !errors.Is(err, errQueueFull) {
+		t.Errorf("expected the run to be dropped, got %v", err)
+	}
+	sem.release()
+	if err := <-waiting; err != nil {
+		t.Errorf("expected the queued run to take the slot, got %v", err)
+	}
+
+	sem = newSemaphore(1, realClock{})
+	sem.setQueue(2, QueueCoalesce, 0)
+	sem.acquire(ctx, "blocker", 0, stopped)
+	waiting = acquire(sem, "a")
+	waitQueued(t, sem, 1, 0)
+	if err := sem.acquire(ctx, "a", 0, stopped); !errors.Is(err, errCoalesced) {
+		t.Errorf("expected the run to be coalesced, got %v", err)
+	}
+	other := acquire(sem, "b")
+	waitQueued(t, sem, 2, 0)
+	if err := sem.acquire(ctx, "c", 0, stopped); !errors.Is(err, errQueueFull) {
+		t.Errorf("expected the run to be dropped, got %v", err)
+	}
+	if _, queue := sem.stats(); queue.Dropped != 2 {
+		t.Errorf("expected 2 runs dropped, got %d", queue.Dropped)
+	}
+	sem.release()
+	<-waiting
+	sem.release()
+	<-other
+
+	// A run blocked by the full queue takes the place freed by a waiter
+	sem = newSemaphore(1, realClock{})
+	sem.setQueue(1, QueueBlock, 0)
+	sem.acquire(ctx, "blocker", 0, stopped)
+	waiting = acquire(sem, "a")
+	waitQueued(t, sem, 1, 0)
+	blocked := acquire(sem, "b")
+	waitQueued(t, sem, 1, 1)
+	sem.release()
+	if err := <-waiting; err != nil {
+		t.Errorf("expected the queued run to take the slot, got %v", err)
+	}
+	waitQueued(t, sem, 1, 0)
+	sem.release()
+	if err := <-blocked; err != nil {
+		t.Errorf("expected the blocked run to take the slot, got %v", err)
+	}
+	if _, queue := sem.stats(); queue.Dropped != 0 {
+		t.Errorf("expected no run dropped while blocking, got %d", queue.Dropped)
+	}
+
+	// A run blocked for longer than the timeout is dropped
+	clock := NewFakeClock(time.Date(2024, 6, 15, 9, 30, 0, 0, time.Local))
+	sem = newSemaphore(1, clock)
+	sem.setQueue(1, QueueBlock, time.Minute)
+	sem.acquire(ctx, "blocker", 0, stopped)
+	waiting = acquire(sem, "a")
+	waitQueued(t, sem, 1, 0)
+	blocked = acquire(sem, "b")
+	waitQueued(t, sem, 1, 1)
+	if err := clock.BlockUntil(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	if err := <-blocked; !errors.Is(err, errQueueTimeout) {
+		t.Errorf("expected the blocked run to be dropped after the timeout, got %v", err)
+	}
+	if _, queue := sem.stats(); queue.Blocked != 0 || queue.Dropped != 1 {
+		t.Errorf("unexpected statistics of the queue: %+v", queue)
+	}
+	sem.release()
+	if err := <-waiting; err != nil {
+		t.Errorf("expected the queued run to take the slot, got %v", err)
+	}
+}
+
+func TestWithQueue(t *testing.T) {
+	m := NewManager().WithQueue(1, QueueDrop, 0)
+	defer m.Stop()
+
+	release := make(chan struct{})
+	heavy := func(ctx context.Context) error {
+		<-release
+		return nil
+	}
+	for _, name := range []string{"vacuum", "reindex", "export"} {
+		m.AddTask(name, mita.Every().Day(), heavy, WithGroup("db-heavy", 1))
+	}
+
+	m.RunTaskNow("vacuum")
+	waitQueued(t, m.groups["db-heavy"], 0, 0)
+	m.RunTaskNow("reindex")
+	waitQueued(t, m.groups["db-heavy"], 1, 0)
+	m.RunTaskNow("export")
+
+	info := waitIdle(t, m, "export")
+	if history, _ := m.GetTaskHistory("export"); len(history) != 1 || history[0].Error != errQueueFull.Error() {
+		t.Errorf("expected the run to be skipped, got %+v", history)
+	}
+	if info.Skipped != 1 {
+		t.Errorf("expected 1 run skipped, got %d", info.Skipped)
+	}
+	stats := m.GetStats()["task_groups"].(map[string]GroupStats)
+	if group := stats["db-heavy"]; group.Queued != 1 || group.Dropped != 1 {
+		t.Errorf("unexpected statistics of the group: %+v", group)
+	}
+
+	close(release)
+	waitIdle(t, m, "vacuum")
+	waitIdle(t, m, "reindex")
+}
+
+func TestWithWorkers(t *testing.T) {
+	m := NewManager().WithWorkers(1).WithQueue(1, QueueCoalesce, 0)
+	defer m.Stop()
+
+	release := make(chan struct{})
+	task := func(ctx context.Context) error {
+		<-release
+		return nil
+	}
+	// The tasks without a group, or in a group without a limit, share the workers
+	m.AddTask("fetch", mita.Every().Day(), task)
+	m.AddTask("report", mita.Every().Day(), task, WithGroup("reporting", 0))
+	m.AddTask("sync", mita.Every().Day(), task)
+
+	m.RunTaskNow("fetch")
+	waitQueued(t, m.workers, 0, 0)
+	m.RunTaskNow("report")
+	waitQueued(t, m.workers, 1, 0)
+	m.RunTaskNow("sync")
+
+	waitIdle(t, m, "sync")
+	if history, _ := m.GetTaskHistory("sync"); len(history) != 1 || history[0].Error != errQueueFull.Error() {
+		t.Errorf("expected the run to be skipped, got %+v", history)
+	}
+	workers := m.GetStats()["task_workers"].(WorkerStats)
+	if workers.Workers != 1 || workers.Running != 1 || workers.Queued != 1 || workers.Dropped != 1 {
+		t.Errorf("unexpected statistics of the workers: %+v", workers)
+	}
+
+	close(release)
+	waitIdle(t, m, "fetch")
+	waitIdle(t, m, "report")
+}
@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+// Result is the outcome of the latest run of a task
+type Result struct {
+	Value      any       `json:"value"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// ResultStore keeps the latest result reported by each task
+type ResultStore struct {
+	mu      sync.RWMutex
+	results map[string]Result
+}
+
+// NewResultStore creates an empty ResultStore
+func NewResultStore() *ResultStore {
+	return &ResultStore{results: make(map[string]Result)}
+}
+
+// Record stores the result of a task, replacing the previous one
+func (s *ResultStore) Record(name string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results[name] = Result{Value: value, RecordedAt: time.Now()}
+}
+
+// Get returns the latest result of a task
+func (s *ResultStore) Get(name string) (Result, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result, ok := s.results[name]
+	return result, ok
+}
+
+// All returns the latest results of all tasks keyed by task name
+func (s *ResultStore) All() map[string]Result {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make(map[string]Result, len(s.results))
+	for name, result := range s.results {
+		results[name] = result
+	}
+	return results
+}
+
+// recordResult stores the result of the running task in the ResultStore of its context, if any
+func recordResult(ctx context.Context, value any) {
+	store, ok := GetValue(ctx, ResultsKey)
+	if !ok {
+		return
+	}
+	if name := mita.GetTaskName(ctx); name != "" {
+		store.Record(name, value)
+	}
+}
@@ -0,0 +1,26 @@
+package tasks
+
+import "testing"
+
+func TestResultStore(t *testing.T) {
+	store := NewResultStore()
+
+	if _, ok := store.Get("task"); ok {
+		t.Error("expected no result for unknown task")
+	}
+
+	store.Record("task", 1)
+	store.Record("task", 2)
+
+	result, ok := store.Get("task")
+	if !ok || result.Value != 2 {
+		t.Errorf("Get(task) = %v, %v; want 2, true", result.Value, ok)
+	}
+	if result.RecordedAt.IsZero() {
+		t.Error("expected RecordedAt to be set")
+	}
+
+	if all := store.All(); len(all) != 1 {
+		t.Errorf("expected 1 result, got %d", len(all))
+	}
+}
@@ -0,0 +1,108 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cymoo/mita"
+	"github.com/cymoo/mote/pkg/util/safego"
+)
+
+// defaultShutdownTimeout is how long Stop waits for the runs in progress by default
+const defaultShutdownTimeout = 30 * time.Second
+
+// WithShutdownTimeout makes Stop wait up to timeout for the runs in progress to end, instead of 30 seconds
+func (m *Manager) WithShutdownTimeout(timeout time.Duration) *Manager {
+	m.shutdownTimeout = timeout
+	return m
+}
+
+// Stop stops the manager, waiting for the runs in progress to end until the shutdown timeout, and saves the state
+// of the tasks, see StopContext and WithShutdownTimeout
+func (m *Manager) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancel()
+	if err := m.StopContext(ctx); err != nil {
+		m.logger.Warn("gave up waiting for the runs of tasks", "timeout", m.shutdownTimeout)
+	}
+}
+
+// StopContext stops the manager, no run starts afterwards, and waits for the runs in progress to end until ctx is
+// done, in which case it returns the error of ctx and the runs go on in the background. The state of the tasks is
+// saved either way, and the channels of Subscribe are closed.
+func (m *Manager) StopContext(ctx context.Context) error {
+	m.stopOnce.Do(func() { close(m.stopped) })
+	m.persisting.Wait()
+
+	// mita gives up waiting for the runs after 30 seconds, the Manager keeps waiting for them until ctx is done
+	stopped := make(chan struct{})
+	safego.Go("stop-tasks", func() {
+		defer close(stopped)
+		m.TaskManager.Stop()
+	})
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+	}
+	err := m.inflight.wait(ctx)
+
+	if err := m.SaveState(context.Background()); err != nil {
+		m.logger.Error("error saving the state of tasks", "error", err)
+	}
+	m.events.close()
+	return err
+}
+
+// runCounter counts the runs in progress, so that StopContext can wait for them
+type runCounter struct {
+	mu sync.Mutex
+	n  int
+	// idle is closed once no run is in progress
+	idle chan struct{}
+}
+
+func (c *runCounter) add() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.n == 0 {
+		c.idle = make(chan struct{})
+	}
+	c.n++
+}
+
+func (c *runCounter) done() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n--
+	if c.n == 0 {
+		close(c.idle)
+	}
+}
+
+// wait waits until no run is in progress, or returns the error of ctx once it is done
+func (c *runCounter) wait(ctx context.Context) error {
+	c.mu.Lock()
+	if c.n == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	idle := c.idle
+	c.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withInflight counts the run among the runs in progress until it ends, waits before it included
+func (m *Manager) withInflight(task mita.Task) mita.Task {
+	return func(ctx context.Context) error {
+		m.inflight.add()
+		defer m.inflight.done()
+		return task(ctx)
+	}
+}
@@ -0,0 +1,82 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mita"
+)
+
+func TestStopContext(t *testing.T) {
+	m := NewManager()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	m.AddTask("slow", mita.Every().Day(), func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	m.RunTaskNow("slow")
+	<-started
+
+	// The run in progress outlives the context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := m.StopContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected StopContext to give up with its context, took %v", elapsed)
+	}
+
+	// Once the run ends, stopping again returns right away
+	close(release)
+	if err := m.StopContext(context.Background()); err != nil {
+		t.Errorf("expected no run in progress, got %v", err)
+	}
+}
+
+func TestStopWaitsForRuns(t *testing.T) {
+	m := NewManager().WithShutdownTimeout(time.Second)
+
+	var ended bool
+	started := make(chan struct{})
+	m.AddTask("slow", mita.Every().Day(), func(ctx context.Context) error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		ended = true
+		return nil
+	})
+	m.RunTaskNow("slow")
+	<-started
+
+	m.Stop()
+	if !ended {
+		t.Error("expected Stop to wait for the run in progress")
+	}
+}
+
+func TestRunCounter(t *testing.T) {
+	var c runCounter
+	if err := c.wait(context.Background()); err != nil {
+		t.Fatalf("expected no run in progress, got %v", err)
+	}
+
+	c.add()
+	c.add()
+	c.done()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a run in progress, got %v", err)
+	}
+
+	go c.done()
+	if err := c.wait(context.Background()); err != nil {
+		t.Errorf("expected the runs to end, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/cymoo/mote/internal/models"
+	"github.com/cymoo/mote/pkg/util/safego"
+	"github.com/redis/go-redis/v9"
+)
+
+// StateStore saves the state of tasks, so that their statistics and whether they are enabled survive restarts
+// services.TaskStateService keeps it in SQLite and RedisStateStore in Redis.
+type StateStore interface {
+	Load(ctx context.Context) ([]models.TaskState, error)
+	Save(ctx context.Context, states []models.TaskState) error
+}
+
+// RedisStateStore keeps the state of tasks in a Redis hash, one JSON value per task
+type RedisStateStore struct {
+	client *redis.Client
+	key    string
+}
+
+func NewRedisStateStore(client *redis.Client, key string) *RedisStateStore {
+	return &RedisStateStore{client: client, key: key}
+}
+
+// Load returns the saved state of all tasks, skipping values that can't be decoded
+func (s *RedisStateStore) Load(ctx context.Context) ([]models.TaskState, error) {
+	values, err := s.client.HGetAll(ctx, s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]models.TaskState, 0, len(values))
+	for name, value := range values {
+		var state models.TaskState
+		if err := json.Unmarshal([]byte(value), &state); err != nil {
+			log.Printf("error decoding the saved state of task %q: %v", name, err)
+			continue
+		}
+		state.Name = name
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Save replaces the saved state of the given tasks
+func (s *RedisStateStore) Save(ctx context.Context, states []models.TaskState) error {
+	if len(states) == 0 {
+		return nil
+	}
+
+	values := make(map[string]any, len(states))
+	for _, state := range states {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		values[state.Name] = data
+	}
+	return s.client.HSet(ctx, s.key, values).Err()
+}
+
+// Persist restores the state of the tasks saved in the store, then saves it every interval
+// Tasks disabled before the restart are disabled again, the ones disabled by their circuit breaker until the end of
+// their cooldown. The state is also saved once a task is enabled or disabled,
+// so that a toggle made from the API survives a crash, and once more when the manager stops.
+// It must be called after the tasks are added.
+func (m *Manager) Persist(ctx context.Context, store StateStore, interval time.Duration) error {
+	states, err := store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.store = store
+	for _, state := range states {
+		if stats, ok := m.stats[state.Name]; ok {
+			stats.restored = state
+		}
+	}
+	m.mu.Unlock()
+
+	for _, state := range states {
+		if _, ok := m.stats[state.Name]; !ok || state.Enabled {
+			continue
+		}
+		// A task disabled by its circuit breaker is enabled again at the end of its cooldown, see WithCircuitBreaker
+		if state.TrippedUntil.Valid {
+			if err := m.restoreTrip(state.Name, time.UnixMilli(state.TrippedUntil.Int64)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := m.TaskManager.DisableTask(state.Name); err != nil {
+			return err
+		}
+	}
+
+	m.persisting.Add(1)
+	safego.Go("save-task-state", func() {
+		defer m.persisting.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-m.stateChanged:
+			case <-m.stopped:
+				return
+			}
+			if err := m.SaveState(context.Background()); err != nil {
+				m.logger.Error("error saving the state of tasks", "error", err)
+			}
+		}
+	})
+	return nil
+}
+
+// EnableTask enables a task, and saves the state of the tasks, see Persist
+// A task disabled by its circuit breaker is enabled before the end of its cooldown.
+func (m *Manager) EnableTask(name string) error {
+	if err := m.TaskManager.EnableTask(name); err != nil {
+		return err
+	}
+	m.endCooldown(name)
+	m.tellStateChanged()
+	return nil
+}
+
+// DisableTask disables a task, and saves the state of the tasks, see Persist
+// A run in progress goes on. A task disabled by its circuit breaker is no longer enabled at the end of its cooldown.
+func (m *Manager) DisableTask(name string) error {
+	if err := m.TaskManager.DisableTask(name); err != nil {
+		return err
+	}
+	m.endCooldown(name)
+	m.tellStateChanged()
+	return nil
+}
+
+// endCooldown forgets the cooldown of a task enabled or disabled by hand, see enableAfterCooldown
+func (m *Manager) endCooldown(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stats, ok := m.stats[name]; ok {
+		stats.trippedUntil = time.Time{}
+	}
+}
+
+// tellStateChanged has the state of the tasks saved in the background, without waiting for the next interval
+// The changes told before it's saved are saved together, e.g. the tasks of a group disabled at once.
+func (m *Manager) tellStateChanged() {
+	select {
+	case m.stateChanged <- struct{}{}:
+	default:
+	}
+}
+
+// SaveState saves the state of all tasks in the store given to Persist, if any
+func (m *Manager) SaveState(ctx context.Context) error {
+	m.mu.RLock()
+	store := m.store
+	m.mu.RUnlock()
+	if store == nil {
+		return nil
+	}
+
+	tasks := m.ListTasks()
+	states := make([]models.TaskState, len(tasks))
+	for i, task := range tasks {
+		states[i] = models.TaskState{
+			Name:       task.Name,
+			Enabled:    task.Enabled,
+			RunCount:   task.RunCount,
+			ErrorCount: task.ErrorCount,
+			Retries:    task.Retries,
+			LastError:  task.LastError,
+		}
+		if !task.LastRun.IsZero() {
+			states[i].LastRun = models.NullInt64{NullInt64: sql.NullInt64{Int64: task.LastRun.UnixMilli(), Valid: true}}
+		}
+		if !task.TrippedUntil.IsZero() {
+			states[i].TrippedUntil = models.NullInt64{NullInt64: sql.NullInt64{Int64: task.TrippedUntil.UnixMilli(), Valid: true}}
+		}
+	}
+	return store.Save(ctx, states)
+}
+
+// withRestored adds the state restored from before the restart to the state of a task
+// The counters add up, and the last run is the restored one until the task runs again.
+func withRestored(task *TaskInfo, restored models.TaskState) {
+	task.RunCount += restored.RunCount
+	task.ErrorCount += restored.ErrorCount
+	task.Retries += restored.Retries
+	if task.LastRun.IsZero() && restored.LastRun.Valid {
+		task.LastRun = time.UnixMilli(restored.LastRun.Int64)
+		task.LastError = restored.LastError
+	}
+}
@@ -4,66 +4,500 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/cymoo/mita"
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/services"
 	"github.com/cymoo/mote/pkg/fulltext"
-	"github.com/jmoiron/sqlx"
+	"github.com/cymoo/mote/pkg/util/safego"
 )
 
-// DeleteOldPosts deletes posts that were marked as deleted more than 30 days ago
+// The keys of the values the tasks of the app find in the context of their runs, see WithTypedValue
+var (
+	ConfigKey  = NewKey[*config.Config]("config")
+	DBKey      = NewKey[*services.DB]("db")
+	FTSKey     = NewKey[*fulltext.FullTextSearch]("fts")
+	UploadKey  = NewKey[*services.UploadService]("upload")
+	ResultsKey = NewKey[*ResultStore]("results")
+)
+
+// PurgeResult reports the outcome of a DeleteOldPosts run
+type PurgeResult struct {
+	// Purged is the number of posts deleted, or that would be deleted in a dry run
+	Purged       int64 `json:"purged"`
+	Deindexed    int64 `json:"deindexed"`
+	FilesDeleted int64 `json:"files_deleted"`
+	// ThumbnailsDeleted is the number of thumbnails left after their original was deleted, see
+	// services.DeleteStrayThumbnails
+	ThumbnailsDeleted int64 `json:"thumbnails_deleted"`
+	// BytesReclaimed counts the files and the thumbnails deleted
+	BytesReclaimed int64 `json:"bytes_reclaimed"`
+	DryRun         bool  `json:"dry_run"`
+}
+
+// DeleteOldPosts permanently deletes posts that were marked as deleted longer than the retention period
+// It also removes them from the full-text index and deletes the files that are no longer referenced by any post,
+// then the thumbnails whose original is gone
 func DeleteOldPosts(ctx context.Context) error {
-	db := ctx.Value(mita.CtxtKey("db")).(*sqlx.DB)
+	if pausedForBackup(ctx) {
+		return nil
+	}
+
+	db := mustValue(ctx, DBKey)
+	fts := mustValue(ctx, FTSKey)
+	cfg := mustValue(ctx, ConfigKey)
+	uploadService := mustValue(ctx, UploadKey)
+
+	postService := services.NewPostService(db)
+	before := time.Now().UTC().AddDate(0, 0, -cfg.Post.RetentionDays).UnixMilli()
+	result := PurgeResult{DryRun: cfg.Post.PurgeDryRun}
+
+	if result.DryRun {
+		count, err := postService.CountDeletedBefore(ctx, before)
+		if err != nil {
+			return fmt.Errorf("error counting old posts: %w", err)
+		}
+		result.Purged = count
+
+		thumbs, err := services.DeleteStrayThumbnails(ctx, db, uploadService, true)
+		if err != nil {
+			return fmt.Errorf("error counting stray thumbnails: %w", err)
+		}
+		result.ThumbnailsDeleted, result.BytesReclaimed = thumbs.Deleted, thumbs.BytesReclaimed
+		log.Printf("[Daily] dry run: %d posts and %d thumbnails would be deleted", count, thumbs.Deleted)
+		recordResult(ctx, result)
+		return nil
+	}
+
+	for {
+		ids, files, err := postService.PurgeDeletedBefore(ctx, before, cfg.Post.PurgeBatchSize)
+		if err != nil {
+			recordResult(ctx, result)
+			return fmt.Errorf("error deleting old posts: %w", err)
+		}
+		result.Purged += int64(len(ids))
+
+		for _, id := range ids {
+			if err := fts.Deindex(ctx, id); err != nil {
+				log.Printf("error deindexing post %d: %v", id, err)
+				continue
+			}
+			result.Deindexed++
+		}
+
+		result.BytesReclaimed += uploadService.DeleteFiles(files)
+		result.FilesDeleted += int64(len(files))
+
+		if len(ids) < cfg.Post.PurgeBatchSize {
+			break
+		}
+	}
+
+	thumbs, err := services.DeleteStrayThumbnails(ctx, db, uploadService, false)
+	if err != nil {
+		recordResult(ctx, result)
+		return fmt.Errorf("error deleting stray thumbnails: %w", err)
+	}
+	result.ThumbnailsDeleted = thumbs.Deleted
+	result.BytesReclaimed += thumbs.BytesReclaimed
+
+	if result.Purged > 0 || result.ThumbnailsDeleted > 0 {
+		log.Printf("[Daily] successfully deleted %d posts, deindexed %d, deleted %d files and %d thumbnails, reclaimed %d bytes",
+			result.Purged, result.Deindexed, result.FilesDeleted, result.ThumbnailsDeleted, result.BytesReclaimed)
+	}
+	recordResult(ctx, result)
+	return nil
+}
+
+// PurgeDeletedTags permanently deletes tags that were in the trash longer than the retention period
+func PurgeDeletedTags(ctx context.Context) error {
+	if pausedForBackup(ctx) {
+		return nil
+	}
 
-	thirtyDaysAgo := time.Now().UTC().AddDate(0, 0, -30).UnixMilli()
+	db := mustValue(ctx, DBKey)
+	cfg := mustValue(ctx, ConfigKey)
 
-	result, err := db.Exec("DELETE FROM posts WHERE deleted_at < $1", thirtyDaysAgo)
+	before := time.Now().UTC().AddDate(0, 0, -cfg.Post.TagRetentionDays).UnixMilli()
+	count, err := services.NewTagService(db).PurgeDeletedBefore(ctx, before)
 	if err != nil {
-		return fmt.Errorf("error deleting old posts: %w", err)
+		return fmt.Errorf("error purging deleted tags: %w", err)
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected > 0 {
-		log.Printf("[Daily] successfully deleted %d posts", rowsAffected)
+	if count > 0 {
+		log.Printf("[Daily] successfully purged %d deleted tags", count)
 	}
 	return nil
 }
 
-// RebuildFullTextIndex rebuilds the full-text search index for all documents
+// PruneActivities deletes the activities older than the retention period
+func PruneActivities(ctx context.Context) error {
+	if pausedForBackup(ctx) {
+		return nil
+	}
+
+	db := mustValue(ctx, DBKey)
+	cfg := mustValue(ctx, ConfigKey)
+
+	before := time.Now().UTC().AddDate(0, 0, -cfg.Post.ActivityRetentionDays).UnixMilli()
+	count, err := services.NewActivityService(db).PruneBefore(ctx, before)
+	if err != nil {
+		return fmt.Errorf("error pruning activities: %w", err)
+	}
+
+	if count > 0 {
+		log.Printf("[Daily] successfully pruned %d activities", count)
+	}
+	return nil
+}
+
+// PurgeExpiredDrafts deletes the drafts of the editor that expired
+func PurgeExpiredDrafts(ctx context.Context) error {
+	if pausedForBackup(ctx) {
+		return nil
+	}
+
+	db := mustValue(ctx, DBKey)
+	cfg := mustValue(ctx, ConfigKey)
+
+	count, err := services.NewDraftService(db, cfg.Post.DraftTTL).PurgeExpired(ctx)
+	if err != nil {
+		return fmt.Errorf("error purging expired drafts: %w", err)
+	}
+
+	if count > 0 {
+		log.Printf("[Daily] successfully purged %d expired drafts", count)
+	}
+	return nil
+}
+
+// RebuildProgress reports the progress of a RebuildFullTextIndex run
+type RebuildProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// RebuildFullTextIndex rebuilds the full-text search index from the posts that aren't deleted
+// Its progress is reported as its result, it stops when the manager stops.
 func RebuildFullTextIndex(ctx context.Context) error {
-	// Get FullTextSearch and DB from context
-	fts := ctx.Value(mita.CtxtKey("fts")).(*fulltext.FullTextSearch)
-	db := ctx.Value(mita.CtxtKey("db")).(*sqlx.DB)
+	fts := mustValue(ctx, FTSKey)
+	cfg := mustValue(ctx, ConfigKey)
+
+	source := services.NewPostService(mustValue(ctx, DBKey)).DocumentSource(cfg.Post.IndexSize)
+	report := func(done, total int) { recordResult(ctx, RebuildProgress{Done: done, Total: total}) }
+	done, err := fts.RebuildAll(ctx, source, report)
+	if err != nil {
+		return fmt.Errorf("error rebuilding the full-text index after %d documents: %w", done, err)
+	}
+
+	log.Printf("successfully rebuilt full-text index for %d documents", done)
+	return nil
+}
+
+// BackfillPostTitles extracts and stores the title and description of posts created before
+// the columns existed, so that page listings don't have to parse the content on each request
+func BackfillPostTitles(ctx context.Context) error {
+	if pausedForBackup(ctx) {
+		return nil
+	}
+
+	db := mustValue(ctx, DBKey)
+
+	count, err := services.NewPostService(db).BackfillTitles(ctx, 500)
+	if err != nil {
+		return fmt.Errorf("error backfilling post titles: %w", err)
+	}
+
+	if count > 0 {
+		log.Printf("successfully backfilled titles for %d posts", count)
+	}
+	return nil
+}
+
+// RegenerateThumbnails brings the thumbnails of uploaded images up to date with the thumbnail width and image formats
+// It is meant to be run from the task API after changing them, its progress is reported as its result.
+func RegenerateThumbnails(ctx context.Context) error {
+	if pausedForBackup(ctx) {
+		return nil
+	}
+
+	db := mustValue(ctx, DBKey)
+	upload := mustValue(ctx, UploadKey)
+	cfg := mustValue(ctx, ConfigKey)
+
+	report := func(progress services.ThumbnailProgress) { recordResult(ctx, progress) }
+	progress, err := services.RegenerateThumbnails(ctx, db, upload, cfg.Upload.ThumbRegenDelay, report)
+	if err != nil {
+		return fmt.Errorf("error regenerating thumbnails: %w", err)
+	}
+
+	recordResult(ctx, progress)
+	if progress.Regenerated > 0 || progress.Failed > 0 {
+		log.Printf("regenerated %d thumbnails, %d failed", progress.Regenerated, progress.Failed)
+	}
+	return nil
+}
+
+// indexCheckSampleSize is the number of posts and indexed documents checked per run
+const indexCheckSampleSize = 500
+
+// IndexCheckResult reports the outcome of a CheckIndexConsistency run
+type IndexCheckResult struct {
+	Checked int `json:"checked"`
+	// Missing is the number of live posts that were not indexed
+	Missing int `json:"missing"`
+	// Stale is the number of indexed documents whose post is deleted or gone
+	Stale    int `json:"stale"`
+	Repaired int `json:"repaired"`
+	// Drift is the ratio of discrepancies to checked entries
+	Drift float64 `json:"drift"`
+}
 
-	type Post struct {
-		ID      int64  `db:"id"`
-		Content string `db:"content"`
+// CheckIndexConsistency samples posts and indexed documents to verify SQLite and the full-text index agree
+// Posts are indexed in background goroutines, so a failure there leaves the index out of sync until repaired here
+func CheckIndexConsistency(ctx context.Context) error {
+	db := mustValue(ctx, DBKey)
+	fts := mustValue(ctx, FTSKey)
+	cfg := mustValue(ctx, ConfigKey)
+
+	postService := services.NewPostService(db)
+	var result IndexCheckResult
+
+	// Every sampled live post must be indexed
+	posts, err := postService.SampleIndexable(ctx, indexCheckSampleSize)
+	if err != nil {
+		return fmt.Errorf("error sampling posts: %w", err)
 	}
+	for _, post := range posts {
+		result.Checked++
+		indexed, err := fts.Indexed(ctx, post.ID)
+		if err != nil {
+			return fmt.Errorf("error checking index of post %d: %w", post.ID, err)
+		}
+		if indexed {
+			continue
+		}
 
-	// Clear existing indexes
-	if err := fts.ClearIndex(ctx); err != nil {
-		return fmt.Errorf("error clearing full-text indexes: %w", err)
+		result.Missing++
+		content, _ := services.TruncateContent(post.Content, cfg.Post.IndexSize)
+		if err := fts.Index(ctx, post.ID, content); err != nil {
+			log.Printf("error indexing post %d: %v", post.ID, err)
+			continue
+		}
+		result.Repaired++
 	}
 
-	var results []Post
+	// Every sampled indexed document must belong to a live post
+	ids, err := fts.IndexedIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing indexed documents: %w", err)
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	ids = ids[:min(len(ids), indexCheckSampleSize)]
 
-	// Fetch all posts from the database
-	err := db.SelectContext(ctx, &results, "SELECT id, content FROM posts")
+	liveIDs, err := postService.FindLiveIDs(ctx, ids)
 	if err != nil {
-		return fmt.Errorf("error fetching posts for full-text indexing: %w", err)
+		return fmt.Errorf("error checking indexed posts: %w", err)
+	}
+	live := make(map[int64]bool, len(liveIDs))
+	for _, id := range liveIDs {
+		live[id] = true
 	}
 
-	// Re-index each post
-	for _, post := range results {
-		id := post.ID
-		content := post.Content
+	for _, id := range ids {
+		result.Checked++
+		if live[id] {
+			continue
+		}
 
-		if err := fts.Index(ctx, id, content); err != nil {
-			log.Printf("error indexing document ID %d: %v", id, err)
+		result.Stale++
+		if err := fts.Deindex(ctx, id); err != nil {
+			log.Printf("error deindexing post %d: %v", id, err)
+			continue
 		}
+		result.Repaired++
+	}
+
+	if result.Checked > 0 {
+		result.Drift = float64(result.Missing+result.Stale) / float64(result.Checked)
+	}
+	if result.Missing+result.Stale > 0 {
+		log.Printf("full-text index drift %.2f%%: %d missing, %d stale, %d repaired",
+			result.Drift*100, result.Missing, result.Stale, result.Repaired)
+	}
+
+	recordResult(ctx, result)
+	return nil
+}
+
+// RecomputeChildrenCounts sets right the children counts of posts that drifted from their live children
+func RecomputeChildrenCounts(ctx context.Context) error {
+	if pausedForBackup(ctx) {
+		return nil
 	}
 
-	log.Printf("successfully rebuilt full-text index for %d documents", len(results))
+	db := mustValue(ctx, DBKey)
+
+	report, err := services.NewPostService(db).RecomputeChildrenCounts(ctx, false)
+	if err != nil {
+		return fmt.Errorf("error recomputing children counts: %w", err)
+	}
 
+	if len(report.Drifts) > 0 {
+		log.Printf("[Daily] fixed the children count of %d posts", len(report.Drifts))
+	}
+	recordResult(ctx, *report)
 	return nil
 }
+
+// StopTokenResult reports the outcome of a ManageStopTokens run
+type StopTokenResult struct {
+	// Frequent are the tokens found in more documents than the configured ratio
+	Frequent []fulltext.TokenStat `json:"frequent"`
+	Promoted int                  `json:"promoted"`
+	// Pruned is the number of document sets deleted for stop tokens
+	Pruned int64 `json:"pruned"`
+}
+
+// ManageStopTokens looks for the tokens contained in too many documents, which make queries slow to intersect and rank
+// They are reported, and promoted to stop tokens if configured to, pruning their document sets
+func ManageStopTokens(ctx context.Context) error {
+	fts := mustValue(ctx, FTSKey)
+	cfg := mustValue(ctx, ConfigKey)
+
+	count, err := fts.GetDocCount(ctx)
+	if err != nil {
+		return fmt.Errorf("error counting documents: %w", err)
+	}
+	// Every token looks frequent in a small index
+	if count < cfg.Search.StopTokenMinDocs {
+		return nil
+	}
+
+	var result StopTokenResult
+	result.Frequent, err = fts.FrequentTokens(ctx, cfg.Search.StopTokenRatio)
+	if err != nil {
+		return fmt.Errorf("error finding frequent tokens: %w", err)
+	}
+
+	if cfg.Search.PromoteStopTokens && len(result.Frequent) > 0 {
+		if err := fts.PromoteStopTokens(ctx, result.Frequent); err != nil {
+			return fmt.Errorf("error promoting stop tokens: %w", err)
+		}
+		result.Promoted = len(result.Frequent)
+		log.Printf("[Daily] promoted %d frequent tokens to stop tokens", result.Promoted)
+	} else if len(result.Frequent) > 0 {
+		log.Printf("[Daily] %d tokens are in more than %.0f%% of documents", len(result.Frequent), cfg.Search.StopTokenRatio*100)
+	}
+
+	result.Pruned, err = fts.PruneStopTokens(ctx)
+	if err != nil {
+		return fmt.Errorf("error pruning stop tokens: %w", err)
+	}
+
+	recordResult(ctx, result)
+	return nil
+}
+
+const (
+	// linkCheckBatchSize is the number of links checked per run
+	linkCheckBatchSize = 200
+	// linkCheckInterval is how long a link check stays valid
+	linkCheckInterval = 7 * 24 * time.Hour
+	linkCheckWorkers  = 4
+	linkCheckTimeout  = 15 * time.Second
+)
+
+// LinkCheckResult reports the outcome of a CheckLinks run
+type LinkCheckResult struct {
+	Links   int `json:"links"`
+	Checked int `json:"checked"`
+	Broken  int `json:"broken"`
+	// Removed is the number of checks deleted because no post links to them anymore
+	Removed int64 `json:"removed"`
+}
+
+// CheckLinks requests the external links found in posts and records their status
+// Links are rechecked once their last check is older than a week, the least recently checked first
+func CheckLinks(ctx context.Context) error {
+	db := mustValue(ctx, DBKey)
+	cfg := mustValue(ctx, ConfigKey)
+
+	linkService := services.NewLinkService(db)
+	var result LinkCheckResult
+
+	links, err := linkService.FindLinks(ctx)
+	if err != nil {
+		return fmt.Errorf("error finding links: %w", err)
+	}
+	result.Links = len(links)
+
+	if result.Removed, err = linkService.PruneChecks(ctx, links); err != nil {
+		return fmt.Errorf("error pruning link checks: %w", err)
+	}
+
+	before := time.Now().Add(-linkCheckInterval).UnixMilli()
+	due, err := linkService.DueForCheck(ctx, links, before, linkCheckBatchSize)
+	if err != nil {
+		return fmt.Errorf("error selecting links to check: %w", err)
+	}
+
+	client := &http.Client{Timeout: linkCheckTimeout}
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	// A link whose check panics is skipped, the worker goes on with the others so that the links are all consumed
+	checkLink := func(link string) {
+		defer safego.Recover("check-links")
+		status, checkErr := services.CheckLink(ctx, client, cfg.Clip.UserAgent, link)
+		if err := linkService.SaveCheck(ctx, link, status, checkErr); err != nil {
+			log.Printf("error saving check of %s: %v", link, err)
+			return
+		}
+		mu.Lock()
+		result.Checked++
+		if services.IsBrokenStatus(status) {
+			result.Broken++
+		}
+		mu.Unlock()
+	}
+	for range linkCheckWorkers {
+		wg.Add(1)
+		safego.Go("check-links", func() {
+			defer wg.Done()
+			for link := range jobs {
+				checkLink(link)
+			}
+		})
+	}
+
+	for _, link := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- link
+	}
+	close(jobs)
+	wg.Wait()
+
+	if result.Broken > 0 {
+		log.Printf("checked %d links, %d broken", result.Checked, result.Broken)
+	}
+	recordResult(ctx, result)
+	return ctx.Err()
+}
+
+// pausedForBackup reports whether a write-heavy task must be skipped because the backup window is open
+func pausedForBackup(ctx context.Context) bool {
+	cfg := mustValue(ctx, ConfigKey)
+	if !cfg.DB.InBackupWindow(time.Now()) {
+		return false
+	}
+	log.Printf("task %s paused during the backup window %s", mita.GetTaskName(ctx), cfg.DB.BackupWindow)
+	return true
+}
@@ -0,0 +1,61 @@
+package tasks
+
+import (
+	"context"
+
+	"github.com/cymoo/mita"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans of task runs
+const tracerName = "github.com/cymoo/mote/internal/tasks"
+
+// Outcomes of a run, recorded on its span
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+	outcomeSkipped = "skipped"
+)
+
+// withSpan runs the task in a span of the tracer of the global provider, a no-op until the app sets one
+// The span is in the context of the task, so the DB and Redis calls it makes are traced as its children.
+func withSpan(name string, schedule mita.Schedule, task mita.Task) mita.Task {
+	tracer := otel.Tracer(tracerName)
+	attrs := []attribute.KeyValue{attribute.String("task.name", name)}
+	if schedule != nil {
+		attrs = append(attrs, attribute.String("task.schedule", schedule.String()))
+	}
+
+	return func(ctx context.Context) error {
+		ctx, span := tracer.Start(ctx, "task "+name,
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithAttributes(attrs...),
+			trace.WithAttributes(attribute.String("task.run_id", GetRunID(ctx))),
+		)
+		defer span.End()
+
+		err := task(ctx)
+		// A successful or skipped run records its outcome itself, as a skipped run returns no error
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			setOutcome(ctx, outcomeFailure)
+		}
+		return err
+	}
+}
+
+// setOutcome records the outcome of the run on its span
+func setOutcome(ctx context.Context, outcome string) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("task.outcome", outcome))
+}
+
+// setAttempt records an attempt of the run on its span, with the trigger of the run
+func setAttempt(ctx context.Context, attempt int, trigger string) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("task.attempt", attempt), attribute.String("task.trigger", trigger))
+	span.AddEvent("attempt", trace.WithAttributes(attribute.Int("task.attempt", attempt)))
+}
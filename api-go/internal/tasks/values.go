@@ -0,0 +1,47 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cymoo/mita"
+)
+
+// Key is the name of a value injected into the context of the runs, with the type of the value, see NewKey
+type Key[T any] struct {
+	name string
+}
+
+// NewKey creates the key of a value of type T injected into the context of the runs, e.g.
+// NewKey[*sqlx.DB]("db")
+// A value set with mita.WithContextValue or SetContextValue under the same name is read with the key as well.
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name: name}
+}
+
+// Name returns the name of the key
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// WithTypedValue injects a value into the context of the runs of all tasks, like mita.WithContextValue but checked
+// against the type of the key, see GetValue
+func WithTypedValue[T any](key Key[T], value T) mita.Option {
+	return mita.WithContextValue(key.name, value)
+}
+
+// GetValue returns the value injected into the context of a run under a key, and whether it was found with the type
+// of the key
+func GetValue[T any](ctx context.Context, key Key[T]) (T, bool) {
+	value, ok := ctx.Value(mita.CtxtKey(key.name)).(T)
+	return value, ok
+}
+
+// mustValue returns the value injected into the context of a run under a key, and panics if it is missing
+func mustValue[T any](ctx context.Context, key Key[T]) T {
+	value, ok := GetValue(ctx, key)
+	if !ok {
+		panic(fmt.Sprintf("no %T value named '%s' in the context of the task", value, key.name))
+	}
+	return value
+}
@@ -0,0 +1,31 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cymoo/mita"
+)
+
+func TestTypedValues(t *testing.T) {
+	limitKey := NewKey[int]("limit")
+	nameKey := NewKey[string]("name")
+	m := NewManager(WithTypedValue(limitKey, 42))
+	m.SetContextValue("name", "pebble")
+	defer m.Stop()
+
+	got := make(chan [3]any, 1)
+	m.AddTask("read", mita.Every().Hour(), func(ctx context.Context) error {
+		limit, _ := GetValue(ctx, limitKey)
+		name, _ := GetValue(ctx, nameKey)
+		_, ok := GetValue(ctx, NewKey[string]("limit"))
+		got <- [3]any{limit, name, ok}
+		return nil
+	})
+	if err := m.RunTaskNow("read"); err != nil {
+		t.Fatalf("RunTaskNow failed: %v", err)
+	}
+	if values := <-got; values != [3]any{42, "pebble", false} {
+		t.Errorf("expected 42, pebble and a mismatched type, got %v", values)
+	}
+}
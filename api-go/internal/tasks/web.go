@@ -0,0 +1,389 @@
+package tasks
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// durationsTemplate is the table of the durations of the runs added to the statistics page of mita
+var durationsTemplate = template.Must(template.New("durations").Funcs(template.FuncMap{
+	"duration": formatDuration,
+	"barHeight": func(d, longest time.Duration) int {
+		if longest <= 0 {
+			return 2
+		}
+		return max(int(24*d/longest), 2)
+	},
+}).Parse(`
+        <div class="tasks-table">
+            <h2>Run Durations</h2>
+            {{if .}}
+            <table>
+                <thead>
+                    <tr>
+                        <th>Task Name</th>
+                        <th>Min</th>
+                        <th>Avg</th>
+                        <th>P95</th>
+                        <th>Max</th>
+                        <th>Last Runs</th>
+                    </tr>
+                </thead>
+                <tbody>
+                    {{range .}}
+                    <tr>
+                        <td><strong>{{.Name}}</strong></td>
+                        {{if .Count}}
+                        <td>{{duration .Min}}</td>
+                        <td>{{duration .Avg}}</td>
+                        <td>{{duration .P95}}</td>
+                        <td>{{duration .Max}}</td>
+                        <td>
+                            <div style="display: flex; align-items: flex-end; gap: 2px; height: 24px;">
+                                {{$longest := .Longest}}{{range .Oldest}}<div title="{{duration .}}" style="width: 6px; height: {{barHeight . $longest}}px; background: #667eea;"></div>{{end}}
+                            </div>
+                        </td>
+                        {{else}}
+                        <td colspan="5">No run yet</td>
+                        {{end}}
+                    </tr>
+                    {{end}}
+                </tbody>
+            </table>
+            {{else}}
+            <p style="text-align: center; color: #999; padding: 40px;">No task data available</p>
+            {{end}}
+        </div>
+`))
+
+// labelsTemplate is the table of the statistics of the tasks by label added to the statistics page of mita
+var labelsTemplate = template.Must(template.New("labels").Parse(`
+        <div class="tasks-table">
+            <h2>Labels</h2>
+            <table>
+                <thead>
+                    <tr>
+                        <th>Label</th>
+                        <th>Tasks</th>
+                        <th>Enabled</th>
+                        <th>Running</th>
+                        <th>Runs</th>
+                        <th>Errors</th>
+                        <th>Skipped</th>
+                    </tr>
+                </thead>
+                <tbody>
+                    {{range .}}
+                    <tr>
+                        <td><a href="?label={{.Name}}"><strong>{{.Name}}</strong></a></td>
+                        <td>{{.Tasks}}</td>
+                        <td>{{.Enabled}}</td>
+                        <td>{{.Running}}</td>
+                        <td>{{.RunCount}}</td>
+                        <td>{{.ErrorCount}}</td>
+                        <td>{{.Skipped}}</td>
+                    </tr>
+                    {{end}}
+                </tbody>
+            </table>
+        </div>
+`))
+
+// groupsTemplate is the table of the tasks by group added to the statistics page of mita, with buttons enabling,
+// disabling or running all the tasks of a group
+var groupsTemplate = template.Must(template.New("groups").Parse(`
+        <div class="tasks-table">
+            <h2>Groups</h2>
+            <table>
+                <thead>
+                    <tr>
+                        <th>Group</th>
+                        <th>Limit</th>
+                        <th>Tasks</th>
+                        <th>Enabled</th>
+                        <th>Running</th>
+                        <th>Queued</th>
+                        <th>Dropped</th>
+                        <th>Runs</th>
+                        <th>Errors</th>
+                        <th></th>
+                    </tr>
+                </thead>
+                <tbody>
+                    {{range .}}
+                    <tr>
+                        <td><strong>{{.Name}}</strong></td>
+                        <td>{{if .Limit}}{{.Limit}}{{else}}-{{end}}</td>
+                        <td>{{.Tasks}}</td>
+                        <td>{{.Enabled}}</td>
+                        <td>{{.Running}}</td>
+                        <td>{{.Queued}}{{if .Blocked}} (+{{.Blocked}} blocked){{end}}</td>
+                        <td>{{.Dropped}}</td>
+                        <td>{{.RunCount}}</td>
+                        <td>{{.ErrorCount}}</td>
+                        <td>
+                            <div style="display: flex; gap: 4px;">
+                                <form method="post" action="groups/{{.Name}}/enable"><button type="submit">Enable</button></form>
+                                <form method="post" action="groups/{{.Name}}/disable"><button type="submit">Disable</button></form>
+                                <form method="post" action="groups/{{.Name}}/run"><button type="submit">Run now</button></form>
+                            </div>
+                        </td>
+                    </tr>
+                    {{end}}
+                </tbody>
+            </table>
+        </div>
+`))
+
+// workersTemplate is the table of the workers running the tasks without a group with a limit added to the statistics
+// page of mita, see WorkerStats
+var workersTemplate = template.Must(template.New("workers").Parse(`
+        <div class="tasks-table">
+            <h2>Workers</h2>
+            <table>
+                <thead>
+                    <tr>
+                        <th>Workers</th>
+                        <th>Running</th>
+                        <th>Queued</th>
+                        <th>Dropped</th>
+                    </tr>
+                </thead>
+                <tbody>
+                    <tr>
+                        <td>{{.Workers}}</td>
+                        <td>{{.Running}}</td>
+                        <td>{{.Queued}}{{if .Blocked}} (+{{.Blocked}} blocked){{end}}</td>
+                        <td>{{.Dropped}}</td>
+                    </tr>
+                </tbody>
+            </table>
+        </div>
+`))
+
+// groupActions are the actions on all the tasks of a group of the statistics page, by the name in their URL
+func (m *Manager) groupActions() map[string]func(group string) error {
+	return map[string]func(group string) error{
+		"enable":  m.EnableGroup,
+		"disable": m.DisableGroup,
+		"run":     m.RunGroupNow,
+	}
+}
+
+// taskActions are the actions on a task of the task list page, by the action posted with its name
+// mita would call the ones of the embedded TaskManager, skipping those of Manager, e.g. saving the state of the tasks.
+func (m *Manager) taskActions() map[string]func(name string) error {
+	return map[string]func(name string) error{
+		"enable":  m.EnableTask,
+		"disable": m.DisableTask,
+		"run":     m.RunTaskNow,
+		"remove":  m.RemoveTask,
+	}
+}
+
+// handleTaskAction runs an action posted from the task list page, and redirects back to it with the outcome, like
+// mita does
+func (m *Manager) handleTaskAction(w http.ResponseWriter, r *http.Request, indexURL string) {
+	name, action := r.FormValue("name"), r.FormValue("action")
+	run, ok := m.taskActions()[action]
+	if name == "" || !ok {
+		http.Error(w, "Missing or invalid name or action parameter", http.StatusBadRequest)
+		return
+	}
+
+	query := url.Values{"status": {"success"}}
+	switch err := run(name); {
+	case err != nil:
+		query.Set("status", "error")
+		query.Set("msg", fmt.Sprintf("Failed to %s task '%s': %s", action, name, err))
+	case action == "run":
+		query.Set("msg", fmt.Sprintf("Task '%s' triggered successfully", name))
+	default:
+		query.Set("msg", fmt.Sprintf("Task '%s' %sd successfully", name, action))
+	}
+	if refresh := r.URL.Query().Get("refresh"); refresh != "" {
+		query.Set("refresh", refresh)
+	}
+	http.Redirect(w, r, indexURL+"?"+query.Encode(), http.StatusSeeOther)
+}
+
+// namedGroupStats are the statistics of the tasks of a group shown on the statistics page
+type namedGroupStats struct {
+	Name string
+	GroupStats
+}
+
+// namedLabelStats are the statistics of the tasks with a label shown on the statistics page
+type namedLabelStats struct {
+	Name string
+	LabelStats
+}
+
+// taskDurations are the durations of the runs of a task shown on the statistics page
+type taskDurations struct {
+	Name string
+	DurationStats
+}
+
+// Oldest returns the recent durations from oldest to newest, the order of the bars
+func (d taskDurations) Oldest() []time.Duration {
+	durations := slices.Clone(d.Recent)
+	slices.Reverse(durations)
+	return durations
+}
+
+// Longest returns the longest of the recent durations, the height of the highest bar
+func (d taskDurations) Longest() time.Duration {
+	if len(d.Recent) == 0 {
+		return 0
+	}
+	return slices.Max(d.Recent)
+}
+
+// formatDuration rounds a duration to the millisecond, or to the microsecond below a millisecond
+func formatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// WebHandler serves the pages of mita.TaskManager.WebHandler, the statistics page showing the durations of the runs
+// of each task too, the slowest on average first, the statistics of the tasks by label, and the groups of tasks with
+// buttons enabling, disabling or running them together, posting to {baseURL}/groups/{group}/{action}, and the
+// workers running the other tasks
+// The actions on a task posted to {baseURL}/action go through Manager, see taskActions.
+// The durations are the ones of the tasks with all the labels given as ?label=db&label=maintenance, if any.
+func (m *Manager) WebHandler(baseURL string) http.Handler {
+	web := m.TaskManager.WebHandler(baseURL)
+	statsURL := "/" + strings.Trim(baseURL, "/") + "/stats"
+	if statsURL == "//stats" {
+		statsURL = "/stats"
+	}
+	groupsURL := strings.TrimSuffix(statsURL, "stats") + "groups/"
+	actionURL := strings.TrimSuffix(statsURL, "stats") + "action"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == actionURL {
+			m.handleTaskAction(w, r, strings.TrimSuffix(statsURL, "stats"))
+			return
+		}
+		if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, groupsURL) {
+			group, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, groupsURL), "/")
+			run, ok := m.groupActions()[action]
+			if !ok || len(m.groupTasks(group)) == 0 {
+				http.NotFound(w, r)
+				return
+			}
+			if err := run(group); err != nil {
+				m.logger.Warn("error on the tasks of a group", "group", group, "action", action, "error", err)
+			}
+			http.Redirect(w, r, statsURL, http.StatusSeeOther)
+			return
+		}
+		if r.Method != http.MethodGet || r.URL.Path != statsURL {
+			web.ServeHTTP(w, r)
+			return
+		}
+
+		tasks := m.ListTasks(r.URL.Query()["label"]...)
+		durations := make([]taskDurations, len(tasks))
+		for i, task := range tasks {
+			durations[i] = taskDurations{Name: task.Name, DurationStats: task.Durations}
+		}
+		slices.SortFunc(durations, func(a, b taskDurations) int {
+			return cmp.Or(cmp.Compare(b.Avg, a.Avg), strings.Compare(a.Name, b.Name))
+		})
+		var labels []namedLabelStats
+		for name, stats := range labelStats(m.ListTasks()) {
+			labels = append(labels, namedLabelStats{Name: name, LabelStats: stats})
+		}
+		slices.SortFunc(labels, func(a, b namedLabelStats) int { return strings.Compare(a.Name, b.Name) })
+		var groups []namedGroupStats
+		for name, stats := range m.groupStats(m.ListTasks()) {
+			groups = append(groups, namedGroupStats{Name: name, GroupStats: stats})
+		}
+		slices.SortFunc(groups, func(a, b namedGroupStats) int { return strings.Compare(a.Name, b.Name) })
+
+		var table bytes.Buffer
+		if err := durationsTemplate.Execute(&table, durations); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(labels) > 0 {
+			if err := labelsTemplate.Execute(&table, labels); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if len(groups) > 0 {
+			if err := groupsTemplate.Execute(&table, groups); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := workersTemplate.Execute(&table, m.workerStats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rewritePage(w, r, web, func(page []byte) []byte {
+			// The table goes at the end of the container of the page, after the table of the executions
+			end := bytes.LastIndex(page, []byte("</body>"))
+			if end < 0 {
+				return page
+			}
+			return insertAt(page, bytes.LastIndex(page[:end], []byte("</div>")), table.Bytes())
+		})
+	})
+}
+
+// rewritePage serves a page of the handler, rewritten by rewrite if it is an HTML page
+func rewritePage(w http.ResponseWriter, r *http.Request, h http.Handler, rewrite func([]byte) []byte) {
+	page := &pageRecorder{header: w.Header(), code: http.StatusOK}
+	h.ServeHTTP(page, r)
+
+	body := page.body.Bytes()
+	if page.code == http.StatusOK && strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		body = rewrite(body)
+	}
+	w.Header().Del("Content-Length")
+	w.WriteHeader(page.code)
+	w.Write(body)
+}
+
+// insertAt inserts the fragment in the page at the index, the page is unchanged for a negative index
+func insertAt(page []byte, i int, fragment []byte) []byte {
+	if i < 0 {
+		return page
+	}
+	return slices.Concat(page[:i], fragment, page[i:])
+}
+
+// pageRecorder keeps a page in memory, so that it can be rewritten before it's sent
+type pageRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (p *pageRecorder) Header() http.Header { return p.header }
+
+func (p *pageRecorder) WriteHeader(code int) {
+	if !p.wrote {
+		p.code, p.wrote = code, true
+	}
+}
+
+func (p *pageRecorder) Write(b []byte) (int, error) {
+	p.WriteHeader(http.StatusOK)
+	return p.body.Write(b)
+}
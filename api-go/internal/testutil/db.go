@@ -0,0 +1,73 @@
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cymoo/mote/assets"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+// dbCount names the in-memory databases, so that each test has its own
+var dbCount atomic.Int64
+
+// NewDB opens an in-memory SQLite database of its own for the test, with the schema of the embedded migrations
+// The database is closed when the test ends.
+func NewDB(t testing.TB) *sqlx.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:testdb%d?mode=memory&cache=shared&_pragma=foreign_keys(1)", dbCount.Add(1))
+	db, err := sqlx.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// One connection keeps the database alive until it's closed, and serializes the writes like the app does
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return db
+}
+
+// Migrate applies the embedded migrations to the database, like the app does on start
+func Migrate(db *sqlx.DB) error {
+	source, err := iofs.New(assets.MigrationFS(), "migrations")
+	if err != nil {
+		return fmt.Errorf("failed to create iofs driver: %w", err)
+	}
+	driver, err := sqlite.WithInstance(db.DB, &sqlite.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to create sqlite driver: %w", err)
+	}
+	// The migrator isn't closed, as it would close the database
+	migrator, err := migrate.NewWithInstance("iofs", source, "sqlite", driver)
+	if err != nil {
+		return fmt.Errorf("failed to create migrator: %w", err)
+	}
+
+	if err := migrator.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	return nil
+}
+
+// Tx begins a transaction rolled back when the test ends, so that the test leaves the database as it found it
+// The transaction holds the only connection of a database from NewDB: the test must use it rather than the database.
+func Tx(t testing.TB, db *sqlx.DB) *sqlx.Tx {
+	t.Helper()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
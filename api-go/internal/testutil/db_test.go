@@ -0,0 +1,62 @@
+package testutil
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+)
+
+func TestNewDB(t *testing.T) {
+	db := NewDB(t)
+
+	// The schema is the one of the last migration
+	var depth int64
+	if err := db.Get(&depth, "SELECT COUNT(*) FROM pragma_table_info('posts') WHERE name = 'depth'"); err != nil || depth != 1 {
+		t.Fatalf("expected the posts to have a depth, got %d: %v", depth, err)
+	}
+
+	// Each test has its own database
+	CreatePost(t, db, models.Post{})
+	var count int
+	if err := NewDB(t).Get(&count, "SELECT COUNT(*) FROM posts"); err != nil || count != 0 {
+		t.Errorf("expected another database to be empty, got %d posts: %v", count, err)
+	}
+}
+
+func TestTx(t *testing.T) {
+	db := NewDB(t)
+
+	t.Run("rolled back", func(t *testing.T) {
+		tx := Tx(t, db)
+		post := CreatePost(t, tx, models.Post{Content: "draft"})
+		tag := CreateTag(t, tx, models.Tag{Name: "go"})
+		TagPost(t, tx, tag.ID, post.ID)
+	})
+
+	var count int
+	if err := db.Get(&count, "SELECT COUNT(*) FROM posts"); err != nil || count != 0 {
+		t.Errorf("expected the posts to be rolled back, got %d: %v", count, err)
+	}
+}
+
+func TestCreateFile(t *testing.T) {
+	upload := &config.UploadConfig{BaseURL: "/uploads", BasePath: t.TempDir()}
+
+	file := CreateFile(t, upload, "2024/a.png", []byte("png"))
+	if file.URL != "/uploads/2024/a.png" || file.Size == nil || *file.Size != 3 {
+		t.Errorf("expected the URL and size of the file, got %+v", file)
+	}
+	if _, err := os.Stat(filepath.Join(upload.BasePath, "2024", "a.png")); err != nil {
+		t.Errorf("expected the file to be written: %v", err)
+	}
+
+	post := CreatePost(t, NewDB(t), models.Post{Files: Files(t, file)})
+	var files []models.FileInfo
+	if err := json.Unmarshal(post.Files.RawMessage, &files); err != nil || len(files) != 1 || files[0].URL != file.URL {
+		t.Errorf("expected the post to have the file, got %s", post.Files.RawMessage)
+	}
+}
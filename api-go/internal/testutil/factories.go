@@ -0,0 +1,107 @@
+package testutil
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cymoo/mote/internal/config"
+	"github.com/cymoo/mote/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreatePost inserts a post with the given fields, a database or a transaction, and returns it with its ID
+// Its content defaults to "post" and its timestamps to now.
+func CreatePost(t testing.TB, db sqlx.ExtContext, post models.Post) models.Post {
+	t.Helper()
+
+	if post.Content == "" {
+		post.Content = "post"
+	}
+	now := time.Now().UnixMilli()
+	if post.CreatedAt == 0 {
+		post.CreatedAt = now
+	}
+	if post.UpdatedAt == 0 {
+		post.UpdatedAt = post.CreatedAt
+	}
+	var files any
+	if post.Files.Valid {
+		files = string(post.Files.RawMessage)
+	}
+
+	query := `INSERT INTO posts (content, title, description, files, color, shared, deleted_at, created_at, updated_at,
+	                             parent_id, children_count, root_id, depth)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	err := db.QueryRowxContext(context.Background(), query,
+		post.Content, post.Title, post.Description, files, post.Color, post.Shared, post.DeletedAt,
+		post.CreatedAt, post.UpdatedAt, post.ParentID, post.ChildrenCount, post.RootID, post.Depth,
+	).Scan(&post.ID)
+	if err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	return post
+}
+
+// CreateTag inserts a tag with the given fields and returns it with its ID, its timestamps default to now
+func CreateTag(t testing.TB, db sqlx.ExtContext, tag models.Tag) models.Tag {
+	t.Helper()
+
+	now := time.Now().UnixMilli()
+	if tag.CreatedAt == 0 {
+		tag.CreatedAt = now
+	}
+	if tag.UpdatedAt == 0 {
+		tag.UpdatedAt = tag.CreatedAt
+	}
+
+	query := `INSERT INTO tags (name, sticky, created_at, updated_at, deleted_at, merged_into)
+	          VALUES (?, ?, ?, ?, ?, ?) RETURNING id`
+	err := db.QueryRowxContext(context.Background(), query,
+		tag.Name, tag.Sticky, tag.CreatedAt, tag.UpdatedAt, tag.DeletedAt, tag.MergedInto,
+	).Scan(&tag.ID)
+	if err != nil {
+		t.Fatalf("failed to create tag: %v", err)
+	}
+	return tag
+}
+
+// TagPost associates a tag with a post
+func TagPost(t testing.TB, db sqlx.ExtContext, tagID, postID int64) {
+	t.Helper()
+
+	query := `INSERT INTO tag_post_assoc (tag_id, post_id) VALUES (?, ?)`
+	if _, err := db.ExecContext(context.Background(), query, tagID, postID); err != nil {
+		t.Fatalf("failed to associate tag and post: %v", err)
+	}
+}
+
+// CreateFile writes an uploaded file under the base path of the config, and returns it as attached to a post
+func CreateFile(t testing.TB, config *config.UploadConfig, name string, data []byte) models.FileInfo {
+	t.Helper()
+
+	path := filepath.Join(config.BasePath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create upload directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	size := uint64(len(data))
+	return models.FileInfo{URL: config.BaseURL + "/" + name, Size: &size}
+}
+
+// Files returns the files attached to a post, to set models.Post.Files
+func Files(t testing.TB, files ...models.FileInfo) models.NullRawMessage {
+	t.Helper()
+
+	data, err := json.Marshal(files)
+	if err != nil {
+		t.Fatalf("failed to encode files: %v", err)
+	}
+	return models.NullRawMessage{RawMessage: data, Valid: true}
+}
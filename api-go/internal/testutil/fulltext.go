@@ -0,0 +1,152 @@
+// Package testutil provides test doubles of the dependencies of the app, so that handlers, services
+// and tasks can be tested without Redis, and fixtures on a database with the schema of the migrations
+package testutil
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cymoo/mote/pkg/fulltext"
+)
+
+// FakeIndex is an in-memory fulltext.Index, safe for concurrent use
+// It matches documents like FullTextSearch, all tokens of the query or any with partial, with a simpler ranking:
+// the number of occurrences of the matching tokens, normalized by the length of the document.
+type FakeIndex struct {
+	mu        sync.RWMutex
+	tokenizer fulltext.Tokenizer
+	docs      map[int64]map[string]int
+}
+
+var _ fulltext.Index = (*FakeIndex)(nil)
+
+// NewFakeIndex creates an empty FakeIndex analyzing text with the given tokenizer, WhitespaceTokenizer if nil
+func NewFakeIndex(tokenizer fulltext.Tokenizer) *FakeIndex {
+	if tokenizer == nil {
+		tokenizer = WhitespaceTokenizer{}
+	}
+	return &FakeIndex{tokenizer: tokenizer, docs: make(map[int64]map[string]int)}
+}
+
+// htmlTag matches the tags of the content of a post, which aren't tokens
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// WhitespaceTokenizer splits text on whitespace, analyzing it in lower case
+// The HTML tags are dropped, like the tokenizers of fulltext do, so that the content of a post can be indexed.
+type WhitespaceTokenizer struct{}
+
+func (WhitespaceTokenizer) Cut(text string) []string {
+	return strings.Fields(htmlTag.ReplaceAllString(text, " "))
+}
+
+func (WhitespaceTokenizer) Analyze(text string) []string {
+	return strings.Fields(strings.ToLower(htmlTag.ReplaceAllString(text, " ")))
+}
+
+func (f *FakeIndex) Index(ctx context.Context, id int64, text string) error {
+	tokens := f.tokenizer.Analyze(text)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// A text without tokens isn't indexed, like with FullTextSearch
+	if len(tokens) == 0 {
+		delete(f.docs, id)
+		return nil
+	}
+	freq := make(map[string]int, len(tokens))
+	for _, token := range tokens {
+		freq[token]++
+	}
+	f.docs[id] = freq
+	return nil
+}
+
+func (f *FakeIndex) Reindex(ctx context.Context, id int64, text string) error {
+	return f.Index(ctx, id, text)
+}
+
+func (f *FakeIndex) Deindex(ctx context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.docs, id)
+	return nil
+}
+
+func (f *FakeIndex) Indexed(ctx context.Context, id int64) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, ok := f.docs[id]
+	return ok, nil
+}
+
+func (f *FakeIndex) IndexedIDs(ctx context.Context) ([]int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	ids := make([]int64, 0, len(f.docs))
+	for id := range f.docs {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (f *FakeIndex) GetDocCount(ctx context.Context) (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return int64(len(f.docs)), nil
+}
+
+func (f *FakeIndex) ClearIndex(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.docs = make(map[int64]map[string]int)
+	return nil
+}
+
+func (f *FakeIndex) Tokenizer() fulltext.Tokenizer {
+	return f.tokenizer
+}
+
+func (f *FakeIndex) Search(ctx context.Context, query string, partial bool, limit int) ([]string, []fulltext.SearchResult, error) {
+	tokens := f.tokenizer.Analyze(query)
+	results := []fulltext.SearchResult{}
+	if len(tokens) == 0 {
+		return tokens, results, nil
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for id, freq := range f.docs {
+		matching, occurrences, total := 0, 0, 0
+		for _, token := range tokens {
+			if freq[token] > 0 {
+				matching++
+				occurrences += freq[token]
+			}
+		}
+		if matching == 0 || (!partial && matching < len(tokens)) {
+			continue
+		}
+		for _, count := range freq {
+			total += count
+		}
+		results = append(results, fulltext.SearchResult{ID: id, Score: float64(occurrences) / math.Sqrt(float64(total))})
+	}
+
+	// Ties are broken by ID, so that results are stable
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return tokens, results, nil
+}
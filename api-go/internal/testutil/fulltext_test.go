@@ -0,0 +1,59 @@
+package testutil
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestFakeIndex(t *testing.T) {
+	ctx := context.Background()
+	index := NewFakeIndex(nil)
+
+	index.Index(ctx, 1, "Go channels and goroutines")
+	index.Index(ctx, 2, "Rust ownership")
+	index.Index(ctx, 3, "go go go")
+	index.Index(ctx, 4, "   ")
+
+	if count, _ := index.GetDocCount(ctx); count != 3 {
+		t.Errorf("expected 3 documents, a blank one isn't indexed, got %d", count)
+	}
+
+	tokens, results, err := index.Search(ctx, "GO channels", false, 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if !slices.Equal(tokens, []string{"go", "channels"}) {
+		t.Errorf("expected the analyzed tokens, got %v", tokens)
+	}
+	if len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("expected all tokens to match, got %+v", results)
+	}
+
+	_, results, _ = index.Search(ctx, "go channels", true, 0)
+	if len(results) != 2 || results[0].ID != 3 {
+		t.Errorf("expected any token to match, the most frequent first, got %+v", results)
+	}
+	_, results, _ = index.Search(ctx, "go channels", true, 1)
+	if len(results) != 1 {
+		t.Errorf("expected the results to be limited, got %+v", results)
+	}
+
+	index.Reindex(ctx, 3, "rust")
+	index.Deindex(ctx, 1)
+	if ids, _ := index.IndexedIDs(ctx); !slices.Equal(ids, []int64{2, 3}) {
+		t.Errorf("expected documents 2 and 3, got %v", ids)
+	}
+	if _, results, _ = index.Search(ctx, "go", false, 0); len(results) != 0 {
+		t.Errorf("expected no match after reindexing, got %+v", results)
+	}
+
+	if tokens := (WhitespaceTokenizer{}).Analyze("<p>Hello <b>World</b></p>"); !slices.Equal(tokens, []string{"hello", "world"}) {
+		t.Errorf("expected the HTML tags to be dropped, got %v", tokens)
+	}
+
+	index.ClearIndex(ctx)
+	if indexed, _ := index.Indexed(ctx, 2); indexed {
+		t.Error("expected the index to be cleared")
+	}
+}
@@ -0,0 +1,25 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/redis/go-redis/v9/maintnotifications"
+)
+
+// NewRedis returns a client of an in-memory Redis server of its own for the test, and the server, e.g. to move its
+// clock forward with FastForward
+// The client and the server are closed when the test ends.
+func NewRedis(t testing.TB) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	// miniredis doesn't know the handshake of the maintenance notifications
+	client := redis.NewClient(&redis.Options{
+		Addr:                     server.Addr(),
+		MaintNotificationsConfig: &maintnotifications.Config{Mode: maintnotifications.ModeDisabled},
+	})
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
@@ -0,0 +1,257 @@
+package fulltext
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Encoding is how the token frequencies of a document are stored
+type Encoding string
+
+const (
+	// EncodingJSON stores them as a JSON string
+	EncodingJSON Encoding = "json"
+	// EncodingGzip stores them as a gzipped JSON string
+	EncodingGzip Encoding = "gzip"
+	// EncodingHash stores them as a Redis hash with integer fields, compact for small documents
+	EncodingHash Encoding = "hash"
+)
+
+// gzipMagic starts every gzip stream, JSON objects start with {
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// EncodingReport reports the outcome of a MigrateEncoding run
+type EncodingReport struct {
+	Encoding  Encoding `json:"encoding"`
+	Documents int      `json:"documents"`
+	// BytesBefore and BytesAfter are the memory used by the token frequencies as reported by Redis
+	BytesBefore int64 `json:"bytes_before"`
+	BytesAfter  int64 `json:"bytes_after"`
+}
+
+// WithEncoding returns a FullTextSearch sharing the client, tokenizer and keyspace, storing documents with the encoding
+// Documents are read whatever their encoding, so that the index keeps working until MigrateEncoding is run.
+func (f *FullTextSearch) WithEncoding(encoding Encoding) *FullTextSearch {
+	copied := *f
+	copied.encoding = encoding
+	return &copied
+}
+
+// Encoding returns the encoding documents are stored with
+func (f *FullTextSearch) Encoding() Encoding {
+	if f.encoding == "" {
+		return EncodingJSON
+	}
+	return f.encoding
+}
+
+// MigrateEncoding stores all indexed documents with the encoding of f
+// onProgress, if not nil, is called after each batch with the number of documents done and their total.
+func (f *FullTextSearch) MigrateEncoding(ctx context.Context, onProgress func(done, total int)) (*EncodingReport, error) {
+	ids, err := f.IndexedIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &EncodingReport{Encoding: f.Encoding()}
+	const batchSize = 500
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+
+		before, err := f.memoryUsage(ctx, batch)
+		if err != nil {
+			return report, err
+		}
+		freqs, err := f.getTokenFreqs(ctx, batch)
+		if err != nil {
+			return report, err
+		}
+
+		pipe := f.client.TxPipeline()
+		for i, id := range batch {
+			if freqs[i] == nil {
+				continue
+			}
+			if err := f.setTokenFreq(ctx, pipe, id, freqs[i]); err != nil {
+				return report, err
+			}
+			report.Documents++
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return report, err
+		}
+
+		after, err := f.memoryUsage(ctx, batch)
+		if err != nil {
+			return report, err
+		}
+		report.BytesBefore += before
+		report.BytesAfter += after
+
+		if onProgress != nil {
+			onProgress(start+len(batch), len(ids))
+		}
+	}
+	return report, nil
+}
+
+// getTokenFreq returns the token frequencies of a document, whatever their encoding
+func (f *FullTextSearch) getTokenFreq(ctx context.Context, id int64) (TokenFrequency, error) {
+	freqs, err := f.getTokenFreqs(ctx, []int64{id})
+	if err != nil {
+		return nil, err
+	}
+	if freqs[0] == nil {
+		return nil, fmt.Errorf("token frequency of doc %d not found: %w", id, redis.Nil)
+	}
+	return freqs[0], nil
+}
+
+// getTokenFreqs returns the token frequencies of documents in one round trip, nil for a document that is not indexed
+// Documents stored with another encoding than the configured one are read again with theirs.
+func (f *FullTextSearch) getTokenFreqs(ctx context.Context, ids []int64) ([]TokenFrequency, error) {
+	pipe := f.client.Pipeline()
+	cmds := make([]redis.Cmder, len(ids))
+	for i, id := range ids {
+		cmds[i] = f.readCmd(ctx, pipe, f.Encoding() == EncodingHash, id)
+	}
+	// Errors are checked for each command
+	pipe.Exec(ctx)
+
+	freqs := make([]TokenFrequency, len(ids))
+	for i, cmd := range cmds {
+		freq, err := decodeTokenFreq(cmd)
+		if isWrongType(err) {
+			// Stored with the other kind of key, e.g. while migrating
+			retry := f.readCmd(ctx, f.client, f.Encoding() != EncodingHash, ids[i])
+			freq, err = decodeTokenFreq(retry)
+		}
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading token frequency of doc %d: %w", ids[i], err)
+		}
+		freqs[i] = freq
+	}
+	return freqs, nil
+}
+
+// readCmd reads the token frequencies of a document stored as a hash or as a string
+func (f *FullTextSearch) readCmd(ctx context.Context, c redis.Cmdable, hash bool, id int64) redis.Cmder {
+	if hash {
+		return c.HGetAll(ctx, f.docTokensKey(id))
+	}
+	return c.Get(ctx, f.docTokensKey(id))
+}
+
+// setTokenFreq queues the write of the token frequencies of a document with the configured encoding
+func (f *FullTextSearch) setTokenFreq(ctx context.Context, pipe redis.Pipeliner, id int64, freq TokenFrequency) error {
+	key := f.docTokensKey(id)
+	switch f.Encoding() {
+	case EncodingHash:
+		fields := make(map[string]any, len(freq))
+		for token, count := range freq {
+			fields[token] = count
+		}
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, fields)
+		return nil
+	case EncodingGzip:
+		data, err := json.Marshal(freq)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		pipe.Set(ctx, key, buf.Bytes(), 0)
+		return nil
+	default:
+		data, err := json.Marshal(freq)
+		if err != nil {
+			return err
+		}
+		pipe.Set(ctx, key, data, 0)
+		return nil
+	}
+}
+
+// decodeTokenFreq decodes the reply of a readCmd, it returns redis.Nil for a missing document
+func decodeTokenFreq(cmd redis.Cmder) (TokenFrequency, error) {
+	switch cmd := cmd.(type) {
+	case *redis.MapStringStringCmd:
+		fields, err := cmd.Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			return nil, redis.Nil
+		}
+		freq := make(TokenFrequency, len(fields))
+		for token, value := range fields {
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, err
+			}
+			freq[token] = count
+		}
+		return freq, nil
+	case *redis.StringCmd:
+		data, err := cmd.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(data, gzipMagic) {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			if data, err = io.ReadAll(zr); err != nil {
+				return nil, err
+			}
+		}
+		var freq TokenFrequency
+		if err := json.Unmarshal(data, &freq); err != nil {
+			return nil, err
+		}
+		return freq, nil
+	default:
+		return nil, fmt.Errorf("unexpected command %T", cmd)
+	}
+}
+
+// memoryUsage sums the memory used by the token frequencies of documents
+func (f *FullTextSearch) memoryUsage(ctx context.Context, ids []int64) (int64, error) {
+	pipe := f.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.MemoryUsage(ctx, f.docTokensKey(id))
+	}
+	pipe.Exec(ctx)
+
+	var total int64
+	for _, cmd := range cmds {
+		bytes, err := cmd.Result()
+		if err != nil && err != redis.Nil {
+			return 0, err
+		}
+		total += bytes
+	}
+	return total, nil
+}
+
+func isWrongType(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
@@ -0,0 +1,74 @@
+package fulltext
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDecodeTokenFreq(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"golang":2}`))
+	zw.Close()
+
+	cmds := map[string]redis.Cmder{
+		"json": redis.NewStringResult(`{"golang":2}`, nil),
+		"gzip": redis.NewStringResult(buf.String(), nil),
+		"hash": redis.NewMapStringStringResult(map[string]string{"golang": "2"}, nil),
+	}
+	for name, cmd := range cmds {
+		freq, err := decodeTokenFreq(cmd)
+		if err != nil || freq["golang"] != 2 {
+			t.Errorf("%s: expected golang twice, got %v, %v", name, freq, err)
+		}
+	}
+
+	if _, err := decodeTokenFreq(redis.NewMapStringStringResult(map[string]string{}, nil)); err != redis.Nil {
+		t.Errorf("expected an empty hash to be missing, got %v", err)
+	}
+}
+
+func TestFullTextSearch_MigrateEncoding(t *testing.T) {
+	client := setupTestRedis(t)
+	defer teardownTestRedis(t, client)
+
+	ctx := context.Background()
+	fts := NewFullTextSearch(client, tokenizer, "test:fts:")
+	fts.Index(ctx, 1, "golang channels")
+	fts.Index(ctx, 2, "golang generics")
+
+	for _, encoding := range []Encoding{EncodingHash, EncodingGzip, EncodingJSON} {
+		encoded := fts.WithEncoding(encoding)
+
+		// Documents are readable before they are migrated
+		_, results, err := encoded.Search(ctx, "golang", false, 0)
+		if err != nil || len(results) != 2 {
+			t.Fatalf("%s: expected 2 results before migrating, got %+v, %v", encoding, results, err)
+		}
+
+		report, err := encoded.MigrateEncoding(ctx, nil)
+		if err != nil {
+			t.Fatalf("%s: MigrateEncoding() error = %v", encoding, err)
+		}
+		if report.Documents != 2 || report.Encoding != encoding {
+			t.Errorf("%s: unexpected report %+v", encoding, report)
+		}
+
+		keyType, _ := client.Type(ctx, fts.docTokensKey(1)).Result()
+		if (encoding == EncodingHash) != (keyType == "hash") {
+			t.Errorf("%s: unexpected key type %s", encoding, keyType)
+		}
+
+		if err := encoded.Reindex(ctx, 1, "golang channels select"); err != nil {
+			t.Fatalf("%s: Reindex() error = %v", encoding, err)
+		}
+		_, results, err = encoded.Search(ctx, "golang select", false, 0)
+		if err != nil || len(results) != 1 || results[0].ID != 1 {
+			t.Errorf("%s: expected document 1, got %+v, %v", encoding, results, err)
+		}
+	}
+}
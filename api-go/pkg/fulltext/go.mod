@@ -0,0 +1,14 @@
+module github.com/cymoo/mote/pkg/fulltext
+
+go 1.25.0
+
+require (
+	github.com/go-ego/gse v0.80.3
+	github.com/redis/go-redis/v9 v9.16.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/vcaesar/cedar v0.20.2 // indirect
+)
@@ -0,0 +1,34 @@
+package fulltext
+
+import "context"
+
+// Indexer maintains the documents of a full-text index
+type Indexer interface {
+	// Index adds a document, or updates it if it is already indexed
+	Index(ctx context.Context, id int64, text string) error
+	// Reindex updates a document, or adds it if it isn't indexed
+	Reindex(ctx context.Context, id int64, text string) error
+	// Deindex removes a document
+	Deindex(ctx context.Context, id int64) error
+	Indexed(ctx context.Context, id int64) (bool, error)
+	IndexedIDs(ctx context.Context) ([]int64, error)
+	GetDocCount(ctx context.Context) (int64, error)
+	// ClearIndex removes all documents
+	ClearIndex(ctx context.Context) error
+}
+
+// Searcher queries a full-text index, see FullTextSearch.Search
+type Searcher interface {
+	Search(ctx context.Context, query string, partial bool, limit int) ([]string, []SearchResult, error)
+	// Tokenizer returns the tokenizer documents and queries are analyzed with
+	Tokenizer() Tokenizer
+}
+
+// Index is a full-text index that documents are added to and searched in
+// FullTextSearch keeps it in Redis, tests can use the in-memory one of internal/testutil.
+type Index interface {
+	Indexer
+	Searcher
+}
+
+var _ Index = (*FullTextSearch)(nil)
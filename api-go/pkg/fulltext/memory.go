@@ -0,0 +1,154 @@
+package fulltext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The classes of the keys of the index, see MemoryStats
+const (
+	// KeyClassDocuments are the token frequencies of the documents, a key per document
+	KeyClassDocuments = "documents"
+	// KeyClassPostings are the documents of the tokens, a key per token
+	KeyClassPostings = "postings"
+	// KeyClassRecent are the most recent documents of the tokens, see WithPostingLimit
+	KeyClassRecent = "recent"
+	// KeyClassMeta are the document count and the stop tokens
+	KeyClassMeta = "meta"
+	// KeyClassOther are the keys under the prefix the index doesn't write, e.g. those of a scratch index, see WithPrefix
+	KeyClassOther = "other"
+)
+
+// DefaultMemorySample is the number of keys of a class whose memory is measured by MemoryStats if not told
+const DefaultMemorySample = 200
+
+// KeyClassStats is the memory used by a class of keys of the index
+type KeyClassStats struct {
+	Class string `json:"class"`
+	Keys  int64  `json:"keys"`
+	// Sampled is the number of keys whose memory was measured, all of them if it equals Keys
+	Sampled int `json:"sampled"`
+	// Bytes is the memory used by the keys, estimated from the sampled ones unless all were
+	Bytes int64 `json:"bytes"`
+}
+
+// MemoryStats is the memory used by the index in Redis, by class of keys
+type MemoryStats struct {
+	Documents int64 `json:"documents"`
+	Tokens    int64 `json:"tokens"`
+	// Postings is the number of documents of all the tokens, the distinct tokens of every document summed, estimated
+	// like the bytes
+	Postings int64           `json:"postings"`
+	Keys     int64           `json:"keys"`
+	Bytes    int64           `json:"bytes"`
+	Classes  []KeyClassStats `json:"classes"`
+}
+
+// keyClasses are the classes in the order they are reported
+var keyClasses = []string{KeyClassDocuments, KeyClassPostings, KeyClassRecent, KeyClassMeta, KeyClassOther}
+
+// MemoryStats scans the keys of the index and measures the memory of a sample of each class with MEMORY USAGE
+// The keys are counted exactly, their bytes and the postings are estimated from the first sample keys of each class
+// the scan returns, which Redis returns in no particular order, 0 for DefaultMemorySample. The scan is incremental and
+// doesn't block Redis, but the index may change meanwhile: the figures are a soft estimate of the index as it is.
+func (f *FullTextSearch) MemoryStats(ctx context.Context, sample int) (*MemoryStats, error) {
+	if sample <= 0 {
+		sample = DefaultMemorySample
+	}
+	classes := make(map[string]*KeyClassStats, len(keyClasses))
+	samples := make(map[string][]string, len(keyClasses))
+	for _, class := range keyClasses {
+		classes[class] = &KeyClassStats{Class: class}
+	}
+
+	iter := f.client.Scan(ctx, 0, f.keyPrefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		class := f.keyClass(key)
+		classes[class].Keys++
+		if len(samples[class]) < sample {
+			samples[class] = append(samples[class], key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	pipe := f.client.Pipeline()
+	usages := make(map[string][]*redis.IntCmd, len(samples))
+	for class, keys := range samples {
+		for _, key := range keys {
+			usages[class] = append(usages[class], pipe.MemoryUsage(ctx, key))
+		}
+	}
+	cards := make([]*redis.IntCmd, len(samples[KeyClassPostings]))
+	for i, key := range samples[KeyClassPostings] {
+		cards[i] = pipe.SCard(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis pipeline error: %w", err)
+	}
+
+	stats := &MemoryStats{
+		Documents: classes[KeyClassDocuments].Keys,
+		Tokens:    classes[KeyClassPostings].Keys,
+		Classes:   make([]KeyClassStats, 0, len(keyClasses)),
+	}
+	for _, class := range keyClasses {
+		c := classes[class]
+		var measured int64
+		for _, cmd := range usages[class] {
+			// Deleted since it was scanned, or of a type MEMORY USAGE fails on, it counts as the others
+			if bytes, err := cmd.Result(); err == nil {
+				measured += bytes
+				c.Sampled++
+			}
+		}
+		c.Bytes = extrapolate(measured, c.Sampled, c.Keys)
+		stats.Keys += c.Keys
+		stats.Bytes += c.Bytes
+		stats.Classes = append(stats.Classes, *c)
+	}
+
+	var postings int64
+	var counted int
+	for _, cmd := range cards {
+		if n, err := cmd.Result(); err == nil {
+			postings += n
+			counted++
+		}
+	}
+	stats.Postings = extrapolate(postings, counted, stats.Tokens)
+	return stats, nil
+}
+
+// keyClass returns the class of a key of the index, see the keys of docTokensKey, tokenDocsKey and tokenRecentKey
+func (f *FullTextSearch) keyClass(key string) string {
+	name := strings.TrimPrefix(key, f.keyPrefix)
+	switch {
+	case key == f.docCountKey(), key == f.stopTokensKey():
+		return KeyClassMeta
+	case strings.HasSuffix(name, ":tokens"):
+		if _, err := strconv.ParseInt(strings.TrimSuffix(name, ":tokens"), 10, 64); err == nil {
+			return KeyClassDocuments
+		}
+	case strings.HasSuffix(name, ":docs"):
+		return KeyClassPostings
+	case strings.HasSuffix(name, ":recent"):
+		return KeyClassRecent
+	}
+	return KeyClassOther
+}
+
+// extrapolate estimates the sum over all the keys of what was summed over the sampled ones
+func extrapolate(sum int64, sampled int, keys int64) int64 {
+	if sampled == 0 || int64(sampled) >= keys {
+		return sum
+	}
+	return sum * keys / int64(sampled)
+}
@@ -0,0 +1,69 @@
+package fulltext
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFullTextSearch_MemoryStats(t *testing.T) {
+	client := setupTestRedis(t)
+	defer teardownTestRedis(t, client)
+
+	ctx := context.Background()
+	fts := NewFullTextSearch(client, tokenizer, "test:fts:")
+	tokens, postings := map[string]bool{}, 0
+	for id, text := range map[int64]string{1: "quick brown fox", 2: "lazy brown dog", 3: "quick dog"} {
+		if err := fts.Index(ctx, id, text); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+		for token := range countFrequencies(tokenizer.Analyze(text)) {
+			tokens[token] = true
+			postings++
+		}
+	}
+
+	stats, err := fts.MemoryStats(ctx, 0)
+	if err != nil {
+		t.Fatalf("MemoryStats() error = %v", err)
+	}
+	if stats.Documents != 3 || stats.Tokens != int64(len(tokens)) || stats.Postings != int64(postings) {
+		t.Errorf("MemoryStats() = %d documents, %d tokens, %d postings, want 3, %d and %d",
+			stats.Documents, stats.Tokens, stats.Postings, len(tokens), postings)
+	}
+	if stats.Bytes <= 0 || len(stats.Classes) != len(keyClasses) {
+		t.Errorf("MemoryStats() = %d bytes in %d classes", stats.Bytes, len(stats.Classes))
+	}
+	for _, class := range stats.Classes {
+		if int64(class.Sampled) != class.Keys {
+			t.Errorf("class %s: %d of %d keys sampled, want all", class.Class, class.Sampled, class.Keys)
+		}
+	}
+
+	// A sample smaller than the class extrapolates its bytes
+	sampled, err := fts.MemoryStats(ctx, 1)
+	if err != nil {
+		t.Fatalf("MemoryStats() error = %v", err)
+	}
+	if sampled.Keys != stats.Keys || sampled.Classes[0].Sampled != 1 || sampled.Classes[0].Bytes <= 0 {
+		t.Errorf("MemoryStats(1) = %+v", sampled)
+	}
+}
+
+func TestExtrapolate(t *testing.T) {
+	tests := []struct {
+		sum     int64
+		sampled int
+		keys    int64
+		want    int64
+	}{
+		{0, 0, 0, 0},
+		{300, 3, 3, 300},
+		{300, 3, 30, 3000},
+		{0, 0, 10, 0},
+	}
+	for _, tt := range tests {
+		if got := extrapolate(tt.sum, tt.sampled, tt.keys); got != tt.want {
+			t.Errorf("extrapolate(%d, %d, %d) = %d, want %d", tt.sum, tt.sampled, tt.keys, got, tt.want)
+		}
+	}
+}
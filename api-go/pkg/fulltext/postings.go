@@ -0,0 +1,105 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WithPostingLimit returns a FullTextSearch sharing the client, tokenizer and keyspace, reading at most limit documents
+// of a token in queries, its most recent ones, so that a token in most documents doesn't make queries slow
+// The IDs of the most recent documents of each token are kept in a sorted set next to its document set, the IDs
+// growing with time. A query then misses the older documents of the frequent tokens, see Exact. The tokens indexed
+// before the limit was set are read in full until the index is rebuilt. 0 reads all documents, the default.
+func (f *FullTextSearch) WithPostingLimit(limit int) *FullTextSearch {
+	copied := *f
+	copied.postingLimit = max(limit, 0)
+	return &copied
+}
+
+// Exact returns a FullTextSearch reading all documents of the tokens in queries whatever the posting limit, e.g. for
+// a search that must be complete. The most recent documents of the tokens are still kept for the other queries.
+func (f *FullTextSearch) Exact() *FullTextSearch {
+	copied := *f
+	copied.exact = true
+	return &copied
+}
+
+// PostingLimit returns the number of documents of a token read in queries, 0 for all
+func (f *FullTextSearch) PostingLimit() int {
+	if f.exact {
+		return 0
+	}
+	return f.postingLimit
+}
+
+// addRecent adds a document to the most recent ones of a token, keeping as many as the posting limit
+func (f *FullTextSearch) addRecent(ctx context.Context, pipe redis.Pipeliner, token string, id int64) {
+	if f.postingLimit <= 0 {
+		return
+	}
+	key := f.tokenRecentKey(token)
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(id), Member: id})
+	pipe.ZRemRangeByRank(ctx, key, 0, int64(-f.postingLimit-1))
+}
+
+// removeRecent removes a document from the most recent ones of a token, whatever the posting limit, so that none is
+// left behind if it is set again
+func (f *FullTextSearch) removeRecent(ctx context.Context, pipe redis.Pipeliner, token string, id int64) {
+	pipe.ZRem(ctx, f.tokenRecentKey(token), id)
+}
+
+// postings returns the IDs of the documents of each token read in a query, at most the posting limit of each unless
+// exact, see WithPostingLimit
+func (f *FullTextSearch) postings(ctx context.Context, tokens []string) ([]map[int64]struct{}, error) {
+	limit := f.PostingLimit()
+
+	// The tokens in more documents than the limit are read from their most recent ones, if kept
+	capped := make([]bool, len(tokens))
+	if limit > 0 {
+		pipe := f.client.Pipeline()
+		cards := make([]*redis.IntCmd, len(tokens))
+		recent := make([]*redis.IntCmd, len(tokens))
+		for i, token := range tokens {
+			cards[i] = pipe.SCard(ctx, f.tokenDocsKey(token))
+			recent[i] = pipe.ZCard(ctx, f.tokenRecentKey(token))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for i := range tokens {
+			capped[i] = cards[i].Val() > int64(limit) && recent[i].Val() > 0
+		}
+	}
+
+	pipe := f.client.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(tokens))
+	for i, token := range tokens {
+		if capped[i] {
+			cmds[i] = pipe.ZRevRange(ctx, f.tokenRecentKey(token), 0, int64(limit-1))
+		} else {
+			cmds[i] = pipe.SMembers(ctx, f.tokenDocsKey(token))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	docSets := make([]map[int64]struct{}, len(cmds))
+	for i, cmd := range cmds {
+		members, _ := cmd.Result()
+		docSets[i] = make(map[int64]struct{}, len(members))
+		for _, member := range members {
+			if id, err := strconv.ParseInt(member, 10, 64); err == nil {
+				docSets[i][id] = struct{}{}
+			}
+		}
+	}
+	return docSets, nil
+}
+
+func (f *FullTextSearch) tokenRecentKey(token string) string {
+	return fmt.Sprintf("%s%s:recent", f.keyPrefix, token)
+}
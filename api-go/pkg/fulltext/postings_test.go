@@ -0,0 +1,54 @@
+package fulltext
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestFullTextSearch_PostingLimit(t *testing.T) {
+	client := setupTestRedis(t)
+	defer teardownTestRedis(t, client)
+
+	fts := NewFullTextSearch(client, tokenizer, "test:fts:").WithPostingLimit(2)
+	ctx := context.Background()
+
+	for i, doc := range []string{"golang channels", "golang generics", "golang modules", "golang iterators"} {
+		if err := fts.Index(ctx, int64(i+1), doc); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+	}
+	if n := client.ZCard(ctx, fts.tokenRecentKey("golang")).Val(); n != 2 {
+		t.Errorf("expected the 2 most recent documents of golang to be kept, got %d", n)
+	}
+
+	ids := func(fts *FullTextSearch, query string) []int64 {
+		_, results, err := fts.Search(ctx, query, false, 0)
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		var ids []int64
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	if got := ids(fts, "golang"); !slices.Equal(got, []int64{3, 4}) {
+		t.Errorf("expected the most recent documents of golang, got %v", got)
+	}
+	if got := ids(fts.Exact(), "golang"); !slices.Equal(got, []int64{1, 2, 3, 4}) {
+		t.Errorf("expected all documents in exact mode, got %v", got)
+	}
+	// A token within the limit is read in full
+	if got := ids(fts, "channels"); !slices.Equal(got, []int64{1}) {
+		t.Errorf("expected the document of channels, got %v", got)
+	}
+
+	if err := fts.Deindex(ctx, 4); err != nil {
+		t.Fatalf("Deindex() error = %v", err)
+	}
+	if got := ids(fts, "golang"); !slices.Equal(got, []int64{3}) {
+		t.Errorf("expected the deindexed document to be gone, got %v", got)
+	}
+}
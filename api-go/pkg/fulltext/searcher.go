@@ -2,13 +2,12 @@ package fulltext
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"math"
 	"sort"
 	"strconv"
+	"strings"
 
-	t "github.com/cymoo/mote/pkg/util/types"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -20,6 +19,11 @@ type FullTextSearch struct {
 	client    *redis.Client
 	tokenizer Tokenizer
 	keyPrefix string
+	encoding  Encoding
+	// postingLimit is the number of documents of a token read in queries, 0 for all, see WithPostingLimit
+	postingLimit int
+	// exact reads all documents of the tokens in queries whatever the posting limit, see Exact
+	exact bool
 }
 
 // NewFullTextSearch creates a new FullTextSearch instance
@@ -35,6 +39,24 @@ func NewFullTextSearch(
 	}
 }
 
+// WithPrefix returns a FullTextSearch sharing the client and tokenizer, with its own keyspace
+// The prefix is appended to the current one, e.g. for a scratch index next to the real one
+func (f *FullTextSearch) WithPrefix(prefix string) *FullTextSearch {
+	return &FullTextSearch{
+		client:       f.client,
+		tokenizer:    f.tokenizer,
+		keyPrefix:    f.keyPrefix + prefix,
+		encoding:     f.encoding,
+		postingLimit: f.postingLimit,
+		exact:        f.exact,
+	}
+}
+
+// Tokenizer returns the tokenizer documents and queries are analyzed with
+func (f *FullTextSearch) Tokenizer() Tokenizer {
+	return f.tokenizer
+}
+
 // Indexed checks if a document is indexed
 func (f *FullTextSearch) Indexed(ctx context.Context, id int64) (bool, error) {
 	exists, err := f.client.Exists(ctx, f.docTokensKey(id)).Result()
@@ -44,6 +66,26 @@ func (f *FullTextSearch) Indexed(ctx context.Context, id int64) (bool, error) {
 	return exists > 0, nil
 }
 
+// IndexedIDs returns the IDs of all indexed documents
+// It scans the keyspace incrementally, so it doesn't block Redis on large indexes
+func (f *FullTextSearch) IndexedIDs(ctx context.Context) ([]int64, error) {
+	var ids []int64
+	iter := f.client.Scan(ctx, 0, f.keyPrefix+"*:tokens", 1000).Iterator()
+	for iter.Next(ctx) {
+		key := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), f.keyPrefix), ":tokens")
+		// Token keys may match the pattern too, only numeric keys are documents
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 // GetDocCount returns the total number of indexed documents
 func (f *FullTextSearch) GetDocCount(ctx context.Context) (int64, error) {
 	val, err := f.client.Get(ctx, f.docCountKey()).Result()
@@ -80,19 +122,25 @@ func (f *FullTextSearch) Index(ctx context.Context, id int64, text string) error
 
 	// Calculate token frequencies
 	tokenFreq := countFrequencies(tokens)
-	freqJSON, err := json.Marshal(tokenFreq)
+
+	stopTokens, err := f.stopTokenSet(ctx)
 	if err != nil {
 		return err
 	}
 
 	// Use pipeline for atomic operations
 	pipe := f.client.Pipeline()
-	pipe.Set(ctx, f.docTokensKey(id), freqJSON, 0)
+	if err := f.setTokenFreq(ctx, pipe, id, tokenFreq); err != nil {
+		return err
+	}
 	pipe.Incr(ctx, f.docCountKey())
 
-	// Add document ID to token sets
+	// Add document ID to token sets, stop tokens have none
 	for token := range tokenFreq {
-		pipe.SAdd(ctx, f.tokenDocsKey(token), id)
+		if !stopTokens.Contains(token) {
+			pipe.SAdd(ctx, f.tokenDocsKey(token), id)
+			f.addRecent(ctx, pipe, token, id)
+		}
 	}
 
 	_, err = pipe.Exec(ctx)
@@ -116,45 +164,44 @@ func (f *FullTextSearch) Reindex(ctx context.Context, id int64, text string) err
 	}
 
 	// Get old token frequencies
-	var oldFreq TokenFrequency
-	data, err := f.client.Get(ctx, f.docTokensKey(id)).Result()
+	oldFreq, err := f.getTokenFreq(ctx, id)
 	if err != nil {
-		return fmt.Errorf("token frequency of doc %d not found: %w", id, err)
-	}
-
-	// Unmarshal old frequencies
-	if err := json.Unmarshal([]byte(data), &oldFreq); err != nil {
 		return err
 	}
 
 	// Calculate new frequencies
 	newFreq := countFrequencies(newTokens)
-	freqJSON, err := json.Marshal(newFreq)
-	if err != nil {
-		return err
-	}
 
 	// Calculate differences
-	oldTokenSet := t.NewSet[string]()
+	oldTokenSet := newTokenSet()
 	for token := range oldFreq {
 		oldTokenSet.Add(token)
 	}
 
-	newTokenSet := t.NewSet(newTokens...)
+	newTokenSet := newTokenSet(newTokens...)
+
+	stopTokens, err := f.stopTokenSet(ctx)
+	if err != nil {
+		return err
+	}
 
 	tokensToRemove := oldTokenSet.Difference(newTokenSet)
-	tokensToAdd := newTokenSet.Difference(oldTokenSet)
+	tokensToAdd := newTokenSet.Difference(oldTokenSet).Difference(stopTokens)
 
 	// Update index
 	pipe := f.client.Pipeline()
-	pipe.Set(ctx, f.docTokensKey(id), freqJSON, 0)
+	if err := f.setTokenFreq(ctx, pipe, id, newFreq); err != nil {
+		return err
+	}
 
 	// Remove document ID from old token sets and add to new token sets
 	for token := range tokensToRemove {
 		pipe.SRem(ctx, f.tokenDocsKey(token), id)
+		f.removeRecent(ctx, pipe, token, id)
 	}
 	for token := range tokensToAdd {
 		pipe.SAdd(ctx, f.tokenDocsKey(token), id)
+		f.addRecent(ctx, pipe, token, id)
 	}
 
 	_, err = pipe.Exec(ctx)
@@ -163,13 +210,8 @@ func (f *FullTextSearch) Reindex(ctx context.Context, id int64, text string) err
 
 // Deindex removes a document from the index
 func (f *FullTextSearch) Deindex(ctx context.Context, id int64) error {
-	var tokenFreq TokenFrequency
-	data, err := f.client.Get(ctx, f.docTokensKey(id)).Result()
+	tokenFreq, err := f.getTokenFreq(ctx, id)
 	if err != nil {
-		return fmt.Errorf("token frequency of doc %d not found: %w", id, err)
-	}
-
-	if err := json.Unmarshal([]byte(data), &tokenFreq); err != nil {
 		return err
 	}
 
@@ -180,6 +222,7 @@ func (f *FullTextSearch) Deindex(ctx context.Context, id int64) error {
 
 	for token := range tokenFreq {
 		pipe.SRem(ctx, f.tokenDocsKey(token), id)
+		f.removeRecent(ctx, pipe, token, id)
 	}
 
 	_, err = pipe.Exec(ctx)
@@ -198,36 +241,23 @@ type SearchResult struct {
 // limit: maximum number of results to return (0 for no limit)
 // Returns the tokens, ranked results, and any error encountered
 func (f *FullTextSearch) Search(ctx context.Context, query string, partial bool, limit int) ([]string, []SearchResult, error) {
-	tokens := f.tokenizer.Analyze(query)
-	if len(tokens) == 0 {
-		return tokens, []SearchResult{}, nil
+	stopTokens, err := f.stopTokenSet(ctx)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Retrieve document IDs for each token
-	pipe := f.client.Pipeline()
-	cmds := make([]*redis.StringSliceCmd, len(tokens))
-
-	for i, token := range tokens {
-		cmds[i] = pipe.SMembers(ctx, f.tokenDocsKey(token))
+	// Stop tokens have no document sets, a query of stop tokens only matches nothing
+	tokens := withoutStopTokens(f.tokenizer.Analyze(query), stopTokens)
+	if len(tokens) == 0 {
+		return tokens, []SearchResult{}, nil
 	}
 
-	_, err := pipe.Exec(ctx)
-	if err != nil && err != redis.Nil {
+	// Retrieve document IDs for each token, the most recent ones of the frequent tokens with a posting limit
+	docSets, err := f.postings(ctx, tokens)
+	if err != nil {
 		return tokens, nil, err
 	}
 
-	// Collect document IDs
-	docSets := make([]map[int64]struct{}, len(cmds))
-	for i, cmd := range cmds {
-		members, _ := cmd.Result()
-		docSets[i] = make(map[int64]struct{})
-		for _, member := range members {
-			if id, err := strconv.ParseInt(member, 10, 64); err == nil {
-				docSets[i][id] = struct{}{}
-			}
-		}
-	}
-
 	// Combine document ID sets based on partial flag
 	var ids map[int64]struct{}
 	if partial {
@@ -294,14 +324,13 @@ func (f *FullTextSearch) rank(ctx context.Context, tokens []string, ids map[int6
 	}
 
 	// Get token frequencies for each document
-	tokenFreqs := make([]TokenFrequency, len(idList))
+	tokenFreqs, err := f.getTokenFreqs(ctx, idList)
+	if err != nil {
+		return nil, err
+	}
 	for i, id := range idList {
-		data, err := f.client.Get(ctx, f.docTokensKey(id)).Result()
-		if err != nil {
-			return nil, fmt.Errorf("token frequency of doc %d not found: %w", id, err)
-		}
-		if err := json.Unmarshal([]byte(data), &tokenFreqs[i]); err != nil {
-			return nil, err
+		if tokenFreqs[i] == nil {
+			return nil, fmt.Errorf("token frequency of doc %d not found: %w", id, redis.Nil)
 		}
 	}
 
@@ -1457,3 +1457,25 @@ func TestFullTextSearch_EmptyQuery(t *testing.T) {
 		t.Errorf("Expected no results for empty query, got %v", results)
 	}
 }
+
+func TestFullTextSearch_IndexedIDs(t *testing.T) {
+	client := setupTestRedis(t)
+	defer teardownTestRedis(t, client)
+
+	fts := NewFullTextSearch(client, tokenizer, "test:fts:")
+	ctx := context.Background()
+
+	for id, text := range map[int64]string{1: "The quick brown fox", 2: "tokens everywhere"} {
+		if err := fts.Index(ctx, id, text); err != nil {
+			t.Fatalf("Failed to index document %d: %v", id, err)
+		}
+	}
+
+	ids, err := fts.IndexedIDs(ctx)
+	if err != nil {
+		t.Fatalf("IndexedIDs() error = %v", err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("Expected 2 indexed IDs, got %v", ids)
+	}
+}
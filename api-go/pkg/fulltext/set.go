@@ -0,0 +1,32 @@
+package fulltext
+
+// tokenSet is a set of tokens, kept here so that the module doesn't depend on the utilities of the app
+type tokenSet map[string]struct{}
+
+func newTokenSet(tokens ...string) tokenSet {
+	s := make(tokenSet, len(tokens))
+	for _, token := range tokens {
+		s[token] = struct{}{}
+	}
+	return s
+}
+
+func (s tokenSet) Add(token string) {
+	s[token] = struct{}{}
+}
+
+func (s tokenSet) Contains(token string) bool {
+	_, ok := s[token]
+	return ok
+}
+
+// Difference returns the tokens of the set that aren't in the other one
+func (s tokenSet) Difference(other tokenSet) tokenSet {
+	result := newTokenSet()
+	for token := range s {
+		if !other.Contains(token) {
+			result.Add(token)
+		}
+	}
+	return result
+}
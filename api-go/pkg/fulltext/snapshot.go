@@ -0,0 +1,170 @@
+package fulltext
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// snapshotMagic starts every snapshot, the digit is the version of its format
+var snapshotMagic = []byte("FTSSNAP1")
+
+// snapshotBatch is the number of keys dumped or restored in a round trip
+const snapshotBatch = 500
+
+// ErrInvalidSnapshot is returned when restoring something that is not a complete snapshot
+var ErrInvalidSnapshot = errors.New("invalid index snapshot")
+
+// Snapshot writes all the keys of the index to w with DUMP, and returns their number
+// The keys are stored without the prefix, so that a snapshot can be restored into another keyspace. A snapshot is:
+//
+//	"FTSSNAP1" (key length, key, value length, value)* 0
+//
+// the lengths being uvarints. The index should not be written to meanwhile, the keys written after they were read
+// are not in the snapshot.
+func (f *FullTextSearch) Snapshot(ctx context.Context, w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(snapshotMagic); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	keys := make([]string, 0, snapshotBatch)
+	flush := func() error {
+		pipe := f.client.Pipeline()
+		dumps := make([]*redis.StringCmd, len(keys))
+		for i, key := range keys {
+			dumps[i] = pipe.Dump(ctx, key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return fmt.Errorf("redis pipeline error: %w", err)
+		}
+		for i, key := range keys {
+			value, err := dumps[i].Result()
+			if errors.Is(err, redis.Nil) {
+				// Deleted since it was scanned
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := writeSnapshotEntry(bw, strings.TrimPrefix(key, f.keyPrefix), value); err != nil {
+				return err
+			}
+			count++
+		}
+		keys = keys[:0]
+		return nil
+	}
+
+	iter := f.client.Scan(ctx, 0, f.keyPrefix+"*", snapshotBatch).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == snapshotBatch {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return count, err
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+
+	if _, err := bw.Write([]byte{0}); err != nil {
+		return count, err
+	}
+	return count, bw.Flush()
+}
+
+// RestoreSnapshot replaces the index with a snapshot written by Snapshot, and returns the number of keys restored
+// The index is cleared first, an invalid or truncated snapshot returns an error wrapping ErrInvalidSnapshot and may
+// leave the index partly restored.
+func (f *FullTextSearch) RestoreSnapshot(ctx context.Context, r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, snapshotMagic) {
+		return 0, fmt.Errorf("%w: unknown format", ErrInvalidSnapshot)
+	}
+
+	if err := f.ClearIndex(ctx); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	pipe := f.client.Pipeline()
+	for {
+		key, value, err := readSnapshotEntry(br)
+		if err != nil {
+			return count, err
+		}
+		if key == "" {
+			break
+		}
+		pipe.RestoreReplace(ctx, f.keyPrefix+key, 0, value)
+		if pipe.Len() == snapshotBatch {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return count, fmt.Errorf("redis pipeline error: %w", err)
+			}
+			count += snapshotBatch
+		}
+	}
+
+	n := pipe.Len()
+	if _, err := pipe.Exec(ctx); err != nil {
+		return count, fmt.Errorf("redis pipeline error: %w", err)
+	}
+	return count + n, nil
+}
+
+func writeSnapshotEntry(w *bufio.Writer, key, value string) error {
+	for _, field := range []string{key, value} {
+		if _, err := w.Write(binary.AppendUvarint(nil, uint64(len(field)))); err != nil {
+			return err
+		}
+		if _, err := w.WriteString(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSnapshotEntry reads a key and its value, the key is empty at the end of the snapshot
+func readSnapshotEntry(r *bufio.Reader) (string, string, error) {
+	key, err := readSnapshotField(r)
+	if err != nil || key == "" {
+		return "", "", err
+	}
+	value, err := readSnapshotField(r)
+	if err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// maxSnapshotField bounds the length of a key or a value, so that a corrupted length doesn't allocate gigabytes
+const maxSnapshotField = 512 << 20
+
+func readSnapshotField(r *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", fmt.Errorf("%w: truncated", ErrInvalidSnapshot)
+	}
+	if n > maxSnapshotField {
+		return "", fmt.Errorf("%w: field of %d bytes", ErrInvalidSnapshot, n)
+	}
+	field := make([]byte, n)
+	if _, err := io.ReadFull(r, field); err != nil {
+		return "", fmt.Errorf("%w: truncated", ErrInvalidSnapshot)
+	}
+	return string(field), nil
+}
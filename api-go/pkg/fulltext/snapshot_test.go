@@ -0,0 +1,58 @@
+package fulltext
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFullTextSearch_Snapshot(t *testing.T) {
+	client := setupTestRedis(t)
+	defer teardownTestRedis(t, client)
+
+	ctx := context.Background()
+	fts := NewFullTextSearch(client, tokenizer, "test:fts:")
+	for id, text := range map[int64]string{1: "The quick brown fox", 2: "jumps over the lazy dog"} {
+		if err := fts.Index(ctx, id, text); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	dumped, err := fts.Snapshot(ctx, &buf)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	// Restored into another keyspace, the index finds the same documents
+	restored := NewFullTextSearch(client, tokenizer, "test:restored:")
+	if err := restored.Index(ctx, 3, "stale document"); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	n, err := restored.RestoreSnapshot(ctx, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+	if n != dumped {
+		t.Errorf("RestoreSnapshot() = %d keys, want %d", n, dumped)
+	}
+
+	count, err := restored.GetDocCount(ctx)
+	if err != nil || count != 2 {
+		t.Errorf("GetDocCount() = %d, %v, want 2", count, err)
+	}
+	_, results, err := restored.Search(ctx, "fox", false, 0)
+	if err != nil || len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("Search(fox) = %v, %v, want document 1", results, err)
+	}
+	if _, results, _ := restored.Search(ctx, "stale", false, 0); len(results) != 0 {
+		t.Errorf("Search(stale) = %v, want no results", results)
+	}
+
+	// A truncated snapshot is rejected
+	_, err = restored.RestoreSnapshot(ctx, bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	if !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("RestoreSnapshot(truncated) error = %v, want ErrInvalidSnapshot", err)
+	}
+}
@@ -0,0 +1,67 @@
+package fulltext
+
+import (
+	"context"
+)
+
+// rebuildBatchSize is the number of documents read from a DocumentSource at once
+const rebuildBatchSize = 500
+
+// Document is a document of a DocumentSource
+type Document struct {
+	ID   int64
+	Text string
+}
+
+// DocumentSource lists all the documents an index should contain, e.g. the posts of a database, see RebuildAll
+type DocumentSource interface {
+	// CountDocuments returns the number of documents, for the progress of a rebuild
+	CountDocuments(ctx context.Context) (int64, error)
+	// Documents returns at most limit documents with an ID greater than afterID, by ID, none once all were listed
+	Documents(ctx context.Context, afterID int64, limit int) ([]Document, error)
+}
+
+// RebuildAll clears the index of f and indexes all the documents of the source, see Rebuild
+func (f *FullTextSearch) RebuildAll(ctx context.Context, source DocumentSource, onProgress func(done, total int)) (int, error) {
+	return Rebuild(ctx, f, source, onProgress)
+}
+
+// Rebuild clears an index and indexes all the documents of the source, in batches
+// onProgress, if not nil, is called after each batch with the number of documents done and their total. The rebuild
+// stops at the first error, or once ctx is done between two documents, and returns the number of documents indexed.
+func Rebuild(ctx context.Context, index Indexer, source DocumentSource, onProgress func(done, total int)) (int, error) {
+	total, err := source.CountDocuments(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := index.ClearIndex(ctx); err != nil {
+		return 0, err
+	}
+
+	done := 0
+	var afterID int64
+	for {
+		docs, err := source.Documents(ctx, afterID, rebuildBatchSize)
+		if err != nil {
+			return done, err
+		}
+		if len(docs) == 0 {
+			return done, nil
+		}
+		for _, doc := range docs {
+			if err := ctx.Err(); err != nil {
+				return done, err
+			}
+			if err := index.Index(ctx, doc.ID, doc.Text); err != nil {
+				return done, err
+			}
+			done++
+		}
+		afterID = docs[len(docs)-1].ID
+
+		if onProgress != nil {
+			// Documents added during the rebuild go past the total counted first
+			onProgress(done, max(done, int(total)))
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package fulltext
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// countingSource lists n documents with the IDs 1 to n
+type countingSource struct{ n int64 }
+
+func (s countingSource) CountDocuments(ctx context.Context) (int64, error) { return s.n, nil }
+
+func (s countingSource) Documents(ctx context.Context, afterID int64, limit int) ([]Document, error) {
+	var docs []Document
+	for id := afterID + 1; id <= s.n && len(docs) < limit; id++ {
+		docs = append(docs, Document{ID: id, Text: "doc"})
+	}
+	return docs, nil
+}
+
+// mapIndexer keeps the IDs of the documents indexed
+type mapIndexer struct {
+	docs map[int64]string
+	// onIndex is called after each document indexed
+	onIndex func()
+}
+
+func (m *mapIndexer) Index(ctx context.Context, id int64, text string) error {
+	m.docs[id] = text
+	if m.onIndex != nil {
+		m.onIndex()
+	}
+	return nil
+}
+
+func (m *mapIndexer) Reindex(ctx context.Context, id int64, text string) error {
+	return m.Index(ctx, id, text)
+}
+
+func (m *mapIndexer) Deindex(ctx context.Context, id int64) error {
+	delete(m.docs, id)
+	return nil
+}
+
+func (m *mapIndexer) Indexed(ctx context.Context, id int64) (bool, error) {
+	_, ok := m.docs[id]
+	return ok, nil
+}
+
+func (m *mapIndexer) IndexedIDs(ctx context.Context) ([]int64, error) {
+	var ids []int64
+	for id := range m.docs {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (m *mapIndexer) GetDocCount(ctx context.Context) (int64, error) { return int64(len(m.docs)), nil }
+
+func (m *mapIndexer) ClearIndex(ctx context.Context) error {
+	clear(m.docs)
+	return nil
+}
+
+func TestRebuild(t *testing.T) {
+	ctx := context.Background()
+	index := &mapIndexer{docs: map[int64]string{-1: "stale"}}
+
+	var progress [][2]int
+	done, err := Rebuild(ctx, index, countingSource{n: 1200}, func(done, total int) {
+		progress = append(progress, [2]int{done, total})
+	})
+	if err != nil {
+		t.Fatalf("Rebuild() error = %v", err)
+	}
+	if done != 1200 || len(index.docs) != 1200 {
+		t.Errorf("expected 1200 documents indexed, got %d and %d in the index", done, len(index.docs))
+	}
+	want := [][2]int{{500, 1200}, {1000, 1200}, {1200, 1200}}
+	if len(progress) != len(want) || progress[0] != want[0] || progress[2] != want[2] {
+		t.Errorf("expected the progress after each batch %v, got %v", want, progress)
+	}
+}
+
+func TestRebuildCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	index := &mapIndexer{docs: map[int64]string{}}
+	index.onIndex = func() {
+		if len(index.docs) == 10 {
+			cancel()
+		}
+	}
+
+	done, err := Rebuild(ctx, index, countingSource{n: 100}, nil)
+	if !errors.Is(err, context.Canceled) || done != 10 {
+		t.Errorf("expected the rebuild to stop after 10 documents, got %d, %v", done, err)
+	}
+}
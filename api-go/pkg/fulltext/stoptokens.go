@@ -0,0 +1,214 @@
+package fulltext
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenStat is the number of documents containing a token
+type TokenStat struct {
+	Token string `json:"token"`
+	Docs  int64  `json:"docs"`
+	// Ratio is the fraction of all documents containing the token
+	Ratio float64 `json:"ratio"`
+}
+
+// IndexStats describes the size of the index and its dynamic stop tokens
+type IndexStats struct {
+	Documents int64    `json:"documents"`
+	Encoding  Encoding `json:"encoding"`
+	// StopTokens are the tokens promoted to stop tokens, with their document count when promoted
+	StopTokens []TokenStat `json:"stop_tokens"`
+}
+
+// Stats returns the number of documents and the dynamic stop tokens of the index
+func (f *FullTextSearch) Stats(ctx context.Context) (*IndexStats, error) {
+	count, err := f.GetDocCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stopTokens, err := f.StopTokens(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexStats{Documents: count, Encoding: f.Encoding(), StopTokens: stopTokens}, nil
+}
+
+// FrequentTokens returns the tokens contained in more than the given fraction of documents, most frequent first
+// Stop tokens are not included, their document sets are pruned.
+func (f *FullTextSearch) FrequentTokens(ctx context.Context, ratio float64) ([]TokenStat, error) {
+	total, err := f.GetDocCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	frequent := make([]TokenStat, 0)
+	if total == 0 {
+		return frequent, nil
+	}
+
+	iter := f.client.Scan(ctx, 0, f.keyPrefix+"*:docs", 1000).Iterator()
+	var tokens []string
+	for iter.Next(ctx) {
+		tokens = append(tokens, strings.TrimSuffix(strings.TrimPrefix(iter.Val(), f.keyPrefix), ":docs"))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	// Count the documents of each token in batches, so that a pipeline stays small
+	const batchSize = 1000
+	for start := 0; start < len(tokens); start += batchSize {
+		batch := tokens[start:min(start+batchSize, len(tokens))]
+		pipe := f.client.Pipeline()
+		cmds := make([]*redis.IntCmd, len(batch))
+		for i, token := range batch {
+			cmds[i] = pipe.SCard(ctx, f.tokenDocsKey(token))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		for i, cmd := range cmds {
+			docs := cmd.Val()
+			if float64(docs) > ratio*float64(total) {
+				frequent = append(frequent, TokenStat{Token: batch[i], Docs: docs, Ratio: float64(docs) / float64(total)})
+			}
+		}
+	}
+
+	sort.Slice(frequent, func(i, j int) bool {
+		if frequent[i].Docs != frequent[j].Docs {
+			return frequent[i].Docs > frequent[j].Docs
+		}
+		return frequent[i].Token < frequent[j].Token
+	})
+	return frequent, nil
+}
+
+// PromoteStopTokens turns tokens into stop tokens and prunes their document sets
+// Stop tokens are ignored in queries and no longer indexed, but still count in the length of a document.
+func (f *FullTextSearch) PromoteStopTokens(ctx context.Context, tokens []TokenStat) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	pipe := f.client.TxPipeline()
+	for _, token := range tokens {
+		pipe.HSet(ctx, f.stopTokensKey(), token.Token, token.Docs)
+		pipe.Del(ctx, f.tokenDocsKey(token.Token), f.tokenRecentKey(token.Token))
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// PruneStopTokens deletes the document sets left for stop tokens, e.g. by a document indexed while promoting
+// It returns the number of sets deleted.
+func (f *FullTextSearch) PruneStopTokens(ctx context.Context) (int64, error) {
+	stopTokens, err := f.stopTokenSet(ctx)
+	if err != nil || len(stopTokens) == 0 {
+		return 0, err
+	}
+
+	keys := make([]string, 0, 2*len(stopTokens))
+	for token := range stopTokens {
+		keys = append(keys, f.tokenDocsKey(token), f.tokenRecentKey(token))
+	}
+	return f.client.Del(ctx, keys...).Result()
+}
+
+// StopTokens returns the dynamic stop tokens, most frequent first
+func (f *FullTextSearch) StopTokens(ctx context.Context) ([]TokenStat, error) {
+	values, err := f.client.HGetAll(ctx, f.stopTokensKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	total, err := f.GetDocCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stopTokens := make([]TokenStat, 0, len(values))
+	for token, value := range values {
+		docs, _ := strconv.ParseInt(value, 10, 64)
+		stat := TokenStat{Token: token, Docs: docs}
+		if total > 0 {
+			stat.Ratio = float64(docs) / float64(total)
+		}
+		stopTokens = append(stopTokens, stat)
+	}
+
+	sort.Slice(stopTokens, func(i, j int) bool {
+		if stopTokens[i].Docs != stopTokens[j].Docs {
+			return stopTokens[i].Docs > stopTokens[j].Docs
+		}
+		return stopTokens[i].Token < stopTokens[j].Token
+	})
+	return stopTokens, nil
+}
+
+// DemoteStopToken makes a stop token searchable again, rebuilding its document set from the indexed documents
+// It returns false if the token is not a stop token.
+func (f *FullTextSearch) DemoteStopToken(ctx context.Context, token string) (bool, error) {
+	removed, err := f.client.HDel(ctx, f.stopTokensKey(), token).Result()
+	if err != nil || removed == 0 {
+		return false, err
+	}
+
+	ids, err := f.IndexedIDs(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	const batchSize = 1000
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+		freqs, err := f.getTokenFreqs(ctx, batch)
+		if err != nil {
+			return true, err
+		}
+
+		var docs []any
+		for i, tokenFreq := range freqs {
+			if tokenFreq[token] > 0 {
+				docs = append(docs, batch[i])
+			}
+		}
+		if len(docs) > 0 {
+			if err := f.client.SAdd(ctx, f.tokenDocsKey(token), docs...).Err(); err != nil {
+				return true, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// stopTokenSet returns the dynamic stop tokens as a set
+func (f *FullTextSearch) stopTokenSet(ctx context.Context) (tokenSet, error) {
+	tokens, err := f.client.HKeys(ctx, f.stopTokensKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	return newTokenSet(tokens...), nil
+}
+
+// withoutStopTokens removes the dynamic stop tokens from the tokens of a query
+func withoutStopTokens(tokens []string, stopTokens tokenSet) []string {
+	if len(stopTokens) == 0 {
+		return tokens
+	}
+	kept := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if !stopTokens.Contains(token) {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
+
+func (f *FullTextSearch) stopTokensKey() string {
+	return f.keyPrefix + "stoptokens"
+}
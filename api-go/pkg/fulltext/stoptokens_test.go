@@ -0,0 +1,109 @@
+package fulltext
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFullTextSearch_FrequentTokens(t *testing.T) {
+	client := setupTestRedis(t)
+	defer teardownTestRedis(t, client)
+
+	fts := NewFullTextSearch(client, tokenizer, "test:fts:")
+	ctx := context.Background()
+
+	docs := []string{"golang channels", "golang generics", "golang modules", "rust traits"}
+	for i, doc := range docs {
+		if err := fts.Index(ctx, int64(i+1), doc); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+	}
+
+	frequent, err := fts.FrequentTokens(ctx, 0.5)
+	if err != nil {
+		t.Fatalf("FrequentTokens() error = %v", err)
+	}
+	if len(frequent) != 1 || frequent[0].Token != "golang" || frequent[0].Docs != 3 {
+		t.Fatalf("expected golang in 3 documents, got %+v", frequent)
+	}
+	if frequent[0].Ratio != 0.75 {
+		t.Errorf("expected a ratio of 0.75, got %v", frequent[0].Ratio)
+	}
+}
+
+func TestFullTextSearch_PromoteStopTokens(t *testing.T) {
+	client := setupTestRedis(t)
+	defer teardownTestRedis(t, client)
+
+	fts := NewFullTextSearch(client, tokenizer, "test:fts:")
+	ctx := context.Background()
+
+	fts.Index(ctx, 1, "golang channels")
+	fts.Index(ctx, 2, "golang generics")
+
+	if err := fts.PromoteStopTokens(ctx, []TokenStat{{Token: "golang", Docs: 2}}); err != nil {
+		t.Fatalf("PromoteStopTokens() error = %v", err)
+	}
+
+	exists, _ := client.Exists(ctx, fts.tokenDocsKey("golang")).Result()
+	if exists != 0 {
+		t.Error("expected the document set of the stop token to be pruned")
+	}
+
+	// Stop tokens are dropped from queries
+	tokens, results, err := fts.Search(ctx, "golang channels", false, 0)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(tokens) != 1 || tokens[0] != "channels" {
+		t.Errorf("expected only channels to be searched, got %v", tokens)
+	}
+	if len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("expected document 1, got %+v", results)
+	}
+
+	// Stop tokens are no longer indexed
+	fts.Index(ctx, 3, "golang modules")
+	exists, _ = client.Exists(ctx, fts.tokenDocsKey("golang")).Result()
+	if exists != 0 {
+		t.Error("expected a new document not to be added to the stop token")
+	}
+
+	stats, err := fts.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if stats.Documents != 3 || len(stats.StopTokens) != 1 || stats.StopTokens[0].Token != "golang" {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestFullTextSearch_DemoteStopToken(t *testing.T) {
+	client := setupTestRedis(t)
+	defer teardownTestRedis(t, client)
+
+	fts := NewFullTextSearch(client, tokenizer, "test:fts:")
+	ctx := context.Background()
+
+	fts.Index(ctx, 1, "golang channels")
+	fts.PromoteStopTokens(ctx, []TokenStat{{Token: "golang", Docs: 1}})
+	fts.Index(ctx, 2, "golang generics")
+
+	demoted, err := fts.DemoteStopToken(ctx, "golang")
+	if err != nil || !demoted {
+		t.Fatalf("DemoteStopToken() = %v, %v", demoted, err)
+	}
+
+	_, results, err := fts.Search(ctx, "golang", false, 0)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("expected both documents to be found again, got %+v", results)
+	}
+
+	demoted, _ = fts.DemoteStopToken(ctx, "golang")
+	if demoted {
+		t.Error("expected a token that is not a stop token not to be demoted")
+	}
+}
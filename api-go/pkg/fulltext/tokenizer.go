@@ -1,18 +1,19 @@
 package fulltext
 
 import (
+	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
-	t "github.com/cymoo/mote/pkg/util/types"
 	"github.com/go-ego/gse"
 )
 
 var (
 	punctuationRegex = regexp.MustCompile(`\p{P}`)
 	htmlTagRegex     = regexp.MustCompile(`<[^>]*>`)
-	stopWords        = t.NewSet(
+	stopWords        = newTokenSet(
 		"a", "an", "and", "are", "as", "at", "be", "by",
 		"can", "for", "from", "have", "if", "in", "is",
 		"it", "may", "not", "of", "on", "or", "tbd",
@@ -28,6 +29,46 @@ type Tokenizer interface {
 	Analyze(text string) []string
 }
 
+// TokenizerFactory creates a tokenizer loading the given dictionaries, its default ones if there are none
+type TokenizerFactory func(dictPaths ...string) (Tokenizer, error)
+
+var (
+	tokenizersMu sync.RWMutex
+	tokenizers   = map[string]TokenizerFactory{
+		"gse": func(dictPaths ...string) (Tokenizer, error) { return NewGseTokenizer(dictPaths...), nil },
+	}
+)
+
+// RegisterTokenizer makes a tokenizer available to NewTokenizer under a name, replacing any registered before
+func RegisterTokenizer(name string, factory TokenizerFactory) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	tokenizers[name] = factory
+}
+
+// NewTokenizer creates the tokenizer registered under a name, so that an index can choose its tokenizer by configuration
+func NewTokenizer(name string, dictPaths ...string) (Tokenizer, error) {
+	tokenizersMu.RLock()
+	factory, ok := tokenizers[name]
+	tokenizersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown tokenizer %q, expected one of %s", name, strings.Join(TokenizerNames(), ", "))
+	}
+	return factory(dictPaths...)
+}
+
+// TokenizerNames returns the names of the registered tokenizers, sorted
+func TokenizerNames() []string {
+	tokenizersMu.RLock()
+	defer tokenizersMu.RUnlock()
+	names := make([]string, 0, len(tokenizers))
+	for name := range tokenizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // GseTokenizer implements Tokenizer using gse
 type GseTokenizer struct {
 	seg  *gse.Segmenter
@@ -0,0 +1,37 @@
+package fulltext
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// whitespaceTokenizer splits text on whitespace
+type whitespaceTokenizer struct{}
+
+func (whitespaceTokenizer) Cut(text string) []string { return strings.Fields(text) }
+func (whitespaceTokenizer) Analyze(text string) []string {
+	return strings.Fields(strings.ToLower(text))
+}
+
+func TestNewTokenizer(t *testing.T) {
+	RegisterTokenizer("whitespace", func(dictPaths ...string) (Tokenizer, error) {
+		return whitespaceTokenizer{}, nil
+	})
+
+	tokenizer, err := NewTokenizer("whitespace")
+	if err != nil {
+		t.Fatalf("NewTokenizer() error = %v", err)
+	}
+	if tokens := tokenizer.Analyze("Hello World"); !slices.Equal(tokens, []string{"hello", "world"}) {
+		t.Errorf("expected the registered tokenizer, got %v", tokens)
+	}
+
+	if names := TokenizerNames(); !slices.Equal(names, []string{"gse", "whitespace"}) {
+		t.Errorf("unexpected tokenizer names %v", names)
+	}
+
+	if _, err := NewTokenizer("jieba"); err == nil {
+		t.Error("expected an error for an unregistered tokenizer")
+	}
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// entry holds a cached value and its expiration time
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// TTLCache is a concurrency-safe in-memory cache whose entries expire after a fixed TTL.
+// When the cache is full, expired entries are evicted first, then the entry closest to expiry.
+type TTLCache[K comparable, V any] struct {
+	mu         sync.Mutex
+	items      map[K]entry[V]
+	ttl        time.Duration
+	maxEntries int
+}
+
+// New creates a TTLCache with the given TTL and maximum number of entries
+// A maxEntries of 0 means the cache is unbounded
+func New[K comparable, V any](ttl time.Duration, maxEntries int) *TTLCache[K, V] {
+	return &TTLCache[K, V]{
+		items:      make(map[K]entry[V]),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+	}
+}
+
+// Get returns the cached value and true if it exists and has not expired
+func (c *TTLCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	item, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	if time.Now().After(item.expiresAt) {
+		delete(c.items, key)
+		return zero, false
+	}
+	return item.value, true
+}
+
+// Set stores a value, evicting an entry if the cache is full
+func (c *TTLCache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.items[key]; !exists && c.maxEntries > 0 && len(c.items) >= c.maxEntries {
+		c.evict()
+	}
+	c.items[key] = entry[V]{value: value, expiresAt: time.Now().Add(c.ttl)}
+}
+
+// Delete removes a value from the cache
+func (c *TTLCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.items, key)
+}
+
+// Clear removes all values from the cache
+func (c *TTLCache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[K]entry[V])
+}
+
+// Len returns the number of entries in the cache, including expired ones not yet evicted
+func (c *TTLCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.items)
+}
+
+// evict removes expired entries, or the entry closest to expiry if none has expired
+// The caller must hold the lock
+func (c *TTLCache[K, V]) evict() {
+	now := time.Now()
+
+	var oldestKey K
+	var oldest time.Time
+	found := false
+
+	for key, item := range c.items {
+		if now.After(item.expiresAt) {
+			delete(c.items, key)
+			continue
+		}
+		if !found || item.expiresAt.Before(oldest) {
+			oldestKey = key
+			oldest = item.expiresAt
+			found = true
+		}
+	}
+
+	if len(c.items) >= c.maxEntries && found {
+		delete(c.items, oldestKey)
+	}
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLCache_GetSet(t *testing.T) {
+	c := New[string, int](time.Minute, 0)
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected miss on empty cache")
+	}
+
+	c.Set("a", 1)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %v, %v; want 1, true", v, ok)
+	}
+
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected miss after Delete")
+	}
+}
+
+func TestTTLCache_Expiry(t *testing.T) {
+	c := New[string, int](10*time.Millisecond, 0)
+	c.Set("a", 1)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected entry to expire")
+	}
+	if c.Len() != 0 {
+		t.Errorf("expected expired entry to be removed, got len %d", c.Len())
+	}
+}
+
+func TestTTLCache_MaxEntries(t *testing.T) {
+	c := New[int, int](time.Minute, 2)
+
+	c.Set(1, 1)
+	time.Sleep(time.Millisecond)
+	c.Set(2, 2)
+	c.Set(3, 3)
+
+	if c.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", c.Len())
+	}
+	if _, ok := c.Get(1); ok {
+		t.Error("expected oldest entry to be evicted")
+	}
+	if _, ok := c.Get(3); !ok {
+		t.Error("expected newest entry to be present")
+	}
+
+	// Overwriting an existing key must not evict
+	c.Set(2, 20)
+	if v, _ := c.Get(2); v != 20 || c.Len() != 2 {
+		t.Errorf("unexpected state after overwrite: value %d, len %d", v, c.Len())
+	}
+}
+
+func TestTTLCache_Clear(t *testing.T) {
+	c := New[string, int](time.Minute, 0)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Clear()
+
+	if c.Len() != 0 {
+		t.Errorf("expected empty cache, got len %d", c.Len())
+	}
+}
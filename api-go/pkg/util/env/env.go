@@ -35,6 +35,20 @@ func GetInt(key string, defaultValue int) int {
 	return intValue
 }
 
+func GetFloat(key string, defaultValue float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		panic(err)
+	}
+
+	return floatValue
+}
+
 func GetByteSize(key string, defaultValue int64) int64 {
 	value, exists := os.LookupEnv(key)
 	if !exists {
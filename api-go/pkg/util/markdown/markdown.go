@@ -0,0 +1,147 @@
+// Package markdown converts the common subset of Markdown used by note apps into the HTML of posts
+//
+// Headings, paragraphs, lists, quotes, fenced code, rules, emphasis, code spans and links are supported.
+// Hash tags such as #book/novel are wrapped in the hash-tag spans the editor produces.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingRegex     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	bulletRegex      = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedRegex     = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	ruleRegex        = regexp.MustCompile(`^(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	linkRegex        = regexp.MustCompile(`!?\[([^\]]*)\]\(([^)\s]+)(?:\s+&#34;[^)]*&#34;)?\)`)
+	strongRegex      = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	emphasisRegex    = regexp.MustCompile(`\*([^*\s][^*]*?)\*|\b_([^_\s][^_]*?)_\b`)
+	strikethroughRex = regexp.MustCompile(`~~(.+?)~~`)
+	hashTagRegex     = regexp.MustCompile(`(^|\s)#([^\s#<>&;,.!?]+(?:/[^\s#<>&;,.!?]+)*)`)
+)
+
+// ToHTML converts Markdown to HTML
+func ToHTML(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var out strings.Builder
+	var paragraph []string
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>") + "</p>")
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flush()
+			fence := trimmed[:3]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+
+		case headingRegex.MatchString(trimmed):
+			flush()
+			m := headingRegex.FindStringSubmatch(trimmed)
+			// The editor supports three levels of headings
+			level := string(rune('0' + min(len(m[1]), 3)))
+			out.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">")
+
+		case ruleRegex.MatchString(trimmed):
+			flush()
+			out.WriteString("<hr>")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"), " "))
+			}
+			i--
+			out.WriteString("<blockquote>" + ToHTML(strings.Join(quote, "\n")) + "</blockquote>")
+
+		case bulletRegex.MatchString(line) || orderedRegex.MatchString(line):
+			flush()
+			itemRegex, tag := bulletRegex, "ul"
+			if !bulletRegex.MatchString(line) {
+				itemRegex, tag = orderedRegex, "ol"
+			}
+			out.WriteString("<" + tag + ">")
+			for ; i < len(lines) && itemRegex.MatchString(lines[i]); i++ {
+				out.WriteString("<li><p>" + inline(itemRegex.FindStringSubmatch(lines[i])[1]) + "</p></li>")
+			}
+			i--
+			out.WriteString("</" + tag + ">")
+
+		default:
+			paragraph = append(paragraph, inline(trimmed))
+		}
+	}
+	flush()
+
+	return out.String()
+}
+
+// inline converts the inline elements of a line, leaving code spans untouched
+func inline(text string) string {
+	parts := strings.Split(text, "`")
+	for i, part := range parts {
+		escaped := html.EscapeString(part)
+		// Odd parts are between backticks, unless the last backtick is unmatched
+		if i%2 == 1 && i < len(parts)-1 {
+			parts[i] = "<code>" + escaped + "</code>"
+			continue
+		}
+		if i%2 == 1 {
+			escaped = "`" + escaped
+		}
+		parts[i] = formatText(escaped)
+	}
+	return strings.Join(parts, "")
+}
+
+// formatText converts links, emphasis and hash tags of escaped text
+func formatText(text string) string {
+	text = hashTagRegex.ReplaceAllString(text, `$1<span class="hash-tag">#$2</span>`)
+	text = linkRegex.ReplaceAllStringFunc(text, func(link string) string {
+		m := linkRegex.FindStringSubmatch(link)
+		label, href := m[1], m[2]
+		if label == "" {
+			label = href
+		}
+		if !safeURL(href) {
+			return label
+		}
+		return `<a href="` + href + `">` + label + `</a>`
+	})
+	text = strongRegex.ReplaceAllString(text, "<strong>$1$2</strong>")
+	text = emphasisRegex.ReplaceAllString(text, "<em>$1$2</em>")
+	text = strikethroughRex.ReplaceAllString(text, "<s>$1</s>")
+	return text
+}
+
+// safeURL reports whether a link target can't run scripts
+func safeURL(href string) bool {
+	scheme, _, found := strings.Cut(href, ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		return true
+	}
+	switch strings.ToLower(scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package markdown
+
+import "testing"
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"paragraphs", "first\nline\n\nsecond", "<p>first<br>line</p><p>second</p>"},
+		{"heading", "# Title\ntext", "<h1>Title</h1><p>text</p>"},
+		{"deep heading", "#### Deep", "<h3>Deep</h3>"},
+		{"hash tag", "reading #book/novel now", `<p>reading <span class="hash-tag">#book/novel</span> now</p>`},
+		{"tag at start", "#todo call", `<p><span class="hash-tag">#todo</span> call</p>`},
+		{"emphasis", "**bold** and *it*", "<p><strong>bold</strong> and <em>it</em></p>"},
+		{"code span", "use `#x <b>` here", "<p>use <code>#x &lt;b&gt;</code> here</p>"},
+		{"link", "[site](https://example.com)", `<p><a href="https://example.com">site</a></p>`},
+		{"unsafe link", "[x](javascript:void)", "<p>x</p>"},
+		{"escaped", "<script>", "<p>&lt;script&gt;</p>"},
+		{"bullets", "- a\n- b", "<ul><li><p>a</p></li><li><p>b</p></li></ul>"},
+		{"ordered", "1. a\n2. b", "<ol><li><p>a</p></li><li><p>b</p></li></ol>"},
+		{"quote", "> quoted\n> more", "<blockquote><p>quoted<br>more</p></blockquote>"},
+		{"fence", "```\n<a> #x\n```", "<pre><code>&lt;a&gt; #x</code></pre>"},
+		{"rule", "a\n\n---\n\nb", "<p>a</p><hr><p>b</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToHTML(tt.src); got != tt.want {
+				t.Errorf("ToHTML(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Package precompressed serves files with their pre-encoded .br or .gz variants when the client accepts them
+package precompressed
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// encodings are the supported encodings in order of preference, with their file extensions
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// FileServer returns a handler serving files from fsys like http.FileServer
+// If the client accepts br or gzip and a file has a variant with the matching extension, the variant is served instead
+func FileServer(fsys fs.FS) http.Handler {
+	fallback := http.FileServer(http.FS(fsys))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		// Responses differ by encoding whenever a variant could exist
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		accepted := parseAcceptEncoding(r.Header.Get("Accept-Encoding"))
+		for _, encoding := range encodings {
+			if !accepted[encoding.name] {
+				continue
+			}
+			if serveVariant(w, r, fsys, name, encoding.name, encoding.ext) {
+				return
+			}
+		}
+
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+// serveVariant serves name+ext with the given content encoding, and reports false if there is no such variant
+func serveVariant(w http.ResponseWriter, r *http.Request, fsys fs.FS, name, encoding, ext string) bool {
+	f, err := fsys.Open(name + ext)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		return false
+	}
+
+	// The content type is the one of the original file, not of the archive
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Encoding", encoding)
+	http.ServeContent(w, r, name, info.ModTime(), content)
+	return true
+}
+
+// parseAcceptEncoding returns the encodings accepted by the client, ignoring those with q=0
+func parseAcceptEncoding(header string) map[string]bool {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				continue
+			}
+		}
+		accepted[name] = true
+	}
+	return accepted
+}
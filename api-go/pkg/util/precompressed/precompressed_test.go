@@ -0,0 +1,47 @@
+package precompressed
+
+import (
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFileServer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":    {Data: []byte("console.log('plain')")},
+		"app.js.gz": {Data: []byte("gzip")},
+		"app.js.br": {Data: []byte("brotli")},
+		"style.css": {Data: []byte("body {}")},
+	}
+	server := FileServer(fsys)
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+		wantBody       string
+	}{
+		{"/app.js", "gzip, deflate, br", "br", "brotli"},
+		{"/app.js", "gzip", "gzip", "gzip"},
+		{"/app.js", "br;q=0, gzip", "gzip", "gzip"},
+		{"/app.js", "", "", "console.log('plain')"},
+		{"/style.css", "br", "", "body {}"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+			t.Errorf("%s with %q: Content-Encoding = %q; want %q", tt.path, tt.acceptEncoding, got, tt.wantEncoding)
+		}
+		if got := rec.Body.String(); got != tt.wantBody {
+			t.Errorf("%s with %q: body = %q; want %q", tt.path, tt.acceptEncoding, got, tt.wantBody)
+		}
+		if tt.wantEncoding != "" && rec.Header().Get("Content-Type") != "text/javascript; charset=utf-8" {
+			t.Errorf("expected content type of the original file, got %q", rec.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Package readability extracts the main content of a web page as simplified HTML
+//
+// Boilerplate such as navigation, sidebars and comments is dropped, the block with the most
+// paragraph text is kept and reduced to a small set of tags. Links are made absolute, and images
+// are removed from the content and returned separately, so the caller can store them.
+package readability
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	unlikelyRegex = regexp.MustCompile(`(?i)comment|sidebar|footer|footnote|masthead|menu|nav|share|social|sponsor|promo|related|cookie|banner|popup|subscribe|advert|\bads?\b`)
+	positiveRegex = regexp.MustCompile(`(?i)article|body|content|entry|main|post|story|text`)
+	spaceRegex    = regexp.MustCompile(`\s+`)
+)
+
+// removedTags are dropped with their content
+var removedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true, atom.Form: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Button: true,
+	atom.Svg: true, atom.Input: true, atom.Select: true, atom.Textarea: true, atom.Template: true,
+}
+
+// keptTags are rendered in the content, other tags are replaced by their children
+var keptTags = map[atom.Atom]string{
+	atom.P: "p", atom.H1: "h2", atom.H2: "h2", atom.H3: "h3", atom.H4: "h3", atom.H5: "h3", atom.H6: "h3",
+	atom.Ul: "ul", atom.Ol: "ol", atom.Li: "li", atom.Blockquote: "blockquote", atom.Pre: "pre",
+	atom.Code: "code", atom.Strong: "strong", atom.B: "strong", atom.Em: "em", atom.I: "em",
+	atom.Br: "br", atom.Hr: "hr", atom.A: "a",
+}
+
+// Article is the readable content of a page
+type Article struct {
+	Title string
+	// Content is the simplified HTML of the main content
+	Content string
+	// Images are the absolute URLs of the images of the main content, in order
+	Images []string
+}
+
+// Extract parses a page and returns its readable content
+// base resolves relative links and images, it is usually the URL of the page.
+func Extract(r io.Reader, base *url.URL) (*Article, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	article := &Article{Title: findTitle(doc)}
+	prune(doc)
+
+	root := findContent(doc)
+	if root == nil {
+		return article, nil
+	}
+
+	var b strings.Builder
+	w := &writer{base: base, article: article, out: &b}
+	w.children(root)
+	article.Content = strings.TrimSpace(b.String())
+	return article, nil
+}
+
+// findTitle prefers the Open Graph title, then the title element, then the first h1
+func findTitle(doc *html.Node) string {
+	var ogTitle, title, h1 string
+	walk(doc, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.Meta:
+			if attr(n, "property") == "og:title" && ogTitle == "" {
+				ogTitle = attr(n, "content")
+			}
+		case atom.Title:
+			if title == "" {
+				title = textContent(n)
+			}
+		case atom.H1:
+			if h1 == "" {
+				h1 = textContent(n)
+			}
+		}
+		return true
+	})
+
+	for _, candidate := range []string{ogTitle, title, h1} {
+		if candidate = normalizeSpace(candidate); candidate != "" {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// prune removes the elements that are never part of the content
+func prune(doc *html.Node) {
+	var remove []*html.Node
+	walk(doc, func(n *html.Node) bool {
+		if n.Type == html.CommentNode {
+			remove = append(remove, n)
+			return false
+		}
+		if n.Type != html.ElementNode || n.DataAtom == atom.Body || n.DataAtom == atom.Html {
+			return true
+		}
+		if removedTags[n.DataAtom] {
+			remove = append(remove, n)
+			return false
+		}
+		// Unlikely candidates are kept if they look like the content itself
+		hint := attr(n, "class") + " " + attr(n, "id")
+		if unlikelyRegex.MatchString(hint) && !positiveRegex.MatchString(hint) &&
+			n.DataAtom != atom.Article && n.DataAtom != atom.Main {
+			remove = append(remove, n)
+			return false
+		}
+		return true
+	})
+
+	for _, n := range remove {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+// findContent returns the element holding the main content
+// An article or main element is used if there is one, otherwise paragraphs vote for their ancestors.
+func findContent(doc *html.Node) *html.Node {
+	var article, main, body *html.Node
+	scores := map[*html.Node]float64{}
+
+	walk(doc, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.Article:
+			if article == nil {
+				article = n
+			}
+		case atom.Main:
+			if main == nil {
+				main = n
+			}
+		case atom.Body:
+			body = n
+		case atom.P, atom.Pre, atom.Td:
+			text := textContent(n)
+			if len(text) < 25 {
+				return true
+			}
+			score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+			if parent := n.Parent; parent != nil {
+				scores[parent] += score
+				if grandparent := parent.Parent; grandparent != nil {
+					scores[grandparent] += score / 2
+				}
+			}
+		}
+		return true
+	})
+
+	if article != nil {
+		return article
+	}
+	if main != nil {
+		return main
+	}
+
+	var best *html.Node
+	var bestScore float64
+	for n, score := range scores {
+		hint := attr(n, "class") + " " + attr(n, "id")
+		if positiveRegex.MatchString(hint) {
+			score += 25
+		}
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return body
+}
+
+// writer renders the content with the kept tags
+type writer struct {
+	base    *url.URL
+	article *Article
+	out     *strings.Builder
+}
+
+func (w *writer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+func (w *writer) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		text := n.Data
+		if !inPre(n) {
+			text = spaceRegex.ReplaceAllString(text, " ")
+		}
+		w.out.WriteString(html.EscapeString(text))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if n.DataAtom == atom.Img {
+		src := attr(n, "src")
+		if src == "" {
+			src = attr(n, "data-src")
+		}
+		if image := w.resolve(src); image != "" {
+			w.article.Images = append(w.article.Images, image)
+		}
+		return
+	}
+
+	tag, ok := keptTags[n.DataAtom]
+	if !ok {
+		w.children(n)
+		return
+	}
+
+	switch tag {
+	case "br", "hr":
+		w.out.WriteString("<" + tag + ">")
+		return
+	case "a":
+		href := w.resolve(attr(n, "href"))
+		if href == "" {
+			w.children(n)
+			return
+		}
+		w.out.WriteString(`<a href="` + html.EscapeString(href) + `">`)
+		w.children(n)
+		w.out.WriteString("</a>")
+		return
+	}
+
+	// Drop blocks left empty once images and boilerplate are removed, keeping their images
+	if tag != "pre" && tag != "code" && strings.TrimSpace(textContent(n)) == "" {
+		discard := &writer{base: w.base, article: w.article, out: &strings.Builder{}}
+		discard.children(n)
+		return
+	}
+	w.out.WriteString("<" + tag + ">")
+	w.children(n)
+	w.out.WriteString("</" + tag + ">")
+}
+
+// resolve returns the absolute http(s) URL of a reference, or an empty string
+func (w *writer) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if w.base != nil {
+		u = w.base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
+
+func inPre(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.DataAtom == atom.Pre {
+			return true
+		}
+	}
+	return false
+}
+
+// walk visits the nodes depth-first, skipping the children of a node if visit returns false
+func walk(n *html.Node, visit func(*html.Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; {
+		// The visitor may not detach c, but prune collects nodes and removes them afterwards
+		next := c.NextSibling
+		walk(c, visit)
+		c = next
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+		return true
+	})
+	return normalizeSpace(b.String())
+}
+
+func normalizeSpace(s string) string {
+	return strings.TrimSpace(spaceRegex.ReplaceAllString(s, " "))
+}
@@ -0,0 +1,72 @@
+package readability
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const page = `<!doctype html>
+<html>
+<head>
+  <title>Fallback title</title>
+  <meta property="og:title" content="The  Real Title">
+  <script>alert(1)</script>
+</head>
+<body>
+  <nav><a href="/">Home</a></nav>
+  <div class="sidebar"><p>Subscribe to our newsletter, it is great, really great.</p></div>
+  <div id="main-content">
+    <h1>Heading</h1>
+    <p>The first paragraph is long enough to count, with commas, clauses, and more words.</p>
+    <p>See <a href="/docs/page?x=1">the docs</a> and <a href="javascript:void(0)">this</a>.</p>
+    <p><img src="img/photo.jpg" alt="photo"></p>
+    <pre>  keep   spacing</pre>
+    <div class="share"><p>Share this article with your friends, family and everyone.</p></div>
+  </div>
+  <footer><p>Copyright notice that is long enough to be a paragraph on its own.</p></footer>
+</body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/post")
+
+	article, err := Extract(strings.NewReader(page), base)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	if article.Title != "The Real Title" {
+		t.Errorf("unexpected title: %q", article.Title)
+	}
+
+	want := `<h2>Heading</h2>` +
+		` <p>The first paragraph is long enough to count, with commas, clauses, and more words.</p>` +
+		` <p>See <a href="https://example.com/docs/page?x=1">the docs</a> and this.</p>` +
+		` <pre> keep spacing</pre>`
+	if got := strings.TrimSpace(spaceRegex.ReplaceAllString(article.Content, " ")); got != want {
+		t.Errorf("unexpected content:\n got %s\nwant %s", got, want)
+	}
+	if !strings.Contains(article.Content, "<pre>  keep   spacing</pre>") {
+		t.Errorf("expected preformatted text to keep its spacing, got %s", article.Content)
+	}
+
+	if len(article.Images) != 1 || article.Images[0] != "https://example.com/blog/img/photo.jpg" {
+		t.Errorf("unexpected images: %v", article.Images)
+	}
+}
+
+func TestExtractPrefersArticle(t *testing.T) {
+	doc := `<body><div><p>Short.</p></div><article><p>Inside the article.</p></article></body>`
+
+	article, err := Extract(strings.NewReader(doc), nil)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if article.Content != "<p>Inside the article.</p>" {
+		t.Errorf("unexpected content: %q", article.Content)
+	}
+	if article.Title != "" {
+		t.Errorf("expected no title, got %q", article.Title)
+	}
+}
@@ -0,0 +1,59 @@
+package ring
+
+import "sync"
+
+// Buffer is a concurrency-safe fixed-size buffer that overwrites its oldest items when full
+type Buffer[T any] struct {
+	mu    sync.Mutex
+	items []T
+	next  int
+	full  bool
+}
+
+// New creates a Buffer holding at most size items
+func New[T any](size int) *Buffer[T] {
+	return &Buffer[T]{items: make([]T, size)}
+}
+
+// Push adds an item, dropping the oldest one if the buffer is full
+func (b *Buffer[T]) Push(item T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.items) == 0 {
+		return
+	}
+
+	b.items[b.next] = item
+	b.next = (b.next + 1) % len(b.items)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Items returns the buffered items from newest to oldest
+func (b *Buffer[T]) Items() []T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := b.next
+	if b.full {
+		count = len(b.items)
+	}
+
+	result := make([]T, 0, count)
+	for i := 1; i <= count; i++ {
+		result = append(result, b.items[(b.next-i+len(b.items))%len(b.items)])
+	}
+	return result
+}
+
+// Clear removes all items
+func (b *Buffer[T]) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	clear(b.items)
+	b.next = 0
+	b.full = false
+}
@@ -0,0 +1,39 @@
+package ring
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	b := New[int](3)
+
+	if items := b.Items(); len(items) != 0 {
+		t.Errorf("expected empty buffer, got %v", items)
+	}
+
+	b.Push(1)
+	b.Push(2)
+	if items := b.Items(); !slices.Equal(items, []int{2, 1}) {
+		t.Errorf("Items() = %v; want [2 1]", items)
+	}
+
+	b.Push(3)
+	b.Push(4)
+	if items := b.Items(); !slices.Equal(items, []int{4, 3, 2}) {
+		t.Errorf("Items() = %v; want [4 3 2]", items)
+	}
+
+	b.Clear()
+	if items := b.Items(); len(items) != 0 {
+		t.Errorf("expected empty buffer after Clear, got %v", items)
+	}
+}
+
+func TestBufferZeroSize(t *testing.T) {
+	b := New[int](0)
+	b.Push(1)
+	if items := b.Items(); len(items) != 0 {
+		t.Errorf("expected zero-size buffer to stay empty, got %v", items)
+	}
+}
@@ -0,0 +1,125 @@
+// Package robots parses robots.txt files and checks whether a crawler may fetch a path
+//
+// Only the Allow and Disallow rules are supported. The rules of the most specific matching
+// user agent group apply, and among them the longest matching rule wins, Allow breaking ties.
+// Patterns may use the * wildcard and the $ end anchor.
+package robots
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+type rule struct {
+	pattern string
+	allow   bool
+}
+
+// Rules are the rules of a robots.txt file that apply to a user agent
+type Rules struct {
+	rules []rule
+}
+
+// Parse reads a robots.txt file and keeps the rules that apply to the user agent
+// A group applies if its name is found in the user agent, ignoring case,
+// the * group is used if no group names it.
+func Parse(r io.Reader, userAgent string) (*Rules, error) {
+	agent := strings.ToLower(userAgent)
+
+	var (
+		named, wildcard []rule
+		hasNamed        bool
+		groupAgents     []string
+		groupRules      []rule
+		inRules         bool
+	)
+	flush := func() {
+		for _, a := range groupAgents {
+			switch {
+			case a == "*":
+				wildcard = append(wildcard, groupRules...)
+			case a != "" && strings.Contains(agent, a):
+				named = append(named, groupRules...)
+				hasNamed = true
+			}
+		}
+		groupAgents, groupRules = nil, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// A user agent line after rules starts a new group
+			if inRules {
+				flush()
+				inRules = false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			// An empty Disallow allows everything
+			if value == "" {
+				continue
+			}
+			groupRules = append(groupRules, rule{pattern: value, allow: key == "allow"})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	if hasNamed {
+		return &Rules{rules: named}, nil
+	}
+	return &Rules{rules: wildcard}, nil
+}
+
+// Allowed reports whether a path, with its query string, may be fetched
+func (r *Rules) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !match(rule.pattern, path) {
+			continue
+		}
+		if n := len(rule.pattern); n > longest || (n == longest && rule.allow) {
+			allowed, longest = rule.allow, n
+		}
+	}
+	return allowed
+}
+
+// match reports whether a pattern matches the beginning of a path
+func match(pattern, path string) bool {
+	if pattern == "" {
+		return true
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(path); i++ {
+			if match(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	case '$':
+		if len(pattern) == 1 {
+			return path == ""
+		}
+	}
+	return path != "" && pattern[0] == path[0] && match(pattern[1:], path[1:])
+}
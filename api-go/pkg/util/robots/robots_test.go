@@ -0,0 +1,65 @@
+package robots
+
+import (
+	"strings"
+	"testing"
+)
+
+const robotsTxt = `
+# comments are ignored
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+
+User-agent: badbot
+User-agent: mote
+Disallow: /
+Allow: /blog/
+`
+
+func TestAllowed(t *testing.T) {
+	rules, err := Parse(strings.NewReader(robotsTxt), "Mozilla/5.0 (compatible; crawler)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tests := map[string]bool{
+		"/":                   true,
+		"/private/":           false,
+		"/private/secret":     false,
+		"/private/public/x":   true,
+		"/docs/file.pdf":      false,
+		"/docs/file.pdf?x=1":  true,
+		"/docs/file.pdf.html": true,
+	}
+	for path, expected := range tests {
+		if got := rules.Allowed(path); got != expected {
+			t.Errorf("Allowed(%q) = %v, expected %v", path, got, expected)
+		}
+	}
+}
+
+func TestAllowedNamedGroup(t *testing.T) {
+	rules, err := Parse(strings.NewReader(robotsTxt), "Mozilla/5.0 (compatible; Mote)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if rules.Allowed("/about") {
+		t.Error("expected the named group to disallow /about")
+	}
+	if !rules.Allowed("/blog/post") {
+		t.Error("expected the longer allow rule to win for /blog/post")
+	}
+}
+
+func TestAllowedEmpty(t *testing.T) {
+	rules, err := Parse(strings.NewReader("User-agent: *\nDisallow:\n"), "mote")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !rules.Allowed("/anything") {
+		t.Error("expected an empty disallow to allow everything")
+	}
+}
@@ -0,0 +1,79 @@
+// Package safego starts goroutines whose panics don't crash the process
+// A panic in a goroutine can't be recovered by its caller, e.g. a middleware recovering the panics of the requests: a
+// goroutine started in the background by a request, or by a task, must recover its own. Go recovers them, logs them
+// with their stack and counts them by name, see Stats.
+package safego
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stat counts the panics recovered in the goroutines of a name
+type Stat struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+	// Last is the value of the latest panic, and LastAt when it was recovered
+	Last   string    `json:"last"`
+	LastAt time.Time `json:"last_at"`
+}
+
+var (
+	mu    sync.Mutex
+	stats = map[string]*Stat{}
+)
+
+// Go runs fn in a new goroutine, a panic of fn is recovered, logged and counted under the name, e.g. "index-post"
+func Go(name string, fn func()) {
+	go func() {
+		defer Recover(name)
+		fn()
+	}()
+}
+
+// Recover recovers a panic, logs and counts it under the name, it must be deferred by the goroutine, see Go
+func Recover(name string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Printf("panic recovered in %s: %v\nstack trace:\n%s", name, r, debug.Stack())
+
+	mu.Lock()
+	defer mu.Unlock()
+	stat, ok := stats[name]
+	if !ok {
+		stat = &Stat{Name: name}
+		stats[name] = stat
+	}
+	stat.Count++
+	stat.Last = fmt.Sprint(r)
+	stat.LastAt = time.Now()
+}
+
+// Stats returns the panics recovered since the start by name, the names without any are not included
+func Stats() []Stat {
+	mu.Lock()
+	defer mu.Unlock()
+	list := make([]Stat, 0, len(stats))
+	for _, stat := range stats {
+		list = append(list, *stat)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Total returns the number of panics recovered since the start
+func Total() int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	var total int64
+	for _, stat := range stats {
+		total += stat.Count
+	}
+	return total
+}
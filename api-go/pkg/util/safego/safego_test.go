@@ -0,0 +1,52 @@
+package safego
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecover(t *testing.T) {
+	before, count := Total(), find(t, "test-recover").Count
+	func() {
+		defer Recover("test-recover")
+		panic("boom")
+	}()
+
+	if got := Total() - before; got != 1 {
+		t.Errorf("expected 1 panic recovered, got %d", got)
+	}
+	stat := find(t, "test-recover")
+	if stat.Count != count+1 || stat.Last != "boom" || stat.LastAt.IsZero() {
+		t.Errorf("unexpected stat %+v", stat)
+	}
+}
+
+func TestGo(t *testing.T) {
+	done := make(chan struct{})
+	Go("test-ok", func() { close(done) })
+	<-done
+
+	count := find(t, "test-go").Count
+	Go("test-go", func() { panic("boom") })
+	deadline := time.Now().Add(time.Second)
+	for find(t, "test-go").Count == count {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the panic to be recovered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if stat := find(t, "test-ok"); stat.Count != 0 {
+		t.Errorf("expected no panic of test-ok, got %+v", stat)
+	}
+}
+
+// find returns the stat of a name, a zero one if it has no panics
+func find(t *testing.T, name string) Stat {
+	t.Helper()
+	for _, stat := range Stats() {
+		if stat.Name == name {
+			return stat
+		}
+	}
+	return Stat{}
+}
@@ -30,8 +30,9 @@ export const HeatMap = React.memo(function HeatMap({
   const startDateStr = formatDate(firstMonday)
   const endDateStr = formatDate(lastSunday)
   const offset = (-new Date().getTimezoneOffset()).toString()
+  const tz = encodeURIComponent(Intl.DateTimeFormat().resolvedOptions().timeZone)
   const { data: counts } = useSWR<number[]>(
-    `${GET_DAILY_POST_COUNTS}?start_date=${startDateStr}&end_date=${endDateStr}&offset=${offset}`,
+    `${GET_DAILY_POST_COUNTS}?start_date=${startDateStr}&end_date=${endDateStr}&offset=${offset}&tz=${tz}`,
   )
 
   const today = formatDate()